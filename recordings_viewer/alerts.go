@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// contentAlert watches finished transcripts for words that matter, such
+// as one's own name or "deadline". Keywords match whole words or phrases,
+// ignoring case; Pattern is a regular expression, also matched ignoring
+// case. Each transcript that matches publishes "alert.matched".
+type contentAlert struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Enabled  bool     `json:"enabled"`
+}
+
+func (a *contentAlert) validate() error {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Pattern = strings.TrimSpace(a.Pattern)
+	var keywords []string
+	for _, k := range a.Keywords {
+		if k = strings.TrimSpace(k); k != "" && !slices.Contains(keywords, k) {
+			keywords = append(keywords, k)
+		}
+	}
+	a.Keywords = keywords
+	if len(a.Keywords) == 0 && a.Pattern == "" {
+		return errors.New("keywords or pattern is required")
+	}
+	if a.Pattern != "" {
+		if _, err := regexp.Compile("(?i)" + a.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+	if a.Name == "" {
+		a.Name = strings.Join(a.Keywords, ", ")
+		if a.Name == "" {
+			a.Name = a.Pattern
+		}
+	}
+	return nil
+}
+
+// terms returns what the alert looks for, as search terms.
+func (a contentAlert) terms() []searchTerm {
+	var out []searchTerm
+	for _, k := range a.Keywords {
+		out = append(out, searchTerm{lit: foldRunes(k)})
+	}
+	if a.Pattern != "" {
+		// validate compiled it already.
+		out = append(out, searchTerm{re: regexp.MustCompile("(?i)" + a.Pattern)})
+	}
+	return out
+}
+
+// alertMatch is a transcript segment an alert matched.
+type alertMatch struct {
+	Segment int     `json:"segment"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker,omitempty"`
+	Text    string  `json:"text"`
+	Matched string  `json:"matched"`
+}
+
+// match returns the segments of segs the alert matches, with the first
+// text each one matched.
+func (a contentAlert) match(segs []segment) []alertMatch {
+	terms := a.terms()
+	var out []alertMatch
+	for n, seg := range segs {
+		rs := []rune(seg.Text)
+		for _, t := range terms {
+			spans := t.find(seg.Text)
+			i := slices.IndexFunc(spans, func(sp [2]int) bool {
+				// Keywords are words: "Ann" is not in "announce".
+				return t.re != nil || wholeWord(rs, sp)
+			})
+			if i < 0 {
+				continue
+			}
+			sp := spans[i]
+			out = append(out, alertMatch{Segment: n, Start: seg.Start, End: seg.End, Speaker: seg.Speaker, Text: strings.TrimSpace(seg.Text), Matched: string(rs[sp[0] : sp[0]+sp[1]])})
+			break
+		}
+	}
+	return out
+}
+
+// wholeWord reports whether the span sp of rs neither starts nor ends
+// inside a word.
+func wholeWord(rs []rune, sp [2]int) bool {
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	start, end := sp[0], sp[0]+sp[1]
+	return (start == 0 || !isWord(rs[start-1]) || !isWord(rs[start])) &&
+		(end == len(rs) || !isWord(rs[end]) || !isWord(rs[end-1]))
+}
+
+func alertsPath() string {
+	return filepath.Join(stateDir(), "alerts.json")
+}
+
+// loadAlerts reads the alerts in the order they were added. Callers hold
+// mu.
+func loadAlerts() ([]contentAlert, error) {
+	items := []contentAlert{}
+	data, err := os.ReadFile(alertsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func saveAlerts(items []contentAlert) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(alertsPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// checkAlertsAfterTranscription runs the enabled alerts over the transcript
+// of the recording at rel once it is written, publishing "alert.matched"
+// for each alert that matches; webhooks pass it on.
+func checkAlertsAfterTranscription(rel string) {
+	mu.Lock()
+	alerts, err := loadAlerts()
+	mu.Unlock()
+	if err != nil {
+		slog.Error("alerts", "err", err)
+		return
+	}
+	if !slices.ContainsFunc(alerts, func(a contentAlert) bool { return a.Enabled }) {
+		return
+	}
+	s, err := findSession(rel)
+	if err != nil {
+		return
+	}
+	src := s.TranscriptJSON
+	if src == "" {
+		src = s.Transcript
+	}
+	if src == "" {
+		return
+	}
+	doc, err := loadTranscriptDoc(absPath(src))
+	if err != nil {
+		slog.Error("alerts", "path", src, "err", err)
+		return
+	}
+	for _, a := range alerts {
+		if !a.Enabled {
+			continue
+		}
+		if matches := a.match(doc.Segments); len(matches) > 0 {
+			slog.Info("alert matched", "alert", a.Name, "session", s.ID, "segments", len(matches))
+			publishEvent("alert.matched", rel, map[string]any{"alert": a.ID, "name": a.Name, "session": s.ID, "matches": matches})
+		}
+	}
+}
+
+// alertsHandler serves /api/alerts: GET lists the content alerts, POST adds
+// one and GET/PUT/DELETE /api/alerts/{id} manage one.
+func alertsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/alerts"), "/")
+	mu.Lock()
+	defer mu.Unlock()
+	alerts, err := loadAlerts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, alerts)
+		case http.MethodPost:
+			var a contentAlert
+			if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if err := a.validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			a.ID = randomID()
+			if err := saveAlerts(append(alerts, a)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			requestLogger(r).Info("added alert", "id", a.ID, "name", a.Name)
+			writeJSONStatus(w, http.StatusCreated, a)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	i := slices.IndexFunc(alerts, func(a contentAlert) bool { return a.ID == id })
+	if i < 0 {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, alerts[i])
+	case http.MethodPut:
+		var a contentAlert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := a.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.ID = id
+		alerts[i] = a
+		if err := saveAlerts(alerts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, a)
+	case http.MethodDelete:
+		if err := saveAlerts(slices.Delete(alerts, i, i+1)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
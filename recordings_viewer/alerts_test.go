@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func addAlert(t *testing.T, body string) contentAlert {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/alerts %s: %d %s", body, rec.Code, rec.Body)
+	}
+	var a contentAlert
+	if err := json.Unmarshal(rec.Body.Bytes(), &a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAlertsCRUD(t *testing.T) {
+	useTempBaseDir(t)
+	a := addAlert(t, `{"keywords": [" Kenobi ", "", "Kenobi", "Obi-Wan"], "enabled": true}`)
+	if a.ID == "" || a.Name != "Kenobi, Obi-Wan" || len(a.Keywords) != 2 {
+		t.Fatalf("alert = %+v", a)
+	}
+	addAlert(t, `{"name": "deadline", "pattern": "due (by|on) \\w+"}`)
+
+	for _, bad := range []string{`{"name": "nothing"}`, `{"pattern": "due (by"}`, `{`} {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader(bad)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("POST %s: %d", bad, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/alerts/"+a.ID, strings.NewReader(`{"name": "me", "keywords": ["Ann"]}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"enabled":false`) {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	var alerts []contentAlert
+	if json.Unmarshal(rec.Body.Bytes(), &alerts); len(alerts) != 2 || alerts[0].Name != "me" {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/alerts/"+a.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/alerts/"+a.ID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("GET deleted: %d", rec.Code)
+	}
+}
+
+func TestAlertMatch(t *testing.T) {
+	segs := []segment{
+		{Start: 0, End: 2, Text: " Ann will announce it."},
+		{Start: 2, End: 4, Text: " The announcement is due by Friday."},
+		{Start: 4, End: 6, Speaker: "Me", Text: " Thanks, ANN."},
+	}
+	a := contentAlert{Keywords: []string{"ann"}, Pattern: `due (by|on) \w+`}
+	got := a.match(segs)
+	if len(got) != 3 || got[0].Matched != "Ann" || got[1].Matched != "due by Friday" || got[2].Matched != "ANN" || got[2].Speaker != "Me" {
+		t.Fatalf("matches = %+v", got)
+	}
+	if got := (contentAlert{Keywords: []string{"nounce"}}).match(segs); len(got) != 0 {
+		t.Fatalf("part of a word matched: %+v", got)
+	}
+}
+
+func TestAlertsRunAfterTranscription(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "call.webm")
+	a := addAlert(t, `{"name": "jedi", "keywords": ["kenobi"], "enabled": true}`)
+	addAlert(t, `{"keywords": ["hello"]}`)
+	fakeWhisper(t, "60", func(_ context.Context, args []string) ([]byte, error) {
+		return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), "call.json"), []byte(segmentsFixture), 0o644)
+	})
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	runJob(queueTranscription(t, "call.webm"))
+
+	var alerts []serverEvent
+	for len(ch) > 0 {
+		if ev := <-ch; ev.Type == "alert.matched" {
+			alerts = append(alerts, ev)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].Data["alert"] != a.ID || alerts[0].Data["session"] != "call" {
+		t.Fatalf("alert events = %+v", alerts)
+	}
+	p := newWebhookPayload("alert.matched", alerts[0])
+	if p.Alert != "jedi" || len(p.Matches) != 1 || p.Matches[0].Start != 1.5 || p.Text != "Alert \"jedi\": call\n> General Kenobi." {
+		t.Fatalf("payload = %+v", p)
+	}
+}
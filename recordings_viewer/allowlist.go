@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// withIPAllowlist refuses requests from addresses outside
+// cfg.AllowedNetworks, so a server listening on the LAN for a phone is not
+// open to every device on it. Loopback is always allowed, and an empty list
+// allows everyone.
+func withIPAllowlist(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nets := cfg().AllowedNetworks; len(nets) > 0 && !clientAllowed(r.RemoteAddr, nets) {
+			requestLogger(r).Warn("refused client outside allowed networks", "remote", r.RemoteAddr)
+			http.Error(w, "address not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func clientAllowed(remoteAddr string, nets []netip.Prefix) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap().WithZone("")
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, p := range nets {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// listensBeyondLoopback reports whether the listen address addr accepts
+// connections from other machines.
+func listensBeyondLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return true
+	}
+	if strings.EqualFold(host, "localhost") {
+		return false
+	}
+	ip, err := netip.ParseAddr(host)
+	return err != nil || !ip.IsLoopback()
+}
+
+// warnOpenListen logs when the server is reachable from the network by
+// anyone, as it is by default.
+func warnOpenListen() {
+	c := cfg()
+	if listensBeyondLoopback(c.Listen) && len(c.AllowedNetworks) == 0 {
+		slog.Warn("listening beyond loopback without VIEWER_ALLOWED_NETWORKS; every host that can reach the port may use the API", "addr", c.Listen)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAllowlistRefusesOtherNetworks(t *testing.T) {
+	t.Setenv("VIEWER_ALLOWED_NETWORKS", "192.168.1.0/24, fd00::/8, 10.0.0.7, bogus")
+	nets := loadConfigFromEnv().AllowedNetworks
+	if len(nets) != 3 || nets[2].String() != "10.0.0.7/32" {
+		t.Fatalf("networks=%v", nets)
+	}
+	useConfig(t, func(c *config) { c.AllowedNetworks = nets })
+	h := withIPAllowlist(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for remote, want := range map[string]int{
+		"192.168.1.23:50000":        http.StatusOK,
+		"[::ffff:192.168.1.9]:1234": http.StatusOK,
+		"[fd12::3]:1234":            http.StatusOK,
+		"10.0.0.7:1234":             http.StatusOK,
+		"127.0.0.1:1234":            http.StatusOK,
+		"[::1]:1234":                http.StatusOK,
+		"10.0.0.8:1234":             http.StatusForbidden,
+		"192.168.2.1:1234":          http.StatusForbidden,
+		"garbage":                   http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: status=%d want %d", remote, rec.Code, want)
+		}
+	}
+
+	useConfig(t, func(c *config) { c.AllowedNetworks = nil })
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("without a list: status=%d", rec.Code)
+	}
+}
+
+func TestListensBeyondLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		":8080":          true,
+		"0.0.0.0:8080":   true,
+		"192.168.1.2:80": true,
+		"127.0.0.1:8080": false,
+		"[::1]:8080":     false,
+		"localhost:8080": false,
+	} {
+		if got := listensBeyondLoopback(addr); got != want {
+			t.Errorf("%s: %v want %v", addr, got, want)
+		}
+	}
+}
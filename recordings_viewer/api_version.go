@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiV1Prefix is the versioned namespace of the HTTP API. Every /api/ route
+// is served under it too, and openapi.json lists the versioned paths; the
+// unversioned ones stay as aliases for clients written before it.
+const apiV1Prefix = "/api/v1"
+
+// unversionedPath maps /api/v1/x to the /api/x route that serves it and
+// returns other paths as they are.
+func unversionedPath(p string) string {
+	if rest, ok := strings.CutPrefix(p, apiV1Prefix+"/"); ok {
+		return "/api/" + rest
+	}
+	return p
+}
+
+// apiV1Handler serves /api/v1/ by handing each request to mux under its
+// unversioned path, so handlers that parse IDs out of the path see the
+// same path either way.
+func apiV1Handler(mux *http.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = unversionedPath(r.URL.Path)
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = unversionedPath(r.URL.RawPath)
+		}
+		w.Header().Set("API-Version", "1")
+		mux.ServeHTTP(w, r2)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Artifact kinds in a session's artifact map.
+const (
+	artifactAudio          = "audio"
+	artifactTranscriptJSON = "transcript_json"
+	artifactTranscriptTxt  = "transcript_txt"
+	artifactSRT            = "srt"
+	artifactSummary        = "summary"
+	artifactWaveform       = "waveform"
+	artifactNotes          = "notes"
+	artifactEnhanced       = "enhanced"
+	artifactSpectrogram    = "spectrogram"
+)
+
+// artifactInfix marks the derived files written next to a recording:
+// foo.summary.md, foo.waveform.json, foo.spectrogram.png, foo.notes.txt,
+// and the cleaned copy of its audio, foo.enhanced.flac. They pair with the
+// recording like its transcripts do.
+var artifactInfix = regexp.MustCompile(`\.(summary|waveform|spectrogram|notes|enhanced)$`)
+
+// artifactSources names the artifact each kind is derived from; an
+// artifact older than its source is stale. Notes are written by hand and
+// never go stale.
+var artifactSources = map[string][]string{
+	artifactTranscriptJSON: {artifactAudio},
+	artifactTranscriptTxt:  {artifactAudio},
+	artifactSRT:            {artifactTranscriptJSON, artifactTranscriptTxt},
+	artifactSummary:        {artifactTranscriptTxt, artifactTranscriptJSON},
+	artifactWaveform:       {artifactAudio},
+	artifactSpectrogram:    {artifactAudio},
+	artifactEnhanced:       {artifactAudio},
+}
+
+// artifact is one file of a recording as clients should fetch it. Generated
+// artifacts have no file and are rendered by the server on request.
+type artifact struct {
+	Path      string    `json:"path,omitempty"`
+	URL       string    `json:"url"`
+	UpdatedAt time.Time `json:"updatedAt,omitzero"`
+	Generated bool      `json:"generated,omitempty"`
+	// Fresh is false when the artifact is older than what it was derived
+	// from, e.g. a transcript made before the audio was replaced.
+	Fresh bool `json:"fresh"`
+}
+
+// artifactKind returns the artifact kind of a session file by naming
+// convention, or "" for files that are not artifacts (sidecar metadata).
+func artifactKind(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if m := artifactInfix.FindStringSubmatch(strings.TrimSuffix(name, path.Ext(name))); m != nil {
+		return m[1]
+	}
+	switch {
+	case isMetaFile(name):
+		return ""
+	case audioExts[ext]:
+		return artifactAudio
+	case ext == ".txt":
+		return artifactTranscriptTxt
+	case ext == ".json":
+		return artifactTranscriptJSON
+	case ext == ".srt":
+		return artifactSRT
+	}
+	return ""
+}
+
+// isArtifactFile reports whether name is a file sessions collect.
+func isArtifactFile(name string) bool {
+	return artifactKind(name) != "" || isMetaFile(name)
+}
+
+// recordingsURL is the /recordings/ URL of a recordings path.
+func recordingsURL(rel string) string {
+	parts := strings.Split(rel, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return "/recordings/" + strings.Join(parts, "/")
+}
+
+// setArtifacts fills s.Artifacts from its files. Where there is no .srt
+// file but a JSON transcript, the srt export is offered as a generated
+// artifact. Artifacts the server regenerated are judged by the records in
+// derived; others by modification time.
+func (s *session) setArtifacts(derived map[string]derivedRecord) {
+	s.Artifacts = map[string]artifact{}
+	for _, f := range s.Files {
+		kind := artifactKind(path.Base(f))
+		if kind == "" {
+			continue
+		}
+		// Split recordings list the first part; the rest are in Parts.
+		if kind == artifactAudio && f != s.Audio {
+			continue
+		}
+		if prev, ok := s.Artifacts[kind]; ok && !s.modTimes[f].After(prev.UpdatedAt) {
+			continue
+		}
+		s.Artifacts[kind] = artifact{Path: f, URL: recordingsURL(f), UpdatedAt: s.modTimes[f]}
+	}
+	if _, ok := s.Artifacts[artifactSRT]; !ok && s.TranscriptJSON != "" {
+		s.Artifacts[artifactSRT] = artifact{
+			URL:       "/api/transcripts/" + strings.TrimPrefix(recordingsURL(s.TranscriptJSON), "/recordings/") + "/export?format=srt",
+			Generated: true,
+		}
+	}
+	for kind, a := range s.Artifacts {
+		a.Fresh = true
+		if !a.Generated {
+			for _, src := range artifactSources[kind] {
+				if from, ok := s.Artifacts[src]; ok && !from.Generated {
+					a.Fresh = derivedFreshness(derived, a, from)
+					break
+				}
+			}
+		}
+		s.Artifacts[kind] = a
+	}
+}
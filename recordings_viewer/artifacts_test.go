@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionArtifacts(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm", "call.json", "call.txt", "call.summary.md", "call.notes.txt", "call.meta.json")
+	// The audio was replaced after it was transcribed.
+	old := time.Now().Add(-time.Hour)
+	for _, f := range []string{"call.json", "call.txt"} {
+		if err := os.Chtimes(filepath.Join(dir, f), old, old); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	sessions, err := scanSessions()
+	if err != nil {
+		t.Fatalf("scanSessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("sessions=%+v want 1", sessions)
+	}
+	s := sessions[0]
+	if s.Transcript != "call.txt" || s.TranscriptJSON != "call.json" {
+		t.Fatalf("summary or notes taken for a transcript: %+v", s)
+	}
+	a := s.Artifacts
+	if len(a) != 6 {
+		t.Fatalf("artifacts=%+v", a)
+	}
+	if a[artifactAudio].URL != "/recordings/call.webm" || !a[artifactAudio].Fresh {
+		t.Fatalf("audio=%+v", a[artifactAudio])
+	}
+	if a[artifactTranscriptJSON].Fresh || a[artifactTranscriptTxt].Fresh {
+		t.Fatalf("transcripts older than the audio reported fresh: %+v", a)
+	}
+	if !a[artifactSummary].Fresh || a[artifactSummary].Path != "call.summary.md" {
+		t.Fatalf("summary=%+v", a[artifactSummary])
+	}
+	if a[artifactNotes].Path != "call.notes.txt" || !a[artifactNotes].Fresh {
+		t.Fatalf("notes=%+v", a[artifactNotes])
+	}
+	srt := a[artifactSRT]
+	if !srt.Generated || srt.URL != "/api/transcripts/call.json/export?format=srt" {
+		t.Fatalf("srt=%+v", srt)
+	}
+}
+
+func TestRecordingStemStripsArtifactInfix(t *testing.T) {
+	for name, want := range map[string]string{
+		"foo.summary.md":       "foo",
+		"foo.waveform.json":    "foo",
+		"foo.part001.webm":     "foo",
+		"foo.meta.json":        "foo",
+		"foo.summary-notes.md": "foo.summary-notes",
+	} {
+		if got := recordingStem(name); got != want {
+			t.Errorf("recordingStem(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// viewerAssets bundles the static viewer UI so the binary can run from any
+// working directory.
+//
+//go:embed index.html
+var viewerAssets embed.FS
+
+// assetsHandler serves the embedded viewer UI. Setting VIEWER_ASSETS_DIR serves
+// files from that directory instead, which is handy while editing the UI.
+func assetsHandler() http.Handler {
+	if dir := getenv("VIEWER_ASSETS_DIR"); dir != "" {
+		return http.FileServer(http.Dir(dir))
+	}
+	return http.FileServer(http.FS(fs.FS(viewerAssets)))
+}
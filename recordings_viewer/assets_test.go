@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssetsHandlerServesEmbeddedIndex(t *testing.T) {
+	t.Setenv("VIEWER_ASSETS_DIR", "")
+	rec := httptest.NewRecorder()
+	assetsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusOK)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "<title>Recordings Viewer</title>") {
+		t.Fatalf("embedded index.html not served")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// chapter is a titled span of a recording, in seconds. Detected chapters
+// (see chapters.go) also have Cues, what marked their start: a long
+// "silence", a "topic" shift in the transcript, or both.
+type chapter struct {
+	Start float64  `json:"start"`
+	End   float64  `json:"end"`
+	Title string   `json:"title"`
+	Cues  []string `json:"cues,omitempty"`
+}
+
+// audioTags are the descriptive tags written into an audio container.
+type audioTags struct {
+	Title    string    `json:"title,omitempty"`
+	Date     string    `json:"date,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Chapters []chapter `json:"chapters,omitempty"`
+}
+
+// ffmetadataEscape escapes the characters FFMETADATA treats specially.
+func ffmetadataEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+	return r.Replace(s)
+}
+
+// ffmetadata renders tags in ffmpeg's FFMETADATA1 format, which carries both
+// global tags and chapters. ffmpeg maps the keys onto ID3 frames for mp3,
+// Vorbis comments for ogg/opus and Matroska tags for webm.
+func (t audioTags) ffmetadata() string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, kv := range [][2]string{{"title", t.Title}, {"date", t.Date}, {"url", t.URL}, {"comment", t.Comment}} {
+		if kv[1] != "" {
+			fmt.Fprintf(&b, "%s=%s\n", kv[0], ffmetadataEscape(kv[1]))
+		}
+	}
+	for _, c := range t.Chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(c.Start*1000), int64(c.End*1000), ffmetadataEscape(c.Title))
+	}
+	return b.String()
+}
+
+// writeAudioTags remuxes fullPath without re-encoding, replacing its tags and
+// chapters, and swaps the result in atomically. Callers must hold mu.
+func writeAudioTags(ctx context.Context, fullPath string, tags audioTags) error {
+	if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+		return err
+	}
+	metaFile := filepath.Join(tempDir(), "tags-"+randomID()+".txt")
+	if err := os.WriteFile(metaFile, []byte(tags.ffmetadata()), 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(metaFile)
+
+	// Remux into the scratch dir (same volume as baseDir) so a crash never
+	// leaves a half-written file that looks like a recording.
+	tmp := filepath.Join(tempDir(), "remux-"+randomID()+filepath.Ext(fullPath))
+	defer os.Remove(tmp)
+	out, err := runCommandFunc(ctx, cfg().FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", fullPath, "-i", metaFile,
+		"-map", "0", "-map_metadata", "1", "-map_chapters", "1",
+		"-c", "copy",
+		tmp,
+	)
+	if err != nil {
+		return fmt.Errorf("ffmpeg tag %s: %v: %s", filepath.Base(fullPath), err, outputTail(out))
+	}
+	if err := os.Rename(tmp, fullPath); err != nil {
+		return err
+	}
+	trackFiles(fullPath)
+	return nil
+}
+
+// defaultAudioTags derives tags for a session from what the library knows.
+func defaultAudioTags(s *session) audioTags {
+	tags := audioTags{Title: recordingStem(filepath.Base(s.ID)), Date: s.RecordedDay}
+	if tags.Date == "" {
+		tags.Date = s.CreatedAt.UTC().Format("2006-01-02")
+	}
+	if meta, err := loadMeta(s.metaPath()); err == nil {
+		if meta.Transcription != nil {
+			tags.Comment = fmt.Sprintf("Transcribed with %s (%s)", meta.Transcription.Engine, meta.Transcription.Model)
+		}
+		if meta.Chapters != nil {
+			tags.Chapters = meta.Chapters.Chapters
+		}
+	}
+	return tags
+}
+
+// tagAudioHandler serves POST /api/transcripts/{path}/tag-audio. The body may
+// override any of title, date, url, comment and chapters; missing fields are
+// derived from the session.
+func tagAudioHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	var override audioTags
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	s, err := findSession(rel)
+	if err != nil || s.Audio == "" {
+		http.Error(w, "audio not found", http.StatusNotFound)
+		return
+	}
+	tags := mergeAudioTags(defaultAudioTags(s), override)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := writeAudioTags(r.Context(), absPath(s.Audio), tags); err != nil {
+		requestLogger(r).Error("tag audio", "path", s.Audio, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("wrote audio tags", "path", s.Audio)
+	publishEvent("recording.tagged", s.Audio, nil)
+	writeJSON(w, tags)
+}
+
+func mergeAudioTags(base, override audioTags) audioTags {
+	if override.Title != "" {
+		base.Title = override.Title
+	}
+	if override.Date != "" {
+		base.Date = override.Date
+	}
+	if override.URL != "" {
+		base.URL = override.URL
+	}
+	if override.Comment != "" {
+		base.Comment = override.Comment
+	}
+	if override.Chapters != nil {
+		base.Chapters = override.Chapters
+	}
+	return base
+}
+
+// tagTranscribedAudio applies default tags after a transcription job when
+// cfg.WriteAudioTags is enabled. Failures are logged, not fatal to the job.
+func tagTranscribedAudio(rel string) {
+	s, err := findSession(rel)
+	if err != nil || s.Audio == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := writeAudioTags(context.Background(), absPath(s.Audio), defaultAudioTags(s)); err != nil {
+		slog.Error("tag audio", "path", s.Audio, "err", err)
+	}
+}
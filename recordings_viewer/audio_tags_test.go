@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFFMetadataEscapesAndChapters(t *testing.T) {
+	tags := audioTags{
+		Title:    "Q3 = plan; #1",
+		URL:      "https://meet.example/abc",
+		Chapters: []chapter{{Start: 0, End: 61.5, Title: "Intro"}},
+	}
+	got := tags.ffmetadata()
+	want := ";FFMETADATA1\ntitle=Q3 \\= plan\\; \\#1\nurl=https://meet.example/abc\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=61500\ntitle=Intro\n"
+	if got != want {
+		t.Fatalf("ffmetadata=\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestTagAudioHandlerRemuxesInPlace(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "standup.webm", "standup.txt")
+	useConfig(t, func(c *config) { c.FFmpegPath = "ffmpeg" })
+	var metadata string
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		data, err := os.ReadFile(args[argIndex(args, "-i", 2)+1])
+		if err != nil {
+			return nil, err
+		}
+		metadata = string(data)
+		return nil, os.WriteFile(args[len(args)-1], []byte("tagged"), 0o644)
+	})
+
+	body := `{"url":"https://meet.example/abc","chapters":[{"start":0,"end":30,"title":"Intro"}]}`
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/transcripts/standup.txt/tag-audio", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	for _, want := range []string{"title=standup", "url=https://meet.example/abc", "[CHAPTER]", "title=Intro", "date="} {
+		if !strings.Contains(metadata, want) {
+			t.Fatalf("metadata missing %q:\n%s", want, metadata)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "standup.webm")); string(data) != "tagged" {
+		t.Fatalf("audio not replaced, got %q", data)
+	}
+}
+
+// argIndex returns the index of the nth (1-based) occurrence of flag in args.
+func argIndex(args []string, flag string, nth int) int {
+	for i, a := range args {
+		if a == flag {
+			nth--
+			if nth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditEntry is an event kept for the operator in audit.jsonl in the
+// state directory: a security-relevant one, such as a rejected credential,
+// or a change to the recordings, with the client that made it. Only
+// changes are served, by GET /api/audit; security events never are.
+type auditEntry struct {
+	Time   time.Time      `json:"time"`
+	Event  string         `json:"event"`
+	Client string         `json:"client,omitempty"`
+	Data   map[string]any `json:"data,omitempty"`
+}
+
+// auditSecurityPrefix starts the events GET /api/audit leaves out.
+const auditSecurityPrefix = "auth."
+
+var auditMu sync.Mutex
+
+func auditLogPath() string {
+	return filepath.Join(stateDir(), "audit.jsonl")
+}
+
+// audit appends an entry to the audit log and mirrors it to the server
+// log. Failures to persist are logged rather than surfaced.
+func audit(event, client string, data map[string]any) {
+	args := []any{"event", event, "client", client}
+	for k, v := range data {
+		args = append(args, k, v)
+	}
+	slog.Warn("audit", args...)
+	appendAudit(auditEntry{Time: time.Now().UTC(), Event: event, Client: client, Data: data})
+}
+
+// auditChange records a change r made to the recordings file rel, such as
+// its SHA-256 "before" and "after" ("" for none). The request log already
+// has it, so it is not logged again.
+func auditChange(r *http.Request, event, rel string, data map[string]any) {
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["method"], data["path"] = r.Method, filepath.ToSlash(rel)
+	if agent := r.UserAgent(); agent != "" {
+		data["agent"] = agent
+	}
+	appendAudit(auditEntry{Time: time.Now().UTC(), Event: event, Client: clientAddr(r), Data: data})
+}
+
+func appendAudit(e auditEntry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		slog.Error("persist audit entry", "err", err)
+		return
+	}
+	f, err := os.OpenFile(auditLogPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Error("persist audit entry", "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Error("persist audit entry", "err", err)
+	}
+}
+
+// withAuditTrail records every request that writes in the audit log as a
+// "request" entry, with its method, path, status and user agent, once the
+// handler returns.
+func withAuditTrail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWriteMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		data := map[string]any{"method": r.Method, "path": r.URL.Path, "status": status}
+		if agent := r.UserAgent(); agent != "" {
+			data["agent"] = agent
+		}
+		appendAudit(auditEntry{Time: time.Now().UTC(), Event: "request", Client: clientAddr(r), Data: data})
+	})
+}
+
+// auditFilter selects entries of the audit log for GET /api/audit.
+type auditFilter struct {
+	event, client, path string
+	since, until        time.Time
+}
+
+func (f auditFilter) matches(e auditEntry) bool {
+	if strings.HasPrefix(e.Event, auditSecurityPrefix) {
+		return false
+	}
+	if f.event != "" && e.Event != f.event || f.client != "" && e.Client != f.client {
+		return false
+	}
+	if !f.since.IsZero() && e.Time.Before(f.since) || !f.until.IsZero() && !e.Time.Before(f.until) {
+		return false
+	}
+	if f.path == "" {
+		return true
+	}
+	for _, k := range []string{"path", "to"} {
+		p, _ := e.Data[k].(string)
+		if e.Event == "request" {
+			// The URL path of a request to a file, or to an action on it.
+			p = strings.TrimPrefix(strings.TrimPrefix(p, "/api/v1"), "/api/transcripts/")
+		}
+		if p == f.path || strings.HasPrefix(p, f.path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readAuditLog returns the entries f matches, newest first, at most limit
+// of them when limit is positive.
+func readAuditLog(f auditFilter, limit int) ([]auditEntry, error) {
+	auditMu.Lock()
+	data, err := os.ReadFile(auditLogPath())
+	auditMu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return []auditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	out := []auditEntry{}
+	for i := len(lines) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		var e auditEntry
+		if json.Unmarshal([]byte(lines[i]), &e) != nil || !f.matches(e) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// auditHandler serves GET /api/audit: the changes recorded in the audit
+// log, newest first. ?path= keeps those of a recordings file or folder,
+// ?event=, ?client=, ?since= and ?until= (RFC 3339) narrow them further,
+// and ?limit= (default 100, 0 for all) caps them. With cfg.AuthToken set
+// it needs the token, as writes do, since it shows who made each change.
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorized(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	f := auditFilter{event: q.Get("event"), client: q.Get("client"), path: strings.Trim(q.Get("path"), "/")}
+	for _, b := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.since}, {"until", &f.until}} {
+		if v := q.Get(b.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, b.name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*b.t = t
+		}
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "limit must be a number of entries, 0 for all", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	entries, err := readAuditLog(f, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entries)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sumOf is the hex SHA-256 of s, as the audit log records it.
+func sumOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuditTrail(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useAuthGuard(t)
+	useConfig(t, func(c *config) { c.AuthToken, c.AuthMaxFailures = "letmein", 0 })
+	os.WriteFile(filepath.Join(dir, "call.txt"), []byte("first draft\n"), 0o644)
+	h := withAuth(withAuditTrail(newMux()))
+	do := func(method, target, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.7:1234"
+		req.Header.Set("User-Agent", "recorder/1.0")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/api/transcripts/call.txt", "second draft\n", "letmein"); rec.Code != http.StatusNoContent {
+		t.Fatalf("put = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/transcripts/call.txt/rename", `{"name": "standup"}`, "letmein"); rec.Code != http.StatusOK {
+		t.Fatalf("rename = %d %s", rec.Code, rec.Body)
+	}
+	do(http.MethodPut, "/api/transcripts/standup.txt", "sneaky\n", "wrong")
+
+	if rec := do(http.MethodGet, "/api/audit", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("audit without token = %d", rec.Code)
+	}
+	rec := do(http.MethodGet, "/api/audit?path=call.txt", "", "letmein")
+	var entries []auditEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("audit = %d %s", rec.Code, rec.Body)
+	}
+	var events []string
+	for _, e := range entries {
+		events = append(events, e.Event)
+		if e.Client != "192.0.2.7" {
+			t.Errorf("%s client = %q", e.Event, e.Client)
+		}
+	}
+	// Newest first, each request after the changes it made.
+	if strings.Join(events, " ") != "request file.renamed request file.updated" {
+		t.Fatalf("events = %v", events)
+	}
+	renamed, updated := entries[1].Data, entries[3].Data
+	if renamed["to"] != "standup.txt" || renamed["after"] != sumOf("second draft\n") {
+		t.Errorf("rename entry = %v", renamed)
+	}
+	if updated["before"] != sumOf("first draft\n") || updated["after"] != sumOf("second draft\n") || updated["agent"] != "recorder/1.0" {
+		t.Errorf("update entry = %v", updated)
+	}
+
+	rec = do(http.MethodGet, "/api/audit?event=request&limit=1", "", "letmein")
+	entries = nil
+	json.Unmarshal(rec.Body.Bytes(), &entries)
+	if len(entries) != 1 || entries[0].Data["status"] != float64(http.StatusOK) || entries[0].Data["path"] != "/api/transcripts/call.txt/rename" {
+		t.Fatalf("request entries = %+v", entries)
+	}
+	rec = do(http.MethodGet, "/api/audit?limit=0", "", "letmein")
+	if strings.Contains(rec.Body.String(), "auth.failed") || strings.Contains(rec.Body.String(), "sneaky") {
+		t.Fatalf("audit serves security events: %s", rec.Body)
+	}
+	if rec := do(http.MethodGet, "/api/audit?since=yesterday", "", "letmein"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad since = %d", rec.Code)
+	}
+}
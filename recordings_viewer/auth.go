@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authBackoffBase is how long a client waits after its first wrong token;
+// each further failure doubles it, up to cfg.AuthLockout.
+const authBackoffBase = time.Second
+
+// authFailure is the record of a client's recent wrong tokens.
+type authFailure struct {
+	count        int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// authFailures tracks failed attempts per client address so that guessing
+// the token from the network is slowed down and then locked out.
+type authFailures struct {
+	mu      sync.Mutex
+	clients map[string]*authFailure
+	swept   time.Time
+}
+
+var authGuard = &authFailures{clients: map[string]*authFailure{}}
+
+// blocked reports whether client must wait before its token is checked
+// again, and for how long.
+func (g *authFailures) blocked(client string, now time.Time) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f, ok := g.clients[client]
+	if !ok || !now.Before(f.blockedUntil) {
+		return false, 0
+	}
+	return true, f.blockedUntil.Sub(now)
+}
+
+// fail records a wrong token from client. After each failure the client
+// backs off exponentially; the maxFailures-th locks it out for lockout.
+// Failures older than lockout are forgotten. It returns the failure count,
+// the wait imposed and whether it is a lockout.
+func (g *authFailures) fail(client string, now time.Time, maxFailures int, lockout time.Duration) (int, time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.swept) > time.Minute {
+		for k, f := range g.clients {
+			if now.Sub(f.last) > lockout && !now.Before(f.blockedUntil) {
+				delete(g.clients, k)
+			}
+		}
+		g.swept = now
+	}
+	f, ok := g.clients[client]
+	if !ok || now.Sub(f.last) > lockout {
+		f = &authFailure{}
+		g.clients[client] = f
+	}
+	f.count++
+	f.last = now
+	if f.count >= maxFailures {
+		f.blockedUntil = now.Add(lockout)
+		return f.count, lockout, true
+	}
+	wait := authBackoffBase << (f.count - 1)
+	if wait > lockout {
+		wait = lockout
+	}
+	f.blockedUntil = now.Add(wait)
+	return f.count, wait, false
+}
+
+// succeed clears client's failures.
+func (g *authFailures) succeed(client string) {
+	g.mu.Lock()
+	delete(g.clients, client)
+	g.mu.Unlock()
+}
+
+// withAuth requires cfg.AuthToken as a bearer token on every request that
+// writes, when one is configured, and on WebSocket upgrades, which start
+// processes. Reads stay open so the viewer and its <audio> elements work
+// without credentials.
+func withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (!isWriteMethod(r.Method) && !isWebSocketUpgrade(r)) || authorized(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// requestToken returns the bearer token r carries. Browsers cannot set
+// headers on a WebSocket handshake, so upgrades may pass it as ?token=.
+func requestToken(r *http.Request) (string, bool) {
+	if got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return got, true
+	}
+	if isWebSocketUpgrade(r) && r.URL.Query().Has("token") {
+		return r.URL.Query().Get("token"), true
+	}
+	return "", false
+}
+
+// authorized checks r's bearer token against cfg.AuthToken, when one is
+// configured, and answers r itself when it is refused. Wrong tokens are
+// recorded in the audit log, and with cfg.AuthMaxFailures set the client
+// is made to back off and then locked out (see authFailures).
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	c := cfg()
+	token := c.AuthToken
+	if token == "" {
+		return true
+	}
+	client, now := clientAddr(r), time.Now()
+	guard := c.AuthMaxFailures > 0
+	if guard {
+		if blocked, wait := authGuard.blocked(client, now); blocked {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many failed attempts", http.StatusTooManyRequests)
+			return false
+		}
+	}
+	got, ok := requestToken(r)
+	if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) != 1 {
+		data := map[string]any{"method": r.Method, "path": r.URL.Path}
+		if guard {
+			n, wait, locked := authGuard.fail(client, now, c.AuthMaxFailures, c.AuthLockout)
+			data["failures"] = n
+			if locked {
+				data["until"] = now.Add(wait).UTC().Format(time.RFC3339)
+				audit("auth.lockout", client, data)
+			} else {
+				audit("auth.failed", client, data)
+			}
+		} else {
+			audit("auth.failed", client, data)
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="recordings-viewer"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if guard {
+		authGuard.succeed(client)
+	}
+	return true
+}
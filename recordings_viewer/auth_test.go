@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAuthGuard starts the test with no failed attempts recorded.
+func useAuthGuard(t *testing.T) {
+	t.Helper()
+	orig := authGuard
+	authGuard = &authFailures{clients: map[string]*authFailure{}}
+	t.Cleanup(func() { authGuard = orig })
+}
+
+func TestWithAuthGuardsWrites(t *testing.T) {
+	useTempBaseDir(t)
+	useAuthGuard(t)
+	useConfig(t, func(c *config) { c.AuthToken = "letmein" })
+	h := withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+
+	cases := []struct {
+		method, auth string
+		want         int
+	}{
+		{http.MethodGet, "", http.StatusNoContent},
+		{http.MethodPut, "", http.StatusUnauthorized},
+		{http.MethodPut, "Bearer nope", http.StatusUnauthorized},
+		{http.MethodPost, "Bearer letmein", http.StatusNoContent},
+		{http.MethodDelete, "letmein", http.StatusUnauthorized},
+	}
+	for i, c := range cases {
+		req := httptest.NewRequest(c.method, "/api/transcripts/a.txt", nil)
+		// One client each, so earlier failures do not make it back off.
+		req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s %q: status=%d want %d", c.method, c.auth, rec.Code, c.want)
+		}
+	}
+}
+
+func TestWithAuthDisabledWithoutToken(t *testing.T) {
+	useConfig(t, func(c *config) { c.AuthToken = "" })
+	h := withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/a.txt", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status=%d", rec.Code)
+	}
+}
+
+func TestWithAuthBacksOffAndLocksOut(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useAuthGuard(t)
+	useConfig(t, func(c *config) { c.AuthToken = "letmein"; c.AuthMaxFailures = 3; c.AuthLockout = time.Hour })
+	h := withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	try := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/transcripts/a.txt", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := try("Bearer nope"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("first failure: %d", rec.Code)
+	}
+	// Even the right token waits out the backoff.
+	if rec := try("Bearer letmein"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("during backoff: %d retry=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	now := time.Now()
+	for i := 2; i <= 3; i++ {
+		n, wait, locked := authGuard.fail("192.0.2.1", now, 3, time.Hour)
+		if n != i || locked != (i == 3) {
+			t.Fatalf("failure %d: n=%d locked=%v", i, n, locked)
+		}
+		if want := time.Duration(1<<(i-1)) * time.Second; !locked && wait != want {
+			t.Fatalf("failure %d: wait=%s want %s", i, wait, want)
+		}
+		now = now.Add(wait)
+	}
+	if blocked, wait := authGuard.blocked("192.0.2.1", now.Add(-time.Minute)); !blocked || wait != time.Minute {
+		t.Fatalf("lockout: blocked=%v wait=%s", blocked, wait)
+	}
+	if blocked, _ := authGuard.blocked("192.0.2.2", now); blocked {
+		t.Fatal("other clients must not be locked out")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ".viewer", "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"event":"auth.failed","client":"192.0.2.1"`) {
+		t.Fatalf("audit log=%s", data)
+	}
+}
+
+func TestWithAuthLockoutLogsAndClearsOnSuccess(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useAuthGuard(t)
+	useConfig(t, func(c *config) { c.AuthToken = "letmein"; c.AuthMaxFailures = 1; c.AuthLockout = time.Hour })
+	h := withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	req := httptest.NewRequest(http.MethodPost, "/api/transcribe", nil)
+	req.Header.Set("Authorization", "Bearer nope")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	data, _ := os.ReadFile(filepath.Join(dir, ".viewer", "audit.jsonl"))
+	if !strings.Contains(string(data), `"event":"auth.lockout"`) || !strings.Contains(string(data), `"path":"/api/transcribe"`) {
+		t.Fatalf("audit log=%s", data)
+	}
+
+	authGuard.succeed("192.0.2.1")
+	req = httptest.NewRequest(http.MethodPost, "/api/transcribe", nil)
+	req.Header.Set("Authorization", "Bearer letmein")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("after clearing: %d", rec.Code)
+	}
+}
+
+func TestWithAuthGuardsWebSocketUpgrades(t *testing.T) {
+	useTempBaseDir(t)
+	useAuthGuard(t)
+	useConfig(t, func(c *config) { c.AuthToken = "letmein" })
+	h := withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusSwitchingProtocols) }))
+
+	for i, c := range []struct {
+		url, auth string
+		want      int
+	}{
+		{"/ws/transcribe", "", http.StatusUnauthorized},
+		{"/ws/transcribe?token=nope", "", http.StatusUnauthorized},
+		{"/ws/transcribe?token=letmein", "", http.StatusSwitchingProtocols},
+		{"/ws/transcribe", "Bearer letmein", http.StatusSwitchingProtocols},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.url, nil)
+		req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s %q: status=%d want %d", c.url, c.auth, rec.Code, c.want)
+		}
+	}
+
+	// A token in the query string only counts for upgrades.
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/a.txt?token=letmein", nil)
+	req.RemoteAddr = "192.0.2.99:1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("PUT with ?token= status=%d", rec.Code)
+	}
+}
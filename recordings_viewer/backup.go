@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backedUpFile is what the last successful backup copied of one file.
+type backedUpFile struct {
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	BackedUpAt time.Time `json:"backedUpAt"`
+}
+
+type backupFailure struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// backupReport is the outcome of one backup run. Removed files are gone
+// locally but stay on the target; backups only ever add.
+type backupReport struct {
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt time.Time        `json:"finishedAt"`
+	Scanned    int              `json:"scanned"`
+	Unchanged  int              `json:"unchanged"`
+	Copied     []string         `json:"copied"`
+	Bytes      int64            `json:"bytes"`
+	Verified   int              `json:"verified"`
+	Failed     []backupFailure  `json:"failed"`
+	Mismatched []verifyMismatch `json:"mismatched"`
+	Removed    []string         `json:"removed"`
+}
+
+// backupState is persisted in .viewer/backup.json between runs. Target
+// names the target Files were copied to.
+type backupState struct {
+	Target        string                  `json:"target,omitempty"`
+	Files         map[string]backedUpFile `json:"files"`
+	LastReport    *backupReport           `json:"lastReport,omitempty"`
+	LastSuccessAt time.Time               `json:"lastSuccessAt,omitzero"`
+}
+
+var errBackupUnconfigured = errors.New("no backup target configured")
+
+// backupRunning keeps a scheduled and a requested backup from overlapping.
+var backupRunning sync.Mutex
+
+func backupStatePath() string {
+	return filepath.Join(stateDir(), "backup.json")
+}
+
+func loadBackupState() (backupState, error) {
+	state := backupState{Files: map[string]backedUpFile{}}
+	data, err := os.ReadFile(backupStatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	if state.Files == nil {
+		state.Files = map[string]backedUpFile{}
+	}
+	return state, nil
+}
+
+func saveBackupState(state backupState) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	_, err = writeFileAtomic(backupStatePath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// expandCommand fills the {src} (local file) and {path} (recordings path)
+// placeholders of a configured command. Arguments are split before
+// substitution, so paths with spaces need no quoting.
+func expandCommand(tmpl []string, src, rel string) []string {
+	r := strings.NewReplacer("{src}", src, "{path}", rel)
+	out := make([]string, len(tmpl))
+	for i, arg := range tmpl {
+		out[i] = r.Replace(arg)
+	}
+	return out
+}
+
+// sha256Hex finds a SHA-256 in the output of a verify command, such as
+// `rclone hashsum sha256` or `ssh host sha256sum`.
+var sha256Hex = regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`)
+
+// backupCandidate is a local file and its current checksum.
+type backupCandidate struct {
+	rel, full string
+	sum       fileChecksum
+}
+
+// collectBackupCandidates lists every recording file with its SHA-256,
+// taken from the checksum index when the file still has the indexed size
+// and modification time, and hashed otherwise.
+func collectBackupCandidates() ([]backupCandidate, error) {
+	mu.Lock()
+	index, err := loadChecksums()
+	mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var out []backupCandidate
+	err = walkRecordings(func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		key := checksumKey(p)
+		if d.IsDir() {
+			if key == "" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if key == "" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		sum := fileChecksum{Size: info.Size(), ModTime: info.ModTime().UTC()}
+		if c, ok := index[key]; ok && c.Size == sum.Size && c.ModTime.Equal(sum.ModTime) {
+			sum.SHA256 = c.SHA256
+		} else if sum.SHA256, err = hashFile(p); err != nil {
+			return nil
+		}
+		out = append(out, backupCandidate{rel: key, full: p, sum: sum})
+		return nil
+	})
+	return out, err
+}
+
+// runBackup copies new and changed recordings to the configured target,
+// skipping files whose checksum matches the last backup, and checks each
+// copy as far as the target allows.
+func runBackup(ctx context.Context, now time.Time) (backupReport, error) {
+	report := backupReport{
+		StartedAt: now.UTC(),
+		Copied:    []string{}, Failed: []backupFailure{}, Mismatched: []verifyMismatch{}, Removed: []string{},
+	}
+	target, err := configuredBackupTarget()
+	if err != nil {
+		return report, fmt.Errorf("backup target: %w", err)
+	}
+	if target == nil {
+		return report, errBackupUnconfigured
+	}
+	state, err := loadBackupState()
+	if err != nil {
+		return report, err
+	}
+	// Copies on another target don't count; start over there. State from
+	// before targets were recorded belongs to the backup command.
+	if state.Target != "" && state.Target != target.String() {
+		slog.Info("backup target changed, copying everything", "from", state.Target, "to", target.String())
+		state.Files = map[string]backedUpFile{}
+	}
+	state.Target = target.String()
+	candidates, err := collectBackupCandidates()
+	if err != nil {
+		return report, err
+	}
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		seen[c.rel] = true
+		report.Scanned++
+		if prev, ok := state.Files[c.rel]; ok && prev.SHA256 == c.sum.SHA256 {
+			report.Unchanged++
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if reason := backupFile(ctx, target, c, &report); reason != "" {
+			report.Failed = append(report.Failed, backupFailure{Path: c.rel, Reason: reason})
+			continue
+		}
+		state.Files[c.rel] = backedUpFile{SHA256: c.sum.SHA256, Size: c.sum.Size, BackedUpAt: time.Now().UTC()}
+		report.Copied = append(report.Copied, c.rel)
+		report.Bytes += c.sum.Size
+	}
+	for rel := range state.Files {
+		if !seen[rel] {
+			report.Removed = append(report.Removed, rel)
+		}
+	}
+	sort.Strings(report.Removed)
+	report.FinishedAt = time.Now().UTC()
+	state.LastReport = &report
+	if len(report.Failed) == 0 {
+		state.LastSuccessAt = report.FinishedAt
+	}
+	return report, saveBackupState(state)
+}
+
+// backupFile copies one file and runs the verification pass on it,
+// returning why it failed or "".
+func backupFile(ctx context.Context, target backupTarget, c backupCandidate, report *backupReport) string {
+	if err := target.copy(ctx, c); err != nil {
+		return fmt.Sprintf("copy: %v", err)
+	}
+	// A file rewritten while it was copied may have reached the target
+	// half old, half new; it is retried next run.
+	if sum, err := hashFile(c.full); err != nil || sum != c.sum.SHA256 {
+		return "changed during backup"
+	}
+	mismatch, checked, err := target.check(ctx, c)
+	if err != nil {
+		return fmt.Sprintf("verify: %v", err)
+	}
+	if mismatch != nil {
+		report.Mismatched = append(report.Mismatched, *mismatch)
+		return "copy on the target does not match"
+	}
+	if checked {
+		report.Verified++
+	}
+	return ""
+}
+
+// runScheduledBackup runs the "backup" schedule and publishes the outcome.
+func runScheduledBackup(now time.Time) {
+	if !backupRunning.TryLock() {
+		slog.Warn("backup still running, skipping scheduled run")
+		return
+	}
+	defer backupRunning.Unlock()
+	report, err := runBackup(context.Background(), now)
+	publishBackupReport(report, err)
+}
+
+func publishBackupReport(report backupReport, err error) {
+	if err != nil {
+		slog.Error("backup", "err", err)
+		publishEvent("backup.failed", "", map[string]any{"error": err.Error()})
+		return
+	}
+	slog.Info("backup finished", "copied", len(report.Copied), "bytes", report.Bytes, "unchanged", report.Unchanged, "failed", len(report.Failed))
+	event := "backup.completed"
+	if len(report.Failed) > 0 {
+		event = "backup.failed"
+	}
+	publishEvent(event, "", map[string]any{
+		"copied": len(report.Copied), "bytes": report.Bytes, "verified": report.Verified, "failed": report.Failed,
+	})
+}
+
+// backupHandler serves GET /api/backup with the last run's report and
+// POST /api/backup to run one now.
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := loadBackupState()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		target, _ := configuredBackupTarget()
+		writeJSON(w, map[string]any{
+			"configured": target != nil,
+			"files":      len(state.Files),
+			"lastReport": state.LastReport,
+		})
+	case http.MethodPost:
+		if target, err := configuredBackupTarget(); target == nil {
+			if err == nil {
+				err = errBackupUnconfigured
+			}
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if !backupRunning.TryLock() {
+			http.Error(w, "backup already running", http.StatusConflict)
+			return
+		}
+		defer backupRunning.Unlock()
+		report, err := runBackup(r.Context(), time.Now())
+		publishBackupReport(report, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, report)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// backupStatus is the payload of GET /api/backup/status.
+type backupStatus struct {
+	Configured bool   `json:"configured"`
+	Target     string `json:"target,omitempty"`
+	// Error explains why a configured target can't be used.
+	Error         string     `json:"error,omitempty"`
+	Running       bool       `json:"running"`
+	Files         int        `json:"files"`
+	Bytes         int64      `json:"bytes"`
+	LastRunAt     *time.Time `json:"lastRunAt,omitempty"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+	LastCopied    int        `json:"lastCopied"`
+	LastFailed    int        `json:"lastFailed"`
+	Scheduled     bool       `json:"scheduled"`
+	NextRunAt     *time.Time `json:"nextRunAt,omitempty"`
+}
+
+// backupStatusHandler serves GET /api/backup/status: the target, what the
+// last backup copied to it, and when the next scheduled one runs.
+func backupStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	state, err := loadBackupState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	st := backupStatus{Files: len(state.Files)}
+	target, err := configuredBackupTarget()
+	switch {
+	case err != nil:
+		st.Configured, st.Error = true, err.Error()
+	case target != nil:
+		st.Configured, st.Target = true, target.String()
+	}
+	if backupRunning.TryLock() {
+		backupRunning.Unlock()
+	} else {
+		st.Running = true
+	}
+	for _, f := range state.Files {
+		st.Bytes += f.Size
+	}
+	if rep := state.LastReport; rep != nil {
+		st.LastRunAt = &rep.FinishedAt
+		st.LastCopied, st.LastFailed = len(rep.Copied), len(rep.Failed)
+	}
+	if !state.LastSuccessAt.IsZero() {
+		st.LastSuccessAt = &state.LastSuccessAt
+	}
+
+	scheduler.Lock()
+	items, err := loadSchedules()
+	scheduler.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, v := range scheduleViews(map[string]schedule{"backup": items["backup"]}, time.Now()) {
+		st.Scheduled = v.Enabled
+		if len(v.NextRuns) > 0 {
+			st.NextRunAt = &v.NextRuns[0]
+		}
+	}
+	writeJSON(w, st)
+}
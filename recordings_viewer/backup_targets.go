@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// backupTarget is where backups are copied to: a command (see
+// cfg.BackupCommand), an S3-compatible bucket or a WebDAV server.
+type backupTarget interface {
+	// String names the target without credentials. A different name means
+	// a different target, which starts over from a full backup.
+	String() string
+	// copy uploads the local file of c to the target as c.rel.
+	copy(ctx context.Context, c backupCandidate) error
+	// check compares the target's copy with c. It returns the mismatch if
+	// they differ, and checked false when the target offers no way to tell.
+	check(ctx context.Context, c backupCandidate) (mismatch *verifyMismatch, checked bool, err error)
+}
+
+// configuredBackupTarget returns the target from cfg.BackupCommand, or
+// else cfg.BackupTarget, and nil when neither is set.
+func configuredBackupTarget() (backupTarget, error) {
+	if len(cfg().BackupCommand) > 0 {
+		return commandBackup{copyCmd: cfg().BackupCommand, verifyCmd: cfg().BackupVerifyCommand}, nil
+	}
+	if cfg().BackupTarget == "" {
+		return nil, nil
+	}
+	return parseBackupTarget(cfg().BackupTarget)
+}
+
+// parseBackupTarget parses "s3://bucket/prefix" or "webdav://host/path"
+// ("webdavs://" for HTTPS). S3 targets use the VIEWER_S3_* endpoint,
+// region and credentials unless ?endpoint= or ?region= override them;
+// WebDAV targets log in with cfg.BackupUser and cfg.BackupPassword, or the
+// URL's user info.
+func parseBackupTarget(raw string) (backupTarget, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		c := cfg().S3
+		c.Bucket = u.Host
+		c.Prefix = strings.Trim(u.Path, "/")
+		if e := u.Query().Get("endpoint"); e != "" {
+			c.Endpoint = strings.TrimRight(e, "/")
+		}
+		if r := u.Query().Get("region"); r != "" {
+			c.Region = r
+		}
+		if c.Bucket == "" {
+			return nil, errors.New("missing bucket")
+		}
+		if c.Endpoint == "" {
+			return nil, errors.New("missing endpoint: set VIEWER_S3_ENDPOINT or ?endpoint=")
+		}
+		return s3Backup{c}, nil
+	case "webdav", "webdavs":
+		if u.Host == "" {
+			return nil, errors.New("missing host")
+		}
+		t := &webdavBackup{user: cfg().BackupUser, password: cfg().BackupPassword, made: map[string]bool{}}
+		if u.User != nil && t.user == "" {
+			t.user = u.User.Username()
+			t.password, _ = u.User.Password()
+		}
+		base := *u
+		base.Scheme = "http"
+		if u.Scheme == "webdavs" {
+			base.Scheme = "https"
+		}
+		base.User, base.RawQuery, base.Fragment = nil, "", ""
+		base.Path = strings.TrimRight(base.Path, "/")
+		base.RawPath = ""
+		t.base = &base
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported backup target scheme %q (want s3, webdav or webdavs)", u.Scheme)
+}
+
+// backupClient uploads to S3 and WebDAV targets. Uploads of long
+// recordings may take a while, so only connecting is bounded.
+var backupClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ResponseHeaderTimeout: 5 * time.Minute,
+	TLSHandshakeTimeout:   10 * time.Second,
+}}
+
+// putFile sends the local file full to target with a PUT, after prepare
+// (when given) has added credentials.
+func putFile(ctx context.Context, target, full string, prepare func(*http.Request)) error {
+	f, err := os.Open(full)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	if prepare != nil {
+		prepare(req)
+	}
+	res, err := backupClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("PUT: %s", res.Status)
+	}
+	return nil
+}
+
+// commandBackup copies files with configured commands.
+type commandBackup struct {
+	copyCmd, verifyCmd []string
+}
+
+func (commandBackup) String() string { return "command" }
+
+func (b commandBackup) copy(ctx context.Context, c backupCandidate) error {
+	args := expandCommand(b.copyCmd, c.full, c.rel)
+	if output, err := runCommandFunc(ctx, args[0], args[1:]...); err != nil {
+		return fmt.Errorf("%w: %s", err, outputTail(output))
+	}
+	return nil
+}
+
+func (b commandBackup) check(ctx context.Context, c backupCandidate) (*verifyMismatch, bool, error) {
+	if len(b.verifyCmd) == 0 {
+		return nil, false, nil
+	}
+	args := expandCommand(b.verifyCmd, c.full, c.rel)
+	output, err := runCommandFunc(ctx, args[0], args[1:]...)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s", err, outputTail(output))
+	}
+	remote := strings.ToLower(sha256Hex.FindString(string(output)))
+	if remote != c.sum.SHA256 {
+		return &verifyMismatch{Path: c.rel, Expected: c.sum.SHA256, Actual: remote}, true, nil
+	}
+	return nil, true, nil
+}
+
+// s3Backup uploads files to a bucket under its prefix with presigned PUTs.
+type s3Backup struct {
+	s3Config
+}
+
+func (b s3Backup) String() string {
+	return "s3://" + path.Join(b.Bucket, b.Prefix)
+}
+
+func (b s3Backup) copy(ctx context.Context, c backupCandidate) error {
+	signed, err := b.presign(http.MethodPut, b.objectKey(c.rel), time.Hour)
+	if err != nil {
+		return err
+	}
+	return putFile(ctx, signed, c.full, nil)
+}
+
+// md5ETag matches the ETag of an object uploaded in one PUT, which is the
+// MD5 of its content; multipart uploads have a "-<parts>" suffix.
+var md5ETag = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// check compares the object's ETag with the file's MD5, or only its size
+// when the ETag is not an MD5.
+func (b s3Backup) check(ctx context.Context, c backupCandidate) (*verifyMismatch, bool, error) {
+	size, etag, err := b.headObject(ctx, b.objectKey(c.rel))
+	if err != nil {
+		return nil, false, err
+	}
+	if size != c.sum.Size {
+		return &verifyMismatch{Path: c.rel, Expected: fmt.Sprintf("%d bytes", c.sum.Size), Actual: fmt.Sprintf("%d bytes", size)}, true, nil
+	}
+	etag = strings.ToLower(etag)
+	if !md5ETag.MatchString(etag) {
+		return nil, true, nil
+	}
+	local, err := md5File(c.full)
+	if err != nil {
+		return nil, false, err
+	}
+	if local != etag {
+		return &verifyMismatch{Path: c.rel, Expected: "md5:" + local, Actual: "md5:" + etag}, true, nil
+	}
+	return nil, true, nil
+}
+
+func md5File(fullPath string) (string, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// webdavBackup uploads files below a WebDAV collection, creating
+// collections for folders as needed.
+type webdavBackup struct {
+	base           *url.URL
+	user, password string
+	// made records the collections known to exist during this run.
+	made map[string]bool
+}
+
+func (b *webdavBackup) String() string {
+	scheme := "webdav"
+	if b.base.Scheme == "https" {
+		scheme = "webdavs"
+	}
+	return scheme + "://" + b.base.Host + b.base.Path
+}
+
+// url returns the URL of rel below the base collection.
+func (b *webdavBackup) url(rel string) string {
+	parts := strings.Split(rel, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return b.base.JoinPath(parts...).String()
+}
+
+func (b *webdavBackup) auth(req *http.Request) {
+	if b.user != "" {
+		req.SetBasicAuth(b.user, b.password)
+	}
+}
+
+func (b *webdavBackup) do(ctx context.Context, method, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	b.auth(req)
+	res, err := backupClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+	return res, nil
+}
+
+// mkcol creates the collections above rel that this run has not seen yet.
+// 405 means the collection already exists.
+func (b *webdavBackup) mkcol(ctx context.Context, rel string) error {
+	dir := path.Dir(rel)
+	if dir == "." || b.made[dir] {
+		return nil
+	}
+	if err := b.mkcol(ctx, dir); err != nil {
+		return err
+	}
+	res, err := b.do(ctx, "MKCOL", b.url(dir)+"/")
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("MKCOL %s: %s", dir, res.Status)
+	}
+	b.made[dir] = true
+	return nil
+}
+
+func (b *webdavBackup) copy(ctx context.Context, c backupCandidate) error {
+	if err := b.mkcol(ctx, c.rel); err != nil {
+		return err
+	}
+	return putFile(ctx, b.url(c.rel), c.full, b.auth)
+}
+
+// check compares the size of the copy; WebDAV has no standard checksum.
+func (b *webdavBackup) check(ctx context.Context, c backupCandidate) (*verifyMismatch, bool, error) {
+	res, err := b.do(ctx, http.MethodHead, b.url(c.rel))
+	if err != nil {
+		return nil, false, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("HEAD: %s", res.Status)
+	}
+	if res.ContentLength < 0 {
+		return nil, false, nil
+	}
+	if res.ContentLength != c.sum.Size {
+		return &verifyMismatch{Path: c.rel, Expected: fmt.Sprintf("%d bytes", c.sum.Size), Actual: fmt.Sprintf("%d bytes", res.ContentLength)}, true, nil
+	}
+	return nil, true, nil
+}
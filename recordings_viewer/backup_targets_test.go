@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory S3 bucket or WebDAV share. With dav set it
+// requires collections to exist before files are PUT into them.
+type fakeStore struct {
+	mu      sync.Mutex
+	dav     bool
+	objects map[string][]byte
+	dirs    map[string]bool
+	auth    string
+	// corrupt, when set, is served in place of every object's content.
+	corrupt []byte
+}
+
+func newFakeStore(t *testing.T, dav bool) (*fakeStore, *httptest.Server) {
+	t.Helper()
+	s := &fakeStore{dav: dav, objects: map[string][]byte{}, dirs: map[string]bool{"/dav": true}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	if s.dav {
+		if user, pass, _ := r.BasicAuth(); user+":"+pass != s.auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	switch r.Method {
+	case "MKCOL":
+		switch {
+		case s.dirs[p]:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case !s.dirs[path.Dir(p)]:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			s.dirs[p] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodPut:
+		if s.dav && !s.dirs[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		s.objects[p] = data
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead:
+		data, ok := s.objects[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if s.corrupt != nil {
+			data = s.corrupt
+		}
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	case http.MethodGet:
+		data, ok := s.objects[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for k := range s.objects {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestBackupToS3(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "2024/b b.txt")
+	store, srv := newFakeStore(t, false)
+	useConfig(t, func(c *config) {
+		c.S3 = s3Config{Endpoint: srv.URL, Region: "us-east-1", AccessKey: "AK", SecretKey: "SK"}
+		c.BackupTarget = "s3://backups/viewer"
+	})
+
+	report, err := runBackup(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Copied) != 2 || report.Verified != 2 || len(report.Failed) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if got := store.keys(); !reflect.DeepEqual(got, []string{"/backups/viewer/2024/b b.txt", "/backups/viewer/a.webm"}) {
+		t.Fatalf("objects = %v", got)
+	}
+
+	// A copy the target mangled is reported and tried again.
+	writeTestFiles(t, dir, "c.webm")
+	store.mu.Lock()
+	store.corrupt = []byte("something else")
+	store.mu.Unlock()
+	report, _ = runBackup(context.Background(), time.Now())
+	if len(report.Mismatched) != 1 || report.Mismatched[0].Path != "c.webm" || len(report.Failed) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	state, _ := loadBackupState()
+	if _, ok := state.Files["c.webm"]; ok || state.Target != "s3://backups/viewer" {
+		t.Fatalf("state = %+v", state)
+	}
+}
+
+func TestBackupToWebDAV(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "2024/05/a.webm", "2024/05/a.txt", "b.webm")
+	store, srv := newFakeStore(t, true)
+	store.auth = "me:pw"
+	useConfig(t, func(c *config) {
+		c.BackupTarget = strings.Replace(srv.URL, "http://", "webdav://", 1) + "/dav/"
+		c.BackupUser = "me"
+		c.BackupPassword = "pw"
+	})
+
+	report, err := runBackup(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Copied) != 3 || report.Verified != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	if got := store.keys(); !reflect.DeepEqual(got, []string{"/dav/2024/05/a.txt", "/dav/2024/05/a.webm", "/dav/b.webm"}) {
+		t.Fatalf("objects = %v", got)
+	}
+
+	useConfig(t, func(c *config) { c.BackupPassword = "wrong" })
+	writeTestFiles(t, dir, "c.webm")
+	report, _ = runBackup(context.Background(), time.Now())
+	if len(report.Failed) != 1 || !strings.Contains(report.Failed[0].Reason, "401") {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestBackupTargetChangeStartsOver(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm")
+	fakeBackupTarget(t)
+	if _, err := runBackup(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	store, srv := newFakeStore(t, false)
+	useConfig(t, func(c *config) {
+		c.BackupCommand = nil
+		c.S3 = s3Config{Endpoint: srv.URL, Region: "us-east-1"}
+		c.BackupTarget = "s3://backups"
+	})
+	report, err := runBackup(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Copied) != 1 || len(store.keys()) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestParseBackupTarget(t *testing.T) {
+	useConfig(t, func(c *config) { c.S3 = s3Config{Endpoint: "https://s3.example.com", Region: "eu-west-1"} })
+	cases := map[string]string{
+		"s3://bucket/some/prefix/":                 "s3://bucket/some/prefix",
+		"s3://bucket?endpoint=http://minio:9000":   "s3://bucket",
+		"webdavs://me:pw@dav.example.com/remote/":  "webdavs://dav.example.com/remote",
+		"webdav://nas.local:8080/backup/recording": "webdav://nas.local:8080/backup/recording",
+	}
+	for raw, want := range cases {
+		target, err := parseBackupTarget(raw)
+		if err != nil || target.String() != want {
+			t.Errorf("parseBackupTarget(%q) = %v, %v; want %s", raw, target, err, want)
+		}
+	}
+	if target, _ := parseBackupTarget("s3://bucket?endpoint=http://minio:9000&region=local"); target.(s3Backup).Endpoint != "http://minio:9000" || target.(s3Backup).Region != "local" {
+		t.Errorf("overrides not applied: %+v", target)
+	}
+	for _, raw := range []string{"ftp://host/x", "s3:///prefix", "webdav:///x"} {
+		if _, err := parseBackupTarget(raw); err == nil {
+			t.Errorf("parseBackupTarget(%q) succeeded", raw)
+		}
+	}
+}
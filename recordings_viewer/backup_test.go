@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBackupTarget copies files into a directory in place of the configured
+// backup command and reports their SHA-256 for the verify command.
+func fakeBackupTarget(t *testing.T) (string, *[]string) {
+	t.Helper()
+	target := t.TempDir()
+	var copied []string
+	useConfig(t, func(c *config) {
+		c.BackupCommand = []string{"cp", "{src}", "remote:{path}"}
+		c.BackupVerifyCommand = []string{"sha", "remote:{path}"}
+	})
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "cp":
+			dst := filepath.Join(target, filepath.FromSlash(args[1][len("remote:"):]))
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return nil, err
+			}
+			os.MkdirAll(filepath.Dir(dst), 0o755)
+			copied = append(copied, args[1])
+			return nil, os.WriteFile(dst, data, 0o644)
+		case "sha":
+			data, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(args[0][len("remote:"):])))
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(data)
+			return []byte(hex.EncodeToString(sum[:]) + "  file\n"), nil
+		}
+		t.Fatalf("unexpected command %s", name)
+		return nil, nil
+	})
+	return target, &copied
+}
+
+func TestBackupCopiesOnlyChangedFiles(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "sub/b.txt")
+	target, copied := fakeBackupTarget(t)
+
+	report, err := runBackup(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Copied, []string{"a.webm", "sub/b.txt"}) || report.Verified != 2 {
+		t.Fatalf("first run = %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(target, "sub", "b.txt")); err != nil {
+		t.Fatalf("not copied: %v", err)
+	}
+
+	*copied = nil
+	os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("changed"), 0o644)
+	os.Remove(filepath.Join(dir, "a.webm"))
+	writeTestFiles(t, dir, "c.webm")
+	report, err = runBackup(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*copied, []string{"remote:c.webm", "remote:sub/b.txt"}) {
+		t.Fatalf("second run copied %v", *copied)
+	}
+	if !reflect.DeepEqual(report.Removed, []string{"a.webm"}) || report.Unchanged != 0 {
+		t.Fatalf("second run = %+v", report)
+	}
+
+	*copied = nil
+	report, _ = runBackup(context.Background(), time.Now())
+	if len(*copied) != 0 || report.Unchanged != 2 {
+		t.Fatalf("third run copied %v: %+v", *copied, report)
+	}
+}
+
+func TestBackupReportsVerifyMismatch(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm")
+	useConfig(t, func(c *config) {
+		c.BackupCommand = []string{"cp", "{src}"}
+		c.BackupVerifyCommand = []string{"sha"}
+	})
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name == "sha" {
+			return []byte("0000000000000000000000000000000000000000000000000000000000000000\n"), nil
+		}
+		return nil, nil
+	})
+	report, err := runBackup(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Copied) != 0 || len(report.Failed) != 1 || len(report.Mismatched) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	// The failed file is tried again next run.
+	state, _ := loadBackupState()
+	if _, ok := state.Files["a.webm"]; ok {
+		t.Fatal("mismatched copy recorded as backed up")
+	}
+}
+
+func TestBackupHandler(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm")
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/backup", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("unconfigured status = %d", rec.Code)
+	}
+
+	fakeBackupTarget(t)
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/backup", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/backup", nil))
+	var status struct {
+		Files      int           `json:"files"`
+		LastReport *backupReport `json:"lastReport"`
+	}
+	json.NewDecoder(rec.Body).Decode(&status)
+	if status.Files != 1 || status.LastReport == nil || len(status.LastReport.Copied) != 1 {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestBackupStatusHandler(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "b.webm")
+
+	status := func() backupStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/backup/status", nil))
+		var st backupStatus
+		if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	if st := status(); st.Configured || st.LastRunAt != nil || st.Scheduled {
+		t.Fatalf("unconfigured status = %+v", st)
+	}
+
+	useConfig(t, func(c *config) { c.BackupTarget = "ftp://nas/backup" })
+	if st := status(); !st.Configured || !strings.Contains(st.Error, "unsupported") {
+		t.Fatalf("invalid target status = %+v", st)
+	}
+
+	useConfig(t, func(c *config) { c.BackupTarget = "" })
+	fakeBackupTarget(t)
+	if _, err := runBackup(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	st := status()
+	if st.Target != "command" || st.Files != 2 || st.Bytes == 0 || st.LastCopied != 2 || st.LastSuccessAt == nil || st.Running {
+		t.Fatalf("status = %+v", st)
+	}
+}
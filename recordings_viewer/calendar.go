@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// calendarSlack is how long before an event a recording may start and
+	// still belong to it: people join early.
+	calendarSlack = 10 * time.Minute
+	// maxCalendarBytes caps the size of a feed.
+	maxCalendarBytes = 20 << 20
+)
+
+var calendarClient = &http.Client{Timeout: 30 * time.Second}
+
+// calendarAttendee is someone invited to an event.
+type calendarAttendee struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// calendarEvent is one occurrence of an event in a calendar feed. Every
+// occurrence of a recurring event has its UID.
+type calendarEvent struct {
+	UID       string             `json:"uid"`
+	Title     string             `json:"title"`
+	Start     time.Time          `json:"start"`
+	End       time.Time          `json:"end"`
+	Location  string             `json:"location,omitempty"`
+	Organizer calendarAttendee   `json:"organizer,omitzero"`
+	Attendees []calendarAttendee `json:"attendees,omitempty"`
+}
+
+// calendarInfo is the event a recording was matched with, stored in its
+// manifest.
+type calendarInfo struct {
+	calendarEvent
+	MatchedAt time.Time `json:"matchedAt"`
+}
+
+// calendarStatus is how the last sync went.
+type calendarStatus struct {
+	LastSync time.Time `json:"lastSync,omitzero"`
+	Events   int       `json:"events"`
+	Matched  int       `json:"matched"`
+	Changed  int       `json:"changed"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+var calendarState struct {
+	sync.Mutex
+	status calendarStatus
+}
+
+// calendarEvents expands the events of a feed into their occurrences from
+// from to to. All-day and cancelled events are left out, as are the
+// occurrences a RECURRENCE-ID event moves or cancels.
+func calendarEvents(events []icsEvent, from, to time.Time) []calendarEvent {
+	key := func(uid string, t time.Time) string { return fmt.Sprintf("%s@%d", uid, t.Unix()) }
+	moved := map[string]bool{}
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() {
+			moved[key(e.uid, e.recurrenceID)] = true
+		}
+	}
+	var out []calendarEvent
+	for _, e := range events {
+		if e.allDay || e.status == "CANCELLED" {
+			continue
+		}
+		for _, t := range e.occurrences(from, to) {
+			if e.recurrenceID.IsZero() && moved[key(e.uid, t)] {
+				continue
+			}
+			out = append(out, calendarEvent{
+				UID: e.uid, Title: e.summary, Start: t.UTC(), End: t.Add(e.duration).UTC(),
+				Location: e.location, Organizer: e.organizer, Attendees: e.attendees,
+			})
+		}
+	}
+	return out
+}
+
+// calendarFeedName names a feed in logs and errors without the secret a
+// feed URL usually carries: its host, or its file name.
+func calendarFeedName(feed string) string {
+	if u, err := url.Parse(feed); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return filepath.Base(feed)
+}
+
+// fetchCalendarFeed reads a feed: an http(s) or webcal URL, such as a
+// Google Calendar's secret address in iCal format, or a file.
+func fetchCalendarFeed(ctx context.Context, feed string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(feed, "webcal://"); ok {
+		feed = "https://" + rest
+	}
+	if !strings.HasPrefix(feed, "http://") && !strings.HasPrefix(feed, "https://") {
+		return os.ReadFile(feed)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed, nil)
+	if err != nil {
+		return nil, errors.New("invalid feed URL")
+	}
+	res, err := calendarClient.Do(req)
+	if err != nil {
+		// The error would repeat the URL.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %s", res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxCalendarBytes+1))
+	if err == nil && len(data) > maxCalendarBytes {
+		err = fmt.Errorf("feed is larger than %d bytes", maxCalendarBytes)
+	}
+	return data, err
+}
+
+// loadCalendarEvents reads every feed in cfg.CalendarFeeds and returns the
+// occurrences of their events from from to to, and what went wrong with
+// the feeds that could not be read.
+func loadCalendarEvents(ctx context.Context, from, to time.Time) ([]calendarEvent, []string) {
+	var events []calendarEvent
+	var errs []string
+	for _, feed := range cfg().CalendarFeeds {
+		data, err := fetchCalendarFeed(ctx, feed)
+		if err == nil {
+			var parsed []icsEvent
+			if parsed, err = parseICS(string(data)); err == nil {
+				events = append(events, calendarEvents(parsed, from, to)...)
+				continue
+			}
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", calendarFeedName(feed), err))
+	}
+	return events, errs
+}
+
+// matchCalendarEvent picks the event a recording from start to end belongs
+// to: the one their overlap is the largest share of, so a meeting wins over
+// a day-long block around it, then one under way when it started, then the
+// one that started closest to it. A recording must overlap a quarter of
+// itself or of the event; one whose end is not known is a moment.
+func matchCalendarEvent(events []calendarEvent, start, end time.Time) (calendarEvent, bool) {
+	end = maxTime(end, start)
+	type score struct {
+		share    float64
+		under    bool
+		distance time.Duration
+	}
+	var best calendarEvent
+	var bestScore score
+	found := false
+	for _, ev := range events {
+		if ev.Start.Add(-calendarSlack).After(end) || !start.Before(ev.End) {
+			continue
+		}
+		overlap := max(minTime(end, ev.End).Sub(maxTime(start, ev.Start)), 0)
+		if end.After(start) && overlap < min(end.Sub(start), ev.End.Sub(ev.Start))/4 {
+			continue
+		}
+		sc := score{under: !start.Before(ev.Start), distance: start.Sub(ev.Start).Abs()}
+		if union := maxTime(end, ev.End).Sub(minTime(start, ev.Start)); union > 0 {
+			sc.share = overlap.Seconds() / union.Seconds()
+		}
+		switch {
+		case !found, sc.share > bestScore.share,
+			sc.share == bestScore.share && sc.under && !bestScore.under,
+			sc.share == bestScore.share && sc.under == bestScore.under && sc.distance < bestScore.distance:
+			best, bestScore, found = ev, sc, true
+		}
+	}
+	return best, found
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// sameCalendarEvent reports whether a stored match still describes ev.
+func sameCalendarEvent(a, b calendarEvent) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+// syncCalendar reads the calendar feeds and matches every recording with
+// the event it was recorded in, saving the event's title, time and
+// attendees in its manifest. Recordings whose event is gone lose it, unless
+// a feed could not be read.
+func syncCalendar(ctx context.Context) (calendarStatus, error) {
+	if len(cfg().CalendarFeeds) == 0 {
+		return calendarStatus{}, errors.New("no calendar feeds configured; set VIEWER_CALENDAR_FEEDS")
+	}
+	sessions, err := scanSessions()
+	if err != nil {
+		return calendarStatus{}, err
+	}
+	now := time.Now()
+	from := now
+	for _, s := range sessions {
+		if !s.RecordedAt.IsZero() {
+			from = minTime(from, s.RecordedAt)
+		}
+	}
+	events, errs := loadCalendarEvents(ctx, from.Add(-24*time.Hour), now.Add(24*time.Hour))
+	status := calendarStatus{LastSync: now.UTC(), Events: len(events), Errors: errs}
+	for _, s := range sessions {
+		if s.RecordedAt.IsZero() || ctx.Err() != nil {
+			continue
+		}
+		meta, _ := loadMeta(s.metaPath())
+		start, end := s.RecordedAt, s.RecordedAt
+		if meta.Source != nil && meta.Source.EndedAt.After(start) {
+			end = meta.Source.EndedAt
+		} else if s.Audio != "" && nearCalendarEvent(events, start) {
+			// Only the length of the recording tells back-to-back
+			// meetings apart.
+			if d, err := recordingDuration(s.Audio); err == nil {
+				end = start.Add(d)
+			}
+		}
+		ev, ok := matchCalendarEvent(events, start, end)
+		if ok {
+			status.Matched++
+		}
+		switch {
+		case ok && meta.Calendar != nil && sameCalendarEvent(meta.Calendar.calendarEvent, ev):
+			continue
+		case !ok && (meta.Calendar == nil || len(errs) > 0):
+			continue
+		}
+		if err := storeCalendarMatch(s.metaPath(), ev, ok, now); err != nil {
+			slog.Error("calendar match", "session", s.ID, "err", err)
+			continue
+		}
+		status.Changed++
+		if ok {
+			publishEvent("calendar.matched", s.ID, map[string]any{"uid": ev.UID, "title": ev.Title})
+		}
+	}
+	for _, e := range errs {
+		slog.Warn("calendar feed", "err", e)
+	}
+	calendarState.Lock()
+	calendarState.status = status
+	calendarState.Unlock()
+	return status, nil
+}
+
+// nearCalendarEvent reports whether a recording starting at start could
+// belong to any of events.
+func nearCalendarEvent(events []calendarEvent, start time.Time) bool {
+	for _, ev := range events {
+		if !ev.Start.Add(-calendarSlack).After(start) && start.Before(ev.End.Add(calendarSlack)) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeCalendarMatch saves ev as the event of the recording whose manifest
+// is metaPath, or removes its event when matched is false.
+func storeCalendarMatch(metaPath string, ev calendarEvent, matched bool, now time.Time) error {
+	mu.Lock()
+	defer mu.Unlock()
+	meta, err := loadMeta(metaPath)
+	if err != nil {
+		return err
+	}
+	meta.Calendar = nil
+	if matched {
+		meta.Calendar = &calendarInfo{calendarEvent: ev, MatchedAt: now.UTC()}
+	}
+	return saveMeta(metaPath, meta)
+}
+
+// runScheduledCalendar syncs the calendar feeds, if any are configured.
+func runScheduledCalendar(now time.Time) {
+	if len(cfg().CalendarFeeds) == 0 {
+		return
+	}
+	status, err := syncCalendar(context.Background())
+	if err != nil {
+		slog.Error("calendar sync", "err", err)
+		return
+	}
+	slog.Info("calendar synced", "events", status.Events, "matched", status.Matched, "changed", status.Changed)
+}
+
+// calendarGroup is an event and the sessions recorded in it.
+type calendarGroup struct {
+	Event    calendarEvent `json:"event"`
+	Sessions []string      `json:"sessions"`
+}
+
+// calendarHandler serves GET /api/calendar: the sessions grouped by the
+// calendar event they were recorded in, newest event first, then those
+// matched with none, and how the last sync went. ?day=2024-05-01 keeps
+// the events that started that day in the display time zone.
+func calendarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	day := r.URL.Query().Get("day")
+	if day != "" {
+		if _, err := time.Parse(time.DateOnly, day); err != nil {
+			http.Error(w, "day must look like 2024-05-01", http.StatusBadRequest)
+			return
+		}
+	}
+	sessions, err := scanSessions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byEvent := map[string]*calendarGroup{}
+	groups := []*calendarGroup{}
+	unmatched := []string{}
+	for _, s := range sessions {
+		if s.Calendar == nil {
+			if day == "" {
+				unmatched = append(unmatched, s.ID)
+			}
+			continue
+		}
+		ev := s.Calendar.calendarEvent
+		if day != "" && ev.Start.In(cfg().DisplayTimezone).Format(time.DateOnly) != day {
+			continue
+		}
+		key := fmt.Sprintf("%s@%d", ev.UID, ev.Start.Unix())
+		g, ok := byEvent[key]
+		if !ok {
+			g = &calendarGroup{Event: ev}
+			byEvent[key] = g
+			groups = append(groups, g)
+		}
+		g.Sessions = append(g.Sessions, s.ID)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Event.Start.After(groups[j].Event.Start) })
+	for _, g := range groups {
+		sort.Slice(g.Sessions, func(i, j int) bool { return naturalLess(g.Sessions[i], g.Sessions[j]) })
+	}
+	sort.Slice(unmatched, func(i, j int) bool { return naturalLess(unmatched[i], unmatched[j]) })
+	calendarState.Lock()
+	status := calendarState.status
+	calendarState.Unlock()
+	writeJSON(w, map[string]any{"feeds": len(cfg().CalendarFeeds), "sync": status, "groups": groups, "unmatched": unmatched})
+}
+
+// calendarSyncHandler serves POST /api/calendar/sync, which syncs the
+// calendar feeds now instead of at the next scheduled run.
+func calendarSyncHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := syncCalendar(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	requestLogger(r).Info("calendar synced", "events", status.Events, "matched", status.Matched, "changed", status.Changed)
+	writeJSON(w, status)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchCalendarEvent(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 5, 1, h, m, 0, 0, time.UTC) }
+	events := []calendarEvent{
+		{UID: "a", Title: "Planning", Start: at(10, 0), End: at(11, 0)},
+		{UID: "b", Title: "Design review", Start: at(11, 0), End: at(12, 0)},
+		{UID: "c", Title: "Focus time", Start: at(9, 0), End: at(17, 0)},
+	}
+	cases := []struct {
+		start, end time.Time
+		want       string
+	}{
+		{at(10, 55), at(11, 50), "b"},
+		{at(9, 55), at(10, 40), "a"},
+		// Only the start is known: the meeting under way wins over the
+		// one about to start, and over the day-long block.
+		{at(10, 55), time.Time{}, "a"},
+		{at(10, 52), at(10, 52), "a"},
+		{at(13, 0), time.Time{}, "c"},
+	}
+	for _, c := range cases {
+		got, ok := matchCalendarEvent(events, c.start, c.end)
+		if !ok || got.UID != c.want {
+			t.Errorf("match(%v, %v) = %q, want %q", c.start.Format("15:04"), c.end.Format("15:04"), got.UID, c.want)
+		}
+	}
+	if _, ok := matchCalendarEvent(events[:2], at(8, 0), at(9, 0)); ok {
+		t.Error("matched a recording before every event")
+	}
+}
+
+func TestSyncCalendarMatchesRecordings(t *testing.T) {
+	dir := useTempBaseDir(t)
+	feed := filepath.Join(t.TempDir(), "work.ics")
+	writeFeed := func(events ...string) {
+		if err := os.WriteFile(feed, []byte(icsFile(events...)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	planning := "BEGIN:VEVENT\r\nUID:planning\r\nSUMMARY:Sprint planning\r\nDTSTART:20240501T080000Z\r\nDTEND:20240501T090000Z\r\n" +
+		"ATTENDEE;CN=Grace Hopper:mailto:grace@example.com\r\nEND:VEVENT\r\n"
+	review := "BEGIN:VEVENT\r\nUID:review\r\nSUMMARY:Design review\r\nDTSTART:20240501T090000Z\r\nDTEND:20240501T100000Z\r\nEND:VEVENT\r\n"
+	writeFeed(planning, review)
+	useConfig(t, func(c *config) { c.CalendarFeeds = []string{feed} })
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		return []byte("3000\n"), nil
+	})
+	writeTestFiles(t, dir, "planning.webm", "review.webm", "lunch.webm")
+	for name, at := range map[string]time.Time{
+		"planning.webm": time.Date(2024, 5, 1, 10, 2, 0, 0, time.FixedZone("", 2*3600)),
+		// Starts just before planning ends; the probed 50 minutes fall in
+		// the review.
+		"review.webm": time.Date(2024, 5, 1, 8, 55, 0, 0, time.UTC),
+		"lunch.webm":  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	} {
+		if err := setRecordedMeta(filepath.Join(dir, name), newRecordingTime(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := syncCalendar(context.Background())
+	if err != nil || status.Events != 2 || status.Matched != 2 || status.Changed != 2 || len(status.Errors) != 0 {
+		t.Fatalf("sync = %+v, %v", status, err)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "planning.webm"))
+	if meta.Calendar == nil || meta.Calendar.Title != "Sprint planning" || len(meta.Calendar.Attendees) != 1 || meta.Calendar.Attendees[0].Name != "Grace Hopper" {
+		t.Fatalf("planning = %+v", meta.Calendar)
+	}
+	if errs := meta.validate(); len(errs) != 0 {
+		t.Fatalf("manifest: %v", errs)
+	}
+	matchedAt := meta.Calendar.MatchedAt
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/calendar", nil))
+	var listing struct {
+		Groups    []calendarGroup `json:"groups"`
+		Unmatched []string        `json:"unmatched"`
+		Sync      calendarStatus  `json:"sync"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("listing: %d %s", rec.Code, rec.Body)
+	}
+	if len(listing.Groups) != 2 || listing.Groups[0].Event.UID != "review" || listing.Groups[0].Sessions[0] != "review" ||
+		listing.Groups[1].Sessions[0] != "planning" || len(listing.Unmatched) != 1 || listing.Sync.Matched != 2 {
+		t.Fatalf("listing = %+v", listing)
+	}
+	sessions, _ := scanSessions()
+	q, _ := parseSessionQuery("grace")
+	for _, s := range sessions {
+		if q.matches(&s) != (s.ID == "planning") {
+			t.Fatalf("query for an attendee: %s matches %v", s.ID, q.matches(&s))
+		}
+	}
+
+	// An unchanged event is not saved again; a deleted one is removed.
+	writeFeed(planning)
+	status, err = syncCalendar(context.Background())
+	if err != nil || status.Changed != 1 {
+		t.Fatalf("second sync = %+v, %v", status, err)
+	}
+	meta, _ = loadMeta(filepath.Join(dir, "planning.webm"))
+	if meta.Calendar == nil || !meta.Calendar.MatchedAt.Equal(matchedAt) {
+		t.Fatalf("planning rewritten: %+v", meta.Calendar)
+	}
+	if meta, _ := loadMeta(filepath.Join(dir, "review.webm")); meta.Calendar != nil {
+		t.Fatalf("review still matched: %+v", meta.Calendar)
+	}
+}
+
+func TestSyncCalendarKeepsMatchesWhenAFeedFails(t *testing.T) {
+	dir := useTempBaseDir(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	useConfig(t, func(c *config) { c.CalendarFeeds = []string{srv.URL + "/private-secret-token/basic.ics"} })
+	writeTestFiles(t, dir, "call.webm")
+	if err := storeCalendarMatch(filepath.Join(dir, "call.meta.json"), calendarEvent{UID: "x", Title: "Call", Start: time.Now(), End: time.Now()}, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/calendar/sync", nil))
+	var status calendarStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || rec.Code != http.StatusOK || len(status.Errors) != 1 {
+		t.Fatalf("sync: %d %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(status.Errors[0], "secret") || !strings.Contains(status.Errors[0], "404") {
+		t.Fatalf("error = %q", status.Errors[0])
+	}
+	if meta, _ := loadMeta(filepath.Join(dir, "call.webm")); meta.Calendar == nil {
+		t.Fatal("match dropped while the feed was unreadable")
+	}
+
+	useConfig(t, func(c *config) { c.CalendarFeeds = nil })
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/calendar/sync", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("sync without feeds: %d", rec.Code)
+	}
+}
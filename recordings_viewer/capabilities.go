@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accelerator is hardware that can speed up transcription. Device is the
+// --device the whisper CLI uses it with, empty when it cannot: PyTorch's
+// Metal backend lacks operations whisper needs, and CoreML is only for
+// whisper.cpp builds.
+type accelerator struct {
+	Kind   string `json:"kind"` // "cuda", "metal" or "coreml"
+	Name   string `json:"name,omitempty"`
+	Device string `json:"device,omitempty"`
+}
+
+var (
+	hostOS, hostArch = runtime.GOOS, runtime.GOARCH
+
+	// probeCUDA lists the NVIDIA GPUs nvidia-smi reports. Tests replace it.
+	probeCUDA = func() ([]string, error) {
+		bin, err := exec.LookPath("nvidia-smi")
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, bin, "--query-gpu=name", "--format=csv,noheader").Output()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, l := range strings.Split(string(out), "\n") {
+			if l = strings.TrimSpace(l); l != "" {
+				names = append(names, l)
+			}
+		}
+		return names, nil
+	}
+)
+
+// acceleratorsMu guards detected, the accelerators found on first use.
+var (
+	acceleratorsMu sync.Mutex
+	detected       []accelerator
+	detectedAt     time.Time
+)
+
+// detectAccelerators returns the accelerators of this machine, probing for
+// them on first use or when refresh is set.
+func detectAccelerators(refresh bool) ([]accelerator, time.Time) {
+	acceleratorsMu.Lock()
+	defer acceleratorsMu.Unlock()
+	if detected != nil && !refresh {
+		return detected, detectedAt
+	}
+	found := []accelerator{}
+	if gpus, err := probeCUDA(); err == nil {
+		for _, name := range gpus {
+			found = append(found, accelerator{Kind: "cuda", Name: name, Device: "cuda"})
+		}
+	}
+	if hostOS == "darwin" && hostArch == "arm64" {
+		found = append(found, accelerator{Kind: "metal", Name: "Apple silicon GPU"}, accelerator{Kind: "coreml", Name: "Apple Neural Engine"})
+	}
+	detected, detectedAt = found, time.Now().UTC()
+	return detected, detectedAt
+}
+
+// whisperDevice is the --device transcription jobs run whisper with:
+// cfg.WhisperDevice unless it is "auto", else the first accelerator whisper
+// can use, else the CPU. source says which.
+func whisperDevice() (device, source string) {
+	if d := cfg().WhisperDevice; d != "" && d != "auto" {
+		return d, "config"
+	}
+	accels, _ := detectAccelerators(false)
+	for _, a := range accels {
+		if a.Device != "" {
+			return a.Device, "detected"
+		}
+	}
+	return "cpu", "detected"
+}
+
+// whisperDeviceArgs are the flags that run whisper on device. Half
+// precision is not supported on the CPU, where whisper would otherwise warn
+// about falling back on every run.
+func whisperDeviceArgs(device string) []string {
+	args := []string{"--device", device}
+	if device == "cpu" {
+		args = append(args, "--fp16", "False")
+	}
+	return args
+}
+
+// capabilitiesHandler serves GET /api/system/capabilities with the
+// accelerators detected on this machine and the device whisper runs on,
+// and the whisper.cpp servers kept warm when that engine is configured.
+// ?refresh=true probes again, e.g. after a driver was installed.
+func capabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	accels, at := detectAccelerators(refresh)
+	device, source := whisperDevice()
+	body := map[string]any{
+		"os":           hostOS,
+		"arch":         hostArch,
+		"cpus":         runtime.NumCPU(),
+		"accelerators": accels,
+		"detectedAt":   at,
+		"whisper":      map[string]string{"device": device, "source": source},
+		"search":       searchSyntax,
+	}
+	if _, ok := cfg().Engines[engineWhisperCpp]; ok {
+		body["whisperCpp"] = map[string]any{"pool": cfg().WhisperCpp.Pool, "servers": warmServers.status()}
+	}
+	writeJSON(w, body)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useHost pretends to run on goos/goarch with the given NVIDIA GPUs, or
+// without nvidia-smi when gpus is nil.
+func useHost(t *testing.T, goos, goarch string, gpus []string) *int {
+	t.Helper()
+	probes := 0
+	origProbe, origOS, origArch := probeCUDA, hostOS, hostArch
+	probeCUDA = func() ([]string, error) {
+		probes++
+		if gpus == nil {
+			return nil, errors.New("nvidia-smi not found")
+		}
+		return gpus, nil
+	}
+	hostOS, hostArch = goos, goarch
+	reset := func() {
+		acceleratorsMu.Lock()
+		detected = nil
+		acceleratorsMu.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		probeCUDA, hostOS, hostArch = origProbe, origOS, origArch
+		reset()
+	})
+	return &probes
+}
+
+func TestWhisperRunsOnDetectedCUDA(t *testing.T) {
+	probes := useHost(t, "linux", "amd64", []string{"NVIDIA GeForce RTX 4090"})
+	_, args, _ := engineArgs("whisper", cfg().Engines["whisper"], "a.wav", "base", "out")
+	if argAfter(args, "--device") != "cuda" || argAfter(args, "--fp16") != "" {
+		t.Fatalf("args=%v", args)
+	}
+	engineArgs("whisper", cfg().Engines["whisper"], "b.wav", "base", "out")
+	if *probes != 1 {
+		t.Fatalf("probed %d times; detection should be cached", *probes)
+	}
+
+	useConfig(t, func(c *config) { c.WhisperDevice = "cpu" })
+	_, args, _ = engineArgs("whisper", cfg().Engines["whisper"], "a.wav", "base", "out")
+	if argAfter(args, "--device") != "cpu" || argAfter(args, "--fp16") != "False" {
+		t.Fatalf("override args=%v", args)
+	}
+}
+
+func TestCapabilitiesReportsAppleSilicon(t *testing.T) {
+	probes := useHost(t, "darwin", "arm64", nil)
+	rec := httptest.NewRecorder()
+	capabilitiesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/system/capabilities?refresh=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d", rec.Code)
+	}
+	var res struct {
+		OS           string        `json:"os"`
+		Accelerators []accelerator `json:"accelerators"`
+		Whisper      struct {
+			Device string `json:"device"`
+			Source string `json:"source"`
+		} `json:"whisper"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.OS != "darwin" || len(res.Accelerators) != 2 || res.Accelerators[0].Kind != "metal" || res.Accelerators[1].Kind != "coreml" {
+		t.Fatalf("capabilities=%s", rec.Body)
+	}
+	// The whisper CLI cannot use either, so it stays on the CPU.
+	if res.Whisper.Device != "cpu" || res.Whisper.Source != "detected" {
+		t.Fatalf("whisper=%+v", res.Whisper)
+	}
+	if *probes != 1 {
+		t.Fatalf("probes=%d", *probes)
+	}
+}
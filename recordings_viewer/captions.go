@@ -0,0 +1,277 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed captions.html
+var captionsPage []byte
+
+// captionHistory is how many finished lines the caption feed keeps; the
+// overlay shows the last ?lines= of them.
+const captionHistory = 10
+
+// captionSnapshot is what the caption feed sends: the latest finished lines
+// of the live transcription and the partial line still being recognized.
+type captionSnapshot struct {
+	Type    string   `json:"type"`
+	Live    bool     `json:"live"`
+	Lines   []string `json:"lines"`
+	Partial string   `json:"partial"`
+}
+
+// captionCue is a finished line of a live session, timed from when the
+// session started: from its first partial, or the end of the line before,
+// until its final.
+type captionCue struct {
+	Start, End time.Duration
+	Text       string
+}
+
+// captionClock is the time source for cue timings; tests replace it.
+var captionClock = time.Now
+
+// captionFeed follows the events of /ws/transcribe connections and fans the
+// resulting captions out to overlay subscribers. Subscribers only ever need
+// the newest snapshot, so a slow one skips the ones it missed.
+type captionFeed struct {
+	mu      sync.Mutex
+	streams int
+	lines   []string
+	partial string
+	subs    map[chan captionSnapshot]struct{}
+
+	// session counts the live sessions; cues are the current one's, timed
+	// from startedAt. lineStart is when the pending line's first partial
+	// arrived, or negative.
+	session   int
+	startedAt time.Time
+	lineStart time.Duration
+	cues      []captionCue
+}
+
+var liveCaptions = &captionFeed{subs: map[chan captionSnapshot]struct{}{}}
+
+// start marks a live transcription as running. The first one clears the
+// captions left over from the previous session.
+func (f *captionFeed) start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.streams++
+	if f.streams == 1 {
+		f.lines, f.partial = nil, ""
+		f.session++
+		f.startedAt, f.lineStart, f.cues = captionClock(), -1, nil
+	}
+	f.broadcast()
+}
+
+func (f *captionFeed) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.streams--
+	f.partial = ""
+	f.broadcast()
+}
+
+// apply updates the captions with a normalized streaming event. Events other
+// than partial and final transcripts are ignored.
+func (f *captionFeed) apply(event string) {
+	var ev struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal([]byte(event), &ev) != nil {
+		return
+	}
+	text := strings.TrimSpace(ev.Text)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := captionClock().Sub(f.startedAt)
+	switch ev.Type {
+	case "partial":
+		f.partial = text
+		if f.lineStart < 0 {
+			f.lineStart = now
+		}
+	case "final":
+		if text != "" {
+			f.lines = append(f.lines, text)
+			if n := len(f.lines); n > captionHistory {
+				f.lines = append([]string(nil), f.lines[n-captionHistory:]...)
+			}
+			f.addCue(now, text)
+		}
+		f.partial, f.lineStart = "", -1
+	default:
+		return
+	}
+	f.broadcast()
+}
+
+// addCue times a final line ending at end. Callers must hold f.mu.
+func (f *captionFeed) addCue(end time.Duration, text string) {
+	start := f.lineStart
+	if start < 0 {
+		start = 0
+		if n := len(f.cues); n > 0 {
+			start = f.cues[n-1].End
+		}
+	}
+	if end <= start {
+		end = start + time.Millisecond
+	}
+	f.cues = append(f.cues, captionCue{Start: start, End: end, Text: text})
+}
+
+// cuesFrom returns the cues of the current or last session from the n-th
+// on, the session's number, and whether it is still live.
+func (f *captionFeed) cuesFrom(n int) (int, []captionCue, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cues []captionCue
+	if n < len(f.cues) {
+		cues = append(cues, f.cues[n:]...)
+	}
+	return f.session, cues, f.streams > 0
+}
+
+// snapshot returns the current captions. Callers must hold f.mu.
+func (f *captionFeed) snapshot() captionSnapshot {
+	lines := append([]string{}, f.lines...)
+	return captionSnapshot{Type: "captions", Live: f.streams > 0, Lines: lines, Partial: f.partial}
+}
+
+// broadcast replaces whatever snapshot each subscriber has not read yet with
+// the current one. Callers must hold f.mu.
+func (f *captionFeed) broadcast() {
+	snap := f.snapshot()
+	for ch := range f.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- snap:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel that holds the current captions and then
+// receives every change.
+func (f *captionFeed) subscribe() chan captionSnapshot {
+	ch := make(chan captionSnapshot, 1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch <- f.snapshot()
+	f.subs[ch] = struct{}{}
+	return ch
+}
+
+func (f *captionFeed) unsubscribe(ch chan captionSnapshot) {
+	f.mu.Lock()
+	delete(f.subs, ch)
+	f.mu.Unlock()
+}
+
+// captionsPageHandler serves GET /captions/live, a page with a transparent
+// background meant to be added to OBS as a browser source.
+func captionsPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(captionsPage)
+}
+
+// captionsFeedHandler serves GET /captions/live/ws, a WebSocket that sends
+// the current captions on connect and again whenever they change. Messages
+// the client sends are ignored.
+func captionsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.conn.Close()
+	ch := liveCaptions.subscribe()
+	defer liveCaptions.unsubscribe(ch)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.readMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case snap := <-ch:
+			data, _ := json.Marshal(snap)
+			if err := ws.writeText(string(data)); err != nil {
+				return
+			}
+		case <-closed:
+			// readMessage has already answered the client's close frame.
+			return
+		}
+	}
+}
+
+// captionsVTTHandler serves GET /captions/live.vtt, the current session's
+// lines as WebVTT cues timed from its start. While the session is live the
+// response stays open and each line is appended as it is finished, so a
+// <track> on a player following the capture shows them as they come; it
+// ends with the session. Without a live session it is the last one's cues.
+func captionsVTTHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// Subscribe before reading the cues so none finished in between is lost.
+	ch := liveCaptions.subscribe()
+	defer liveCaptions.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, "WEBVTT\n\n")
+	session, sent := -1, 0
+	for {
+		s, cues, live := liveCaptions.cuesFrom(sent)
+		if session < 0 {
+			session = s
+		}
+		if s != session {
+			// A new session started; its cues are timed from another start.
+			return
+		}
+		for _, c := range cues {
+			fmt.Fprintf(w, "%s --> %s\n%s\n\n", vttTime(c.Start.Seconds()), vttTime(c.End.Seconds()), c.Text)
+		}
+		sent += len(cues)
+		flusher.Flush()
+		if !live {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useLiveCaptions(t *testing.T) *captionFeed {
+	t.Helper()
+	orig := liveCaptions
+	liveCaptions = &captionFeed{subs: map[chan captionSnapshot]struct{}{}}
+	t.Cleanup(func() { liveCaptions = orig })
+	return liveCaptions
+}
+
+func TestCaptionFeedKeepsRecentLines(t *testing.T) {
+	f := useLiveCaptions(t)
+	ch := f.subscribe()
+	defer f.unsubscribe(ch)
+	if snap := <-ch; snap.Live || len(snap.Lines) != 0 {
+		t.Fatalf("initial=%+v", snap)
+	}
+
+	f.start()
+	for i := 0; i < captionHistory+2; i++ {
+		f.apply(fmt.Sprintf(`{"type":"final","text":" line %d "}`, i))
+	}
+	f.apply(`{"type":"partial","text":"still talk"}`)
+	f.apply(`{"type":"done"}`)
+	f.apply(`not json`)
+	// Only the newest snapshot is waiting.
+	snap := <-ch
+	if !snap.Live || snap.Partial != "still talk" || len(snap.Lines) != captionHistory || snap.Lines[0] != "line 2" {
+		t.Fatalf("snapshot=%+v", snap)
+	}
+
+	f.stop()
+	if snap := <-ch; snap.Live || snap.Partial != "" || len(snap.Lines) != captionHistory {
+		t.Fatalf("after stop=%+v", snap)
+	}
+	f.start()
+	if snap := <-ch; !snap.Live || len(snap.Lines) != 0 {
+		t.Fatalf("new session kept old captions: %+v", snap)
+	}
+}
+
+func TestCaptionsFeedFollowsLiveTranscription(t *testing.T) {
+	useLiveCaptions(t)
+	useConfig(t, func(c *config) { c.StreamCommand = []string{"python3", "whisper_stream.py"} })
+	useFakeStreamBackend(t)
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	feed := dialTestWebSocket(t, srv, "/captions/live/ws")
+	next := func() captionSnapshot {
+		t.Helper()
+		_, msg := feed.read(t)
+		var snap captionSnapshot
+		if err := json.Unmarshal([]byte(msg), &snap); err != nil || snap.Type != "captions" {
+			t.Fatalf("feed sent %s", msg)
+		}
+		return snap
+	}
+	if snap := next(); snap.Live {
+		t.Fatalf("initial=%+v", snap)
+	}
+
+	c := dialTestWebSocket(t, srv, "/ws/transcribe?format=pcm_s16le&rate=16000")
+	c.send(t, wsOpBinary, make([]byte, 320))
+	c.read(t)
+	c.send(t, wsOpText, []byte(`{"type":"stop"}`))
+	for {
+		if _, msg := c.read(t); msg == `{"type":"done"}` {
+			break
+		}
+	}
+	for {
+		snap := next()
+		if !snap.Live {
+			if strings.Join(snap.Lines, "|") != "done after 320" {
+				t.Fatalf("final captions=%+v", snap)
+			}
+			break
+		}
+	}
+}
+
+func TestCaptionsPageIsServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/captions/live", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/ws") {
+		t.Fatalf("status=%d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("content type=%s", ct)
+	}
+}
+
+func TestCaptionsVTTStreamsCuesOfTheLiveSession(t *testing.T) {
+	f := useLiveCaptions(t)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	orig := captionClock
+	captionClock = func() time.Time { return now }
+	t.Cleanup(func() { captionClock = orig })
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	f.start()
+	now = now.Add(time.Second)
+	f.apply(`{"type":"partial","text":"hello"}`)
+	now = now.Add(2 * time.Second)
+	f.apply(`{"type":"final","text":"hello there"}`)
+
+	res, err := http.Get(srv.URL + "/captions/live.vtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/vtt") {
+		t.Fatalf("content type=%s", ct)
+	}
+	r := bufio.NewReader(res.Body)
+	readCue := func() string {
+		t.Helper()
+		var b strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read: %v after %q", err, b.String())
+			}
+			if line == "\n" {
+				return b.String()
+			}
+			b.WriteString(line)
+		}
+	}
+	if got := readCue(); got != "WEBVTT\n" {
+		t.Fatalf("header=%q", got)
+	}
+	if got := readCue(); got != "00:00:01.000 --> 00:00:03.000\nhello there\n" {
+		t.Fatalf("first cue=%q", got)
+	}
+
+	// A line with no partial runs from the end of the one before.
+	now = now.Add(2 * time.Second)
+	f.apply(`{"type":"final","text":"how are you"}`)
+	if got := readCue(); got != "00:00:03.000 --> 00:00:05.000\nhow are you\n" {
+		t.Fatalf("second cue=%q", got)
+	}
+	f.stop()
+	if rest, _ := io.ReadAll(r); len(rest) != 0 {
+		t.Fatalf("after stop=%q", rest)
+	}
+
+	// Once the session is over the last one is served whole.
+	res2, err := http.Get(srv.URL + "/captions/live.vtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res2.Body)
+	res2.Body.Close()
+	if strings.Count(string(body), " --> ") != 2 {
+		t.Fatalf("finished session=%q", body)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// probeChannels asks ffprobe how many channels the first audio stream of
+// fullPath has.
+func probeChannels(fullPath string) (int, error) {
+	out, err := runCommandFunc(context.Background(), cfg().FFprobePath,
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=channels",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		fullPath,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: %v: %s", filepath.Base(fullPath), err, strings.TrimSpace(string(out)))
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: unexpected channel count %q", filepath.Base(fullPath), strings.TrimSpace(string(out)))
+	}
+	return n, nil
+}
+
+// splitChannels writes the left and right channels of a stereo recording
+// to outDir as mono files, so each can be transcribed as a track of its
+// own: a capture with the user on one channel and the call on the other
+// is diarized without a model. The tracks' speakers come from
+// cfg.ChannelSpeakers; inputs are the files to transcribe for them.
+func splitChannels(ctx context.Context, rel, audio, outDir string) (tracks []sessionTrack, inputs []string, err error) {
+	n, err := probeChannels(audio)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n < 2 {
+		return nil, nil, errors.New("recording has a single channel; nothing to split")
+	}
+	stem := strings.TrimSuffix(filepath.Base(audio), filepath.Ext(audio))
+	left := filepath.Join(outDir, stem+".left.wav")
+	right := filepath.Join(outDir, stem+".right.wav")
+	out, err := runCommandFunc(ctx, cfg().FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", audio,
+		"-map", "0:a:0", "-af", "pan=mono|c0=c0", "-ar", "16000", left,
+		"-map", "0:a:0", "-af", "pan=mono|c0=c1", "-ar", "16000", right,
+	)
+	if err != nil {
+		return nil, nil, &jobDiagnostics{msg: fmt.Sprintf("split channels: %v", err), detail: outputTail(out)}
+	}
+	tracks = []sessionTrack{
+		{Name: "left", Path: rel, Speaker: cfg().ChannelSpeakers[0]},
+		{Name: "right", Path: rel, Speaker: cfg().ChannelSpeakers[1]},
+	}
+	return tracks, []string{left, right}, nil
+}
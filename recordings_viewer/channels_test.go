@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeStereo answers ffprobe with channels for a channel query and a one
+// minute duration otherwise, writes ffmpeg's outputs, and has whisper
+// transcribe each channel file from transcripts by stem.
+func fakeStereo(t *testing.T, channels string, transcripts map[string]string) {
+	t.Helper()
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ffprobe":
+			if argAfter(args, "-show_entries") == "stream=channels" {
+				return []byte(channels), nil
+			}
+			return []byte("60"), nil
+		case "ffmpeg":
+			for i, a := range args {
+				if strings.HasSuffix(a, ".wav") && args[i-1] != "-i" {
+					os.WriteFile(a, []byte("pcm"), 0o644)
+				}
+			}
+			return nil, nil
+		case "whisper":
+			stem := strings.TrimSuffix(filepath.Base(args[0]), ".wav")
+			doc, ok := transcripts[stem]
+			if !ok {
+				return nil, fmt.Errorf("unexpected input %s", args[0])
+			}
+			return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), stem+".json"), []byte(doc), 0o644)
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	})
+}
+
+func TestSplitChannelsLabelsSpeakers(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	useConfig(t, func(c *config) { c.ChannelSpeakers = []string{"Ana", "Client"} })
+	writeTestFiles(t, dir, "call.webm")
+	fakeStereo(t, "2", map[string]string{
+		"call.left":  `{"text":" Thanks for joining.","segments":[{"start":0,"end":2,"text":" Thanks for joining."}]}`,
+		"call.right": `{"text":" Happy to be here.","segments":[{"start":2.5,"end":4,"text":" Happy to be here."}]}`,
+	})
+
+	rec := httptest.NewRecorder()
+	transcribeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path": "call.webm", "splitChannels": true}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("queue: %d %s", rec.Code, rec.Body)
+	}
+	j, _ := jobs.claim()
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted || strings.Join(got.Output, ",") != "call.json,call.txt" {
+		t.Fatalf("job=%+v", got)
+	}
+	text, _ := os.ReadFile(filepath.Join(dir, "call.txt"))
+	if want := "Ana: Thanks for joining.\nClient: Happy to be here.\n"; string(text) != want {
+		t.Fatalf("txt=%q want %q", text, want)
+	}
+	doc, _ := loadTranscriptDoc(filepath.Join(dir, "call.webm"))
+	if len(doc.Segments) != 2 || doc.Segments[1].Speaker != "Client" {
+		t.Fatalf("doc=%+v", doc)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "call.webm"))
+	if meta.Transcription == nil || strings.Join(meta.Transcription.Tracks, ",") != "left,right" {
+		t.Fatalf("transcription=%+v", meta.Transcription)
+	}
+}
+
+func TestSplitChannelsRefusesMono(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	useConfig(t, func(c *config) { c.SplitChannels = true })
+	writeTestFiles(t, dir, "memo.webm")
+	fakeStereo(t, "1", nil)
+
+	j := queueTranscription(t, "memo.webm")
+	if !j.SplitChannels {
+		t.Fatalf("VIEWER_SPLIT_CHANNELS not applied: %+v", j)
+	}
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobFailed || !strings.Contains(got.Error, "single channel") {
+		t.Fatalf("job=%+v", got)
+	}
+}
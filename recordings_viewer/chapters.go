@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// chapterInfo is the chapters found in a recording, stored in its manifest.
+type chapterInfo struct {
+	Chapters    []chapter `json:"chapters"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+const (
+	// silenceNoise is the level below which ffmpeg's silencedetect counts
+	// audio as silent.
+	silenceNoise = "-35dB"
+	// chapterWindow is how much transcript on either side of a candidate
+	// boundary is compared to spot a topic shift.
+	chapterWindow = 2 * time.Minute
+	// chapterTitleWords is how many keywords make a chapter's title.
+	chapterTitleWords = 3
+)
+
+// silence is a stretch of silence ffmpeg found, in seconds.
+type silence struct {
+	start, end float64
+}
+
+var silenceLine = regexp.MustCompile(`silence_(start|end): (-?[0-9.]+)`)
+
+// detectSilences runs ffmpeg's silencedetect over the audio at fullPath and
+// returns the silences of at least cfg.ChapterSilence.
+func detectSilences(ctx context.Context, fullPath string) ([]silence, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%s:d=%s", silenceNoise, strconv.FormatFloat(cfg().ChapterSilence.Seconds(), 'f', -1, 64))
+	out, err := runCommandFunc(ctx, cfg().FFmpegPath, "-hide_banner", "-nostats", "-i", fullPath, "-vn", "-af", filter, "-f", "null", "-")
+	if err != nil {
+		return nil, &jobDiagnostics{msg: fmt.Sprintf("detect silences: %v", err), detail: outputTail(out)}
+	}
+	var found []silence
+	start := -1.0
+	for _, m := range silenceLine.FindAllStringSubmatch(string(out), -1) {
+		t, _ := strconv.ParseFloat(m[2], 64)
+		if m[1] == "start" {
+			start = max(t, 0)
+		} else if start >= 0 {
+			found = append(found, silence{start, t})
+			start = -1
+		}
+	}
+	return found, nil
+}
+
+// chapterCue is a place a chapter could start, scored by how clear a break
+// it is. A silence runs from from to at.
+type chapterCue struct {
+	at, from float64
+	score    float64
+	cues     []string
+}
+
+// topicShifts finds where the transcript changes subject, TextTiling
+// style: at each segment boundary the words of the chapterWindow before
+// and after are compared, and the boundaries where they have least in
+// common compared to their neighbours are shifts. The score is the depth of that
+// dip, from 0 to 2.
+func topicShifts(segs []segment) []chapterCue {
+	window := chapterWindow.Seconds()
+	var at, sims []float64
+	for i := 1; i < len(segs); i++ {
+		b := segs[i].Start
+		before, after := map[string]float64{}, map[string]float64{}
+		for _, s := range segs {
+			switch {
+			case s.Start >= b-window && s.Start < b:
+				addTerms(before, s.Text)
+			case s.Start >= b && s.Start < b+window:
+				addTerms(after, s.Text)
+			}
+		}
+		if len(before) == 0 || len(after) == 0 {
+			continue
+		}
+		at = append(at, b)
+		sims = append(sims, cosine(before, after))
+	}
+	// Only the valleys of the similarity curve can be shifts.
+	var valleys []int
+	var depths []float64
+	var sum, sumSq float64
+	for i, sim := range sims {
+		if (i > 0 && sims[i-1] < sim) || (i+1 < len(sims) && sims[i+1] < sim) {
+			continue
+		}
+		left, right := sim, sim
+		for j := i - 1; j >= 0 && sims[j] >= left && at[i]-at[j] <= window; j-- {
+			left = sims[j]
+		}
+		for j := i + 1; j < len(sims) && sims[j] >= right && at[j]-at[i] <= window; j++ {
+			right = sims[j]
+		}
+		d := left - sim + right - sim
+		valleys, depths = append(valleys, i), append(depths, d)
+		sum, sumSq = sum+d, sumSq+d*d
+	}
+	if len(depths) == 0 {
+		return nil
+	}
+	mean := sum / float64(len(depths))
+	cutoff := mean + math.Sqrt(max(sumSq/float64(len(depths))-mean*mean, 0))/2
+	var shifts []chapterCue
+	for k, d := range depths {
+		if d > 0 && d >= cutoff {
+			shifts = append(shifts, chapterCue{at: at[valleys[k]], score: d, cues: []string{"topic"}})
+		}
+	}
+	return shifts
+}
+
+func addTerms(tf map[string]float64, text string) {
+	for _, t := range keywordTerms(text) {
+		tf[t]++
+	}
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot, na, nb float64
+	for t, x := range a {
+		dot += x * b[t]
+		na += x * x
+	}
+	for _, y := range b {
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// planChapters splits a recording of duration seconds at the clearest of
+// its silences and topic shifts, keeping every chapter at least
+// cfg.ChapterMinLength long. A chapter starts where speech resumes after a
+// silence; a topic shift inside or next to a silence adds to its score.
+func planChapters(duration float64, silences []silence, shifts []chapterCue) []chapter {
+	var cues []chapterCue
+	for _, s := range silences {
+		if s.end < duration {
+			cues = append(cues, chapterCue{at: s.end, from: s.start, score: s.end - s.start, cues: []string{"silence"}})
+		}
+	}
+	for _, shift := range shifts {
+		i := slices.IndexFunc(cues, func(c chapterCue) bool {
+			return c.cues[0] == "silence" && shift.at >= c.from-1 && shift.at <= c.at+1
+		})
+		if i >= 0 {
+			cues[i].score += 10 * shift.score
+			cues[i].cues = append(cues[i].cues, "topic")
+		} else {
+			// A clear dip (depth 0.5) weighs like a five second pause.
+			cues = append(cues, chapterCue{at: shift.at, score: 10 * shift.score, cues: shift.cues})
+		}
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].score > cues[j].score })
+	minLen := cfg().ChapterMinLength.Seconds()
+	starts := []chapterCue{{at: 0}}
+	for _, c := range cues {
+		if c.at < minLen || duration-c.at < minLen {
+			continue
+		}
+		if !slices.ContainsFunc(starts, func(s chapterCue) bool { return math.Abs(s.at-c.at) < minLen }) {
+			starts = append(starts, c)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].at < starts[j].at })
+	chapters := make([]chapter, len(starts))
+	for i, s := range starts {
+		end := duration
+		if i+1 < len(starts) {
+			end = starts[i+1].at
+		}
+		chapters[i] = chapter{Start: roundOffset(s.at), End: roundOffset(end), Cues: s.cues}
+	}
+	return chapters
+}
+
+func roundOffset(s float64) float64 {
+	return math.Round(s*100) / 100
+}
+
+// titleChapters names each chapter after the words most particular to its
+// part of the transcript, e.g. "Budget, hiring, roadmap", or "Chapter 2"
+// when it has none.
+func titleChapters(chapters []chapter, segs []segment) {
+	texts := make([]string, len(chapters))
+	for _, s := range segs {
+		for i, c := range chapters {
+			if s.Start >= c.Start && (s.Start < c.End || i == len(chapters)-1) {
+				texts[i] += " " + s.Text
+				break
+			}
+		}
+	}
+	df := map[string]int{}
+	for _, text := range texts {
+		seen := map[string]bool{}
+		for _, t := range keywordTerms(text) {
+			if !seen[t] {
+				seen[t] = true
+				df[t]++
+			}
+		}
+	}
+	for i := range chapters {
+		words := topKeywords(texts[i], df, len(chapters))
+		if len(words) > chapterTitleWords {
+			words = words[:chapterTitleWords]
+		}
+		if len(words) == 0 {
+			chapters[i].Title = fmt.Sprintf("Chapter %d", i+1)
+			continue
+		}
+		title := strings.Join(words, ", ")
+		r, n := utf8.DecodeRuneInString(title)
+		chapters[i].Title = string(unicode.ToUpper(r)) + title[n:]
+	}
+}
+
+// detectChapters finds the chapters of the session s from the silences in
+// its audio and the topic shifts in its transcript, using whichever of the
+// two it has.
+func detectChapters(ctx context.Context, s *session) (chapterInfo, error) {
+	var segs []segment
+	if s.TranscriptJSON != "" {
+		doc, err := loadTranscriptDoc(absPath(s.TranscriptJSON))
+		if err != nil {
+			return chapterInfo{}, err
+		}
+		segs = doc.Segments
+	}
+	if s.Audio == "" && len(segs) == 0 {
+		return chapterInfo{}, errors.New("recording has no audio or timed transcript")
+	}
+	var duration float64
+	var silences []silence
+	if s.Audio != "" {
+		d, err := probeDuration(absPath(s.Audio))
+		if err != nil {
+			return chapterInfo{}, err
+		}
+		duration = d.Seconds()
+		if silences, err = detectSilences(ctx, absPath(s.Audio)); err != nil {
+			return chapterInfo{}, err
+		}
+	} else {
+		duration = segs[len(segs)-1].End
+	}
+	chapters := planChapters(duration, silences, topicShifts(segs))
+	titleChapters(chapters, segs)
+	return chapterInfo{Chapters: chapters, GeneratedAt: time.Now().UTC()}, nil
+}
+
+// storeChapters detects the chapters of the session containing rel and
+// saves them in its manifest, whose path it returns.
+func storeChapters(ctx context.Context, rel string) (string, error) {
+	s, err := findSession(rel)
+	if err != nil {
+		return "", err
+	}
+	info, err := detectChapters(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	meta, err := loadMeta(s.metaPath())
+	if err != nil {
+		return "", err
+	}
+	meta.Chapters = &info
+	if err := saveMeta(s.metaPath(), meta); err != nil {
+		return "", err
+	}
+	metaRel, _ := relPath(s.metaPath())
+	publishEvent("chapters.updated", s.ID, map[string]any{"chapters": len(info.Chapters)})
+	return metaRel, nil
+}
+
+// queueChaptersJob queues chapter detection for the recording at rel,
+// unless a job for it is already waiting.
+func queueChaptersJob(rel string) (*job, error) {
+	if jobs.pending("chapters", rel) {
+		return nil, errors.New("chapters are already being detected")
+	}
+	j := &job{ID: randomID(), Type: "chapters", Path: rel, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path)
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+	return j, nil
+}
+
+// chaptersHandler serves /api/sessions/{id}/chapters: GET returns the
+// stored chapters and POST queues a job that detects them again. New
+// transcripts get chapters on their own unless VIEWER_DETECT_CHAPTERS is
+// off.
+func chaptersHandler(w http.ResponseWriter, r *http.Request, s *session) {
+	switch r.Method {
+	case http.MethodGet:
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if meta.Chapters == nil {
+			http.Error(w, "no chapters yet", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, meta.Chapters)
+	case http.MethodPost:
+		rel := s.Audio
+		if rel == "" {
+			rel = s.TranscriptJSON
+		}
+		if rel == "" {
+			http.Error(w, "recording has no audio or timed transcript", http.StatusUnprocessableEntity)
+			return
+		}
+		j, err := queueChaptersJob(rel)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeJSONStatus(w, http.StatusAccepted, j)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// chaptersAfterTranscription queues chapter detection for a recording whose
+// transcript was just made.
+func chaptersAfterTranscription(rel string) {
+	if !cfg().DetectChapters || cfg().ReadOnly {
+		return
+	}
+	queueChaptersJob(rel)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// twoTopicSegments is ten minutes of talk about money and ten about
+// hiring, in 30 second segments.
+func twoTopicSegments() []segment {
+	var segs []segment
+	for i := range 40 {
+		text := " The budget invoice and spending."
+		if i >= 20 {
+			text = " The hiring candidate had a good interview."
+		}
+		segs = append(segs, segment{ID: i, Start: float64(i * 30), End: float64(i*30 + 30), Text: text})
+	}
+	return segs
+}
+
+func TestTopicShifts(t *testing.T) {
+	shifts := topicShifts(twoTopicSegments())
+	if len(shifts) != 1 || shifts[0].at != 600 || shifts[0].score != 2 {
+		t.Fatalf("shifts=%+v", shifts)
+	}
+	if shifts := topicShifts(twoTopicSegments()[:20]); len(shifts) != 0 {
+		t.Fatalf("one topic: %+v", shifts)
+	}
+}
+
+func TestPlanChapters(t *testing.T) {
+	silences := []silence{{600, 606}, {700, 703}, {2000, 2002}, {2700, 2704}, {3500, 3510}}
+	shifts := []chapterCue{{at: 1800, score: 0.8, cues: []string{"topic"}}, {at: 2701, score: 0.4, cues: []string{"topic"}}}
+	got := planChapters(3600, silences, shifts)
+	want := []chapter{
+		{Start: 0, End: 606},
+		{Start: 606, End: 1800, Cues: []string{"silence"}},
+		{Start: 1800, End: 2704, Cues: []string{"topic"}},
+		{Start: 2704, End: 3600, Cues: []string{"silence", "topic"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %+v\nwant %+v", got, want)
+	}
+	if got := planChapters(240, silences[:1], nil); len(got) != 1 || got[0].End != 240 {
+		t.Fatalf("short recording: %+v", got)
+	}
+}
+
+func TestChaptersEndpoint(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	writeTestFiles(t, dir, "call.webm")
+	doc, _ := json.Marshal(transcriptDoc{Segments: twoTopicSegments()})
+	if err := os.WriteFile(filepath.Join(dir, "call.json"), doc, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case cfg().FFprobePath:
+			return []byte("1200.5\n"), nil
+		case cfg().FFmpegPath:
+			if !strings.HasPrefix(argAfter(args, "-af"), "silencedetect=noise=-35dB:d=3") {
+				t.Fatalf("args=%v", args)
+			}
+			return []byte("[silencedetect @ 0x1] silence_start: 598.2\n[silencedetect @ 0x1] silence_end: 604.5 | silence_duration: 6.3\n"), nil
+		}
+		t.Fatalf("unexpected command %s", name)
+		return nil, nil
+	})
+	serve := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(method, "/api/sessions/call/chapters", nil))
+		return rec
+	}
+
+	if rec := serve(http.MethodGet); rec.Code != http.StatusNotFound {
+		t.Fatalf("before detection: %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost); rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"type":"chapters"`) {
+		t.Fatalf("post: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodPost); rec.Code != http.StatusConflict {
+		t.Fatalf("while pending: %d", rec.Code)
+	}
+	j, _ := jobs.claim()
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted {
+		t.Fatalf("job=%+v", got)
+	}
+
+	rec := serve(http.MethodGet)
+	var info chapterInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("get: %d %s", rec.Code, rec.Body)
+	}
+	want := []chapter{
+		{Start: 0, End: 604.5, Title: "Budget, invoice, spending"},
+		{Start: 604.5, End: 1200.5, Title: "Candidate, good, hiring", Cues: []string{"silence", "topic"}},
+	}
+	if !reflect.DeepEqual(info.Chapters, want) || info.GeneratedAt.IsZero() {
+		t.Fatalf("chapters=%+v", info)
+	}
+	// Tagging the audio carries the chapters into the file.
+	s, _ := findSession("call")
+	if tags := defaultAudioTags(s); len(tags.Chapters) != 2 {
+		t.Fatalf("tags=%+v", tags)
+	}
+}
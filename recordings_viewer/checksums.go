@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileChecksum is the SHA-256 of a recording file as last written by the
+// server, with the size and modification time it had then.
+type fileChecksum struct {
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+func checksumsPath() string {
+	return filepath.Join(stateDir(), "checksums.json")
+}
+
+// loadChecksums reads the checksum index keyed by recordings path (see
+// relPath). Callers hold mu.
+func loadChecksums() (map[string]fileChecksum, error) {
+	items := map[string]fileChecksum{}
+	data, err := os.ReadFile(checksumsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func saveChecksums(items map[string]fileChecksum) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(checksumsPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// checksumKey returns the index key for fullPath, or "" for files the index
+// does not cover: anything outside the workspaces, state dirs, and partial
+// writes.
+func checksumKey(fullPath string) string {
+	rel, ok := relPath(fullPath)
+	if !ok {
+		return ""
+	}
+	_, inner, err := splitWorkspace(rel)
+	if err != nil || inner == "" || inner == ".viewer" || strings.HasPrefix(inner, ".viewer/") || strings.HasSuffix(rel, ".tmp") {
+		return ""
+	}
+	return rel
+}
+
+func hashFile(fullPath string) (string, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// updateChecksums applies fn to the index and saves it. Failures are logged:
+// a stale index entry shows up in the next verify rather than failing the
+// write that triggered it. Callers hold mu.
+func updateChecksums(fn func(items map[string]fileChecksum)) {
+	items, err := loadChecksums()
+	if err != nil {
+		slog.Error("update checksum index", "err", err)
+		return
+	}
+	fn(items)
+	if err := saveChecksums(items); err != nil {
+		slog.Error("update checksum index", "err", err)
+	}
+}
+
+// recordChecksum stores sum for the file just written at fullPath. Callers
+// hold mu.
+func recordChecksum(fullPath, sum string) {
+	key := checksumKey(fullPath)
+	if key == "" {
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return
+	}
+	updateChecksums(func(items map[string]fileChecksum) {
+		items[key] = fileChecksum{SHA256: sum, Size: info.Size(), ModTime: info.ModTime().UTC()}
+	})
+}
+
+// trackFiles hashes files the server produced without writeFileAtomic (ffmpeg
+// outputs, renames) and records them. Callers hold mu.
+func trackFiles(paths ...string) {
+	for _, p := range paths {
+		if checksumKey(p) == "" {
+			continue
+		}
+		sum, err := hashFile(p)
+		if err != nil {
+			slog.Warn("checksum", "path", p, "err", err)
+			continue
+		}
+		recordChecksum(p, sum)
+	}
+}
+
+// forgetFiles drops index entries for files the server removed. Callers
+// hold mu.
+func forgetFiles(paths ...string) {
+	updateChecksums(func(items map[string]fileChecksum) {
+		for _, p := range paths {
+			delete(items, checksumKey(p))
+		}
+	})
+}
+
+// moveChecksum re-keys the entry for a file the server renamed. Callers
+// hold mu.
+func moveChecksum(from, to string) {
+	updateChecksums(func(items map[string]fileChecksum) {
+		if c, ok := items[checksumKey(from)]; ok {
+			delete(items, checksumKey(from))
+			if key := checksumKey(to); key != "" {
+				items[key] = c
+			}
+		}
+	})
+}
+
+type verifyMismatch struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// verifyReport is the result of re-hashing the recordings tree. Corrupted
+// files changed content while keeping their size and modification time,
+// which is what bit rot looks like; modified files were changed outside the
+// server.
+type verifyReport struct {
+	CheckedAt time.Time        `json:"checkedAt"`
+	Checked   int              `json:"checked"`
+	OK        int              `json:"ok"`
+	Corrupted []verifyMismatch `json:"corrupted"`
+	Modified  []verifyMismatch `json:"modified"`
+	Missing   []string         `json:"missing"`
+	Untracked []string         `json:"untracked"`
+	Errors    []string         `json:"errors,omitempty"`
+}
+
+// verifyChecksums re-hashes every recording file against the index. With
+// update set, untracked and modified files are adopted and missing entries
+// dropped; corrupted entries are always kept so the damage stays visible.
+func verifyChecksums(update bool) (verifyReport, error) {
+	report := verifyReport{
+		CheckedAt: time.Now().UTC(),
+		Corrupted: []verifyMismatch{}, Modified: []verifyMismatch{}, Missing: []string{}, Untracked: []string{},
+	}
+	mu.Lock()
+	index, err := loadChecksums()
+	mu.Unlock()
+	if err != nil {
+		return report, err
+	}
+
+	adopt := map[string]fileChecksum{}
+	seen := map[string]bool{}
+	err = walkRecordings(func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			return nil
+		}
+		key := checksumKey(p)
+		if d.IsDir() {
+			if key == "" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if key == "" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			return nil
+		}
+		sum, err := hashFile(p)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			return nil
+		}
+		seen[key] = true
+		report.Checked++
+		current := fileChecksum{SHA256: sum, Size: info.Size(), ModTime: info.ModTime().UTC()}
+		want, ok := index[key]
+		switch {
+		case !ok:
+			report.Untracked = append(report.Untracked, key)
+			adopt[key] = current
+		case want.SHA256 == sum:
+			report.OK++
+			if !want.ModTime.Equal(current.ModTime) {
+				adopt[key] = current
+			}
+		case want.Size == current.Size && want.ModTime.Equal(current.ModTime):
+			report.Corrupted = append(report.Corrupted, verifyMismatch{Path: key, Expected: want.SHA256, Actual: sum})
+		default:
+			report.Modified = append(report.Modified, verifyMismatch{Path: key, Expected: want.SHA256, Actual: sum})
+			adopt[key] = current
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	for key := range index {
+		if !seen[key] {
+			report.Missing = append(report.Missing, key)
+		}
+	}
+	sort.Strings(report.Missing)
+
+	if update {
+		mu.Lock()
+		updateChecksums(func(items map[string]fileChecksum) {
+			for key, c := range adopt {
+				items[key] = c
+			}
+			for _, key := range report.Missing {
+				delete(items, key)
+			}
+		})
+		mu.Unlock()
+	}
+	return report, nil
+}
+
+// verifyHandler serves GET /api/verify, which only reports, and POST,
+// which also adopts the changes it finds into the checksum index. Updating
+// is a write so that it needs the auth token.
+func verifyHandler(w http.ResponseWriter, r *http.Request) {
+	update := false
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Has("update") {
+			http.Error(w, "use POST /api/verify to update the checksums", http.StatusMethodNotAllowed)
+			return
+		}
+	case http.MethodPost:
+		update = true
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if update && cfg().ReadOnly {
+		http.Error(w, "server is read-only", http.StatusForbidden)
+		return
+	}
+	report, err := verifyChecksums(update)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// runScheduledVerify verifies the tree and publishes "verify.failed" when
+// files are corrupted or missing.
+func runScheduledVerify(now time.Time) {
+	report, err := verifyChecksums(false)
+	if err != nil {
+		slog.Error("verify", "err", err)
+		return
+	}
+	if len(report.Corrupted) > 0 || len(report.Missing) > 0 {
+		slog.Warn("verify found damaged files", "corrupted", len(report.Corrupted), "missing", len(report.Missing), "checked", report.Checked)
+		publishEvent("verify.failed", "", map[string]any{"corrupted": report.Corrupted, "missing": report.Missing})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomicRecordsChecksum(t *testing.T) {
+	dir := useTempBaseDir(t)
+	mu.Lock()
+	_, err := writeFileAtomic(filepath.Join(dir, "a/talk.txt"), strings.NewReader("hello"))
+	items, _ := loadChecksums()
+	mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := items["a/talk.txt"]
+	if !ok || c.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" || c.Size != 5 {
+		t.Fatalf("checksums=%+v", items)
+	}
+	for key := range items {
+		if strings.HasPrefix(key, ".viewer") {
+			t.Fatalf("state files must not be indexed: %v", items)
+		}
+	}
+}
+
+func TestVerifyReportsCorruptedModifiedMissingAndUntracked(t *testing.T) {
+	dir := useTempBaseDir(t)
+	mu.Lock()
+	for _, name := range []string{"rot.webm", "edited.txt", "gone.txt", "fine.txt"} {
+		if _, err := writeFileAtomic(filepath.Join(dir, name), strings.NewReader("original "+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Unlock()
+	writeTestFiles(t, dir, "new.webm")
+
+	// Flip content but keep size and mtime, as bit rot would.
+	rot := filepath.Join(dir, "rot.webm")
+	info, _ := os.Stat(rot)
+	if err := os.WriteFile(rot, []byte("ORIGINAL rot.webm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(rot, info.ModTime(), info.ModTime())
+	later := time.Now().Add(time.Minute)
+	os.WriteFile(filepath.Join(dir, "edited.txt"), []byte("changed"), 0o644)
+	os.Chtimes(filepath.Join(dir, "edited.txt"), later, later)
+	os.Remove(filepath.Join(dir, "gone.txt"))
+
+	rec := httptest.NewRecorder()
+	verifyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/verify", nil))
+	var report verifyReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Checked != 4 || report.OK != 1 ||
+		len(report.Corrupted) != 1 || report.Corrupted[0].Path != "rot.webm" ||
+		len(report.Modified) != 1 || report.Modified[0].Path != "edited.txt" ||
+		len(report.Missing) != 1 || report.Missing[0] != "gone.txt" ||
+		len(report.Untracked) != 1 || report.Untracked[0] != "new.webm" {
+		t.Fatalf("report=%+v", report)
+	}
+
+	rec = httptest.NewRecorder()
+	verifyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/verify?update=1", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET ?update=1 status=%d want 405", rec.Code)
+	}
+	if report, _ = verifyChecksums(false); len(report.Untracked) != 1 {
+		t.Fatalf("GET updated the checksums: %+v", report)
+	}
+	rec = httptest.NewRecorder()
+	verifyHandler(rec, httptest.NewRequest(http.MethodPost, "/api/verify", nil))
+	report, _ = verifyChecksums(false)
+	if report.OK != 3 || len(report.Corrupted) != 1 || len(report.Missing) != 0 || len(report.Untracked) != 0 {
+		t.Fatalf("after update report=%+v", report)
+	}
+}
+
+func TestRenameMovesChecksums(t *testing.T) {
+	dir := useTempBaseDir(t)
+	mu.Lock()
+	writeFileAtomic(filepath.Join(dir, "old.txt"), strings.NewReader("x"))
+	mu.Unlock()
+	writeTestFiles(t, dir, "old.webm")
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/transcripts/old.webm/rename", strings.NewReader(`{"name":"new"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	mu.Lock()
+	items, _ := loadChecksums()
+	mu.Unlock()
+	if _, ok := items["new.txt"]; !ok {
+		t.Fatalf("checksum not moved: %v", items)
+	}
+	if _, ok := items["old.txt"]; ok {
+		t.Fatalf("old key left behind: %v", items)
+	}
+}
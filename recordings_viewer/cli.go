@@ -0,0 +1,537 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exit codes of the subcommands, for scripts and cron jobs.
+const (
+	exitOK = 0
+	// exitFailed means nothing was done, e.g. every recording failed.
+	exitFailed = 1
+	// exitPartial means some items failed and the rest succeeded, or a
+	// check found problems.
+	exitPartial = 2
+	// exitConfig means the command could not run as given: bad usage, an
+	// invalid setting, or a missing tool.
+	exitConfig = 3
+)
+
+// cli is what every subcommand shares: where to print, whether to print
+// JSON (-json) rather than text meant for people, and how much to say.
+type cli struct {
+	json bool
+	// quiet drops the text results, leaving errors and the exit code;
+	// verbose reports progress and debug logs on stderr.
+	quiet, verbose bool
+	// logLevelSet is set when -log-level was given, which quiet and verbose
+	// then leave alone.
+	logLevelSet bool
+	stdin       io.Reader
+	stdout      io.Writer
+	stderr      io.Writer
+}
+
+// cliCommands are the subcommands run as `viewer_server [-json] <name> ...`
+// against the recordings directory, without starting the server.
+var cliCommands = map[string]func(c *cli, args []string) int{
+	"transcribe": cliTranscribe,
+	"search":     cliSearch,
+	"stats":      cliStats,
+	"verify":     cliVerify,
+	"doctor":     cliDoctor,
+	"secrets":    cliSecrets,
+	"sync":       cliSync,
+}
+
+// runCLI runs the subcommand named by args[0] with the global options in c
+// and returns the process exit code.
+func runCLI(c *cli, args []string) int {
+	run, ok := cliCommands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(cliCommands))
+		for name := range cliCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(c.stderr, "unknown command %q; commands: service, %s\n", args[0], strings.Join(names, ", "))
+		return exitConfig
+	}
+	return run(c, args[1:])
+}
+
+// flags returns the flag set of the named subcommand. It accepts -json,
+// -quiet and -verbose too, so they may follow the subcommand.
+func (c *cli) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.BoolVar(&c.json, "json", c.json, "print machine-readable JSON")
+	fs.BoolVar(&c.quiet, "quiet", c.quiet, "print only errors")
+	fs.BoolVar(&c.verbose, "verbose", c.verbose, "report progress and debug logs")
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: viewer_server %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args with fs, allowing flags after the positional
+// arguments, and returns the positional ones. It then sets the log level
+// for -quiet or -verbose.
+func (c *cli) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+	if c.quiet && c.verbose {
+		err := errors.New("-quiet and -verbose cannot be combined")
+		fmt.Fprintln(c.stderr, err)
+		return nil, err
+	}
+	switch {
+	case c.logLevelSet:
+	case c.quiet:
+		logLevel.Set(slog.LevelError)
+	case c.verbose:
+		logLevel.Set(slog.LevelDebug)
+	}
+	return rest, nil
+}
+
+// parseNone parses args for a subcommand that takes no positional
+// arguments.
+func (c *cli) parseNone(fs *flag.FlagSet, args []string) error {
+	rest, err := c.parse(fs, args)
+	if err == nil && len(rest) > 0 {
+		fs.Usage()
+		err = fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	return err
+}
+
+// print writes v as JSON with -json, and calls text otherwise. With
+// -quiet, text only gets to report problems.
+func (c *cli) print(v any, text func(w io.Writer)) {
+	if !c.json {
+		if c.quiet {
+			text(io.Discard)
+		} else {
+			text(c.stdout)
+		}
+		return
+	}
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// fail reports err, as {"error": ...} with -json, and returns code.
+func (c *cli) fail(code int, err error) int {
+	if c.json {
+		c.print(map[string]string{"error": err.Error()}, nil)
+	} else {
+		fmt.Fprintln(c.stderr, err)
+	}
+	return code
+}
+
+// problem writes a line about a failed item to the results in w, or to
+// stderr with -quiet.
+func (c *cli) problem(w io.Writer, format string, args ...any) {
+	if c.quiet {
+		w = c.stderr
+	}
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+// progress reports work under way on stderr with -verbose.
+func (c *cli) progress(format string, args ...any) {
+	if c.verbose {
+		fmt.Fprintf(c.stderr, format+"\n", args...)
+	}
+}
+
+// batchExit is the exit code of a batch in which failed of total items
+// failed.
+func batchExit(failed, total int) int {
+	switch {
+	case failed == 0:
+		return exitOK
+	case failed < total:
+		return exitPartial
+	}
+	return exitFailed
+}
+
+// cliRecordingPath accepts either a file path, relative to the working
+// directory, inside a workspace or a recordings path such as "2024/call.webm".
+func cliRecordingPath(arg string) (string, error) {
+	if full, err := filepath.Abs(arg); err == nil {
+		if _, err := os.Stat(full); err == nil {
+			if rel, ok := relPath(full); ok {
+				return rel, nil
+			}
+		}
+	}
+	rel, full, err := resolveRecordingPath(arg)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(full); err != nil {
+		return "", fmt.Errorf("%s: recording not found", arg)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// cliTranscribe transcribes the given recordings in this process, one after
+// another, including the follow-up work a server job does. A recording that
+// cannot be found fails on its own without stopping the others.
+func cliTranscribe(c *cli, args []string) int {
+	fs := c.flags("transcribe", "[-engine name] [-model name] <audio>...")
+	engine := fs.String("engine", cfg().DefaultEngine, "transcription engine")
+	model := fs.String("model", "", "model (default VIEWER_DEFAULT_MODEL)")
+	paths, err := c.parse(fs, args)
+	if err != nil {
+		return exitConfig
+	}
+	if len(paths) == 0 {
+		fs.Usage()
+		return exitConfig
+	}
+	if cfg().ReadOnly {
+		return c.fail(exitConfig, errors.New("recordings are read-only"))
+	}
+	if _, ok := cfg().Engines[*engine]; !ok {
+		return c.fail(exitConfig, fmt.Errorf("unknown engine %q", *engine))
+	}
+	results := make([]job, len(paths))
+	var queued []*job
+	for i, p := range paths {
+		rel, err := cliRecordingPath(p)
+		if err == nil && !isAudioFile(rel) {
+			err = fmt.Errorf("%s: not an audio file", p)
+		}
+		if err != nil {
+			results[i] = job{Type: "transcribe", Path: p, Status: jobFailed, Error: err.Error()}
+			continue
+		}
+		j, err := queueTranscribeJob(rel, *engine, *model)
+		if err != nil {
+			results[i] = job{Type: "transcribe", Path: rel, Status: jobFailed, Error: err.Error()}
+			continue
+		}
+		results[i].ID = j.ID
+		queued = append(queued, j)
+	}
+	for j, ok := jobs.claim(); ok; j, ok = jobs.claim() {
+		c.progress("%s %s (attempt %d)", j.Type, j.Path, j.Attempts)
+		start := time.Now()
+		runJob(j)
+		final, _ := jobs.get(j.ID)
+		c.progress("%s %s: %s in %s", j.Type, j.Path, final.Status, time.Since(start).Round(time.Millisecond))
+	}
+
+	failed := 0
+	for i := range results {
+		if results[i].ID != "" {
+			results[i], _ = jobs.get(results[i].ID)
+		}
+		if results[i].Status != jobCompleted {
+			failed++
+		}
+	}
+	c.print(results, func(w io.Writer) {
+		for _, j := range results {
+			if j.Status == jobCompleted {
+				fmt.Fprintf(w, "%s: %s\n", j.Path, strings.Join(j.Output, ", "))
+			} else {
+				c.problem(w, "%s: failed: %s", j.Path, j.Error)
+			}
+		}
+	})
+	return batchExit(failed, len(results))
+}
+
+// searchHit is one transcript segment matching a search. Complete is false
+// for a segment of a recording still being transcribed, whose Path is the
+// audio.
+type searchHit struct {
+	Session  string  `json:"session"`
+	Path     string  `json:"path"`
+	Segment  int     `json:"segment"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Text     string  `json:"text"`
+	Complete bool    `json:"complete"`
+}
+
+// cliSearch prints the transcript segments the query matches (see
+// searchQuery), and those transcription jobs running now have produced so
+// far. Transcripts that cannot be read make it a partial failure.
+func cliSearch(c *cli, args []string) int {
+	fs := c.flags("search", "[-limit n] [-regex] <query>")
+	limit := fs.Int("limit", 50, "print at most this many matches; 0 for all")
+	regex := fs.Bool("regex", false, "match the query's terms as regular expressions")
+	words, err := c.parse(fs, args)
+	if err != nil {
+		return exitConfig
+	}
+	if len(words) == 0 {
+		fs.Usage()
+		return exitConfig
+	}
+	query, err := parseSearchQuery(strings.Join(words, " "), *regex)
+	if err != nil {
+		return c.fail(exitConfig, err)
+	}
+	sessions, err := scanSessions()
+	if err != nil {
+		return c.fail(exitFailed, err)
+	}
+	hits := []searchHit{}
+	unreadable := 0
+search:
+	for i := range sessions {
+		s := &sessions[i]
+		src := s.TranscriptJSON
+		if src == "" {
+			src = s.Transcript
+		}
+		if src == "" || !query.matchesSession(s) {
+			continue
+		}
+		c.progress("searching %s", src)
+		doc, err := loadTranscriptDoc(absPath(src))
+		if err != nil {
+			fmt.Fprintf(c.stderr, "%s: %v\n", src, err)
+			unreadable++
+			continue
+		}
+		for n, seg := range doc.Segments {
+			if query.matchSegment(seg) == nil {
+				continue
+			}
+			if *limit > 0 && len(hits) == *limit {
+				break search
+			}
+			hits = append(hits, searchHit{Session: s.ID, Path: src, Segment: n, Start: seg.Start, End: seg.End, Text: strings.TrimSpace(seg.Text), Complete: true})
+		}
+	}
+	running, err := loadPartialTranscripts()
+	if err != nil {
+		fmt.Fprintf(c.stderr, "transcriptions in progress: %v\n", err)
+		unreadable++
+	}
+partial:
+	for _, p := range running {
+		s, err := findSession(p.Path)
+		if err != nil {
+			s = &session{ID: strings.TrimSuffix(p.Path, filepath.Ext(p.Path))}
+		}
+		if !query.matchesSession(s) {
+			continue
+		}
+		id := s.ID
+		for n, seg := range p.Segments {
+			if query.matchSegment(seg) == nil {
+				continue
+			}
+			if *limit > 0 && len(hits) >= *limit {
+				break partial
+			}
+			hits = append(hits, searchHit{Session: id, Path: p.Path, Segment: n, Start: seg.Start, End: seg.End, Text: strings.TrimSpace(seg.Text)})
+		}
+	}
+	c.print(hits, func(w io.Writer) {
+		for _, h := range hits {
+			if h.Complete {
+				fmt.Fprintf(w, "%s [%s] %s\n", h.Path, clockTime(h.Start), h.Text)
+			} else {
+				fmt.Fprintf(w, "%s [%s] %s (still transcribing)\n", h.Path, clockTime(h.Start), h.Text)
+			}
+		}
+	})
+	if unreadable > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
+
+// cliStats prints the totals of GET /api/stats.
+func cliStats(c *cli, args []string) int {
+	fs := c.flags("stats", "")
+	if err := c.parseNone(fs, args); err != nil {
+		return exitConfig
+	}
+	st, err := collectStats()
+	if err != nil {
+		return c.fail(exitFailed, err)
+	}
+	c.print(st, func(w io.Writer) {
+		fmt.Fprintf(w, "recordings  %d\nfiles       %d\nsize        %s\n", st.Recordings, st.Files, formatBytes(st.TotalBytes))
+		if st.FreeBytes != nil {
+			fmt.Fprintf(w, "disk free   %s of %s\n", formatBytes(int64(*st.FreeBytes)), formatBytes(int64(*st.TotalDisk)))
+		}
+		if st.Oldest != nil {
+			fmt.Fprintf(w, "oldest      %s (%s)\nnewest      %s (%s)\n",
+				st.Oldest.Path, st.Oldest.ModTime.Format("2006-01-02"), st.Newest.Path, st.Newest.ModTime.Format("2006-01-02"))
+		}
+		for _, e := range st.ByExtension {
+			fmt.Fprintf(w, "  %-12s %6d files  %10s\n", e.Ext, e.Files, formatBytes(e.Bytes))
+		}
+	})
+	return exitOK
+}
+
+// formatBytes renders n in binary units, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// cliVerify runs the integrity check of GET /api/verify. Corrupted, missing
+// or unreadable files make it a partial failure.
+func cliVerify(c *cli, args []string) int {
+	fs := c.flags("verify", "[-update]")
+	update := fs.Bool("update", false, "adopt new and changed files into the checksum index")
+	if err := c.parseNone(fs, args); err != nil {
+		return exitConfig
+	}
+	if *update && cfg().ReadOnly {
+		return c.fail(exitConfig, errors.New("recordings are read-only"))
+	}
+	report, err := verifyChecksums(*update)
+	if err != nil {
+		return c.fail(exitFailed, err)
+	}
+	c.print(report, func(w io.Writer) {
+		fmt.Fprintf(w, "checked %d files: %d ok, %d corrupted, %d modified, %d missing, %d untracked\n",
+			report.Checked, report.OK, len(report.Corrupted), len(report.Modified), len(report.Missing), len(report.Untracked))
+		for _, m := range report.Corrupted {
+			c.problem(w, "corrupted  %s", m.Path)
+		}
+		for _, m := range report.Modified {
+			fmt.Fprintf(w, "modified   %s\n", m.Path)
+		}
+		for _, p := range report.Missing {
+			c.problem(w, "missing    %s", p)
+		}
+		for _, e := range report.Errors {
+			c.problem(w, "error      %s", e)
+		}
+		if c.verbose {
+			for _, p := range report.Untracked {
+				fmt.Fprintf(w, "untracked  %s\n", p)
+			}
+		}
+	})
+	if len(report.Corrupted) > 0 || len(report.Missing) > 0 || len(report.Errors) > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
+
+// doctorCheck is one finding of `viewer_server doctor`.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// cliDoctor checks that the recordings are reachable and writable and that
+// the configured tools can be found. A failed check is a configuration
+// problem.
+func cliDoctor(c *cli, args []string) int {
+	fs := c.flags("doctor", "")
+	if err := c.parseNone(fs, args); err != nil {
+		return exitConfig
+	}
+	var checks []doctorCheck
+	check := func(name, detail string, err error) {
+		if err != nil {
+			detail = err.Error()
+		}
+		checks = append(checks, doctorCheck{Name: name, OK: err == nil, Detail: detail})
+	}
+	for _, ws := range workspaces() {
+		info, err := os.Stat(ws.Dir)
+		if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", ws.Dir)
+		}
+		check("workspace "+ws.Name, ws.Dir, err)
+	}
+	if cfg().ReadOnly {
+		check("state directory", "skipped: read-only", nil)
+	} else {
+		err := os.MkdirAll(stateDir(), 0o755)
+		if err == nil {
+			var f *os.File
+			if f, err = os.CreateTemp(stateDir(), "doctor-*.tmp"); err == nil {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}
+		check("state directory", stateDir()+" is writable", err)
+	}
+	lookPath := func(name, bin string) {
+		full, err := exec.LookPath(bin)
+		check(name, full, err)
+	}
+	lookPath("ffmpeg", cfg().FFmpegPath)
+	lookPath("ffprobe", cfg().FFprobePath)
+	engines := make([]string, 0, len(cfg().Engines))
+	for name := range cfg().Engines {
+		engines = append(engines, name)
+	}
+	sort.Strings(engines)
+	for _, name := range engines {
+		lookPath("engine "+name, cfg().Engines[name].Binary)
+	}
+
+	failed := 0
+	for _, ch := range checks {
+		if !ch.OK {
+			failed++
+		}
+	}
+	c.print(checks, func(w io.Writer) {
+		for _, ch := range checks {
+			if ch.OK {
+				fmt.Fprintf(w, "ok    %-18s %s\n", ch.Name, ch.Detail)
+			} else {
+				c.problem(w, "FAIL  %-18s %s", ch.Name, ch.Detail)
+			}
+		}
+	})
+	if failed > 0 {
+		return exitConfig
+	}
+	return exitOK
+}
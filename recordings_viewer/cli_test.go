@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runTestCLI runs a subcommand and returns its exit code and output.
+func runTestCLI(t *testing.T, asJSON bool, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	level := logLevel.Level()
+	t.Cleanup(func() { logLevel.Set(level) })
+	code := runCLI(&cli{json: asJSON, stdout: &stdout, stderr: &stderr}, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLIStatsJSON(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "a.txt", "b.webm")
+
+	code, out, _ := runTestCLI(t, true, "stats")
+	var st storageStats
+	if code != 0 || json.Unmarshal([]byte(out), &st) != nil || st.Recordings != 2 || st.Files != 3 {
+		t.Fatalf("code = %d, stats = %s", code, out)
+	}
+	// -json may follow the subcommand as well.
+	if _, out, _ := runTestCLI(t, false, "stats", "--json"); !json.Valid([]byte(out)) {
+		t.Fatalf("stats --json = %q", out)
+	}
+	if _, out, _ := runTestCLI(t, false, "stats"); !strings.Contains(out, "recordings  2") {
+		t.Fatalf("stats = %q", out)
+	}
+}
+
+func TestCLISearch(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+	os.WriteFile(filepath.Join(dir, "call.json"), []byte(segmentsFixture), 0o644)
+	os.WriteFile(filepath.Join(dir, "memo.txt"), []byte("Nothing to see."), 0o644)
+
+	code, out, _ := runTestCLI(t, false, "search", "kenobi", "-json")
+	var hits []searchHit
+	if code != 0 || json.Unmarshal([]byte(out), &hits) != nil {
+		t.Fatalf("code = %d, out = %s", code, out)
+	}
+	if len(hits) != 1 || hits[0].Session != "call" || hits[0].Segment != 1 || hits[0].Start != 1.5 {
+		t.Fatalf("hits = %+v", hits)
+	}
+	if _, out, _ := runTestCLI(t, false, "search", "Kenobi"); !strings.HasPrefix(out, "call.json [00:00:01] ") {
+		t.Fatalf("search = %q", out)
+	}
+	if code, _, _ := runTestCLI(t, false, "search"); code != exitConfig {
+		t.Fatalf("search without text exited %d", code)
+	}
+}
+
+func TestCLIVerifyFailsOnMissingFiles(t *testing.T) {
+	dir := useTempBaseDir(t)
+	mu.Lock()
+	writeFileAtomic(filepath.Join(dir, "a.txt"), strings.NewReader("a"))
+	writeFileAtomic(filepath.Join(dir, "b.txt"), strings.NewReader("b"))
+	mu.Unlock()
+
+	if code, out, _ := runTestCLI(t, false, "verify"); code != 0 || !strings.Contains(out, "2 ok") {
+		t.Fatalf("verify = %d %q", code, out)
+	}
+	os.Remove(filepath.Join(dir, "b.txt"))
+	code, out, _ := runTestCLI(t, true, "verify")
+	var report verifyReport
+	json.Unmarshal([]byte(out), &report)
+	if code != exitPartial || len(report.Missing) != 1 || report.Missing[0] != "b.txt" {
+		t.Fatalf("verify = %d %s", code, out)
+	}
+}
+
+func TestCLIDoctor(t *testing.T) {
+	useTempBaseDir(t)
+	exe, _ := os.Executable()
+	useConfig(t, func(c *config) {
+		c.FFmpegPath = exe
+		c.FFprobePath = exe
+		c.Engines = map[string]engineConfig{"whisper": {Binary: filepath.Join(t.TempDir(), "no-such-whisper")}}
+	})
+
+	code, out, _ := runTestCLI(t, true, "doctor")
+	var checks []doctorCheck
+	if err := json.Unmarshal([]byte(out), &checks); err != nil {
+		t.Fatalf("doctor = %s", out)
+	}
+	failed := map[string]bool{}
+	for _, c := range checks {
+		failed[c.Name] = !c.OK
+	}
+	if code != exitConfig || !failed["engine whisper"] || failed["ffmpeg"] || failed["state directory"] || failed["workspace default"] {
+		t.Fatalf("doctor = %d %s", code, out)
+	}
+}
+
+func TestCLITranscribe(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	useConfig(t, func(c *config) { c.ExtractKeywords = false })
+	writeTestFiles(t, dir, "call.webm")
+	fakeWhisper(t, "60", func(_ context.Context, args []string) ([]byte, error) {
+		out := argAfter(args, "--output_dir")
+		return nil, os.WriteFile(filepath.Join(out, "call.json"), []byte(`{"text":" Hello. ","segments":[]}`), 0o644)
+	})
+
+	// A file path inside the recordings works as well as a recordings path.
+	code, out, stderr := runTestCLI(t, true, "transcribe", filepath.Join(dir, "call.webm"))
+	var results []job
+	if err := json.Unmarshal([]byte(out), &results); err != nil || code != 0 {
+		t.Fatalf("transcribe = %d %s %s", code, out, stderr)
+	}
+	if len(results) != 1 || results[0].Status != jobCompleted || results[0].Path != "call.webm" {
+		t.Fatalf("results = %+v", results)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "call.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out, _ = runTestCLI(t, true, "transcribe", "missing.webm")
+	if code != exitFailed || !strings.Contains(out, `"status": "failed"`) {
+		t.Fatalf("missing recording = %d %s", code, out)
+	}
+	if code, _, _ := runTestCLI(t, false, "transcribe", "-engine", "nope", "call.webm"); code != exitConfig {
+		t.Fatalf("unknown engine exited %d", code)
+	}
+}
+
+func TestCLITranscribePartialFailure(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	useConfig(t, func(c *config) { c.ExtractKeywords = false })
+	writeTestFiles(t, dir, "good.webm", "bad.webm")
+	fakeWhisper(t, "60", func(_ context.Context, args []string) ([]byte, error) {
+		if strings.HasSuffix(args[0], "bad.webm") {
+			return []byte("decode error"), errors.New("exit status 1")
+		}
+		out := argAfter(args, "--output_dir")
+		return nil, os.WriteFile(filepath.Join(out, "good.json"), []byte(`{"text":" Hi. ","segments":[]}`), 0o644)
+	})
+
+	code, out, stderr := runTestCLI(t, false, "transcribe", "-verbose", "good.webm", "bad.webm", "missing.webm")
+	if code != exitPartial {
+		t.Fatalf("exit = %d, want %d", code, exitPartial)
+	}
+	if !strings.Contains(out, "good.webm: good.json, good.txt") || !strings.Contains(out, "bad.webm: failed:") ||
+		!strings.Contains(out, "missing.webm: failed:") {
+		t.Fatalf("out = %q", out)
+	}
+	if !strings.Contains(stderr, "transcribe good.webm: completed") {
+		t.Fatalf("-verbose progress = %q", stderr)
+	}
+}
+
+func TestCLIQuiet(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm")
+
+	if code, out, _ := runTestCLI(t, false, "stats", "-quiet"); code != exitOK || out != "" {
+		t.Fatalf("stats -quiet = %d %q", code, out)
+	}
+	// JSON was asked for explicitly, so -quiet keeps it.
+	if _, out, _ := runTestCLI(t, true, "stats", "-quiet"); !json.Valid([]byte(out)) {
+		t.Fatalf("stats -json -quiet = %q", out)
+	}
+	mu.Lock()
+	writeFileAtomic(filepath.Join(dir, "b.txt"), strings.NewReader("b"))
+	mu.Unlock()
+	os.Remove(filepath.Join(dir, "b.txt"))
+	// Problems still reach stderr.
+	if code, out, stderr := runTestCLI(t, false, "verify", "-quiet"); code != exitPartial || out != "" || !strings.Contains(stderr, "missing    b.txt") {
+		t.Fatalf("verify -quiet = %d %q %q", code, out, stderr)
+	}
+	if code, _, _ := runTestCLI(t, false, "stats", "-quiet", "-verbose"); code != exitConfig {
+		t.Fatalf("-quiet -verbose exited %d", code)
+	}
+}
+
+func TestCLIUnknownCommand(t *testing.T) {
+	if code, _, stderr := runTestCLI(t, false, "frobnicate"); code != exitConfig || !strings.Contains(stderr, "doctor") {
+		t.Fatalf("unknown command = %d %q", code, stderr)
+	}
+}
+
+func TestMainFlags(t *testing.T) {
+	var stderr bytes.Buffer
+	if _, code := parseMainFlags([]string{"-bogus", "stats"}, &stderr); code != exitConfig || !strings.Contains(stderr.String(), "-bogus") {
+		t.Fatalf("-bogus stats = %d %q", code, stderr.String())
+	}
+	m, code := parseMainFlags([]string{"-json", "-dir", "/data", "stats", "-quiet"}, &stderr)
+	if code != exitOK || !m.json || m.dir != "/data" || strings.Join(m.fs.Args(), " ") != "stats -quiet" {
+		t.Fatalf("flags = %d %+v", code, m)
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cold storage shrinks old sessions without taking them out of the
+// library. The audio of sessions recorded more than VIEWER_COLD_AFTER ago
+// is re-encoded at a low bitrate ("compress") or moved to the S3 bucket
+// ("s3"), while their transcripts, manifests and search index entries stay
+// where they are. Each file moved is listed in the session's manifest as
+// "cold", so rehydrating the session can bring the original back.
+
+// coldStoragePolicy decides which sessions go to cold storage and how. A
+// zero After disables the schedule; sessions can still be moved by hand.
+type coldStoragePolicy struct {
+	After   time.Duration
+	Mode    string // "compress" or "s3"
+	Bitrate string // of compressed copies, e.g. "24k"
+	// Dir keeps the originals of compressed files, say on a slower disk,
+	// so they can be rehydrated. Without it they are discarded.
+	Dir string
+}
+
+// coldFile is one audio file in cold storage, as recorded in its
+// session's manifest. Size and SHA256 are those of the original.
+type coldFile struct {
+	Path    string    `json:"path"`
+	Mode    string    `json:"mode"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	MovedAt time.Time `json:"movedAt"`
+	// Compressed is the re-encoded copy left in the library, and Kept
+	// whether the original is under the cold storage dir.
+	Compressed string `json:"compressed,omitempty"`
+	Bitrate    string `json:"bitrate,omitempty"`
+	Kept       bool   `json:"kept,omitempty"`
+	// Bucket and Key locate an original moved to S3.
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// errColdOriginalLost is returned when rehydrating a file compressed
+// without keeping its original.
+var errColdOriginalLost = errors.New("original audio was not kept when it was compressed")
+
+// coldCandidate is a session the policy would move to cold storage.
+type coldCandidate struct {
+	ID         string    `json:"id"`
+	Files      []string  `json:"files"`
+	Bytes      int64     `json:"bytes"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// currentColdPolicy returns the configured policy with its defaults.
+func currentColdPolicy() coldStoragePolicy {
+	p := cfg().Cold
+	if p.Mode != "s3" {
+		p.Mode = "compress"
+	}
+	if p.Bitrate == "" {
+		p.Bitrate = "24k"
+	}
+	return p
+}
+
+// warmAudio lists the audio files of s that are not in cold storage yet:
+// its recording, parts and tracks, but not derived audio such as enhanced
+// copies.
+func warmAudio(s session) []string {
+	var out []string
+	for _, f := range s.Files {
+		name := path.Base(f)
+		if !isAudioFile(name) || artifactInfix.MatchString(strings.TrimSuffix(name, path.Ext(name))) {
+			continue
+		}
+		if slices.ContainsFunc(s.Cold, func(c coldFile) bool { return c.Path == f || c.Compressed == f }) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// planColdStorage selects the sessions recorded before now minus p.After
+// that still have audio outside cold storage, oldest first.
+func planColdStorage(p coldStoragePolicy, now time.Time) ([]coldCandidate, error) {
+	sessions, err := scanSessions()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].RecordedAt.Before(sessions[j].RecordedAt) })
+	out := []coldCandidate{}
+	for _, s := range sessions {
+		if now.Sub(s.RecordedAt) <= p.After {
+			continue
+		}
+		files := warmAudio(s)
+		if len(files) == 0 {
+			continue
+		}
+		c := coldCandidate{ID: s.ID, Files: files, RecordedAt: s.RecordedAt}
+		for _, f := range files {
+			if info, err := os.Stat(absPath(f)); err == nil {
+				c.Bytes += info.Size()
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// moveSessionToCold moves the audio of s that is not in cold storage yet
+// and records it in the session's manifest. It returns the files moved
+// and the bytes freed in the library.
+func moveSessionToCold(ctx context.Context, p coldStoragePolicy, s *session) ([]coldFile, int64, error) {
+	if p.Mode == "s3" && !cfg().S3.enabled() {
+		return nil, 0, errors.New("cold storage in s3 needs VIEWER_S3_ENDPOINT and VIEWER_S3_BUCKET")
+	}
+	var moved []coldFile
+	var freed int64
+	for _, rel := range warmAudio(*s) {
+		c, n, err := moveToCold(ctx, p, rel)
+		if err != nil {
+			return moved, freed, fmt.Errorf("%s: %w", rel, err)
+		}
+		if c == nil {
+			continue
+		}
+		mu.Lock()
+		err = recordColdFiles(s, func(files []coldFile) []coldFile { return append(files, *c) })
+		mu.Unlock()
+		if err != nil {
+			return moved, freed, err
+		}
+		moved = append(moved, *c)
+		freed += n
+	}
+	if len(moved) > 0 {
+		publishEvent("cold.moved", s.ID, map[string]any{"mode": p.Mode, "files": len(moved), "bytes": freed})
+	}
+	return moved, freed, nil
+}
+
+// moveToCold moves one audio file to cold storage and returns its record
+// and the bytes freed, or nil when a compressed copy would be no smaller.
+func moveToCold(ctx context.Context, p coldStoragePolicy, rel string) (*coldFile, int64, error) {
+	full := absPath(rel)
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, 0, err
+	}
+	mu.Lock()
+	sum, err := currentSHA256(full)
+	mu.Unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	c := &coldFile{Path: rel, Mode: p.Mode, Size: info.Size(), SHA256: sum, MovedAt: time.Now().UTC()}
+	if p.Mode == "s3" {
+		if err := uploadToCold(ctx, c, full); err != nil {
+			return nil, 0, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := os.Remove(full); err != nil {
+			return nil, 0, err
+		}
+		forgetFiles(full)
+		return c, info.Size(), nil
+	}
+	return compressToCold(ctx, p, c, full)
+}
+
+// uploadToCold copies full to the bucket and checks the object's size.
+func uploadToCold(ctx context.Context, c *coldFile, full string) error {
+	s3 := cfg().S3
+	c.Bucket, c.Key = s3.Bucket, s3.objectKey(c.Path)
+	signed, err := s3.presign(http.MethodPut, c.Key, 15*time.Minute)
+	if err != nil {
+		return err
+	}
+	if err := putFile(ctx, signed, full, nil); err != nil {
+		return err
+	}
+	size, _, err := s3.headObject(ctx, c.Key)
+	if err != nil {
+		return err
+	}
+	if size != c.Size {
+		return fmt.Errorf("object %s has %d bytes, want %d", c.Key, size, c.Size)
+	}
+	return nil
+}
+
+// compressToCold re-encodes full as Opus at p.Bitrate into a WebM file of
+// the same name, keeping the original under p.Dir when it is set.
+func compressToCold(ctx context.Context, p coldStoragePolicy, c *coldFile, full string) (*coldFile, int64, error) {
+	c.Bitrate = p.Bitrate
+	c.Compressed = strings.TrimSuffix(c.Path, path.Ext(c.Path)) + ".webm"
+	dst := absPath(c.Compressed)
+	if dst != full {
+		if _, err := os.Stat(dst); err == nil {
+			return nil, 0, fmt.Errorf("%s already exists", c.Compressed)
+		}
+	}
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return nil, 0, err
+	}
+	tmp := filepath.Join(stateDir(), "cold-"+randomID()+".webm")
+	defer os.Remove(tmp)
+	output, err := runCommandFunc(ctx, cfg().FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", full,
+		"-vn", "-c:a", "libopus", "-b:a", p.Bitrate,
+		"-f", "webm", tmp,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ffmpeg: %v: %s", err, outputTail(output))
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() >= c.Size {
+		return nil, 0, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if p.Dir != "" {
+		kept := filepath.Join(p.Dir, filepath.FromSlash(c.Path))
+		if err := os.MkdirAll(filepath.Dir(kept), 0o755); err != nil {
+			return nil, 0, err
+		}
+		if err := moveFile(full, kept); err != nil {
+			return nil, 0, err
+		}
+		c.Kept = true
+	} else if err := os.Remove(full); err != nil {
+		return nil, 0, err
+	}
+	forgetFiles(full)
+	if err := moveFile(tmp, dst); err != nil {
+		return nil, 0, err
+	}
+	trackFiles(dst)
+	return c, c.Size - info.Size(), nil
+}
+
+// recordColdFiles rewrites the cold storage entries of the manifest of s.
+// Callers hold mu.
+func recordColdFiles(s *session, update func([]coldFile) []coldFile) error {
+	fullPath := s.metaPath()
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		return err
+	}
+	meta.Cold = update(meta.Cold)
+	if len(meta.Cold) == 0 {
+		meta.Cold = nil
+	}
+	if err := saveMeta(fullPath, meta); err != nil {
+		return err
+	}
+	s.Cold = meta.Cold
+	return nil
+}
+
+// rehydrateSession brings the original audio of every file of s in cold
+// storage back into the library. A file compressed without keeping its
+// original stays compressed and fails with errColdOriginalLost once the
+// others are back.
+func rehydrateSession(ctx context.Context, s *session) ([]string, error) {
+	var restored []string
+	var lost error
+	for _, c := range slices.Clone(s.Cold) {
+		err := rehydrateFile(ctx, c)
+		if errors.Is(err, errColdOriginalLost) {
+			lost = fmt.Errorf("%s: %w", c.Path, err)
+			continue
+		}
+		if err != nil {
+			return restored, fmt.Errorf("%s: %w", c.Path, err)
+		}
+		mu.Lock()
+		err = recordColdFiles(s, func(files []coldFile) []coldFile {
+			return slices.DeleteFunc(files, func(f coldFile) bool { return f.Path == c.Path })
+		})
+		mu.Unlock()
+		if err != nil {
+			return restored, err
+		}
+		restored = append(restored, c.Path)
+	}
+	if len(restored) > 0 {
+		publishEvent("cold.rehydrated", s.ID, map[string]any{"files": restored})
+	}
+	return restored, lost
+}
+
+// rehydrateFile puts the original of c back at its path.
+func rehydrateFile(ctx context.Context, c coldFile) error {
+	full := absPath(c.Path)
+	switch c.Mode {
+	case "s3":
+		if err := downloadFromCold(ctx, c, full); err != nil {
+			return err
+		}
+	default:
+		if !c.Kept {
+			return errColdOriginalLost
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		kept := filepath.Join(currentColdPolicy().Dir, filepath.FromSlash(c.Path))
+		compressed := absPath(c.Compressed)
+		if err := moveFile(kept, full); err != nil {
+			return err
+		}
+		if compressed != full {
+			os.Remove(compressed)
+			forgetFiles(compressed)
+		}
+		trackFiles(full)
+	}
+	return nil
+}
+
+// downloadFromCold fetches the object of c into full and checks that it
+// is the original.
+func downloadFromCold(ctx context.Context, c coldFile, full string) error {
+	signed, err := cfg().S3.presign(http.MethodGet, c.Key, 15*time.Minute)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, signed, nil)
+	if err != nil {
+		return err
+	}
+	res, err := backupClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("object %s: %s", c.Key, res.Status)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := writeFileAtomic(full, res.Body); err != nil {
+		return err
+	}
+	if sum, err := currentSHA256(full); err != nil || sum != c.SHA256 {
+		os.Remove(full)
+		forgetFiles(full)
+		if err == nil {
+			err = fmt.Errorf("object %s does not match the original", c.Key)
+		}
+		return err
+	}
+	return nil
+}
+
+// coldRedirect returns a short-lived URL of the original of rel when it was
+// moved to S3, so /recordings/ can still play it.
+func coldRedirect(rel string) (string, bool) {
+	if !isAudioFile(rel) {
+		return "", false
+	}
+	if _, err := os.Stat(absPath(rel)); !errors.Is(err, os.ErrNotExist) {
+		return "", false
+	}
+	sessions, err := scanSessions()
+	if err != nil {
+		return "", false
+	}
+	for _, s := range sessions {
+		for _, c := range s.Cold {
+			if c.Path == rel && c.Mode == "s3" {
+				signed, err := cfg().S3.presign(http.MethodGet, c.Key, time.Hour)
+				return signed, err == nil
+			}
+		}
+	}
+	return "", false
+}
+
+// runColdStorage moves the sessions the policy selects to cold storage.
+func runColdStorage(now time.Time) {
+	p := currentColdPolicy()
+	if p.After <= 0 {
+		return
+	}
+	candidates, err := planColdStorage(p, now)
+	if err != nil {
+		slog.Error("cold storage", "err", err)
+		return
+	}
+	var sessions, files int
+	var freed int64
+	for _, c := range candidates {
+		s, err := findSession(c.ID)
+		if err != nil {
+			continue
+		}
+		moved, n, err := moveSessionToCold(context.Background(), p, s)
+		if err != nil {
+			slog.Error("cold storage", "session", c.ID, "err", err)
+		}
+		if len(moved) > 0 {
+			sessions++
+			files += len(moved)
+			freed += n
+		}
+	}
+	if sessions > 0 {
+		slog.Info("moved sessions to cold storage", "mode", p.Mode, "sessions", sessions, "files", files, "bytes", freed)
+	}
+}
+
+// coldPreviewHandler serves GET /api/cold/preview, the sessions the cold
+// storage schedule would move next.
+func coldPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := currentColdPolicy()
+	candidates := []coldCandidate{}
+	if p.After > 0 {
+		var err error
+		if candidates, err = planColdStorage(p, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	var bytes int64
+	for _, c := range candidates {
+		bytes += c.Bytes
+	}
+	writeJSON(w, map[string]any{"mode": p.Mode, "after": p.After.String(), "candidates": candidates, "bytes": bytes})
+}
+
+// sessionColdHandler serves /api/sessions/{id}/cold: GET lists the files
+// of the session in cold storage, POST moves its audio there now whatever
+// its age, and DELETE rehydrates it.
+func sessionColdHandler(w http.ResponseWriter, r *http.Request, s *session) {
+	switch r.Method {
+	case http.MethodGet:
+		files := s.Cold
+		if files == nil {
+			files = []coldFile{}
+		}
+		writeJSON(w, map[string]any{"files": files})
+	case http.MethodPost:
+		p := currentColdPolicy()
+		moved, freed, err := moveSessionToCold(r.Context(), p, s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if moved == nil {
+			moved = []coldFile{}
+		}
+		requestLogger(r).Info("moved session to cold storage", "session", s.ID, "mode", p.Mode, "files", len(moved))
+		writeJSON(w, map[string]any{"moved": moved, "bytes": freed})
+	case http.MethodDelete:
+		if len(s.Cold) == 0 {
+			http.Error(w, "session is not in cold storage", http.StatusConflict)
+			return
+		}
+		restored, err := rehydrateSession(r.Context(), s)
+		if errors.Is(err, errColdOriginalLost) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		requestLogger(r).Info("rehydrated session", "session", s.ID, "files", len(restored))
+		writeJSON(w, map[string]any{"restored": restored})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func coldRequest(t *testing.T, method, id string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(method, "/api/sessions/"+id+"/cold", nil))
+	var res map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	return rec.Code, res
+}
+
+// useFakeOpus makes ffmpeg write a two-byte file as its output.
+func useFakeOpus(t *testing.T) {
+	t.Helper()
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		return nil, os.WriteFile(args[len(args)-1], []byte("op"), 0o644)
+	})
+}
+
+func TestColdStorageCompress(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "old/a.wav", "old/a.txt")
+	kept := t.TempDir()
+	useConfig(t, func(c *config) { c.Cold = coldStoragePolicy{After: 24 * time.Hour, Dir: kept} })
+	useFakeOpus(t)
+
+	if candidates, _ := planColdStorage(currentColdPolicy(), time.Now()); len(candidates) != 0 {
+		t.Fatalf("recent session planned: %+v", candidates)
+	}
+	runColdStorage(time.Now().Add(48 * time.Hour))
+
+	if _, err := os.Stat(filepath.Join(dir, "old/a.wav")); !os.IsNotExist(err) {
+		t.Fatalf("original still in the library: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "old/a.webm")); string(data) != "op" {
+		t.Fatalf("compressed = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(kept, "old/a.wav")); string(data) != "old/a.wav" {
+		t.Fatalf("kept original = %q", data)
+	}
+	s, err := findSession("old/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Transcript != "old/a.txt" || len(s.Cold) != 1 || s.Cold[0].Compressed != "old/a.webm" || s.Cold[0].SHA256 != sumOf("old/a.wav") || !s.Cold[0].Kept {
+		t.Fatalf("session = %+v", s)
+	}
+	// Compressed audio is not compressed again.
+	if candidates, _ := planColdStorage(currentColdPolicy(), time.Now().Add(48*time.Hour)); len(candidates) != 0 {
+		t.Fatalf("cold session planned: %+v", candidates)
+	}
+
+	code, res := coldRequest(t, http.MethodDelete, "old/a")
+	if code != http.StatusOK || len(res["restored"].([]any)) != 1 {
+		t.Fatalf("rehydrate = %d %v", code, res)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "old/a.wav")); string(data) != "old/a.wav" {
+		t.Fatalf("rehydrated = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old/a.webm")); !os.IsNotExist(err) {
+		t.Fatalf("compressed copy left behind: %v", err)
+	}
+	if meta, _ := loadMeta(filepath.Join(dir, "old/a.txt")); meta.Cold != nil {
+		t.Fatalf("meta = %+v", meta)
+	}
+	if code, _ := coldRequest(t, http.MethodDelete, "old/a"); code != http.StatusConflict {
+		t.Fatalf("rehydrate again = %d", code)
+	}
+}
+
+func TestColdStorageCompressWithoutOriginal(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm")
+	useFakeOpus(t)
+
+	code, res := coldRequest(t, http.MethodPost, "a")
+	if code != http.StatusOK || len(res["moved"].([]any)) != 1 {
+		t.Fatalf("move = %d %v", code, res)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.webm")); string(data) != "op" {
+		t.Fatalf("compressed = %q", data)
+	}
+	if code, _ := coldRequest(t, http.MethodDelete, "a"); code != http.StatusConflict {
+		t.Fatalf("rehydrate = %d", code)
+	}
+	if meta, _ := loadMeta(filepath.Join(dir, "a.webm")); len(meta.Cold) != 1 || meta.Cold[0].Kept {
+		t.Fatalf("meta = %+v", meta)
+	}
+}
+
+func TestColdStorageS3(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "a.txt")
+	store, srv := newFakeStore(t, false)
+	useConfig(t, func(c *config) {
+		c.S3 = s3Config{Endpoint: srv.URL, Bucket: "rec", Region: "us-east-1", Prefix: "viewer"}
+		c.Cold = coldStoragePolicy{Mode: "s3"}
+	})
+
+	code, res := coldRequest(t, http.MethodPost, "a")
+	if code != http.StatusOK || res["bytes"] != float64(len("a.webm")) {
+		t.Fatalf("move = %d %v", code, res)
+	}
+	if keys := store.keys(); len(keys) != 1 || keys[0] != "/rec/viewer/a.webm" {
+		t.Fatalf("keys = %v", keys)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.webm")); !os.IsNotExist(err) {
+		t.Fatalf("audio still in the library: %v", err)
+	}
+
+	// The transcript is still served from the library, the audio from the
+	// bucket.
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/recordings/a.webm", nil))
+	if rec.Code != http.StatusTemporaryRedirect || !strings.HasPrefix(rec.Header().Get("Location"), srv.URL+"/rec/viewer/a.webm?") {
+		t.Fatalf("play = %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/recordings/a.txt", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("transcript = %d", rec.Code)
+	}
+
+	if code, res := coldRequest(t, http.MethodDelete, "a"); code != http.StatusOK {
+		t.Fatalf("rehydrate = %d %v", code, res)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.webm")); string(data) != "a.webm" {
+		t.Fatalf("rehydrated = %q", data)
+	}
+
+	// A changed object is not taken for the original.
+	coldRequest(t, http.MethodPost, "a")
+	store.objects["/rec/viewer/a.webm"] = []byte("tampered")
+	if code, _ := coldRequest(t, http.MethodDelete, "a"); code != http.StatusBadGateway {
+		t.Fatalf("rehydrate tampered = %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.webm")); !os.IsNotExist(err) {
+		t.Fatalf("tampered audio kept: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// collator compares names for listings. The natural collation orders runs
+// of digits by value ("recording_2" before "recording_10"), ignores case and
+// accents at first, and only falls back to them, then to byte order, to
+// break ties. Locales that treat some accented letters as letters of their
+// own sort those where their alphabet does.
+type collator struct {
+	binary   bool
+	tailored map[rune]int
+}
+
+// localeLetters lists, per language, letters that are not accented variants
+// but separate letters, with the primary weight they sort at. Weights are
+// rune values scaled by 4 so tailored letters fit between or after them.
+var localeLetters = map[string]map[rune]int{
+	"sv": {'å': 'z'*4 + 1, 'ä': 'z'*4 + 2, 'ö': 'z'*4 + 3},
+	"fi": {'å': 'z'*4 + 1, 'ä': 'z'*4 + 2, 'ö': 'z'*4 + 3},
+	"da": {'æ': 'z'*4 + 1, 'ø': 'z'*4 + 2, 'å': 'z'*4 + 3},
+	"nb": {'æ': 'z'*4 + 1, 'ø': 'z'*4 + 2, 'å': 'z'*4 + 3},
+	"no": {'æ': 'z'*4 + 1, 'ø': 'z'*4 + 2, 'å': 'z'*4 + 3},
+	"es": {'ñ': 'n'*4 + 2},
+	"tr": {'ç': 'c'*4 + 2, 'ğ': 'g'*4 + 2, 'ı': 'h'*4 + 2, 'ö': 'o'*4 + 2, 'ş': 's'*4 + 2, 'ü': 'u'*4 + 2},
+}
+
+// accentFold maps accented Latin letters to their base letter.
+var accentFold = map[rune]string{}
+
+func init() {
+	for base, variants := range map[string]string{
+		"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđ", "e": "èéêëēĕėęě", "g": "ĝğġģ",
+		"h": "ĥħ", "i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ", "l": "ĺļľŀł", "n": "ñńņňŉ",
+		"o": "òóôõöøōŏő", "r": "ŕŗř", "s": "śŝşš", "t": "ţťŧ", "u": "ùúûüũūŭůűų",
+		"w": "ŵ", "y": "ýÿŷ", "z": "źżž", "ae": "æ", "oe": "œ", "ss": "ß", "th": "þ",
+	} {
+		for _, r := range variants {
+			accentFold[r] = base
+		}
+	}
+}
+
+// newCollator returns the collator for a listing request's collation and
+// locale parameters.
+func newCollator(collation, locale string) (collator, error) {
+	switch collation {
+	case "", "natural":
+	case "binary":
+		return collator{binary: true}, nil
+	default:
+		return collator{}, fmt.Errorf("unknown collation %q", collation)
+	}
+	return collator{tailored: localeLetters[languageCode(locale)]}, nil
+}
+
+// collationElem is one unit of comparison: a whole number, or a letter's
+// primary weight.
+type collationElem struct {
+	number  bool
+	digits  string // number without leading zeros
+	primary int
+}
+
+// elems expands s into collation elements, folding case and accents.
+func (c collator) elems(s string) []collationElem {
+	var out []collationElem
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r >= '0' && r <= '9' {
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			digits := strings.TrimLeft(s[i:j], "0")
+			out = append(out, collationElem{number: true, digits: digits})
+			i = j
+			continue
+		}
+		i += size
+		lower := unicode.ToLower(r)
+		if w, ok := c.tailored[lower]; ok {
+			out = append(out, collationElem{primary: w})
+			continue
+		}
+		if base, ok := accentFold[lower]; ok {
+			for _, b := range base {
+				out = append(out, collationElem{primary: int(b) * 4})
+			}
+			continue
+		}
+		out = append(out, collationElem{primary: int(lower) * 4})
+	}
+	return out
+}
+
+func compareElems(a, b []collationElem) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := a[i], b[i]
+		switch {
+		case x.number && y.number:
+			if len(x.digits) != len(y.digits) {
+				return len(x.digits) - len(y.digits)
+			}
+			if cmp := strings.Compare(x.digits, y.digits); cmp != 0 {
+				return cmp
+			}
+		case x.number != y.number:
+			// Numbers sort before letters, like their code points do.
+			if x.number {
+				return -1
+			}
+			return 1
+		case x.primary != y.primary:
+			return x.primary - y.primary
+		}
+	}
+	return len(a) - len(b)
+}
+
+// compare orders a and b, returning a negative number, zero or a positive
+// number.
+func (c collator) compare(a, b string) int {
+	if c.binary {
+		return strings.Compare(a, b)
+	}
+	if cmp := compareElems(c.elems(a), c.elems(b)); cmp != 0 {
+		return cmp
+	}
+	// Equal ignoring case, accents and leading zeros: unaccented sorts
+	// first (ASCII bytes are lower than UTF-8 sequences), then lowercase.
+	if cmp := strings.Compare(strings.ToLower(a), strings.ToLower(b)); cmp != 0 {
+		return cmp
+	}
+	return -strings.Compare(a, b)
+}
+
+func (c collator) less(a, b string) bool {
+	return c.compare(a, b) < 0
+}
+
+var naturalCollator = collator{}
+
+// naturalLess is the default ordering of names in listings.
+func naturalLess(a, b string) bool {
+	return naturalCollator.less(a, b)
+}
+
+// listingOrder is how a listing request asked to be sorted:
+// ?sort=name|created|updated|recorded&order=asc|desc&collation=natural|binary&locale=sv.
+type listingOrder struct {
+	by   string
+	desc bool
+	coll collator
+}
+
+func parseListingOrder(q url.Values) (listingOrder, error) {
+	o := listingOrder{by: q.Get("sort")}
+	switch o.by {
+	case "":
+		o.by = "name"
+	case "name", "created", "updated", "recorded":
+	default:
+		return o, fmt.Errorf("unknown sort %q", o.by)
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		o.desc = true
+	default:
+		return o, fmt.Errorf("unknown order %q", q.Get("order"))
+	}
+	var err error
+	o.coll, err = newCollator(q.Get("collation"), q.Get("locale"))
+	return o, err
+}
+
+// sortSessions orders sessions for a listing; ties on time fall back to the
+// name.
+func (o listingOrder) sortSessions(sessions []session) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		if o.desc {
+			a, b = b, a
+		}
+		switch {
+		case o.by == "created" && !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.Before(b.CreatedAt)
+		case o.by == "updated" && !a.UpdatedAt.Equal(b.UpdatedAt):
+			return a.UpdatedAt.Before(b.UpdatedAt)
+		case o.by == "recorded" && !a.RecordedAt.Equal(b.RecordedAt):
+			return a.RecordedAt.Before(b.RecordedAt)
+		}
+		return o.coll.less(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sortedWith(t *testing.T, c collator, names ...string) string {
+	t.Helper()
+	sort.Slice(names, func(i, j int) bool { return c.less(names[i], names[j]) })
+	return strings.Join(names, " ")
+}
+
+func TestNaturalCollation(t *testing.T) {
+	got := sortedWith(t, naturalCollator, "recording_10.webm", "Recording_2.webm", "recording_1.webm", "recording_02.webm", "écho.txt", "echo.txt", "Zebra.txt", "apple.txt")
+	want := "apple.txt echo.txt écho.txt recording_1.webm recording_02.webm Recording_2.webm recording_10.webm Zebra.txt"
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	binary, _ := newCollator("binary", "")
+	if got := sortedWith(t, binary, "b10", "b2", "B1"); got != "B1 b10 b2" {
+		t.Fatalf("binary=%s", got)
+	}
+}
+
+func TestLocaleCollation(t *testing.T) {
+	sv, _ := newCollator("", "sv-SE")
+	if got := sortedWith(t, sv, "öl", "zon", "apa", "år"); got != "apa zon år öl" {
+		t.Fatalf("sv=%s", got)
+	}
+	root, _ := newCollator("", "")
+	if got := sortedWith(t, root, "öl", "zon", "apa", "år"); got != "apa år öl zon" {
+		t.Fatalf("root=%s", got)
+	}
+	es, _ := newCollator("natural", "es")
+	if got := sortedWith(t, es, "nube", "ñu", "oso"); got != "nube ñu oso" {
+		t.Fatalf("es=%s", got)
+	}
+	if _, err := newCollator("icu", ""); err == nil {
+		t.Fatalf("unknown collation should fail")
+	}
+}
+
+func TestSessionsListingOrder(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call_10.webm", "call_9.webm", "call_1.webm")
+
+	rec := httptest.NewRecorder()
+	sessionsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?order=desc", nil))
+	var sessions []session
+	json.NewDecoder(rec.Body).Decode(&sessions)
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	if strings.Join(ids, " ") != "call_10 call_9 call_1" {
+		t.Fatalf("ids=%v", ids)
+	}
+
+	rec = httptest.NewRecorder()
+	sessionsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?sort=size", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	listTranscripts(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts", nil))
+	var items []transcript
+	json.NewDecoder(rec.Body).Decode(&items)
+	if len(items) != 3 || items[0].ID != "call_1.webm" || items[2].ID != "call_10.webm" {
+		t.Fatalf("items=%+v", items)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// confidenceWord is a word of a segment with whisper's probability for it,
+// present when the transcript was made with word timestamps.
+type confidenceWord struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float64 `json:"probability"`
+	Low         bool    `json:"low,omitempty"`
+}
+
+// segmentConfidence is how sure whisper was of one segment. Confidence is
+// the segment's average token probability, exp(avg_logprob), and
+// NoSpeech the probability that it held no speech at all; both are absent
+// when the engine did not report them.
+type segmentConfidence struct {
+	Index      int              `json:"index"`
+	Start      float64          `json:"start"`
+	End        float64          `json:"end"`
+	Text       string           `json:"text"`
+	Confidence *float64         `json:"confidence,omitempty"`
+	NoSpeech   *float64         `json:"noSpeech,omitempty"`
+	Low        bool             `json:"low"`
+	Edited     bool             `json:"edited,omitempty"`
+	Words      []confidenceWord `json:"words,omitempty"`
+}
+
+// transcriptConfidence is the heatmap data of a transcript.
+type transcriptConfidence struct {
+	Path      string              `json:"path"`
+	Threshold float64             `json:"threshold"`
+	Available bool                `json:"available"`
+	Average   *float64            `json:"average,omitempty"`
+	Low       int                 `json:"low"`
+	Segments  []segmentConfidence `json:"segments"`
+}
+
+// readConfidence scores the segments of the whisper JSON at jsonPath. A
+// segment is low when its confidence or one of its words' probabilities is
+// under threshold, unless it was edited since, which means someone already
+// checked it.
+func readConfidence(jsonPath string, threshold float64) (transcriptConfidence, error) {
+	res := transcriptConfidence{Threshold: threshold, Segments: []segmentConfidence{}}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return res, err
+	}
+	var doc struct {
+		Segments []struct {
+			Start        float64          `json:"start"`
+			End          float64          `json:"end"`
+			Text         string           `json:"text"`
+			AvgLogprob   *float64         `json:"avg_logprob"`
+			NoSpeechProb *float64         `json:"no_speech_prob"`
+			Edited       bool             `json:"edited"`
+			Words        []confidenceWord `json:"words"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return res, fmt.Errorf("%s: %w", jsonPath, err)
+	}
+	var sum, weight float64
+	for i, s := range doc.Segments {
+		sc := segmentConfidence{Index: i, Start: s.Start, End: s.End, Text: s.Text, NoSpeech: s.NoSpeechProb, Edited: s.Edited}
+		if s.AvgLogprob != nil {
+			c := roundConfidence(math.Exp(*s.AvgLogprob))
+			sc.Confidence = &c
+			sc.Low = c < threshold
+			// Long segments weigh more in the average than a stray "Hmm."
+			w := max(s.End-s.Start, 0.1)
+			sum, weight = sum+c*w, weight+w
+		}
+		for _, w := range s.Words {
+			w.Probability = roundConfidence(w.Probability)
+			w.Low = w.Probability < threshold
+			sc.Low = sc.Low || w.Low
+			sc.Words = append(sc.Words, w)
+		}
+		if sc.Confidence != nil || len(sc.Words) > 0 {
+			res.Available = true
+		}
+		if sc.Edited {
+			sc.Low = false
+		}
+		if sc.Low {
+			res.Low++
+		}
+		res.Segments = append(res.Segments, sc)
+	}
+	if weight > 0 {
+		avg := roundConfidence(sum / weight)
+		res.Average = &avg
+	}
+	return res, nil
+}
+
+func roundConfidence(p float64) float64 {
+	return math.Round(p*1000) / 1000
+}
+
+// confidenceHandler serves GET /api/transcripts/{path}/confidence with the
+// confidence of each segment and word of the recording's JSON transcript,
+// for highlighting the passages most likely to need correcting.
+// ?threshold= overrides cfg.LowConfidence.
+func confidenceHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	threshold := cfg().LowConfidence
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 1 {
+			http.Error(w, "threshold must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		threshold = t
+	}
+	jsonPath := transcriptJSONPath(absPath(rel))
+	res, err := readConfidence(jsonPath, threshold)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "no JSON transcript", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Path, _ = relPath(jsonPath)
+	writeJSON(w, res)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const confidenceFixture = `{"text":" Hello there. General Kenobi. Hmm.","segments":[` +
+	`{"id":0,"start":0,"end":2,"text":" Hello there.","avg_logprob":-0.1,"no_speech_prob":0.01,` +
+	`"words":[{"word":" Hello","start":0,"end":0.8,"probability":0.98},{"word":" there.","start":0.8,"end":2,"probability":0.91}]},` +
+	`{"id":1,"start":2,"end":4,"text":" General Kenobi.","avg_logprob":-0.2,` +
+	`"words":[{"word":" General","start":2,"end":3,"probability":0.95},{"word":" Kenobi.","start":3,"end":4,"probability":0.31}]},` +
+	`{"id":2,"start":4,"end":6,"text":" Hmm.","avg_logprob":-1.5}]}`
+
+func getConfidence(t *testing.T, target string) (int, transcriptConfidence) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var res transcriptConfidence
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, res
+}
+
+func TestConfidenceFlagsUnlikelyPassages(t *testing.T) {
+	dir := useTempBaseDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "call.json"), []byte(confidenceFixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, res := getConfidence(t, "/api/transcripts/call.webm/confidence")
+	if code != http.StatusOK || !res.Available || res.Path != "call.json" || res.Threshold != 0.5 {
+		t.Fatalf("status=%d res=%+v", code, res)
+	}
+	if len(res.Segments) != 3 || res.Low != 2 {
+		t.Fatalf("segments=%+v", res.Segments)
+	}
+	first, second, third := res.Segments[0], res.Segments[1], res.Segments[2]
+	if first.Low || *first.Confidence != 0.905 || *first.NoSpeech != 0.01 {
+		t.Fatalf("first=%+v", first)
+	}
+	// A confident segment with one doubtful word is flagged at that word.
+	if !second.Low || second.Words[0].Low || !second.Words[1].Low {
+		t.Fatalf("second=%+v", second)
+	}
+	if !third.Low || *third.Confidence != 0.223 || third.Words != nil {
+		t.Fatalf("third=%+v", third)
+	}
+	if *res.Average != 0.649 {
+		t.Fatalf("average=%v", *res.Average)
+	}
+
+	if _, res = getConfidence(t, "/api/transcripts/call.json/confidence?threshold=0.2"); res.Low != 0 {
+		t.Fatalf("low at 0.2: %d", res.Low)
+	}
+	if code, _ = getConfidence(t, "/api/transcripts/call.json/confidence?threshold=2"); code != http.StatusBadRequest {
+		t.Fatalf("bad threshold: %d", code)
+	}
+
+	// Correcting a segment settles it.
+	if rec := patchSegmentRequest(t, "/api/transcripts/call.webm/segments/1", `{"text":" General Grievous."}`); rec.Code != http.StatusOK {
+		t.Fatalf("patch: %d", rec.Code)
+	}
+	if _, res = getConfidence(t, "/api/transcripts/call.webm/confidence"); res.Low != 1 || !res.Segments[1].Edited || res.Segments[1].Low {
+		t.Fatalf("after edit: %+v", res)
+	}
+}
+
+func TestConfidenceWithoutProbabilities(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "notes.webm", "notes.txt")
+	if code, _ := getConfidence(t, "/api/transcripts/notes.webm/confidence"); code != http.StatusNotFound {
+		t.Fatalf("text-only transcript: %d", code)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "plain.json"), []byte(`{"text":" Hi.","segments":[{"start":0,"end":1,"text":" Hi."}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, res := getConfidence(t, "/api/transcripts/plain.json/confidence")
+	if code != http.StatusOK || res.Available || res.Low != 0 || res.Average != nil || res.Segments[0].Confidence != nil {
+		t.Fatalf("status=%d res=%+v", code, res)
+	}
+}
+
+func TestWhisperRunsWithWordTimestamps(t *testing.T) {
+	useHost(t, "linux", "amd64", nil)
+	_, args, _ := engineArgs("whisper", cfg().Engines["whisper"], "a.wav", "base", "out")
+	if argAfter(args, "--word_timestamps") != "True" {
+		t.Fatalf("args=%v", args)
+	}
+	useConfig(t, func(c *config) { c.WordTimestamps = false })
+	if _, args, _ = engineArgs("whisper", cfg().Engines["whisper"], "a.wav", "base", "out"); argAfter(args, "--word_timestamps") != "" {
+		t.Fatalf("args=%v", args)
+	}
+}
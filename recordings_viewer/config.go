@@ -0,0 +1,564 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// config collects runtime settings that are not part of the request API.
+type config struct {
+	// Listen is the address the server listens on.
+	Listen string
+
+	// GalleryListen, when set, is a second address that serves only the
+	// public gallery of published sessions. See gallery.go.
+	GalleryListen string
+
+	// AuthToken, when set, must accompany every write request as
+	// "Authorization: Bearer <token>".
+	AuthToken string
+	// AuthMaxFailures wrong tokens in a row lock a client out for
+	// AuthLockout; zero disables the lockout and the backoff before it.
+	AuthMaxFailures int
+	AuthLockout     time.Duration
+
+	// ShareSecret signs the links POST /api/share hands out; without one a
+	// random key is kept in the state directory. ShareMaxTTL caps how long
+	// a link lasts, and PublicURL is the address links point at when the
+	// server sits behind a proxy. See share.go.
+	ShareSecret string
+	ShareMaxTTL time.Duration
+	PublicURL   string
+
+	// SecretsBackend is where the secret settings left out of the
+	// environment and config file are looked up: "auto", "keychain" or
+	// "file"; see openSecretStore. SecretsFile overrides the encrypted
+	// file's path. See secrets.go.
+	SecretsBackend string
+	SecretsFile    string
+
+	S3 s3Config
+
+	// AllowedOrigins lists origins (e.g. chrome-extension://<id>) that may
+	// call the API cross-origin. "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedNetworks, when set, are the only addresses besides loopback
+	// the server answers; see withIPAllowlist.
+	AllowedNetworks []netip.Prefix
+
+	// JanitorInterval is how often stale uploads and temp files are swept;
+	// zero disables the janitor. JanitorTTL is how old they must be.
+	JanitorInterval time.Duration
+	JanitorTTL      time.Duration
+
+	// MaxRecordingDuration splits ingested audio longer than this into
+	// sequential parts; zero disables splitting.
+	MaxRecordingDuration time.Duration
+
+	FFmpegPath  string
+	FFprobePath string
+
+	// Engines configures each transcription engine by name; DefaultEngine
+	// and DefaultModel apply when a job does not choose. The whisper.cpp
+	// engine is only there when its server binary is set, and WhisperCpp
+	// configures the servers kept warm for it.
+	Engines       map[string]engineConfig
+	DefaultEngine string
+	DefaultModel  string
+	WhisperCpp    whisperCppConfig
+	JobWorkers    int
+	// Audio longer than ChunkOver is transcribed in pieces of ChunkLength
+	// that overlap by ChunkOverlap, ChunkWorkers at a time; see
+	// runEngineChunked. A zero ChunkOver turns this off.
+	ChunkOver    time.Duration
+	ChunkLength  time.Duration
+	ChunkOverlap time.Duration
+	ChunkWorkers int
+	// PreviewWorkers is how many waveforms and spectrograms are drawn at
+	// once, apart from the job workers.
+	PreviewWorkers int
+	// TranscribeBudget caps what engines with a CostPerMinute are expected
+	// to spend in a month; zero is no cap. Audio never louder than
+	// SilenceThreshold dBFS is not sent to them. PreflightWarnOnly queues
+	// transcriptions that fail these checks anyway, with warnings.
+	TranscribeBudget  float64
+	SilenceThreshold  float64
+	PreflightWarnOnly bool
+
+	// ModelDir is where whisper keeps its models and GET /api/models looks
+	// for them; empty means whisper's own cache directory.
+	ModelDir string
+	// WhisperDevice is the --device whisper runs on; "auto" picks one from
+	// the detected accelerators (see whisperDevice).
+	WhisperDevice string
+	// WordTimestamps has whisper time each word and report how sure it was
+	// of it, which GET /api/transcripts/{path}/confidence shows; segments
+	// or words less probable than LowConfidence are flagged there.
+	WordTimestamps bool
+	LowConfidence  float64
+	// EnhanceAudio runs transcriptions on audio cleaned up by
+	// enhanceFilters, with a highpass at EnhanceHighpass Hz (0 for none)
+	// and RNNoise using the RNNoiseModel file when one is set.
+	EnhanceAudio    bool
+	EnhanceHighpass int
+	RNNoiseModel    string
+
+	// StreamCommand is the streaming transcription backend launched per
+	// /ws/transcribe connection, e.g. ["python3", "../whisper_stream.py"].
+	StreamCommand []string
+
+	// UndoVersions is how many of the versions a PUT replaced are kept per
+	// transcript for POST /api/transcripts/{path}/undo; zero keeps none.
+	UndoVersions int
+
+	// EventLogMax is how many of the latest server events are kept in
+	// events.jsonl and replayed by GET /api/events.
+	EventLogMax int
+
+	// WriteAudioTags remuxes audio with title/date/comment tags after each
+	// successful transcription.
+	WriteAudioTags bool
+
+	// SplitChannels transcribes the two channels of stereo recordings
+	// separately by default, labelling them with ChannelSpeakers (left,
+	// right); see splitChannels.
+	SplitChannels   bool
+	ChannelSpeakers []string
+
+	// ImportDirs are the local directories POST /api/import may read from.
+	ImportDirs []string
+
+	// NamingTemplate names new recordings from uploads and imports, e.g.
+	// "{date}_{time}_{title}"; empty keeps the names clients send. See
+	// naming.go.
+	NamingTemplate string
+
+	// VaultDir is the folder, such as an Obsidian vault, that POST
+	// /api/export/vault writes Markdown notes to.
+	VaultDir string
+
+	// CensorWords extends the built-in list masked by censored exports.
+	CensorWords []string
+
+	// ReadOnly refuses every request that would change the library.
+	ReadOnly bool
+
+	// Workspaces are extra recordings roots by name (a NAS mount, an archive
+	// drive), browsed alongside baseDir, which is the PrimaryWorkspace.
+	PrimaryWorkspace string
+	Workspaces       map[string]string
+
+	// SalvageIdle is how long a capture must have stopped uploading chunks
+	// before POST /api/salvage treats it as interrupted.
+	SalvageIdle time.Duration
+
+	// RateLimit is how many write requests (PUT, POST, PATCH, DELETE) per
+	// second each client may make, with bursts of RateBurst; zero disables
+	// the limit. MaxBodyBytes caps a write request's body.
+	RateLimit    float64
+	RateBurst    int
+	MaxBodyBytes int64
+
+	// DisplayTimezone is the zone listings render recording times and days
+	// in; recordings keep their own offset regardless.
+	DisplayTimezone *time.Location
+
+	// BackupCommand copies one file to the backup target, with {src} and
+	// {path} placeholders; BackupVerifyCommand prints the SHA-256 of the
+	// copy on the target. See backup.go.
+	BackupCommand       []string
+	BackupVerifyCommand []string
+
+	// BackupTarget is an s3:// or webdav(s):// URL backups upload to when
+	// there is no BackupCommand; BackupUser and BackupPassword log in to
+	// WebDAV. See backup_targets.go.
+	BackupTarget   string
+	BackupUser     string
+	BackupPassword string
+
+	// SummaryCommand and WaveformCommand print a recording's summary and
+	// waveform, given {src}; RegenerateStale queues them, and .srt files,
+	// for rebuilding when their source changes. See derived.go.
+	SummaryCommand  []string
+	WaveformCommand []string
+	RegenerateStale bool
+
+	// ExtractKeywords queues keyword extraction whenever a transcript
+	// changes, with KeywordsCommand when set and TF-IDF otherwise. Topics
+	// maps each topic to the words that mark it. See keywords.go.
+	ExtractKeywords bool
+	KeywordsCommand []string
+	// DetectChapters queues chapter detection whenever a recording is
+	// transcribed. A chapter starts after a silence of at least
+	// ChapterSilence or at a topic shift, and lasts ChapterMinLength or
+	// more.
+	DetectChapters   bool
+	ChapterSilence   time.Duration
+	ChapterMinLength time.Duration
+	Topics           map[string][]string
+
+	// PublishTargets are the SSH hosts sessions can be pushed to by name;
+	// SFTPPath and RsyncPath are the client binaries.
+	PublishTargets map[string]publishTarget
+	SFTPPath       string
+	RsyncPath      string
+
+	// Webhooks are URLs that receive a POST for each WebhookEvents event
+	// (recording.uploaded, transcript.completed, alert.matched), signed
+	// with WebhookSecret when set. See webhooks.go.
+	Webhooks      []string
+	WebhookEvents []string
+	WebhookSecret string
+
+	// Hooks run commands or POST to URLs after the webhook events, each
+	// within HookTimeout. See hooks.go.
+	Hooks       []hook
+	HookTimeout time.Duration
+
+	// CalendarFeeds are the ICS feeds, as URLs or file paths, whose events
+	// recordings are matched with by time. See calendar.go.
+	CalendarFeeds []string
+
+	// SyncPeer is the URL of another server whose recordings the "sync"
+	// schedule keeps the same as these, sending SyncToken as the bearer
+	// token. SyncPrefer settles files changed on both sides: "keep" (report
+	// them), "local", "peer" or "newer".
+	SyncPeer   string
+	SyncToken  string
+	SyncPrefer string
+
+	// Retention removes or archives old sessions every RetentionInterval.
+	Retention         retentionPolicy
+	RetentionInterval time.Duration
+
+	// Cold moves the audio of old sessions to cold storage on the "cold"
+	// schedule.
+	Cold coldStoragePolicy
+}
+
+// s3Config describes an S3-compatible bucket used for direct uploads. The
+// backend is disabled unless Endpoint and Bucket are both set.
+type s3Config struct {
+	Endpoint     string // e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000
+	Bucket       string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Prefix       string // optional key prefix inside the bucket
+}
+
+func (c s3Config) enabled() bool {
+	return c.Endpoint != "" && c.Bucket != ""
+}
+
+// currentConfig is the running configuration. A published config is never
+// modified: reloadConfig publishes a new one with setConfig, so a request
+// or job that reads cfg once keeps a consistent view of it.
+var currentConfig = func() *atomic.Pointer[config] {
+	var p atomic.Pointer[config]
+	c := loadConfigFromEnv()
+	p.Store(&c)
+	return &p
+}()
+
+// cfg returns the running configuration.
+func cfg() *config {
+	return currentConfig.Load()
+}
+
+// setConfig publishes c as the running configuration.
+func setConfig(c config) {
+	currentConfig.Store(&c)
+}
+
+// loadConfigFromEnv reads the VIEWER_* settings from the environment and
+// the config file (see getenv).
+func loadConfigFromEnv() config {
+	c := config{
+		S3: s3Config{
+			Endpoint:     strings.TrimRight(getenv("VIEWER_S3_ENDPOINT"), "/"),
+			Bucket:       getenv("VIEWER_S3_BUCKET"),
+			Region:       getenv("VIEWER_S3_REGION"),
+			AccessKey:    getenv("VIEWER_S3_ACCESS_KEY"),
+			SecretKey:    getenv("VIEWER_S3_SECRET_KEY"),
+			SessionToken: getenv("VIEWER_S3_SESSION_TOKEN"),
+			Prefix:       strings.Trim(getenv("VIEWER_S3_PREFIX"), "/"),
+		},
+	}
+	if c.S3.Region == "" {
+		c.S3.Region = "us-east-1"
+	}
+	c.Listen = envString("VIEWER_LISTEN", ":8080")
+	c.GalleryListen = getenv("VIEWER_GALLERY_LISTEN")
+	c.AuthToken = getenv("VIEWER_AUTH_TOKEN")
+	c.AuthMaxFailures = envInt("VIEWER_AUTH_MAX_FAILURES", 5)
+	c.AuthLockout = envDuration("VIEWER_AUTH_LOCKOUT", 15*time.Minute)
+	c.ShareSecret = getenv("VIEWER_SHARE_SECRET")
+	c.SecretsBackend = envString("VIEWER_SECRETS_BACKEND", "auto")
+	c.SecretsFile = getenv("VIEWER_SECRETS_FILE")
+	c.ShareMaxTTL = envDuration("VIEWER_SHARE_MAX_TTL", 7*24*time.Hour)
+	c.PublicURL = strings.TrimRight(getenv("VIEWER_PUBLIC_URL"), "/")
+	c.AllowedOrigins = envList("VIEWER_ALLOWED_ORIGINS")
+	c.AllowedNetworks = envPrefixes("VIEWER_ALLOWED_NETWORKS")
+	c.JanitorInterval = envDuration("VIEWER_JANITOR_INTERVAL", time.Hour)
+	c.JanitorTTL = envDuration("VIEWER_JANITOR_TTL", 24*time.Hour)
+	c.MaxRecordingDuration = envDuration("VIEWER_MAX_RECORDING_DURATION", 0)
+	c.FFmpegPath = envString("VIEWER_FFMPEG", "ffmpeg")
+	c.FFprobePath = envString("VIEWER_FFPROBE", "ffprobe")
+	c.Engines = map[string]engineConfig{
+		"whisper": {
+			Binary:          envString("VIEWER_WHISPER", "whisper"),
+			RTF:             envFloat("VIEWER_WHISPER_RTF", 1.0),
+			TimeoutMultiple: envFloat("VIEWER_WATCHDOG_MULTIPLE", 3),
+			MinTimeout:      envDuration("VIEWER_WATCHDOG_MIN", 2*time.Minute),
+			Retries:         envInt("VIEWER_JOB_RETRIES", 0),
+			CostPerMinute:   envFloat("VIEWER_WHISPER_COST_PER_MINUTE", 0),
+			MaxDuration:     envDuration("VIEWER_WHISPER_MAX_DURATION", 0),
+		},
+	}
+	if bin := getenv("VIEWER_WHISPERCPP"); bin != "" {
+		c.Engines[engineWhisperCpp] = engineConfig{
+			Binary:          bin,
+			RTF:             envFloat("VIEWER_WHISPERCPP_RTF", 0.5),
+			TimeoutMultiple: envFloat("VIEWER_WATCHDOG_MULTIPLE", 3),
+			MinTimeout:      envDuration("VIEWER_WATCHDOG_MIN", 2*time.Minute),
+			Retries:         envInt("VIEWER_JOB_RETRIES", 0),
+		}
+	}
+	c.WhisperCpp = whisperCppConfig{
+		ModelDir: envString("VIEWER_WHISPERCPP_MODEL_DIR", "models"),
+		Pool:     max(envInt("VIEWER_WHISPERCPP_POOL", 1), 1),
+		Idle:     envDuration("VIEWER_WHISPERCPP_IDLE", 0),
+	}
+	c.DefaultEngine = envString("VIEWER_ENGINE", "whisper")
+	if _, ok := c.Engines[c.DefaultEngine]; !ok {
+		invalidSetting("VIEWER_ENGINE", c.DefaultEngine, errors.New("engine not configured"))
+		c.DefaultEngine = "whisper"
+	}
+	c.DefaultModel = envString("VIEWER_WHISPER_MODEL", "base")
+	c.JobWorkers = envInt("VIEWER_JOB_WORKERS", 1)
+	c.ChunkOver = envDuration("VIEWER_CHUNK_OVER", 0)
+	c.ChunkLength = envDuration("VIEWER_CHUNK_LENGTH", 10*time.Minute)
+	c.ChunkOverlap = envDuration("VIEWER_CHUNK_OVERLAP", 5*time.Second)
+	c.ChunkWorkers = max(envInt("VIEWER_CHUNK_WORKERS", 2), 1)
+	c.PreviewWorkers = max(envInt("VIEWER_PREVIEW_WORKERS", 2), 1)
+	c.TranscribeBudget = envFloat("VIEWER_TRANSCRIBE_BUDGET", 0)
+	c.SilenceThreshold = envFloat("VIEWER_SILENCE_THRESHOLD", -50)
+	c.PreflightWarnOnly = envBool("VIEWER_PREFLIGHT_WARN_ONLY", false)
+	c.ModelDir = getenv("VIEWER_WHISPER_MODEL_DIR")
+	c.WhisperDevice = envString("VIEWER_WHISPER_DEVICE", "auto")
+	c.WordTimestamps = envBool("VIEWER_WHISPER_WORD_TIMESTAMPS", true)
+	c.LowConfidence = envFloat("VIEWER_LOW_CONFIDENCE", 0.5)
+	c.EnhanceAudio = envBool("VIEWER_ENHANCE_AUDIO", false)
+	c.EnhanceHighpass = envInt("VIEWER_ENHANCE_HIGHPASS", 80)
+	c.RNNoiseModel = getenv("VIEWER_RNNOISE_MODEL")
+	c.StreamCommand = strings.Fields(getenv("VIEWER_STREAM_COMMAND"))
+	c.UndoVersions = envInt("VIEWER_UNDO_VERSIONS", 5)
+	c.EventLogMax = max(envInt("VIEWER_EVENT_LOG_MAX", 10000), 1)
+	c.WriteAudioTags = envBool("VIEWER_WRITE_AUDIO_TAGS", false)
+	c.SplitChannels = envBool("VIEWER_SPLIT_CHANNELS", false)
+	c.ChannelSpeakers = envList("VIEWER_CHANNEL_SPEAKERS")
+	if len(c.ChannelSpeakers) != 2 {
+		if len(c.ChannelSpeakers) > 0 {
+			invalidSetting("VIEWER_CHANNEL_SPEAKERS", getenv("VIEWER_CHANNEL_SPEAKERS"), errors.New("want two names, left and right"))
+		}
+		c.ChannelSpeakers = []string{"Me", "Others"}
+	}
+	c.ImportDirs = envList("VIEWER_IMPORT_DIRS")
+	c.NamingTemplate = envNamingTemplate("VIEWER_NAMING_TEMPLATE")
+	c.CensorWords = envList("VIEWER_CENSOR_WORDS")
+	c.VaultDir = getenv("VIEWER_VAULT_DIR")
+	c.Retention = retentionPolicy{
+		MaxAge:     envDuration("VIEWER_RETENTION_MAX_AGE", 0),
+		MaxBytes:   int64(envInt("VIEWER_RETENTION_MAX_BYTES", 0)),
+		Action:     envString("VIEWER_RETENTION_ACTION", "archive"),
+		ArchiveDir: getenv("VIEWER_RETENTION_ARCHIVE_DIR"),
+	}
+	c.RetentionInterval = envDuration("VIEWER_RETENTION_INTERVAL", 24*time.Hour)
+	c.Cold = coldStoragePolicy{
+		After:   envDuration("VIEWER_COLD_AFTER", 0),
+		Mode:    strings.ToLower(envString("VIEWER_COLD_MODE", "compress")),
+		Bitrate: envString("VIEWER_COLD_BITRATE", "24k"),
+		Dir:     getenv("VIEWER_COLD_DIR"),
+	}
+	c.ReadOnly = envBool("VIEWER_READONLY", false)
+	c.PrimaryWorkspace = envString("VIEWER_WORKSPACE_NAME", "default")
+	c.Workspaces = envWorkspaces("VIEWER_WORKSPACES", c.PrimaryWorkspace)
+	c.BackupCommand = strings.Fields(getenv("VIEWER_BACKUP_COMMAND"))
+	c.BackupVerifyCommand = strings.Fields(getenv("VIEWER_BACKUP_VERIFY_COMMAND"))
+	c.BackupTarget = getenv("VIEWER_BACKUP_TARGET")
+	c.BackupUser = getenv("VIEWER_BACKUP_USER")
+	c.BackupPassword = getenv("VIEWER_BACKUP_PASSWORD")
+	c.SummaryCommand = strings.Fields(getenv("VIEWER_SUMMARY_COMMAND"))
+	c.WaveformCommand = strings.Fields(getenv("VIEWER_WAVEFORM_COMMAND"))
+	c.RegenerateStale = envBool("VIEWER_REGENERATE_STALE", false)
+	c.ExtractKeywords = envBool("VIEWER_EXTRACT_KEYWORDS", true)
+	c.KeywordsCommand = strings.Fields(getenv("VIEWER_KEYWORDS_COMMAND"))
+	c.DetectChapters = envBool("VIEWER_DETECT_CHAPTERS", true)
+	c.ChapterSilence = envDuration("VIEWER_CHAPTER_SILENCE", 3*time.Second)
+	c.ChapterMinLength = envDuration("VIEWER_CHAPTER_MIN_LENGTH", 5*time.Minute)
+	c.Topics = envTopics("VIEWER_TOPICS")
+	c.PublishTargets = envPublishTargets("VIEWER_PUBLISH_TARGETS")
+	c.Webhooks = envList("VIEWER_WEBHOOKS")
+	c.WebhookEvents = envList("VIEWER_WEBHOOK_EVENTS")
+	if len(c.WebhookEvents) == 0 {
+		c.WebhookEvents = []string{"recording.uploaded", "transcript.completed", "alert.matched"}
+	}
+	c.WebhookSecret = getenv("VIEWER_WEBHOOK_SECRET")
+	c.Hooks = envHooks("VIEWER_HOOKS")
+	c.HookTimeout = envDuration("VIEWER_HOOK_TIMEOUT", 30*time.Second)
+	c.CalendarFeeds = envList("VIEWER_CALENDAR_FEEDS")
+	c.SyncPeer = getenv("VIEWER_SYNC_PEER")
+	c.SyncToken = getenv("VIEWER_SYNC_TOKEN")
+	c.SyncPrefer = strings.ToLower(envString("VIEWER_SYNC_PREFER", syncKeep))
+	c.SFTPPath = envString("VIEWER_SFTP", "sftp")
+	c.RsyncPath = envString("VIEWER_RSYNC", "rsync")
+	c.SalvageIdle = envDuration("VIEWER_SALVAGE_IDLE", 5*time.Minute)
+	c.RateLimit = envFloat("VIEWER_RATE_LIMIT", 10)
+	c.RateBurst = envInt("VIEWER_RATE_BURST", 20)
+	c.MaxBodyBytes = int64(envInt("VIEWER_MAX_BODY_BYTES", 1<<30))
+	if loc, err := loadDisplayTimezone(getenv("VIEWER_DISPLAY_TIMEZONE")); err != nil {
+		invalidSetting("VIEWER_DISPLAY_TIMEZONE", getenv("VIEWER_DISPLAY_TIMEZONE"), err)
+		c.DisplayTimezone = time.Local
+	} else {
+		c.DisplayTimezone = loc
+	}
+	return c
+}
+
+func envString(name, def string) string {
+	if v := getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList splits a comma-separated environment variable, dropping blanks.
+func envList(name string) []string {
+	var out []string
+	for _, v := range strings.Split(getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envWorkspaces parses "name=dir,name=dir" into extra workspace roots,
+// skipping malformed entries and names clashing with the primary one.
+func envWorkspaces(name, primary string) map[string]string {
+	out := map[string]string{}
+	for _, entry := range envList(name) {
+		wsName, dir, ok := strings.Cut(entry, "=")
+		wsName, dir = strings.TrimSpace(wsName), strings.TrimSpace(dir)
+		if !ok || !validWorkspaceName(wsName) || wsName == primary || dir == "" {
+			slog.Warn("ignoring invalid workspace", "name", name, "value", entry)
+			continue
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		out[wsName] = filepath.Clean(dir)
+	}
+	return out
+}
+
+// envPrefixes parses a list of CIDR networks, e.g.
+// "192.168.1.0/24,fd00::/8"; a bare address stands for itself.
+func envPrefixes(name string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, entry := range envList(name) {
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			ip, ipErr := netip.ParseAddr(entry)
+			if ipErr != nil {
+				slog.Warn("ignoring invalid network", "name", name, "value", entry)
+				continue
+			}
+			p = netip.PrefixFrom(ip, ip.BitLen())
+		}
+		out = append(out, p.Masked())
+	}
+	return out
+}
+
+// envTopics parses "name=word|word,name=word", e.g.
+// "budget=budget|invoice|revenue,hiring=candidate|interview".
+func envTopics(name string) map[string][]string {
+	out := map[string][]string{}
+	for _, entry := range envList(name) {
+		topic, words, ok := strings.Cut(entry, "=")
+		topic = strings.TrimSpace(topic)
+		if !ok || topic == "" {
+			slog.Warn("ignoring invalid topic", "name", name, "value", entry)
+			continue
+		}
+		for _, w := range strings.Split(words, "|") {
+			if w = strings.TrimSpace(w); w != "" {
+				out[topic] = append(out[topic], w)
+			}
+		}
+	}
+	return out
+}
+
+func envBool(name string, def bool) bool {
+	raw := getenv(name)
+	if raw == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		invalidSetting(name, raw, err)
+		return def
+	}
+	return b
+}
+
+func envInt(name string, def int) int {
+	raw := getenv(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		invalidSetting(name, raw, err)
+		return def
+	}
+	return n
+}
+
+func envFloat(name string, def float64) float64 {
+	raw := getenv(name)
+	if raw == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		invalidSetting(name, raw, err)
+		return def
+	}
+	return f
+}
+
+// envDuration parses a time.Duration from the environment, falling back to def
+// when unset or malformed.
+func envDuration(name string, def time.Duration) time.Duration {
+	raw := getenv(name)
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		invalidSetting(name, raw, err)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The config file is a TOML file whose keys name the VIEWER_* settings:
+// a top-level key "listen" is VIEWER_LISTEN and "max_age" in a [retention]
+// table is VIEWER_RETENTION_MAX_AGE. Environment variables take precedence
+// over the file, and command-line flags over both.
+//
+// Only the part of TOML these settings need is understood: tables, and
+// strings, integers, floats, booleans and one-line arrays as values.
+
+// configFileAliases maps file keys whose setting does not follow the
+// naming rule.
+var configFileAliases = map[string]string{
+	"whisper.binary":    "VIEWER_WHISPER",
+	"whispercpp.binary": "VIEWER_WHISPERCPP",
+}
+
+// configFileLists are tables whose entries become one "name=value" list
+// setting, e.g. [workspaces] nas = "/mnt/nas" is VIEWER_WORKSPACES.
+var configFileLists = map[string]string{
+	"workspaces": "VIEWER_WORKSPACES",
+	"publish":    "VIEWER_PUBLISH_TARGETS",
+	"topics":     "VIEWER_TOPICS",
+	"hooks":      "VIEWER_HOOKS",
+}
+
+var settings struct {
+	sync.Mutex
+	// file holds the config file's values by setting name, and where holds
+	// where in path each was set.
+	path  string
+	file  map[string]string
+	where map[string]configFileKey
+	// consulted records the setting names the last load read, to spot
+	// config file keys that match no setting.
+	consulted map[string]bool
+	// problems are what the last load found wrong with the config file;
+	// see validateConfig.
+	problems []configProblem
+}
+
+// configFileKey is a key of the config file, as written, and its line.
+type configFileKey struct {
+	key  string
+	line int
+}
+
+// getenv returns the named VIEWER_* setting from the environment, falling
+// back to the config file.
+func getenv(name string) string {
+	settings.Lock()
+	defer settings.Unlock()
+	if settings.consulted != nil {
+		settings.consulted[name] = true
+	}
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return settings.file[name]
+}
+
+// configFileSetting returns the setting name for a dotted file key.
+func configFileSetting(key string) string {
+	if name, ok := configFileAliases[key]; ok {
+		return name
+	}
+	return "VIEWER_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// parseConfigFile reads the TOML subset described above into settings by
+// name, and where each was set. Arrays become comma-separated lists, and
+// configFileLists tables "name=value" lists.
+func parseConfigFile(data string) (map[string]string, map[string]configFileKey, error) {
+	out := map[string]string{}
+	where := map[string]configFileKey{}
+	lists := map[string][]string{}
+	table := ""
+	for i, line := range strings.Split(data, "\n") {
+		lineNo := i + 1
+		line = strings.TrimSpace(stripTOMLComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, nil, fmt.Errorf("line %d: invalid table header %q", lineNo, line)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if !validTOMLKey(table) {
+				return nil, nil, fmt.Errorf("line %d: invalid table name %q", lineNo, table)
+			}
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validTOMLKey(key) {
+			return nil, nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		value, err := parseTOMLValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s: %w", lineNo, key, err)
+		}
+		if name, ok := configFileLists[table]; ok {
+			if _, seen := where[name]; !seen {
+				where[name] = configFileKey{table, lineNo}
+			}
+			lists[name] = append(lists[name], key+"="+value)
+			continue
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		name := configFileSetting(key)
+		if _, dup := out[name]; dup {
+			return nil, nil, fmt.Errorf("line %d: %s set twice", lineNo, key)
+		}
+		out[name] = value
+		where[name] = configFileKey{key, lineNo}
+	}
+	for name, entries := range lists {
+		out[name] = strings.Join(entries, ",")
+	}
+	return out, where, nil
+}
+
+func validTOMLKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// stripTOMLComment drops a trailing # comment outside quoted strings.
+func stripTOMLComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseTOMLValue returns a value as the text its setting would hold in the
+// environment.
+func parseTOMLValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", errors.New("missing value")
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return "", errors.New("arrays must be on one line")
+		}
+		var items []string
+		for _, part := range splitTOMLArray(raw[1 : len(raw)-1]) {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			v, err := parseTOMLValue(part)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	case strings.HasPrefix(raw, `"`):
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return s, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "true" || raw == "false":
+		return raw, nil
+	}
+	number := strings.ReplaceAll(raw, "_", "")
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", fmt.Errorf("invalid value %s (strings need quotes)", raw)
+	}
+	return number, nil
+}
+
+// splitTOMLArray splits array items on commas outside quoted strings.
+func splitTOMLArray(s string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || i == 0 || s[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// loadConfigFile reads path and makes its values the fallback for getenv.
+// An empty path clears them. A file with values outside configEnums is
+// refused.
+func loadConfigFile(path string) error {
+	values := map[string]string{}
+	where := map[string]configFileKey{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if values, where, err = parseConfigFile(string(data)); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := configProblems(path, checkConfigEnums(values, where)); err != nil {
+			return err
+		}
+	}
+	settings.Lock()
+	settings.path, settings.file, settings.where = path, values, where
+	settings.Unlock()
+	return nil
+}
+
+// loadConfig builds the config from the environment and config file,
+// noting file keys that match no setting and values that do not parse for
+// validateConfig.
+func loadConfig() config {
+	settings.Lock()
+	settings.consulted = map[string]bool{}
+	settings.problems = nil
+	settings.Unlock()
+	c := loadConfigFromEnv()
+	settings.Lock()
+	defer settings.Unlock()
+	known := make([]string, 0, len(settings.consulted)+len(configSettingsElsewhere))
+	for name := range settings.consulted {
+		known = append(known, name)
+	}
+	known = append(known, configSettingsElsewhere...)
+	for name, at := range settings.where {
+		if !slices.Contains(known, name) {
+			settings.problems = append(settings.problems, configProblem{at, unknownSettingMessage(at.key, known)})
+		}
+	}
+	settings.consulted = nil
+	return c
+}
+
+// reloadConfig re-reads the config file on SIGHUP. Settings read only at
+// startup (the listen address, the recordings directory and the number of
+// job workers) keep their old values until a restart. On error the current
+// config stays in place.
+func reloadConfig(path string, overrides func(*config)) error {
+	restore := keepConfigFile()
+	if err := loadConfigFile(path); err != nil {
+		return err
+	}
+	next := loadConfig()
+	overrides(&next)
+	applyStoredSecrets(&next)
+	if err := validateConfig(next); err != nil {
+		restore()
+		return err
+	}
+	prev := cfg()
+	next.Listen, next.JobWorkers, next.PreviewWorkers = prev.Listen, prev.JobWorkers, prev.PreviewWorkers
+	setConfig(next)
+	if dir := recordingsDirSetting(); dir != baseDir {
+		slog.Warn("recordings directory change needs a restart", "current", baseDir, "configured", dir)
+	}
+	notifyScheduler()
+	publishEvent("config.reloaded", "", nil)
+	return nil
+}
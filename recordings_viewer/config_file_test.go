@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// useConfigFile makes contents the config file for the duration of the test.
+func useConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "viewer.toml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfigFile(path); err != nil {
+		t.Fatalf("load config file: %v", err)
+	}
+	t.Cleanup(func() { loadConfigFile("") })
+	return path
+}
+
+func TestParseConfigFile(t *testing.T) {
+	got, _, err := parseConfigFile(`
+# recordings viewer
+recordings_dir = "/data/recordings"  # trailing comment
+listen = ':9090'
+auth_token = "s3cr#t"
+allowed_origins = ["chrome-extension://abc", "http://localhost:3000"]
+rate_limit = 2.5
+
+[whisper]
+binary = "/opt/whisper"
+model = "small"
+
+[retention]
+max_age = "720h"
+max_bytes = 10_000_000
+
+[workspaces]
+nas = "/mnt/nas"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"VIEWER_RECORDINGS_DIR":      "/data/recordings",
+		"VIEWER_LISTEN":              ":9090",
+		"VIEWER_AUTH_TOKEN":          "s3cr#t",
+		"VIEWER_ALLOWED_ORIGINS":     "chrome-extension://abc,http://localhost:3000",
+		"VIEWER_RATE_LIMIT":          "2.5",
+		"VIEWER_WHISPER":             "/opt/whisper",
+		"VIEWER_WHISPER_MODEL":       "small",
+		"VIEWER_RETENTION_MAX_AGE":   "720h",
+		"VIEWER_RETENTION_MAX_BYTES": "10000000",
+		"VIEWER_WORKSPACES":          "nas=/mnt/nas",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	for _, bad := range []string{
+		"listen = :8080",
+		"[retention\nmax_age = \"1h\"",
+		"model = \"a\"\nmodel = \"b\"",
+		"origins = [\"a\",\n\"b\"]",
+		"just words",
+	} {
+		if _, _, err := parseConfigFile(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestConfigFileIsFallbackForEnvironment(t *testing.T) {
+	useConfigFile(t, "[whisper]\nmodel = \"small\"\n[retention]\ninterval = \"6h\"\n")
+	t.Setenv("VIEWER_RETENTION_INTERVAL", "2h")
+	c := loadConfig()
+	if c.DefaultModel != "small" {
+		t.Fatalf("model = %q, want the file's", c.DefaultModel)
+	}
+	if c.RetentionInterval != 2*time.Hour {
+		t.Fatalf("interval = %s, want the environment's", c.RetentionInterval)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) {})
+	path := useConfigFile(t, "listen = \":9000\"\n[whisper]\nmodel = \"base\"\n")
+	setConfig(loadConfig())
+
+	os.WriteFile(path, []byte("listen = \":9999\"\nreadonly = false\n[whisper]\nmodel = \"large\"\n"), 0o644)
+	if err := reloadConfig(path, func(c *config) { c.ReadOnly = true }); err != nil {
+		t.Fatal(err)
+	}
+	if cfg().DefaultModel != "large" || !cfg().ReadOnly {
+		t.Fatalf("after reload: model %q readOnly %v", cfg().DefaultModel, cfg().ReadOnly)
+	}
+	if cfg().Listen != ":9000" {
+		t.Fatalf("listen changed without a restart: %q", cfg().Listen)
+	}
+
+	os.WriteFile(path, []byte("model = large"), 0o644)
+	if err := reloadConfig(path, func(*config) {}); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if cfg().DefaultModel != "large" {
+		t.Fatalf("failed reload changed the config: %q", cfg().DefaultModel)
+	}
+}
+
+// TestReloadConfigDuringRequests is meant for go test -race: requests keep
+// reading the config while it is reloaded.
+func TestReloadConfigDuringRequests(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.AuthToken = "secret" })
+	path := useConfigFile(t, "[whisper]\nmodel = \"base\"\n")
+	h := withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := reloadConfig(path, func(c *config) { c.AuthToken = "secret" }); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/tags", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d", rec.Code)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// configProblem is something wrong with the config file, at the key that
+// caused it.
+type configProblem struct {
+	at  configFileKey
+	msg string
+}
+
+// configSettingsElsewhere are settings read outside loadConfigFromEnv, so
+// loadConfig does not see them consulted.
+var configSettingsElsewhere = []string{
+	"VIEWER_LOG_LEVEL",
+	"VIEWER_LOG_FORMAT",
+	"VIEWER_RECORDINGS_DIR",
+	"VIEWER_ASSETS_DIR",
+}
+
+// configEnums are the settings that take one of a few words.
+var configEnums = map[string][]string{
+	"VIEWER_COLD_MODE":        {"compress", "s3"},
+	"VIEWER_ENGINE":           {"whisper", "whisper.cpp"},
+	"VIEWER_LOG_LEVEL":        {"debug", "info", "warn", "error"},
+	"VIEWER_LOG_FORMAT":       {"text", "json"},
+	"VIEWER_RETENTION_ACTION": {"archive", "delete"},
+	"VIEWER_SECRETS_BACKEND":  {"auto", "keychain", "file"},
+	"VIEWER_SYNC_PREFER":      {"keep", "local", "peer", "newer"},
+}
+
+// configPairs are settings that mean nothing without each other.
+var configPairs = [][2]string{
+	{"VIEWER_S3_ENDPOINT", "VIEWER_S3_BUCKET"},
+	{"VIEWER_S3_ACCESS_KEY", "VIEWER_S3_SECRET_KEY"},
+	{"VIEWER_BACKUP_USER", "VIEWER_BACKUP_PASSWORD"},
+}
+
+// checkConfigEnums reports the file values outside configEnums.
+func checkConfigEnums(values map[string]string, where map[string]configFileKey) []configProblem {
+	var problems []configProblem
+	for name, allowed := range configEnums {
+		if v, ok := values[name]; ok && !slices.Contains(allowed, strings.ToLower(v)) {
+			problems = append(problems, configProblem{where[name], fmt.Sprintf("%q is not one of %s", v, strings.Join(allowed, ", "))})
+		}
+	}
+	return problems
+}
+
+// invalidSetting reports a setting whose value did not parse. Set by the
+// config file, it fails validateConfig; set in the environment, the
+// default is used with a warning.
+func invalidSetting(name, raw string, err error) {
+	settings.Lock()
+	defer settings.Unlock()
+	if _, inEnv := os.LookupEnv(name); !inEnv && settings.consulted != nil {
+		if at, ok := settings.where[name]; ok {
+			settings.problems = append(settings.problems, configProblem{at, fmt.Sprintf("invalid value %q: %v", raw, err)})
+			return
+		}
+	}
+	slog.Warn("ignoring invalid setting", "name", name, "value", raw, "err", err)
+}
+
+// unknownSettingMessage describes a file key that matches no setting,
+// suggesting the known one it was probably meant to be.
+func unknownSettingMessage(key string, known []string) string {
+	name := configFileSetting(key)
+	best, bestDist := "", 3
+	for _, k := range known {
+		if d := editDistance(name, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	if best == "" {
+		return "unknown setting"
+	}
+	suggestion := strings.ToLower(strings.TrimPrefix(best, "VIEWER_"))
+	// Keep the suggestion in the table the key was written in.
+	if table, _, ok := strings.Cut(key, "."); ok {
+		if rest, ok := strings.CutPrefix(suggestion, table+"_"); ok {
+			suggestion = table + "." + rest
+		}
+	}
+	return fmt.Sprintf("unknown setting (did you mean %q?)", suggestion)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// validateConfig checks c and the config file it was loaded from, as left
+// by loadConfig: unknown keys, values that do not parse, and settings set
+// in the file without the other half of their configPairs pair.
+func validateConfig(c config) error {
+	settings.Lock()
+	path := settings.path
+	problems := slices.Clone(settings.problems)
+	where := settings.where
+	settings.Unlock()
+	secrets := secretSettings(&c)
+	value := func(name string) string {
+		if p, ok := secrets[name]; ok {
+			return *p
+		}
+		return getenv(name)
+	}
+	for _, pair := range configPairs {
+		for i, name := range pair {
+			other := pair[1-i]
+			at, inFile := where[name]
+			if inFile && value(name) != "" && value(other) == "" {
+				problems = append(problems, configProblem{at, fmt.Sprintf("needs %s as well", strings.ToLower(strings.TrimPrefix(other, "VIEWER_")))})
+			}
+		}
+	}
+	return configProblems(path, problems)
+}
+
+// configProblems joins problems into one error, one "path:line: key: msg"
+// line each in file order, or returns nil when there are none.
+func configProblems(path string, problems []configProblem) error {
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].at.line < problems[j].at.line })
+	var errs []error
+	for _, p := range problems {
+		errs = append(errs, fmt.Errorf("%s:%d: %s: %s", path, p.at.line, p.at.key, p.msg))
+	}
+	return errors.Join(errs...)
+}
+
+// keepConfigFile saves the loaded config file so a reload that fails
+// validation can put it back.
+func keepConfigFile() (restore func()) {
+	settings.Lock()
+	path, file, where := settings.path, settings.file, settings.where
+	settings.Unlock()
+	return func() {
+		settings.Lock()
+		settings.path, settings.file, settings.where = path, file, where
+		settings.Unlock()
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigReportsFileMistakes(t *testing.T) {
+	path := useConfigFile(t, `listen = ":9000"
+rate_limt = 5
+job_workers = "two"
+
+[retention]
+max_agee = "720h"
+
+[backup]
+user = "me"
+`)
+	err := validateConfig(loadConfig())
+	if err == nil {
+		t.Fatal("expected problems")
+	}
+	want := []string{
+		path + `:2: rate_limt: unknown setting (did you mean "rate_limit"?)`,
+		path + `:3: job_workers: invalid value "two": strconv.Atoi: parsing "two": invalid syntax`,
+		path + `:6: retention.max_agee: unknown setting (did you mean "retention.max_age"?)`,
+		path + `:9: backup.user: needs backup_password as well`,
+	}
+	if got := strings.Split(err.Error(), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", err, strings.Join(want, "\n"))
+	}
+
+	// The environment can supply the other half, and its own bad values
+	// only warn.
+	t.Setenv("VIEWER_BACKUP_PASSWORD", "pw")
+	t.Setenv("VIEWER_JOB_WORKERS", "lots")
+	if err := validateConfig(loadConfig()); strings.Contains(err.Error(), "backup") || strings.Contains(err.Error(), "job_workers") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestConfigFileRejectsBadEnumValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "viewer.toml")
+	os.WriteFile(path, []byte("log_level = \"info\"\n\n[retention]\naction = \"shred\"\n"), 0o644)
+	t.Cleanup(func() { loadConfigFile("") })
+	err := loadConfigFile(path)
+	if err == nil || err.Error() != path+`:4: retention.action: "shred" is not one of archive, delete` {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestReloadKeepsConfigOnValidationError(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) {})
+	path := useConfigFile(t, "[whisper]\nmodel = \"base\"\n")
+	setConfig(loadConfig())
+
+	os.WriteFile(path, []byte("[whisper]\nmodel = \"large\"\nmodle = \"tiny\"\n"), 0o644)
+	if err := reloadConfig(path, func(*config) {}); err == nil || !strings.Contains(err.Error(), ":3: whisper.modle: unknown setting") {
+		t.Fatalf("err=%v", err)
+	}
+	if cfg().DefaultModel != "base" || getenv("VIEWER_WHISPER_MODEL") != "base" {
+		t.Fatalf("failed reload changed the config: %q", cfg().DefaultModel)
+	}
+}
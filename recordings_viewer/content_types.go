@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// audioContentTypes are the types recordings are served with. Go's table
+// and content sniffing miss several (m4a, flac) and report WebM audio as
+// video.
+var audioContentTypes = map[string]string{
+	".webm": "audio/webm", ".ogg": "audio/ogg", ".opus": "audio/ogg", ".mp3": "audio/mpeg",
+	".wav": "audio/wav", ".m4a": "audio/mp4", ".flac": "audio/flac", ".mp4": "audio/mp4",
+}
+
+// textContentTypes are the types transcripts and the other text files of a
+// session are served with. Without them http.ServeFile sniffs, and a
+// transcript that starts with a timestamp can come out as something else.
+var textContentTypes = map[string]string{
+	".txt": "text/plain; charset=utf-8", ".srt": "text/plain; charset=utf-8", ".md": "text/plain; charset=utf-8",
+	".vtt": "text/vtt; charset=utf-8", ".json": "application/json", ".jsonl": "application/x-ndjson",
+}
+
+// setContentType sets the Content-Type of the file called name on w when
+// its extension has one here.
+func setContentType(w http.ResponseWriter, name string) {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := audioContentTypes[ext]; ok {
+		w.Header().Set("Content-Type", t)
+	} else if t, ok := textContentTypes[ext]; ok {
+		w.Header().Set("Content-Type", t)
+	}
+}
+
+// audioSignatures are how each kind of recording starts.
+var audioSignatures = map[string]func(head []byte) bool{
+	".webm": func(b []byte) bool { return bytes.HasPrefix(b, []byte("\x1a\x45\xdf\xa3")) },
+	".ogg":  func(b []byte) bool { return bytes.HasPrefix(b, []byte("OggS")) },
+	".opus": func(b []byte) bool { return bytes.HasPrefix(b, []byte("OggS")) },
+	".mp3": func(b []byte) bool {
+		return bytes.HasPrefix(b, []byte("ID3")) || len(b) >= 2 && b[0] == 0xff && b[1]&0xe0 == 0xe0
+	},
+	".wav": func(b []byte) bool {
+		return len(b) >= 12 && (string(b[:4]) == "RIFF" || string(b[:4]) == "RF64") && string(b[8:12]) == "WAVE"
+	},
+	".m4a":  func(b []byte) bool { return len(b) >= 8 && string(b[4:8]) == "ftyp" },
+	".mp4":  func(b []byte) bool { return len(b) >= 8 && string(b[4:8]) == "ftyp" },
+	".flac": func(b []byte) bool { return bytes.HasPrefix(b, []byte("fLaC")) || bytes.HasPrefix(b, []byte("ID3")) },
+}
+
+// contentMismatchError is a body that is not what the name of the file it
+// was sent for says it is.
+type contentMismatchError struct{ msg string }
+
+func (e *contentMismatchError) Error() string { return e.msg }
+
+// checkedContent returns body checked against the file name it is stored
+// as: audio must start like its container, and text must be UTF-8 without
+// NUL bytes, JSON starting with an object or array. contentType, the
+// request's Content-Type, must not claim another kind of file. Reading the
+// returned reader fails with a *contentMismatchError where the content
+// stops matching. Capture chunks are not checked, as all but the first
+// continue a file rather than start one.
+func checkedContent(name, contentType string, body io.Reader) (io.Reader, error) {
+	ext := strings.ToLower(path.Ext(name))
+	declared, _, _ := mime.ParseMediaType(contentType)
+	_, isAudio := audioSignatures[ext]
+	_, isText := textContentTypes[ext]
+	switch {
+	case isAudio && (strings.HasPrefix(declared, "text/") || declared == "application/json"):
+		return nil, &contentMismatchError{fmt.Sprintf("%s is not audio, but %s was sent", ext, declared)}
+	case isText && (strings.HasPrefix(declared, "audio/") || strings.HasPrefix(declared, "video/") || strings.HasPrefix(declared, "image/")):
+		return nil, &contentMismatchError{fmt.Sprintf("%s is text, but %s was sent", ext, declared)}
+	case isAudio && !isChunkFile(name):
+		return &audioChecker{r: body, ext: ext}, nil
+	case isAudio:
+		return body, nil
+	case isText:
+		return &textChecker{r: body, json: ext == ".json" || ext == ".jsonl"}, nil
+	}
+	return body, nil
+}
+
+// audioChecker fails a read once the start of the body is known not to be
+// the container of ext.
+type audioChecker struct {
+	r       io.Reader
+	ext     string
+	head    []byte
+	checked bool
+}
+
+func (c *audioChecker) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.checked {
+		return n, err
+	}
+	c.head = append(c.head, p[:min(n, 12-len(c.head))]...)
+	if len(c.head) == 12 || err != nil {
+		c.checked = true
+		if !audioSignatures[c.ext](c.head) {
+			return 0, &contentMismatchError{fmt.Sprintf("the body is not %s audio (detected %s)", c.ext, http.DetectContentType(c.head))}
+		}
+	}
+	return n, err
+}
+
+// textChecker fails a read once the body is known not to be UTF-8 text,
+// or, with json set, not to start a JSON object or array.
+type textChecker struct {
+	r    io.Reader
+	json bool
+	// partial is the start of a UTF-8 sequence cut off by the last read.
+	partial []byte
+	offset  int64
+	started bool
+}
+
+func (c *textChecker) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	chunk := append(c.partial, p[:n]...)
+	if i := bytes.IndexByte(chunk, 0); i >= 0 {
+		return 0, &contentMismatchError{fmt.Sprintf("the body is binary, not text (NUL byte at %d)", c.offset+int64(i))}
+	}
+	if c.json && !c.started {
+		if trimmed := bytes.TrimLeft(chunk, " \t\r\n\ufeff"); len(trimmed) > 0 {
+			c.started = true
+			if trimmed[0] != '{' && trimmed[0] != '[' {
+				return 0, &contentMismatchError{"the body is not JSON"}
+			}
+		}
+	}
+	valid := len(chunk)
+	if err == nil {
+		// Keep up to three bytes of a sequence the next read completes.
+		for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-3; i-- {
+			if utf8.RuneStart(chunk[i]) {
+				if !utf8.FullRune(chunk[i:]) {
+					valid = i
+				}
+				break
+			}
+		}
+	}
+	if !utf8.Valid(chunk[:valid]) {
+		return 0, &contentMismatchError{"the body is not UTF-8 text"}
+	}
+	c.offset += int64(valid)
+	c.partial = append(c.partial[:0], chunk[valid:]...)
+	return n, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// webmHeader is the EBML magic WebM files start with, enough for a test
+// body to pass as WebM audio.
+const webmHeader = "\x1a\x45\xdf\xa3"
+
+func TestServedContentTypes(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.txt", "call.json", "call.m4a", "call.srt")
+	for path, want := range map[string]string{
+		"/api/transcripts/call.txt":  "text/plain; charset=utf-8",
+		"/api/transcripts/call.json": "application/json",
+		"/recordings/call.m4a":       "audio/mp4",
+		"/recordings/call.srt":       "text/plain; charset=utf-8",
+	} {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || got != want {
+			t.Errorf("%s: %d %q, want %q", path, rec.Code, got, want)
+		}
+	}
+}
+
+func TestPutRejectsMismatchedContent(t *testing.T) {
+	useTempBaseDir(t)
+	for _, tc := range []struct {
+		name, contentType, body string
+		want                    int
+	}{
+		{"a.txt", "", "Hello, wörld.", http.StatusNoContent},
+		{"a.txt", "", "ID3\x04\x00\x00\x00\x00", http.StatusUnsupportedMediaType},
+		{"a.txt", "", "caf\xe9", http.StatusUnsupportedMediaType},
+		{"a.txt", "audio/webm", "Hello", http.StatusUnsupportedMediaType},
+		{"a.json", "application/json", ` {"segments": []}`, http.StatusNoContent},
+		{"a.json", "", "Hello", http.StatusUnsupportedMediaType},
+		{"a.webm", "audio/webm", webmHeader + "\x42\x86\x81\x01", http.StatusNoContent},
+		{"a.webm", "", "RIFF\x24\x00\x00\x00WAVEfmt ", http.StatusUnsupportedMediaType},
+		{"a.webm", "text/plain", webmHeader, http.StatusUnsupportedMediaType},
+		{"a.wav", "", "RIFF\x24\x00\x00\x00WAVEfmt ", http.StatusNoContent},
+		{"a.mp3", "", "\xff\xfb\x90\x64", http.StatusNoContent},
+		{"a.chunk0003.webm", "", "\x1f\x43\xb6\x75", http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/api/transcripts/"+tc.name, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %q: %d %s", tc.name, tc.body, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestTextCheckerAcrossReads(t *testing.T) {
+	r, err := checkedContent("a.txt", "", iotest.OneByteReader(strings.NewReader("naïve — ✓")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || string(got) != "naïve — ✓" {
+		t.Fatalf("read %q, %v", got, err)
+	}
+	// A sequence cut off by the end of the body is not text.
+	r, _ = checkedContent("a.txt", "", iotest.OneByteReader(strings.NewReader("naïve \xe2\x80")))
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("truncated UTF-8 accepted")
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Custom field types. The type hints how a value is shown, compared in
+// filters and written to CSV.
+const (
+	fieldText   = "text"
+	fieldNumber = "number"
+	fieldDate   = "date"
+	fieldBool   = "bool"
+)
+
+// customField is one user-defined value in a manifest, such as a client
+// name or a matter number. Value is a string for text and date (as
+// YYYY-MM-DD), a float64 for number and a bool for bool.
+type customField struct {
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// customFieldName keeps field names usable in ?field= filters and search
+// queries: no operators or colons, and no surrounding spaces.
+var customFieldName = regexp.MustCompile(`^[\p{L}\p{N}_](?:[\p{L}\p{N}_ .-]{0,62}[\p{L}\p{N}_.-])?$`)
+
+// check reports why f's value does not fit its type.
+func (f customField) check() error {
+	switch f.Type {
+	case fieldText:
+		if _, ok := f.Value.(string); !ok {
+			return errors.New("must be a string")
+		}
+	case fieldNumber:
+		if _, ok := f.Value.(float64); !ok {
+			return errors.New("must be a number")
+		}
+	case fieldDate:
+		s, ok := f.Value.(string)
+		if _, err := time.Parse(time.DateOnly, s); !ok || err != nil {
+			return errors.New("must be a date like 2024-05-01")
+		}
+	case fieldBool:
+		if _, ok := f.Value.(bool); !ok {
+			return errors.New("must be true or false")
+		}
+	default:
+		return fmt.Errorf("unknown type %q (want text, number, date or bool)", f.Type)
+	}
+	return nil
+}
+
+// String formats the value for CSV and display.
+func (f customField) String() string {
+	switch v := f.Value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// parseCustomFields reads the fields of a PUT body. Each value is either
+// {"type": ..., "value": ...} or a bare string, number or boolean whose
+// type is inferred; dates need the explicit form.
+func parseCustomFields(raw map[string]json.RawMessage) (map[string]customField, error) {
+	out := map[string]customField{}
+	for name, data := range raw {
+		if !customFieldName.MatchString(name) {
+			return nil, fmt.Errorf("invalid field name %q", name)
+		}
+		var f customField
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			if err := json.Unmarshal(data, &f); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		} else {
+			if err := json.Unmarshal(data, &f.Value); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			switch f.Value.(type) {
+			case string:
+				f.Type = fieldText
+			case float64:
+				f.Type = fieldNumber
+			case bool:
+				f.Type = fieldBool
+			default:
+				return nil, fmt.Errorf("%s: must be a string, number, boolean or {\"type\", \"value\"}", name)
+			}
+		}
+		if err := f.check(); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		out[name] = f
+	}
+	return out, nil
+}
+
+// lookupField finds name in fields, ignoring case.
+func lookupField(fields map[string]customField, name string) (customField, bool) {
+	if f, ok := fields[name]; ok {
+		return f, true
+	}
+	for k, f := range fields {
+		if strings.EqualFold(k, name) {
+			return f, true
+		}
+	}
+	return customField{}, false
+}
+
+// fieldFilter is a ?field= filter or field: search term: "client=Acme",
+// "hours>=2", "due<2024-07-01", or a bare name for "has the field".
+type fieldFilter struct {
+	Name, Op, Value string
+}
+
+var fieldOps = []string{">=", "<=", "!=", "=", "<", ">"}
+
+func parseFieldFilter(s string) (fieldFilter, error) {
+	i := strings.IndexAny(s, "=<>!")
+	if i < 0 {
+		if strings.TrimSpace(s) == "" {
+			return fieldFilter{}, errors.New("empty field filter")
+		}
+		return fieldFilter{Name: strings.TrimSpace(s)}, nil
+	}
+	ff := fieldFilter{Name: strings.TrimSpace(s[:i])}
+	for _, op := range fieldOps {
+		if strings.HasPrefix(s[i:], op) {
+			ff.Op, ff.Value = op, strings.TrimSpace(s[i+len(op):])
+			break
+		}
+	}
+	if ff.Name == "" || ff.Op == "" {
+		return ff, fmt.Errorf("invalid field filter %q (want name, name=value, name>value, ...)", s)
+	}
+	return ff, nil
+}
+
+// parseFieldFilters parses every ?field= parameter.
+func parseFieldFilters(values []string) ([]fieldFilter, error) {
+	var out []fieldFilter
+	for _, v := range values {
+		ff, err := parseFieldFilter(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ff)
+	}
+	return out, nil
+}
+
+// matches compares the field named by ff according to its type: numbers
+// numerically, dates and text in order (text ignoring case). A value that
+// does not parse as the field's type never matches.
+func (ff fieldFilter) matches(fields map[string]customField) bool {
+	f, ok := lookupField(fields, ff.Name)
+	if !ok || ff.Op == "" {
+		return ok
+	}
+	var cmp int
+	switch f.Type {
+	case fieldNumber:
+		want, err := strconv.ParseFloat(ff.Value, 64)
+		if err != nil {
+			return false
+		}
+		have, _ := f.Value.(float64)
+		switch {
+		case have < want:
+			cmp = -1
+		case have > want:
+			cmp = 1
+		}
+	case fieldBool:
+		want, err := strconv.ParseBool(ff.Value)
+		if err != nil || (ff.Op != "=" && ff.Op != "!=") {
+			return false
+		}
+		if f.Value != want {
+			cmp = 1
+		}
+	case fieldDate:
+		if _, err := time.Parse(time.DateOnly, ff.Value); err != nil {
+			return false
+		}
+		cmp = strings.Compare(f.String(), ff.Value)
+	default:
+		cmp = strings.Compare(strings.ToLower(f.String()), strings.ToLower(ff.Value))
+	}
+	switch ff.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func matchesFields(fields map[string]customField, filters []fieldFilter) bool {
+	for _, ff := range filters {
+		if !ff.matches(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldNames returns the sorted union of the field names in use.
+func fieldNames(sessions []session) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, s := range sessions {
+		for name := range s.Fields {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// transcriptFieldsHandler serves GET/PUT /api/transcripts/{path}/fields.
+// PUT replaces every custom field with the body's {"fields": {...}}.
+func transcriptFieldsHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	fullPath := absPath(rel)
+	switch r.Method {
+	case http.MethodGet:
+		meta, err := loadMeta(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fields := meta.Fields
+		if fields == nil {
+			fields = map[string]customField{}
+		}
+		writeJSON(w, map[string]any{"fields": fields})
+	case http.MethodPut:
+		var payload struct {
+			Fields map[string]json.RawMessage `json:"fields"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		fields, err := parseCustomFields(payload.Fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		meta, err := loadMeta(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		meta.Fields = fields
+		if len(fields) == 0 {
+			meta.Fields = nil
+		}
+		if err := saveMeta(fullPath, meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestLogger(r).Info("updated fields", "path", rel, "fields", len(fields))
+		publishEvent("fields.updated", rel, map[string]any{"fields": fields})
+		writeJSON(w, map[string]any{"fields": fields})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
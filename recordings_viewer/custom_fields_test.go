@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func putFields(t *testing.T, rel, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/"+rel+"/fields", strings.NewReader(body)))
+	return rec
+}
+
+func TestCustomFieldsPutAndFilter(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "a.txt", "b.webm", "b.txt")
+
+	rec := putFields(t, "a.webm", `{"fields": {"client": "Acme", "hours": 2.5, "billable": true, "due": {"type": "date", "value": "2024-07-01"}}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body)
+	}
+	putFields(t, "b.webm", `{"fields": {"client": "Globex", "hours": 10}}`)
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/a.webm/fields", nil))
+	var got struct {
+		Fields map[string]customField `json:"fields"`
+	}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if f := got.Fields["due"]; f.Type != fieldDate || f.Value != "2024-07-01" || got.Fields["hours"].Type != fieldNumber {
+		t.Fatalf("fields = %+v", got.Fields)
+	}
+
+	list := func(query string) []string {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?"+query, nil))
+		var sessions []session
+		json.NewDecoder(rec.Body).Decode(&sessions)
+		var ids []string
+		for _, s := range sessions {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	cases := map[string]string{
+		"field=client%3Dacme":                        "a",
+		"field=hours%3E3":                            "b",
+		"field=hours%3C%3D2.5&field=billable%3Dtrue": "a",
+		"field=due%3C2024-08-01":                     "a",
+		"field=due":                                  "a",
+		"field=client%21%3DAcme":                     "b",
+		"field=hours%3Dlots":                         "",
+	}
+	for q, want := range cases {
+		if got := strings.Join(list(q), ","); got != want {
+			t.Errorf("?%s = %q, want %q", q, got, want)
+		}
+	}
+
+	q, err := parseSessionQuery(`field:"client=Acme" field:hours<3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := findSession("a"); !q.matches(s) {
+		t.Fatalf("query %+v does not match a", q)
+	}
+}
+
+func TestCustomFieldsRejectBadValues(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm")
+	for _, body := range []string{
+		`{"fields": {"due": {"type": "date", "value": "next week"}}}`,
+		`{"fields": {"hours": {"type": "number", "value": "2"}}}`,
+		`{"fields": {"a=b": "x"}}`,
+		`{"fields": {"tags": ["x"]}}`,
+		`{"fields": {"x": {"type": "money", "value": 1}}}`,
+	} {
+		if rec := putFields(t, "a.webm", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", body, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?field=%3Dx", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad filter status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// regenerateTimeout bounds one run of a summary or waveform command, or
+// the drawing of a waveform or spectrogram.
+const regenerateTimeout = 10 * time.Minute
+
+// derivedRecord is what the server generated a derived artifact from. An
+// artifact with a record is stale once its source's content changes; a
+// touched or copied source with the same SHA-256 keeps it fresh.
+type derivedRecord struct {
+	Source        string    `json:"source"`
+	SourceSize    int64     `json:"sourceSize"`
+	SourceModTime time.Time `json:"sourceModTime"`
+	SourceSHA256  string    `json:"sourceSha256"`
+	GeneratedAt   time.Time `json:"generatedAt"`
+}
+
+func derivedPath() string {
+	return filepath.Join(stateDir(), "derived.json")
+}
+
+// loadDerived reads the derived artifact records, keyed by artifact path.
+func loadDerived() (map[string]derivedRecord, error) {
+	records := map[string]derivedRecord{}
+	data, err := os.ReadFile(derivedPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return records, err
+	}
+	return records, json.Unmarshal(data, &records)
+}
+
+// saveDerived writes the records. Callers hold mu.
+func saveDerived(records map[string]derivedRecord) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(derivedPath(), bytes.NewReader(append(data, '\n')))
+	return err
+}
+
+// sourceUnchanged reports whether rec's source still has the content the
+// artifact was generated from. Size and modification time settle the common
+// case; the file is hashed only when they differ.
+func (rec derivedRecord) sourceUnchanged() bool {
+	full := absPath(rec.Source)
+	info, err := os.Stat(full)
+	if err != nil {
+		return false
+	}
+	if info.Size() == rec.SourceSize && info.ModTime().Equal(rec.SourceModTime) {
+		return true
+	}
+	sum, err := hashFile(full)
+	return err == nil && sum == rec.SourceSHA256
+}
+
+// regenerator produces one kind of derived artifact for a session. It
+// returns the file it worked from, as a recordings path, and the content,
+// and may report how far along it is, from 0 to 1, to progress.
+type regenerator struct {
+	available func() bool
+	run       func(ctx context.Context, s *session, progress func(float64)) (src string, content []byte, err error)
+}
+
+var regenerators = map[string]regenerator{
+	artifactSRT: {
+		available: func() bool { return true },
+		run: func(ctx context.Context, s *session, progress func(float64)) (string, []byte, error) {
+			if s.TranscriptJSON == "" {
+				return "", nil, errors.New("no JSON transcript to build subtitles from")
+			}
+			srt, err := renderTranscriptExport(s.TranscriptJSON, exportOptions{Format: "srt"}, recordingProvenance(s.TranscriptJSON))
+			return s.TranscriptJSON, []byte(srt), err
+		},
+	},
+	artifactSummary: {
+		available: func() bool { return len(cfg().SummaryCommand) > 0 },
+		run: func(ctx context.Context, s *session, progress func(float64)) (string, []byte, error) {
+			src := s.Transcript
+			if src == "" {
+				src = s.TranscriptJSON
+			}
+			if src == "" {
+				return "", nil, errors.New("no transcript to summarize")
+			}
+			out, err := runArtifactCommand(ctx, summaryCommand(src), src)
+			return src, out, err
+		},
+	},
+	artifactWaveform: {
+		available: func() bool { return true },
+		run: func(ctx context.Context, s *session, progress func(float64)) (string, []byte, error) {
+			if s.Audio == "" {
+				return "", nil, errors.New("no audio to draw")
+			}
+			if len(cfg().WaveformCommand) == 0 {
+				out, err := drawWaveform(ctx, s.Audio, progress)
+				return s.Audio, out, err
+			}
+			out, err := runArtifactCommand(ctx, cfg().WaveformCommand, s.Audio)
+			return s.Audio, out, err
+		},
+	},
+	artifactSpectrogram: {
+		available: func() bool { return true },
+		run: func(ctx context.Context, s *session, progress func(float64)) (string, []byte, error) {
+			if s.Audio == "" {
+				return "", nil, errors.New("no audio to draw")
+			}
+			out, err := drawSpectrogram(ctx, s.Audio)
+			return s.Audio, out, err
+		},
+	},
+}
+
+// runArtifactCommand runs a configured generator on the recordings path src
+// and returns what it printed.
+func runArtifactCommand(ctx context.Context, tmpl []string, src string) ([]byte, error) {
+	args := expandCommand(tmpl, absPath(src), src)
+	out, err := runCommandFunc(ctx, args[0], args[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", filepath.Base(args[0]), err, outputTail(out))
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, fmt.Errorf("%s printed nothing", filepath.Base(args[0]))
+	}
+	return out, nil
+}
+
+// regenerate runs a "regenerate", "waveform" or "spectrogram" job: it
+// rebuilds the artifact at j.Path from its session's current files and
+// records what it was built from. Progress is published as job.progress
+// events, at most one per tenth.
+func regenerate(ctx context.Context, j job) ([]string, error) {
+	s, err := findSession(j.Path)
+	if err != nil {
+		return nil, err
+	}
+	kind := artifactKind(path.Base(j.Path))
+	gen, ok := regenerators[kind]
+	if !ok || !gen.available() {
+		return nil, fmt.Errorf("cannot regenerate %s artifacts", kind)
+	}
+	// Fingerprint the sources before reading them, so a change made while
+	// the artifact is built leaves it stale rather than falsely fresh.
+	before := map[string]derivedRecord{}
+	for _, src := range []string{s.Audio, s.Transcript, s.TranscriptJSON} {
+		if src == "" {
+			continue
+		}
+		info, err := os.Stat(absPath(src))
+		if err != nil {
+			return nil, err
+		}
+		sum, err := hashFile(absPath(src))
+		if err != nil {
+			return nil, err
+		}
+		before[src] = derivedRecord{Source: src, SourceSize: info.Size(), SourceModTime: info.ModTime(), SourceSHA256: sum}
+	}
+	ctx, cancel := context.WithTimeout(ctx, regenerateTimeout)
+	defer cancel()
+	reported := 0.0
+	progress := func(p float64) {
+		if p = math.Floor(min(p, 1)*10) / 10; p > reported {
+			reported = p
+			publishEvent("job.progress", j.Path, map[string]any{"id": j.ID, "progress": p})
+		}
+	}
+	src, content, err := gen.run(ctx, s, progress)
+	if err != nil {
+		return nil, err
+	}
+	rec := before[src]
+	rec.GeneratedAt = time.Now().UTC()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := writeFileAtomic(absPath(j.Path), bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	records, err := loadDerived()
+	if err != nil {
+		slog.Warn("derived artifact records unreadable, starting over", "err", err)
+		records = map[string]derivedRecord{}
+	}
+	records[j.Path] = rec
+	if err := saveDerived(records); err != nil {
+		return nil, err
+	}
+	return []string{j.Path}, nil
+}
+
+// staleArtifact is an artifact older than what it was derived from.
+type staleArtifact struct {
+	Session     string    `json:"session"`
+	Kind        string    `json:"kind"`
+	Path        string    `json:"path"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Regenerable bool      `json:"regenerable"`
+}
+
+func staleArtifacts(s *session) []staleArtifact {
+	var out []staleArtifact
+	for kind, a := range s.Artifacts {
+		if a.Fresh || a.Generated {
+			continue
+		}
+		gen, ok := regenerators[kind]
+		out = append(out, staleArtifact{
+			Session: s.ID, Kind: kind, Path: a.Path, UpdatedAt: a.UpdatedAt,
+			Regenerable: ok && gen.available(),
+		})
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Kind < out[k].Kind })
+	return out
+}
+
+// queueRegeneration queues a job for each stale artifact of s the server
+// can rebuild, unless one is already waiting or running.
+func queueRegeneration(s *session) []*job {
+	var queued []*job
+	for _, a := range staleArtifacts(s) {
+		typ := regenerateJobType(a.Kind)
+		if !a.Regenerable || jobs.pending(typ, a.Path) {
+			continue
+		}
+		j := &job{ID: randomID(), Type: typ, Path: a.Path, Status: jobQueued, CreatedAt: time.Now().UTC()}
+		jobs.enqueue(j)
+		slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path)
+		publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+		queued = append(queued, j)
+	}
+	return queued
+}
+
+// regenerateAfterChange queues regeneration of the artifacts a change to rel
+// left stale, when VIEWER_REGENERATE_STALE is set.
+func regenerateAfterChange(rel string) {
+	if !cfg().RegenerateStale || cfg().ReadOnly {
+		return
+	}
+	if s, err := findSession(rel); err == nil {
+		queueRegeneration(s)
+	}
+}
+
+// staleHandler serves GET /api/stale with every stale artifact and
+// POST /api/stale, optionally with {"sessions": [...]}, to queue their
+// regeneration.
+func staleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Sessions []string `json:"sessions"`
+	}
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	var sessions []session
+	if len(req.Sessions) > 0 {
+		for _, id := range req.Sessions {
+			s, err := findSession(id)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("session %s not found", id), http.StatusNotFound)
+				return
+			}
+			sessions = append(sessions, *s)
+		}
+	} else {
+		all, err := scanSessions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sessions = all
+	}
+
+	if r.Method == http.MethodGet {
+		stale := []staleArtifact{}
+		for i := range sessions {
+			stale = append(stale, staleArtifacts(&sessions[i])...)
+		}
+		writeJSON(w, stale)
+		return
+	}
+	queued := []*job{}
+	for i := range sessions {
+		queued = append(queued, queueRegeneration(&sessions[i])...)
+	}
+	writeJSONStatus(w, http.StatusAccepted, queued)
+}
+
+// derivedFreshness decides whether the artifact at a.Path is fresh from its
+// derived record, falling back to comparing modification times with from.
+func derivedFreshness(records map[string]derivedRecord, a, from artifact) bool {
+	if rec, ok := records[a.Path]; ok {
+		return rec.sourceUnchanged()
+	}
+	return !a.UpdatedAt.Before(from.UpdatedAt)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staleSRTFixture writes call.webm, call.json and a call.srt older than the
+// JSON transcript.
+func staleSRTFixture(t *testing.T) string {
+	t.Helper()
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm", "call.srt")
+	if err := os.WriteFile(filepath.Join(dir, "call.json"), []byte(segmentsFixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, f := range []string{"call.webm", "call.srt"} {
+		if err := os.Chtimes(filepath.Join(dir, f), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func sessionArtifact(t *testing.T, id, kind string) artifact {
+	t.Helper()
+	s, err := findSession(id)
+	if err != nil {
+		t.Fatalf("findSession(%s): %v", id, err)
+	}
+	return s.Artifacts[kind]
+}
+
+func runQueuedJobs(t *testing.T) []job {
+	t.Helper()
+	var ran []job
+	for {
+		j, ok := jobs.claim()
+		if !ok {
+			return ran
+		}
+		runJob(j)
+		final, _ := jobs.get(j.ID)
+		ran = append(ran, final)
+	}
+}
+
+func TestRegenerateStaleSRT(t *testing.T) {
+	dir := staleSRTFixture(t)
+	useJobQueue(t)
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stale", nil))
+	var stale []staleArtifact
+	json.NewDecoder(rec.Body).Decode(&stale)
+	if len(stale) != 1 || stale[0].Path != "call.srt" || !stale[0].Regenerable {
+		t.Fatalf("stale = %+v", stale)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/stale", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("queue status = %d: %s", rec.Code, rec.Body)
+	}
+	// Queuing again while the job waits adds nothing.
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/stale", strings.NewReader(`{"sessions":["call"]}`)))
+	if strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Fatalf("duplicate jobs queued: %s", rec.Body)
+	}
+
+	ran := runQueuedJobs(t)
+	if len(ran) != 1 || ran[0].Type != "regenerate" || ran[0].Status != jobCompleted {
+		t.Fatalf("jobs = %+v", ran)
+	}
+	srt, _ := os.ReadFile(filepath.Join(dir, "call.srt"))
+	if !strings.Contains(string(srt), "00:00:01,500 --> 00:00:03,000") {
+		t.Fatalf("srt = %s", srt)
+	}
+	if !sessionArtifact(t, "call", artifactSRT).Fresh {
+		t.Fatal("regenerated srt is stale")
+	}
+
+	// Touching the transcript without changing it keeps the srt fresh,
+	// even though it is now older.
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "call.json"), later, later)
+	if !sessionArtifact(t, "call", artifactSRT).Fresh {
+		t.Fatal("srt stale after the transcript was only touched")
+	}
+	os.WriteFile(filepath.Join(dir, "call.json"), []byte(strings.Replace(segmentsFixture, "Kenobi", "Grievous", 2)), 0o644)
+	if sessionArtifact(t, "call", artifactSRT).Fresh {
+		t.Fatal("srt fresh after the transcript changed")
+	}
+}
+
+func TestRegenerateAfterSegmentEdit(t *testing.T) {
+	dir := staleSRTFixture(t)
+	useJobQueue(t)
+	useConfig(t, func(c *config) {
+		c.RegenerateStale = true
+		c.ExtractKeywords = false
+		c.SummaryCommand = []string{"summarize", "{src}"}
+	})
+	writeTestFiles(t, dir, "call.summary.md")
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "call.summary.md"), old, old)
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "summarize" || args[0] != filepath.Join(dir, "call.json") {
+			t.Fatalf("unexpected command %s %v", name, args)
+		}
+		return []byte("A greeting.\n"), nil
+	})
+
+	rec := patchSegmentRequest(t, "/api/transcripts/call.json/segments/0", `{"text":" Hi."}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch status = %d", rec.Code)
+	}
+	ran := runQueuedJobs(t)
+	if len(ran) != 2 {
+		t.Fatalf("jobs = %+v", ran)
+	}
+	for _, j := range ran {
+		if j.Status != jobCompleted {
+			t.Fatalf("job %s: %s", j.Path, j.Error)
+		}
+	}
+	summary, _ := os.ReadFile(filepath.Join(dir, "call.summary.md"))
+	if string(summary) != "A greeting.\n" {
+		t.Fatalf("summary = %q", summary)
+	}
+	srt, _ := os.ReadFile(filepath.Join(dir, "call.srt"))
+	if !strings.Contains(string(srt), "Hi.") {
+		t.Fatalf("srt = %s", srt)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !linux && !darwin && !freebsd
+
+package main
+
+import "errors"
+
+// diskSpace is not implemented where syscall has no portable Statfs_t;
+// callers skip their free-space checks.
+func diskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+)
+
+// openAPISpec describes the HTTP API; docs_test.go checks that every
+// path in it reaches a handler.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// openAPIHandler serves GET /api/openapi.json, stamped with the server's
+// version.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info, ok := spec["info"].(map[string]any); ok {
+		info["version"] = appVersion
+	}
+	writeJSON(w, spec)
+}
+
+// docsHandler serves GET /api/docs, a page that lists the API from
+// /api/openapi.json and sends requests to this server from forms.
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPISpecPathsReachHandlers(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	fill := strings.NewReplacer("{path}", "2024/call.webm", "{id}", "abc", "{n}", "0", "{name}", "p")
+	mux := newMux()
+	for p, ops := range spec.Paths {
+		for method := range ops {
+			// /api/v1/ hands everything on; check the route it hands to.
+			req := httptest.NewRequest(strings.ToUpper(method), unversionedPath(fill.Replace(p)), nil)
+			// "/" is the UI's file server, which catches unknown paths.
+			if _, pattern := mux.Handler(req); pattern == "/" || pattern == "" {
+				t.Errorf("%s %s has no handler", method, p)
+			}
+		}
+	}
+}
+
+func TestOpenAPISpecPathsAreVersioned(t *testing.T) {
+	var spec struct {
+		Paths map[string]any `json:"paths"`
+	}
+	json.Unmarshal(openAPISpec, &spec)
+	for p := range spec.Paths {
+		if strings.HasPrefix(p, "/api/") && !strings.HasPrefix(p, apiV1Prefix+"/") {
+			t.Errorf("%s is not under %s", p, apiV1Prefix)
+		}
+	}
+}
+
+func TestAPIV1ServesTheSameRoutes(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "uuid/clip/audio.webm")
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/sessions/uuid/clip/audio", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"uuid/clip/audio"`) || rec.Header().Get("API-Version") != "1" {
+		t.Fatalf("GET /api/v1/sessions/{id}: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown route: %d", rec.Code)
+	}
+
+	// Read-only mode knows the versioned safe paths too.
+	useConfig(t, func(c *config) { c.ReadOnly = true })
+	h := withReadOnly(newMux())
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/validate/manifest", strings.NewReader(`{"schema": 1}`)))
+	if rec.Code == http.StatusForbidden {
+		t.Fatalf("safe POST refused under /api/v1")
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/transcribe", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("write allowed under /api/v1: %d", rec.Code)
+	}
+}
+
+func TestDocsEndpoints(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.OpenAPI != "3.0.3" || spec.Info.Version != appVersion {
+		t.Fatalf("spec = %+v", spec)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/api/openapi.json") {
+		t.Fatalf("docs: %d", rec.Code)
+	}
+}
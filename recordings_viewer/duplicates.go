@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audio fingerprints are loudness envelopes: the level of each
+// fingerprintFrame of audio decoded to mono at fingerprintRate, in dB
+// scaled to a byte. They survive re-encoding and the small offsets between
+// two captures of the same tab, which a content hash does not.
+const (
+	fingerprintRate  = 8000
+	fingerprintFrame = 500 * time.Millisecond
+	// fingerprintMaxLag is how far apart, in frames, two captures of the
+	// same audio may start.
+	fingerprintMaxLag = 10
+	// nearDuplicateSimilarity is the least envelope correlation for two
+	// recordings to count as the same audio.
+	nearDuplicateSimilarity = 0.9
+)
+
+// nearDuplicateTolerance is how much the lengths of two near duplicates
+// may differ: a second, or 2% of the longer one.
+func nearDuplicateTolerance(a, b float64) float64 {
+	return max(1, 0.02*max(a, b))
+}
+
+// audioPrint is what the duplicate scan learned about one audio file. It is
+// cached in .viewer/fingerprints.json while the file's size and
+// modification time stay the same.
+type audioPrint struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	SHA256   string    `json:"sha256"`
+	Duration float64   `json:"duration,omitempty"`
+	Envelope []byte    `json:"envelope,omitempty"`
+}
+
+func fingerprintsPath() string {
+	return filepath.Join(stateDir(), "fingerprints.json")
+}
+
+func duplicatesPath() string {
+	return filepath.Join(stateDir(), "duplicates.json")
+}
+
+// duplicateMember is one session of a duplicate cluster.
+type duplicateMember struct {
+	ID         string    `json:"id"`
+	Audio      string    `json:"audio"`
+	Size       int64     `json:"size"`
+	Duration   float64   `json:"duration,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+	Transcript bool      `json:"transcript"`
+}
+
+// duplicateCluster groups sessions with the same audio. Exact clusters
+// have byte-identical audio; near clusters are as long as each other and
+// sound the same, and Similarity is the weakest link between them.
+// Sessions are oldest first; Reclaimable is the size of all but the
+// largest.
+type duplicateCluster struct {
+	Kind        string            `json:"kind"`
+	Similarity  float64           `json:"similarity"`
+	Sessions    []duplicateMember `json:"sessions"`
+	Reclaimable int64             `json:"reclaimable"`
+}
+
+// duplicatesReport is the result of a duplicate scan.
+type duplicatesReport struct {
+	ScannedAt   time.Time          `json:"scannedAt"`
+	Scanned     int                `json:"scanned"`
+	Clusters    []duplicateCluster `json:"clusters"`
+	Reclaimable int64              `json:"reclaimable"`
+	Errors      []string           `json:"errors,omitempty"`
+}
+
+// duplicateScan keeps scans from running concurrently.
+var duplicateScan sync.Mutex
+
+// scanDuplicates fingerprints the audio of every session and clusters the
+// duplicates. Unchanged files reuse their cached fingerprint, and the
+// checksum index spares hashing files the server wrote itself.
+func scanDuplicates(ctx context.Context) (duplicatesReport, error) {
+	duplicateScan.Lock()
+	defer duplicateScan.Unlock()
+	report := duplicatesReport{ScannedAt: time.Now().UTC(), Clusters: []duplicateCluster{}}
+	sessions, err := scanSessions()
+	if err != nil {
+		return report, err
+	}
+	mu.Lock()
+	index, err := loadChecksums()
+	mu.Unlock()
+	if err != nil {
+		return report, err
+	}
+	cache := map[string]audioPrint{}
+	if data, err := os.ReadFile(fingerprintsPath()); err == nil {
+		if err := json.Unmarshal(data, &cache); err != nil {
+			slog.Warn("fingerprint cache", "err", err)
+			cache = map[string]audioPrint{}
+		}
+	}
+
+	var members []duplicateMember
+	var prints []audioPrint
+	fresh := map[string]audioPrint{}
+	for _, s := range sessions {
+		if s.Audio == "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		p, err := fingerprintAudio(ctx, s.Audio, cache[s.Audio], index[s.Audio])
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", s.Audio, err))
+			if p.SHA256 == "" {
+				continue
+			}
+		}
+		fresh[s.Audio] = p
+		members = append(members, duplicateMember{ID: s.ID, Audio: s.Audio, Size: p.Size, Duration: p.Duration, RecordedAt: s.RecordedAt, Transcript: s.hasTranscript()})
+		prints = append(prints, p)
+	}
+	report.Scanned = len(members)
+	if data, err := json.MarshalIndent(fresh, "", "  "); err == nil {
+		if err := os.MkdirAll(stateDir(), 0o755); err == nil {
+			_, err = writeFileAtomic(fingerprintsPath(), strings.NewReader(string(data)+"\n"))
+		}
+		if err != nil {
+			slog.Warn("fingerprint cache", "err", err)
+		}
+	}
+
+	report.Clusters = clusterDuplicates(members, prints)
+	for _, c := range report.Clusters {
+		report.Reclaimable += c.Reclaimable
+	}
+	return report, nil
+}
+
+// fingerprintAudio returns the print of the audio at rel, reusing cached
+// when the file is unchanged. A print without an envelope (ffmpeg failed)
+// still takes part in exact matching and is returned with the error.
+func fingerprintAudio(ctx context.Context, rel string, cached audioPrint, sum fileChecksum) (audioPrint, error) {
+	full := absPath(rel)
+	info, err := os.Stat(full)
+	if err != nil {
+		return audioPrint{}, err
+	}
+	p := audioPrint{Size: info.Size(), ModTime: info.ModTime().UTC()}
+	if cached.Size == p.Size && cached.ModTime.Equal(p.ModTime) && cached.SHA256 != "" && len(cached.Envelope) > 0 {
+		return cached, nil
+	}
+	if sum.Size == p.Size && sum.ModTime.Equal(p.ModTime) {
+		p.SHA256 = sum.SHA256
+	} else if p.SHA256, err = hashFile(full); err != nil {
+		return audioPrint{}, err
+	}
+	if d, err := probeDuration(full); err == nil {
+		p.Duration = d.Seconds()
+	}
+	p.Envelope, err = loudnessEnvelope(ctx, full)
+	return p, err
+}
+
+// loudnessEnvelope decodes fullPath with ffmpeg and returns its level per
+// fingerprintFrame.
+func loudnessEnvelope(ctx context.Context, fullPath string) ([]byte, error) {
+	out, err := runCommandFunc(ctx, cfg().FFmpegPath,
+		"-v", "error", "-nostdin",
+		"-i", fullPath,
+		"-vn", "-ac", "1", "-ar", strconv.Itoa(fingerprintRate),
+		"-f", "s16le", "-",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v", err)
+	}
+	frame := int(fingerprintFrame.Seconds()*fingerprintRate) * 2
+	var env []byte
+	for i := 0; i+frame <= len(out); i += frame {
+		var sum float64
+		for j := i; j < i+frame; j += 2 {
+			v := float64(int16(binary.LittleEndian.Uint16(out[j:])))
+			sum += v * v
+		}
+		db := 20 * math.Log10(math.Sqrt(sum/float64(frame/2))+1)
+		env = append(env, byte(min(255, db*255/91)))
+	}
+	if len(env) == 0 {
+		return nil, errors.New("ffmpeg: no audio decoded")
+	}
+	return env, nil
+}
+
+// envelopeSimilarity is the best correlation of a and b over shifts of up
+// to fingerprintMaxLag frames, counting only shifts that overlap most of
+// the shorter envelope. Flat envelopes, such as silence, match nothing.
+func envelopeSimilarity(a, b []byte) float64 {
+	best := 0.0
+	need := min(len(a), len(b)) * 4 / 5
+	for lag := -fingerprintMaxLag; lag <= fingerprintMaxLag; lag++ {
+		var x, y []byte
+		if lag >= 0 {
+			x, y = a[min(lag, len(a)):], b
+		} else {
+			x, y = a, b[min(-lag, len(b)):]
+		}
+		n := min(len(x), len(y))
+		if n < 2 || n < need {
+			continue
+		}
+		best = max(best, correlation(x[:n], y[:n]))
+	}
+	return best
+}
+
+// correlation is the Pearson correlation of x and y, or 0 when either is
+// constant.
+func correlation(x, y []byte) float64 {
+	var sx, sy, sxx, syy, sxy float64
+	for i := range x {
+		a, b := float64(x[i]), float64(y[i])
+		sx += a
+		sy += b
+		sxx += a * a
+		syy += b * b
+		sxy += a * b
+	}
+	n := float64(len(x))
+	vx, vy := sxx-sx*sx/n, syy-sy*sy/n
+	if vx <= 0 || vy <= 0 {
+		return 0
+	}
+	return (sxy - sx*sy/n) / math.Sqrt(vx*vy)
+}
+
+// clusterDuplicates links members with identical hashes, or with lengths
+// within nearDuplicateTolerance and similar envelopes, and returns the
+// groups of two or more, largest reclaimable size first.
+func clusterDuplicates(members []duplicateMember, prints []audioPrint) []duplicateCluster {
+	parent := make([]int, len(members))
+	weakest := make([]float64, len(members))
+	for i := range parent {
+		parent[i] = i
+		weakest[i] = 1
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	link := func(i, j int, sim float64) {
+		ri, rj := find(i), find(j)
+		if ri != rj {
+			parent[rj] = ri
+			weakest[ri] = min(weakest[ri], weakest[rj])
+		}
+		weakest[ri] = min(weakest[ri], sim)
+	}
+
+	byHash := map[string]int{}
+	for i, p := range prints {
+		if j, ok := byHash[p.SHA256]; ok {
+			link(j, i, 1)
+		} else {
+			byHash[p.SHA256] = i
+		}
+	}
+	order := make([]int, 0, len(prints))
+	for i, p := range prints {
+		if p.Duration > 0 && len(p.Envelope) > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(a, b int) bool { return prints[order[a]].Duration < prints[order[b]].Duration })
+	for a, i := range order {
+		for _, j := range order[a+1:] {
+			pi, pj := prints[i], prints[j]
+			if pj.Duration-pi.Duration > nearDuplicateTolerance(pi.Duration, pj.Duration) {
+				break
+			}
+			if pi.SHA256 == pj.SHA256 {
+				continue
+			}
+			if sim := envelopeSimilarity(pi.Envelope, pj.Envelope); sim >= nearDuplicateSimilarity {
+				link(i, j, math.Round(sim*1000)/1000)
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	for i := range members {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+	clusters := []duplicateCluster{}
+	for root, idx := range groups {
+		if len(idx) < 2 {
+			continue
+		}
+		c := duplicateCluster{Kind: "exact", Similarity: weakest[root]}
+		var total, largest int64
+		for _, i := range idx {
+			if prints[i].SHA256 != prints[idx[0]].SHA256 {
+				c.Kind = "near"
+			}
+			c.Sessions = append(c.Sessions, members[i])
+			total += members[i].Size
+			largest = max(largest, members[i].Size)
+		}
+		sort.SliceStable(c.Sessions, func(a, b int) bool {
+			if !c.Sessions[a].RecordedAt.Equal(c.Sessions[b].RecordedAt) {
+				return c.Sessions[a].RecordedAt.Before(c.Sessions[b].RecordedAt)
+			}
+			return c.Sessions[a].ID < c.Sessions[b].ID
+		})
+		c.Reclaimable = total - largest
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(a, b int) bool {
+		if clusters[a].Reclaimable != clusters[b].Reclaimable {
+			return clusters[a].Reclaimable > clusters[b].Reclaimable
+		}
+		return clusters[a].Sessions[0].ID < clusters[b].Sessions[0].ID
+	})
+	return clusters
+}
+
+func loadDuplicatesReport() (*duplicatesReport, error) {
+	data, err := os.ReadFile(duplicatesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var report duplicatesReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func saveDuplicatesReport(report duplicatesReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(duplicatesPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// duplicatesHandler serves GET /api/duplicates: the report of the last
+// scan, or of a new one when there is none yet or ?refresh=1 is set.
+func duplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	if !refresh {
+		report, err := loadDuplicatesReport()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if report != nil {
+			writeJSON(w, report)
+			return
+		}
+	}
+	report, err := scanDuplicates(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := saveDuplicatesReport(report); err != nil {
+		requestLogger(r).Error("save duplicates report", "err", err)
+	}
+	writeJSON(w, report)
+}
+
+// runScheduledDuplicates rescans for duplicates and publishes
+// "duplicates.found" when there are any.
+func runScheduledDuplicates(now time.Time) {
+	report, err := scanDuplicates(context.Background())
+	if err != nil {
+		slog.Error("duplicates", "err", err)
+		return
+	}
+	if err := saveDuplicatesReport(report); err != nil {
+		slog.Error("duplicates", "err", err)
+	}
+	if len(report.Clusters) > 0 {
+		slog.Info("duplicates found", "clusters", len(report.Clusters), "bytes", report.Reclaimable)
+		publishEvent("duplicates.found", "", map[string]any{"clusters": len(report.Clusters), "reclaimable": report.Reclaimable})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pcmLevels returns mono s16le audio with one fingerprint frame per level.
+func pcmLevels(levels ...int) []byte {
+	frame := int(fingerprintFrame.Seconds() * fingerprintRate)
+	out := make([]byte, 0, len(levels)*frame*2)
+	for _, l := range levels {
+		for i := 0; i < frame; i++ {
+			v := int16(l)
+			if i%2 == 1 {
+				v = -v
+			}
+			out = binary.LittleEndian.AppendUint16(out, uint16(v))
+		}
+	}
+	return out
+}
+
+// fakeAudioTools answers ffprobe with durations and ffmpeg with pcm, both
+// keyed by file name, and counts the decodes.
+func fakeAudioTools(t *testing.T, durations map[string]string, pcm map[string][]byte) *int {
+	t.Helper()
+	decodes := 0
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name == cfg().FFprobePath {
+			return []byte(durations[filepath.Base(args[len(args)-1])] + "\n"), nil
+		}
+		file := filepath.Base(args[slices.Index(args, "-i")+1])
+		decodes++
+		if data, ok := pcm[file]; ok {
+			return data, nil
+		}
+		return []byte("invalid data"), errors.New("exit status 1")
+	})
+	return &decodes
+}
+
+func TestScanDuplicatesClustersExactAndNearCopies(t *testing.T) {
+	dir := useTempBaseDir(t)
+	speech := []int{100, 3000, 8000, 200, 5000, 12000, 50, 7000, 900, 4000, 16000, 300, 2500, 9000, 60, 6000}
+	shifted := append([]int{40, 40}, speech[:len(speech)-2]...)
+	other := slices.Clone(speech)
+	slices.Reverse(other)
+	files := map[string]string{
+		"2024-05-01_10-00-00.webm": "same bytes",
+		"2024-05-01_10-00-01.webm": "same bytes",
+		"2024-05-02_09-00-00.webm": "first capture",
+		"2024-05-02_09-00-02.webm": "second capture, re-encoded",
+		"2024-05-03_09-00-00.webm": "another talk",
+		"2024-05-04_09-00-00.webm": "a longer talk",
+	}
+	// Start times come from the modification times, in name order.
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for name, body := range files {
+		full := filepath.Join(dir, name)
+		if err := os.WriteFile(full, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		at, _ := time.Parse("2006-01-02_15-04-05", strings.TrimSuffix(name, ".webm"))
+		if err := os.Chtimes(full, at, at); err != nil || at.Before(start) {
+			t.Fatalf("chtimes %s: %v", name, err)
+		}
+	}
+	decodes := fakeAudioTools(t, map[string]string{
+		"2024-05-01_10-00-00.webm": "30",
+		"2024-05-01_10-00-01.webm": "30",
+		"2024-05-02_09-00-00.webm": "8",
+		"2024-05-02_09-00-02.webm": "8.4",
+		"2024-05-03_09-00-00.webm": "8",
+		"2024-05-04_09-00-00.webm": "60",
+	}, map[string][]byte{
+		"2024-05-01_10-00-00.webm": pcmLevels(speech...),
+		"2024-05-01_10-00-01.webm": pcmLevels(speech...),
+		"2024-05-02_09-00-00.webm": pcmLevels(speech...),
+		"2024-05-02_09-00-02.webm": pcmLevels(shifted...),
+		"2024-05-03_09-00-00.webm": pcmLevels(other...),
+		"2024-05-04_09-00-00.webm": pcmLevels(speech...),
+	})
+
+	report, err := scanDuplicates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 6 || len(report.Clusters) != 2 || len(report.Errors) != 0 {
+		t.Fatalf("report=%+v", report)
+	}
+	byKind := map[string]duplicateCluster{}
+	for _, c := range report.Clusters {
+		byKind[c.Kind] = c
+	}
+	ids := func(c duplicateCluster) []string {
+		var out []string
+		for _, m := range c.Sessions {
+			out = append(out, m.ID)
+		}
+		return out
+	}
+	if got := ids(byKind["exact"]); !slices.Equal(got, []string{"2024-05-01_10-00-00", "2024-05-01_10-00-01"}) || byKind["exact"].Similarity != 1 || byKind["exact"].Reclaimable != 10 {
+		t.Fatalf("exact=%+v", byKind["exact"])
+	}
+	near := byKind["near"]
+	if got := ids(near); !slices.Equal(got, []string{"2024-05-02_09-00-00", "2024-05-02_09-00-02"}) || near.Similarity < nearDuplicateSimilarity || near.Reclaimable != int64(len("first capture")) {
+		t.Fatalf("near=%+v", near)
+	}
+	if report.Reclaimable != 10+int64(len("first capture")) {
+		t.Fatalf("reclaimable=%d", report.Reclaimable)
+	}
+
+	// Unchanged files reuse their cached fingerprints.
+	*decodes = 0
+	if _, err := scanDuplicates(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if *decodes != 0 {
+		t.Fatalf("rescan decoded %d files", *decodes)
+	}
+}
+
+func TestScanDuplicatesKeepsExactMatchesWhenDecodingFails(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "talk.webm")
+	for _, name := range []string{"copy-1.webm", "copy-2.webm"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("broken"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeAudioTools(t, map[string]string{}, map[string][]byte{})
+	report, err := scanDuplicates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 3 || len(report.Clusters) != 1 || report.Clusters[0].Kind != "exact" || len(report.Clusters[0].Sessions) != 2 {
+		t.Fatalf("report=%+v", report)
+	}
+}
+
+func TestEnvelopeSimilarity(t *testing.T) {
+	a := []byte{10, 80, 20, 90, 15, 70, 30, 85, 5, 60}
+	if sim := envelopeSimilarity(a, a); sim < 0.999 {
+		t.Fatalf("identical=%v", sim)
+	}
+	shifted := append([]byte{0}, a[:len(a)-1]...)
+	if sim := envelopeSimilarity(a, shifted); sim < 0.999 {
+		t.Fatalf("shifted=%v", sim)
+	}
+	flat := []byte{50, 50, 50, 50, 50, 50, 50, 50, 50, 50}
+	if sim := envelopeSimilarity(flat, flat); sim != 0 {
+		t.Fatalf("silence=%v", sim)
+	}
+}
+
+func TestDuplicatesHandlerServesLastReport(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "talk.webm")
+	fakeAudioTools(t, map[string]string{"talk.webm": "1"}, map[string][]byte{"talk.webm": pcmLevels(100, 2000)})
+
+	get := func(target string) duplicatesReport {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		duplicatesHandler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", target, rec.Code, rec.Body)
+		}
+		var report duplicatesReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	first := get("/api/duplicates")
+	if first.Scanned != 1 || first.Clusters == nil {
+		t.Fatalf("first=%+v", first)
+	}
+	writeTestFiles(t, dir, "other.webm")
+	if again := get("/api/duplicates"); again.Scanned != 1 || !again.ScannedAt.Equal(first.ScannedAt) {
+		t.Fatalf("cached=%+v", again)
+	}
+	if fresh := get("/api/duplicates?refresh=1"); fresh.Scanned != 2 {
+		t.Fatalf("refresh=%+v", fresh)
+	}
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNoHeaderDuration is a recording whose container does not say how
+// long it is, such as an MP3 or a WebM capture MediaRecorder never
+// finalized; ffprobe has to work it out.
+var errNoHeaderDuration = errors.New("no duration in the container headers")
+
+// headerDuration reads the duration of the audio at fullPath from its
+// container's headers, which takes a few small reads where ffprobe would
+// take a process.
+func headerDuration(fullPath string) (time.Duration, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	var secs float64
+	switch strings.ToLower(filepath.Ext(fullPath)) {
+	case ".wav":
+		secs, err = wavDuration(f, info.Size())
+	case ".flac":
+		secs, err = flacDuration(f)
+	case ".m4a", ".mp4":
+		secs, err = mp4Duration(f, info.Size())
+	case ".webm":
+		secs, err = webmDuration(f)
+	case ".ogg", ".opus":
+		secs, err = oggDuration(f, info.Size())
+	default:
+		err = errNoHeaderDuration
+	}
+	if err != nil {
+		return 0, err
+	}
+	if secs <= 0 || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, errNoHeaderDuration
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// readAtMost reads up to n bytes of f from off, fewer at its end.
+func readAtMost(f *os.File, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	got, err := f.ReadAt(b, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return b[:got], nil
+}
+
+// wavDuration divides the size of a WAV file's data chunk by its byte
+// rate. A data chunk whose size was never filled in runs to the end.
+func wavDuration(f *os.File, size int64) (float64, error) {
+	var byteRate uint32
+	for off := int64(12); off+8 <= size; {
+		hdr, err := readAtMost(f, off, 8)
+		if err != nil || len(hdr) < 8 {
+			return 0, errNoHeaderDuration
+		}
+		chunk := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		switch string(hdr[:4]) {
+		case "fmt ":
+			b, err := readAtMost(f, off+8+8, 4)
+			if err != nil || len(b) < 4 {
+				return 0, errNoHeaderDuration
+			}
+			byteRate = binary.LittleEndian.Uint32(b)
+		case "data":
+			if byteRate == 0 {
+				return 0, errNoHeaderDuration
+			}
+			if chunk == 0 || chunk == math.MaxUint32 || off+8+chunk > size {
+				chunk = size - off - 8
+			}
+			return float64(chunk) / float64(byteRate), nil
+		}
+		off += 8 + chunk + chunk%2
+	}
+	return 0, errNoHeaderDuration
+}
+
+// flacDuration divides the sample count in a FLAC file's STREAMINFO block
+// by its sample rate, past an ID3 tag some taggers put first.
+func flacDuration(f *os.File) (float64, error) {
+	off := int64(0)
+	head, err := readAtMost(f, 0, 10)
+	if err != nil {
+		return 0, err
+	}
+	if len(head) == 10 && string(head[:3]) == "ID3" {
+		off = 10 + (int64(head[6])<<21 | int64(head[7])<<14 | int64(head[8])<<7 | int64(head[9]))
+	}
+	b, err := readAtMost(f, off, 4+4+18)
+	if err != nil || len(b) < 26 || string(b[:4]) != "fLaC" || b[4]&0x7f != 0 {
+		return 0, errNoHeaderDuration
+	}
+	info := b[8+10:]
+	rate := uint32(info[0])<<12 | uint32(info[1])<<4 | uint32(info[2])>>4
+	samples := uint64(info[3]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(info[4:8]))
+	if rate == 0 || samples == 0 {
+		return 0, errNoHeaderDuration
+	}
+	return float64(samples) / float64(rate), nil
+}
+
+// mp4Duration reads the duration in the movie header (moov/mvhd) of an
+// MP4 or M4A file, wherever in the file the moov box is.
+func mp4Duration(f *os.File, size int64) (float64, error) {
+	moov, moovSize, err := findMP4Box(f, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, _, err := findMP4Box(f, moov, moov+moovSize, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	b, err := readAtMost(f, mvhd, 32)
+	if err != nil || len(b) < 20 {
+		return 0, errNoHeaderDuration
+	}
+	var scale, dur uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return 0, errNoHeaderDuration
+		}
+		scale, dur = uint64(binary.BigEndian.Uint32(b[20:24])), binary.BigEndian.Uint64(b[24:32])
+	} else {
+		scale, dur = uint64(binary.BigEndian.Uint32(b[12:16])), uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	if scale == 0 {
+		return 0, errNoHeaderDuration
+	}
+	return float64(dur) / float64(scale), nil
+}
+
+// findMP4Box returns where the contents of the first box of type typ
+// between start and end begin, and their size.
+func findMP4Box(f *os.File, start, end int64, typ string) (int64, int64, error) {
+	for off := start; off+8 <= end; {
+		hdr, err := readAtMost(f, off, 16)
+		if err != nil || len(hdr) < 8 {
+			return 0, 0, errNoHeaderDuration
+		}
+		size, hdrLen := int64(binary.BigEndian.Uint32(hdr[:4])), int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if len(hdr) < 16 {
+				return 0, 0, errNoHeaderDuration
+			}
+			size, hdrLen = int64(binary.BigEndian.Uint64(hdr[8:16])), 16
+		}
+		if size < hdrLen {
+			return 0, 0, errNoHeaderDuration
+		}
+		if string(hdr[4:8]) == typ {
+			return off + hdrLen, size - hdrLen, nil
+		}
+		off += size
+	}
+	return 0, 0, errNoHeaderDuration
+}
+
+// EBML element IDs webmDuration looks for.
+const (
+	ebmlHeaderID    = 0x1a45dfa3
+	ebmlSegmentID   = 0x18538067
+	ebmlInfoID      = 0x1549a966
+	ebmlClusterID   = 0x1f43b675
+	ebmlTimescaleID = 0x2ad7b1
+	ebmlDurationID  = 0x4489
+)
+
+// webmHeadSize is how much of a WebM file webmDuration reads; the segment
+// info comes before the first cluster, well within it.
+const webmHeadSize = 64 << 10
+
+// webmDuration reads the Duration of a WebM file's segment info, in units
+// of its TimecodeScale. MediaRecorder leaves it out, as it does not know
+// the length until the recording stops.
+func webmDuration(f *os.File) (float64, error) {
+	b, err := readAtMost(f, 0, webmHeadSize)
+	if err != nil {
+		return 0, err
+	}
+	id, size, n := ebmlElement(b)
+	if id != ebmlHeaderID || n == 0 || size < 0 || int64(len(b)-n) < size {
+		return 0, errNoHeaderDuration
+	}
+	b = b[n+int(size):]
+	if id, _, n = ebmlElement(b); id != ebmlSegmentID || n == 0 {
+		return 0, errNoHeaderDuration
+	}
+	for b = b[n:]; len(b) > 0; {
+		id, size, n := ebmlElement(b)
+		if n == 0 || id == ebmlClusterID || size < 0 || int64(len(b)-n) < size {
+			break
+		}
+		if id != ebmlInfoID {
+			b = b[n+int(size):]
+			continue
+		}
+		scale, dur := 1e6, 0.0
+		for info := b[n : n+int(size)]; len(info) > 0; {
+			cid, csize, cn := ebmlElement(info)
+			if cn == 0 || csize < 0 || int64(len(info)-cn) < csize {
+				break
+			}
+			v := info[cn : cn+int(csize)]
+			switch {
+			case cid == ebmlTimescaleID && len(v) <= 8:
+				var u uint64
+				for _, c := range v {
+					u = u<<8 | uint64(c)
+				}
+				scale = float64(u)
+			case cid == ebmlDurationID && len(v) == 4:
+				dur = float64(math.Float32frombits(binary.BigEndian.Uint32(v)))
+			case cid == ebmlDurationID && len(v) == 8:
+				dur = math.Float64frombits(binary.BigEndian.Uint64(v))
+			}
+			info = info[cn+int(csize):]
+		}
+		if dur <= 0 {
+			break
+		}
+		return dur * scale / 1e9, nil
+	}
+	return 0, errNoHeaderDuration
+}
+
+// ebmlElement parses the ID and data size of the EBML element b starts
+// with, and the length of both; n is 0 when b does not start with one,
+// and size -1 when the size is unknown.
+func ebmlElement(b []byte) (id uint32, size int64, n int) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, 0
+	}
+	idLen := 1
+	for b[0]&(0x80>>(idLen-1)) == 0 {
+		idLen++
+	}
+	if idLen > 4 || len(b) < idLen+1 {
+		return 0, 0, 0
+	}
+	for _, c := range b[:idLen] {
+		id = id<<8 | uint32(c)
+	}
+	s := b[idLen:]
+	if s[0] == 0 {
+		return 0, 0, 0
+	}
+	sizeLen := 1
+	for s[0]&(0x80>>(sizeLen-1)) == 0 {
+		sizeLen++
+	}
+	if len(s) < sizeLen {
+		return 0, 0, 0
+	}
+	v := uint64(s[0] & (0xff >> sizeLen))
+	for _, c := range s[1:sizeLen] {
+		v = v<<8 | uint64(c)
+	}
+	if v == 1<<(7*sizeLen)-1 {
+		return id, -1, idLen + sizeLen
+	}
+	return id, int64(v), idLen + sizeLen
+}
+
+// oggTailSize is how much of the end of an Ogg file oggDuration searches
+// for the last page; pages are at most 64 KiB.
+const oggTailSize = 64 << 10
+
+// oggDuration reads the granule position of the last page of an Ogg Opus
+// or Vorbis file, which counts the samples before its end.
+func oggDuration(f *os.File, size int64) (float64, error) {
+	head, err := readAtMost(f, 0, 4096)
+	if err != nil {
+		return 0, err
+	}
+	var rate float64
+	var preSkip int64
+	if i := bytes.Index(head, []byte("OpusHead")); i >= 0 && len(head) >= i+12 {
+		// Opus counts granules at 48 kHz whatever the input rate.
+		rate, preSkip = 48000, int64(binary.LittleEndian.Uint16(head[i+10:i+12]))
+	} else if i := bytes.Index(head, []byte("\x01vorbis")); i >= 0 && len(head) >= i+16 {
+		rate = float64(binary.LittleEndian.Uint32(head[i+12 : i+16]))
+	}
+	if rate == 0 {
+		return 0, errNoHeaderDuration
+	}
+	off := max(0, size-oggTailSize)
+	tail, err := readAtMost(f, off, int(size-off))
+	if err != nil {
+		return 0, err
+	}
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+14 > len(tail) {
+			continue
+		}
+		// A page on which no packet ends has a granule position of -1.
+		if granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14])); granule >= 0 {
+			return float64(granule-preSkip) / rate, nil
+		}
+	}
+	return 0, errNoHeaderDuration
+}
+
+// indexedDuration is the duration of a recording with the size and
+// modification time its file had when it was read; 0 when its headers do
+// not say and ffprobe has not been asked yet.
+type indexedDuration struct {
+	Seconds float64   `json:"seconds"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// durationsMu guards durations.json.
+var durationsMu sync.Mutex
+
+func durationsPath() string {
+	return filepath.Join(stateDir(), "durations.json")
+}
+
+// loadDurations reads the duration index keyed by recordings path.
+// Callers hold durationsMu.
+func loadDurations() (map[string]indexedDuration, error) {
+	items := map[string]indexedDuration{}
+	data, err := os.ReadFile(durationsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// storeDurations adds found to the index. Entries for files that no longer
+// exist are dropped on the way.
+func storeDurations(found map[string]indexedDuration) error {
+	durationsMu.Lock()
+	defer durationsMu.Unlock()
+	items, err := loadDurations()
+	if err != nil {
+		return err
+	}
+	for rel := range items {
+		if _, err := os.Stat(absPath(rel)); errors.Is(err, os.ErrNotExist) {
+			delete(items, rel)
+		}
+	}
+	for rel, d := range found {
+		items[rel] = d
+	}
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(durationsPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// durationLookup answers the durations of recordings for a listing: from
+// the index while the file is unchanged, else from the container headers.
+// Recordings whose headers do not say are queued for ffprobe, and have a
+// duration in later listings.
+type durationLookup struct {
+	index map[string]indexedDuration
+	found map[string]indexedDuration
+}
+
+func newDurationLookup() *durationLookup {
+	durationsMu.Lock()
+	index, err := loadDurations()
+	durationsMu.Unlock()
+	if err != nil {
+		slog.Warn("load duration index", "err", err)
+	}
+	return &durationLookup{index: index, found: map[string]indexedDuration{}}
+}
+
+// seconds returns the duration of the recording at rel.
+func (l *durationLookup) seconds(rel string) (float64, bool) {
+	info, err := os.Stat(absPath(rel))
+	if err != nil {
+		return 0, false
+	}
+	if d, ok := l.index[rel]; ok && d.Size == info.Size() && d.ModTime.Equal(info.ModTime().UTC()) {
+		if d.Seconds == 0 {
+			queueDurationProbe(rel)
+		}
+		return d.Seconds, d.Seconds > 0
+	}
+	d, err := headerDuration(absPath(rel))
+	// Headers that do not say are remembered too, as 0, so they are not
+	// read again for every listing.
+	l.found[rel] = indexedDuration{Seconds: d.Seconds(), Size: info.Size(), ModTime: info.ModTime().UTC()}
+	if err != nil {
+		queueDurationProbe(rel)
+		return 0, false
+	}
+	return d.Seconds(), true
+}
+
+// total returns the combined duration of the recordings at rels, such as
+// the parts of a split recording, when all of them are known.
+func (l *durationLookup) total(rels []string) (float64, bool) {
+	sum := 0.0
+	for _, rel := range rels {
+		secs, ok := l.seconds(rel)
+		if !ok {
+			return 0, false
+		}
+		sum += secs
+	}
+	return sum, len(rels) > 0
+}
+
+// save adds the durations read from headers to the index.
+func (l *durationLookup) save() {
+	if len(l.found) == 0 {
+		return
+	}
+	if err := storeDurations(l.found); err != nil {
+		slog.Warn("save duration index", "err", err)
+	}
+	l.found = map[string]indexedDuration{}
+}
+
+// recordingDuration returns the length of the audio at rel, from the
+// index, the container headers or, failing those, ffprobe, indexing it.
+func recordingDuration(rel string) (time.Duration, error) {
+	l := newDurationLookup()
+	if secs, ok := l.seconds(rel); ok {
+		l.save()
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	info, err := os.Stat(absPath(rel))
+	if err != nil {
+		return 0, err
+	}
+	d, err := probeDuration(absPath(rel))
+	if err != nil {
+		return 0, err
+	}
+	err = storeDurations(map[string]indexedDuration{rel: {Seconds: d.Seconds(), Size: info.Size(), ModTime: info.ModTime().UTC()}})
+	if err != nil {
+		slog.Warn("save duration index", "err", err)
+	}
+	return d, nil
+}
+
+// durationProbes feeds the recordings whose headers do not say how long
+// they are to ffprobe, one at a time; nil until startDurationIndexer runs,
+// so listings outside the server leave them be.
+var durationProbes struct {
+	sync.Mutex
+	queue   chan string
+	pending map[string]bool
+}
+
+// queueDurationProbe asks for the duration of rel to be indexed with
+// ffprobe, unless it already is queued or the queue is full.
+func queueDurationProbe(rel string) {
+	durationProbes.Lock()
+	defer durationProbes.Unlock()
+	if durationProbes.queue == nil || durationProbes.pending[rel] {
+		return
+	}
+	select {
+	case durationProbes.queue <- rel:
+		durationProbes.pending[rel] = true
+	default:
+	}
+}
+
+// startDurationIndexer probes the durations listings queue until ctx is
+// done.
+func startDurationIndexer(ctx context.Context) {
+	queue := make(chan string, 1024)
+	durationProbes.Lock()
+	durationProbes.queue, durationProbes.pending = queue, map[string]bool{}
+	durationProbes.Unlock()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case rel := <-queue:
+				if _, err := recordingDuration(rel); err != nil {
+					slog.Debug("probe duration", "path", rel, "err", err)
+				}
+				durationProbes.Lock()
+				delete(durationProbes.pending, rel)
+				durationProbes.Unlock()
+			}
+		}
+	}()
+}
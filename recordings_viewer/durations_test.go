@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func le16(v uint16) string { return string(binary.LittleEndian.AppendUint16(nil, v)) }
+func le32(v uint32) string { return string(binary.LittleEndian.AppendUint32(nil, v)) }
+func le64(v uint64) string { return string(binary.LittleEndian.AppendUint64(nil, v)) }
+func be32(v uint32) string { return string(binary.BigEndian.AppendUint32(nil, v)) }
+func be64(v uint64) string { return string(binary.BigEndian.AppendUint64(nil, v)) }
+
+// durationFixtures are the smallest files of each kind headerDuration
+// reads, with the length they say they have.
+var durationFixtures = map[string]struct {
+	body string
+	want time.Duration
+}{
+	// 16-bit mono at 8 kHz: 16000 bytes a second.
+	"call.wav": {"RIFF" + le32(36+32000) + "WAVE" + "fmt " + le32(16) + le16(1) + le16(1) + le32(8000) + le32(16000) + le16(2) + le16(16) +
+		"data" + le32(32000) + strings.Repeat("\x00", 32000), 2 * time.Second},
+	// 3 seconds at 44.1 kHz, stereo, 16 bits.
+	"call.flac": {"fLaC" + "\x80\x00\x00\x22" + "\x10\x00\x10\x00\x00\x00\x00\x00\x00\x00" +
+		be64(44100<<44|1<<41|15<<36|44100*3) + strings.Repeat("\x00", 16), 3 * time.Second},
+	// moov after mdat, as most encoders write it: 2500 ms.
+	"call.m4a": {be32(16) + "ftypM4A " + be32(0) + be32(12) + "mdat" + "\x00\x00\x00\x00" +
+		be32(8+8+100) + "moov" + be32(8+100) + "mvhd" + "\x00\x00\x00\x00" + be32(0) + be32(0) + be32(1000) + be32(2500) + strings.Repeat("\x00", 80), 2500 * time.Millisecond},
+	// An EBML header, a segment of unknown size and its info: 4000 ms.
+	"call.webm": {"\x1a\x45\xdf\xa3\x80" + "\x18\x53\x80\x67\x01\xff\xff\xff\xff\xff\xff\xff" +
+		"\x15\x49\xa9\x66\x92" + "\x2a\xd7\xb1\x83\x0f\x42\x40" + "\x44\x89\x88" + be64(math.Float64bits(4000)) +
+		"\x1f\x43\xb6\x75\x80", 4 * time.Second},
+	// Opus with a pre-skip of 312, its last page 5 seconds in, and a
+	// page after it on which no packet ends.
+	"call.ogg": {"OggS\x00\x02" + le64(0) + strings.Repeat("\x00", 12) + "\x01\x13" + "OpusHead\x01\x01" + le16(312) + le32(48000) + "\x00\x00\x00" +
+		"OggS\x00\x00" + le64(48000*5+312) + strings.Repeat("\x00", 12) + "\x00" +
+		"OggS\x00\x04" + le64(math.MaxUint64) + strings.Repeat("\x00", 12) + "\x00", 5 * time.Second},
+}
+
+func TestHeaderDuration(t *testing.T) {
+	dir := t.TempDir()
+	for name, f := range durationFixtures {
+		full := filepath.Join(dir, name)
+		os.WriteFile(full, []byte(f.body), 0o644)
+		if got, err := headerDuration(full); err != nil || got != f.want {
+			t.Errorf("%s = %v, %v; want %v", name, got, err, f.want)
+		}
+	}
+	// What MediaRecorder writes: segment info without a duration.
+	os.WriteFile(filepath.Join(dir, "capture.webm"), []byte("\x1a\x45\xdf\xa3\x80"+"\x18\x53\x80\x67\x01\xff\xff\xff\xff\xff\xff\xff"+
+		"\x15\x49\xa9\x66\x87"+"\x2a\xd7\xb1\x83\x0f\x42\x40"+"\x1f\x43\xb6\x75\x80"), 0o644)
+	os.WriteFile(filepath.Join(dir, "talk.mp3"), []byte("ID3"), 0o644)
+	for _, name := range []string{"capture.webm", "talk.mp3"} {
+		if d, err := headerDuration(filepath.Join(dir, name)); err != errNoHeaderDuration {
+			t.Errorf("%s = %v, %v", name, d, err)
+		}
+	}
+}
+
+func TestSessionDurations(t *testing.T) {
+	dir := useTempBaseDir(t)
+	os.WriteFile(filepath.Join(dir, "call.wav"), []byte(durationFixtures["call.wav"].body), 0o644)
+	os.WriteFile(filepath.Join(dir, "long.part000.ogg"), []byte(durationFixtures["call.ogg"].body), 0o644)
+	os.WriteFile(filepath.Join(dir, "long.part001.ogg"), []byte(durationFixtures["call.ogg"].body), 0o644)
+	writeTestFiles(t, dir, "talk.mp3")
+	probes := 0
+	useConfig(t, func(c *config) { c.FFprobePath = "ffprobe" })
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		probes++
+		return []byte("61.5\n"), nil
+	})
+
+	sessions, err := scanSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, s := range sessions {
+		got[s.ID] = s.Duration
+	}
+	if got["call"] != 2 || got["long"] != 10 || got["talk"] != 0 || probes != 0 {
+		t.Fatalf("durations = %v after %d probes", got, probes)
+	}
+
+	// What the headers do not say ffprobe works out, once.
+	for range 2 {
+		if d, err := recordingDuration("talk.mp3"); err != nil || d != 61500*time.Millisecond {
+			t.Fatalf("talk.mp3 = %v, %v", d, err)
+		}
+	}
+	sessions, _ = scanSessions()
+	for _, s := range sessions {
+		if s.ID == "talk" && s.Duration != 61.5 {
+			t.Fatalf("talk = %v", s.Duration)
+		}
+	}
+	if probes != 1 {
+		t.Fatalf("probed %d times", probes)
+	}
+	index, _ := loadDurations()
+	if index["call.wav"].Seconds != 2 || index["talk.mp3"].Seconds != 61.5 {
+		t.Fatalf("index = %v", index)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// enhanceFilters is the ffmpeg audio filter chain that cleans up speech:
+// a highpass against rumble and hum, noise reduction (RNNoise when a model
+// is configured, else ffmpeg's FFT denoiser) and EBU R128 loudness
+// normalization, which lifts quiet speakers in tab captures.
+func enhanceFilters() string {
+	var filters []string
+	if cfg().EnhanceHighpass > 0 {
+		filters = append(filters, fmt.Sprintf("highpass=f=%d", cfg().EnhanceHighpass))
+	}
+	if cfg().RNNoiseModel != "" {
+		filters = append(filters, "arnndn=m="+filterQuote(cfg().RNNoiseModel))
+	} else {
+		filters = append(filters, "afftdn")
+	}
+	return strings.Join(append(filters, "loudnorm=I=-16:TP=-1.5:LRA=11"), ",")
+}
+
+// filterQuote quotes a filter option value, such as a Windows path with a
+// drive colon, for ffmpeg's filtergraph syntax.
+func filterQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// enhancedPath is where the cleaned copy of the audio at rel is kept: next
+// to it as <stem>.enhanced.flac, lossless and paired with the recording.
+func enhancedPath(rel string) string {
+	return pathJoinRel(path.Dir(rel), recordingStem(path.Base(rel))+"."+artifactEnhanced+".flac")
+}
+
+// enhance runs an "enhance" job, writing the cleaned copy of the recording
+// at j.Path.
+func enhance(ctx context.Context, j job) ([]string, error) {
+	audio := absPath(j.Path)
+	outDir := filepath.Join(tempDir(), "job-"+j.ID)
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outDir)
+	tmp := filepath.Join(outDir, "enhanced.flac")
+	if out, err := runCommandFunc(ctx, cfg().FFmpegPath, "-hide_banner", "-loglevel", "error", "-y",
+		"-i", audio, "-vn", "-af", enhanceFilters(), "-ar", "48000", tmp); err != nil {
+		return nil, &jobDiagnostics{msg: fmt.Sprintf("enhance audio: %v", err), detail: outputTail(out)}
+	}
+	f, err := os.Open(tmp)
+	if err != nil {
+		return nil, &jobDiagnostics{msg: "ffmpeg produced no audio"}
+	}
+	defer f.Close()
+	rel := enhancedPath(j.Path)
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := writeFileAtomic(absPath(rel), f); err != nil {
+		return nil, err
+	}
+	return []string{rel}, nil
+}
+
+// queueEnhanceJob queues an "enhance" job for the audio at rel unless one
+// is already pending.
+func queueEnhanceJob(rel string) (*job, error) {
+	if jobs.pending("enhance", rel) {
+		return nil, errors.New("already being enhanced")
+	}
+	j := &job{ID: randomID(), Type: "enhance", Path: rel, Priority: priorityInteractive, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path)
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+	return j, nil
+}
+
+// recordingsAPIHandler routes /api/recordings/{id}/stream,
+// /api/recordings/{id}/enhance, /estimate, /waveform and /spectrogram.
+func recordingsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/recordings/")
+	if id, ok := strings.CutSuffix(rest, "/enhance"); ok && id != "" {
+		enhanceHandler(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(rest, "/estimate"); ok && id != "" {
+		transcribeEstimateHandler(w, r, id)
+		return
+	}
+	for _, kind := range []string{artifactWaveform, artifactSpectrogram} {
+		if id, ok := strings.CutSuffix(rest, "/"+kind); ok && id != "" {
+			previewHandler(w, r, id, kind)
+			return
+		}
+	}
+	recordingStreamHandler(w, r)
+}
+
+// enhanceHandler serves POST /api/recordings/{id}/enhance, queueing a job
+// that writes a cleaned copy of the session's audio (see enhanceFilters)
+// next to it. The copy is listed as the session's "enhanced" artifact.
+func enhanceHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, err := findSession(id)
+	if err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	if s.Audio == "" {
+		http.Error(w, "recording has no audio", http.StatusNotFound)
+		return
+	}
+	j, err := queueEnhanceJob(s.Audio)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSONStatus(w, http.StatusAccepted, j)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnhanceWritesCleanedCopy(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	writeTestFiles(t, dir, "2024/call.webm", "2024/call.txt")
+	var filters string
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != cfg().FFmpegPath {
+			t.Fatalf("unexpected command %s", name)
+		}
+		filters = argAfter(args, "-af")
+		return nil, os.WriteFile(args[len(args)-1], []byte("clean"), 0o644)
+	})
+	post := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/recordings/2024/call/enhance", nil))
+		return rec
+	}
+
+	if rec := post(); rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"type":"enhance"`) {
+		t.Fatalf("enhance: %d %s", rec.Code, rec.Body)
+	}
+	if rec := post(); rec.Code != http.StatusConflict {
+		t.Fatalf("while pending: %d", rec.Code)
+	}
+	j, _ := jobs.claim()
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted || got.Output[0] != "2024/call.enhanced.flac" {
+		t.Fatalf("job=%+v", got)
+	}
+	if filters != "highpass=f=80,afftdn,loudnorm=I=-16:TP=-1.5:LRA=11" {
+		t.Fatalf("filters=%q", filters)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "2024/call.enhanced.flac")); string(data) != "clean" {
+		t.Fatalf("enhanced copy=%q", data)
+	}
+	// The copy belongs to the recording without replacing its audio.
+	s, err := findSession("2024/call")
+	if err != nil || s.Audio != "2024/call.webm" || !slices.Contains(s.Files, "2024/call.enhanced.flac") {
+		t.Fatalf("session=%+v err=%v", s, err)
+	}
+
+	if rec := post(); rec.Code != http.StatusAccepted {
+		t.Fatalf("again: %d", rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/recordings/nope/enhance", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing recording: %d", rec.Code)
+	}
+}
+
+func TestTranscribeEnhancesAudioFirst(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	useConfig(t, func(c *config) { c.RNNoiseModel = `C:\models\sh.rnnn`; c.EnhanceHighpass = 0 })
+	writeTestFiles(t, dir, "quiet.webm")
+	var filters, input string
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ffprobe":
+			return []byte("30"), nil
+		case cfg().FFmpegPath:
+			filters = argAfter(args, "-af")
+			return nil, os.WriteFile(args[len(args)-1], nil, 0o644)
+		case "whisper":
+			input = args[0]
+			out := argAfter(args, "--output_dir")
+			return nil, os.WriteFile(filepath.Join(out, "quiet.json"), []byte(`{"text":" hi","segments":[]}`), 0o644)
+		}
+		t.Fatalf("unexpected command %s", name)
+		return nil, nil
+	})
+
+	rec := httptest.NewRecorder()
+	transcribeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path":"quiet.webm","enhance":true}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("queue: %d %s", rec.Code, rec.Body)
+	}
+	j, _ := jobs.claim()
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted {
+		t.Fatalf("job=%+v", got)
+	}
+	if filters != `arnndn=m='C:\models\sh.rnnn',loudnorm=I=-16:TP=-1.5:LRA=11` || filepath.Ext(input) != ".wav" {
+		t.Fatalf("filters=%q input=%q", filters, input)
+	}
+	meta, err := loadMeta(filepath.Join(dir, "quiet.json"))
+	if err != nil || meta.Transcription == nil || !meta.Transcription.Enhanced {
+		t.Fatalf("meta=%+v err=%v", meta, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+)
+
+// lookPath finds a binary on PATH. Tests replace it.
+var lookPath = exec.LookPath
+
+// binaryStatus is whether a tool the server runs was found. Command is the
+// name or path it is configured as, Path where it was found.
+type binaryStatus struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Found   bool   `json:"found"`
+	Path    string `json:"path,omitempty"`
+}
+
+// environmentBinaries looks up ffmpeg, ffprobe, each engine's binary and
+// yt-dlp, which the extension's setup offers for importing from video
+// sites.
+func environmentBinaries() []binaryStatus {
+	tools := [][2]string{{"ffmpeg", cfg().FFmpegPath}, {"ffprobe", cfg().FFprobePath}}
+	engines := make([]string, 0, len(cfg().Engines))
+	for name := range cfg().Engines {
+		engines = append(engines, name)
+	}
+	sort.Strings(engines)
+	for _, name := range engines {
+		tools = append(tools, [2]string{name, cfg().Engines[name].Binary})
+	}
+	tools = append(tools, [2]string{"yt-dlp", "yt-dlp"})
+	out := make([]binaryStatus, 0, len(tools))
+	for _, t := range tools {
+		b := binaryStatus{Name: t[0], Command: t[1]}
+		if full, err := lookPath(t[1]); err == nil {
+			b.Found, b.Path = true, full
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// environmentPaths are the folders a setup screen suggests or shows: where
+// recordings and the server's state are kept, the per-user config folder,
+// and the user's Downloads folder, where Chrome saves recordings by
+// default.
+func environmentPaths() map[string]string {
+	paths := map[string]string{
+		"recordings": baseDir,
+		"state":      stateDir(),
+		"config":     secretsDir(),
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths["home"] = home
+		paths["downloads"] = filepath.Join(home, "Downloads")
+	}
+	return paths
+}
+
+// environmentHandler serves GET /api/environment, what a setup screen needs
+// to preconfigure this machine: the OS, the binaries found, whether a GPU
+// can speed up transcription, the device and model jobs use, and default
+// paths. ?refresh=true probes for accelerators again.
+func environmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	accels, _ := detectAccelerators(refresh)
+	gpu := false
+	for _, a := range accels {
+		gpu = gpu || a.Kind == "cuda" || a.Kind == "metal"
+	}
+	device, _ := whisperDevice()
+	writeJSON(w, map[string]any{
+		"os":           hostOS,
+		"arch":         hostArch,
+		"cpus":         runtime.NumCPU(),
+		"binaries":     environmentBinaries(),
+		"gpu":          gpu,
+		"accelerators": accels,
+		"defaults": map[string]any{
+			"engine": cfg().DefaultEngine,
+			"model":  cfg().DefaultModel,
+			"device": device,
+			"paths":  environmentPaths(),
+		},
+	})
+}
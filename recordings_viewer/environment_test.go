@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+)
+
+func TestEnvironmentReportsSetup(t *testing.T) {
+	useTempBaseDir(t)
+	useHost(t, "linux", "amd64", []string{"NVIDIA RTX A2000"})
+	orig := lookPath
+	t.Cleanup(func() { lookPath = orig })
+	lookPath = func(bin string) (string, error) {
+		if bin == "yt-dlp" {
+			return "", exec.ErrNotFound
+		}
+		return "/usr/bin/" + bin, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/environment", nil))
+	var res struct {
+		OS       string         `json:"os"`
+		Binaries []binaryStatus `json:"binaries"`
+		GPU      bool           `json:"gpu"`
+		Defaults struct {
+			Device string            `json:"device"`
+			Paths  map[string]string `json:"paths"`
+		} `json:"defaults"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status=%d err=%v", rec.Code, err)
+	}
+	if res.OS != "linux" || !res.GPU || res.Defaults.Device != "cuda" || res.Defaults.Paths["recordings"] != baseDir {
+		t.Fatalf("res=%+v", res)
+	}
+	found := map[string]bool{}
+	for _, b := range res.Binaries {
+		found[b.Name] = b.Found
+	}
+	if !found["ffmpeg"] || !found["whisper"] || found["yt-dlp"] {
+		t.Fatalf("binaries=%+v", res.Binaries)
+	}
+
+	useHost(t, "windows", "amd64", nil)
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/environment", nil))
+	res.GPU = true
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if res.GPU || res.Defaults.Device != "cpu" {
+		t.Fatalf("without a GPU: %s", rec.Body)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// serverEvent is a single entry in the persisted event log. Seq increases
+// monotonically so reconnecting clients can ask for everything after the
+// last sequence number they saw.
+type serverEvent struct {
+	Seq  int64          `json:"seq"`
+	Type string         `json:"type"`
+	Time time.Time      `json:"time"`
+	Path string         `json:"path,omitempty"`
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// eventLog appends events to events.jsonl in the state directory and fans
+// them out to live subscribers. The latest cfg.EventLogMax events are also
+// kept in recent, which replays are served from; the file is read only when
+// its location changes, and rewritten with just those events once it holds
+// twice as many.
+type eventLog struct {
+	mu      sync.Mutex
+	path    string
+	lastSeq int64
+	recent  []serverEvent
+	lines   int
+	subs    map[chan serverEvent]struct{}
+}
+
+var events = &eventLog{subs: map[chan serverEvent]struct{}{}}
+
+func eventLogPath() string {
+	return filepath.Join(stateDir(), "events.jsonl")
+}
+
+// publishEvent records an event and notifies subscribers. Failures to persist
+// are logged rather than surfaced, since events are advisory.
+func publishEvent(typ, path string, data map[string]any) serverEvent {
+	return events.publish(typ, path, data)
+}
+
+func (l *eventLog) publish(typ, path string, data map[string]any) serverEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncPath()
+
+	l.lastSeq++
+	ev := serverEvent{Seq: l.lastSeq, Type: typ, Time: time.Now().UTC(), Path: path, Data: data}
+	l.recent = append(l.recent, ev)
+	if n := len(l.recent) - eventLogMax(); n > 0 {
+		l.recent = append(l.recent[:0:0], l.recent[n:]...)
+	}
+	if err := appendEvent(l.path, ev); err != nil {
+		slog.Error("persist event", "type", typ, "err", err)
+	}
+	if l.lines++; l.lines > 2*eventLogMax() {
+		l.compact()
+	}
+	for ch := range l.subs {
+		select {
+		case ch <- ev:
+		default:
+			// A subscriber that fell behind is dropped rather than
+			// silently skipped: its channel is closed, so it catches up
+			// from since (see follow), and SSE clients reconnect with
+			// Last-Event-ID.
+			close(ch)
+			delete(l.subs, ch)
+		}
+	}
+	return ev
+}
+
+// syncPath reloads the last sequence number when the log location changed,
+// e.g. after baseDir was reconfigured. Callers must hold l.mu.
+func (l *eventLog) syncPath() {
+	path := eventLogPath()
+	if path == l.path {
+		return
+	}
+	l.path = path
+	l.lastSeq = 0
+	evs, err := readEventsSince(path, 0)
+	if err != nil {
+		slog.Error("read event log", "path", path, "err", err)
+	}
+	if n := len(evs); n > 0 {
+		l.lastSeq = evs[n-1].Seq
+	}
+	l.lines = len(evs)
+	if n := len(evs) - eventLogMax(); n > 0 {
+		evs = evs[n:]
+	}
+	l.recent = evs
+	if l.lines > len(l.recent) {
+		l.compact()
+	}
+}
+
+// compact rewrites the log file with only the events in l.recent. Callers
+// must hold l.mu.
+func (l *eventLog) compact() {
+	var buf bytes.Buffer
+	for _, ev := range l.recent {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			continue
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if _, err := writeFileAtomic(l.path, &buf); err != nil {
+		slog.Error("compact event log", "path", l.path, "err", err)
+		return
+	}
+	l.lines = len(l.recent)
+}
+
+// eventLogMax is how many events the log keeps.
+func eventLogMax() int {
+	return max(cfg().EventLogMax, 1)
+}
+
+func (l *eventLog) subscribe() chan serverEvent {
+	ch := make(chan serverEvent, 64)
+	l.mu.Lock()
+	l.subs[ch] = struct{}{}
+	l.mu.Unlock()
+	return ch
+}
+
+// eventFollower receives every event published after it was created, in
+// order and each once: when publish drops it for falling behind, it
+// subscribes again and catches up from the log.
+type eventFollower struct {
+	log  *eventLog
+	ch   chan serverEvent
+	last int64
+}
+
+// follow subscribes a follower to the events published from now on.
+func (l *eventLog) follow() *eventFollower {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncPath()
+	ch := make(chan serverEvent, 64)
+	l.subs[ch] = struct{}{}
+	return &eventFollower{log: l, ch: ch, last: l.lastSeq}
+}
+
+// run calls handle with each event until ctx is done, then unsubscribes.
+func (f *eventFollower) run(ctx context.Context, handle func(serverEvent)) {
+	defer func() { f.log.unsubscribe(f.ch) }()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-f.ch:
+			if !ok {
+				f.ch = f.log.subscribe()
+				missed, err := f.log.since(f.last)
+				if err != nil {
+					slog.Error("replay events", "after", f.last, "err", err)
+				}
+				for _, ev := range missed {
+					handle(ev)
+					f.last = ev.Seq
+				}
+				continue
+			}
+			if ev.Seq <= f.last {
+				continue
+			}
+			handle(ev)
+			f.last = ev.Seq
+		}
+	}
+}
+
+// unsubscribe stops delivering events to ch. Channels closed by publish are
+// already gone.
+func (l *eventLog) unsubscribe(ch chan serverEvent) {
+	l.mu.Lock()
+	delete(l.subs, ch)
+	l.mu.Unlock()
+}
+
+// since returns the kept events with Seq > seq.
+func (l *eventLog) since(seq int64) ([]serverEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncPath()
+	i := sort.Search(len(l.recent), func(i int) bool { return l.recent[i].Seq > seq })
+	if i == len(l.recent) {
+		return nil, nil
+	}
+	return append([]serverEvent(nil), l.recent[i:]...), nil
+}
+
+func appendEvent(path string, ev serverEvent) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func readEventsSince(path string, seq int64) ([]serverEvent, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []serverEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var ev serverEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		if ev.Seq > seq {
+			out = append(out, ev)
+		}
+	}
+	return out, scanner.Err()
+}
+
+// eventsHandler serves GET /api/events. With ?since_seq=N it returns every
+// event after N; clients sending Accept: text/event-stream get the replay
+// followed by live events as server-sent events. Last-Event-ID is honoured as
+// a fallback for since_seq so EventSource reconnects resume automatically.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	raw := r.URL.Query().Get("since_seq")
+	if raw == "" {
+		raw = r.Header.Get("Last-Event-ID")
+	}
+	var since int64
+	if raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid since_seq", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+
+	if r.Header.Get("Accept") != "text/event-stream" {
+		evs, err := events.since(since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if evs == nil {
+			evs = []serverEvent{}
+		}
+		writeJSON(w, evs)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// Subscribe before replaying so nothing published in between is lost.
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+	backlog, err := events.since(since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	last := since
+	for _, ev := range backlog {
+		writeSSE(w, ev)
+		last = ev.Seq
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				// Dropped for falling behind; the client resumes from
+				// Last-Event-ID when it reconnects.
+				return
+			}
+			if ev.Seq <= last {
+				continue
+			}
+			writeSSE(w, ev)
+			last = ev.Seq
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev serverEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+}
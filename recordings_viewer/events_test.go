@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEventsReplaySinceSeq(t *testing.T) {
+	useTempBaseDir(t)
+	first := publishEvent("transcript.updated", "a.txt", nil)
+	publishEvent("tags.updated", "a.txt", map[string]any{"tags": []string{"x"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/events?since_seq="+strconv.FormatInt(first.Seq, 10), nil)
+	rec := httptest.NewRecorder()
+	eventsHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusOK)
+	}
+	var got []serverEvent
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode events: %v", err)
+	}
+	if len(got) != 1 || got[0].Type != "tags.updated" || got[0].Seq != first.Seq+1 {
+		t.Fatalf("events=%+v want single tags.updated after seq %d", got, first.Seq)
+	}
+
+	// The sequence survives a reload of the persisted log.
+	events.mu.Lock()
+	events.path = ""
+	events.mu.Unlock()
+	if ev := publishEvent("transcript.updated", "b.txt", nil); ev.Seq != first.Seq+2 {
+		t.Fatalf("seq after reload=%d want %d", ev.Seq, first.Seq+2)
+	}
+}
+
+func TestEventsRejectsInvalidSinceSeq(t *testing.T) {
+	useTempBaseDir(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/events?since_seq=abc", nil)
+	rec := httptest.NewRecorder()
+	eventsHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEventsStreamReplaysThenFollows(t *testing.T) {
+	useTempBaseDir(t)
+	publishEvent("transcript.updated", "a.txt", nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?since_seq=0", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer res.Body.Close()
+
+	reader := bufio.NewReader(res.Body)
+	readEvent := func() string {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read stream: %v", err)
+			}
+			if strings.HasPrefix(line, "event: ") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+			}
+		}
+	}
+	if got := readEvent(); got != "transcript.updated" {
+		t.Fatalf("replayed event=%q", got)
+	}
+	publishEvent("tags.updated", "a.txt", nil)
+	if got := readEvent(); got != "tags.updated" {
+		t.Fatalf("live event=%q", got)
+	}
+}
+
+func TestEventLogKeepsLatest(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.EventLogMax = 3 })
+	var last serverEvent
+	for i := 0; i < 10; i++ {
+		last = publishEvent("transcript.updated", "a.txt", map[string]any{"n": i})
+	}
+
+	evs, err := events.since(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 3 || evs[0].Seq != last.Seq-2 || evs[2].Seq != last.Seq {
+		t.Fatalf("events=%+v want the last 3", evs)
+	}
+	// The file is compacted once it holds twice the limit.
+	if onDisk, _ := readEventsSince(eventLogPath(), 0); len(onDisk) > 6 {
+		t.Fatalf("events.jsonl holds %d events", len(onDisk))
+	}
+
+	// A reload compacts the file and keeps the sequence going.
+	events.mu.Lock()
+	events.path = ""
+	events.mu.Unlock()
+	if ev := publishEvent("tags.updated", "a.txt", nil); ev.Seq != last.Seq+1 {
+		t.Fatalf("seq after reload=%d want %d", ev.Seq, last.Seq+1)
+	}
+	onDisk, _ := readEventsSince(eventLogPath(), 0)
+	if len(onDisk) != 4 || onDisk[0].Seq != last.Seq-2 {
+		t.Fatalf("events.jsonl after reload=%+v", onDisk)
+	}
+}
+
+func TestEventFollowerCatchesUpAfterFallingBehind(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.EventLogMax = 1000 })
+	follower := events.follow()
+	sub := events.subscribe()
+	first := publishEvent("tags.updated", "a.txt", nil)
+	for i := 0; i < 99; i++ {
+		publishEvent("tags.updated", "a.txt", nil)
+	}
+
+	// An ordinary subscriber that fell behind is closed after its buffer.
+	n := 0
+	for range sub {
+		n++
+	}
+	if n != cap(sub) {
+		t.Fatalf("subscriber got %d events before closing, want %d", n, cap(sub))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []int64
+	follower.run(ctx, func(ev serverEvent) {
+		got = append(got, ev.Seq)
+		if len(got) == 100 {
+			cancel()
+		}
+	})
+	for i, seq := range got {
+		if seq != first.Seq+int64(i) {
+			t.Fatalf("follower got %v; want 100 events in order from %d", got, first.Seq)
+		}
+	}
+	if len(got) != 100 {
+		t.Fatalf("follower got %d events, want 100", len(got))
+	}
+}
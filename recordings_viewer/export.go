@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// provenance describes where an exported artifact came from. It is embedded
+// in every export so files keep their context once they leave the library.
+type provenance struct {
+	App       string
+	Version   string
+	Engine    string
+	Model     string
+	Source    string
+	CreatedAt time.Time
+	Exported  time.Time
+	// URL is where the recording can be downloaded from this server, when
+	// the export was requested over HTTP.
+	URL string
+}
+
+func (p provenance) lines() []string {
+	lines := []string{
+		"Generated by " + p.App + " " + p.Version,
+		"Source: " + p.Source,
+	}
+	if p.Engine != "" {
+		lines = append(lines, "Engine: "+p.Engine+" (model "+p.Model+")")
+	}
+	if !p.CreatedAt.IsZero() {
+		lines = append(lines, "Transcribed: "+p.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	lines = append(lines, "Exported: "+p.Exported.UTC().Format(time.RFC3339))
+	return lines
+}
+
+// recordingProvenance gathers provenance for the recording at rel from its
+// sidecar metadata, falling back to the transcript's modification time.
+func recordingProvenance(rel string) provenance {
+	fullPath := absPath(rel)
+	p := provenance{App: appName, Version: appVersion, Source: filepath.ToSlash(rel), Exported: time.Now()}
+	if meta, err := loadMeta(fullPath); err == nil && meta.Transcription != nil {
+		p.Engine = meta.Transcription.Engine
+		p.Model = meta.Transcription.Model
+		p.CreatedAt = meta.Transcription.CompletedAt
+	} else if info, err := os.Stat(transcriptJSONPath(fullPath)); err == nil {
+		p.CreatedAt = info.ModTime()
+	}
+	return p
+}
+
+var textExportTypes = map[string]string{
+	"srt": "application/x-subrip; charset=utf-8",
+	"vtt": "text/vtt; charset=utf-8",
+	"txt": "text/plain; charset=utf-8",
+
+	"markdown": "text/markdown; charset=utf-8",
+}
+
+// exportExtension returns the file extension of an export format.
+func exportExtension(format string) string {
+	if format == "markdown" {
+		return "md"
+	}
+	return format
+}
+
+var audioExportFormats = map[string]bool{"mp3": true, "ogg": true}
+
+// exportOptions controls how a transcript or recording is exported. Named
+// sets of options are saved as export profiles.
+type exportOptions struct {
+	Format string `json:"format"`
+	// Censor masks words from the profanity list; CleanVerbatim drops
+	// fillers (um, uh) and stuttered repeats.
+	Censor        bool `json:"censor,omitempty"`
+	CleanVerbatim bool `json:"cleanVerbatim,omitempty"`
+	// IncludeTimestamps prefixes each line of a text export with its start.
+	IncludeTimestamps bool `json:"includeTimestamps,omitempty"`
+	// Template is a text/template that replaces the default text layout.
+	Template string `json:"template,omitempty"`
+}
+
+func (o exportOptions) validate() error {
+	if _, ok := textExportTypes[o.Format]; !ok && !audioExportFormats[o.Format] {
+		return fmt.Errorf("unsupported format %q", o.Format)
+	}
+	if o.Template != "" {
+		if _, err := parseExportTemplate(o.Template); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportOptionsFromQuery starts from ?profile=name when given and applies
+// format, censor, clean_verbatim and timestamps parameters on top.
+func exportOptionsFromQuery(q url.Values) (exportOptions, error) {
+	var opts exportOptions
+	if name := q.Get("profile"); name != "" {
+		mu.Lock()
+		profiles, err := loadExportProfiles()
+		mu.Unlock()
+		if err != nil {
+			return opts, err
+		}
+		p, ok := profiles[name]
+		if !ok {
+			return opts, fmt.Errorf("unknown export profile %q", name)
+		}
+		opts = p
+	}
+	if f := q.Get("format"); f != "" {
+		opts.Format = strings.ToLower(f)
+	}
+	for key, dst := range map[string]*bool{"censor": &opts.Censor, "clean_verbatim": &opts.CleanVerbatim, "timestamps": &opts.IncludeTimestamps} {
+		if v := q.Get(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s: %q", key, v)
+			}
+			*dst = b
+		}
+	}
+	return opts, opts.validate()
+}
+
+// exportHandler serves GET /api/transcripts/{path}/export?format=
+// srt|vtt|txt|markdown for transcripts and format=mp3|ogg for a tagged
+// transcode of the audio.
+func exportHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	opts, err := exportOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prov := recordingProvenance(rel)
+	prov.URL = sourceURL(r, rel)
+	stem := recordingStem(filepath.Base(rel))
+
+	if ctype, ok := textExportTypes[opts.Format]; ok {
+		body, err := renderTranscriptExport(rel, opts, prov)
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "transcript not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Disposition", attachment(stem+"."+exportExtension(opts.Format)))
+		io.WriteString(w, body)
+		return
+	}
+	exportAudio(w, r, rel, opts.Format, prov)
+}
+
+// renderTranscriptExport renders the transcript of rel in a text format
+// after applying the censor and clean-verbatim filters and the formatting
+// rules of its language.
+func renderTranscriptExport(rel string, opts exportOptions, prov provenance) (string, error) {
+	doc, err := loadTranscriptDoc(absPath(rel))
+	if err != nil {
+		return "", err
+	}
+	doc = localizeTranscript(filterTranscript(doc, opts))
+	switch {
+	case opts.Format == "srt":
+		return renderSRT(doc, prov), nil
+	case opts.Format == "vtt":
+		return renderVTT(doc, prov), nil
+	case opts.Format == "markdown":
+		return renderMarkdown(doc, newMarkdownNote(rel, doc, prov), prov, opts.IncludeTimestamps), nil
+	case opts.Template != "":
+		return renderTemplate(opts.Template, doc, prov, rel)
+	case opts.IncludeTimestamps:
+		return renderTimestampedText(doc, prov), nil
+	}
+	return renderText(doc, prov), nil
+}
+
+// renderSRT writes doc as SubRip. SRT has no comment syntax, so provenance is
+// carried in a zero-length first cue that players never display.
+func renderSRT(doc transcriptDoc, prov provenance) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "1\n%s --> %s\n%s\n\n", srtTime(0), srtTime(0), strings.Join(prov.lines(), "\n"))
+	for i, s := range doc.Segments {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+2, srtTime(s.Start), srtTime(s.End), s.caption())
+	}
+	return b.String()
+}
+
+// renderVTT writes doc as WebVTT with provenance in a NOTE block.
+func renderVTT(doc transcriptDoc, prov provenance) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\nNOTE\n")
+	b.WriteString(strings.Join(prov.lines(), "\n"))
+	b.WriteString("\n\n")
+	for _, s := range doc.Segments {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", vttTime(s.Start), vttTime(s.End), s.caption())
+	}
+	return b.String()
+}
+
+// renderText writes the plain transcript under a bracketed provenance header.
+func renderText(doc transcriptDoc, prov provenance) string {
+	var b strings.Builder
+	for _, l := range prov.lines() {
+		b.WriteString("[" + l + "]\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.TrimSpace(doc.Text))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// renderTimestampedText writes one line per segment prefixed with its start.
+func renderTimestampedText(doc transcriptDoc, prov provenance) string {
+	var b strings.Builder
+	for _, l := range prov.lines() {
+		b.WriteString("[" + l + "]\n")
+	}
+	b.WriteString("\n")
+	for _, s := range doc.Segments {
+		fmt.Fprintf(&b, "[%s] %s\n", clockTime(s.Start), s.caption())
+	}
+	return b.String()
+}
+
+func srtTime(sec float64) string {
+	return strings.Replace(vttTime(sec), ".", ",", 1)
+}
+
+func vttTime(sec float64) string {
+	ms := int64(sec*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func clockTime(sec float64) string {
+	return vttTime(sec)[:8]
+}
+
+// exportAudio serves a transcode of the session's audio.
+func exportAudio(w http.ResponseWriter, r *http.Request, rel, format string, prov provenance) {
+	s, err := findSession(rel)
+	if err != nil || s.Audio == "" {
+		http.Error(w, "audio not found", http.StatusNotFound)
+		return
+	}
+	out, err := transcodeAudio(s, rel, format, prov)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "audio not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("export audio", "path", rel, "format", format, "err", err)
+		http.Error(w, "transcode failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", attachment(recordingStem(filepath.Base(rel))+"."+format))
+	http.ServeFile(w, r, out)
+}
+
+// attachment is a Content-Disposition value downloading as name, quoted
+// (or RFC 2231 encoded, for names beyond ASCII) so recording names with
+// quotes or semicolons cannot break out of it.
+func attachment(name string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
+
+// transcodeAudio transcodes the session's audio with ffmpeg, writing
+// provenance into the container tags (ID3 for mp3, Vorbis comments for
+// ogg/opus), and returns the path of the cached result. The tags carry the
+// export time to the hour, and are part of the cache key, so a transcode is
+// reused for at most that hour.
+func transcodeAudio(s *session, rel, format string, prov provenance) (string, error) {
+	src := absPath(s.Audio)
+	prov.Exported = prov.Exported.UTC().Truncate(time.Hour)
+	comment := strings.Join(prov.lines(), "; ")
+	kind := "audio-" + format + "\n" + comment
+	key, err := artifactKey(kind, src, s.metaPath())
+	if err != nil {
+		key, err = artifactKey(kind, src)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	codec := map[string][]string{"mp3": {"-c:a", "libmp3lame", "-q:a", "4", "-id3v2_version", "3"}, "ogg": {"-c:a", "libopus", "-b:a", "64k"}}[format]
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", src, "-vn", "-map_metadata", "-1"}
+	args = append(args, codec...)
+	args = append(args,
+		"-metadata", "title="+recordingStem(filepath.Base(rel)),
+		"-metadata", "comment="+comment,
+		"-metadata", "encoded_by="+prov.App+" "+prov.Version,
+	)
+	if !prov.CreatedAt.IsZero() {
+		args = append(args, "-metadata", "date="+prov.CreatedAt.UTC().Format("2006-01-02"))
+	}
+	return cachedArtifact(key, "."+format, func(ctx context.Context, out string) error {
+		outText, err := runCommandFunc(ctx, cfg().FFmpegPath, append(args, out)...)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, outputTail(outText))
+		}
+		return nil
+	})
+}
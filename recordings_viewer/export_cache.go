@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// flightGroup collapses concurrent calls with the same key into one
+// execution whose result is shared by every caller.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  string
+	err  error
+	dups int
+}
+
+// do runs fn once per key at a time. shared reports whether the result was
+// also handed to other callers.
+func (g *flightGroup) do(key string, fn func() (string, error)) (val string, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		<-c.done
+		return c.val, c.err, true
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	shared = c.dups > 0
+	g.mu.Unlock()
+	close(c.done)
+	return c.val, c.err, shared
+}
+
+// exportFlights deduplicates derived artifacts (transcodes, archives) that
+// several viewer tabs may request at once.
+var exportFlights flightGroup
+
+func exportCacheDir() string {
+	return filepath.Join(tempDir(), "cache")
+}
+
+// artifactKey identifies a derived artifact by its kind and the size and
+// modification time of every source, so edits produce a new key.
+func artifactKey(kind string, sources ...string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, kind)
+	for _, src := range sources {
+		info, err := os.Stat(src)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(h, src, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
+
+// cachedArtifact returns the path of the artifact stored under key with the
+// given extension, running build to produce it when missing. Concurrent
+// requests for the same key share one build; build writes to the path it is
+// given and the result is renamed into place only on success.
+func cachedArtifact(key, ext string, build func(ctx context.Context, out string) error) (string, error) {
+	path := filepath.Join(exportCacheDir(), key+ext)
+	val, err, _ := exportFlights.do(key+ext, func() (string, error) {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		if err := os.MkdirAll(exportCacheDir(), 0o755); err != nil {
+			return "", err
+		}
+		tmp := filepath.Join(exportCacheDir(), key+"-"+randomID()+ext)
+		defer os.Remove(tmp)
+		// The build outlives any single request: other callers may be
+		// waiting on it after the first one disconnects.
+		if err := build(context.Background(), tmp); err != nil {
+			return "", err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return "", err
+		}
+		return path, nil
+	})
+	return val, err
+}
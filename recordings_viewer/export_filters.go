@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultCensorWords is the built-in profanity list; VIEWER_CENSOR_WORDS adds
+// to it.
+var defaultCensorWords = []string{"fuck", "shit", "bitch", "bastard", "asshole", "dick", "cunt", "crap", "damn"}
+
+var fillerWords = map[string]bool{"um": true, "umm": true, "uh": true, "uhh": true, "er": true, "erm": true, "ah": true, "hmm": true, "mm": true}
+
+func censorPattern() *regexp.Regexp {
+	words := append([]string{}, defaultCensorWords...)
+	words = append(words, cfg().CensorWords...)
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(strings.ToLower(w))
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(words, "|") + `)(?:[a-z]?(?:s|es|ed|er|ers|ing|in|y))?\b`)
+}
+
+// censorText keeps the first letter of each listed word and masks the rest.
+func censorText(re *regexp.Regexp, text string) string {
+	return re.ReplaceAllStringFunc(text, func(w string) string {
+		_, size := utf8.DecodeRuneInString(w)
+		return w[:size] + strings.Repeat("*", utf8.RuneCountInString(w)-1)
+	})
+}
+
+// cleanVerbatim drops filler words and immediately repeated words ("I I
+// think" becomes "I think"), re-capitalising a sentence whose first word was
+// removed.
+func cleanVerbatim(text string) string {
+	var out []string
+	prev := ""
+	capNext := false
+	for _, tok := range strings.Fields(text) {
+		core := strings.ToLower(strings.TrimFunc(tok, unicode.IsPunct))
+		if fillerWords[core] || (core != "" && core == prev) {
+			sentenceStart := len(out) == 0 || strings.ContainsAny(out[len(out)-1][len(out[len(out)-1])-1:], ".!?")
+			if r, _ := utf8.DecodeRuneInString(tok); fillerWords[core] && sentenceStart && unicode.IsUpper(r) {
+				capNext = true
+			}
+			if !sentenceStart && strings.ContainsAny(tok[len(tok)-1:], ".!?") {
+				out[len(out)-1] = strings.TrimRight(out[len(out)-1], ",;:") + tok[len(tok)-1:]
+			}
+			continue
+		}
+		if capNext {
+			r, size := utf8.DecodeRuneInString(tok)
+			tok = string(unicode.ToUpper(r)) + tok[size:]
+			capNext = false
+		}
+		out = append(out, tok)
+		prev = core
+	}
+	return strings.Join(out, " ")
+}
+
+// filterTranscript applies the text filters selected in opts to the full
+// text and every segment.
+func filterTranscript(doc transcriptDoc, opts exportOptions) transcriptDoc {
+	if !opts.Censor && !opts.CleanVerbatim {
+		return doc
+	}
+	var re *regexp.Regexp
+	if opts.Censor {
+		re = censorPattern()
+	}
+	apply := func(s string) string {
+		if opts.CleanVerbatim {
+			s = cleanVerbatim(s)
+		}
+		if re != nil {
+			s = censorText(re, s)
+		}
+		return s
+	}
+	out := doc
+	out.Text = apply(doc.Text)
+	out.Segments = make([]segment, len(doc.Segments))
+	for i, s := range doc.Segments {
+		s.Text = apply(s.Text)
+		out.Segments[i] = s
+	}
+	return out
+}
+
+// exportTemplateData is what export templates can reference, e.g.
+// {{.Title}}, {{range .Segments}}{{timestamp .Start}} {{.Text}}{{end}}.
+type exportTemplateData struct {
+	Title      string
+	Source     string
+	Language   string
+	Provenance []string
+	Text       string
+	Segments   []segment
+}
+
+func parseExportTemplate(text string) (*template.Template, error) {
+	return template.New("export").Funcs(template.FuncMap{
+		"timestamp": clockTime,
+		"trim":      strings.TrimSpace,
+	}).Parse(text)
+}
+
+func renderTemplate(text string, doc transcriptDoc, prov provenance, rel string) (string, error) {
+	tmpl, err := parseExportTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, exportTemplateData{
+		Title:      recordingStem(filepath.Base(rel)),
+		Source:     prov.Source,
+		Language:   doc.Language,
+		Provenance: prov.lines(),
+		Text:       strings.TrimSpace(doc.Text),
+		Segments:   doc.Segments,
+	})
+	return b.String(), err
+}
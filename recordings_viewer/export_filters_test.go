@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestCleanVerbatim(t *testing.T) {
+	cases := map[string]string{
+		"Um, so we we shipped it.":   "So we shipped it.",
+		"It works, uh, mostly. Uhh.": "It works, mostly.",
+		"I I think, you know, yes":   "I think, you know, yes",
+	}
+	for in, want := range cases {
+		if got := cleanVerbatim(in); got != want {
+			t.Errorf("cleanVerbatim(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func TestCensorText(t *testing.T) {
+	useConfig(t, func(c *config) { c.CensorWords = []string{"frak"} })
+	got := censorText(censorPattern(), "Well shit, the Frakking build is damned; classic.")
+	if want := "Well s***, the F******* build is d*****; classic."; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	doc := transcriptDoc{Text: " Hi. Bye.", Segments: []segment{{Start: 0, Text: " Hi."}, {Start: 65.2, Text: " Bye."}}}
+	out, err := renderTemplate("# {{.Title}}\n{{range .Segments}}- {{timestamp .Start}} {{trim .Text}}\n{{end}}", doc, provenance{Source: "a/talk.json"}, "a/talk.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# talk\n- 00:00:00 Hi.\n- 00:01:05 Bye.\n"; out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
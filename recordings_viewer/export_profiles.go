@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+func exportProfilesPath() string {
+	return filepath.Join(stateDir(), "export-profiles.json")
+}
+
+// loadExportProfiles reads the saved profiles. Callers hold mu.
+func loadExportProfiles() (map[string]exportOptions, error) {
+	items := map[string]exportOptions{}
+	data, err := os.ReadFile(exportProfilesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func saveExportProfiles(items map[string]exportOptions) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(exportProfilesPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+type exportProfile struct {
+	Name string `json:"name"`
+	exportOptions
+}
+
+// exportProfilesHandler serves GET /api/export-profiles and
+// GET/PUT/DELETE /api/export-profiles/{name}.
+func exportProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/export-profiles"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		items, err := loadExportProfiles()
+		mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list := []exportProfile{}
+		for n, o := range items {
+			list = append(list, exportProfile{Name: n, exportOptions: o})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		writeJSON(w, list)
+		return
+	}
+	if !profileNamePattern.MatchString(name) {
+		http.Error(w, "invalid profile name", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	items, err := loadExportProfiles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		o, ok := items[name]
+		if !ok {
+			http.Error(w, "profile not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, exportProfile{Name: name, exportOptions: o})
+	case http.MethodPut:
+		var o exportOptions
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		o.Format = strings.ToLower(o.Format)
+		if err := o.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items[name] = o
+		if err := saveExportProfiles(items); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, exportProfile{Name: name, exportOptions: o})
+	case http.MethodDelete:
+		if _, ok := items[name]; !ok {
+			http.Error(w, "profile not found", http.StatusNotFound)
+			return
+		}
+		delete(items, name)
+		if err := saveExportProfiles(items); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportProfilesCRUD(t *testing.T) {
+	useTempBaseDir(t)
+	rec := httptest.NewRecorder()
+	exportProfilesHandler(rec, httptest.NewRequest(http.MethodPut, "/api/export-profiles/client", strings.NewReader(`{"format":"TXT","censor":true,"includeTimestamps":true}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	exportProfilesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/export-profiles", nil))
+	var list []exportProfile
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "client" || list[0].Format != "txt" || !list[0].Censor {
+		t.Fatalf("list=%+v", list)
+	}
+
+	for _, c := range []struct{ path, body string }{
+		{"/api/export-profiles/bad", `{"format":"docx"}`},
+		{"/api/export-profiles/bad", `{"format":"txt","template":"{{.Nope"}`},
+		{"/api/export-profiles/..", `{"format":"txt"}`},
+	} {
+		rec = httptest.NewRecorder()
+		exportProfilesHandler(rec, httptest.NewRequest(http.MethodPut, c.path, strings.NewReader(c.body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: status=%d", c.path, c.body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	exportProfilesHandler(rec, httptest.NewRequest(http.MethodDelete, "/api/export-profiles/client", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status=%d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	exportProfilesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/export-profiles/client", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("get after delete status=%d", rec.Code)
+	}
+}
+
+func TestExportUsesProfileWithOverrides(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeWhisperFixture(t, dir)
+	mu.Lock()
+	saveExportProfiles(map[string]exportOptions{"notes": {Format: "txt", IncludeTimestamps: true, CleanVerbatim: true}})
+	mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.webm/export?profile=notes", nil))
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.HasSuffix(body, "\n[00:00:00] Hello.\n[00:00:01] World.\n") {
+		t.Fatalf("status=%d body=%s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.webm/export?profile=notes&format=srt", nil))
+	if !strings.Contains(rec.Body.String(), "00:00:01,500 --> 01:02:05,250") {
+		t.Fatalf("format override ignored: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.webm/export?profile=missing", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown profile status=%d", rec.Code)
+	}
+}
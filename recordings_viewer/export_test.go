@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeWhisperFixture(t *testing.T, dir string) {
+	t.Helper()
+	writeTestFiles(t, dir, "talk.webm")
+	doc := `{"text":" Hello. World.","language":"en","segments":[{"id":0,"start":0,"end":1.5,"text":" Hello."},{"id":1,"start":1.5,"end":3725.25,"text":" World."}]}`
+	if err := os.WriteFile(dir+"/talk.json", []byte(doc), 0o644); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := saveMeta(dir+"/talk.webm", recordingMeta{Transcription: &transcriptionInfo{
+		Engine: "whisper", Model: "small", CompletedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+	}}); err != nil {
+		t.Fatalf("save meta: %v", err)
+	}
+}
+
+func TestExportSRTAndVTTEmbedProvenance(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeWhisperFixture(t, dir)
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.webm/export?format=srt", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("srt status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	srt := rec.Body.String()
+	if !strings.HasPrefix(srt, "1\n00:00:00,000 --> 00:00:00,000\nGenerated by recordings-viewer") {
+		t.Fatalf("srt header=%q", srt[:80])
+	}
+	if !strings.Contains(srt, "Engine: whisper (model small)") || !strings.Contains(srt, "3\n00:00:01,500 --> 01:02:05,250\nWorld.") {
+		t.Fatalf("srt body=%s", srt)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.json/export?format=vtt", nil))
+	vtt := rec.Body.String()
+	if !strings.HasPrefix(vtt, "WEBVTT\n\nNOTE\nGenerated by") || !strings.Contains(vtt, "Transcribed: 2024-03-01T09:00:00Z") {
+		t.Fatalf("vtt=%s", vtt)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/vtt") {
+		t.Fatalf("content-type=%q", ct)
+	}
+}
+
+func TestExportAudioWritesProvenanceTags(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeWhisperFixture(t, dir)
+	useConfig(t, func(c *config) { c.FFmpegPath = "ffmpeg" })
+	var args []string
+	useRunCommand(t, func(_ context.Context, name string, a ...string) ([]byte, error) {
+		args = a
+		return nil, os.WriteFile(a[len(a)-1], []byte("ID3"), 0o644)
+	})
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.txt/export?format=mp3", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ID3" {
+		t.Fatalf("status=%d body=%q", rec.Code, rec.Body.String())
+	}
+	joined := strings.Join(args, " ")
+	// The export time is tagged to the hour, which the cached transcode
+	// is reused for.
+	for _, want := range []string{"title=talk", "date=2024-03-01", "comment=Generated by recordings-viewer", "-id3v2_version 3", ":00:00Z"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("ffmpeg args missing %q: %s", want, joined)
+		}
+	}
+}
+
+func TestExportAttachmentNameIsEscaped(t *testing.T) {
+	dir := useTempBaseDir(t)
+	os.WriteFile(filepath.Join(dir, `a "b"; c.txt`), []byte("hello"), 0o644)
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/"+url.PathEscape(`a "b"; c.txt`)+"/export?format=txt", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body)
+	}
+	_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	if err != nil || params["filename"] != `a "b"; c.txt` {
+		t.Fatalf("content-disposition=%q params=%v err=%v", rec.Header().Get("Content-Disposition"), params, err)
+	}
+}
+
+func TestExportAudioSharesConcurrentTranscodes(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeWhisperFixture(t, dir)
+	release := make(chan struct{})
+	var runs atomic.Int32
+	useRunCommand(t, func(_ context.Context, name string, a ...string) ([]byte, error) {
+		runs.Add(1)
+		<-release
+		return nil, os.WriteFile(a[len(a)-1], []byte("OggS"), 0o644)
+	})
+
+	var wg sync.WaitGroup
+	codes := make([]int, 4)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.webm/export?format=ogg", nil))
+			codes[i] = rec.Code
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for _, c := range codes {
+		if c != http.StatusOK {
+			t.Fatalf("codes=%v", codes)
+		}
+	}
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("ffmpeg ran %d times, want 1", n)
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/talk.webm/export?format=ogg", nil))
+	if rec.Code != http.StatusOK || runs.Load() != 1 {
+		t.Fatalf("cached export should not transcode again: status=%d runs=%d", rec.Code, runs.Load())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// favoriteInfo marks a session as a favorite of the viewer's user.
+type favoriteInfo struct {
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// favoritesFilter is what ?favorites= asks of a session listing.
+type favoritesFilter int
+
+const (
+	favoritesAll   favoritesFilter = iota
+	favoritesOnly                  // ?favorites=true
+	favoritesFirst                 // ?favorites=first
+)
+
+func parseFavoritesFilter(v string) (favoritesFilter, error) {
+	if v == "" {
+		return favoritesAll, nil
+	}
+	if v == "first" {
+		return favoritesFirst, nil
+	}
+	only, err := strconv.ParseBool(v)
+	if err != nil {
+		return favoritesAll, fmt.Errorf("favorites must be true, false or first, not %q", v)
+	}
+	if only {
+		return favoritesOnly, nil
+	}
+	return favoritesAll, nil
+}
+
+func (f favoritesFilter) matches(s *session) bool {
+	return f != favoritesOnly || s.Favorite
+}
+
+// pin moves favorites ahead of the other sessions, keeping the listing's
+// order within each group.
+func (f favoritesFilter) pin(sessions []session) {
+	if f != favoritesFirst {
+		return
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Favorite && !sessions[j].Favorite })
+}
+
+// favoriteHandler serves GET /api/transcripts/{path}/favorite with whether
+// the recording's session is a favorite, and PUT with {"favorite": true}
+// or false to mark or unmark it.
+func favoriteHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	s, err := findSession(rel)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	type state struct {
+		Favorite bool       `json:"favorite"`
+		AddedAt  *time.Time `json:"addedAt,omitempty"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if meta.Favorite == nil {
+			writeJSON(w, state{})
+			return
+		}
+		writeJSON(w, state{Favorite: true, AddedAt: &meta.Favorite.AddedAt})
+	case http.MethodPut:
+		var payload struct {
+			Favorite *bool `json:"favorite"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Favorite == nil {
+			http.Error(w, `body must be {"favorite": true|false}`, http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case !*payload.Favorite:
+			meta.Favorite = nil
+		case meta.Favorite == nil:
+			meta.Favorite = &favoriteInfo{AddedAt: time.Now().UTC()}
+		}
+		if err := saveMeta(s.metaPath(), meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestLogger(r).Info("updated favorite", "session", s.ID, "favorite", *payload.Favorite)
+		publishEvent("favorite.updated", s.ID, map[string]any{"favorite": *payload.Favorite})
+		res := state{Favorite: meta.Favorite != nil}
+		if meta.Favorite != nil {
+			res.AddedAt = &meta.Favorite.AddedAt
+		}
+		writeJSON(w, res)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
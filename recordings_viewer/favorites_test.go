@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func listSessionIDs(t *testing.T, query string) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/sessions%s: %d %s", query, rec.Code, rec.Body)
+	}
+	var list []session
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	ids := make([]string, len(list))
+	for i, s := range list {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func TestFavoritesFilterAndPin(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "b.webm", "c.webm", "d.webm")
+	for _, p := range []string{"d.webm", "b.webm"} {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/"+p+"/favorite", strings.NewReader(`{"favorite": true}`)))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"favorite":true`) {
+			t.Fatalf("PUT %s: %d %s", p, rec.Code, rec.Body)
+		}
+	}
+
+	if got := strings.Join(listSessionIDs(t, "?favorites=true"), ","); got != "b,d" {
+		t.Fatalf("favorites=%s", got)
+	}
+	if got := strings.Join(listSessionIDs(t, "?favorites=first&order=desc"), ","); got != "d,b,c,a" {
+		t.Fatalf("pinned=%s", got)
+	}
+	if got := strings.Join(listSessionIDs(t, "?favorites=false"), ","); got != "a,b,c,d" {
+		t.Fatalf("all=%s", got)
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?favorites=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad filter: %d", rec.Code)
+	}
+
+	meta, _ := loadMeta(filepath.Join(dir, "b.webm"))
+	if meta.Favorite == nil || meta.Favorite.AddedAt.IsZero() {
+		t.Fatalf("meta=%+v", meta)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/b.webm/favorite", strings.NewReader(`{"favorite": false}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unmark: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/b.webm/favorite", nil))
+	if strings.TrimSpace(rec.Body.String()) != `{"favorite":false}` {
+		t.Fatalf("GET after unmark: %s", rec.Body)
+	}
+	if got := strings.Join(listSessionIDs(t, "?favorites=1"), ","); got != "d" {
+		t.Fatalf("favorites after unmark=%s", got)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/a.webm/favorite", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("PUT without flag: %d", rec.Code)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed gallery.html
+var galleryPage []byte
+
+// galleryInfo marks a session as published in the public gallery.
+type galleryInfo struct {
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+// galleryEntry is how the gallery lists a published session.
+type galleryEntry struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	RecordedAt  time.Time     `json:"recordedAt"`
+	PublishedAt time.Time     `json:"publishedAt"`
+	Tags        []string      `json:"tags,omitempty"`
+	Language    string        `json:"language,omitempty"`
+	Excerpt     string        `json:"excerpt,omitempty"`
+	Files       []galleryFile `json:"files"`
+}
+
+type galleryFile struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	URL  string `json:"url"`
+}
+
+// galleryExcerptLen bounds the transcript excerpt of a listing entry.
+const galleryExcerptLen = 280
+
+func newGalleryEntry(s *session) galleryEntry {
+	e := galleryEntry{ID: s.ID, Title: path.Base(s.ID), RecordedAt: s.RecordedAt, Tags: s.Tags, Language: s.Language, Files: []galleryFile{}}
+	if meta, err := loadMeta(s.metaPath()); err == nil && meta.Gallery != nil {
+		e.PublishedAt = meta.Gallery.PublishedAt
+	}
+	e.Excerpt = transcriptExcerpt(*s, galleryExcerptLen)
+	files := sharedFiles(s)
+	for _, f := range s.Files {
+		if name := path.Base(f); files[name] == f {
+			e.Files = append(e.Files, galleryFile{Name: name, Kind: artifactKind(name), URL: galleryFileURL(f)})
+		}
+	}
+	return e
+}
+
+func galleryFileURL(rel string) string {
+	return "/gallery/files" + strings.TrimPrefix(recordingsURL(rel), "/recordings")
+}
+
+// publishedSession returns the session of id when it is published.
+func publishedSession(id string) (*session, bool) {
+	s, err := findSession(id)
+	if err != nil || !s.Published {
+		return nil, false
+	}
+	return s, true
+}
+
+// galleryHandler serves the public gallery of published sessions, which
+// needs no credentials and never shows anything else: GET /gallery/ is
+// the page, /gallery/api/sessions lists the sessions newest first,
+// /gallery/api/sessions/{id} describes one and /gallery/files/{path}
+// serves a published session's audio and transcripts.
+func galleryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/gallery/")
+	switch {
+	case rest == "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(galleryPage)
+	case rest == "api/sessions":
+		all, err := scanSessions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries := []galleryEntry{}
+		for i := range all {
+			if all[i].Published {
+				entries = append(entries, newGalleryEntry(&all[i]))
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].RecordedAt.After(entries[j].RecordedAt) })
+		writeJSON(w, entries)
+	case strings.HasPrefix(rest, "api/sessions/"):
+		s, ok := publishedSession(strings.TrimPrefix(rest, "api/sessions/"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, newGalleryEntry(s))
+	case strings.HasPrefix(rest, "files/"):
+		rel := strings.TrimPrefix(rest, "files/")
+		s, ok := publishedSession(rel)
+		if !ok || sharedFiles(s)[path.Base(rel)] != rel {
+			http.NotFound(w, r)
+			return
+		}
+		serveSessionFile(w, r, rel)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// galleryMux serves only the gallery, for cfg.GalleryListen.
+func galleryMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gallery/", galleryHandler)
+	mux.Handle("/{$}", http.RedirectHandler("/gallery/", http.StatusFound))
+	return mux
+}
+
+// publishedHandler serves GET /api/transcripts/{path}/published with
+// whether the recording's session is in the public gallery, and PUT with
+// {"published": true} or false to add or remove it.
+func publishedHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	s, err := findSession(rel)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	type state struct {
+		Published   bool       `json:"published"`
+		PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if meta.Gallery == nil {
+			writeJSON(w, state{})
+			return
+		}
+		writeJSON(w, state{Published: true, PublishedAt: &meta.Gallery.PublishedAt})
+	case http.MethodPut:
+		var payload struct {
+			Published *bool `json:"published"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Published == nil {
+			http.Error(w, `body must be {"published": true|false}`, http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case !*payload.Published:
+			meta.Gallery = nil
+		case meta.Gallery == nil:
+			meta.Gallery = &galleryInfo{PublishedAt: time.Now().UTC()}
+		}
+		if err := saveMeta(s.metaPath(), meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestLogger(r).Info("updated gallery", "session", s.ID, "published", *payload.Published)
+		publishEvent("gallery.updated", s.ID, map[string]any{"published": *payload.Published})
+		res := state{Published: meta.Gallery != nil}
+		if meta.Gallery != nil {
+			res.PublishedAt = &meta.Gallery.PublishedAt
+		}
+		writeJSON(w, res)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setPublished(t *testing.T, rel string, published bool) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	body := `{"published": false}`
+	if published {
+		body = `{"published": true}`
+	}
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/"+rel+"/published", strings.NewReader(body)))
+	return rec
+}
+
+func TestGalleryShowsOnlyPublishedSessions(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "episodes/ep1.webm", "episodes/ep1.txt", "episodes/ep1.summary.txt", "private/call.webm", "private/call.txt")
+	os.WriteFile(filepath.Join(dir, "episodes", "ep1.json"), []byte(segmentsFixture), 0o644)
+	fakeStreamRemux(t, "12.5", nil)
+
+	if rec := setPublished(t, "episodes/ep1.webm", true); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"published":true`) {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body)
+	}
+
+	get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	for _, h := range []http.Handler{newMux(), galleryMux()} {
+		rec := get(h, "/gallery/api/sessions")
+		var entries []galleryEntry
+		json.NewDecoder(rec.Body).Decode(&entries)
+		if len(entries) != 1 || entries[0].ID != "episodes/ep1" || entries[0].Excerpt != "episodes/ep1.txt" || len(entries[0].Files) != 3 {
+			t.Fatalf("entries = %+v", entries)
+		}
+		for _, f := range entries[0].Files {
+			if rec := get(h, f.URL); rec.Code != http.StatusOK {
+				t.Fatalf("GET %s status = %d", f.URL, rec.Code)
+			}
+		}
+		for _, p := range []string{
+			"/gallery/api/sessions/private/call",
+			"/gallery/files/private/call.webm",
+			"/gallery/files/episodes/ep1.summary.txt",
+			"/gallery/files/episodes/ep1" + metaSuffix,
+		} {
+			if rec := get(h, p); rec.Code != http.StatusNotFound {
+				t.Fatalf("GET %s status = %d", p, rec.Code)
+			}
+		}
+		if rec := get(h, "/gallery/"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<audio") {
+			t.Fatalf("page status = %d", rec.Code)
+		}
+	}
+	// The gallery server serves nothing else.
+	if rec := get(galleryMux(), "/api/sessions"); rec.Code != http.StatusNotFound {
+		t.Fatalf("gallery server /api/sessions status = %d", rec.Code)
+	}
+
+	setPublished(t, "episodes/ep1", false)
+	if rec := get(newMux(), "/gallery/api/sessions/episodes/ep1"); rec.Code != http.StatusNotFound {
+		t.Fatalf("unpublished status = %d", rec.Code)
+	}
+}
+
+func TestGalleryIsReadOnly(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "ep.webm")
+	rec := httptest.NewRecorder()
+	galleryMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/gallery/files/ep.webm", strings.NewReader("x")))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT status = %d", rec.Code)
+	}
+	if rec := setPublished(t, "ep.webm", true); rec.Code != http.StatusOK {
+		t.Fatalf("publish status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/ep.webm/published", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("empty body status = %d", rec.Code)
+	}
+}
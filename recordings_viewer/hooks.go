@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hookEvents are the events hooks can run on; they are the webhook
+// events, see webhookEvent.
+var hookEvents = []string{"recording.uploaded", "transcript.completed", "alert.matched"}
+
+// eventName matches an event name such as "transcript.completed".
+var eventName = regexp.MustCompile(`^[a-z]+\.[a-z]+$`)
+
+// hook runs after an event: a POST of the webhook payload to URL, or
+// Command with {src} (the file), {path} (its recordings path), {event} and
+// {payload} (a file holding the webhook payload) filled in.
+type hook struct {
+	Event   string
+	URL     string
+	Command []string
+}
+
+// target describes where the hook goes, for logs and GET /api/hooks:
+// the URL's scheme and host or the command's name, as their other parts
+// may hold credentials.
+func (h hook) target() string {
+	if h.URL != "" {
+		return redactURL(h.URL)
+	}
+	return filepath.Base(h.Command[0])
+}
+
+// envHooks parses "event=target" entries, where a target is an http(s)
+// URL or a command. An entry that does not start with an event, such as
+// the second item of `transcript.completed = ["a", "b"]` in the config
+// file, is another hook for the event before it. Malformed entries, and
+// those of unknown events, are skipped.
+func envHooks(name string) []hook {
+	var out []hook
+	event := ""
+	for _, entry := range envList(name) {
+		target := entry
+		if e, rest, ok := strings.Cut(entry, "="); ok && eventName.MatchString(strings.TrimSpace(e)) {
+			event, target = strings.TrimSpace(e), strings.TrimSpace(rest)
+			if !slices.Contains(hookEvents, event) {
+				slog.Warn("ignoring hook for unknown event", "name", name, "event", event, "want", hookEvents)
+				event = ""
+				continue
+			}
+		}
+		if event == "" || target == "" {
+			slog.Warn("ignoring invalid hook", "name", name, "value", entry)
+			continue
+		}
+		h := hook{Event: event}
+		if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+			h.URL = target
+		} else {
+			h.Command = strings.Fields(target)
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// hookRun is the outcome of a hook's last run.
+type hookRun struct {
+	At       time.Time `json:"at"`
+	Path     string    `json:"path,omitempty"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"durationSeconds"`
+}
+
+// hookRuns holds the last run of each hook, by its place in cfg.Hooks.
+var hookRuns = struct {
+	sync.Mutex
+	last map[int]hookRun
+}{last: map[int]hookRun{}}
+
+// runHook runs h for event with payload, within cfg.HookTimeout.
+func runHook(ctx context.Context, h hook, event, rel string, payload []byte) error {
+	timeout := cfg().HookTimeout
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if h.URL != "" {
+		return sendWebhook(ctx, h.URL, event, payload)
+	}
+	if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(tempDir(), "hook-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(payload)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	r := strings.NewReplacer("{src}", absPath(rel), "{path}", rel, "{event}", event, "{payload}", f.Name())
+	args := make([]string, len(h.Command))
+	for i, arg := range h.Command {
+		args[i] = r.Replace(arg)
+	}
+	out, err := runCommandFunc(ctx, args[0], args[1:]...)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", filepath.Base(args[0]), err, outputTail(out))
+	}
+	return nil
+}
+
+// startHooks runs the hooks of each server event until ctx is done. Each
+// run is logged, failures as errors, and the last one of each hook is
+// kept for GET /api/hooks.
+func startHooks(ctx context.Context) {
+	follower := events.follow()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		follower.run(ctx, func(ev serverEvent) {
+			event, ok := webhookEvent(ev)
+			hooks := cfg().Hooks
+			if !ok || !slices.ContainsFunc(hooks, func(h hook) bool { return h.Event == event }) {
+				return
+			}
+			payload, err := json.Marshal(newWebhookPayload(event, ev))
+			if err != nil {
+				slog.Error("hook payload", "event", event, "err", err)
+				return
+			}
+			for i, h := range hooks {
+				if h.Event != event {
+					continue
+				}
+				background.Add(1)
+				go func() {
+					defer background.Done()
+					start := time.Now()
+					err := runHook(ctx, h, event, ev.Path, payload)
+					run := hookRun{At: start.UTC(), Path: ev.Path, OK: err == nil, Duration: time.Since(start).Seconds()}
+					if err != nil {
+						run.Error = err.Error()
+						slog.Error("hook failed", "event", event, "hook", h.target(), "path", ev.Path, "err", err)
+					} else {
+						slog.Info("hook ran", "event", event, "hook", h.target(), "path", ev.Path)
+					}
+					hookRuns.Lock()
+					hookRuns.last[i] = run
+					hookRuns.Unlock()
+				}()
+			}
+		})
+	}()
+}
+
+// hooksHandler serves GET /api/hooks: the configured hooks in order, each
+// with its event, target (URLs without their path) and last run.
+func hooksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	type hookStatus struct {
+		Event   string   `json:"event"`
+		Kind    string   `json:"kind"`
+		Target  string   `json:"target"`
+		LastRun *hookRun `json:"lastRun,omitempty"`
+	}
+	hookRuns.Lock()
+	defer hookRuns.Unlock()
+	out := []hookStatus{}
+	for i, h := range cfg().Hooks {
+		st := hookStatus{Event: h.Event, Kind: "command", Target: h.target()}
+		if h.URL != "" {
+			st.Kind = "http"
+		}
+		if run, ok := hookRuns.last[i]; ok {
+			st.LastRun = &run
+		}
+		out = append(out, st)
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvHooks(t *testing.T) {
+	useConfigFile(t, "[hooks]\n"+
+		`recording.uploaded = "notion-push --file {src}"`+"\n"+
+		`transcript.completed = ["https://hooks.example.com/done?token=abc", "/usr/local/bin/index {path} {payload}"]`+"\n"+
+		`job.started = "nope"`+"\n")
+	hooks := envHooks("VIEWER_HOOKS")
+	if len(hooks) != 3 {
+		t.Fatalf("hooks = %+v", hooks)
+	}
+	if hooks[0].Event != "recording.uploaded" || strings.Join(hooks[0].Command, " ") != "notion-push --file {src}" {
+		t.Errorf("first = %+v", hooks[0])
+	}
+	// The token in the URL does not start a new entry.
+	if hooks[1].Event != "transcript.completed" || hooks[1].URL != "https://hooks.example.com/done?token=abc" || hooks[1].target() != "https://hooks.example.com/…" {
+		t.Errorf("second = %+v", hooks[1])
+	}
+	if hooks[2].Event != "transcript.completed" || hooks[2].Command[0] != "/usr/local/bin/index" {
+		t.Errorf("third = %+v", hooks[2])
+	}
+}
+
+func TestHooksRunOnEvents(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+	got := make(chan *http.Request, 2)
+	srv := webhookReceiver(t, got)
+	ran := make(chan map[string]any, 2)
+	useConfig(t, func(c *config) {
+		c.Hooks = []hook{
+			{Event: "recording.uploaded", URL: srv.URL + "/hook"},
+			{Event: "recording.uploaded", Command: []string{"push", "{src}", "{event}", "{payload}"}},
+			{Event: "recording.uploaded", Command: []string{"broken"}},
+			{Event: "transcript.completed", Command: []string{"never"}},
+		}
+		c.HookTimeout = time.Second
+	})
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if name == "broken" {
+			return []byte("no such page\n"), errors.New("exit status 2")
+		}
+		payload, err := os.ReadFile(args[2])
+		ran <- map[string]any{"name": name, "args": args, "payload": string(payload), "err": err}
+		return nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() { cancel(); background.Wait() })
+	startHooks(ctx)
+
+	publishEvent("upload.finalized", "call.webm", map[string]any{"backend": "local"})
+	if r, p := receive(t, got); p.Event != "recording.uploaded" || r.URL.Path != "/hook" {
+		t.Fatalf("POST %s = %+v", r.URL, p)
+	}
+	var run map[string]any
+	select {
+	case run = <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command hook did not run")
+	}
+	args := run["args"].([]string)
+	if run["name"] != "push" || args[0] != filepath.Join(dir, "call.webm") || args[1] != "recording.uploaded" || !strings.Contains(run["payload"].(string), `"path":"call.webm"`) {
+		t.Fatalf("run = %v", run)
+	}
+	if _, err := os.Stat(args[2]); !os.IsNotExist(err) {
+		t.Errorf("payload file left behind: %v", err)
+	}
+
+	// The last run of each hook, failures with their output.
+	var hooks []struct {
+		Event   string   `json:"event"`
+		Kind    string   `json:"kind"`
+		LastRun *hookRun `json:"lastRun"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/hooks", nil))
+		json.Unmarshal(rec.Body.Bytes(), &hooks)
+		if len(hooks) == 4 && hooks[0].LastRun != nil && hooks[1].LastRun != nil && hooks[2].LastRun != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hooks[0].Kind != "http" || !hooks[0].LastRun.OK || !hooks[1].LastRun.OK || hooks[3].LastRun != nil {
+		t.Fatalf("hooks = %+v", hooks)
+	}
+	if hooks[2].LastRun.OK || hooks[2].LastRun.Error != "broken: exit status 2: no such page" {
+		t.Fatalf("failed run = %+v", hooks[2].LastRun)
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.HookTimeout = 10 * time.Millisecond })
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	err := runHook(context.Background(), hook{Event: "recording.uploaded", Command: []string{"slow"}}, "recording.uploaded", "call.webm", []byte(`{}`))
+	if err == nil || err.Error() != "timed out after 10ms" {
+		t.Fatalf("err = %v", err)
+	}
+}
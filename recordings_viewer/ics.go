@@ -0,0 +1,423 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxICSPeriods bounds how many days, weeks, months or years of a
+// recurring event are looked at, so a bad rule cannot spin forever.
+const maxICSPeriods = 20000
+
+// icsProp is one content line of an iCalendar file, e.g.
+// DTSTART;TZID=Europe/Berlin:20240501T100000.
+type icsProp struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// icsLines unfolds the content lines of data and parses them, skipping
+// those that are not "name:value".
+func icsLines(data string) []icsProp {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, "\r"))
+	}
+	var props []icsProp
+	for _, line := range lines {
+		if p, ok := parseICSLine(line); ok {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+func parseICSLine(line string) (icsProp, bool) {
+	quoted := false
+	var parts []string
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			parts = append(parts, line[start:i])
+			start = i + 1
+		case c == ':' && !quoted:
+			parts = append(parts, line[start:i])
+			p := icsProp{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: line[i+1:]}
+			for _, param := range parts[1:] {
+				k, v, _ := strings.Cut(param, "=")
+				p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+			}
+			return p, p.name != ""
+		}
+	}
+	return icsProp{}, false
+}
+
+var icsEscapes = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// icsText unescapes a TEXT value.
+func icsText(v string) string {
+	return strings.TrimSpace(icsEscapes.Replace(v))
+}
+
+// icsEvent is a VEVENT as read, before its recurrences are expanded.
+type icsEvent struct {
+	uid, summary, location, status string
+	organizer                      calendarAttendee
+	attendees                      []calendarAttendee
+	start, end                     time.Time
+	allDay                         bool
+	duration                       time.Duration
+	hasDuration                    bool
+	rrule                          string
+	exdates                        []time.Time
+	recurrenceID                   time.Time
+	// invalid events have a time that did not parse and are skipped.
+	invalid bool
+}
+
+// parseICS reads the events of an iCalendar file, skipping those whose
+// times do not parse. Times without a zone are taken in X-WR-TIMEZONE, or
+// time.Local; a TZID that is not an IANA name, such as Outlook's
+// "W. Europe Standard Time", is treated the same.
+func parseICS(data string) ([]icsEvent, error) {
+	props := icsLines(data)
+	if len(props) == 0 || props[0].name != "BEGIN" || !strings.EqualFold(props[0].value, "VCALENDAR") {
+		return nil, errors.New("not an iCalendar file")
+	}
+	loc := time.Local
+	for _, p := range props {
+		if p.name == "X-WR-TIMEZONE" {
+			if l, err := time.LoadLocation(strings.TrimSpace(p.value)); err == nil {
+				loc = l
+			}
+		}
+	}
+	var events []icsEvent
+	var stack []string
+	var ev *icsEvent
+	for _, p := range props {
+		switch p.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.value))
+			if stack[len(stack)-1] == "VEVENT" {
+				ev = &icsEvent{}
+			}
+			continue
+		case "END":
+			if len(stack) > 0 {
+				if stack[len(stack)-1] == "VEVENT" && ev != nil {
+					if !ev.start.IsZero() && !ev.invalid {
+						events = append(events, *ev)
+					}
+					ev = nil
+				}
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if ev == nil || len(stack) == 0 || stack[len(stack)-1] != "VEVENT" {
+			continue
+		}
+		switch p.name {
+		case "UID":
+			ev.uid = strings.TrimSpace(p.value)
+		case "SUMMARY":
+			ev.summary = icsText(p.value)
+		case "LOCATION":
+			ev.location = icsText(p.value)
+		case "STATUS":
+			ev.status = strings.ToUpper(strings.TrimSpace(p.value))
+		case "ORGANIZER":
+			ev.organizer = icsAttendee(p)
+		case "ATTENDEE":
+			if cu := strings.ToUpper(p.params["CUTYPE"]); cu != "ROOM" && cu != "RESOURCE" {
+				ev.attendees = append(ev.attendees, icsAttendee(p))
+			}
+		case "DTSTART":
+			t, allDay, err := icsTime(p, p.value, loc)
+			ev.start, ev.allDay, ev.invalid = t, allDay, ev.invalid || err != nil
+		case "DTEND":
+			t, _, err := icsTime(p, p.value, loc)
+			ev.end, ev.invalid = t, ev.invalid || err != nil
+		case "DURATION":
+			d, err := icsDuration(p.value)
+			ev.duration, ev.hasDuration, ev.invalid = d, true, ev.invalid || err != nil
+		case "RRULE":
+			ev.rrule = strings.TrimSpace(p.value)
+		case "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				if t, _, err := icsTime(p, v, loc); err == nil {
+					ev.exdates = append(ev.exdates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			if t, _, err := icsTime(p, p.value, loc); err == nil {
+				ev.recurrenceID = t
+			}
+		}
+	}
+	for i := range events {
+		e := &events[i]
+		switch {
+		case e.hasDuration:
+		case !e.end.IsZero():
+			e.duration = e.end.Sub(e.start)
+		case e.allDay:
+			e.duration = 24 * time.Hour
+		}
+		e.duration = max(e.duration, 0)
+	}
+	return events, nil
+}
+
+// icsAttendee reads an ATTENDEE or ORGANIZER: the CN parameter and the
+// mailto: address.
+func icsAttendee(p icsProp) calendarAttendee {
+	a := calendarAttendee{Name: strings.TrimSpace(p.params["CN"])}
+	if addr, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(p.value)), "mailto:"); ok {
+		a.Email = addr
+	}
+	if a.Name == a.Email {
+		a.Name = ""
+	}
+	return a
+}
+
+// icsTime parses a DATE or DATE-TIME value of p: UTC with a trailing Z, in
+// the TZID parameter's zone, or otherwise in loc.
+func icsTime(p icsProp, v string, loc *time.Location) (t time.Time, allDay bool, err error) {
+	v = strings.TrimSpace(v)
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	switch {
+	case p.params["VALUE"] == "DATE" || len(v) == 8:
+		t, err = time.ParseInLocation("20060102", v, loc)
+		allDay = true
+	case strings.HasSuffix(v, "Z"):
+		t, err = time.Parse("20060102T150405Z", v)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", v, loc)
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time %q", v)
+	}
+	return t, allDay, nil
+}
+
+var icsDurationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// icsDuration parses a DURATION value such as PT1H30M or P1D.
+func icsDuration(v string) (time.Duration, error) {
+	m := icsDurationPattern.FindStringSubmatch(strings.TrimSpace(v))
+	if m == nil || v == "P" || v == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// icsRule is a parsed RRULE. Only the parts meetings use are understood:
+// FREQ DAILY, WEEKLY, MONTHLY or YEARLY with INTERVAL, COUNT, UNTIL,
+// BYDAY and BYMONTHDAY.
+type icsRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []icsWeekday
+	byMonthDay []int
+}
+
+// icsWeekday is a BYDAY entry, e.g. 2TU for the second Tuesday; n is 0
+// for every such day.
+type icsWeekday struct {
+	n   int
+	day time.Weekday
+}
+
+var icsWeekdays = map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday}
+
+func parseICSRule(rule string, loc *time.Location) (icsRule, error) {
+	r := icsRule{interval: 1}
+	for _, part := range strings.Split(rule, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(v); err == nil && r.interval < 1 {
+				err = errors.New("interval must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, _, err = icsTime(icsProp{}, v, loc)
+			if err == nil && len(v) == 8 {
+				// A date includes the whole day.
+				r.until = r.until.Add(24*time.Hour - time.Second)
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				num := strings.TrimRight(d, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+				day, ok := icsWeekdays[strings.ToUpper(d[len(num):])]
+				n, nErr := 0, error(nil)
+				if num != "" {
+					n, nErr = strconv.Atoi(num)
+				}
+				if !ok || nErr != nil {
+					err = fmt.Errorf("invalid BYDAY %q", d)
+					break
+				}
+				r.byDay = append(r.byDay, icsWeekday{n, day})
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(v, ",") {
+				n, nErr := strconv.Atoi(d)
+				if nErr != nil || n == 0 || n < -31 || n > 31 {
+					err = fmt.Errorf("invalid BYMONTHDAY %q", d)
+					break
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "WKST":
+		default:
+			err = fmt.Errorf("unsupported rule part %s", k)
+		}
+		if err != nil {
+			return icsRule{}, err
+		}
+	}
+	if !slices.Contains([]string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}, r.freq) {
+		return icsRule{}, fmt.Errorf("unsupported frequency %q", r.freq)
+	}
+	return r, nil
+}
+
+// occurrences returns the starts of e's occurrences that end after from and
+// start before to. An event whose rule is not understood occurs once.
+func (e icsEvent) occurrences(from, to time.Time) []time.Time {
+	overlaps := func(t time.Time) bool { return t.Before(to) && t.Add(e.duration).After(from) }
+	rule, err := parseICSRule(e.rrule, e.start.Location())
+	if e.rrule == "" || err != nil {
+		if overlaps(e.start) {
+			return []time.Time{e.start}
+		}
+		return nil
+	}
+	var out []time.Time
+	n := 0
+	for period := 0; period < maxICSPeriods; period++ {
+		for _, t := range rule.period(e.start, period) {
+			if t.Before(e.start) {
+				continue
+			}
+			if n++; (rule.count > 0 && n > rule.count) || (!rule.until.IsZero() && t.After(rule.until)) || !t.Before(to) {
+				return out
+			}
+			if overlaps(t) && !slices.ContainsFunc(e.exdates, t.Equal) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// period returns the occurrences of r in its nth day, week, month or year
+// counted from start, in order, at start's time of day.
+func (r icsRule) period(start time.Time, n int) []time.Time {
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	loc := start.Location()
+	at := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, hh, mm, ss, 0, loc) }
+	step := n * r.interval
+	var out []time.Time
+	switch r.freq {
+	case "DAILY":
+		out = append(out, at(y, m, d+step))
+	case "WEEKLY":
+		// Weeks start on Monday.
+		monday := d - (int(start.Weekday())+6)%7 + 7*step
+		days := r.byDay
+		if len(days) == 0 {
+			days = []icsWeekday{{day: start.Weekday()}}
+		}
+		for _, wd := range days {
+			out = append(out, at(y, m, monday+(int(wd.day)+6)%7))
+		}
+	case "MONTHLY":
+		first := time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, loc)
+		out = monthDays(first, r.byDay, r.byMonthDay, d, at)
+	case "YEARLY":
+		if t := at(y+step, m, d); t.Day() == d {
+			out = append(out, t)
+		}
+	}
+	slices.SortFunc(out, func(a, b time.Time) int { return a.Compare(b) })
+	return out
+}
+
+// monthDays returns the days of the month starting at first picked by
+// byDay or byMonthDay, or day when neither is given.
+func monthDays(first time.Time, byDay []icsWeekday, byMonthDay []int, day int, at func(int, time.Month, int) time.Time) []time.Time {
+	y, m := first.Year(), first.Month()
+	last := time.Date(y, m+1, 0, 0, 0, 0, 0, first.Location()).Day()
+	var days []int
+	for _, n := range byMonthDay {
+		if n < 0 {
+			n = last + 1 + n
+		}
+		days = append(days, n)
+	}
+	for _, wd := range byDay {
+		firstDay := 1 + (int(wd.day)-int(first.Weekday())+7)%7
+		var matches []int
+		for d := firstDay; d <= last; d += 7 {
+			matches = append(matches, d)
+		}
+		switch {
+		case wd.n == 0:
+			days = append(days, matches...)
+		case wd.n > 0 && wd.n <= len(matches):
+			days = append(days, matches[wd.n-1])
+		case wd.n < 0 && -wd.n <= len(matches):
+			days = append(days, matches[len(matches)+wd.n])
+		}
+	}
+	if len(byDay) == 0 && len(byMonthDay) == 0 {
+		days = []int{day}
+	}
+	var out []time.Time
+	for _, d := range days {
+		if d >= 1 && d <= last && !slices.ContainsFunc(out, func(t time.Time) bool { return t.Day() == d }) {
+			out = append(out, at(y, m, d))
+		}
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func icsFile(events ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nX-WR-TIMEZONE:Europe/Berlin\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+}
+
+func TestParseICSEvent(t *testing.T) {
+	data := icsFile("BEGIN:VEVENT\r\n" +
+		"UID:abc@example.com\r\n" +
+		"SUMMARY:Budget review\\, Q3\r\n" +
+		"DTSTART;TZID=America/New_York:20240501T100000\r\n" +
+		"DURATION:PT1H30M\r\n" +
+		"LOCATION:https://meet.google.com/abc-defg-hij\r\n" +
+		"ORGANIZER;CN=Ada Lovelace:mailto:ada@example.com\r\n" +
+		"ATTENDEE;CN=\"Grace Hopper; Navy\";ROLE=REQ-PARTICIPANT:mailto:Grace@Example.com\r\n" +
+		"ATTENDEE;CUTYPE=ROOM;CN=Room 4:mailto:room4@example.com\r\n" +
+		"ATTENDEE:mailto:alan@example.com\r\n" +
+		"DESCRIPTION:A long description that is folded\r\n  across two lines\r\n" +
+		"BEGIN:VALARM\r\nTRIGGER:-PT10M\r\nSUMMARY:Not the title\r\nEND:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:holiday\r\nSUMMARY:Holiday\r\nDTSTART;VALUE=DATE:20240501\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:broken\r\nDTSTART:yesterday\r\nEND:VEVENT\r\n")
+	events, err := parseICS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events = %+v", events)
+	}
+	e := events[0]
+	ny, _ := time.LoadLocation("America/New_York")
+	if e.uid != "abc@example.com" || e.summary != "Budget review, Q3" || !e.start.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, ny)) || e.duration != 90*time.Minute {
+		t.Fatalf("event = %+v", e)
+	}
+	if e.organizer != (calendarAttendee{Name: "Ada Lovelace", Email: "ada@example.com"}) {
+		t.Fatalf("organizer = %+v", e.organizer)
+	}
+	want := []calendarAttendee{{Name: "Grace Hopper; Navy", Email: "grace@example.com"}, {Email: "alan@example.com"}}
+	if len(e.attendees) != 2 || e.attendees[0] != want[0] || e.attendees[1] != want[1] {
+		t.Fatalf("attendees = %+v", e.attendees)
+	}
+	if !events[1].allDay || events[1].duration != 24*time.Hour {
+		t.Fatalf("all-day event = %+v", events[1])
+	}
+	if _, err := parseICS("hello"); err == nil {
+		t.Fatal("parsed a file that is not iCalendar")
+	}
+}
+
+func TestICSRecurrences(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	day := func(m time.Month, d, h int) time.Time { return time.Date(2024, m, d, h, 0, 0, 0, berlin) }
+	from, to := day(time.January, 1, 0), day(time.December, 31, 0)
+	cases := []struct {
+		name, rule string
+		exdate     string
+		want       []time.Time
+	}{
+		{"weekly by day", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", "", []time.Time{day(3, 25, 10), day(3, 27, 10), day(4, 1, 10), day(4, 3, 10)}},
+		// 10:00 in Berlin on both sides of the switch to summer time.
+		{"daily with exdate", "FREQ=DAILY;UNTIL=20240401", "20240330T100000", []time.Time{day(3, 25, 10), day(3, 26, 10), day(3, 27, 10), day(3, 28, 10), day(3, 29, 10), day(3, 31, 10), day(4, 1, 10)}},
+		{"every other week", "FREQ=WEEKLY;INTERVAL=2;COUNT=3", "", []time.Time{day(3, 25, 10), day(4, 8, 10), day(4, 22, 10)}},
+		{"second Tuesday", "FREQ=MONTHLY;BYDAY=2TU;COUNT=3", "", []time.Time{day(4, 9, 10), day(5, 14, 10), day(6, 11, 10)}},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=2", "", []time.Time{day(3, 31, 10), day(4, 30, 10)}},
+		{"unsupported", "FREQ=HOURLY;COUNT=5", "", []time.Time{day(3, 25, 10)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			event := "BEGIN:VEVENT\r\nUID:x\r\nDTSTART;TZID=Europe/Berlin:20240325T100000\r\nDTEND;TZID=Europe/Berlin:20240325T103000\r\nRRULE:" + c.rule + "\r\n"
+			if c.exdate != "" {
+				event += "EXDATE;TZID=Europe/Berlin:" + c.exdate + "\r\n"
+			}
+			events, err := parseICS(icsFile(event + "END:VEVENT\r\n"))
+			if err != nil || len(events) != 1 {
+				t.Fatalf("events = %+v, %v", events, err)
+			}
+			got := events[0].occurrences(from, to)
+			if len(got) != len(c.want) {
+				t.Fatalf("occurrences = %v", got)
+			}
+			for i := range got {
+				if !got[i].Equal(c.want[i]) {
+					t.Fatalf("occurrence %d = %v, want %v", i, got[i], c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCalendarEventsMoveAndCancelOccurrences(t *testing.T) {
+	data := icsFile("BEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup\r\nDTSTART:20240506T080000Z\r\nDURATION:PT15M\r\nRRULE:FREQ=DAILY;COUNT=3\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:standup\r\nRECURRENCE-ID:20240507T080000Z\r\nSUMMARY:Standup (moved)\r\nDTSTART:20240507T090000Z\r\nDURATION:PT15M\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:standup\r\nRECURRENCE-ID:20240508T080000Z\r\nSTATUS:CANCELLED\r\nDTSTART:20240508T080000Z\r\nEND:VEVENT\r\n")
+	parsed, err := parseICS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := calendarEvents(parsed, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	if len(events) != 2 {
+		t.Fatalf("events = %+v", events)
+	}
+	titles := map[string]string{}
+	for _, ev := range events {
+		titles[ev.Start.Format("02 15:04")] = ev.Title
+	}
+	if titles["06 08:00"] != "Standup" || titles["07 09:00"] != "Standup (moved)" {
+		t.Fatalf("events = %v", titles)
+	}
+}
+
+func TestICSDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{"PT45M": 45 * time.Minute, "P1D": 24 * time.Hour, "P1W": 7 * 24 * time.Hour, "-PT15M": -15 * time.Minute, "PT1H30M20S": 90*time.Minute + 20*time.Second} {
+		if got, err := icsDuration(in); err != nil || got != want {
+			t.Errorf("icsDuration(%q) = %v, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"", "P", "PT", "1H", "PT1.5H"} {
+		if _, err := icsDuration(in); err == nil {
+			t.Errorf("icsDuration(%q) succeeded", in)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// importInfo records where an imported recording came from.
+type importInfo struct {
+	OriginalName string    `json:"originalName"`
+	SourcePath   string    `json:"sourcePath,omitempty"`
+	ImportedAt   time.Time `json:"importedAt"`
+}
+
+type importRequest struct {
+	Path       string `json:"path"`
+	Transcribe bool   `json:"transcribe"`
+	Engine     string `json:"engine"`
+	Model      string `json:"model"`
+	RecordedAt string `json:"recordedAt"`
+	// SourceURL, SourceTitle and EndedAt describe the tab the recording
+	// came from; see sourceInfo.
+	SourceURL   string `json:"sourceUrl"`
+	SourceTitle string `json:"sourceTitle"`
+	EndedAt     string `json:"endedAt"`
+	// Template is the session template to file the recording under.
+	Template string `json:"template"`
+}
+
+type importResult struct {
+	Session string   `json:"session"`
+	Files   []string `json:"files"`
+	Jobs    []string `json:"jobs,omitempty"`
+	// NotQueued says why files were not sent for transcription; see
+	// preflightTranscription.
+	NotQueued []string `json:"notQueued,omitempty"`
+}
+
+// importStem turns an original file name into a safe file stem.
+func importStem(name string) string {
+	stem := safeName(strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)))
+	if stem == "" {
+		return "recording"
+	}
+	return stem
+}
+
+// safeName keeps the letters, digits, dashes, underscores and dots of s,
+// with spaces as underscores, trimmed of leading and trailing dots and
+// underscores.
+func safeName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_', r == '.':
+			return r
+		case unicode.IsSpace(r):
+			return '_'
+		}
+		return -1
+	}, s)
+	return strings.Trim(s, "._")
+}
+
+// importLocalPathAllowed reports whether p lies inside one of the
+// directories listed in VIEWER_IMPORT_DIRS.
+func importLocalPathAllowed(p string) bool {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return false
+	}
+	for _, dir := range cfg().ImportDirs {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// importHandler serves POST /api/import. The audio arrives either as a
+// multipart "file" field or as {"path": ...} naming a file in one of the
+// VIEWER_IMPORT_DIRS. It is converted to WebM/Opus, stored as
+// imports/{id}/{name}.webm, or under VIEWER_NAMING_TEMPLATE in imports/,
+// and optionally queued for transcription.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := randomID()
+	var req importRequest
+	var info importInfo
+	var input string
+	var recorded *recordingTime
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, hdr, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "missing file field", bodyErrorStatus(err, http.StatusBadRequest))
+			return
+		}
+		defer file.Close()
+		if r.MultipartForm != nil {
+			defer r.MultipartForm.RemoveAll()
+		}
+		req.Transcribe, _ = strconv.ParseBool(r.FormValue("transcribe"))
+		req.Engine = r.FormValue("engine")
+		req.Model = r.FormValue("model")
+		req.RecordedAt = r.FormValue("recordedAt")
+		req.SourceURL = r.FormValue("sourceUrl")
+		req.SourceTitle = r.FormValue("sourceTitle")
+		req.EndedAt = r.FormValue("endedAt")
+		req.Template = r.FormValue("template")
+		info.OriginalName = filepath.Base(hdr.Filename)
+		if !isAudioFile(info.OriginalName) {
+			http.Error(w, "not an audio file", http.StatusBadRequest)
+			return
+		}
+		input = filepath.Join(tempDir(), "import-"+id+filepath.Ext(info.OriginalName))
+		defer os.Remove(input)
+		if _, err := writeFileAtomic(input, file); err != nil {
+			http.Error(w, err.Error(), bodyErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	} else {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if !filepath.IsAbs(req.Path) || !importLocalPathAllowed(req.Path) {
+			http.Error(w, "path is not inside an import directory", http.StatusForbidden)
+			return
+		}
+		if !isAudioFile(req.Path) {
+			http.Error(w, "not an audio file", http.StatusBadRequest)
+			return
+		}
+		input = filepath.Clean(req.Path)
+		info.OriginalName = filepath.Base(input)
+		info.SourcePath = input
+		if st, err := os.Stat(input); err == nil && req.RecordedAt == "" {
+			rt := newRecordingTime(st.ModTime())
+			recorded = &rt
+		}
+	}
+	if req.RecordedAt != "" {
+		rt, err := parseRecordingTime(req.RecordedAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recorded = &rt
+	}
+	source, err := parseSource(req.SourceURL, req.SourceTitle, req.EndedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var template sessionTemplate
+	if req.Template != "" {
+		mu.Lock()
+		template, err = findSessionTemplate(req.Template)
+		mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), templateStatus(err))
+			return
+		}
+	}
+	if req.Transcribe {
+		if req.Engine == "" {
+			req.Engine = cfg().DefaultEngine
+		}
+		if _, ok := cfg().Engines[req.Engine]; !ok {
+			http.Error(w, "unknown engine", http.StatusBadRequest)
+			return
+		}
+	}
+
+	converted := filepath.Join(tempDir(), "import-"+id+".out.webm")
+	defer os.Remove(converted)
+	if err := convertForStorage(r, input, converted); err != nil {
+		requestLogger(r).Warn("import conversion failed", "name", info.OriginalName, "err", err)
+		http.Error(w, "conversion failed", http.StatusUnprocessableEntity)
+		return
+	}
+
+	rel := path.Join("imports", id, importStem(info.OriginalName)+".webm")
+	info.ImportedAt = time.Now().UTC()
+
+	mu.Lock()
+	if cfg().NamingTemplate != "" {
+		// A template names the recording, so it needs no folder of its own.
+		rel = namedRecordingPath(path.Join("imports", path.Base(rel)), uploadName(info.OriginalName, recorded, source), nil)
+	}
+	meta := recordingMeta{Import: &info, Recorded: recorded, Source: source}
+	if req.Template != "" {
+		template.apply(&meta, req.Template)
+	}
+	err = storeImport(converted, absPath(rel), meta)
+	mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The duration policy runs before the response, which lists the parts.
+	files, err := splitLongRecording(r.Context(), absPath(rel))
+	if err != nil {
+		requestLogger(r).Error("duration policy", "path", rel, "err", err)
+	}
+	if files == nil {
+		files = []string{absPath(rel)}
+	}
+	res := importResult{Session: strings.TrimSuffix(rel, ".webm")}
+	for _, f := range files {
+		fileRel, _ := relPath(f)
+		res.Files = append(res.Files, fileRel)
+	}
+	requestLogger(r).Info("imported recording", "name", info.OriginalName, "path", rel)
+	publishEvent("recording.imported", rel, map[string]any{"originalName": info.OriginalName, "files": res.Files})
+	if req.Transcribe {
+		for _, f := range res.Files {
+			j, err := queueTranscribeJob(f, req.Engine, req.Model)
+			if err != nil {
+				res.NotQueued = append(res.NotQueued, f+": "+err.Error())
+				continue
+			}
+			res.Jobs = append(res.Jobs, j.ID)
+		}
+	}
+	writeJSONStatus(w, http.StatusCreated, res)
+}
+
+// convertForStorage writes input to out as WebM/Opus, the format the
+// extension records in. WebM input is copied as is.
+func convertForStorage(r *http.Request, input, out string) error {
+	if strings.EqualFold(filepath.Ext(input), ".webm") {
+		in, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = writeFileAtomic(out, in)
+		return err
+	}
+	output, err := runCommandFunc(r.Context(), cfg().FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", input,
+		"-vn", "-c:a", "libopus", "-b:a", "64k",
+		out,
+	)
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, outputTail(output))
+	}
+	return nil
+}
+
+// storeImport moves the converted file into place and writes its sidecar
+// metadata. Callers hold mu.
+func storeImport(converted, fullPath string, meta recordingMeta) error {
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(converted, fullPath); err != nil {
+		return err
+	}
+	trackFiles(fullPath)
+	return saveMeta(fullPath, meta)
+}
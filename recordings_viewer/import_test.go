@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportUploadConvertsAndQueuesTranscription(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{})
+	var ffmpegArgs []string
+	useRunCommand(t, func(_ context.Context, name string, a ...string) ([]byte, error) {
+		ffmpegArgs = a
+		return nil, os.WriteFile(a[len(a)-1], []byte("webm"), 0o644)
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "Zoom Meeting (1).m4a")
+	fw.Write([]byte("m4a data"))
+	mw.WriteField("transcribe", "true")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	importHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var res importResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(res.Session, "imports/") || !strings.HasSuffix(res.Session, "/Zoom_Meeting_1") || len(res.Files) != 1 || len(res.Jobs) != 1 {
+		t.Fatalf("result=%+v", res)
+	}
+	if argAfter(ffmpegArgs, "-c:a") != "libopus" {
+		t.Fatalf("ffmpeg args=%v", ffmpegArgs)
+	}
+	full := filepath.Join(dir, filepath.FromSlash(res.Files[0]))
+	meta, err := loadMeta(full)
+	if err != nil || meta.Import == nil || meta.Import.OriginalName != "Zoom Meeting (1).m4a" {
+		t.Fatalf("meta=%+v err=%v", meta, err)
+	}
+	if j, ok := jobs.get(res.Jobs[0]); !ok || j.Path != res.Files[0] {
+		t.Fatalf("job=%+v", j)
+	}
+	entries, _ := os.ReadDir(tempDir())
+	if len(entries) != 0 {
+		t.Fatalf("temp files left behind: %v", entries)
+	}
+}
+
+func TestImportLocalPathRequiresImportDir(t *testing.T) {
+	dir := useTempBaseDir(t)
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "call.webm"), []byte("webm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"path":"` + filepath.ToSlash(filepath.Join(src, "call.webm")) + `"}`
+
+	rec := httptest.NewRecorder()
+	importHandler(rec, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status without import dir=%d", rec.Code)
+	}
+
+	useConfig(t, func(c *config) { c.ImportDirs = []string{src} })
+	rec = httptest.NewRecorder()
+	importHandler(rec, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var res importResult
+	json.NewDecoder(rec.Body).Decode(&res)
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(res.Files[0])))
+	if err != nil || string(data) != "webm" {
+		t.Fatalf("imported webm should be copied as is: %q %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "call.webm")); err != nil {
+		t.Fatalf("source must be left in place: %v", err)
+	}
+}
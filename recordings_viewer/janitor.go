@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// janitorReport summarizes one janitor pass.
+type janitorReport struct {
+	RanAt          time.Time `json:"ranAt"`
+	ExpiredUploads int       `json:"expiredUploads"`
+	PartialFiles   int       `json:"partialFiles"`
+	TempOutputs    int       `json:"tempOutputs"`
+	FinishedJobs   int       `json:"finishedJobs"`
+	BytesFreed     int64     `json:"bytesFreed"`
+	Errors         []string  `json:"errors,omitempty"`
+}
+
+var janitorState struct {
+	sync.Mutex
+	last   *janitorReport
+	totals janitorReport
+}
+
+// tempDir holds scratch outputs such as transcodes; anything left there past
+// the janitor TTL is considered abandoned.
+func tempDir() string {
+	return filepath.Join(stateDir(), "tmp")
+}
+
+// runJanitor drops expired staged uploads and deletes *.tmp partial writes and
+// scratch outputs older than ttl, and forgets jobs that finished before
+// then.
+func runJanitor(now time.Time, ttl time.Duration) janitorReport {
+	report := janitorReport{RanAt: now.UTC()}
+	cutoff := now.Add(-ttl)
+
+	mu.Lock()
+	// Resumable uploads still in progress keep their partial data however
+	// long they have been idle.
+	live := map[string]bool{}
+	items, err := loadStagedUploads()
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		for id, up := range items {
+			if now.Before(up.ExpiresAt.Add(ttl)) {
+				if up.Resumable {
+					live[up.partPath()] = true
+				}
+				continue
+			}
+			if up.Backend == "local" {
+				removeStale(absPath(up.Path)+".tmp", cutoff, &report, &report.PartialFiles)
+			}
+			if up.Resumable {
+				removeStale(up.partPath(), cutoff, &report, &report.PartialFiles)
+			}
+			delete(items, id)
+			report.ExpiredUploads++
+		}
+		if report.ExpiredUploads > 0 {
+			if err := saveStagedUploads(items); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+		}
+	}
+
+	for _, ws := range workspaces() {
+		filepath.WalkDir(ws.Dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if p == tempDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(d.Name(), ".tmp") && !live[p] {
+				removeStale(p, cutoff, &report, &report.PartialFiles)
+			}
+			return nil
+		})
+	}
+	mu.Unlock()
+
+	entries, err := os.ReadDir(tempDir())
+	if err == nil {
+		for _, e := range entries {
+			removeStale(filepath.Join(tempDir(), e.Name()), cutoff, &report, &report.TempOutputs)
+		}
+	}
+
+	report.FinishedJobs = jobs.prune(cutoff)
+
+	janitorState.Lock()
+	janitorState.last = &report
+	janitorState.totals.ExpiredUploads += report.ExpiredUploads
+	janitorState.totals.PartialFiles += report.PartialFiles
+	janitorState.totals.TempOutputs += report.TempOutputs
+	janitorState.totals.FinishedJobs += report.FinishedJobs
+	janitorState.totals.BytesFreed += report.BytesFreed
+	janitorState.Unlock()
+	return report
+}
+
+// removeStale deletes p (recursively for directories) when it was last
+// modified before cutoff, updating the report counters.
+func removeStale(p string, cutoff time.Time, report *janitorReport, counter *int) {
+	info, err := os.Stat(p)
+	if err != nil || !info.ModTime().Before(cutoff) {
+		return
+	}
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+		filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if fi, err := d.Info(); err == nil {
+					size += fi.Size()
+				}
+			}
+			return nil
+		})
+	}
+	if err := os.RemoveAll(p); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return
+	}
+	*counter++
+	report.BytesFreed += size
+}
+
+// healthHandler serves GET /api/health with janitor statistics.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mu.Lock()
+	items, err := loadStagedUploads()
+	mu.Unlock()
+	staged := len(items)
+	if err != nil {
+		staged = -1
+	}
+
+	janitorState.Lock()
+	defer janitorState.Unlock()
+	writeJSON(w, map[string]any{
+		"status":        "ok",
+		"readOnly":      cfg().ReadOnly,
+		"stagedUploads": staged,
+		"janitor": map[string]any{
+			"lastRun": janitorState.last,
+			"totals":  janitorState.totals,
+		},
+	})
+}
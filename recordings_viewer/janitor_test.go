@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunJanitorRemovesStaleArtifacts(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "keep.txt", "uuid/clip/audio.webm.tmp", "fresh.txt.tmp")
+	if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+		t.Fatalf("mkdir temp: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir(), "transcode.wav"), []byte("pcm"), 0o644); err != nil {
+		t.Fatalf("write temp output: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for _, p := range []string{filepath.Join(dir, "uuid/clip/audio.webm.tmp"), filepath.Join(tempDir(), "transcode.wav")} {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	mu.Lock()
+	saveStagedUploads(map[string]stagedUpload{
+		"old": {ID: "old", Path: "gone.webm", Backend: "local", ExpiresAt: old},
+		"new": {ID: "new", Path: "soon.webm", Backend: "local", ExpiresAt: time.Now().Add(time.Hour)},
+	})
+	mu.Unlock()
+
+	report := runJanitor(time.Now(), 24*time.Hour)
+	if report.ExpiredUploads != 1 || report.PartialFiles != 1 || report.TempOutputs != 1 {
+		t.Fatalf("report=%+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fresh.txt.tmp")); err != nil {
+		t.Fatalf("fresh partial file should survive: %v", err)
+	}
+	mu.Lock()
+	items, _ := loadStagedUploads()
+	mu.Unlock()
+	if _, ok := items["new"]; !ok || len(items) != 1 {
+		t.Fatalf("staged uploads=%v", items)
+	}
+
+	rec := httptest.NewRecorder()
+	healthHandler(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	var health struct {
+		StagedUploads int `json:"stagedUploads"`
+		Janitor       struct {
+			LastRun *janitorReport `json:"lastRun"`
+		} `json:"janitor"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatalf("decode health: %v", err)
+	}
+	if health.StagedUploads != 1 || health.Janitor.LastRun == nil || health.Janitor.LastRun.TempOutputs != 1 {
+		t.Fatalf("health=%+v", health)
+	}
+}
+
+func TestRunJanitorForgetsFinishedJobs(t *testing.T) {
+	useTempBaseDir(t)
+	useJobQueue(t)
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	recent := time.Now().UTC()
+	for id, j := range map[string]*job{
+		"old":     {Status: jobCompleted, FinishedAt: &old},
+		"failed":  {Status: jobFailed, FinishedAt: &old},
+		"recent":  {Status: jobCompleted, FinishedAt: &recent},
+		"waiting": {Status: jobQueued},
+	} {
+		j.ID, j.Type, j.Path, j.CreatedAt = id, "keywords", id+".txt", old
+		jobs.enqueue(j)
+	}
+
+	if report := runJanitor(time.Now(), 24*time.Hour); report.FinishedJobs != 2 {
+		t.Fatalf("report=%+v", report)
+	}
+	var ids []string
+	for _, j := range jobs.list() {
+		ids = append(ids, j.ID)
+	}
+	if len(ids) != 2 || ids[0] == "old" || ids[1] == "old" || ids[0] == "failed" || ids[1] == "failed" {
+		t.Fatalf("jobs left=%v", ids)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// jobAggregate totals a set of jobs for the jobs dashboard. Durations run
+// from the start to the end of a job's last attempt, and queue latency from
+// its creation to that start.
+type jobAggregate struct {
+	Total              int     `json:"total"`
+	Queued             int     `json:"queued,omitempty"`
+	Running            int     `json:"running,omitempty"`
+	Completed          int     `json:"completed"`
+	Failed             int     `json:"failed"`
+	Canceled           int     `json:"canceled,omitempty"`
+	AvgDurationSeconds float64 `json:"avgDurationSeconds"`
+	AvgQueueSeconds    float64 `json:"avgQueueSeconds"`
+
+	durations, waits       time.Duration
+	timedRuns, timedStarts int
+}
+
+func (a *jobAggregate) add(j job) {
+	a.Total++
+	switch j.Status {
+	case jobQueued:
+		a.Queued++
+	case jobRunning:
+		a.Running++
+	case jobCompleted:
+		a.Completed++
+	case jobFailed:
+		a.Failed++
+	case jobCanceled:
+		a.Canceled++
+	}
+	if j.StartedAt == nil {
+		return
+	}
+	a.waits += j.StartedAt.Sub(j.CreatedAt)
+	a.timedStarts++
+	if j.FinishedAt != nil {
+		a.durations += j.FinishedAt.Sub(*j.StartedAt)
+		a.timedRuns++
+	}
+}
+
+// finish fills in the averages.
+func (a *jobAggregate) finish() {
+	if a.timedRuns > 0 {
+		a.AvgDurationSeconds = roundSeconds(a.durations / time.Duration(a.timedRuns))
+	}
+	if a.timedStarts > 0 {
+		a.AvgQueueSeconds = roundSeconds(a.waits / time.Duration(a.timedStarts))
+	}
+}
+
+func roundSeconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
+
+// jobsSummary is the payload of GET /api/jobs/summary.
+type jobsSummary struct {
+	jobAggregate
+	ByType map[string]*jobAggregate `json:"byType"`
+}
+
+// summarizeJobs totals jobs overall and per type.
+func summarizeJobs(list []job) jobsSummary {
+	sum := jobsSummary{ByType: map[string]*jobAggregate{}}
+	for _, j := range list {
+		sum.add(j)
+		agg, ok := sum.ByType[j.Type]
+		if !ok {
+			agg = &jobAggregate{}
+			sum.ByType[j.Type] = agg
+		}
+		agg.add(j)
+	}
+	sum.finish()
+	for _, agg := range sum.ByType {
+		agg.finish()
+	}
+	return sum
+}
+
+// jobBucket totals the jobs that finished in one period.
+type jobBucket struct {
+	Start time.Time `json:"start"`
+	jobAggregate
+}
+
+// bucketStart returns the start of the hour, day or week (from Monday)
+// containing t in loc.
+func bucketStart(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch bucket {
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case "week":
+		back := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-back, 0, 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// nextBucket returns the start of the period after the one starting at t.
+func nextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// jobHistory buckets the jobs that finished from the period containing
+// since up to now by the period they finished in, oldest first. Periods
+// without jobs are included so the series can be charted as it is.
+func jobHistory(list []job, bucket string, since, now time.Time, loc *time.Location) []jobBucket {
+	// The first period is counted whole.
+	since = bucketStart(since, bucket, loc)
+	byStart := map[int64]*jobBucket{}
+	var out []*jobBucket
+	for t := since; !t.After(now); t = nextBucket(t, bucket) {
+		b := &jobBucket{Start: t}
+		byStart[t.Unix()] = b
+		out = append(out, b)
+	}
+	for _, j := range list {
+		if j.FinishedAt == nil || j.FinishedAt.Before(since) || j.FinishedAt.After(now) {
+			continue
+		}
+		if b, ok := byStart[bucketStart(*j.FinishedAt, bucket, loc).Unix()]; ok {
+			b.add(j)
+		}
+	}
+	history := make([]jobBucket, len(out))
+	for i, b := range out {
+		b.finish()
+		history[i] = *b
+	}
+	return history
+}
+
+// jobsByType keeps the jobs of the ?type= given, or all of them.
+func jobsByType(list []job, typ string) []job {
+	if typ == "" {
+		return list
+	}
+	var out []job
+	for _, j := range list {
+		if j.Type == typ {
+			out = append(out, j)
+		}
+	}
+	return out
+}
+
+// jobsSummaryHandler serves GET /api/jobs/summary: job counts by status,
+// average run time and queue latency, overall and per type.
+func jobsSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, summarizeJobs(jobsByType(jobs.list(), r.URL.Query().Get("type"))))
+}
+
+// jobsHistoryHandler serves GET /api/jobs/history: the same totals for the
+// jobs finished in each ?bucket= (hour, day or week; default day) of the
+// last ?days= days (default 30), in the display time zone or ?tz=.
+func jobsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	bucket := q.Get("bucket")
+	switch bucket {
+	case "":
+		bucket = "day"
+	case "hour", "day", "week":
+	default:
+		http.Error(w, "bucket must be hour, day or week", http.StatusBadRequest)
+		return
+	}
+	days := 30
+	if raw := q.Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 366 {
+			http.Error(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	loc, err := displayTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+	writeJSON(w, jobHistory(jobsByType(jobs.list(), q.Get("type")), bucket, since, now, loc))
+}
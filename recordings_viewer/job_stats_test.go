@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// finishedJob returns a job created at created that waited wait and ran
+// for run.
+func finishedJob(typ, status string, created time.Time, wait, run time.Duration) *job {
+	start, end := created.Add(wait), created.Add(wait+run)
+	return &job{ID: randomID(), Type: typ, Status: status, CreatedAt: created, StartedAt: &start, FinishedAt: &end}
+}
+
+func TestJobsSummary(t *testing.T) {
+	useJobQueue(t)
+	now := time.Now().UTC()
+	jobs.enqueue(finishedJob("transcribe", jobCompleted, now.Add(-time.Hour), 10*time.Second, 60*time.Second))
+	jobs.enqueue(finishedJob("transcribe", jobFailed, now.Add(-time.Hour), 30*time.Second, 20*time.Second))
+	jobs.enqueue(finishedJob("keywords", jobCompleted, now.Add(-time.Hour), 2*time.Second, time.Second))
+	jobs.enqueue(&job{ID: randomID(), Type: "transcribe", Status: jobQueued, CreatedAt: now})
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/summary", nil))
+	var sum struct {
+		jobAggregate
+		ByType map[string]jobAggregate `json:"byType"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum.Total != 4 || sum.Completed != 2 || sum.Failed != 1 || sum.Queued != 1 {
+		t.Fatalf("summary = %+v", sum)
+	}
+	tr := sum.ByType["transcribe"]
+	if tr.Total != 3 || tr.AvgDurationSeconds != 40 || tr.AvgQueueSeconds != 20 {
+		t.Fatalf("transcribe = %+v", tr)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/summary?type=keywords", nil))
+	json.NewDecoder(rec.Body).Decode(&sum)
+	if sum.Total != 1 || sum.AvgDurationSeconds != 1 {
+		t.Fatalf("keywords summary = %+v", sum)
+	}
+}
+
+func TestJobHistoryBuckets(t *testing.T) {
+	loc := time.FixedZone("test", 2*3600)
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, loc) // a Wednesday
+	list := []job{
+		*finishedJob("transcribe", jobCompleted, time.Date(2024, 5, 8, 1, 0, 0, 0, loc), 0, time.Minute),
+		*finishedJob("transcribe", jobFailed, time.Date(2024, 5, 8, 9, 0, 0, 0, loc), 0, time.Minute),
+		*finishedJob("transcribe", jobCompleted, time.Date(2024, 5, 6, 23, 0, 0, 0, loc), 0, 3*time.Minute),
+		// Finished before the range.
+		*finishedJob("transcribe", jobCompleted, time.Date(2024, 4, 1, 9, 0, 0, 0, loc), 0, time.Minute),
+	}
+
+	days := jobHistory(list, "day", now.AddDate(0, 0, -3), now, loc)
+	if len(days) != 4 || !days[0].Start.Equal(time.Date(2024, 5, 5, 0, 0, 0, 0, loc)) {
+		t.Fatalf("days = %+v", days)
+	}
+	if d := days[1]; d.Completed != 1 || d.AvgDurationSeconds != 180 {
+		t.Fatalf("May 6 = %+v", d)
+	}
+	if d := days[3]; d.Total != 2 || d.Completed != 1 || d.Failed != 1 {
+		t.Fatalf("May 8 = %+v", d)
+	}
+
+	weeks := jobHistory(list, "week", now.AddDate(0, 0, -3), now, loc)
+	// May 5 is a Sunday, so the range starts in the week of April 29.
+	if len(weeks) != 2 || !weeks[0].Start.Equal(time.Date(2024, 4, 29, 0, 0, 0, 0, loc)) || weeks[1].Total != 3 {
+		t.Fatalf("weeks = %+v", weeks)
+	}
+}
+
+func TestJobsHistoryHandler(t *testing.T) {
+	useJobQueue(t)
+	jobs.enqueue(finishedJob("transcribe", jobCompleted, time.Now().Add(-time.Minute), 0, time.Second))
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/history?bucket=hour&days=1&tz=UTC", nil))
+	var buckets []jobBucket
+	json.NewDecoder(rec.Body).Decode(&buckets)
+	if rec.Code != http.StatusOK || len(buckets) < 24 || buckets[len(buckets)-1].Completed != 1 {
+		t.Fatalf("history = %d %s", rec.Code, rec.Body)
+	}
+	for _, q := range []string{"bucket=month", "days=0", "tz=Nowhere/Else"} {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/history?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s status = %d", q, rec.Code)
+		}
+	}
+}
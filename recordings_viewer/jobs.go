@@ -0,0 +1,970 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+// Job priorities: workers take interactive jobs, which someone is waiting
+// on, before batch work such as imports, scheduled re-runs, regeneration
+// and keyword extraction. Within a priority jobs run in submission order.
+const (
+	priorityBatch       = "batch"
+	priorityInteractive = "interactive"
+)
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobFinished = errors.New("job already finished")
+)
+
+// job is one unit of background work: a "transcribe" job transcribes an
+// audio file under baseDir, a "regenerate" job rebuilds a stale derived
+// artifact (see derived.go) and "waveform" and "spectrogram" jobs draw
+// one (see waveforms.go).
+type job struct {
+	ID            string     `json:"id"`
+	Type          string     `json:"type"`
+	Path          string     `json:"path"`
+	Engine        string     `json:"engine"`
+	Model         string     `json:"model"`
+	Range         *timeRange `json:"range,omitempty"`
+	SplitChannels bool       `json:"splitChannels,omitempty"`
+	Enhance       bool       `json:"enhance,omitempty"`
+	Language      string     `json:"language,omitempty"`
+	Priority      string     `json:"priority"`
+	// Cost is what a transcription by a paid engine is expected to cost,
+	// and Warnings what its checks found when it was queued anyway; see
+	// preflightTranscription.
+	Cost        float64    `json:"cost,omitempty"`
+	Warnings    []string   `json:"warnings,omitempty"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Timeout     float64    `json:"timeoutSeconds,omitempty"`
+	Output      []string   `json:"output,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Diagnostics string     `json:"diagnostics,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+
+	// cancelRequested is set when the job is canceled after being claimed
+	// but before runJob started it.
+	cancelRequested bool
+}
+
+func (j *job) rank() int {
+	if j.Priority == priorityInteractive {
+		return 1
+	}
+	return 0
+}
+
+// Worker pools: waveforms and spectrograms are drawn by their own few
+// workers, so opening a folder of new recordings neither waits behind
+// transcriptions nor starts an ffmpeg per recording.
+const (
+	poolGeneral = "general"
+	poolPreview = "preview"
+)
+
+// jobPool is the pool whose workers run jobs of type typ.
+func jobPool(typ string) string {
+	if typ == "waveform" || typ == "spectrogram" {
+		return poolPreview
+	}
+	return poolGeneral
+}
+
+// jobQueue holds jobs in submission order and wakes each pool's workers
+// when new work arrives. With a path set (see restore) the unfinished jobs
+// are saved there on every change.
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	order   []string
+	wake    map[string]chan struct{}
+	cancels map[string]context.CancelFunc
+	path    string
+	// stopping is set by interrupt: nothing more is claimed, and jobs
+	// canceled from then on stay running in the saved queue.
+	stopping bool
+}
+
+var jobs = newJobQueue()
+
+func newJobQueue() *jobQueue {
+	wake := map[string]chan struct{}{poolGeneral: make(chan struct{}, 1), poolPreview: make(chan struct{}, 1)}
+	return &jobQueue{jobs: map[string]*job{}, wake: wake, cancels: map[string]context.CancelFunc{}}
+}
+
+func jobQueuePath() string {
+	return filepath.Join(stateDir(), "jobs.json")
+}
+
+func (q *jobQueue) enqueue(j *job) {
+	if j.Priority == "" {
+		j.Priority = priorityBatch
+	}
+	q.mu.Lock()
+	q.jobs[j.ID] = j
+	q.order = append(q.order, j.ID)
+	q.save()
+	q.mu.Unlock()
+	q.notify()
+}
+
+// save writes the queued and running jobs to q.path, if the queue is
+// persisted. Callers hold q.mu.
+func (q *jobQueue) save() {
+	if q.path == "" {
+		return
+	}
+	pending := []*job{}
+	for _, id := range q.order {
+		if j := q.jobs[id]; j.Status == jobQueued || j.Status == jobRunning {
+			pending = append(pending, j)
+		}
+	}
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(q.path), 0o755)
+	}
+	if err == nil {
+		_, err = writeFileAtomic(q.path, strings.NewReader(string(data)+"\n"))
+	}
+	if err != nil {
+		slog.Error("persist job queue", "path", q.path, "err", err)
+	}
+}
+
+// restore loads the jobs saved at path and persists the queue there from
+// then on. Jobs that were running when the server stopped are queued again.
+func (q *jobQueue) restore(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []*job
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, j := range saved {
+		if _, ok := q.jobs[j.ID]; ok {
+			continue
+		}
+		if j.Status == jobRunning {
+			slog.Info("requeued interrupted job", "job", j.ID, "type", j.Type, "path", j.Path)
+			j.Status = jobQueued
+		}
+		q.jobs[j.ID] = j
+		q.order = append(q.order, j.ID)
+	}
+	if len(saved) > 0 {
+		q.notify()
+	}
+	return nil
+}
+
+// prune forgets the jobs that finished before cutoff and returns how many
+// it dropped. Only queued and running jobs are saved, so this only shrinks
+// memory and the job list.
+func (q *jobQueue) prune(cutoff time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kept := q.order[:0]
+	n := 0
+	for _, id := range q.order {
+		j := q.jobs[id]
+		if j.Status != jobQueued && j.Status != jobRunning && j.FinishedAt != nil && j.FinishedAt.Before(cutoff) {
+			delete(q.jobs, id)
+			n++
+			continue
+		}
+		kept = append(kept, id)
+	}
+	q.order = kept
+	return n
+}
+
+// notify wakes a worker of every pool to look for work.
+func (q *jobQueue) notify() {
+	for _, wake := range q.wake {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// claim marks the oldest queued job of the highest priority as running and
+// returns a copy of it.
+func (q *jobQueue) claim() (job, bool) {
+	return q.claimFrom("")
+}
+
+// claimFrom is claim for the workers of pool, or of every pool when pool
+// is empty.
+func (q *jobQueue) claimFrom(pool string) (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopping {
+		return job{}, false
+	}
+	var next *job
+	for _, id := range q.order {
+		if j := q.jobs[id]; j.Status == jobQueued && (pool == "" || jobPool(j.Type) == pool) && (next == nil || j.rank() > next.rank()) {
+			next = j
+		}
+	}
+	if next == nil {
+		return job{}, false
+	}
+	now := time.Now().UTC()
+	next.Status = jobRunning
+	next.Attempts++
+	next.StartedAt = &now
+	next.FinishedAt = nil
+	q.save()
+	return *next, true
+}
+
+// start returns the context a claimed job runs under, which cancel cancels,
+// and a func to call when the run is over.
+func (q *jobQueue) start(id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cancels[id] = cancel
+	if j, ok := q.jobs[id]; q.stopping || ok && j.cancelRequested {
+		cancel()
+	}
+	return ctx, func() {
+		q.mu.Lock()
+		delete(q.cancels, id)
+		q.mu.Unlock()
+		cancel()
+	}
+}
+
+// interrupt cancels the running jobs for shutdown. Unlike cancel it leaves
+// them running in the saved queue, so restore queues them again on the next
+// start without counting the interrupted attempt.
+func (q *jobQueue) interrupt() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stopping = true
+	for _, cancel := range q.cancels {
+		cancel()
+	}
+}
+
+// cancel stops job id. A queued job is canceled at once; a running one has
+// its context canceled, killing its subprocess, and runJob marks it
+// canceled when the run returns.
+func (q *jobQueue) cancel(id string) (job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return job{}, errJobNotFound
+	}
+	switch j.Status {
+	case jobQueued:
+		now := time.Now().UTC()
+		j.Status = jobCanceled
+		j.FinishedAt = &now
+		q.save()
+	case jobRunning:
+		j.cancelRequested = true
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+	default:
+		return *j, errJobFinished
+	}
+	return *j, nil
+}
+
+func (q *jobQueue) update(id string, fn func(*job)) (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	fn(j)
+	q.save()
+	return *j, true
+}
+
+func (q *jobQueue) get(id string) (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// pending reports whether a job of type typ for path is queued or running.
+func (q *jobQueue) pending(typ, path string) bool {
+	_, ok := q.findPending(typ, path)
+	return ok
+}
+
+// findPending returns a copy of the queued or running job of type typ for
+// path.
+func (q *jobQueue) findPending(typ, path string) (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		if j.Type == typ && j.Path == path && (j.Status == jobQueued || j.Status == jobRunning) {
+			return *j, true
+		}
+	}
+	return job{}, false
+}
+
+func (q *jobQueue) list() []job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]job, 0, len(q.order))
+	for _, id := range q.order {
+		out = append(out, *q.jobs[id])
+	}
+	return out
+}
+
+// engineConfig describes how to run one transcription engine and how long a
+// run may take before the watchdog kills it.
+type engineConfig struct {
+	Binary string
+	// RTF is the engine's typical real-time factor (processing time divided
+	// by audio duration) on this machine.
+	RTF float64
+	// TimeoutMultiple scales the expected runtime into the watchdog limit.
+	TimeoutMultiple float64
+	// MinTimeout is the floor for the watchdog limit, covering model load.
+	MinTimeout time.Duration
+	// Retries is how many extra attempts a failed job gets.
+	Retries int
+	// CostPerMinute is what the engine charges per minute of audio, for an
+	// engine that sends it to a paid API; zero for local ones.
+	CostPerMinute float64
+	// MaxDuration is the longest audio the engine accepts; zero is no
+	// limit.
+	MaxDuration time.Duration
+}
+
+// watchdogTimeout returns the kill deadline for a recording of duration d.
+// Unknown durations fall back to the minimum timeout times the multiple.
+func (e engineConfig) watchdogTimeout(d time.Duration) time.Duration {
+	expected := time.Duration(float64(d) * e.RTF * e.TimeoutMultiple)
+	if d <= 0 {
+		expected = time.Duration(float64(e.MinTimeout) * e.TimeoutMultiple)
+	}
+	if expected < e.MinTimeout {
+		return e.MinTimeout
+	}
+	return expected
+}
+
+// engineArgs builds the command line for engine. Output lands in outDir as
+// <stem>.json.
+func engineArgs(engine string, e engineConfig, audio, model, outDir string) (string, []string, error) {
+	switch engine {
+	case "whisper":
+		args := []string{audio, "--model", model, "--output_format", "json", "--output_dir", outDir}
+		if cfg().ModelDir != "" {
+			args = append(args, "--model_dir", cfg().ModelDir)
+		}
+		if cfg().WordTimestamps {
+			args = append(args, "--word_timestamps", "True")
+		}
+		device, _ := whisperDevice()
+		return e.Binary, append(args, whisperDeviceArgs(device)...), nil
+	default:
+		return "", nil, fmt.Errorf("unknown engine %q", engine)
+	}
+}
+
+// startJobWorkers runs n workers of pool until ctx is cancelled. A job
+// already running when ctx ends is allowed to finish so shutdown does not
+// discard half-done transcriptions.
+func startJobWorkers(ctx context.Context, pool string, n int) {
+	for i := 0; i < n; i++ {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			for {
+				if j, ok := jobs.claimFrom(pool); ok {
+					runJob(j)
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-jobs.wake[pool]:
+				}
+			}
+		}()
+	}
+}
+
+func runJob(j job) {
+	publishEvent("job.running", j.Path, map[string]any{"id": j.ID, "attempt": j.Attempts})
+	ctx, done := jobs.start(j.ID)
+	defer done()
+	var output []string
+	var timeout time.Duration
+	var err error
+	began := time.Now()
+	switch j.Type {
+	case "regenerate", "waveform", "spectrogram":
+		output, err = regenerate(ctx, j)
+	case "enhance":
+		output, err = enhance(ctx, j)
+	case "keywords":
+		var metaRel string
+		if _, metaRel, err = storeKeywords(ctx, j.Path); err == nil {
+			output = []string{metaRel}
+		}
+	case "chapters":
+		var metaRel string
+		if metaRel, err = storeChapters(ctx, j.Path); err == nil {
+			output = []string{metaRel}
+		}
+	case "split":
+		output, err = splitJob(ctx, j)
+	case "language":
+		if err = updateTranscriptLanguage(absPath(j.Path)); err == nil {
+			output = []string{j.Path}
+		}
+	default:
+		output, timeout, err = transcribe(ctx, j)
+	}
+	canceled := ctx.Err() != nil
+	final, _ := jobs.update(j.ID, func(cur *job) {
+		now := time.Now().UTC()
+		cur.FinishedAt = &now
+		cur.Timeout = timeout.Seconds()
+		if err == nil {
+			cur.Status = jobCompleted
+			cur.Output = output
+			cur.Error, cur.Diagnostics = "", ""
+			return
+		}
+		if canceled && jobs.stopping && !cur.cancelRequested {
+			cur.Attempts--
+			cur.FinishedAt = nil
+			cur.Error, cur.Diagnostics = "", ""
+			return
+		}
+		if canceled {
+			cur.Status = jobCanceled
+			cur.Error, cur.Diagnostics = "", ""
+			return
+		}
+		cur.Error = err.Error()
+		var diag *jobDiagnostics
+		if errors.As(err, &diag) {
+			cur.Diagnostics = diag.detail
+		}
+		if cur.Attempts <= cfg().Engines[cur.Engine].Retries {
+			cur.Status = jobQueued
+			return
+		}
+		cur.Status = jobFailed
+	})
+
+	if j.Cost > 0 && (final.Status == jobCompleted || final.Status == jobFailed) {
+		// The audio was sent whether or not a transcript came back.
+		if err := recordSpend(j.Cost, time.Now()); err != nil {
+			slog.Error("record spend", "job", j.ID, "err", err)
+		}
+	}
+	switch final.Status {
+	case jobCompleted:
+		slog.Info("job completed", "job", j.ID, "path", j.Path)
+		if j.Type == "transcribe" {
+			if audio, err := transcribedAudio(j); err == nil {
+				if err := recordThroughput(j, audio, time.Since(began)); err != nil {
+					slog.Error("record throughput", "job", j.ID, "err", err)
+				}
+			}
+			if cfg().WriteAudioTags {
+				tagTranscribedAudio(j.Path)
+			}
+			regenerateAfterChange(j.Path)
+			applyRulesAfterTranscription(j.Path)
+			checkAlertsAfterTranscription(j.Path)
+			summarizeAfterTranscription(j.Path)
+			queueKeywordsJob(j.Path)
+			chaptersAfterTranscription(j.Path)
+		}
+		publishEvent("job.completed", j.Path, map[string]any{"id": j.ID, "output": output})
+	case jobCanceled:
+		slog.Info("job canceled", "job", j.ID, "path", j.Path)
+		publishEvent("job.canceled", j.Path, map[string]any{"id": j.ID})
+	case jobRunning:
+		slog.Info("job interrupted by shutdown", "job", j.ID, "path", j.Path)
+	case jobQueued:
+		slog.Warn("job attempt failed, retrying", "job", j.ID, "attempt", j.Attempts, "err", err)
+		publishEvent("job.retrying", j.Path, map[string]any{"id": j.ID, "error": final.Error})
+		jobs.notify()
+	default:
+		slog.Error("job failed", "job", j.ID, "err", err)
+		publishEvent("job.failed", j.Path, map[string]any{"id": j.ID, "error": final.Error})
+	}
+}
+
+// jobDiagnostics carries captured process output alongside a job failure.
+type jobDiagnostics struct {
+	msg    string
+	detail string
+}
+
+func (d *jobDiagnostics) Error() string { return d.msg }
+
+// transcribe runs the job's engine under a watchdog and moves the resulting
+// transcript next to the audio as <stem>.json and <stem>.txt. A session
+// captured as several tracks has each track transcribed on its own and the
+// results merged, attributed to the track's speaker, and so are the two
+// channels of a stereo recording when the job splits them. Long audio is
+// transcribed in chunks; see runEngineChunked.
+func transcribe(ctx context.Context, j job) ([]string, time.Duration, error) {
+	engine, ok := cfg().Engines[j.Engine]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown engine %q", j.Engine)
+	}
+	audio := absPath(j.Path)
+	outDir := filepath.Join(tempDir(), "job-"+j.ID)
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(outDir)
+	defer dropPartialTranscript(j)
+
+	stem := strings.TrimSuffix(filepath.Base(audio), filepath.Ext(audio))
+	var tracks []sessionTrack
+	var inputs []string
+	if s, err := findSession(j.Path); err == nil && len(s.Tracks) > 1 {
+		tracks = s.Tracks
+		for _, tr := range tracks {
+			inputs = append(inputs, absPath(tr.Path))
+		}
+		stem = recordingStem(filepath.Base(audio))
+	} else if j.SplitChannels {
+		if tracks, inputs, err = splitChannels(ctx, j.Path, audio, outDir); err != nil {
+			return nil, 0, err
+		}
+	}
+	var raw []byte
+	var text string
+	var timeout time.Duration
+	if tracks == nil {
+		var err error
+		if raw, timeout, err = runEngineChunked(ctx, j, engine, audio, outDir); err != nil {
+			return nil, timeout, err
+		}
+		var parsed struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(raw, &parsed); err != nil {
+			return nil, timeout, fmt.Errorf("parse transcript: %w", err)
+		}
+		text = parsed.Text
+	} else {
+		parts := make([]trackTranscript, 0, len(tracks))
+		for i, tr := range tracks {
+			dir := filepath.Join(outDir, tr.Name)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, timeout, err
+			}
+			out, t, err := runEngineChunked(ctx, j, engine, inputs[i], dir)
+			timeout = max(timeout, t)
+			if err != nil {
+				return nil, timeout, fmt.Errorf("track %s: %w", tr.Name, err)
+			}
+			parts = append(parts, trackTranscript{Track: tr, Raw: out})
+		}
+		var err error
+		if raw, text, err = mergeTrackTranscripts(parts); err != nil {
+			return nil, timeout, fmt.Errorf("merge tracks: %w", err)
+		}
+	}
+
+	base := filepath.Join(filepath.Dir(audio), stem)
+	dir := filepath.ToSlash(filepath.Dir(j.Path))
+	outputs := []string{pathJoinRel(dir, stem+".json"), pathJoinRel(dir, stem+".txt")}
+	mu.Lock()
+	defer mu.Unlock()
+	if j.Range != nil {
+		existing, err := os.ReadFile(base + ".json")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, timeout, err
+		}
+		if err == nil {
+			if raw, text, err = mergeRangeTranscript(existing, raw, *j.Range); err != nil {
+				return nil, timeout, fmt.Errorf("merge range: %w", err)
+			}
+		}
+	}
+	for _, rel := range outputs {
+		if err := saveUndoVersion(rel); err != nil {
+			return nil, timeout, err
+		}
+	}
+	if _, err := writeFileAtomic(base+".json", strings.NewReader(string(raw))); err != nil {
+		return nil, timeout, err
+	}
+	if _, err := writeFileAtomic(base+".txt", strings.NewReader(strings.TrimSpace(text)+"\n")); err != nil {
+		return nil, timeout, err
+	}
+	meta, err := loadMeta(base + ".json")
+	if err != nil {
+		return nil, timeout, err
+	}
+	meta.Transcription = &transcriptionInfo{Engine: j.Engine, Model: j.Model, JobID: j.ID, Range: j.Range, Enhanced: j.Enhance, CompletedAt: time.Now().UTC()}
+	for _, tr := range tracks {
+		meta.Transcription.Tracks = append(meta.Transcription.Tracks, tr.Name)
+	}
+	if lang, ok := transcriptLanguage(base + ".json"); ok && (meta.Language == nil || meta.Language.Source != "manual") {
+		meta.Language = &lang
+	}
+	if err := saveMeta(base+".json", meta); err != nil {
+		return nil, timeout, err
+	}
+	return outputs, timeout, nil
+}
+
+// runEngine transcribes the audio file at audio, or the job's range of it,
+// into outDir and returns the engine's JSON with timestamps relative to
+// the whole recording, and the watchdog limit it ran under.
+func runEngine(ctx context.Context, j job, engine engineConfig, audio, outDir string) ([]byte, time.Duration, error) {
+	duration, err := probeDuration(audio)
+	if err != nil {
+		slog.Warn("using minimum watchdog timeout", "job", j.ID, "err", err)
+	}
+	if j.Range != nil {
+		duration = j.Range.length(duration)
+	}
+	timeout := engine.watchdogTimeout(duration)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	input := audio
+	// whisper-server only reads the 16 kHz WAV prepareForTranscription
+	// writes.
+	if j.Range != nil || j.Enhance || j.Engine == engineWhisperCpp {
+		if input, err = prepareForTranscription(ctx, audio, outDir, j.Range, j.Enhance); err != nil {
+			return nil, timeout, err
+		}
+	}
+	if j.Engine == engineWhisperCpp {
+		raw, err := transcribeWarm(ctx, engine, input, j.Model, j.Language)
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, timeout, &jobDiagnostics{
+				msg:    fmt.Sprintf("watchdog: stopped %s after %s", j.Engine, timeout.Round(time.Second)),
+				detail: fmt.Sprintf("audio duration %s × rtf %.2f × multiple %.1f (min %s)", duration.Round(time.Second), engine.RTF, engine.TimeoutMultiple, engine.MinTimeout),
+			}
+		}
+		if err != nil {
+			return nil, timeout, err
+		}
+		if j.Range != nil {
+			if raw, err = offsetTranscript(raw, j.Range.Start); err != nil {
+				return nil, timeout, fmt.Errorf("offset transcript: %w", err)
+			}
+		}
+		return raw, timeout, nil
+	}
+	name, args, err := engineArgs(j.Engine, engine, input, j.Model, outDir)
+	if err != nil {
+		return nil, timeout, err
+	}
+	if j.Language != "" {
+		args = append(args, "--language", j.Language)
+	}
+	out, err := runCommandLinesFunc(ctx, func(line string) {
+		if seg, ok := parseProgressLine(line); ok {
+			addPartialSegment(j, seg)
+		}
+	}, name, args...)
+	flushPartialTranscript(j)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, timeout, &jobDiagnostics{
+			msg: fmt.Sprintf("watchdog: killed %s after %s", j.Engine, timeout.Round(time.Second)),
+			detail: fmt.Sprintf("audio duration %s × rtf %.2f × multiple %.1f (min %s)\n%s",
+				duration.Round(time.Second), engine.RTF, engine.TimeoutMultiple, engine.MinTimeout, outputTail(out)),
+		}
+	}
+	if err != nil {
+		return nil, timeout, &jobDiagnostics{msg: fmt.Sprintf("%s: %v", j.Engine, err), detail: outputTail(out)}
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(audio), filepath.Ext(audio))
+	raw, err := os.ReadFile(filepath.Join(outDir, stem+".json"))
+	if err != nil {
+		return nil, timeout, &jobDiagnostics{msg: "engine produced no transcript", detail: outputTail(out)}
+	}
+	if j.Range != nil {
+		if raw, err = offsetTranscript(raw, j.Range.Start); err != nil {
+			return nil, timeout, fmt.Errorf("offset transcript: %w", err)
+		}
+	}
+	return raw, timeout, nil
+}
+
+func pathJoinRel(dir, name string) string {
+	if dir == "." || dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// outputTail keeps the last few lines of process output for diagnostics.
+func outputTail(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) > 20 {
+		lines = lines[len(lines)-20:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// transcribeHandler serves POST /api/transcribe with
+// {"path": "...", "model": "base", "engine": "whisper"} and queues a job.
+// "range": {"start": 3000, "end": 3600} transcribes only that part of the
+// recording, in seconds; without "end" it runs to the end. Jobs queued here
+// are interactive unless "priority" is "batch".
+func transcribeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		Path   string     `json:"path"`
+		Model  string     `json:"model"`
+		Engine string     `json:"engine"`
+		Range  *timeRange `json:"range"`
+		// SplitChannels defaults to cfg.SplitChannels.
+		SplitChannels *bool  `json:"splitChannels"`
+		Priority      string `json:"priority"`
+		// Enhance defaults to cfg.EnhanceAudio.
+		Enhance *bool `json:"enhance"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	switch payload.Priority {
+	case "":
+		payload.Priority = priorityInteractive
+	case priorityInteractive, priorityBatch:
+	default:
+		http.Error(w, "priority must be interactive or batch", http.StatusBadRequest)
+		return
+	}
+	if payload.Range != nil {
+		if err := payload.Range.check(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	cleanRel, fullPath, err := resolveRecordingPath(payload.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !isAudioFile(fullPath) {
+		http.Error(w, "not an audio file", http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	if payload.Engine == "" {
+		payload.Engine = cfg().DefaultEngine
+	}
+	if _, ok := cfg().Engines[payload.Engine]; !ok {
+		http.Error(w, "unknown engine", http.StatusBadRequest)
+		return
+	}
+	if payload.Range != nil {
+		// A range past the end would only fail once the job runs.
+		d, _ := probeDuration(fullPath)
+		rng, err := payload.Range.within(d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload.Range = &rng
+	}
+	opts := transcribeOptions{Range: payload.Range, SplitChannels: cfg().SplitChannels, Enhance: cfg().EnhanceAudio, Priority: payload.Priority}
+	if payload.SplitChannels != nil {
+		opts.SplitChannels = *payload.SplitChannels
+	}
+	if payload.Enhance != nil {
+		opts.Enhance = *payload.Enhance
+	}
+	j, err := queueTranscribeJobWith(filepath.ToSlash(cleanRel), payload.Engine, payload.Model, opts)
+	var pe *preflightError
+	if errors.As(err, &pe) {
+		http.Error(w, pe.msg, pe.status)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("queue transcription", "path", cleanRel, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONStatus(w, http.StatusAccepted, j)
+}
+
+// queueTranscribeJob enqueues a transcription of rel, falling back to the
+// default model when none is given.
+func queueTranscribeJob(rel, engine, model string) (*job, error) {
+	return queueTranscribeJobWith(rel, engine, model, transcribeOptions{SplitChannels: cfg().SplitChannels, Enhance: cfg().EnhanceAudio})
+}
+
+// transcribeOptions are the optional parts of a transcription request.
+type transcribeOptions struct {
+	// Range limits the transcription to part of the recording.
+	Range *timeRange
+	// SplitChannels transcribes the channels of a stereo recording
+	// separately; see splitChannels.
+	SplitChannels bool
+	// Enhance cleans up the audio first; see enhanceFilters.
+	Enhance bool
+	// Priority defaults to priorityBatch.
+	Priority string
+}
+
+// queueTranscribeJobWith enqueues a transcription of rel as opts say,
+// unless preflightTranscription rejects it. The model and language of the
+// recording's session template apply unless a model is asked for.
+func queueTranscribeJobWith(rel, engine, model string, opts transcribeOptions) (*job, error) {
+	language := ""
+	if t := recordingTemplate(rel); t != nil {
+		language = t.Language
+		if model == "" {
+			model = t.Model
+		}
+	}
+	if model == "" {
+		model = defaultModel()
+	}
+	cost, warnings, err := preflightTranscription(rel, engine, opts)
+	if err != nil {
+		slog.Info("transcription not queued", "path", rel, "engine", engine, "reason", err)
+		return nil, err
+	}
+	j := &job{
+		ID:            randomID(),
+		Type:          "transcribe",
+		Path:          rel,
+		Engine:        engine,
+		Model:         model,
+		Range:         opts.Range,
+		SplitChannels: opts.SplitChannels,
+		Enhance:       opts.Enhance,
+		Language:      language,
+		Priority:      opts.Priority,
+		Cost:          cost,
+		Warnings:      warnings,
+		Status:        jobQueued,
+		CreatedAt:     time.Now().UTC(),
+	}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path, "engine", j.Engine, "model", j.Model, "priority", j.Priority)
+	if len(warnings) > 0 {
+		slog.Warn("queued transcription despite checks", "job", j.ID, "path", j.Path, "warnings", warnings)
+	}
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+	return j, nil
+}
+
+// jobsHandler serves GET /api/jobs, GET /api/jobs/{id} and DELETE
+// /api/jobs/{id}, which cancels a job.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/")
+	if r.Method == http.MethodDelete && id != "" {
+		cancelJobHandler(w, r, id)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch id {
+	case "summary":
+		jobsSummaryHandler(w, r)
+		return
+	case "history":
+		jobsHistoryHandler(w, r)
+		return
+	case "budget":
+		jobsBudgetHandler(w, r)
+		return
+	}
+	if id == "" {
+		list := jobs.list()
+		sort.SliceStable(list, func(i, k int) bool { return list[i].CreatedAt.After(list[k].CreatedAt) })
+		writeJSON(w, list)
+		return
+	}
+	j, ok := jobs.get(id)
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, j)
+}
+
+// cancelJobHandler cancels job id: 200 with the canceled job if it was
+// still queued, 202 if it is running and will stop shortly.
+func cancelJobHandler(w http.ResponseWriter, r *http.Request, id string) {
+	j, err := jobs.cancel(id)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errJobFinished):
+		http.Error(w, fmt.Sprintf("job already %s", j.Status), http.StatusConflict)
+		return
+	}
+	requestLogger(r).Info("canceling job", "job", j.ID, "status", j.Status)
+	if j.Status == jobCanceled {
+		publishEvent("job.canceled", j.Path, map[string]any{"id": j.ID})
+		writeJSON(w, j)
+		return
+	}
+	writeJSONStatus(w, http.StatusAccepted, j)
+}
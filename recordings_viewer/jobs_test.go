@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useJobQueue(t *testing.T) {
+	t.Helper()
+	orig := jobs
+	jobs = newJobQueue()
+	t.Cleanup(func() {
+		jobs = orig
+	})
+}
+
+func useTestEngine(t *testing.T, e engineConfig) {
+	t.Helper()
+	e.Binary = "whisper"
+	useConfig(t, func(c *config) {
+		c.FFprobePath = "ffprobe"
+		c.Engines = map[string]engineConfig{"whisper": e}
+		c.DefaultEngine = "whisper"
+		c.DefaultModel = "base"
+	})
+}
+
+// fakeWhisper answers ffprobe with durationSecs and runs fn for whisper.
+func fakeWhisper(t *testing.T, durationSecs string, fn func(ctx context.Context, args []string) ([]byte, error)) {
+	t.Helper()
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ffprobe":
+			return []byte(durationSecs), nil
+		case "whisper":
+			return fn(ctx, args)
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	})
+}
+
+func argAfter(args []string, flag string) string {
+	for i, a := range args {
+		if a == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func queueTranscription(t *testing.T, path string) job {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path":"`+path+`"}`))
+	rec := httptest.NewRecorder()
+	transcribeHandler(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("queue status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	j, ok := jobs.claim()
+	if !ok {
+		t.Fatalf("no queued job")
+	}
+	return j
+}
+
+func TestWatchdogTimeout(t *testing.T) {
+	e := engineConfig{RTF: 0.5, TimeoutMultiple: 3, MinTimeout: time.Minute}
+	if got := e.watchdogTimeout(time.Hour); got != 90*time.Minute {
+		t.Fatalf("timeout for 1h=%s want 90m", got)
+	}
+	if got := e.watchdogTimeout(10 * time.Second); got != time.Minute {
+		t.Fatalf("timeout for 10s=%s want floor 1m", got)
+	}
+	if got := e.watchdogTimeout(0); got != 3*time.Minute {
+		t.Fatalf("timeout for unknown duration=%s want 3m", got)
+	}
+}
+
+func TestRunJobWritesTranscript(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "uuid/clip/audio.webm")
+	fakeWhisper(t, "60", func(_ context.Context, args []string) ([]byte, error) {
+		out := argAfter(args, "--output_dir")
+		return nil, os.WriteFile(filepath.Join(out, "audio.json"), []byte(`{"text":" hello there ","segments":[]}`), 0o644)
+	})
+
+	j := queueTranscription(t, "uuid/clip/audio.webm")
+	runJob(j)
+
+	got, _ := jobs.get(j.ID)
+	if got.Status != jobCompleted || got.Timeout != 180 {
+		t.Fatalf("job=%+v", got)
+	}
+	text, err := os.ReadFile(filepath.Join(dir, "uuid/clip/audio.txt"))
+	if err != nil || string(text) != "hello there\n" {
+		t.Fatalf("transcript=%q err=%v", text, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir(), "job-"+j.ID)); !os.IsNotExist(err) {
+		t.Fatalf("job scratch dir should be removed")
+	}
+}
+
+func TestRunJobWatchdogKillsHungEngineAndRetries(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 0.0001, TimeoutMultiple: 1, MinTimeout: 20 * time.Millisecond, Retries: 1})
+	writeTestFiles(t, dir, "hung.webm")
+	fakeWhisper(t, "1", func(ctx context.Context, _ []string) ([]byte, error) {
+		<-ctx.Done()
+		return []byte("loading model...\n"), ctx.Err()
+	})
+
+	j := queueTranscription(t, "hung.webm")
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobQueued {
+		t.Fatalf("after first attempt status=%s want retry", got.Status)
+	}
+	j, _ = jobs.claim()
+	runJob(j)
+
+	got, _ := jobs.get(j.ID)
+	if got.Status != jobFailed || got.Attempts != 2 {
+		t.Fatalf("job=%+v want failed after 2 attempts", got)
+	}
+	if !strings.HasPrefix(got.Error, "watchdog:") || !strings.Contains(got.Diagnostics, "loading model") {
+		t.Fatalf("error=%q diagnostics=%q", got.Error, got.Diagnostics)
+	}
+}
+
+func TestTranscribeHandlerRejectsNonAudio(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	writeTestFiles(t, dir, "notes.txt")
+	rec := httptest.NewRecorder()
+	transcribeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path":"notes.txt"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestClaimPrefersInteractiveJobs(t *testing.T) {
+	useJobQueue(t)
+	for _, j := range []*job{
+		{ID: "import", Status: jobQueued},
+		{ID: "rerun", Status: jobQueued, Priority: priorityBatch},
+		{ID: "user", Status: jobQueued, Priority: priorityInteractive},
+	} {
+		jobs.enqueue(j)
+	}
+	var order []string
+	for {
+		j, ok := jobs.claim()
+		if !ok {
+			break
+		}
+		order = append(order, j.ID)
+	}
+	if got := strings.Join(order, ","); got != "user,import,rerun" {
+		t.Fatalf("claimed %s", got)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute, Retries: 3})
+	writeTestFiles(t, dir, "long.webm", "next.webm")
+	started := make(chan struct{})
+	fakeWhisper(t, "60", func(ctx context.Context, _ []string) ([]byte, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	cancelJob := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		jobsHandler(rec, httptest.NewRequest(http.MethodDelete, "/api/jobs/"+id, nil))
+		return rec
+	}
+
+	j := queueTranscription(t, "long.webm")
+	done := make(chan struct{})
+	go func() {
+		runJob(j)
+		close(done)
+	}()
+	<-started
+	if rec := cancelJob(j.ID); rec.Code != http.StatusAccepted {
+		t.Fatalf("cancel running: %d %s", rec.Code, rec.Body)
+	}
+	<-done
+	// A canceled job is not retried.
+	if got, _ := jobs.get(j.ID); got.Status != jobCanceled || got.Error != "" {
+		t.Fatalf("job=%+v", got)
+	}
+	if rec := cancelJob(j.ID); rec.Code != http.StatusConflict {
+		t.Fatalf("cancel finished: %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	transcribeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path":"next.webm","priority":"batch"}`)))
+	queued := jobs.list()[1]
+	if queued.Priority != priorityBatch {
+		t.Fatalf("queued=%+v", queued)
+	}
+	if rec := cancelJob(queued.ID); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"canceled"`) {
+		t.Fatalf("cancel queued: %d %s", rec.Code, rec.Body)
+	}
+	if _, ok := jobs.claim(); ok {
+		t.Fatal("claimed a canceled job")
+	}
+	if rec := cancelJob("nope"); rec.Code != http.StatusNotFound {
+		t.Fatalf("cancel unknown: %d", rec.Code)
+	}
+}
+
+func TestJobQueueSurvivesRestart(t *testing.T) {
+	useTempBaseDir(t)
+	useJobQueue(t)
+	if err := jobs.restore(jobQueuePath()); err != nil {
+		t.Fatal(err)
+	}
+	jobs.enqueue(&job{ID: "a", Type: "transcribe", Path: "a.webm", Status: jobQueued})
+	jobs.enqueue(&job{ID: "b", Type: "transcribe", Path: "b.webm", Status: jobQueued})
+	jobs.enqueue(&job{ID: "c", Type: "transcribe", Path: "c.webm", Status: jobQueued})
+	jobs.claim()
+	jobs.update("b", func(j *job) { j.Status = jobCompleted })
+
+	restarted := newJobQueue()
+	if err := restarted.restore(jobQueuePath()); err != nil {
+		t.Fatal(err)
+	}
+	list := restarted.list()
+	if len(list) != 2 || list[0].ID != "a" || list[0].Status != jobQueued || list[0].Attempts != 1 || list[1].ID != "c" {
+		t.Fatalf("restored %+v", list)
+	}
+}
+
+func TestInterruptedJobIsRequeuedOnRestart(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	if err := jobs.restore(jobQueuePath()); err != nil {
+		t.Fatal(err)
+	}
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "long.webm", "next.webm")
+	started := make(chan struct{})
+	fakeWhisper(t, "60", func(ctx context.Context, _ []string) ([]byte, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	j := queueTranscription(t, "long.webm")
+	next := &job{ID: "next", Type: "transcribe", Path: "next.webm", Status: jobQueued}
+	jobs.enqueue(next)
+	done := make(chan struct{})
+	go func() {
+		runJob(j)
+		close(done)
+	}()
+	<-started
+	jobs.interrupt()
+	<-done
+	if got, _ := jobs.get(j.ID); got.Status != jobRunning || got.Attempts != 0 {
+		t.Fatalf("interrupted job=%+v", got)
+	}
+	if _, ok := jobs.claim(); ok {
+		t.Fatal("claimed a job while stopping")
+	}
+
+	restarted := newJobQueue()
+	if err := restarted.restore(jobQueuePath()); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := restarted.get(j.ID); !ok || got.Status != jobQueued {
+		t.Fatalf("restored %+v", restarted.list())
+	}
+	if got, ok := restarted.get("next"); !ok || got.Status != jobQueued {
+		t.Fatalf("restored %+v", restarted.list())
+	}
+}
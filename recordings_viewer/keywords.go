@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keywordLimit caps the keywords and entities kept for a transcript.
+const keywordLimit = 10
+
+// keywordInfo is what the keyword step extracted from a recording's
+// transcript, stored in its manifest.
+type keywordInfo struct {
+	Keywords []string `json:"keywords"`
+	Entities []string `json:"entities"`
+	Topics   []string `json:"topics"`
+	// Method is "tfidf" for the built-in extractor and "command" for
+	// VIEWER_KEYWORDS_COMMAND.
+	Method      string    `json:"method"`
+	ExtractedAt time.Time `json:"extractedAt"`
+}
+
+// stopWords are common English words that never make useful keywords.
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`
+		a about after again all also an and any are as at be because been before
+		being but by can could did do does doing done don down each even for from
+		get got had has have having he her here hers him his how i if in into is
+		it its just know let like made make many may me might more most much must
+		my no not now of off oh ok okay on once one only or other our out over
+		really right said same say see she should so some still such than that the
+		their them then there these they thing things think this those though
+		through to too under up us very want was way we well were what when where
+		which while who why will with would yeah yes you your going gonna kind lot
+		actually maybe sure something anything everything`) {
+		stopWords[w] = true
+	}
+	for w := range fillerWords {
+		stopWords[w] = true
+	}
+}
+
+// keywordTerms splits text into lowercase words that can be keywords:
+// at least three letters, and neither a stop word nor a number.
+func keywordTerms(text string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}) {
+		w = strings.Trim(w, "'")
+		if utf8.RuneCountInString(w) < 3 || stopWords[w] || strings.TrimFunc(w, unicode.IsDigit) == "" {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// transcriptText returns the text of the session's transcript.
+func transcriptText(s *session) (string, string, error) {
+	src := s.Transcript
+	if src == "" {
+		src = s.TranscriptJSON
+	}
+	if src == "" {
+		return "", "", errors.New("recording has no transcript")
+	}
+	doc, err := loadTranscriptDoc(absPath(src))
+	if err != nil {
+		return "", "", err
+	}
+	return src, doc.Text, nil
+}
+
+// documentFrequencies counts, for every term, the transcripts in the
+// library that use it, and returns the number of transcripts.
+func documentFrequencies() (map[string]int, int, error) {
+	sessions, err := scanSessions()
+	if err != nil {
+		return nil, 0, err
+	}
+	df := map[string]int{}
+	n := 0
+	for i := range sessions {
+		_, text, err := transcriptText(&sessions[i])
+		if err != nil {
+			continue
+		}
+		n++
+		seen := map[string]bool{}
+		for _, t := range keywordTerms(text) {
+			if !seen[t] {
+				seen[t] = true
+				df[t]++
+			}
+		}
+	}
+	return df, n, nil
+}
+
+// topKeywords ranks the terms of text by TF-IDF against the library, so
+// words every transcript uses rank below ones particular to this one.
+func topKeywords(text string, df map[string]int, docs int) []string {
+	tf := map[string]int{}
+	for _, t := range keywordTerms(text) {
+		tf[t]++
+	}
+	score := map[string]float64{}
+	terms := make([]string, 0, len(tf))
+	for t, n := range tf {
+		idf := math.Log(float64(1+docs)/float64(1+df[t])) + 1
+		score[t] = float64(n) * idf
+		terms = append(terms, t)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if score[terms[i]] != score[terms[j]] {
+			return score[terms[i]] > score[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > keywordLimit {
+		terms = terms[:keywordLimit]
+	}
+	return terms
+}
+
+// capitalizedRun matches runs of capitalized words, e.g. "Acme Corp".
+var capitalizedRun = regexp.MustCompile(`\p{Lu}[\p{L}\p{N}'’-]*(?:[ \t]+\p{Lu}[\p{L}\p{N}'’-]*)*`)
+
+// namedEntities guesses names of people, places and organizations as runs
+// of capitalized words. A single word capitalized only because it starts a
+// sentence is not counted, nor is a leading stop word ("The Acme Corp").
+// Entities mentioned most come first.
+func namedEntities(text string) []string {
+	count := map[string]int{}
+	var order []string
+	for _, loc := range capitalizedRun.FindAllStringIndex(text, -1) {
+		words := strings.Fields(text[loc[0]:loc[1]])
+		before := strings.TrimRight(text[:loc[0]], " \t\n\"'“‘(")
+		sentenceStart := before == "" || strings.ContainsAny(before[len(before)-1:], ".!?\n")
+		if stopWords[strings.ToLower(words[0])] {
+			words = words[1:]
+		} else if sentenceStart && len(words) == 1 {
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		run := strings.Join(words, " ")
+		if count[run] == 0 {
+			order = append(order, run)
+		}
+		count[run]++
+	}
+	sort.SliceStable(order, func(i, j int) bool { return count[order[i]] > count[order[j]] })
+	if len(order) > keywordLimit {
+		order = order[:keywordLimit]
+	}
+	return order
+}
+
+// matchTopics returns the configured topics (VIEWER_TOPICS) whose words
+// appear in text.
+func matchTopics(text string) []string {
+	terms := map[string]bool{}
+	for _, t := range keywordTerms(text) {
+		terms[t] = true
+	}
+	var out []string
+	for topic, words := range cfg().Topics {
+		for _, w := range words {
+			if terms[strings.ToLower(w)] {
+				out = append(out, topic)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// extractKeywords extracts keywords, entities and topics from the
+// transcript of the session s, with VIEWER_KEYWORDS_COMMAND when set and the
+// built-in TF-IDF extractor otherwise.
+func extractKeywords(ctx context.Context, s *session) (keywordInfo, error) {
+	src, text, err := transcriptText(s)
+	if err != nil {
+		return keywordInfo{}, err
+	}
+	info := keywordInfo{Method: "tfidf", ExtractedAt: time.Now().UTC()}
+	if len(cfg().KeywordsCommand) > 0 {
+		out, err := runArtifactCommand(ctx, cfg().KeywordsCommand, src)
+		if err != nil {
+			return keywordInfo{}, err
+		}
+		if err := json.Unmarshal(out, &info); err != nil {
+			return keywordInfo{}, fmt.Errorf("keywords command: %w", err)
+		}
+		info.Method = "command"
+	} else {
+		df, docs, err := documentFrequencies()
+		if err != nil {
+			return keywordInfo{}, err
+		}
+		info.Keywords = topKeywords(text, df, docs)
+		info.Entities = namedEntities(text)
+	}
+	info.Topics = normalizeTags(append(info.Topics, matchTopics(text)...))
+	for _, list := range []*[]string{&info.Keywords, &info.Entities, &info.Topics} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	return info, nil
+}
+
+// storeKeywords extracts the keywords of the session containing rel and
+// saves them in its manifest, whose path it returns.
+func storeKeywords(ctx context.Context, rel string) (keywordInfo, string, error) {
+	s, err := findSession(rel)
+	if err != nil {
+		return keywordInfo{}, "", err
+	}
+	info, err := extractKeywords(ctx, s)
+	if err != nil {
+		return keywordInfo{}, "", err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	meta, err := loadMeta(s.metaPath())
+	if err != nil {
+		return keywordInfo{}, "", err
+	}
+	meta.Keywords = &info
+	if err := saveMeta(s.metaPath(), meta); err != nil {
+		return keywordInfo{}, "", err
+	}
+	metaRel, _ := relPath(s.metaPath())
+	publishEvent("keywords.updated", s.ID, map[string]any{"topics": info.Topics})
+	return info, metaRel, nil
+}
+
+// queueKeywordsJob queues keyword extraction for the recording at rel after
+// its transcript changed, unless VIEWER_EXTRACT_KEYWORDS is off or a job for
+// it is already waiting.
+func queueKeywordsJob(rel string) {
+	if !cfg().ExtractKeywords || cfg().ReadOnly || jobs.pending("keywords", rel) {
+		return
+	}
+	j := &job{ID: randomID(), Type: "keywords", Path: rel, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path)
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+}
+
+// isTranscriptFile reports whether name is a transcript keywords are
+// extracted from.
+func isTranscriptFile(name string) bool {
+	kind := artifactKind(filepath.Base(name))
+	return kind == artifactTranscriptTxt || kind == artifactTranscriptJSON
+}
+
+// keywordsHandler serves GET /api/transcripts/{path}/keywords with the
+// stored keywords, extracting them without storing when there are none,
+// and POST to extract and store them again.
+func keywordsHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	switch r.Method {
+	case http.MethodGet:
+		s, err := findSession(rel)
+		if err != nil {
+			http.Error(w, "recording not found", http.StatusNotFound)
+			return
+		}
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if meta.Keywords != nil {
+			writeJSON(w, meta.Keywords)
+			return
+		}
+		info, err := extractKeywords(r.Context(), s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		writeJSON(w, info)
+	case http.MethodPost:
+		info, _, err := storeKeywords(r.Context(), rel)
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "recording not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		requestLogger(r).Info("extracted keywords", "path", rel, "method", info.Method)
+		writeJSON(w, info)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
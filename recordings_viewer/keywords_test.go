@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTranscripts(t *testing.T, dir string, texts map[string]string) {
+	t.Helper()
+	for name, text := range texts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTopKeywords(t *testing.T) {
+	// "meeting" is in every transcript, so "invoice" outranks it even
+	// though both appear twice.
+	df := map[string]int{"meeting": 3, "invoice": 1, "budget": 1}
+	got := topKeywords("The meeting was about the invoice. One more meeting, one more invoice, and the budget.", df, 3)
+	if len(got) < 3 || got[0] != "invoice" || got[1] != "meeting" {
+		t.Fatalf("keywords = %v", got)
+	}
+	for _, w := range got {
+		if stopWords[w] {
+			t.Fatalf("stop word %q in %v", w, got)
+		}
+	}
+}
+
+func TestNamedEntities(t *testing.T) {
+	got := namedEntities("Yesterday we called Acme Corp. The Acme Corp team met Jane Doe in Berlin. Then we left.")
+	want := []string{"Acme Corp", "Jane Doe", "Berlin"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("entities = %v, want %v", got, want)
+	}
+}
+
+func TestMatchTopics(t *testing.T) {
+	useConfig(t, func(c *config) {
+		c.Topics = map[string][]string{
+			"finance": {"invoice", "budget"},
+			"hiring":  {"candidate"},
+		}
+	})
+	if got := matchTopics("Please send the Invoice today."); !reflect.DeepEqual(got, []string{"finance"}) {
+		t.Fatalf("topics = %v", got)
+	}
+	if got := matchTopics("Nothing relevant."); len(got) != 0 {
+		t.Fatalf("topics = %v", got)
+	}
+}
+
+func TestKeywordsHandler(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) {
+		c.Topics = map[string][]string{"finance": {"invoice"}}
+	})
+	writeTestFiles(t, dir, "call.webm")
+	writeTranscripts(t, dir, map[string]string{
+		"call.txt":  "We talked to Acme Corp about the overdue invoice. The invoice is due Friday.",
+		"other.txt": "A short note about lunch.",
+	})
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/call.webm/keywords", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status = %d: %s", rec.Code, rec.Body)
+	}
+	var info keywordInfo
+	json.NewDecoder(rec.Body).Decode(&info)
+	if info.Method != "tfidf" || len(info.Keywords) == 0 || info.Keywords[0] != "invoice" {
+		t.Fatalf("keywords = %+v", info)
+	}
+	if !reflect.DeepEqual(info.Topics, []string{"finance"}) || !reflect.DeepEqual(info.Entities, []string{"Acme Corp", "Friday"}) {
+		t.Fatalf("keywords = %+v", info)
+	}
+	// GET alone stores nothing.
+	if meta, _ := loadMeta(filepath.Join(dir, "call.webm")); meta.Keywords != nil {
+		t.Fatal("GET stored keywords")
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/transcripts/call.webm/keywords", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST status = %d: %s", rec.Code, rec.Body)
+	}
+	meta, err := loadMeta(filepath.Join(dir, "call.webm"))
+	if err != nil || meta.Keywords == nil || meta.Keywords.Keywords[0] != "invoice" {
+		t.Fatalf("stored keywords = %+v, %v", meta.Keywords, err)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/missing.webm/keywords", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing recording status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/transcripts/other.txt/keywords", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST other status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestKeywordsCommand(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) {
+		c.KeywordsCommand = []string{"extract", "{src}"}
+		c.Topics = map[string][]string{"finance": {"invoice"}}
+	})
+	writeTranscripts(t, dir, map[string]string{"call.txt": "The invoice is late."})
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "extract" || args[0] != filepath.Join(dir, "call.txt") {
+			t.Fatalf("unexpected command %s %v", name, args)
+		}
+		return []byte(`{"keywords":["late invoice"],"topics":["Billing"]}`), nil
+	})
+
+	info, metaRel, err := storeKeywords(context.Background(), "call.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Method != "command" || !reflect.DeepEqual(info.Keywords, []string{"late invoice"}) {
+		t.Fatalf("keywords = %+v", info)
+	}
+	// The command's topics are kept alongside the configured ones.
+	if !reflect.DeepEqual(info.Topics, []string{"Billing", "finance"}) || info.Entities == nil {
+		t.Fatalf("keywords = %+v", info)
+	}
+	if metaRel != "call"+metaSuffix {
+		t.Fatalf("manifest = %s", metaRel)
+	}
+}
+
+func TestTopicFilter(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) {
+		c.Topics = map[string][]string{"finance": {"invoice"}, "hiring": {"candidate"}}
+	})
+	writeTranscripts(t, dir, map[string]string{
+		"a.txt": "The invoice for the candidate.",
+		"b.txt": "Another invoice.",
+		"c.txt": "Nothing here.",
+	})
+	for _, f := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, _, err := storeKeywords(context.Background(), f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?topic=finance", nil))
+	var sessions []session
+	json.NewDecoder(rec.Body).Decode(&sessions)
+	if len(sessions) != 2 || sessions[0].ID != "a" || sessions[1].ID != "b" {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts?topic=finance&topic=hiring", nil))
+	if !strings.Contains(rec.Body.String(), `"a.txt"`) || strings.Contains(rec.Body.String(), `"b.txt"`) {
+		t.Fatalf("transcripts = %s", rec.Body)
+	}
+}
+
+func TestKeywordsQueuedAfterSave(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	writeTestFiles(t, dir, "call.webm")
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/call.txt", strings.NewReader("The invoice from Acme Corp is late.")))
+	if rec.Code != http.StatusOK && rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body)
+	}
+	keywordJobs := func() []job {
+		t.Helper()
+		var ran []job
+		for _, j := range runQueuedJobs(t) {
+			if j.Type == "keywords" {
+				ran = append(ran, j)
+			}
+		}
+		return ran
+	}
+	ran := keywordJobs()
+	if len(ran) != 1 || ran[0].Status != jobCompleted {
+		t.Fatalf("jobs = %+v", ran)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "call.webm"))
+	if meta.Keywords == nil || !reflect.DeepEqual(meta.Keywords.Entities, []string{"Acme Corp"}) {
+		t.Fatalf("stored keywords = %+v", meta.Keywords)
+	}
+
+	useConfig(t, func(c *config) { c.ExtractKeywords = false })
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/call.txt", strings.NewReader("Changed.")))
+	if ran := keywordJobs(); len(ran) != 0 {
+		t.Fatalf("jobs queued with extraction off: %+v", ran)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// languageRules are the formatting conventions applied to a transcript's
+// text when it is exported.
+type languageRules struct {
+	// noSpaces languages (Chinese, Japanese) do not separate words, so the
+	// spaces whisper puts between segments and tokens are removed.
+	noSpaces bool
+	// rtl text gets right-to-left marks so punctuation at the line ends is
+	// placed correctly by players and editors.
+	rtl bool
+	// terminators end a sentence; spaceAfter requires whitespace (or the
+	// end of the text) after one, which keeps "3.5" and "e.g." intact.
+	terminators string
+	spaceAfter  bool
+	// maxCue is the length in characters above which a subtitle cue holding
+	// several sentences is split.
+	maxCue int
+}
+
+var languageNames = map[string]string{
+	"english": "en", "chinese": "zh", "mandarin": "zh", "cantonese": "yue", "japanese": "ja", "korean": "ko",
+	"arabic": "ar", "hebrew": "he", "persian": "fa", "urdu": "ur", "hindi": "hi", "greek": "el", "armenian": "hy",
+}
+
+// languageCode reduces whisper's language field ("zh", "Chinese", "pt-BR")
+// to a lowercase base code.
+func languageCode(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if code, ok := languageNames[lang]; ok {
+		return code
+	}
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+func rulesFor(lang string) languageRules {
+	r := languageRules{terminators: ".!?…", spaceAfter: true, maxCue: 84}
+	switch languageCode(lang) {
+	case "zh", "ja", "yue":
+		r = languageRules{noSpaces: true, terminators: "。！？!?…", maxCue: 32}
+	case "ar", "fa", "ur", "ps", "sd", "ug":
+		r.rtl = true
+		r.terminators = ".!?؟۔"
+	case "he", "iw", "yi":
+		r.rtl = true
+	case "hi", "mr", "ne", "bn", "sa":
+		r.terminators = "।॥.!?"
+	case "el":
+		// Greek uses ";" as its question mark.
+		r.terminators = ".!;…"
+	case "hy":
+		r.terminators = "։.!?"
+	}
+	return r
+}
+
+// isCJK reports whether r is a Han, kana or CJK punctuation character.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// tidy trims text, collapses runs of whitespace and, for languages without
+// word spacing, drops whitespace between two CJK characters.
+func (l languageRules) tidy(text string) string {
+	fields := strings.Fields(text)
+	if !l.noSpaces || len(fields) == 0 {
+		return strings.Join(fields, " ")
+	}
+	var b strings.Builder
+	b.WriteString(fields[0])
+	for i := 1; i < len(fields); i++ {
+		prev, _ := utf8.DecodeLastRuneInString(fields[i-1])
+		next, _ := utf8.DecodeRuneInString(fields[i])
+		if !isCJK(prev) || !isCJK(next) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fields[i])
+	}
+	return b.String()
+}
+
+// mark wraps right-to-left text in RLM marks.
+func (l languageRules) mark(text string) string {
+	if !l.rtl || text == "" {
+		return text
+	}
+	return "\u200f" + text + "\u200f"
+}
+
+var sentenceClosers = "\"'”’)]}」』）"
+
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "st": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true, "approx": true,
+}
+
+// sentences splits tidied text at the language's sentence terminators,
+// keeping closing quotes and brackets with the sentence they end.
+func (l languageRules) sentences(text string) []string {
+	var out []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !strings.ContainsRune(l.terminators, runes[i]) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (strings.ContainsRune(l.terminators, runes[end]) || strings.ContainsRune(sentenceClosers, runes[end])) {
+			end++
+		}
+		if l.spaceAfter {
+			if end < len(runes) && !unicode.IsSpace(runes[end]) {
+				continue
+			}
+			if runes[i] == '.' && l.isAbbreviation(runes[start:i]) {
+				continue
+			}
+		}
+		if s := strings.TrimSpace(string(runes[start:end])); s != "" {
+			out = append(out, s)
+		}
+		start = end
+		i = end - 1
+	}
+	if s := strings.TrimSpace(string(runes[start:])); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// isAbbreviation reports whether the word before a full stop is a known
+// abbreviation or a single-letter initial.
+func (l languageRules) isAbbreviation(before []rune) bool {
+	word := string(before)
+	if i := strings.LastIndexFunc(word, unicode.IsSpace); i >= 0 {
+		word = word[i+1:]
+	}
+	word = strings.ToLower(strings.TrimLeft(word, sentenceClosers+"(["))
+	return abbreviations[word] || utf8.RuneCountInString(word) == 1 && unicode.IsLetter([]rune(word)[0])
+}
+
+// localizeTranscript applies the formatting rules of doc's language for
+// export: the text becomes one tidied sentence per line, and long segments
+// holding several sentences are split into one cue per sentence with the
+// time shared out by length.
+func localizeTranscript(doc transcriptDoc) transcriptDoc {
+	l := rulesFor(doc.Language)
+	out := doc
+	var lines []string
+	for _, s := range l.sentences(l.tidy(doc.Text)) {
+		lines = append(lines, l.mark(s))
+	}
+	out.Text = strings.Join(lines, "\n")
+
+	out.Segments = make([]segment, 0, len(doc.Segments))
+	for _, seg := range doc.Segments {
+		text := l.tidy(seg.Text)
+		parts := []string{text}
+		if utf8.RuneCountInString(text) > l.maxCue && seg.End > seg.Start {
+			if s := l.sentences(text); len(s) > 1 {
+				parts = s
+			}
+		}
+		total := 0
+		for _, p := range parts {
+			total += utf8.RuneCountInString(p)
+		}
+		start, done := seg.Start, 0
+		for i, p := range parts {
+			done += utf8.RuneCountInString(p)
+			end := seg.End
+			if i < len(parts)-1 {
+				end = seg.Start + (seg.End-seg.Start)*float64(done)/float64(total)
+			}
+			out.Segments = append(out.Segments, segment{ID: len(out.Segments), Start: start, End: end, Text: l.mark(p)})
+			start = end
+		}
+	}
+	return out
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// minDetectLetters is the fewest letters a transcript needs for its
+// language to be guessed.
+const minDetectLetters = 20
+
+// languageInfo is the language of a recording's transcript, stored in its
+// manifest.
+type languageInfo struct {
+	// Code is a lowercase base code such as "en" or "ja".
+	Code string `json:"code"`
+	// Source is "whisper" when the engine reported it, "detected" when the
+	// server guessed it from the text, and "manual" when set by hand.
+	Source     string    `json:"source"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// scriptLanguages attributes letters of a script to the language most
+// transcripts written in it are in.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	code   string
+}{
+	{unicode.Hangul, "ko"}, {unicode.Thai, "th"}, {unicode.Hebrew, "he"},
+	{unicode.Greek, "el"}, {unicode.Armenian, "hy"}, {unicode.Georgian, "ka"},
+	{unicode.Devanagari, "hi"}, {unicode.Bengali, "bn"}, {unicode.Tamil, "ta"},
+}
+
+// latinProfiles are the most frequent short words of languages written in
+// the Latin alphabet, which tell them apart in running speech.
+var latinProfiles = map[string][]string{
+	"en": strings.Fields("the and is of to in that it you was for this have are with not"),
+	"es": strings.Fields("el la de que y en los se del las un por con una es no"),
+	"fr": strings.Fields("le la les de et est des que une pour pas dans qui je il ce"),
+	"de": strings.Fields("der die das und ist nicht ich zu den mit sie es ein auf auch"),
+	"it": strings.Fields("il di che la per non un una sono del della è ma io questo"),
+	"pt": strings.Fields("o a de que e do da não um uma para com os é no se"),
+	"nl": strings.Fields("de het een en van ik niet dat is je op te zijn met"),
+	"sv": strings.Fields("och att det som en är på jag inte för med har av till"),
+}
+
+// latinWords maps each profile word to the languages using it.
+var latinWords = map[string][]string{}
+
+func init() {
+	for code, words := range latinProfiles {
+		for _, w := range words {
+			latinWords[w] = append(latinWords[w], code)
+		}
+	}
+}
+
+// detectLanguage guesses the language of text: from its script when one
+// language dominates it, and from the frequency of common words for
+// Latin-alphabet text. It returns "" when the text is too short or no
+// language stands out.
+func detectLanguage(text string) string {
+	var letters, latin, cyrillic, arabic, han, kana int
+	scripts := map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					scripts[s.code]++
+					break
+				}
+			}
+		}
+	}
+	if letters < minDetectLetters {
+		return ""
+	}
+	half := letters / 2
+	switch {
+	// Japanese mixes kanji with kana; Chinese has no kana at all.
+	case kana > 0 && kana+han > half:
+		return "ja"
+	case han > half:
+		return "zh"
+	case cyrillic > half:
+		if strings.ContainsAny(text, "іїєґІЇЄҐ") {
+			return "uk"
+		}
+		return "ru"
+	case arabic > half:
+		switch {
+		case strings.ContainsAny(text, "ٹڈڑںے"):
+			return "ur"
+		case strings.ContainsAny(text, "پچژگ"):
+			return "fa"
+		}
+		return "ar"
+	case latin > half:
+		return detectLatinLanguage(text)
+	}
+	for code, n := range scripts {
+		if n > half {
+			return code
+		}
+	}
+	return ""
+}
+
+// detectLatinLanguage picks the profile whose common words text uses most,
+// provided it clearly leads the runner-up.
+func detectLatinLanguage(text string) string {
+	hits := map[string]int{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for _, code := range latinWords[w] {
+			hits[code]++
+		}
+	}
+	codes := make([]string, 0, len(hits))
+	for code := range hits {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if hits[codes[i]] != hits[codes[j]] {
+			return hits[codes[i]] > hits[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	if len(codes) == 0 || hits[codes[0]] < 3 {
+		return ""
+	}
+	if len(codes) > 1 && float64(hits[codes[0]]) < 1.2*float64(hits[codes[1]]) {
+		return ""
+	}
+	return codes[0]
+}
+
+// transcriptLanguage returns the language of the transcript at fullPath:
+// whisper's when the JSON transcript has one, otherwise a guess from the
+// text.
+func transcriptLanguage(fullPath string) (languageInfo, bool) {
+	doc, err := loadTranscriptDoc(fullPath)
+	if err != nil {
+		return languageInfo{}, false
+	}
+	info := languageInfo{Code: languageCode(doc.Language), Source: "whisper", DetectedAt: time.Now().UTC()}
+	if info.Code == "" {
+		info.Code, info.Source = detectLanguage(doc.Text), "detected"
+	}
+	return info, info.Code != ""
+}
+
+// updateTranscriptLanguage stores the language of the transcript at
+// fullPath in its manifest, keeping one set by hand. The transcript is read
+// without mu, which is only taken to update the manifest; callers must not
+// hold it.
+func updateTranscriptLanguage(fullPath string) error {
+	info, ok := transcriptLanguage(fullPath)
+	if !ok {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		return err
+	}
+	if meta.Language != nil && meta.Language.Source == "manual" {
+		return nil
+	}
+	meta.Language = &info
+	return saveMeta(fullPath, meta)
+}
+
+// queueLanguageJob queues a job detecting the language of the transcript
+// at rel.
+func queueLanguageJob(rel string) {
+	if cfg().ReadOnly || jobs.pending("language", rel) {
+		return
+	}
+	j := &job{ID: randomID(), Type: "language", Path: rel, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path)
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+}
+
+// languageHandler serves GET /api/transcripts/{path}/language with the
+// recording's stored language, PUT with {"language": "ja"} to set it by
+// hand, and POST to detect it again, replacing one set by hand.
+func languageHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	fullPath := absPath(rel)
+	switch r.Method {
+	case http.MethodGet:
+		meta, err := loadMeta(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if meta.Language == nil {
+			http.Error(w, "language unknown", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, meta.Language)
+	case http.MethodPut, http.MethodPost:
+		var info languageInfo
+		if r.Method == http.MethodPut {
+			var payload struct {
+				Language string `json:"language"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			info = languageInfo{Code: languageCode(payload.Language), Source: "manual", DetectedAt: time.Now().UTC()}
+			if info.Code == "" {
+				http.Error(w, "missing language", http.StatusBadRequest)
+				return
+			}
+		} else {
+			s, err := findSession(rel)
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "recording not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			src := s.TranscriptJSON
+			if src == "" {
+				src = s.Transcript
+			}
+			var ok bool
+			if info, ok = transcriptLanguage(absPath(src)); src == "" || !ok {
+				http.Error(w, "could not detect the transcript's language", http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		meta, err := loadMeta(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		meta.Language = &info
+		if err := saveMeta(fullPath, meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestLogger(r).Info("updated language", "path", rel, "language", info.Code, "source", info.Source)
+		publishEvent("language.updated", rel, map[string]any{"language": info.Code})
+		writeJSON(w, info)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// matchesLanguage reports whether code is one of the wanted ?lang= codes;
+// no codes match everything.
+func matchesLanguage(code string, want []string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, w := range want {
+		if languageCode(w) == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"So the plan is that we ship it on Friday, and you are in charge of the release notes for this.": "en",
+		"Entonces el plan es que lo enviamos el viernes y tú te encargas de las notas de la versión.":    "es",
+		"Alors le plan est que nous le livrons vendredi et tu es chargé des notes pour la version.":      "fr",
+		"Also der Plan ist, dass wir es am Freitag ausliefern und du bist für die Notizen zuständig.":    "de",
+		"それでは金曜日にリリースする予定です。リリースノートはあなたが担当してください。":                                                       "ja",
+		"那么计划是我们在星期五发布，你负责编写这次发布的说明文档和相关材料。":                                                             "zh",
+		"그러면 금요일에 출시할 계획이고 릴리스 노트는 당신이 맡아 주세요.":                                                          "ko",
+		"Итак, план такой: мы выпускаем в пятницу, а ты отвечаешь за примечания.":                        "ru",
+		"Отже, план такий: ми випускаємо в пʼятницю, а ти відповідаєш за примітки.":                      "uk",
+		"إذن الخطة هي أن نطلق الإصدار يوم الجمعة وأنت مسؤول عن الملاحظات.":                               "ar",
+		"Too short.": "",
+	}
+	for text, want := range cases {
+		if got := detectLanguage(text); got != want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestLanguageStoredOnSave(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useConfig(t, func(c *config) { c.ExtractKeywords = false })
+	writeTestFiles(t, dir, "call.webm", "meeting.webm")
+
+	put := func(path, body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s status = %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+	put("/api/transcripts/call.txt", "それでは金曜日にリリースする予定です。リリースノートはあなたが担当してください。")
+	put("/api/transcripts/meeting.json", `{"language":"en","text":" Short.","segments":[]}`)
+	for _, j := range runQueuedJobs(t) {
+		if j.Type != "language" || j.Status != jobCompleted {
+			t.Fatalf("job = %+v", j)
+		}
+	}
+
+	meta, _ := loadMeta(filepath.Join(dir, "call.webm"))
+	if meta.Language == nil || meta.Language.Code != "ja" || meta.Language.Source != "detected" {
+		t.Fatalf("call language = %+v", meta.Language)
+	}
+	meta, _ = loadMeta(filepath.Join(dir, "meeting.webm"))
+	if meta.Language == nil || meta.Language.Code != "en" || meta.Language.Source != "whisper" {
+		t.Fatalf("meeting language = %+v", meta.Language)
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts?lang=ja", nil))
+	var items []transcript
+	json.NewDecoder(rec.Body).Decode(&items)
+	for _, it := range items {
+		if !strings.HasPrefix(it.ID, "call.") || it.Language != "ja" {
+			t.Fatalf("?lang=ja listed %+v", it)
+		}
+	}
+	if len(items) == 0 {
+		t.Fatal("?lang=ja listed nothing")
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?lang=en&lang=fr", nil))
+	var sessions []session
+	json.NewDecoder(rec.Body).Decode(&sessions)
+	if len(sessions) != 1 || sessions[0].ID != "meeting" || sessions[0].Language != "en" {
+		t.Fatalf("?lang=en&lang=fr sessions = %+v", sessions)
+	}
+}
+
+func TestLanguageHandler(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+	os.WriteFile(filepath.Join(dir, "call.txt"), []byte("So the plan is that we ship it on Friday, and you are in charge of the notes."), 0o644)
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(method, "/api/transcripts/call.webm/language", strings.NewReader(body)))
+		return rec
+	}
+	if rec := do(http.MethodGet, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET before detection status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"code":"en"`) {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPut, `{"language":"Japanese"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body)
+	}
+	// A language set by hand survives later saves of the transcript.
+	if err := updateTranscriptLanguage(filepath.Join(dir, "call.txt")); err != nil {
+		t.Fatal(err)
+	}
+	rec := do(http.MethodGet, "")
+	var info languageInfo
+	json.NewDecoder(rec.Body).Decode(&info)
+	if info.Code != "ja" || info.Source != "manual" {
+		t.Fatalf("language = %+v", info)
+	}
+	if rec := do(http.MethodPut, `{"language":""}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("PUT empty status = %d", rec.Code)
+	}
+}
+
+func TestRunJobStoresWhisperLanguage(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "clip.webm")
+	fakeWhisper(t, "60", func(_ context.Context, args []string) ([]byte, error) {
+		out := argAfter(args, "--output_dir")
+		return nil, os.WriteFile(filepath.Join(out, "clip.json"), []byte(`{"language":"pt","text":" Olá. ","segments":[]}`), 0o644)
+	})
+
+	runJob(queueTranscription(t, "clip.webm"))
+	meta, _ := loadMeta(filepath.Join(dir, "clip.webm"))
+	if meta.Language == nil || meta.Language.Code != "pt" || meta.Language.Source != "whisper" {
+		t.Fatalf("language = %+v", meta.Language)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSentencesFollowLanguageRules(t *testing.T) {
+	cases := []struct {
+		lang, text string
+		want       []string
+	}{
+		{"en", "Dr. Smith paid $3.5 million, e.g. in cash. Wow! Really?", []string{"Dr. Smith paid $3.5 million, e.g. in cash.", "Wow!", "Really?"}},
+		{"zh", "我们开始吧。 今天 讨论 预算！好吗？", []string{"我们开始吧。", "今天讨论预算！", "好吗？"}},
+		{"Japanese", "「はい。」そうです。", []string{"「はい。」", "そうです。"}},
+		{"ar", "مرحبا؟ نعم.", []string{"مرحبا؟", "نعم."}},
+		{"el", "Τι κάνεις; Καλά.", []string{"Τι κάνεις;", "Καλά."}},
+		{"hi", "नमस्ते। आप कैसे हैं?", []string{"नमस्ते।", "आप कैसे हैं?"}},
+	}
+	for _, c := range cases {
+		l := rulesFor(c.lang)
+		got := l.sentences(l.tidy(c.text))
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("%s: got %q want %q", c.lang, got, c.want)
+		}
+	}
+}
+
+func TestTidyKeepsSpacesAroundLatinInCJK(t *testing.T) {
+	l := rulesFor("zh")
+	if got := l.tidy(" 我们 用 Go 语言 写 的 "); got != "我们用 Go 语言写的" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestLocalizedExports(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+	doc := `{"text":" مرحبا؟ نعم.","language":"ar","segments":[{"id":0,"start":0,"end":2,"text":" مرحبا؟ نعم."}]}`
+	if err := os.WriteFile(filepath.Join(dir, "call.json"), []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/call.webm/export?format=txt", nil))
+	if !strings.HasSuffix(rec.Body.String(), "\n\u200fمرحبا؟\u200f\n\u200fنعم.\u200f\n") {
+		t.Fatalf("txt=%q", rec.Body.String())
+	}
+
+	long := strings.Repeat("word ", 20)
+	doc = `{"text":"x","language":"en","segments":[{"id":0,"start":10,"end":20,"text":" ` + long + `end. ` + long + `end."}]}`
+	os.WriteFile(filepath.Join(dir, "call.json"), []byte(doc), 0o644)
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/call.webm/export?format=vtt", nil))
+	vtt := rec.Body.String()
+	if !strings.Contains(vtt, "00:00:10.000 --> 00:00:15.000\nword") || !strings.Contains(vtt, "00:00:15.000 --> 00:00:20.000\nword") {
+		t.Fatalf("long segment not split by sentence: %s", vtt)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// ProcessLauncher starts desktop processes on behalf of a request: the file
+// manager for open-folder, and anything else that hands a recording to
+// another application. It is the one seam tests and forks replace to keep
+// the server from spawning programs; testsupport.FakeLauncher records calls
+// instead. Helper tools run to completion (ffmpeg, whisper) go through
+// runCommandFunc.
+type ProcessLauncher interface {
+	// Start launches name with args and returns without waiting for it.
+	Start(name string, args ...string) error
+	// Open shows path in the platform's file manager or default
+	// application. It returns ErrOpenUnsupported where there is none.
+	Open(path string) error
+	// Reveal shows the file manager with path selected. It returns
+	// ErrOpenUnsupported where there is no file manager to ask.
+	Reveal(path string) error
+}
+
+// ErrOpenUnsupported is returned by ProcessLauncher.Open on platforms
+// without a known opener.
+var ErrOpenUnsupported = errors.New("opening files is not supported on this platform")
+
+// launchHandlers serves the endpoints that hand recordings to desktop
+// applications, starting them with launcher. newMux gives it execLauncher;
+// tests build the mux with a fake through newMuxWithLauncher.
+type launchHandlers struct {
+	launcher ProcessLauncher
+}
+
+// execLauncher starts real processes.
+type execLauncher struct{}
+
+func (execLauncher) Start(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the process when it exits so it does not linger as a zombie.
+	go cmd.Wait()
+	return nil
+}
+
+func (l execLauncher) Open(path string) error {
+	name, args := openerCommand(runtime.GOOS, path)
+	if name == "" {
+		return ErrOpenUnsupported
+	}
+	return l.Start(name, args...)
+}
+
+func (l execLauncher) Reveal(path string) error {
+	name, args := revealCommand(runtime.GOOS, path)
+	if name == "" {
+		return ErrOpenUnsupported
+	}
+	return l.Start(name, args...)
+}
+
+// openerCommand returns the command that opens path on goos.
+func openerCommand(goos, path string) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "open", []string{path}
+	case "windows":
+		return "explorer", []string{path}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return "xdg-open", []string{path}
+	default:
+		return "", nil
+	}
+}
+
+// revealCommand returns the command that shows path selected in the file
+// manager on goos. The freedesktop file managers have no common command
+// line for selecting a file, so there the containing folder is opened.
+func revealCommand(goos, path string) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "open", []string{"-R", path}
+	case "windows":
+		return "explorer", []string{"/select,", path}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return "xdg-open", []string{filepath.Dir(path)}
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"recordings_viewer/testsupport"
+)
+
+func TestOpenerCommandPerPlatform(t *testing.T) {
+	for goos, want := range map[string]string{"darwin": "open", "windows": "explorer", "linux": "xdg-open", "plan9": ""} {
+		name, args := openerCommand(goos, "/r/x")
+		if name != want {
+			t.Fatalf("%s: name=%q want %q", goos, name, want)
+		}
+		if want != "" && (len(args) != 1 || args[0] != "/r/x") {
+			t.Fatalf("%s: args=%v", goos, args)
+		}
+	}
+}
+
+func TestOpenFolderReportsLauncherErrors(t *testing.T) {
+	dir := useTempBaseDir(t)
+	os.Mkdir(filepath.Join(dir, "s"), 0o755)
+	fake := &testsupport.FakeLauncher{}
+
+	for err, want := range map[error]int{ErrOpenUnsupported: http.StatusNotImplemented, os.ErrPermission: http.StatusInternalServerError} {
+		fake.Err = err
+		rec := httptest.NewRecorder()
+		launchHandlers{launcher: fake}.openFolder(rec, httptest.NewRequest(http.MethodPost, "/api/open-folder", strings.NewReader(`{"path":"s"}`)))
+		if rec.Code != want {
+			t.Fatalf("err %v: status=%d want %d", err, rec.Code, want)
+		}
+	}
+}
+
+func TestRevealCommandPerPlatform(t *testing.T) {
+	name, args := revealCommand("darwin", "/r/a.webm")
+	if name != "open" || strings.Join(args, " ") != "-R /r/a.webm" {
+		t.Fatalf("darwin: %s %v", name, args)
+	}
+	name, args = revealCommand("windows", `C:\r\a.webm`)
+	if name != "explorer" || len(args) != 2 || args[0] != "/select," {
+		t.Fatalf("windows: %s %v", name, args)
+	}
+	if name, args = revealCommand("linux", "/r/a.webm"); name != "xdg-open" || args[0] != "/r" {
+		t.Fatalf("linux: %s %v", name, args)
+	}
+	if name, _ = revealCommand("plan9", "/r/a.webm"); name != "" {
+		t.Fatalf("plan9: %s", name)
+	}
+}
+
+func TestRevealHandler(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "s/a.webm", "s/a.txt")
+	fake := &testsupport.FakeLauncher{}
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		newMuxWithLauncher(fake).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/reveal", strings.NewReader(body)))
+		return rec.Code
+	}
+	if code := post(`{"path":"recordings/s/a.txt"}`); code != http.StatusNoContent {
+		t.Fatalf("reveal status=%d", code)
+	}
+	if got := fake.Revealed(); len(got) != 1 || got[0] != filepath.Join(dir, "s", "a.txt") {
+		t.Fatalf("revealed=%v", got)
+	}
+	if code := post(`{"path":"s/a.webm","action":"play"}`); code != http.StatusNoContent {
+		t.Fatalf("play status=%d", code)
+	}
+	if got := fake.Opened(); len(got) != 1 || got[0] != filepath.Join(dir, "s", "a.webm") {
+		t.Fatalf("opened=%v", got)
+	}
+	for body, want := range map[string]int{
+		`{"path":"s/a.txt","action":"play"}`:   http.StatusBadRequest,
+		`{"path":"s/a.webm","action":"print"}`: http.StatusBadRequest,
+		`{"path":"s/missing.webm"}`:            http.StatusNotFound,
+		`{"path":"../etc/passwd"}`:             http.StatusBadRequest,
+	} {
+		if code := post(body); code != want {
+			t.Errorf("%s: status=%d want %d", body, code, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// isWriteMethod reports whether requests with method may change the library.
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// tokenBucket allows rate requests per second with bursts of up to burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client address.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+var writeLimiter = &rateLimiter{buckets: map[string]*tokenBucket{}}
+
+// allow takes a token from client's bucket. When the bucket is empty it
+// returns false and how long until the next token.
+func (l *rateLimiter) allow(client string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	// Drop buckets that have refilled completely; they behave exactly like
+	// a fresh one.
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// clientAddr identifies the caller for rate limiting by remote IP.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withWriteLimits guards requests that write: each client may make
+// cfg.RateLimit of them per second (bursts of cfg.RateBurst), and bodies
+// larger than cfg.MaxBodyBytes, or than the free space left, are refused
+// before they reach the disk. Reads pass through untouched.
+func withWriteLimits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWriteMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		c := cfg()
+		if c.RateLimit > 0 {
+			if ok, wait := writeLimiter.allow(clientAddr(r), c.RateLimit, c.RateBurst, time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		if limit := c.MaxBodyBytes; limit > 0 {
+			if r.ContentLength > limit {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		if r.ContentLength > 0 {
+			if free, _, err := diskSpace(baseDir); err == nil && uint64(r.ContentLength) > free {
+				http.Error(w, "not enough disk space", http.StatusInsufficientStorage)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyErrorStatus maps an error from reading a request body to a status:
+// 413 when the body exceeded the size limit, otherwise fallback.
+func bodyErrorStatus(err error, fallback int) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return fallback
+}
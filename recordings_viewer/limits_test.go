@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefillsOverTime(t *testing.T) {
+	l := &rateLimiter{buckets: map[string]*tokenBucket{}}
+	now := time.Unix(1000, 0)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("1.2.3.4", 1, 3, now); !ok {
+			t.Fatalf("request %d refused within burst", i)
+		}
+	}
+	ok, wait := l.allow("1.2.3.4", 1, 3, now)
+	if ok || wait != time.Second {
+		t.Fatalf("ok=%v wait=%v want refused for 1s", ok, wait)
+	}
+	if ok, _ := l.allow("5.6.7.8", 1, 3, now); !ok {
+		t.Fatalf("other client should have its own bucket")
+	}
+	if ok, _ := l.allow("1.2.3.4", 1, 3, now.Add(time.Second)); !ok {
+		t.Fatalf("token not refilled after 1s")
+	}
+}
+
+func TestWriteLimitsRateLimitWritesOnly(t *testing.T) {
+	useConfig(t, func(c *config) { c.RateLimit = 0.001; c.RateBurst = 1 })
+	old := writeLimiter
+	writeLimiter = &rateLimiter{buckets: map[string]*tokenBucket{}}
+	t.Cleanup(func() { writeLimiter = old })
+	h := withWriteLimits(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/a.txt", strings.NewReader("x")))
+		if rec.Code != want {
+			t.Fatalf("put %d: status=%d want %d", i, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("missing Retry-After")
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get status=%d; reads must not be limited", rec.Code)
+	}
+}
+
+func TestWriteLimitsMaxBody(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.RateLimit = 0; c.MaxBodyBytes = 8 })
+	h := withWriteLimits(newMux())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/big.txt", strings.NewReader("0123456789")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("declared length: status=%d want 413", rec.Code)
+	}
+
+	// Without a Content-Length the limit trips while copying, and the
+	// partial file is discarded.
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/big.txt", io.MultiReader(strings.NewReader("0123456789")))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("streamed: status=%d want 413", rec.Code)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "big.txt*")); len(matches) != 0 {
+		t.Fatalf("left files behind: %v", matches)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/small.txt", strings.NewReader("ok")))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("small body: status=%d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "small.txt")); err != nil {
+		t.Fatalf("small body not written: %v", err)
+	}
+}
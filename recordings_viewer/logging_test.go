@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends JSON logs at debug level to the returned buffer for the
+// rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	orig, origLevel := slog.Default(), logLevel.Level()
+	var buf bytes.Buffer
+	if err := setupLogging(&buf, "debug", "json"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		slog.SetDefault(orig)
+		logLevel.Set(origLevel)
+	})
+	return &buf
+}
+
+func TestRequestLogIncludesIDStatusAndLatency(t *testing.T) {
+	buf := captureLogs(t)
+	h := withRequestLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestLogger(r).Info("inside handler")
+		if _, ok := w.(http.Flusher); !ok {
+			t.Errorf("response writer lost http.Flusher")
+		}
+		http.Error(w, "nope", http.StatusNotFound)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions/missing", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("X-Request-ID") != "abc123" {
+		t.Fatalf("request id header=%q", rec.Header().Get("X-Request-ID"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log lines=%q", lines)
+	}
+	var inner, access map[string]any
+	json.Unmarshal([]byte(lines[0]), &inner)
+	json.Unmarshal([]byte(lines[1]), &access)
+	if inner["request_id"] != "abc123" || inner["msg"] != "inside handler" {
+		t.Fatalf("handler log=%v", inner)
+	}
+	if access["request_id"] != "abc123" || access["level"] != "WARN" || access["method"] != "GET" ||
+		access["path"] != "/api/sessions/missing" || access["status"] != float64(404) || access["duration_ms"] == nil {
+		t.Fatalf("access log=%v", access)
+	}
+}
+
+func TestRequestLogGeneratesID(t *testing.T) {
+	captureLogs(t)
+	h := withRequestLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if id := rec.Header().Get("X-Request-ID"); len(id) != 16 {
+		t.Fatalf("generated id=%q", id)
+	}
+}
+
+func TestSetupLoggingLevels(t *testing.T) {
+	buf := captureLogs(t)
+	if err := setupLogging(buf, "warn", "text"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("hidden")
+	slog.Warn("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "level=WARN msg=shown") {
+		t.Fatalf("output=%q", out)
+	}
+	for _, bad := range [][2]string{{"loud", "text"}, {"info", "xml"}} {
+		if err := setupLogging(buf, bad[0], bad[1]); err == nil {
+			t.Fatalf("setupLogging(%q, %q) should fail", bad[0], bad[1])
+		}
+	}
+}
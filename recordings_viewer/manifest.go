@@ -0,0 +1,513 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manifestSchemaVersion is the version of the sidecar metadata layout that
+// saveMeta writes and manifest.schema.json describes. Sidecars without a
+// "schema" field predate versioning and count as version 0.
+const manifestSchemaVersion = 1
+
+//go:embed manifest.schema.json
+var manifestSchema []byte
+
+// manifestProblem is one way a manifest breaks the schema.
+type manifestProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p manifestProblem) Error() string {
+	if p.Field == "" {
+		return p.Message
+	}
+	return p.Field + ": " + p.Message
+}
+
+// manifestErrors is returned when a manifest fails validation.
+type manifestErrors []manifestProblem
+
+func (e manifestErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, p := range e {
+		msgs[i] = p.Error()
+	}
+	return "invalid manifest: " + strings.Join(msgs, "; ")
+}
+
+// manifestUpgrades[v] turns a version v manifest into version v+1.
+var manifestUpgrades = []func(map[string]any) error{
+	upgradeManifestV0,
+}
+
+// upgradeManifestV0 converts the looser sidecars external writers produced
+// before versioning: tags as one comma-separated string, and the recording
+// time as a bare RFC 3339 timestamp like the X-Recorded-At header.
+func upgradeManifestV0(m map[string]any) error {
+	if s, ok := m["tags"].(string); ok {
+		tags := []any{}
+		for _, tag := range normalizeTags(strings.Split(s, ",")) {
+			tags = append(tags, tag)
+		}
+		m["tags"] = tags
+	}
+	if s, ok := m["recorded"].(string); ok {
+		rt, err := parseRecordingTime(s)
+		if err != nil {
+			return manifestProblem{Field: "recorded", Message: err.Error()}
+		}
+		m["recorded"] = map[string]any{"at": rt.At.Format(time.RFC3339Nano), "offset": rt.Offset}
+	}
+	return nil
+}
+
+// manifestVersion reads the schema version of a decoded manifest.
+func manifestVersion(m map[string]any) (int, error) {
+	raw, ok := m["schema"]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, manifestProblem{Field: "schema", Message: "must be an integer"}
+	}
+	v, err := n.Int64()
+	if err != nil || v < 0 {
+		return 0, manifestProblem{Field: "schema", Message: "must be a non-negative integer"}
+	}
+	if v > manifestSchemaVersion {
+		return 0, manifestProblem{Field: "schema", Message: fmt.Sprintf("version %d is newer than this server supports (%d)", v, manifestSchemaVersion)}
+	}
+	return int(v), nil
+}
+
+// decodeManifestMap parses a manifest into a generic map, keeping numbers
+// as written.
+func decodeManifestMap(data []byte) (map[string]any, error) {
+	var m map[string]any
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil || m == nil {
+		return nil, manifestProblem{Message: "not a JSON object"}
+	}
+	return m, nil
+}
+
+// upgradeManifest brings a manifest up to manifestSchemaVersion and returns
+// the upgraded map and the version it was written with.
+func upgradeManifest(data []byte) (map[string]any, int, error) {
+	m, err := decodeManifestMap(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, err := manifestVersion(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	for v := from; v < manifestSchemaVersion; v++ {
+		if err := manifestUpgrades[v](m); err != nil {
+			return nil, from, err
+		}
+	}
+	m["schema"] = manifestSchemaVersion
+	return m, from, nil
+}
+
+// manifestObjects lists the fields each object in a manifest may have and
+// the ones it must have, keyed by the object's field ("" is the top level).
+var manifestObjects = map[string]struct{ allowed, required []string }{
+	"":              {allowed: []string{"schema", "tags", "remote", "transcription", "import", "recorded", "source", "calendar", "partial", "keywords", "chapters", "language", "gallery", "favorite", "template", "cold", "fields", "notes", "annotations"}, required: []string{"schema"}},
+	"remote":        {allowed: []string{"backend", "bucket", "key", "size", "etag"}, required: []string{"backend", "bucket", "key", "size"}},
+	"transcription": {allowed: []string{"engine", "model", "jobId", "range", "enhanced", "tracks", "completedAt"}, required: []string{"engine", "model", "completedAt"}},
+	"import":        {allowed: []string{"originalName", "sourcePath", "importedAt"}, required: []string{"originalName", "importedAt"}},
+	"recorded":      {allowed: []string{"at", "offset"}, required: []string{"at", "offset"}},
+	"source":        {allowed: []string{"url", "title", "endedAt"}},
+	"calendar":      {allowed: []string{"uid", "title", "start", "end", "location", "organizer", "attendees", "matchedAt"}, required: []string{"uid", "title", "start", "end", "matchedAt"}},
+	"partial":       {allowed: []string{"salvagedAt", "chunks", "bytes"}, required: []string{"salvagedAt", "chunks", "bytes"}},
+	"keywords":      {allowed: []string{"keywords", "entities", "topics", "method", "extractedAt"}, required: []string{"method", "extractedAt"}},
+	"chapters":      {allowed: []string{"chapters", "generatedAt"}, required: []string{"chapters", "generatedAt"}},
+	"language":      {allowed: []string{"code", "source", "detectedAt"}, required: []string{"code", "source", "detectedAt"}},
+	"gallery":       {allowed: []string{"publishedAt"}, required: []string{"publishedAt"}},
+	"favorite":      {allowed: []string{"addedAt"}, required: []string{"addedAt"}},
+	"template":      {allowed: []string{"name", "model", "language", "summaryPrompt", "appliedAt"}, required: []string{"name", "appliedAt"}},
+	"cold":          {allowed: []string{"path", "mode", "size", "sha256", "movedAt", "compressed", "bitrate", "kept", "bucket", "key"}, required: []string{"path", "mode", "size", "sha256", "movedAt"}},
+	"annotations":   {allowed: []string{"id", "time", "text", "createdAt", "updatedAt"}, required: []string{"id", "time", "text", "createdAt"}},
+}
+
+// checkManifestFields reports unknown and missing fields.
+func checkManifestFields(m map[string]any) []manifestProblem {
+	var problems []manifestProblem
+	check := func(field, prefix string, obj map[string]any) {
+		spec := manifestObjects[field]
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !slices.Contains(spec.allowed, k) {
+				problems = append(problems, manifestProblem{Field: prefix + k, Message: "unknown field"})
+			}
+		}
+		for _, k := range spec.required {
+			if _, ok := obj[k]; !ok {
+				problems = append(problems, manifestProblem{Field: prefix + k, Message: "is required"})
+			}
+		}
+	}
+	check("", "", m)
+	for _, field := range manifestObjects[""].allowed {
+		if _, nested := manifestObjects[field]; !nested {
+			continue
+		}
+		switch v := m[field].(type) {
+		case map[string]any:
+			check(field, field+".", v)
+		case []any:
+			// Arrays of objects, such as annotations, are checked item by
+			// item.
+			for i, item := range v {
+				if obj, ok := item.(map[string]any); ok {
+					check(field, fmt.Sprintf("%s[%d].", field, i), obj)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// utcOffset matches the "+09:00" offsets recordingTime stores.
+var utcOffset = regexp.MustCompile(`^[+-][0-9]{2}:[0-9]{2}$`)
+
+// validate checks the rules of the manifest schema that decoding into
+// recordingMeta does not enforce.
+func (m recordingMeta) validate() []manifestProblem {
+	var problems []manifestProblem
+	bad := func(field, msg string) {
+		problems = append(problems, manifestProblem{Field: field, Message: msg})
+	}
+	if m.Schema != manifestSchemaVersion {
+		bad("schema", fmt.Sprintf("must be %d", manifestSchemaVersion))
+	}
+	for i, tag := range m.Tags {
+		if tag == "" {
+			bad(fmt.Sprintf("tags[%d]", i), "must not be empty")
+		}
+	}
+	if r := m.Remote; r != nil {
+		if r.Backend == "" || r.Bucket == "" || r.Key == "" {
+			bad("remote", "backend, bucket and key must not be empty")
+		}
+		if r.Size < 0 {
+			bad("remote.size", "must not be negative")
+		}
+	}
+	if t := m.Transcription; t != nil {
+		if t.Engine == "" {
+			bad("transcription.engine", "must not be empty")
+		}
+		if t.CompletedAt.IsZero() {
+			bad("transcription.completedAt", "must be a date-time")
+		}
+		if t.Range != nil {
+			if err := t.Range.check(); err != nil {
+				bad("transcription.range", err.Error())
+			}
+		}
+	}
+	if imp := m.Import; imp != nil {
+		if imp.OriginalName == "" {
+			bad("import.originalName", "must not be empty")
+		}
+		if imp.ImportedAt.IsZero() {
+			bad("import.importedAt", "must be a date-time")
+		}
+	}
+	if rt := m.Recorded; rt != nil {
+		if rt.At.IsZero() {
+			bad("recorded.at", "must be a date-time")
+		}
+		if !utcOffset.MatchString(rt.Offset) {
+			bad("recorded.offset", `must look like "+09:00"`)
+		}
+	}
+	if src := m.Source; src != nil {
+		if _, err := parseSource(src.URL, src.Title, ""); err != nil {
+			bad("source", err.Error())
+		}
+		if !src.EndedAt.IsZero() && m.Recorded != nil && src.EndedAt.Before(m.Recorded.At) {
+			bad("source.endedAt", "must not be before recorded.at")
+		}
+	}
+	if c := m.Calendar; c != nil {
+		if c.UID == "" {
+			bad("calendar.uid", "must not be empty")
+		}
+		if c.Start.IsZero() || c.End.Before(c.Start) {
+			bad("calendar.end", "must not be before calendar.start")
+		}
+		if c.MatchedAt.IsZero() {
+			bad("calendar.matchedAt", "must be a date-time")
+		}
+	}
+	if p := m.Partial; p != nil {
+		if p.SalvagedAt.IsZero() {
+			bad("partial.salvagedAt", "must be a date-time")
+		}
+		if p.Chunks < 1 {
+			bad("partial.chunks", "must be at least 1")
+		}
+		if p.Bytes < 0 {
+			bad("partial.bytes", "must not be negative")
+		}
+	}
+	if k := m.Keywords; k != nil {
+		if k.Method != "tfidf" && k.Method != "command" {
+			bad("keywords.method", `must be "tfidf" or "command"`)
+		}
+		if k.ExtractedAt.IsZero() {
+			bad("keywords.extractedAt", "must be a date-time")
+		}
+	}
+	if c := m.Chapters; c != nil {
+		if c.GeneratedAt.IsZero() {
+			bad("chapters.generatedAt", "must be a date-time")
+		}
+		for i, ch := range c.Chapters {
+			if ch.Start < 0 || ch.End < ch.Start || (i > 0 && ch.Start < c.Chapters[i-1].End) {
+				bad(fmt.Sprintf("chapters.chapters[%d]", i), "must be in order and not overlap")
+			}
+			if ch.Title == "" {
+				bad(fmt.Sprintf("chapters.chapters[%d].title", i), "must not be empty")
+			}
+		}
+	}
+	if l := m.Language; l != nil {
+		if l.Code == "" || l.Code != languageCode(l.Code) {
+			bad("language.code", `must be a lowercase base code such as "en"`)
+		}
+		if l.Source != "whisper" && l.Source != "detected" && l.Source != "manual" {
+			bad("language.source", `must be "whisper", "detected" or "manual"`)
+		}
+		if l.DetectedAt.IsZero() {
+			bad("language.detectedAt", "must be a date-time")
+		}
+	}
+	if g := m.Gallery; g != nil && g.PublishedAt.IsZero() {
+		bad("gallery.publishedAt", "must be a date-time")
+	}
+	if f := m.Favorite; f != nil && f.AddedAt.IsZero() {
+		bad("favorite.addedAt", "must be a date-time")
+	}
+	if t := m.Template; t != nil {
+		if !profileNamePattern.MatchString(t.Name) {
+			bad("template.name", "invalid template name")
+		}
+		if t.AppliedAt.IsZero() {
+			bad("template.appliedAt", "must be a date-time")
+		}
+	}
+	for i, c := range m.Cold {
+		field := fmt.Sprintf("cold[%d]", i)
+		if c.Path == "" {
+			bad(field+".path", "must not be empty")
+		}
+		switch c.Mode {
+		case "compress":
+			if c.Compressed == "" {
+				bad(field+".compressed", "is required for compressed files")
+			}
+		case "s3":
+			if c.Bucket == "" || c.Key == "" {
+				bad(field, "bucket and key must not be empty")
+			}
+		default:
+			bad(field+".mode", `must be "compress" or "s3"`)
+		}
+		if c.MovedAt.IsZero() {
+			bad(field+".movedAt", "must be a date-time")
+		}
+	}
+	names := make([]string, 0, len(m.Fields))
+	for name := range m.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !customFieldName.MatchString(name) {
+			bad("fields."+name, "invalid field name")
+		} else if err := m.Fields[name].check(); err != nil {
+			bad("fields."+name, err.Error())
+		}
+	}
+	seen := map[string]bool{}
+	for i, a := range m.Annotations {
+		field := fmt.Sprintf("annotations[%d]", i)
+		if a.ID == "" || seen[a.ID] {
+			bad(field+".id", "must be unique and not empty")
+		}
+		seen[a.ID] = true
+		if err := a.check(); err != nil {
+			bad(field, err.Error())
+		}
+		if a.CreatedAt.IsZero() {
+			bad(field+".createdAt", "must be a date-time")
+		}
+	}
+	return problems
+}
+
+// parseManifest upgrades and validates a manifest from an external writer.
+// It returns the upgraded manifest, the version it was written with, and
+// every problem found.
+func parseManifest(data []byte) (recordingMeta, int, manifestErrors) {
+	var meta recordingMeta
+	m, from, err := upgradeManifest(data)
+	if err != nil {
+		if p, ok := err.(manifestProblem); ok {
+			return meta, from, manifestErrors{p}
+		}
+		return meta, from, manifestErrors{{Message: err.Error()}}
+	}
+	problems := checkManifestFields(m)
+	upgraded, _ := json.Marshal(m)
+	if err := json.Unmarshal(upgraded, &meta); err != nil {
+		p := manifestProblem{Message: err.Error()}
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			p = manifestProblem{Field: te.Field, Message: "must be " + jsonTypeName(te.Type.Kind().String())}
+		}
+		return meta, from, append(problems, p)
+	}
+	problems = append(problems, meta.validate()...)
+	if len(problems) > 0 {
+		return meta, from, problems
+	}
+	return meta, from, nil
+}
+
+// jsonTypeName names a Go kind the way the schema does.
+func jsonTypeName(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "an integer"
+	case kind == "slice":
+		return "an array"
+	case kind == "struct", kind == "ptr", kind == "map":
+		return "an object"
+	}
+	return "a " + kind
+}
+
+// upgradeManifestFile rewrites the sidecar at fullPath in the current
+// schema if it was written with an older one. Callers hold mu.
+func upgradeManifestFile(fullPath string) (bool, error) {
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return false, err
+	}
+	m, err := decodeManifestMap(data)
+	if err != nil {
+		return false, err
+	}
+	if v, err := manifestVersion(m); err != nil || v == manifestSchemaVersion {
+		return false, err
+	}
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		return false, err
+	}
+	return true, saveMeta(fullPath, meta)
+}
+
+// upgradeManifests upgrades the sidecars of s during a scan. It is skipped
+// in read-only mode, and while another request holds mu, so a scan never
+// waits on a write; a later scan catches up.
+func upgradeManifests(s *session) {
+	if cfg().ReadOnly {
+		return
+	}
+	for _, f := range s.Files {
+		if !isMetaFile(f) {
+			continue
+		}
+		if !mu.TryLock() {
+			return
+		}
+		upgraded, err := upgradeManifestFile(absPath(f))
+		mu.Unlock()
+		switch {
+		case err != nil:
+			slog.Warn("manifest upgrade failed", "path", f, "err", err)
+		case upgraded:
+			slog.Info("upgraded manifest", "path", f, "schema", manifestSchemaVersion)
+		}
+	}
+}
+
+// putManifest validates a manifest uploaded through PUT /api/transcripts
+// and stores it upgraded to the current schema. Callers hold mu.
+func putManifest(fullPath string, body io.Reader) (int64, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return 0, err
+	}
+	meta, _, problems := parseManifest(data)
+	if problems != nil {
+		return 0, problems
+	}
+	return int64(len(data)), saveMeta(fullPath, meta)
+}
+
+type manifestReport struct {
+	Valid    bool              `json:"valid"`
+	Schema   int               `json:"schema"`
+	Upgraded bool              `json:"upgraded"`
+	Errors   []manifestProblem `json:"errors"`
+	Manifest *recordingMeta    `json:"manifest,omitempty"`
+}
+
+// validateManifestHandler serves /api/validate/manifest. GET returns the
+// manifest JSON Schema; POST checks the manifest in the body without
+// storing it and returns the version it was written with, the problems
+// found and, when valid, the manifest as the server would store it.
+func validateManifestHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(manifestSchema)
+	case http.MethodPost:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), bodyErrorStatus(err, http.StatusBadRequest))
+			return
+		}
+		meta, from, problems := parseManifest(data)
+		report := manifestReport{
+			Valid:    problems == nil,
+			Schema:   from,
+			Upgraded: problems == nil && from < manifestSchemaVersion,
+			Errors:   []manifestProblem(problems),
+		}
+		if report.Errors == nil {
+			report.Errors = []manifestProblem{}
+		}
+		if report.Valid {
+			report.Manifest = &meta
+		}
+		writeJSON(w, report)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
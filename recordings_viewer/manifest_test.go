@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestSchemaDocumentMatchesVersion(t *testing.T) {
+	var doc struct {
+		Properties map[string]struct {
+			Const *int `json:"const"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(manifestSchema, &doc); err != nil {
+		t.Fatalf("schema is not JSON: %v", err)
+	}
+	if c := doc.Properties["schema"].Const; c == nil || *c != manifestSchemaVersion {
+		t.Fatalf("schema document const = %v, want %d", c, manifestSchemaVersion)
+	}
+	for field := range manifestObjects {
+		if _, ok := doc.Properties[field]; field != "" && !ok {
+			t.Errorf("schema document lacks %q", field)
+		}
+	}
+}
+
+func TestParseManifestUpgradesLegacy(t *testing.T) {
+	meta, from, problems := parseManifest([]byte(`{"tags": "work, call,work", "recorded": "2024-05-01T21:30:00+02:00"}`))
+	if problems != nil {
+		t.Fatalf("problems: %v", problems)
+	}
+	if from != 0 || meta.Schema != manifestSchemaVersion {
+		t.Fatalf("from %d schema %d", from, meta.Schema)
+	}
+	if !reflect.DeepEqual(meta.Tags, []string{"call", "work"}) {
+		t.Fatalf("tags = %v", meta.Tags)
+	}
+	if meta.Recorded == nil || meta.Recorded.Offset != "+02:00" || meta.Recorded.At.Hour() != 19 {
+		t.Fatalf("recorded = %+v", meta.Recorded)
+	}
+}
+
+func TestParseManifestReportsProblems(t *testing.T) {
+	cases := map[string]string{
+		`{"schema": 1, "color": "red"}`:                                                                                            "color",
+		`{"schema": 1, "remote": {"backend": "s3", "bucket": "b"}}`:                                                                "remote.key",
+		`{"schema": 1, "partial": {"salvagedAt": "2024-05-01T00:00:00Z", "chunks": 0, "bytes": 1}}`:                                "partial.chunks",
+		`{"schema": 1, "tags": "a,b"}`:                                                                                             "tags",
+		`{"schema": 1, "fields": {"due": {"type": "date", "value": "soon"}}}`:                                                      "fields.due",
+		`{"schema": 1, "annotations": [{"id": "a", "time": 1, "text": "x", "createdAt": "2024-05-01T00:00:00Z", "color": "red"}]}`: "annotations[0].color",
+		`{"schema": 1, "annotations": [{"id": "a", "time": -1, "text": "x", "createdAt": "2024-05-01T00:00:00Z"}]}`:                "annotations[0]",
+		`{"schema": 9}`: "schema",
+		`[1, 2]`:        "",
+	}
+	for body, field := range cases {
+		_, _, problems := parseManifest([]byte(body))
+		found := false
+		for _, p := range problems {
+			found = found || p.Field == field
+		}
+		if !found {
+			t.Errorf("%s: problems %v, want one for %q", body, problems, field)
+		}
+	}
+}
+
+func TestValidateManifestHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/validate/manifest", strings.NewReader(`{"tags": ["a"]}`))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	var report manifestReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !report.Valid || !report.Upgraded || report.Schema != 0 || report.Manifest == nil || report.Manifest.Schema != manifestSchemaVersion {
+		t.Fatalf("report = %+v", report)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/validate/manifest", strings.NewReader(`{"schema": 1, "tags": [""]}`))
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	report = manifestReport{}
+	json.NewDecoder(rec.Body).Decode(&report)
+	if report.Valid || len(report.Errors) != 1 || report.Errors[0].Field != "tags[0]" {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestTranscriptPutValidatesManifest(t *testing.T) {
+	dir := useTempBaseDir(t)
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/a.meta.json", strings.NewReader(`{"schema": 1, "extra": true}`))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.meta.json")); !os.IsNotExist(err) {
+		t.Fatalf("invalid manifest was written: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/transcripts/a.meta.json", strings.NewReader(`{"tags": "x"}`))
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "a.meta.json"))
+	if !strings.Contains(string(data), `"schema": 1`) || !strings.Contains(string(data), `"x"`) {
+		t.Fatalf("stored manifest = %s", data)
+	}
+}
+
+func TestScanUpgradesOldManifests(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+	legacy := filepath.Join(dir, "call.meta.json")
+	if err := os.WriteFile(legacy, []byte(`{"tags": "team"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := scanSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || !reflect.DeepEqual(sessions[0].Tags, []string{"team"}) {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	data, _ := os.ReadFile(legacy)
+	var stored map[string]any
+	json.Unmarshal(data, &stored)
+	if stored["schema"] != float64(manifestSchemaVersion) {
+		t.Fatalf("manifest not upgraded on disk: %s", data)
+	}
+
+	useConfig(t, func(c *config) { c.ReadOnly = true })
+	os.WriteFile(legacy, []byte(`{"tags": "team"}`), 0o644)
+	scanSessions()
+	if data, _ := os.ReadFile(legacy); strings.Contains(string(data), "schema") {
+		t.Fatalf("read-only scan rewrote manifest: %s", data)
+	}
+}
+
+// TestSavedManifestsRoundTrip checks that every manifest the server writes
+// itself can be PUT back as it is.
+func TestSavedManifestsRoundTrip(t *testing.T) {
+	dir := useTempBaseDir(t)
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	for name, meta := range map[string]recordingMeta{
+		"source": {Source: &sourceInfo{URL: "https://meet.example.com/abc", Title: "Weekly sync", EndedAt: at}},
+		"calendar": {Calendar: &calendarInfo{calendarEvent: calendarEvent{
+			UID: "evt-1@example.com", Title: "Weekly sync", Start: at, End: at.Add(time.Hour), Location: "Room 4",
+			Organizer: calendarAttendee{Name: "Ann Lee", Email: "ann@example.com"},
+			Attendees: []calendarAttendee{{Name: "Bo", Email: "bo@example.com"}},
+		}, MatchedAt: at}},
+		"chapters": {Chapters: &chapterInfo{Chapters: []chapter{
+			{Start: 0, End: 300, Title: "Budget", Cues: []string{"silence"}},
+			{Start: 300, End: 600, Title: "Hiring", Cues: []string{"topic"}},
+		}, GeneratedAt: at}},
+		"enhanced": {Transcription: &transcriptionInfo{Engine: "whisper", Model: "base", JobID: "j1", Enhanced: true, CompletedAt: at}},
+	} {
+		full := filepath.Join(dir, name+".webm")
+		if err := saveMeta(full, meta); err != nil {
+			t.Fatalf("%s: saveMeta: %v", name, err)
+		}
+		data, err := os.ReadFile(metaPathFor(full))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, problems := parseManifest(data); len(problems) > 0 {
+			t.Fatalf("%s: saved manifest is invalid: %v", name, problems)
+		}
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/"+name+".meta.json", strings.NewReader(string(data))))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("%s: PUT status = %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
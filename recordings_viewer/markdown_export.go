@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// markdownSectionLength is the least a timestamped section of a Markdown
+// note covers; a section ends at the first segment after that.
+const markdownSectionLength = 5 * time.Minute
+
+// markdownNote is the frontmatter of a Markdown export.
+type markdownNote struct {
+	Title    string
+	Date     time.Time
+	Duration float64
+	Tags     []string
+	Language string
+	Source   string
+}
+
+// newMarkdownNote describes the recording at rel. The duration is where
+// the last segment ends, or the audio's when the transcript is untimed.
+func newMarkdownNote(rel string, doc transcriptDoc, prov provenance) markdownNote {
+	n := markdownNote{Title: recordingStem(filepath.Base(rel)), Language: doc.Language, Source: prov.URL}
+	for _, seg := range doc.Segments {
+		n.Duration = max(n.Duration, seg.End)
+	}
+	s, err := findSession(rel)
+	if err != nil {
+		return n
+	}
+	n.Date = recordingTime{At: s.RecordedAt, Offset: s.RecordedOffset}.original()
+	n.Tags = s.Tags
+	if n.Language == "" {
+		n.Language = s.Language
+	}
+	if n.Duration == 0 && s.Audio != "" {
+		if d, err := probeDuration(absPath(s.Audio)); err == nil {
+			n.Duration = d.Seconds()
+		}
+	}
+	return n
+}
+
+// renderMarkdown writes doc as a Markdown note with YAML frontmatter, as
+// Obsidian and most static site generators read it. Timed transcripts are
+// split into sections headed by their start time; with timestamps set each
+// segment also starts with its own.
+func renderMarkdown(doc transcriptDoc, n markdownNote, prov provenance, timestamps bool) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(n.Title))
+	if !n.Date.IsZero() {
+		fmt.Fprintf(&b, "date: %s\n", n.Date.Format(time.RFC3339))
+	}
+	if n.Duration > 0 {
+		fmt.Fprintf(&b, "duration: %s\n", yamlString(clockTime(n.Duration)))
+	}
+	if len(n.Tags) > 0 {
+		b.WriteString("tags:\n")
+		for _, t := range n.Tags {
+			// Obsidian tags cannot contain spaces.
+			fmt.Fprintf(&b, "  - %s\n", yamlString(strings.Join(strings.Fields(t), "-")))
+		}
+	}
+	if n.Language != "" {
+		fmt.Fprintf(&b, "language: %s\n", yamlString(n.Language))
+	}
+	if n.Source != "" {
+		fmt.Fprintf(&b, "source: %s\n", yamlString(n.Source))
+	}
+	if prov.Engine != "" {
+		fmt.Fprintf(&b, "engine: %s\n", yamlString(strings.TrimSpace(prov.Engine+" "+prov.Model)))
+	}
+	fmt.Fprintf(&b, "generator: %s\n", yamlString(prov.App+" "+prov.Version))
+	fmt.Fprintf(&b, "exported: %s\n", prov.Exported.UTC().Format(time.RFC3339))
+	b.WriteString("---\n\n")
+	fmt.Fprintf(&b, "# %s\n", n.Title)
+
+	timed := false
+	for _, seg := range doc.Segments {
+		timed = timed || seg.End > 0
+	}
+	if !timed {
+		fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(doc.Text))
+		return b.String()
+	}
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			sep := " "
+			if timestamps {
+				sep = "\n"
+			}
+			fmt.Fprintf(&b, "\n%s\n", strings.Join(para, sep))
+			para = nil
+		}
+	}
+	sectionEnd := -1.0
+	for _, seg := range doc.Segments {
+		text := seg.caption()
+		if text == "" {
+			continue
+		}
+		if seg.Start >= sectionEnd {
+			flush()
+			fmt.Fprintf(&b, "\n## %s\n", clockTime(seg.Start))
+			sectionEnd = seg.Start + markdownSectionLength.Seconds()
+		}
+		if timestamps {
+			text = fmt.Sprintf("**[%s]** %s", clockTime(seg.Start), text)
+		}
+		para = append(para, text)
+	}
+	flush()
+	return b.String()
+}
+
+// yamlString quotes s as a YAML double-quoted scalar, which accepts JSON
+// string escapes.
+func yamlString(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// sourceURL links to the recording of rel, preferring its audio, on the
+// server r was sent to.
+func sourceURL(r *http.Request, rel string) string {
+	if s, err := findSession(rel); err == nil && s.Audio != "" {
+		rel = s.Audio
+	}
+	return publicBaseURL(r) + recordingsURL(rel)
+}
+
+var errVaultUnconfigured = errors.New("no vault configured: set VIEWER_VAULT_DIR")
+
+// vaultResult reports a bulk Markdown export. Written holds note paths
+// relative to the vault.
+type vaultResult struct {
+	Dir     string        `json:"dir"`
+	Written []string      `json:"written"`
+	Skipped []vaultReason `json:"skipped"`
+	Failed  []vaultReason `json:"failed"`
+}
+
+type vaultReason struct {
+	Session string `json:"session"`
+	Reason  string `json:"reason"`
+}
+
+// vaultExportHandler serves POST /api/export/vault: it writes a Markdown
+// note for each session picked by "ids" and "query" (as for
+// /api/export/zip) into cfg.VaultDir, optionally below "folder", at the
+// session's own path. Notes that already exist are left alone, since they
+// may have been edited in the vault, unless "overwrite" is set.
+func vaultExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cfg().VaultDir == "" {
+		http.Error(w, errVaultUnconfigured.Error(), http.StatusNotImplemented)
+		return
+	}
+	var payload struct {
+		IDs       []string `json:"ids"`
+		Query     string   `json:"query"`
+		Folder    string   `json:"folder"`
+		Profile   string   `json:"profile"`
+		Overwrite bool     `json:"overwrite"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	payload.Query = strings.TrimSpace(payload.Query)
+	if len(payload.IDs) == 0 && payload.Query == "" {
+		http.Error(w, "no sessions selected", http.StatusBadRequest)
+		return
+	}
+	folder := filepath.FromSlash(strings.Trim(payload.Folder, "/"))
+	if folder != "" && !filepath.IsLocal(folder) {
+		http.Error(w, "folder must be a relative path inside the vault", http.StatusBadRequest)
+		return
+	}
+	q := url.Values{"format": {"markdown"}}
+	if payload.Profile != "" {
+		q.Set("profile", payload.Profile)
+	}
+	opts, err := exportOptionsFromQuery(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sessions, status, err := selectSessions(payload.IDs, payload.Query)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	res := vaultResult{Dir: filepath.Join(cfg().VaultDir, folder), Written: []string{}, Skipped: []vaultReason{}, Failed: []vaultReason{}}
+	for _, s := range sessions {
+		if !s.hasTranscript() {
+			res.Skipped = append(res.Skipped, vaultReason{s.ID, "no transcript"})
+			continue
+		}
+		note := filepath.ToSlash(filepath.Join(folder, filepath.FromSlash(s.ID)+".md"))
+		full := filepath.Join(cfg().VaultDir, filepath.FromSlash(note))
+		if _, err := os.Stat(full); err == nil && !payload.Overwrite {
+			res.Skipped = append(res.Skipped, vaultReason{s.ID, "note exists"})
+			continue
+		}
+		src := s.TranscriptJSON
+		if src == "" {
+			src = s.Transcript
+		}
+		prov := recordingProvenance(src)
+		prov.URL = sourceURL(r, src)
+		body, err := renderTranscriptExport(src, opts, prov)
+		if err == nil {
+			_, err = writeFileAtomic(full, strings.NewReader(body))
+		}
+		if err != nil {
+			requestLogger(r).Error("vault export", "session", s.ID, "err", err)
+			res.Failed = append(res.Failed, vaultReason{s.ID, err.Error()})
+			continue
+		}
+		res.Written = append(res.Written, note)
+	}
+	publishEvent("vault.exported", "", map[string]any{"written": len(res.Written), "skipped": len(res.Skipped), "failed": len(res.Failed)})
+	writeJSON(w, res)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportMarkdown(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeWhisperFixture(t, dir)
+	mu.Lock()
+	meta, _ := loadMeta(dir + "/talk.webm")
+	meta.Tags = []string{"interview", "acme corp"}
+	rt := newRecordingTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("", 2*3600)))
+	meta.Recorded = &rt
+	if err := saveMeta(dir+"/talk.webm", meta); err != nil {
+		t.Fatal(err)
+	}
+	mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://viewer.local/api/transcripts/talk.json/export?format=markdown", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/markdown") {
+		t.Fatalf("status=%d headers=%v body=%s", rec.Code, rec.Header(), rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != "attachment; filename=talk.md" {
+		t.Fatalf("content-disposition=%q", cd)
+	}
+	md := rec.Body.String()
+	for _, want := range []string{
+		"---\ntitle: \"talk\"\ndate: 2024-05-01T10:00:00+02:00\nduration: \"01:02:05\"\n",
+		"tags:\n  - \"acme-corp\"\n  - \"interview\"\n",
+		"language: \"en\"\nsource: \"http://viewer.local/recordings/talk.webm\"\nengine: \"whisper small\"\n",
+		"---\n\n# talk\n\n## 00:00:00\n\nHello. World.\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestRenderMarkdownSections(t *testing.T) {
+	doc := transcriptDoc{Segments: []segment{
+		{Start: 0, End: 2, Text: " First."},
+		{Start: 290, End: 310, Text: " Still first."},
+		{Start: 310, End: 320, Text: " Second."},
+	}}
+	md := renderMarkdown(doc, markdownNote{Title: "t"}, provenance{App: appName, Version: appVersion}, true)
+	want := "# t\n\n## 00:00:00\n\n**[00:00:00]** First.\n**[00:04:50]** Still first.\n\n## 00:05:10\n\n**[00:05:10]** Second.\n"
+	if !strings.HasSuffix(md, want) {
+		t.Fatalf("markdown=%s", md)
+	}
+
+	md = renderMarkdown(transcriptDoc{Text: "Untimed text.", Segments: []segment{{Text: "Untimed text."}}}, markdownNote{Title: `a "quoted" name`}, provenance{}, false)
+	if !strings.Contains(md, `title: "a \"quoted\" name"`) || !strings.HasSuffix(md, "\nUntimed text.\n") || strings.Contains(md, "##") {
+		t.Fatalf("markdown=%s", md)
+	}
+}
+
+func TestVaultExport(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeWhisperFixture(t, dir)
+	writeTestFiles(t, dir, "2024/notes.webm", "2024/notes.txt", "silent.webm")
+	vault := t.TempDir()
+	useConfig(t, func(c *config) { c.VaultDir = vault })
+
+	post := func(body string) (int, vaultResult) {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/export/vault", strings.NewReader(body)))
+		var res vaultResult
+		json.NewDecoder(rec.Body).Decode(&res)
+		return rec.Code, res
+	}
+	code, res := post(`{"ids":["talk","2024/notes","silent"],"folder":"Meetings"}`)
+	if code != http.StatusOK || len(res.Written) != 2 || len(res.Skipped) != 1 || res.Skipped[0].Reason != "no transcript" {
+		t.Fatalf("status=%d result=%+v", code, res)
+	}
+	note, err := os.ReadFile(filepath.Join(vault, "Meetings", "2024", "notes.md"))
+	if err != nil || !strings.Contains(string(note), "# notes\n\n2024/notes.txt\n") {
+		t.Fatalf("note=%q err=%v", note, err)
+	}
+
+	// Notes edited in the vault are kept unless overwrite is set.
+	os.WriteFile(filepath.Join(vault, "Meetings", "talk.md"), []byte("my edits"), 0o644)
+	if _, res := post(`{"ids":["talk"],"folder":"Meetings"}`); len(res.Skipped) != 1 || res.Skipped[0].Reason != "note exists" {
+		t.Fatalf("result=%+v", res)
+	}
+	if _, res := post(`{"ids":["talk"],"folder":"Meetings","overwrite":true}`); len(res.Written) != 1 {
+		t.Fatalf("result=%+v", res)
+	}
+
+	if code, _ := post(`{"ids":["talk"],"folder":"../outside"}`); code != http.StatusBadRequest {
+		t.Fatalf("escaping folder status=%d", code)
+	}
+	useConfig(t, func(c *config) { c.VaultDir = "" })
+	if code, _ := post(`{"ids":["talk"]}`); code != http.StatusNotImplemented {
+		t.Fatalf("unconfigured status=%d", code)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partSuffix matches the ".part000" marker that auto-split segments carry
+// between the stem and the extension.
+var partSuffix = regexp.MustCompile(`\.part\d{3}$`)
+
+func isAudioFile(name string) bool {
+	return audioExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// probeDuration asks ffprobe for the container duration of fullPath.
+func probeDuration(fullPath string) (time.Duration, error) {
+	return probeDurationContext(context.Background(), fullPath)
+}
+
+// probeDurationContext is probeDuration, stopped when ctx is done.
+func probeDurationContext(ctx context.Context, fullPath string) (time.Duration, error) {
+	out, err := runCommandFunc(ctx, cfg().FFprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		fullPath,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: %v: %s", filepath.Base(fullPath), err, strings.TrimSpace(string(out)))
+	}
+	secs, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: unexpected duration %q", filepath.Base(fullPath), strings.TrimSpace(string(out)))
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// splitLongRecording enforces cfg.MaxRecordingDuration on an ingested audio
+// file: recordings longer than the limit are cut with ffmpeg's segment muxer
+// into stem.part000.ext, stem.part001.ext, … which recordingStem keeps in the
+// same session, and the original is removed. It returns the new part paths,
+// or nil when no split was needed. ffprobe and ffmpeg run without mu, which
+// is only taken to swap the parts in; callers must not hold it.
+func splitLongRecording(ctx context.Context, fullPath string) ([]string, error) {
+	limit := cfg().MaxRecordingDuration
+	if !needsSplitCheck(fullPath) {
+		return nil, nil
+	}
+	before, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	dur, err := probeDurationContext(ctx, fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if dur <= limit {
+		return nil, nil
+	}
+
+	dir := filepath.Dir(fullPath)
+	ext := filepath.Ext(fullPath)
+	stem := strings.TrimSuffix(filepath.Base(fullPath), ext)
+	pattern := filepath.Join(dir, stem+".part%03d"+ext)
+	partsGlob := filepath.Join(dir, globEscape(stem)+".part[0-9][0-9][0-9]"+globEscape(ext))
+	removeParts := func() {
+		parts, _ := filepath.Glob(partsGlob)
+		for _, p := range parts {
+			os.Remove(p)
+		}
+	}
+	out, err := runCommandFunc(ctx, cfg().FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", fullPath,
+		"-f", "segment",
+		"-segment_time", strconv.FormatFloat(limit.Seconds(), 'f', -1, 64),
+		"-reset_timestamps", "1",
+		"-c", "copy",
+		pattern,
+	)
+	if err != nil {
+		removeParts()
+		return nil, fmt.Errorf("ffmpeg segment %s: %v: %s", filepath.Base(fullPath), err, strings.TrimSpace(string(out)))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	parts, err := filepath.Glob(partsGlob)
+	if err != nil || len(parts) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no segments for %s", filepath.Base(fullPath))
+	}
+	// The recording may have been replaced or removed while ffmpeg ran;
+	// its parts would then be stale.
+	if now, err := os.Stat(fullPath); err != nil || now.Size() != before.Size() || !now.ModTime().Equal(before.ModTime()) {
+		removeParts()
+		return nil, fmt.Errorf("%s changed while it was being split", filepath.Base(fullPath))
+	}
+	sort.Strings(parts)
+	trackFiles(parts...)
+	if err := os.Remove(fullPath); err != nil {
+		return parts, err
+	}
+	forgetFiles(fullPath)
+	slog.Info("split long recording", "path", fullPath, "duration", dur.Round(time.Second), "parts", len(parts), "limit", limit)
+	return parts, nil
+}
+
+// needsSplitCheck reports whether fullPath falls under the duration
+// policy: an audio file other than a track, with a limit set.
+func needsSplitCheck(fullPath string) bool {
+	// Tracks must stay aligned with one another, so they are not split.
+	_, isTrack := trackName(filepath.Base(fullPath))
+	return cfg().MaxRecordingDuration > 0 && isAudioFile(fullPath) && !isTrack
+}
+
+// queueSplitJob queues a job applying the duration policy to the recording
+// at rel, unless it does not fall under it.
+func queueSplitJob(rel string) {
+	if !needsSplitCheck(rel) || cfg().ReadOnly || jobs.pending("split", rel) {
+		return
+	}
+	j := &job{ID: randomID(), Type: "split", Path: rel, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path)
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+}
+
+// splitJob runs a split job and publishes recording.split with the parts.
+func splitJob(ctx context.Context, j job) ([]string, error) {
+	parts, err := splitLongRecording(ctx, absPath(j.Path))
+	if err != nil || parts == nil {
+		return nil, err
+	}
+	rels := make([]string, len(parts))
+	for i, p := range parts {
+		rels[i], _ = relPath(p)
+	}
+	publishEvent("recording.split", j.Path, map[string]any{"parts": rels})
+	return rels, nil
+}
+
+// globEscape quotes glob metacharacters in a literal path fragment.
+func globEscape(s string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return r.Replace(s)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSegmenter emulates ffprobe reporting duration and ffmpeg writing
+// segment files for the given output pattern.
+func fakeSegmenter(t *testing.T, duration string, segments int) *[]string {
+	t.Helper()
+	var calls []string
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		calls = append(calls, name)
+		switch name {
+		case "ffprobe":
+			return []byte(duration + "\n"), nil
+		case "ffmpeg":
+			pattern := args[len(args)-1]
+			for i := 0; i < segments; i++ {
+				if err := os.WriteFile(fmt.Sprintf(pattern, i), []byte("seg"), 0o644); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	})
+	return &calls
+}
+
+func TestPutSplitsRecordingsOverLimit(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useConfig(t, func(c *config) {
+		c.MaxRecordingDuration = time.Hour
+		c.FFmpegPath, c.FFprobePath = "ffmpeg", "ffprobe"
+	})
+	fakeSegmenter(t, "9000.5", 3)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/meeting.webm", strings.NewReader(webmHeader+"audio"))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status=%d", rec.Code)
+	}
+	// The split runs as a job, after the response.
+	if _, err := os.Stat(filepath.Join(dir, "meeting.webm")); err != nil {
+		t.Fatalf("original should stay until the split job runs: %v", err)
+	}
+	ran := runQueuedJobs(t)
+	if len(ran) != 1 || ran[0].Type != "split" || ran[0].Status != jobCompleted || len(ran[0].Output) != 3 {
+		t.Fatalf("jobs=%+v want one completed split with 3 parts", ran)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "meeting.webm")); !os.IsNotExist(err) {
+		t.Fatalf("original should be replaced by parts, stat err=%v", err)
+	}
+
+	sessions, err := scanSessions()
+	if err != nil {
+		t.Fatalf("scanSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != "meeting" || len(sessions[0].Parts) != 3 {
+		t.Fatalf("sessions=%+v want one session with 3 parts", sessions)
+	}
+	if sessions[0].Audio != "meeting.part000.webm" {
+		t.Fatalf("audio=%q", sessions[0].Audio)
+	}
+}
+
+func TestSplitLongRecordingSkipsShortAndText(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) {
+		c.MaxRecordingDuration = time.Hour
+		c.FFmpegPath, c.FFprobePath = "ffmpeg", "ffprobe"
+	})
+	calls := fakeSegmenter(t, "120", 1)
+	writeTestFiles(t, dir, "short.webm", "notes.txt")
+
+	for _, name := range []string{"short.webm", "notes.txt"} {
+		parts, err := splitLongRecording(context.Background(), filepath.Join(dir, name))
+		if err != nil || parts != nil {
+			t.Fatalf("%s: parts=%v err=%v", name, parts, err)
+		}
+	}
+	if strings.Join(*calls, ",") != "ffprobe" {
+		t.Fatalf("calls=%v want only one ffprobe", *calls)
+	}
+}
+
+func TestSplitLongRecordingKeepsChangedOriginal(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) {
+		c.MaxRecordingDuration = time.Hour
+		c.FFmpegPath, c.FFprobePath = "ffmpeg", "ffprobe"
+	})
+	writeTestFiles(t, dir, "meeting.webm")
+	full := filepath.Join(dir, "meeting.webm")
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if name == "ffprobe" {
+			return []byte("9000\n"), nil
+		}
+		if !mu.TryLock() {
+			t.Error("ffmpeg ran under mu")
+		} else {
+			mu.Unlock()
+		}
+		os.WriteFile(fmt.Sprintf(args[len(args)-1], 0), []byte("seg"), 0o644)
+		// A new upload replaces the recording while it is being split.
+		return nil, os.WriteFile(full, []byte("a newer, longer recording"), 0o644)
+	})
+
+	if parts, err := splitLongRecording(context.Background(), full); err == nil || parts != nil {
+		t.Fatalf("parts=%v err=%v, want an error", parts, err)
+	}
+	if b, _ := os.ReadFile(full); string(b) != "a newer, longer recording" {
+		t.Fatalf("original = %q", b)
+	}
+	if parts, _ := filepath.Glob(filepath.Join(dir, "meeting.part*")); len(parts) != 0 {
+		t.Fatalf("stale parts left: %v", parts)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metaSuffix is appended to a recording's stem to form its sidecar metadata
+// file, e.g. "foo.webm" -> "foo.meta.json".
+const metaSuffix = ".meta.json"
+
+// recordingMeta is the sidecar metadata persisted next to a recording, also
+// called its manifest; manifest.schema.json describes the layout.
+type recordingMeta struct {
+	Schema        int                `json:"schema"`
+	Tags          []string           `json:"tags,omitempty"`
+	Remote        *remoteObject      `json:"remote,omitempty"`
+	Transcription *transcriptionInfo `json:"transcription,omitempty"`
+	Import        *importInfo        `json:"import,omitempty"`
+	Recorded      *recordingTime     `json:"recorded,omitempty"`
+	Source        *sourceInfo        `json:"source,omitempty"`
+	Calendar      *calendarInfo      `json:"calendar,omitempty"`
+	Partial       *partialInfo       `json:"partial,omitempty"`
+	Keywords      *keywordInfo       `json:"keywords,omitempty"`
+	Chapters      *chapterInfo       `json:"chapters,omitempty"`
+	Language      *languageInfo      `json:"language,omitempty"`
+	Gallery       *galleryInfo       `json:"gallery,omitempty"`
+	Favorite      *favoriteInfo      `json:"favorite,omitempty"`
+	Template      *templateInfo      `json:"template,omitempty"`
+	// Cold lists the audio files moved to cold storage; see coldFile.
+	Cold []coldFile `json:"cold,omitempty"`
+	// Fields are custom values by name; see customField.
+	Fields map[string]customField `json:"fields,omitempty"`
+	// Notes are free-form text about the session and Annotations mark
+	// moments in it.
+	Notes       string       `json:"notes,omitempty"`
+	Annotations []annotation `json:"annotations,omitempty"`
+}
+
+// transcriptionInfo records which engine produced a recording's transcript.
+type transcriptionInfo struct {
+	Engine string     `json:"engine"`
+	Model  string     `json:"model"`
+	JobID  string     `json:"jobId,omitempty"`
+	Range  *timeRange `json:"range,omitempty"`
+	// Enhanced is set when the audio was cleaned up before transcription.
+	Enhanced bool `json:"enhanced,omitempty"`
+	// Tracks are the tracks of a multi-track capture, or the channels of
+	// a stereo one, merged into the transcript.
+	Tracks      []string  `json:"tracks,omitempty"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// isMetaFile reports whether name is a sidecar metadata file.
+func isMetaFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), metaSuffix)
+}
+
+// metaPathFor returns the sidecar path for the recording at fullPath.
+func metaPathFor(fullPath string) string {
+	if isMetaFile(fullPath) {
+		return fullPath
+	}
+	return strings.TrimSuffix(fullPath, filepath.Ext(fullPath)) + metaSuffix
+}
+
+// loadMeta reads the sidecar for the recording at fullPath, upgrading it in
+// memory if it was written with an older schema. A missing sidecar yields
+// empty metadata rather than an error.
+func loadMeta(fullPath string) (recordingMeta, error) {
+	var meta recordingMeta
+	data, err := os.ReadFile(metaPathFor(fullPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, err
+	}
+	m, _, err := upgradeManifest(data)
+	if err != nil {
+		return meta, err
+	}
+	upgraded, err := json.Marshal(m)
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(upgraded, &meta); err != nil {
+		return meta, err
+	}
+	return meta, nil
+}
+
+// saveMeta validates meta against the current manifest schema and
+// atomically writes the sidecar for the recording at fullPath. Callers are
+// expected to hold mu.
+func saveMeta(fullPath string, meta recordingMeta) error {
+	meta.Schema = manifestSchemaVersion
+	if problems := meta.validate(); len(problems) > 0 {
+		return manifestErrors(problems)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(metaPathFor(fullPath), bytes.NewReader(append(data, '\n')))
+	return err
+}
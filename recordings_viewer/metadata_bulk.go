@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bulkMetadataChange is what POST /api/metadata/bulk does to each
+// recording it selects: set its language, file it under a project (the
+// tag "project:{project}", replacing any other project) and add tags.
+type bulkMetadataChange struct {
+	Language string   `json:"language"`
+	Project  string   `json:"project"`
+	AddTags  []string `json:"addTags"`
+}
+
+func (c *bulkMetadataChange) validate() error {
+	if c.Language = strings.TrimSpace(c.Language); c.Language != "" {
+		if c.Language = languageCode(c.Language); !languageCodePattern.MatchString(c.Language) {
+			return errors.New(`language must be a code such as "en"`)
+		}
+	}
+	c.Project = strings.TrimSpace(c.Project)
+	c.AddTags = normalizeTags(c.AddTags)
+	if c.Language == "" && c.Project == "" && len(c.AddTags) == 0 {
+		return errors.New("no changes: set language, project or addTags")
+	}
+	return nil
+}
+
+// bulkMetadataEdit is the change made, or with ?dry=1 to be made, to one
+// session. Language is only set when it changes.
+type bulkMetadataEdit struct {
+	Session          string   `json:"session"`
+	Added            []string `json:"added,omitempty"`
+	Removed          []string `json:"removed,omitempty"`
+	Language         string   `json:"language,omitempty"`
+	PreviousLanguage string   `json:"previousLanguage,omitempty"`
+	Tags             []string `json:"tags"`
+}
+
+// apply makes c to meta and reports what changed; ok is false when meta
+// already has every change.
+func (c bulkMetadataChange) apply(meta *recordingMeta) (edit bulkMetadataEdit, ok bool) {
+	tags := slices.Clone(meta.Tags)
+	want := c.AddTags
+	if c.Project != "" {
+		want = append(slices.Clone(want), "project:"+c.Project)
+		tags = slices.DeleteFunc(tags, func(tag string) bool {
+			if strings.HasPrefix(tag, "project:") && tag != "project:"+c.Project {
+				edit.Removed = append(edit.Removed, tag)
+				return true
+			}
+			return false
+		})
+	}
+	for _, tag := range want {
+		if !slices.Contains(tags, tag) {
+			edit.Added = append(edit.Added, tag)
+		}
+	}
+	meta.Tags = normalizeTags(append(tags, want...))
+	edit.Tags = meta.Tags
+	if c.Language != "" && (meta.Language == nil || meta.Language.Code != c.Language) {
+		if meta.Language != nil {
+			edit.PreviousLanguage = meta.Language.Code
+		}
+		edit.Language = c.Language
+		meta.Language = &languageInfo{Code: c.Language, Source: "manual", DetectedAt: time.Now().UTC()}
+	}
+	return edit, len(edit.Added) > 0 || len(edit.Removed) > 0 || edit.Language != ""
+}
+
+// bulkMetadataHandler serves POST /api/metadata/bulk: it makes one change
+// to every session named in ids or matching query, as for
+// /api/export/zip, or with ?dry=1 only reports what it would change.
+// Each change is written to the audit log as "metadata.updated".
+func bulkMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dry, _ := strconv.ParseBool(r.URL.Query().Get("dry"))
+	var payload struct {
+		IDs   []string `json:"ids"`
+		Query string   `json:"query"`
+		bulkMetadataChange
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	payload.Query = strings.TrimSpace(payload.Query)
+	if len(payload.IDs) == 0 && payload.Query == "" {
+		http.Error(w, "no sessions selected", http.StatusBadRequest)
+		return
+	}
+	change := payload.bulkMetadataChange
+	if err := change.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sessions, status, err := selectSessions(payload.IDs, payload.Query)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	edits := []bulkMetadataEdit{}
+	for _, s := range sessions {
+		edit, err := bulkEditSession(r, s, change, dry)
+		if err != nil {
+			http.Error(w, s.ID+": "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if edit != nil {
+			edits = append(edits, *edit)
+		}
+	}
+	if !dry {
+		requestLogger(r).Info("bulk metadata edit", "matched", len(sessions), "changed", len(edits))
+	}
+	writeJSON(w, map[string]any{"dryRun": dry, "matched": len(sessions), "edits": edits})
+}
+
+// bulkEditSession makes change to the manifest of s, unless dry, and
+// returns what changed, or nil when nothing would.
+func bulkEditSession(r *http.Request, s *session, change bulkMetadataChange, dry bool) (*bulkMetadataEdit, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	fullPath := s.metaPath()
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	edit, ok := change.apply(&meta)
+	if !ok {
+		return nil, nil
+	}
+	edit.Session = s.ID
+	if dry {
+		return &edit, nil
+	}
+	before, _ := currentSHA256(fullPath)
+	if err := saveMeta(fullPath, meta); err != nil {
+		return nil, err
+	}
+	after, _ := currentSHA256(fullPath)
+	rel, _ := relPath(fullPath)
+	data := map[string]any{"before": before, "after": after, "bulk": true}
+	if len(edit.Added) > 0 || len(edit.Removed) > 0 {
+		data["added"], data["removed"] = edit.Added, edit.Removed
+		publishEvent("tags.updated", s.ID, map[string]any{"tags": meta.Tags})
+	}
+	if edit.Language != "" {
+		data["language"] = edit.Language
+		publishEvent("language.updated", s.ID, map[string]any{"language": edit.Language})
+	}
+	auditChange(r, "metadata.updated", rel, data)
+	return &edit, nil
+}
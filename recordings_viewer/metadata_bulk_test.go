@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func bulkEdit(t *testing.T, url, body string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+	var res map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	return rec.Code, res
+}
+
+func TestBulkMetadataEdit(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "imports/a.webm", "imports/b.webm", "calls/c.webm")
+	mu.Lock()
+	saveMeta(filepath.Join(dir, "imports/a.webm"), recordingMeta{Tags: []string{"imported", "project:old"}})
+	saveMeta(filepath.Join(dir, "imports/b.webm"), recordingMeta{Tags: []string{"imported", "project:acme"}, Language: &languageInfo{Code: "de", Source: "manual", DetectedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}})
+	mu.Unlock()
+	body := `{"query": "tag:imported", "language": "de-DE", "project": "acme", "addTags": ["archive"]}`
+
+	// The preview changes nothing.
+	code, res := bulkEdit(t, "/api/metadata/bulk?dry=1", body)
+	if code != http.StatusOK || res["dryRun"] != true || res["matched"] != 2.0 || len(res["edits"].([]any)) != 2 {
+		t.Fatalf("dry run = %d %v", code, res)
+	}
+	if meta, _ := loadMeta(filepath.Join(dir, "imports/a.webm")); meta.Language != nil {
+		t.Fatalf("dry run changed %+v", meta)
+	}
+
+	code, res = bulkEdit(t, "/api/metadata/bulk", body)
+	if code != http.StatusOK || res["dryRun"] != false {
+		t.Fatalf("edit = %d %v", code, res)
+	}
+	edits := res["edits"].([]any)
+	a := edits[0].(map[string]any)
+	if a["session"] != "imports/a" || a["language"] != "de" || !reflect.DeepEqual(a["removed"], []any{"project:old"}) || !reflect.DeepEqual(a["added"], []any{"archive", "project:acme"}) {
+		t.Fatalf("a = %v", a)
+	}
+	// b only lacked the tag; its language stays as it was.
+	b := edits[1].(map[string]any)
+	if b["language"] != nil || !reflect.DeepEqual(b["added"], []any{"archive"}) {
+		t.Fatalf("b = %v", b)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "imports/a.webm"))
+	if !reflect.DeepEqual(meta.Tags, []string{"archive", "imported", "project:acme"}) || meta.Language == nil || meta.Language.Code != "de" || meta.Language.Source != "manual" {
+		t.Fatalf("meta = %+v", meta)
+	}
+	entries, _ := readAuditLog(auditFilter{event: "metadata.updated"}, 0)
+	if len(entries) != 2 || entries[1].Data["path"] != "imports/a.meta.json" || entries[1].Data["language"] != "de" {
+		t.Fatalf("audit = %+v", entries)
+	}
+
+	// Running it again changes nothing more.
+	if code, res = bulkEdit(t, "/api/metadata/bulk", body); code != http.StatusOK || len(res["edits"].([]any)) != 0 {
+		t.Fatalf("again = %d %v", code, res)
+	}
+
+	for _, bad := range []string{
+		`{"language": "de"}`,
+		`{"query": "tag:imported"}`,
+		`{"query": "tag:imported", "language": "Klingon"}`,
+		`{"query": "after:soon", "language": "de"}`,
+	} {
+		if code, _ := bulkEdit(t, "/api/metadata/bulk", bad); code != http.StatusBadRequest {
+			t.Errorf("%s: %d", bad, code)
+		}
+	}
+	if code, _ := bulkEdit(t, "/api/metadata/bulk", `{"ids": ["nope"], "addTags": ["x"]}`); code != http.StatusNotFound {
+		t.Errorf("unknown session: %d", code)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPreflightAllowedOrigin(t *testing.T) {
+	const origin = "chrome-extension://abcdefghijklmnop"
+	useConfig(t, func(c *config) { c.AllowedOrigins = []string{origin + "/"} })
+	called := false
+	h := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/transcripts/a.txt", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent || called {
+		t.Fatalf("preflight status=%d handlerCalled=%v", rec.Code, called)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+		t.Fatalf("allow-origin=%q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "content-type" {
+		t.Fatalf("allow-headers=%q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/transcripts/a.txt", nil)
+	req.Header.Set("Origin", origin)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if !called || rec.Header().Get("Access-Control-Allow-Origin") != origin {
+		t.Fatalf("actual request not passed through with CORS headers")
+	}
+}
+
+func TestCORSRejectsUnknownOriginPreflight(t *testing.T) {
+	useConfig(t, func(c *config) { c.AllowedOrigins = []string{"chrome-extension://good"} })
+	h := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/transcripts/a.txt", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("unexpected allow-origin header")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// whisperModel is a model the whisper CLI can load. Its weights are
+// published at modelsBaseURL/{SHA256}/{File}, and whisper looks for them
+// under File in its model directory.
+type whisperModel struct {
+	Name   string
+	File   string
+	SHA256 string
+}
+
+// whisperModels are the multilingual models, smallest first. "large" is
+// whatever whisper currently means by it.
+var whisperModels = []whisperModel{
+	{"tiny", "tiny.pt", "65147644a518d12f04e32d6f3b26facc3f8dd46e5390956a9424a650c0ce22b9"},
+	{"base", "base.pt", "ed3a0b6b1c0edf879ad9b11b1af5a0e6ab5db9205f891f668f8b0e6c6326e34e"},
+	{"small", "small.pt", "9ecf779972d90ba49c06d968637d720dd632c55bbf19d441fb42bf17a411e794"},
+	{"medium", "medium.pt", "345ae4da62f9b3d59415adc60127b97c714f32e89e936602e85993674d08dcb1"},
+	{"large", "large-v3.pt", "e5b1a55b89c1367dacf97e3e19bfd829a01529dbfdeefa8caeb59b3f1b81dadb"},
+}
+
+var (
+	modelsBaseURL = "https://openaipublic.azureedge.net/main/whisper/models"
+	// modelClient has no timeout: the large model is about 3 GB.
+	modelClient = &http.Client{}
+)
+
+func findWhisperModel(name string) (whisperModel, bool) {
+	for _, m := range whisperModels {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return whisperModel{}, false
+}
+
+// whisperModelDir is where whisper keeps its models: cfg.ModelDir, which is
+// passed to it with --model_dir, or its own default cache.
+func whisperModelDir() string {
+	if cfg().ModelDir != "" {
+		return cfg().ModelDir
+	}
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "whisper")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".cache", "whisper")
+	}
+	return filepath.Join(home, ".cache", "whisper")
+}
+
+// modelDownload is the progress of a model being downloaded, or why its
+// download failed.
+type modelDownload struct {
+	Status   string `json:"status"` // "downloading" or "failed"
+	Received int64  `json:"received"`
+	Total    int64  `json:"total,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// modelsMu guards modelDownloads and the saved model settings.
+var (
+	modelsMu       sync.Mutex
+	modelDownloads = map[string]*modelDownload{}
+)
+
+// modelSettings are the choices made through POST /api/models.
+type modelSettings struct {
+	Default string `json:"default,omitempty"`
+}
+
+func modelSettingsPath() string {
+	return filepath.Join(stateDir(), "models.json")
+}
+
+func loadModelSettings() (modelSettings, error) {
+	var s modelSettings
+	data, err := os.ReadFile(modelSettingsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(data, &s)
+}
+
+func saveModelSettings(s modelSettings) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(modelSettingsPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// defaultModel is the model a transcription uses when its job does not
+// choose: the one selected with POST /api/models, else cfg.DefaultModel.
+func defaultModel() string {
+	modelsMu.Lock()
+	s, err := loadModelSettings()
+	modelsMu.Unlock()
+	if err != nil {
+		slog.Error("read model settings", "err", err)
+	}
+	if s.Default != "" {
+		return s.Default
+	}
+	return cfg().DefaultModel
+}
+
+// progressWriter counts what is written through it into d.Received.
+type progressWriter struct{ d *modelDownload }
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	modelsMu.Lock()
+	p.d.Received += int64(len(b))
+	modelsMu.Unlock()
+	return len(b), nil
+}
+
+// startModelDownload begins downloading m in the background unless it is
+// already being downloaded. It reports whether it started one.
+func startModelDownload(m whisperModel) bool {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	if d := modelDownloads[m.Name]; d != nil && d.Status == "downloading" {
+		return false
+	}
+	d := &modelDownload{Status: "downloading"}
+	modelDownloads[m.Name] = d
+	dir := whisperModelDir()
+	go func() {
+		err := downloadModel(m, dir, d)
+		modelsMu.Lock()
+		defer modelsMu.Unlock()
+		if err != nil {
+			slog.Error("download model", "model", m.Name, "err", err)
+			d.Status, d.Error = "failed", err.Error()
+			publishEvent("model.failed", "", map[string]any{"model": m.Name, "error": err.Error()})
+			return
+		}
+		delete(modelDownloads, m.Name)
+		slog.Info("downloaded model", "model", m.Name, "bytes", d.Received)
+		publishEvent("model.downloaded", "", map[string]any{"model": m.Name})
+	}()
+	return true
+}
+
+// downloadModel fetches m into dir, checking it against its published
+// checksum before it replaces anything there.
+func downloadModel(m whisperModel, dir string, d *modelDownload) error {
+	res, err := modelClient.Get(modelsBaseURL + "/" + m.SHA256 + "/" + m.File)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: %s", m.File, res.Status)
+	}
+	modelsMu.Lock()
+	d.Total = res.ContentLength
+	modelsMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, m.File+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h, progressWriter{d}), res.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != m.SHA256 {
+		return fmt.Errorf("download %s: checksum mismatch", m.File)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, m.File))
+}
+
+// modelStatus is how GET /api/models lists a model.
+type modelStatus struct {
+	Name      string         `json:"name"`
+	Installed bool           `json:"installed"`
+	Bytes     int64          `json:"bytes,omitempty"`
+	Default   bool           `json:"default"`
+	Download  *modelDownload `json:"download,omitempty"`
+}
+
+func listModels() map[string]any {
+	dir := whisperModelDir()
+	def := defaultModel()
+	list := make([]modelStatus, 0, len(whisperModels))
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	for _, m := range whisperModels {
+		st := modelStatus{Name: m.Name, Default: m.Name == def}
+		if info, err := os.Stat(filepath.Join(dir, m.File)); err == nil && info.Mode().IsRegular() {
+			st.Installed, st.Bytes = true, info.Size()
+		}
+		if d := modelDownloads[m.Name]; d != nil {
+			cp := *d
+			st.Download = &cp
+		}
+		list = append(list, st)
+	}
+	return map[string]any{"dir": dir, "default": def, "models": list}
+}
+
+// modelsHandler serves GET /api/models, listing the whisper models with
+// whether each is installed and how far along a download is, and POST with
+// {"download": "small"} to fetch a model or {"default": "small"} to have
+// transcriptions use it when they do not name one.
+func modelsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, listModels())
+	case http.MethodPost:
+		var payload struct {
+			Download string `json:"download"`
+			Default  string `json:"default"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON body", bodyErrorStatus(err, http.StatusBadRequest))
+			return
+		}
+		if payload.Download == "" && payload.Default == "" {
+			http.Error(w, "download or default required", http.StatusBadRequest)
+			return
+		}
+		for _, name := range []string{payload.Download, payload.Default} {
+			if _, ok := findWhisperModel(name); name != "" && !ok {
+				http.Error(w, fmt.Sprintf("unknown model %q", name), http.StatusBadRequest)
+				return
+			}
+		}
+		logger := requestLogger(r)
+		if payload.Default != "" {
+			modelsMu.Lock()
+			s, err := loadModelSettings()
+			if err == nil {
+				s.Default = payload.Default
+				err = saveModelSettings(s)
+			}
+			modelsMu.Unlock()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			logger.Info("set default model", "model", payload.Default)
+			publishEvent("model.default", "", map[string]any{"model": payload.Default})
+		}
+		status := http.StatusOK
+		if m, ok := findWhisperModel(payload.Download); ok {
+			if _, err := os.Stat(filepath.Join(whisperModelDir(), m.File)); err != nil && startModelDownload(m) {
+				logger.Info("downloading model", "model", m.Name)
+				status = http.StatusAccepted
+			}
+		}
+		writeJSONStatus(w, status, listModels())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useModelServer serves a "tiny" model with the given content, published
+// under the checksum of published, and points the models API at it.
+func useModelServer(t *testing.T, content, published string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(published))
+	model := whisperModel{"tiny", "tiny.pt", hex.EncodeToString(sum[:])}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+model.SHA256+"/tiny.pt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(srv.Close)
+	dir := t.TempDir()
+	useConfig(t, func(c *config) { c.ModelDir = dir })
+	origModels, origURL := whisperModels, modelsBaseURL
+	whisperModels, modelsBaseURL = []whisperModel{model, {"base", "base.pt", "0"}}, srv.URL
+	modelsMu.Lock()
+	modelDownloads = map[string]*modelDownload{}
+	modelsMu.Unlock()
+	t.Cleanup(func() { whisperModels, modelsBaseURL = origModels, origURL })
+	return dir
+}
+
+func postModels(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	modelsHandler(rec, httptest.NewRequest(http.MethodPost, "/api/models", strings.NewReader(body)))
+	return rec
+}
+
+// waitForModel polls GET /api/models until check accepts the named model.
+func waitForModel(t *testing.T, name string, check func(modelStatus) bool) modelStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		modelsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/models", nil))
+		var res struct {
+			Models []modelStatus `json:"models"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		for _, m := range res.Models {
+			if m.Name == name && check(m) {
+				return m
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("model %s never settled: %s", name, rec.Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestModelsDownloadAndSelectDefault(t *testing.T) {
+	useTempBaseDir(t)
+	useJobQueue(t)
+	dir := useModelServer(t, "weights", "weights")
+
+	if rec := postModels(t, `{"download": "tiny"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("download: %d %s", rec.Code, rec.Body)
+	}
+	m := waitForModel(t, "tiny", func(m modelStatus) bool { return m.Download == nil })
+	if !m.Installed || m.Bytes != int64(len("weights")) {
+		t.Fatalf("model=%+v", m)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "tiny.pt")); string(data) != "weights" {
+		t.Fatalf("model file=%q", data)
+	}
+	// Installed models are not fetched again.
+	if rec := postModels(t, `{"download": "tiny"}`); rec.Code != http.StatusOK {
+		t.Fatalf("second download: %d", rec.Code)
+	}
+
+	if rec := postModels(t, `{"default": "tiny"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"default":"tiny"`) {
+		t.Fatalf("default: %d %s", rec.Code, rec.Body)
+	}
+	j, _ := queueTranscribeJobWith("call.webm", "whisper", "", transcribeOptions{})
+	if j.Model != "tiny" {
+		t.Fatalf("job model=%s", j.Model)
+	}
+	_, args, _ := engineArgs("whisper", cfg().Engines["whisper"], "call.webm", j.Model, "out")
+	if argAfter(args, "--model_dir") != dir {
+		t.Fatalf("engine args=%v", args)
+	}
+}
+
+func TestModelsDownloadRejectsChecksumMismatch(t *testing.T) {
+	useTempBaseDir(t)
+	dir := useModelServer(t, "tampered", "weights")
+
+	if rec := postModels(t, `{"download": "tiny"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("download: %d %s", rec.Code, rec.Body)
+	}
+	m := waitForModel(t, "tiny", func(m modelStatus) bool { return m.Download != nil && m.Download.Status == "failed" })
+	if m.Installed || !strings.Contains(m.Download.Error, "checksum") {
+		t.Fatalf("model=%+v download=%+v", m, m.Download)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("left files behind: %v", entries)
+	}
+}
+
+func TestModelsRejectsUnknownModels(t *testing.T) {
+	useTempBaseDir(t)
+	useModelServer(t, "weights", "weights")
+	for _, body := range []string{`{"download": "huge"}`, `{"default": "huge"}`, `{}`} {
+		if rec := postModels(t, body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", body, rec.Code)
+		}
+	}
+	if got := defaultModel(); got != cfg().DefaultModel {
+		t.Fatalf("default=%s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// namingFields are the placeholders a naming template may use: the day
+// and time the recording started, on the recorder's clock, the title and
+// host of the tab it was captured from, and the name the client sent.
+var namingFields = []string{"date", "time", "title", "host", "name"}
+
+// namingPlaceholder matches a {field} in a naming template.
+var namingPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// recordingName is what a naming template is filled in from.
+type recordingName struct {
+	Recorded time.Time
+	Title    string
+	URL      string
+	Name     string
+}
+
+// checkNamingTemplate reports what is wrong with tmpl, such as
+// "{date}/{time}_{title}": an unknown placeholder, a stray brace or a path
+// that leaves the folder it is applied in.
+func checkNamingTemplate(tmpl string) error {
+	for _, m := range namingPlaceholder.FindAllStringSubmatch(tmpl, -1) {
+		if !slices.Contains(namingFields, m[1]) {
+			return fmt.Errorf("unknown placeholder {%s} (want %s)", m[1], "{"+strings.Join(namingFields, "}, {")+"}")
+		}
+	}
+	rest := namingPlaceholder.ReplaceAllString(tmpl, "x")
+	switch {
+	case strings.ContainsAny(rest, `{}`):
+		return errors.New("unbalanced brace")
+	case strings.Contains(rest, `\`) || strings.HasPrefix(rest, "/"):
+		return errors.New("folders are separated by / and relative")
+	}
+	for _, part := range strings.Split(tmpl, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid folder %q", part)
+		}
+	}
+	return nil
+}
+
+// envNamingTemplate reads a naming template, ignoring an invalid one.
+func envNamingTemplate(name string) string {
+	raw := strings.TrimSpace(getenv(name))
+	if raw == "" {
+		return ""
+	}
+	if err := checkNamingTemplate(raw); err != nil {
+		invalidSetting(name, raw, err)
+		return ""
+	}
+	return raw
+}
+
+// renderName fills in tmpl. Each value is made safe for a file name by
+// safeName; a missing title falls back to the name sent, and a
+// folder or name left empty becomes "recording".
+func renderName(tmpl string, n recordingName) string {
+	name := recordingStem(path.Base(n.Name))
+	title := n.Title
+	if strings.TrimSpace(title) == "" {
+		title = name
+	}
+	host := ""
+	if u, err := url.Parse(n.URL); err == nil {
+		host = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	values := map[string]string{
+		"date":  n.Recorded.Format("2006-01-02"),
+		"time":  n.Recorded.Format("15-04-05"),
+		"title": safeName(title),
+		"host":  safeName(host),
+		"name":  safeName(name),
+	}
+	parts := strings.Split(tmpl, "/")
+	for i, part := range parts {
+		part = namingPlaceholder.ReplaceAllStringFunc(part, func(m string) string {
+			return values[m[1:len(m)-1]]
+		})
+		if part = strings.Trim(safeName(part), "-_."); part == "" {
+			part = "recording"
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, "/")
+}
+
+// namedRecordingPath returns where a recording the client would store at
+// rel is stored under cfg.NamingTemplate: the template's name, in rel's
+// folder, with "-2", "-3" and so on added when a recording of that name
+// is there already or taken says the path is spoken for. Without a
+// template rel is kept. Callers hold mu.
+func namedRecordingPath(rel string, n recordingName, taken func(string) bool) string {
+	if cfg().NamingTemplate == "" {
+		return rel
+	}
+	if n.Recorded.IsZero() {
+		n.Recorded = time.Now()
+	}
+	if n.Name == "" {
+		n.Name = path.Base(rel)
+	}
+	ext := path.Ext(rel)
+	base := path.Join(path.Dir(rel), renderName(cfg().NamingTemplate, n))
+	for i := 1; ; i++ {
+		candidate := base + ext
+		if i > 1 {
+			candidate = base + "-" + strconv.Itoa(i) + ext
+		}
+		if !recordingExists(candidate) && (taken == nil || !taken(candidate)) {
+			return candidate
+		}
+	}
+}
+
+// recordingExists reports whether any file shares the stem of rel, so a
+// new recording there would be paired with it.
+func recordingExists(rel string) bool {
+	names, _ := pairedFiles(absPath(rel))
+	return len(names) > 0
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckNamingTemplate(t *testing.T) {
+	for _, ok := range []string{"{date}_{time}_{title}", "{date}/{host}_{time}", "call-{name}"} {
+		if err := checkNamingTemplate(ok); err != nil {
+			t.Errorf("%s: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"{date}_{speaker}", "{date", "date}", "/{date}", "{date}//{time}", "../{title}", `{date}\{time}`} {
+		if err := checkNamingTemplate(bad); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestRenderName(t *testing.T) {
+	n := recordingName{
+		Recorded: time.Date(2024, 5, 1, 21, 30, 0, 0, time.FixedZone("", 2*3600)),
+		Title:    "Weekly sync: Q2 / roadmap?",
+		URL:      "https://www.meet.example.com/abc-defg",
+		Name:     "tab-capture.webm",
+	}
+	cases := map[string]string{
+		"{date}_{time}_{title}": "2024-05-01_21-30-00_Weekly_sync_Q2__roadmap",
+		"{date}/{host}_{time}":  "2024-05-01/meet.example.com_21-30-00",
+		"{name}":                "tab-capture",
+		"{title}_{name}":        "Weekly_sync_Q2__roadmap_tab-capture",
+	}
+	for tmpl, want := range cases {
+		if got := renderName(tmpl, n); got != want {
+			t.Errorf("%s = %q, want %q", tmpl, got, want)
+		}
+	}
+	if got := renderName("{host}/{title}", recordingName{Name: "call.webm"}); got != "recording/call" {
+		t.Errorf("without a tab = %q", got)
+	}
+}
+
+func TestUploadsFollowNamingTemplate(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.NamingTemplate = "{date}_{title}" })
+	writeTestFiles(t, dir, "2024/2024-05-01_Standup.txt")
+	create := func(body string) map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(body))
+		req.Header.Set("X-Recorded-At", "2024-05-01T09:00:00+02:00")
+		req.Header.Set("X-Source-Title", url.PathEscape("Standup"))
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create %s = %d %s", body, rec.Code, rec.Body)
+		}
+		var res map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		return res
+	}
+
+	// The transcript of an earlier standup is there, and the first upload
+	// is still staged when the second is created.
+	first := create(`{"path": "2024/capture-1.webm"}`)
+	second := create(`{"path": "2024/capture-2.webm"}`)
+	if first["path"] != "2024/2024-05-01_Standup-2.webm" || first["url"] != "/api/transcripts/2024/2024-05-01_Standup-2.webm" {
+		t.Fatalf("first = %v", first)
+	}
+	if second["path"] != "2024/2024-05-01_Standup-3.webm" {
+		t.Fatalf("second = %v", second)
+	}
+	// Tracks keep the path they were sent with.
+	if track := create(`{"path": "2024/capture-1.webm", "track": "mic"}`); track["path"] != "2024/capture-1.track-mic.webm" {
+		t.Fatalf("track = %v", track)
+	}
+}
+
+func TestImportFollowsNamingTemplate(t *testing.T) {
+	useTempBaseDir(t)
+	useJobQueue(t)
+	useConfig(t, func(c *config) { c.NamingTemplate = "{date}_{name}" })
+	useRunCommand(t, func(_ context.Context, name string, a ...string) ([]byte, error) {
+		return nil, os.WriteFile(a[len(a)-1], []byte("webm"), 0o644)
+	})
+	src := t.TempDir()
+	useConfig(t, func(c *config) { c.ImportDirs = []string{src} })
+	os.WriteFile(filepath.Join(src, "Zoom call.m4a"), []byte("m4a data"), 0o644)
+
+	for _, want := range []string{"imports/2024-03-04_Zoom_call", "imports/2024-03-04_Zoom_call-2"} {
+		body := `{"path": ` + strings.ReplaceAll(`"`+filepath.Join(src, "Zoom call.m4a")+`"`, `\`, `\\`) + `, "recordedAt": "2024-03-04T10:00:00-05:00"}`
+		rec := httptest.NewRecorder()
+		importHandler(rec, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body)))
+		var res importResult
+		if json.Unmarshal(rec.Body.Bytes(), &res); rec.Code != http.StatusCreated || res.Session != want {
+			t.Fatalf("import = %d %s, want %s", rec.Code, rec.Body, want)
+		}
+	}
+}
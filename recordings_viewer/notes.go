@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// annotation marks a moment of a recording, Time seconds from its start.
+type annotation struct {
+	ID        string    `json:"id"`
+	Time      float64   `json:"time"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt,omitzero"`
+}
+
+func (a annotation) check() error {
+	switch {
+	case math.IsNaN(a.Time) || a.Time < 0:
+		return errors.New("time must be a number of seconds, at least 0")
+	case strings.TrimSpace(a.Text) == "":
+		return errors.New("text must not be empty")
+	}
+	return nil
+}
+
+// splitSessionAction splits /api/sessions/{id}/notes,
+// /api/sessions/{id}/chapters, /api/sessions/{id}/cold,
+// /api/sessions/{id}/annotations and
+// /api/sessions/{id}/annotations/{n} into the session ID, the action and
+// the annotation ID.
+func splitSessionAction(p string) (id, action, arg string, ok bool) {
+	parts := strings.Split(p, "/")
+	n := len(parts)
+	switch {
+	case n >= 2 && (parts[n-1] == "notes" || parts[n-1] == "chapters" || parts[n-1] == "cold" || parts[n-1] == "annotations"):
+		return strings.Join(parts[:n-1], "/"), parts[n-1], "", true
+	case n >= 3 && parts[n-2] == "annotations":
+		return strings.Join(parts[:n-2], "/"), "annotations", parts[n-1], true
+	}
+	return "", "", "", false
+}
+
+// sessionNotesHandler serves GET/PUT /api/sessions/{id}/notes, free-form
+// text about a session kept in its manifest. PUT takes {"notes": "..."};
+// an empty string removes them.
+func sessionNotesHandler(w http.ResponseWriter, r *http.Request, s *session) {
+	switch r.Method {
+	case http.MethodGet:
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]string{"notes": meta.Notes})
+	case http.MethodPut:
+		var payload struct {
+			Notes *string `json:"notes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Notes == nil {
+			http.Error(w, `body must be {"notes": "..."}`, http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		meta.Notes = *payload.Notes
+		if strings.TrimSpace(meta.Notes) == "" {
+			meta.Notes = ""
+		}
+		if err := saveMeta(s.metaPath(), meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestLogger(r).Info("updated notes", "session", s.ID, "bytes", len(meta.Notes))
+		publishEvent("notes.updated", s.ID, map[string]any{"bytes": len(meta.Notes)})
+		writeJSON(w, map[string]string{"notes": meta.Notes})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// annotationsHandler serves /api/sessions/{id}/annotations: GET lists the
+// annotations in time order and POST adds one from {"time": 93.5,
+// "text": "..."}; PUT and DELETE /api/sessions/{id}/annotations/{n} change
+// or remove one.
+func annotationsHandler(w http.ResponseWriter, r *http.Request, s *session, id string) {
+	if r.Method == http.MethodGet {
+		meta, err := loadMeta(s.metaPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list := sortedAnnotations(meta.Annotations)
+		if id == "" {
+			writeJSON(w, list)
+			return
+		}
+		i := slices.IndexFunc(list, func(a annotation) bool { return a.ID == id })
+		if i < 0 {
+			http.Error(w, "annotation not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, list[i])
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && id == "":
+	case (r.Method == http.MethodPut || r.Method == http.MethodDelete) && id != "":
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload annotation
+	if r.Method != http.MethodDelete {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		payload.Text = strings.TrimSpace(payload.Text)
+		if err := payload.check(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	meta, err := loadMeta(s.metaPath())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	i := slices.IndexFunc(meta.Annotations, func(a annotation) bool { return a.ID == id })
+	if id != "" && i < 0 {
+		http.Error(w, "annotation not found", http.StatusNotFound)
+		return
+	}
+	now := time.Now().UTC()
+	var res annotation
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodPost:
+		res = annotation{ID: randomID(), Time: payload.Time, Text: payload.Text, CreatedAt: now}
+		meta.Annotations = append(meta.Annotations, res)
+		status = http.StatusCreated
+	case http.MethodPut:
+		res = meta.Annotations[i]
+		res.Time, res.Text, res.UpdatedAt = payload.Time, payload.Text, now
+		meta.Annotations[i] = res
+	case http.MethodDelete:
+		meta.Annotations = slices.Delete(meta.Annotations, i, i+1)
+	}
+	meta.Annotations = sortedAnnotations(meta.Annotations)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	if err := saveMeta(s.metaPath(), meta); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("updated annotations", "session", s.ID, "method", r.Method, "annotations", len(meta.Annotations))
+	publishEvent("annotations.updated", s.ID, map[string]any{"annotations": sortedAnnotations(meta.Annotations)})
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONStatus(w, status, res)
+}
+
+// sortedAnnotations returns list in time order, never nil.
+func sortedAnnotations(list []annotation) []annotation {
+	out := append([]annotation{}, list...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time < out[j].Time })
+	return out
+}
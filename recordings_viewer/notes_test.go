@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sessionRequest(t *testing.T, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestSessionNotes(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "uuid/clip/audio.webm", "uuid/clip/transcript.txt")
+
+	rec := sessionRequest(t, http.MethodPut, "/api/sessions/uuid/clip/audio/notes", `{"notes": "Follow up with Dana about the budget."}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	rec = sessionRequest(t, http.MethodGet, "/api/sessions/uuid/clip/audio/notes", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Follow up with Dana") {
+		t.Fatalf("GET: %d %s", rec.Code, rec.Body)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "uuid/clip/audio.webm"))
+	if meta.Notes != "Follow up with Dana about the budget." {
+		t.Fatalf("meta=%+v", meta)
+	}
+	if rec := sessionRequest(t, http.MethodPut, "/api/sessions/uuid/clip/audio/notes", `{}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("PUT without notes: %d", rec.Code)
+	}
+	if rec := sessionRequest(t, http.MethodGet, "/api/sessions/missing/notes", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing session: %d", rec.Code)
+	}
+}
+
+func TestSessionAnnotations(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+
+	add := func(body string) annotation {
+		t.Helper()
+		rec := sessionRequest(t, http.MethodPost, "/api/sessions/call/annotations", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("POST %s: %d %s", body, rec.Code, rec.Body)
+		}
+		var a annotation
+		json.Unmarshal(rec.Body.Bytes(), &a)
+		return a
+	}
+	later := add(`{"time": 754.5, "text": "  decision: ship Friday "}`)
+	first := add(`{"time": 12, "text": "intro"}`)
+	if later.ID == "" || later.Text != "decision: ship Friday" || later.CreatedAt.IsZero() {
+		t.Fatalf("annotation=%+v", later)
+	}
+	for _, bad := range []string{`{"time": -1, "text": "x"}`, `{"time": 3, "text": " "}`, `{"time": "soon"}`} {
+		if rec := sessionRequest(t, http.MethodPost, "/api/sessions/call/annotations", bad); rec.Code != http.StatusBadRequest {
+			t.Fatalf("POST %s: %d", bad, rec.Code)
+		}
+	}
+
+	rec := sessionRequest(t, http.MethodGet, "/api/sessions/call/annotations", "")
+	var list []annotation
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list) != 2 || list[0].ID != first.ID || list[1].ID != later.ID {
+		t.Fatalf("list=%+v", list)
+	}
+
+	rec = sessionRequest(t, http.MethodPut, "/api/sessions/call/annotations/"+first.ID, `{"time": 15, "text": "intro ends"}`)
+	var edited annotation
+	json.Unmarshal(rec.Body.Bytes(), &edited)
+	if rec.Code != http.StatusOK || edited.Time != 15 || edited.UpdatedAt.IsZero() || !edited.CreatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	if rec := sessionRequest(t, http.MethodDelete, "/api/sessions/call/annotations/"+later.ID, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d", rec.Code)
+	}
+	if rec := sessionRequest(t, http.MethodDelete, "/api/sessions/call/annotations/"+later.ID, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("DELETE again: %d", rec.Code)
+	}
+	if rec := sessionRequest(t, http.MethodPut, "/api/sessions/call/annotations", `{"time": 1, "text": "x"}`); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT on list: %d", rec.Code)
+	}
+
+	meta, _ := loadMeta(filepath.Join(dir, "call.webm"))
+	if len(meta.Annotations) != 1 || meta.Annotations[0].Text != "intro ends" {
+		t.Fatalf("meta=%+v", meta.Annotations)
+	}
+	if problems := meta.validate(); len(problems) != 0 {
+		t.Fatalf("stored manifest invalid: %v", problems)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The offline manifest lets the viewer keep a copy of the library, say in
+// a service worker's cache: GET /api/manifest lists every session with the
+// size and SHA-256 of each of its files, and a cursor. Passing the cursor
+// back as ?since= returns only the sessions that changed after it and the
+// IDs of those removed. Each change to a session, noticed when the
+// manifest is served, gets the next version number; the cursor is the
+// last one handed out.
+
+// maxOfflineRemovals bounds the removed sessions remembered for deltas. A
+// cursor older than the oldest one forgotten gets the full list again.
+const maxOfflineRemovals = 1000
+
+// offlineFile is one file of a session in the offline manifest.
+type offlineFile struct {
+	Path    string    `json:"path"`
+	URL     string    `json:"url"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// offlineSession is a session in the offline manifest. Version is the
+// number of its last change.
+type offlineSession struct {
+	ID      string        `json:"id"`
+	Version int64         `json:"version"`
+	Files   []offlineFile `json:"files"`
+}
+
+// offlineVersion is what the server remembers of a session it listed: a
+// digest of its files and the version they were given.
+type offlineVersion struct {
+	Digest  string `json:"digest"`
+	Version int64  `json:"version"`
+}
+
+// offlineManifestState is kept in .viewer/offline-manifest.json. Epoch
+// tells cursors of this state from those of one that was lost, and Floor
+// is the newest version of a forgotten removal.
+type offlineManifestState struct {
+	Epoch    string                    `json:"epoch"`
+	Seq      int64                     `json:"seq"`
+	Floor    int64                     `json:"floor"`
+	Sessions map[string]offlineVersion `json:"sessions"`
+	Removed  map[string]int64          `json:"removed"`
+}
+
+func offlineManifestPath() string {
+	return filepath.Join(stateDir(), "offline-manifest.json")
+}
+
+// loadOfflineManifest reads the state, starting a new epoch when there is
+// none. Callers hold mu.
+func loadOfflineManifest() (*offlineManifestState, error) {
+	state := &offlineManifestState{Epoch: randomID(), Sessions: map[string]offlineVersion{}, Removed: map[string]int64{}}
+	data, err := os.ReadFile(offlineManifestPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveOfflineManifest(state *offlineManifestState) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(offlineManifestPath(), bytes.NewReader(append(data, '\n')))
+	return err
+}
+
+// cursor is the cursor for everything state has versioned so far.
+func (state *offlineManifestState) cursor() string {
+	return state.Epoch + "." + strconv.FormatInt(state.Seq, 10)
+}
+
+// update versions the sessions whose files differ from when they were
+// last listed, and records the removal of those gone.
+func (state *offlineManifestState) update(current map[string]*offlineSession) {
+	ids := make([]string, 0, len(current))
+	for id := range current {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s := current[id]
+		digest := offlineDigest(s.Files)
+		v, ok := state.Sessions[id]
+		if !ok || v.Digest != digest {
+			state.Seq++
+			v = offlineVersion{Digest: digest, Version: state.Seq}
+			state.Sessions[id] = v
+			delete(state.Removed, id)
+		}
+		s.Version = v.Version
+	}
+	for id := range state.Sessions {
+		if _, ok := current[id]; !ok {
+			state.Seq++
+			state.Removed[id] = state.Seq
+			delete(state.Sessions, id)
+		}
+	}
+	for len(state.Removed) > maxOfflineRemovals {
+		oldest := ""
+		for id, v := range state.Removed {
+			if oldest == "" || v < state.Removed[oldest] {
+				oldest = id
+			}
+		}
+		state.Floor = max(state.Floor, state.Removed[oldest])
+		delete(state.Removed, oldest)
+	}
+}
+
+// offlineDigest sums the paths, sizes and hashes of files.
+func offlineDigest(files []offlineFile) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s\n", f.Path, f.Size, f.SHA256)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseOfflineCursor splits a cursor into its epoch and version.
+func parseOfflineCursor(cursor string) (string, int64, error) {
+	epoch, seq, ok := strings.Cut(cursor, ".")
+	n, err := strconv.ParseInt(seq, 10, 64)
+	if !ok || epoch == "" || err != nil || n < 0 {
+		return "", 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return epoch, n, nil
+}
+
+// currentOfflineSessions lists every session with its files' sizes and
+// hashes, taken from the checksum index where it is current.
+func currentOfflineSessions() (map[string]*offlineSession, error) {
+	sessions, err := scanSessions()
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := collectBackupCandidates()
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]fileChecksum, len(candidates))
+	for _, c := range candidates {
+		sums[c.rel] = c.sum
+	}
+	out := make(map[string]*offlineSession, len(sessions))
+	for _, s := range sessions {
+		entry := &offlineSession{ID: s.ID, Files: []offlineFile{}}
+		for _, f := range s.Files {
+			sum, ok := sums[f]
+			if !ok {
+				continue
+			}
+			entry.Files = append(entry.Files, offlineFile{Path: f, URL: recordingsURL(f), Size: sum.Size, SHA256: sum.SHA256, ModTime: sum.ModTime})
+		}
+		out[s.ID] = entry
+	}
+	return out, nil
+}
+
+// offlineManifestHandler serves GET /api/manifest: every session with the
+// files the viewer needs to keep it offline, and a cursor. With
+// ?since={cursor} only the sessions changed after the cursor are listed,
+// with the IDs of those removed in "removed". A cursor this server can no
+// longer answer, say after its state was lost, gets the full list, marked
+// "full".
+func offlineManifestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var sinceEpoch string
+	var since int64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if sinceEpoch, since, err = parseOfflineCursor(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	current, err := currentOfflineSessions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mu.Lock()
+	state, err := loadOfflineManifest()
+	if err == nil {
+		before := state.Seq
+		state.update(current)
+		// An empty library is saved too, so its epoch is kept.
+		if state.Seq != before || state.Seq == 0 {
+			err = saveOfflineManifest(state)
+		}
+	}
+	mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	full := sinceEpoch != state.Epoch || since < state.Floor || since > state.Seq
+	sessions := []*offlineSession{}
+	for _, s := range current {
+		if full || s.Version > since {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	removed := []string{}
+	if !full {
+		for id, v := range state.Removed {
+			if v > since {
+				removed = append(removed, id)
+			}
+		}
+		sort.Strings(removed)
+	}
+	writeJSON(w, map[string]any{"cursor": state.cursor(), "full": full, "sessions": sessions, "removed": removed})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type offlineManifestResponse struct {
+	Cursor   string           `json:"cursor"`
+	Full     bool             `json:"full"`
+	Sessions []offlineSession `json:"sessions"`
+	Removed  []string         `json:"removed"`
+}
+
+func getOfflineManifest(t *testing.T, since string) offlineManifestResponse {
+	t.Helper()
+	url := "/api/manifest"
+	if since != "" {
+		url += "?since=" + since
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", url, rec.Code, rec.Body)
+	}
+	var res offlineManifestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestOfflineManifest(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "a.txt", "b.webm", "c.webm")
+
+	first := getOfflineManifest(t, "")
+	if !first.Full || len(first.Sessions) != 3 || first.Sessions[0].ID != "a" || len(first.Sessions[0].Files) != 2 {
+		t.Fatalf("first = %+v", first)
+	}
+	f := first.Sessions[0].Files[0]
+	if f.Path != "a.txt" || f.URL != "/recordings/a.txt" || f.Size != 5 || f.SHA256 != sumOf("a.txt") {
+		t.Fatalf("file = %+v", f)
+	}
+
+	// Nothing changed.
+	same := getOfflineManifest(t, first.Cursor)
+	if same.Full || len(same.Sessions) != 0 || len(same.Removed) != 0 || same.Cursor != first.Cursor {
+		t.Fatalf("unchanged = %+v", same)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("edited transcript"), 0o644)
+	os.Remove(filepath.Join(dir, "b.webm"))
+	writeTestFiles(t, dir, "d.webm")
+	delta := getOfflineManifest(t, first.Cursor)
+	if delta.Full || len(delta.Sessions) != 2 || delta.Sessions[0].ID != "a" || delta.Sessions[1].ID != "d" || strings.Join(delta.Removed, ",") != "b" {
+		t.Fatalf("delta = %+v", delta)
+	}
+	if delta.Sessions[0].Version <= first.Sessions[0].Version {
+		t.Fatalf("version not bumped: %d", delta.Sessions[0].Version)
+	}
+	if later := getOfflineManifest(t, delta.Cursor); len(later.Sessions) != 0 || len(later.Removed) != 0 {
+		t.Fatalf("after delta = %+v", later)
+	}
+
+	// A cursor of another server, or of lost state, gets everything.
+	if other := getOfflineManifest(t, "elsewhere.3"); !other.Full || len(other.Sessions) != 3 {
+		t.Fatalf("foreign cursor = %+v", other)
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/manifest?since=3", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed cursor = %d", rec.Code)
+	}
+}
+
+func TestOfflineManifestForgetsOldRemovals(t *testing.T) {
+	state := &offlineManifestState{Epoch: "e", Sessions: map[string]offlineVersion{}, Removed: map[string]int64{}}
+	current := map[string]*offlineSession{}
+	for i := 0; i < maxOfflineRemovals+2; i++ {
+		id := "s" + strings.Repeat("x", i)
+		current[id] = &offlineSession{ID: id}
+	}
+	state.update(current)
+	state.update(map[string]*offlineSession{})
+	if len(state.Removed) != maxOfflineRemovals || state.Floor != int64(maxOfflineRemovals+4) {
+		t.Fatalf("removed %d, floor %d", len(state.Removed), state.Floor)
+	}
+}
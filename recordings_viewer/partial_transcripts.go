@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runCommandLinesFunc runs a command like runCommandFunc, also passing each
+// line it prints to onLine as it comes. Python buffers what it prints to a
+// pipe, so PYTHONUNBUFFERED is set for the whisper CLI's sake. Tests
+// replace it through useRunCommand.
+var runCommandLinesFunc = func(ctx context.Context, onLine func(string), name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "PYTHONUNBUFFERED=1")
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	var out bytes.Buffer
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		sc := bufio.NewScanner(pr)
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			out.Write(sc.Bytes())
+			out.WriteByte('\n')
+			onLine(sc.Text())
+		}
+		// Keep the process from blocking on a line too long to scan.
+		io.Copy(io.Discard, pr)
+	}()
+	err := cmd.Run()
+	pw.Close()
+	<-read
+	return out.Bytes(), err
+}
+
+// whisperProgressLine is a segment as the whisper CLI prints it while
+// transcribing: "[01:02.500 --> 01:05.000]  text", hours added past one.
+var whisperProgressLine = regexp.MustCompile(`^\[((?:\d+:)?\d+:\d+\.\d+) --> ((?:\d+:)?\d+:\d+\.\d+)\]\s*(.*)$`)
+
+// parseProgressLine returns the segment line describes, if it is one.
+func parseProgressLine(line string) (segment, bool) {
+	m := whisperProgressLine.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return segment{}, false
+	}
+	start, err1 := parseClock(m[1])
+	end, err2 := parseClock(m[2])
+	if err1 != nil || err2 != nil {
+		return segment{}, false
+	}
+	return segment{Start: start, End: end, Text: " " + m[3]}, true
+}
+
+// parseClock parses "mm:ss.fff" or "hh:mm:ss.fff" into seconds.
+func parseClock(s string) (float64, error) {
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, err
+		}
+		total = total*60 + v
+	}
+	return total, nil
+}
+
+// partialTranscript is what a running transcription has produced so far,
+// kept in .viewer/partial/<job id>.json so search finds long recordings
+// before they are done. It is removed when the job ends, with or without
+// a transcript.
+type partialTranscript struct {
+	Path      string    `json:"path"`
+	Job       string    `json:"job"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Segments  []segment `json:"segments"`
+	// written is when the file was last written, and dirty whether
+	// segments were added since.
+	written time.Time
+	dirty   bool
+}
+
+// partialFlushInterval is how often a running job's segments are written
+// out at most.
+const partialFlushInterval = time.Second
+
+var partials = struct {
+	sync.Mutex
+	byJob map[string]*partialTranscript
+}{byJob: map[string]*partialTranscript{}}
+
+func partialDir() string {
+	return filepath.Join(stateDir(), "partial")
+}
+
+// addPartialSegment records a segment of j's transcript as the engine
+// prints it, writing the job's partial transcript once
+// partialFlushInterval has passed since it last was.
+func addPartialSegment(j job, seg segment) {
+	if j.Range != nil {
+		seg.Start += j.Range.Start
+		seg.End += j.Range.Start
+	}
+	partials.Lock()
+	defer partials.Unlock()
+	p := partials.byJob[j.ID]
+	if p == nil {
+		p = &partialTranscript{Path: j.Path, Job: j.ID}
+		partials.byJob[j.ID] = p
+	}
+	seg.ID = len(p.Segments)
+	p.Segments = append(p.Segments, seg)
+	p.dirty = true
+	if time.Since(p.written) >= partialFlushInterval {
+		writePartialTranscript(p)
+	}
+}
+
+// writePartialTranscript writes p. Callers hold partials.
+func writePartialTranscript(p *partialTranscript) {
+	p.UpdatedAt = time.Now().UTC()
+	p.written, p.dirty = p.UpdatedAt, false
+	data, err := json.Marshal(p)
+	if err == nil {
+		err = os.MkdirAll(partialDir(), 0o755)
+	}
+	if err == nil {
+		_, err = writeFileAtomic(filepath.Join(partialDir(), p.Job+".json"), bytes.NewReader(data))
+	}
+	if err != nil {
+		slog.Warn("write partial transcript", "job", p.Job, "err", err)
+	}
+}
+
+// flushPartialTranscript writes the segments of j not written yet, at the
+// end of an engine run.
+func flushPartialTranscript(j job) {
+	partials.Lock()
+	defer partials.Unlock()
+	if p := partials.byJob[j.ID]; p != nil && p.dirty {
+		writePartialTranscript(p)
+	}
+}
+
+// dropPartialTranscript removes j's partial transcript once the job has
+// ended.
+func dropPartialTranscript(j job) {
+	partials.Lock()
+	defer partials.Unlock()
+	delete(partials.byJob, j.ID)
+	if err := os.Remove(filepath.Join(partialDir(), j.ID+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("remove partial transcript", "job", j.ID, "err", err)
+	}
+}
+
+// clearPartialTranscripts removes the partial transcripts of jobs an
+// earlier run of the server left behind; restored jobs start over.
+func clearPartialTranscripts() {
+	if err := os.RemoveAll(partialDir()); err != nil {
+		slog.Warn("clear partial transcripts", "err", err)
+	}
+}
+
+// loadPartialTranscripts reads the partial transcripts of the jobs running
+// now, in this process or another.
+func loadPartialTranscripts() ([]partialTranscript, error) {
+	entries, err := os.ReadDir(partialDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []partialTranscript
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(partialDir(), e.Name()))
+		if err != nil {
+			// Removed as its job ended.
+			continue
+		}
+		var p partialTranscript
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	for line, want := range map[string]segment{
+		"[00:01.500 --> 00:04.000]  Hello there.":        {Start: 1.5, End: 4, Text: " Hello there."},
+		"[01:02:03.000 --> 01:02:05.250] General Kenobi": {Start: 3723, End: 3725.25, Text: " General Kenobi"},
+	} {
+		if got, ok := parseProgressLine(line); !ok || got != want {
+			t.Errorf("%q = %+v, %v", line, got, ok)
+		}
+	}
+	if _, ok := parseProgressLine("Detected language: English"); ok {
+		t.Error("parsed a line that is not a segment")
+	}
+}
+
+func TestSearchWhileTranscribing(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "lecture.webm")
+	fakeWhisper(t, "3600", nil)
+	var during []searchHit
+	runCommandLinesFunc = func(_ context.Context, onLine func(string), name string, args ...string) ([]byte, error) {
+		onLine("Detected language: English")
+		onLine("[00:00.000 --> 00:05.000]  Welcome to the lecture on Kenobi.")
+		_, out, _ := runTestCLI(t, true, "search", "kenobi")
+		if err := json.Unmarshal([]byte(out), &during); err != nil {
+			t.Errorf("search = %s", out)
+		}
+		onLine("[00:05.000 --> 00:09.000]  Kenobi again.")
+		return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), "lecture.json"),
+			[]byte(`{"text": "Welcome to the lecture on Kenobi. Kenobi again.", "segments": [{"start": 0, "end": 5, "text": " Welcome to the lecture on Kenobi."}, {"start": 5, "end": 9, "text": " Kenobi again."}]}`), 0o644)
+	}
+
+	j := queueTranscription(t, "lecture.webm")
+	runJob(j)
+	if len(during) != 1 || during[0].Complete || during[0].Path != "lecture.webm" || during[0].Session != "lecture" {
+		t.Fatalf("hits while transcribing = %+v", during)
+	}
+	_, out, _ := runTestCLI(t, true, "search", "kenobi")
+	var after []searchHit
+	if err := json.Unmarshal([]byte(out), &after); err != nil || len(after) != 2 || !after[0].Complete || after[0].Path != "lecture.json" {
+		t.Fatalf("hits after = %s", out)
+	}
+	if entries, _ := os.ReadDir(partialDir()); len(entries) != 0 {
+		t.Fatalf("partial transcripts left: %v", entries)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// recordingsHandler serves /recordings/ from every workspace. http.FileServer
+// answers Range and If-Range requests, which audio elements need to seek.
+// Audio moved to cold storage in S3 is redirected to the bucket.
+func recordingsHandler() http.Handler {
+	files := http.FileServer(recordingsFS{})
+	return http.StripPrefix("/recordings/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signed, ok := coldRedirect(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")); ok {
+			http.Redirect(w, r, signed, http.StatusTemporaryRedirect)
+			return
+		}
+		setContentType(w, r.URL.Path)
+		files.ServeHTTP(w, r)
+	}))
+}
+
+// seekableAudio remembers, by artifactKey of the source, whether a WebM
+// file already carries its duration, so each version is probed once.
+var seekableAudio sync.Map
+
+// seekableCopy returns a file with the same audio as the WebM at src that
+// players can seek in. MediaRecorder writes WebM without a duration or cues
+// because it streams as it records, so browsers can only seek in it by
+// restarting playback; such files are remuxed (no re-encoding) into the
+// export cache. Other files are returned as they are.
+func seekableCopy(src string) (string, error) {
+	if strings.ToLower(path.Ext(src)) != ".webm" {
+		return src, nil
+	}
+	key, err := artifactKey("seekable", src)
+	if err != nil {
+		return "", err
+	}
+	if ok, known := seekableAudio.Load(key); known && ok.(bool) {
+		return src, nil
+	}
+	if _, err := probeDuration(src); err == nil {
+		seekableAudio.Store(key, true)
+		return src, nil
+	}
+	return cachedArtifact(key, ".webm", func(ctx context.Context, out string) error {
+		output, err := runCommandFunc(ctx, cfg().FFmpegPath,
+			"-hide_banner", "-loglevel", "error", "-y",
+			"-i", src, "-map", "0", "-c", "copy", out)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, outputTail(output))
+		}
+		return nil
+	})
+}
+
+// recordingStreamHandler serves GET /api/recordings/{id}/stream: the audio of
+// the session with that ID (or of the named audio file, for a part of a split
+// recording) in a form the browser can seek in, with Range support.
+func recordingStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/recordings/"), "/stream")
+	if !ok || id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	s, err := findSession(id)
+	if err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	audio := s.Audio
+	if clean, err := normalizeRecordingsRelative(id); err == nil && isAudioFile(clean) {
+		for _, f := range s.Files {
+			if f == filepath.ToSlash(clean) {
+				audio = f
+			}
+		}
+	}
+	if audio == "" {
+		http.Error(w, "recording has no audio", http.StatusNotFound)
+		return
+	}
+	src := absPath(audio)
+	out, err := seekableCopy(src)
+	if err != nil {
+		// Playback without seeking beats none.
+		requestLogger(r).Warn("remux for seeking", "path", audio, "err", err)
+		out = src
+	}
+	setContentType(w, audio)
+	http.ServeFile(w, r, out)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRecordingsServeRanges(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm", "memo.m4a")
+
+	req := httptest.NewRequest(http.MethodGet, "/recordings/call.webm", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "ll.w" {
+		t.Fatalf("range: %d %q", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 2-5/9" {
+		t.Fatalf("Content-Range = %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "audio/webm" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/recordings/memo.m4a", nil))
+	if got := rec.Header().Get("Content-Type"); got != "audio/mp4" {
+		t.Fatalf("m4a Content-Type = %q", got)
+	}
+}
+
+// fakeStreamRemux answers ffprobe with duration and ffmpeg by writing "remuxed",
+// counting the ffmpeg runs.
+func fakeStreamRemux(t *testing.T, duration string, remuxErr error) *int {
+	t.Helper()
+	runs := 0
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case cfg().FFprobePath:
+			return []byte(duration + "\n"), nil
+		case cfg().FFmpegPath:
+			runs++
+			if remuxErr != nil {
+				return []byte("bad input"), remuxErr
+			}
+			return nil, os.WriteFile(args[len(args)-1], []byte("remuxed"), 0o644)
+		}
+		t.Fatalf("unexpected command %s", name)
+		return nil, nil
+	})
+	return &runs
+}
+
+func getStream(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestRecordingStreamRemuxesUnseekableWebM(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm", "call.txt")
+	runs := fakeStreamRemux(t, "N/A", nil)
+
+	for range 2 {
+		rec := getStream(t, "/api/recordings/call/stream")
+		if rec.Code != http.StatusOK || rec.Body.String() != "remuxed" {
+			t.Fatalf("stream: %d %q", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "audio/webm" {
+			t.Fatalf("Content-Type = %q", got)
+		}
+	}
+	if *runs != 1 {
+		t.Fatalf("ffmpeg ran %d times, want 1 (cached)", *runs)
+	}
+}
+
+func TestRecordingStreamServesSeekableAudioAsIs(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm", "talk.part000.webm", "talk.part001.webm")
+	runs := fakeStreamRemux(t, "12.5", nil)
+
+	if rec := getStream(t, "/api/recordings/call.webm/stream"); rec.Body.String() != "call.webm" {
+		t.Fatalf("stream = %q", rec.Body)
+	}
+	// A part of a split recording is streamed by its path.
+	if rec := getStream(t, "/api/recordings/talk.part001.webm/stream"); rec.Body.String() != "talk.part001.webm" {
+		t.Fatalf("part stream = %q", rec.Body)
+	}
+	if *runs != 0 {
+		t.Fatalf("ffmpeg ran %d times for seekable audio", *runs)
+	}
+	if rec := getStream(t, "/api/recordings/missing/stream"); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing recording status = %d", rec.Code)
+	}
+}
+
+func TestRecordingStreamFallsBackWhenRemuxFails(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+	fakeStreamRemux(t, "N/A", errors.New("exit status 1"))
+
+	if rec := getStream(t, "/api/recordings/call/stream"); rec.Code != http.StatusOK || rec.Body.String() != "call.webm" {
+		t.Fatalf("stream: %d %q", rec.Code, rec.Body)
+	}
+}
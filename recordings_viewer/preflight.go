@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// preflightError is why a transcription was not queued, with the HTTP
+// status that reports it.
+type preflightError struct {
+	status int
+	msg    string
+}
+
+func (e *preflightError) Error() string { return e.msg }
+
+// preflightTranscription checks a transcription of the audio at rel by
+// engine before it is queued, so an engine that sends audio to a paid API
+// is not sent more than it accepts, captures with nothing in them, or more
+// than cfg.TranscribeBudget allows this month. It returns what the
+// transcription is expected to cost. Local engines, with neither a
+// CostPerMinute nor a MaxDuration, are not checked. With
+// cfg.PreflightWarnOnly the problems are returned as warnings instead.
+func preflightTranscription(rel, engine string, opts transcribeOptions) (cost float64, warnings []string, err error) {
+	e := cfg().Engines[engine]
+	if e.CostPerMinute <= 0 && e.MaxDuration <= 0 {
+		return 0, nil, nil
+	}
+	var problems []string
+	status := http.StatusUnprocessableEntity
+	d, err := recordingDuration(rel)
+	if err != nil {
+		problems = append(problems, "the audio's duration could not be read")
+	}
+	length := d
+	if opts.Range != nil {
+		length = opts.Range.length(d)
+	}
+	if e.MaxDuration > 0 && length > e.MaxDuration {
+		problems = append(problems, fmt.Sprintf("%s of audio is more than %s accepts (%s)", length.Round(time.Second), engine, e.MaxDuration))
+	}
+	if e.CostPerMinute > 0 && err == nil {
+		if db, err := recordingMaxVolume(rel, opts.Range); err == nil && db < cfg().SilenceThreshold {
+			problems = append(problems, fmt.Sprintf("the audio is silent (never louder than %.1f dB)", db))
+		} else if err != nil {
+			slog.Warn("measure loudness", "path", rel, "err", err)
+		}
+		runs := 1
+		if opts.SplitChannels {
+			if n, _ := probeChannels(absPath(rel)); n == 2 {
+				runs = 2
+			}
+		}
+		cost = length.Minutes() * float64(runs) * e.CostPerMinute
+		if b := transcribeBudget(time.Now()); cfg().TranscribeBudget > 0 && b.Spent+b.Pending+cost > cfg().TranscribeBudget {
+			if len(problems) == 0 {
+				status = http.StatusPaymentRequired
+			}
+			problems = append(problems, fmt.Sprintf("estimated cost %.2f is more than the %.2f left of this month's budget", cost, max(b.Remaining, 0)))
+		}
+	}
+	if len(problems) == 0 {
+		return cost, nil, nil
+	}
+	if cfg().PreflightWarnOnly {
+		return cost, problems, nil
+	}
+	return 0, nil, &preflightError{status: status, msg: strings.Join(problems, "; ")}
+}
+
+var maxVolumeLine = regexp.MustCompile(`max_volume: (-?[0-9.]+|-inf) dB`)
+
+// maxVolume runs ffmpeg's volumedetect over tr of the audio at fullPath, or
+// all of it, and returns its loudest sample in dBFS.
+func maxVolume(ctx context.Context, fullPath string, tr *timeRange) (float64, error) {
+	args := []string{"-hide_banner", "-nostats"}
+	if tr != nil {
+		args = append(args, "-ss", formatSeconds(tr.Start))
+		if tr.End != 0 {
+			args = append(args, "-to", formatSeconds(tr.End))
+		}
+	}
+	args = append(args, "-i", fullPath, "-vn", "-af", "volumedetect", "-f", "null", "-")
+	out, err := runCommandFunc(ctx, cfg().FFmpegPath, args...)
+	if err != nil {
+		return 0, fmt.Errorf("volumedetect %s: %v: %s", filepath.Base(fullPath), err, outputTail(out))
+	}
+	m := maxVolumeLine.FindStringSubmatch(string(out))
+	if m == nil {
+		return 0, fmt.Errorf("volumedetect %s: no max_volume in the output", filepath.Base(fullPath))
+	}
+	if m[1] == "-inf" {
+		// Digital silence.
+		return -1000, nil
+	}
+	return strconv.ParseFloat(m[1], 64)
+}
+
+// maxVolumes caches what recordingMaxVolume measured, by recordings path
+// and range, until the file changes: the backfill schedule would otherwise
+// decode a silent recording it keeps not queueing on every run.
+var maxVolumes = struct {
+	sync.Mutex
+	entries map[string]cachedVolume
+}{entries: map[string]cachedVolume{}}
+
+type cachedVolume struct {
+	modTime time.Time
+	size    int64
+	db      float64
+}
+
+// recordingMaxVolume measures the loudest sample of tr of the audio at rel,
+// or returns the one measured before.
+func recordingMaxVolume(rel string, tr *timeRange) (float64, error) {
+	info, err := os.Stat(absPath(rel))
+	if err != nil {
+		return 0, err
+	}
+	key := rel
+	if tr != nil {
+		key += fmt.Sprintf("#%g-%g", tr.Start, tr.End)
+	}
+	maxVolumes.Lock()
+	c, ok := maxVolumes.entries[key]
+	maxVolumes.Unlock()
+	if ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.db, nil
+	}
+	db, err := maxVolume(context.Background(), absPath(rel), tr)
+	if err != nil {
+		return 0, err
+	}
+	maxVolumes.Lock()
+	maxVolumes.entries[key] = cachedVolume{modTime: info.ModTime(), size: info.Size(), db: db}
+	maxVolumes.Unlock()
+	return db, nil
+}
+
+// budgetStatus is what paid transcriptions cost in one month: Spent by the
+// jobs that ran, Pending for those still queued or running, and what is
+// left of cfg.TranscribeBudget, if set.
+type budgetStatus struct {
+	Month     string  `json:"month"`
+	Budget    float64 `json:"budget,omitempty"`
+	Spent     float64 `json:"spent"`
+	Pending   float64 `json:"pending"`
+	Remaining float64 `json:"remaining,omitempty"`
+}
+
+// spendLedger is persisted in .viewer/spend.json: the estimated cost of the
+// paid transcriptions that ran, by month ("2024-05") in the display time
+// zone.
+type spendLedger struct {
+	Months map[string]float64 `json:"months"`
+}
+
+// spendMu serialises updates of the ledger.
+var spendMu sync.Mutex
+
+func spendLedgerPath() string {
+	return filepath.Join(stateDir(), "spend.json")
+}
+
+func loadSpendLedger() (spendLedger, error) {
+	ledger := spendLedger{Months: map[string]float64{}}
+	data, err := os.ReadFile(spendLedgerPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return ledger, err
+	}
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return ledger, err
+	}
+	if ledger.Months == nil {
+		ledger.Months = map[string]float64{}
+	}
+	return ledger, nil
+}
+
+func spendMonth(t time.Time) string {
+	return t.In(cfg().DisplayTimezone).Format("2006-01")
+}
+
+// recordSpend adds the estimated cost of a transcription that ran at t to
+// the ledger.
+func recordSpend(cost float64, t time.Time) error {
+	spendMu.Lock()
+	defer spendMu.Unlock()
+	ledger, err := loadSpendLedger()
+	if err != nil {
+		return err
+	}
+	ledger.Months[spendMonth(t)] += cost
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(spendLedgerPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// transcribeBudget totals the month containing now.
+func transcribeBudget(now time.Time) budgetStatus {
+	b := budgetStatus{Month: spendMonth(now), Budget: cfg().TranscribeBudget}
+	spendMu.Lock()
+	ledger, err := loadSpendLedger()
+	spendMu.Unlock()
+	if err != nil {
+		slog.Error("read spend ledger", "err", err)
+	}
+	b.Spent = ledger.Months[b.Month]
+	for _, j := range jobs.list() {
+		if j.Status == jobQueued || j.Status == jobRunning {
+			b.Pending += j.Cost
+		}
+	}
+	if b.Budget > 0 {
+		b.Remaining = b.Budget - b.Spent - b.Pending
+	}
+	return b
+}
+
+// jobsBudgetHandler serves GET /api/jobs/budget: this month's estimated
+// spending on paid transcriptions against cfg.TranscribeBudget.
+func jobsBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, transcribeBudget(time.Now()))
+}
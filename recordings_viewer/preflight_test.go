@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreflightTranscription(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{CostPerMinute: 0.006, MaxDuration: 2 * time.Hour})
+	useConfig(t, func(c *config) {
+		c.FFmpegPath = "ffmpeg"
+		c.TranscribeBudget = 0.1
+		c.SilenceThreshold = -50
+	})
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		file := filepath.Base(args[len(args)-1])
+		if name == "ffprobe" {
+			if file == "lecture.webm" {
+				return []byte("9000\n"), nil
+			}
+			return []byte("600\n"), nil
+		}
+		if argAfter(args, "-i") == filepath.Join(dir, "empty.webm") {
+			return []byte("[Parsed_volumedetect_0] mean_volume: -inf dB\n[Parsed_volumedetect_0] max_volume: -inf dB\n"), nil
+		}
+		return []byte("[Parsed_volumedetect_0] max_volume: -3.2 dB\n"), nil
+	})
+	writeTestFiles(t, dir, "call.webm", "call2.webm", "lecture.webm", "empty.webm")
+	transcribe := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path": "`+path+`"}`)))
+		return rec
+	}
+
+	rec := transcribe("call.webm")
+	var j job
+	if err := json.Unmarshal(rec.Body.Bytes(), &j); err != nil || rec.Code != http.StatusAccepted || math.Abs(j.Cost-0.06) > 1e-9 {
+		t.Fatalf("call: %d %s", rec.Code, rec.Body)
+	}
+	for path, want := range map[string]string{"lecture.webm": "2h30m0s of audio is more than whisper accepts", "empty.webm": "silent"} {
+		if rec := transcribe(path); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: %d %s", path, rec.Code, rec.Body)
+		}
+	}
+	// 0.06 is pending, so another 0.06 is over the budget.
+	if rec := transcribe("call2.webm"); rec.Code != http.StatusPaymentRequired || !strings.Contains(rec.Body.String(), "0.04 left") {
+		t.Fatalf("over budget: %d %s", rec.Code, rec.Body)
+	}
+	if got := len(jobs.list()); got != 1 {
+		t.Fatalf("%d jobs queued", got)
+	}
+
+	useConfig(t, func(c *config) { c.PreflightWarnOnly = true })
+	rec = transcribe("empty.webm")
+	j = job{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &j); err != nil || rec.Code != http.StatusAccepted || len(j.Warnings) != 2 {
+		t.Fatalf("warn only: %d %s", rec.Code, rec.Body)
+	}
+
+	if err := recordSpend(0.25, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/budget", nil))
+	var b budgetStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Spent != 0.25 || math.Abs(b.Pending-0.12) > 1e-9 || math.Abs(b.Remaining+0.27) > 1e-9 || b.Month != time.Now().In(cfg().DisplayTimezone).Format("2006-01") {
+		t.Fatalf("budget = %+v", b)
+	}
+}
+
+func TestPreflightSkipsLocalEngines(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useTestEngine(t, engineConfig{})
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		t.Fatalf("ran %s %v", name, args)
+		return nil, nil
+	})
+	writeTestFiles(t, dir, "local.webm")
+	if cost, warnings, err := preflightTranscription("local.webm", "whisper", transcribeOptions{}); cost != 0 || warnings != nil || err != nil {
+		t.Fatalf("preflight = %v, %v, %v", cost, warnings, err)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// publishTarget is a remote host sessions are pushed to over SSH, from a
+// VIEWER_PUBLISH_TARGETS entry such as
+// "home=sftp://me@nas.local:2222/srv/recordings?identity=/home/me/.ssh/id_ed25519".
+// The sftp:// scheme uploads with sftp, rsync+ssh:// with rsync over ssh.
+// Both use the system's OpenSSH, so keys, agents and ~/.ssh/config apply.
+type publishTarget struct {
+	Name     string `json:"name"`
+	Tool     string `json:"tool"` // "sftp" or "rsync"
+	User     string `json:"user,omitempty"`
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Dir      string `json:"dir"`
+	Identity string `json:"identity,omitempty"`
+}
+
+// parsePublishTarget parses one target URL.
+func parsePublishTarget(name, raw string) (publishTarget, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return publishTarget{}, err
+	}
+	t := publishTarget{Name: name, Host: u.Hostname(), Dir: path.Clean("/" + u.Path), Identity: u.Query().Get("identity")}
+	switch u.Scheme {
+	case "sftp":
+		t.Tool = "sftp"
+	case "rsync+ssh":
+		t.Tool = "rsync"
+	default:
+		return publishTarget{}, fmt.Errorf("unsupported scheme %q (want sftp or rsync+ssh)", u.Scheme)
+	}
+	if t.Host == "" {
+		return publishTarget{}, fmt.Errorf("missing host")
+	}
+	if u.User != nil {
+		t.User = u.User.Username()
+	}
+	if p := u.Port(); p != "" {
+		if t.Port, err = strconv.Atoi(p); err != nil {
+			return publishTarget{}, fmt.Errorf("invalid port %q", p)
+		}
+	}
+	if u.Path == "" {
+		t.Dir = "."
+	}
+	return t, nil
+}
+
+// envPublishTargets parses "name=url,name=url", skipping malformed entries.
+func envPublishTargets(name string) map[string]publishTarget {
+	out := map[string]publishTarget{}
+	for _, entry := range envList(name) {
+		targetName, raw, ok := strings.Cut(entry, "=")
+		targetName = strings.TrimSpace(targetName)
+		if !ok || !validWorkspaceName(targetName) {
+			slog.Warn("ignoring invalid publish target", "name", name, "value", entry)
+			continue
+		}
+		t, err := parsePublishTarget(targetName, strings.TrimSpace(raw))
+		if err != nil {
+			slog.Warn("ignoring invalid publish target", "name", name, "target", targetName, "err", err)
+			continue
+		}
+		out[targetName] = t
+	}
+	return out
+}
+
+// login is the [user@]host argument for ssh, sftp and rsync.
+func (t publishTarget) login() string {
+	if t.User == "" {
+		return t.Host
+	}
+	return t.User + "@" + t.Host
+}
+
+// sshOptions are the ssh flags shared by both tools. portFlag is -P for
+// sftp and -p for ssh.
+func (t publishTarget) sshOptions(portFlag string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	if t.Port != 0 {
+		args = append(args, portFlag, strconv.Itoa(t.Port))
+	}
+	if t.Identity != "" {
+		args = append(args, "-i", t.Identity)
+	}
+	return args
+}
+
+// sftpQuote quotes an argument for an sftp batch file.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// push copies files into remoteDir on the target, creating it as needed.
+func (t publishTarget) push(ctx context.Context, files []string, remoteDir string) error {
+	var output []byte
+	var err error
+	switch t.Tool {
+	case "sftp":
+		// sftp's mkdir is not recursive; "-" ignores "already exists".
+		var dirs []string
+		for d := remoteDir; d != "/" && d != "."; d = path.Dir(d) {
+			dirs = append([]string{d}, dirs...)
+		}
+		var batch strings.Builder
+		for _, d := range dirs {
+			fmt.Fprintf(&batch, "-mkdir %s\n", sftpQuote(d))
+		}
+		for _, f := range files {
+			fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(f), sftpQuote(path.Join(remoteDir, filepath.Base(f))))
+		}
+		if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+			return err
+		}
+		batchFile := filepath.Join(tempDir(), "publish-"+randomID()+".sftp")
+		if err := os.WriteFile(batchFile, []byte(batch.String()), 0o600); err != nil {
+			return err
+		}
+		defer os.Remove(batchFile)
+		args := append([]string{"-b", batchFile}, t.sshOptions("-P")...)
+		output, err = runCommandFunc(ctx, cfg().SFTPPath, append(args, t.login())...)
+	case "rsync":
+		ssh := strings.Join(append([]string{"ssh"}, t.sshOptions("-p")...), " ")
+		args := append([]string{"-a", "--protect-args", "--mkpath", "-e", ssh}, files...)
+		output, err = runCommandFunc(ctx, cfg().RsyncPath, append(args, t.login()+":"+remoteDir+"/")...)
+	default:
+		return fmt.Errorf("unknown publish tool %q", t.Tool)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", t.Tool, err, outputTail(output))
+	}
+	return nil
+}
+
+// sessionSummary is the <stem>.summary.json published with a session so the
+// remote copy is self-describing without the viewer.
+type sessionSummary struct {
+	ID             string    `json:"id"`
+	RecordedAt     time.Time `json:"recordedAt"`
+	RecordedOffset string    `json:"recordedOffset"`
+	Tags           []string  `json:"tags,omitempty"`
+	Partial        bool      `json:"partial,omitempty"`
+	Files          []string  `json:"files"`
+	Excerpt        string    `json:"excerpt,omitempty"`
+	PublishedAt    time.Time `json:"publishedAt"`
+}
+
+// summaryExcerptLen bounds the transcript excerpt in a session summary.
+const summaryExcerptLen = 500
+
+// writeSessionSummary writes s's summary into dir and returns its path.
+func writeSessionSummary(s session, dir string, now time.Time) (string, error) {
+	sum := sessionSummary{
+		ID: s.ID, RecordedAt: s.RecordedAt, RecordedOffset: s.RecordedOffset,
+		Tags: s.Tags, Partial: s.Partial, PublishedAt: now.UTC(),
+	}
+	for _, f := range s.Files {
+		sum.Files = append(sum.Files, path.Base(f))
+	}
+	sum.Excerpt = transcriptExcerpt(s, summaryExcerptLen)
+	data, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	out := filepath.Join(dir, path.Base(s.ID)+".summary.json")
+	return out, os.WriteFile(out, append(data, '\n'), 0o644)
+}
+
+// transcriptExcerpt returns the first max characters of s's text
+// transcript, or "" when it has none.
+func transcriptExcerpt(s session, max int) string {
+	if s.Transcript == "" {
+		return ""
+	}
+	data, err := os.ReadFile(absPath(s.Transcript))
+	if err != nil {
+		return ""
+	}
+	text := []rune(strings.TrimSpace(string(data)))
+	if len(text) > max {
+		text = append(text[:max], '…')
+	}
+	return string(text)
+}
+
+type publishResult struct {
+	Session   string   `json:"session"`
+	RemoteDir string   `json:"remoteDir,omitempty"`
+	Files     []string `json:"files,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// publishSession pushes s's files and summary to t, into the same folder
+// below t.Dir that the session has in its workspace.
+func publishSession(ctx context.Context, t publishTarget, s session, now time.Time) publishResult {
+	res := publishResult{Session: s.ID}
+	_, inner, err := splitWorkspace(s.Folder)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.RemoteDir = path.Join(t.Dir, inner)
+	if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	staging, err := os.MkdirTemp(tempDir(), "publish-")
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer os.RemoveAll(staging)
+	summary, err := writeSessionSummary(s, staging, now)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	var files []string
+	for _, f := range s.Files {
+		files = append(files, absPath(f))
+	}
+	files = append(files, summary)
+	if err := t.push(ctx, files, res.RemoteDir); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	for _, f := range files {
+		res.Files = append(res.Files, filepath.Base(f))
+	}
+	return res
+}
+
+// publishHandler serves GET /api/publish with the configured targets and
+// POST /api/publish with {"target": "home", "sessions": [...], "tags": [...]}
+// to push the listed sessions, or every session carrying all the tags.
+func publishHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		targets := make([]publishTarget, 0, len(cfg().PublishTargets))
+		for _, t := range cfg().PublishTargets {
+			targets = append(targets, t)
+		}
+		sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+		writeJSON(w, targets)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Target   string   `json:"target"`
+		Sessions []string `json:"sessions"`
+		Tags     []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	t, ok := cfg().PublishTargets[req.Target]
+	if !ok {
+		http.Error(w, "unknown publish target", http.StatusBadRequest)
+		return
+	}
+	if len(req.Sessions) == 0 && len(req.Tags) == 0 {
+		http.Error(w, "sessions or tags required", http.StatusBadRequest)
+		return
+	}
+
+	var selected []session
+	for _, id := range req.Sessions {
+		s, err := findSession(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("session %s not found", id), http.StatusNotFound)
+			return
+		}
+		selected = append(selected, *s)
+	}
+	if len(req.Tags) > 0 {
+		all, err := scanSessions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, s := range all {
+			if hasAllTags(s.Tags, req.Tags) {
+				selected = append(selected, s)
+			}
+		}
+	}
+
+	logger := requestLogger(r)
+	now := time.Now()
+	results := []publishResult{}
+	seen := map[string]bool{}
+	for _, s := range selected {
+		if seen[s.ID] {
+			continue
+		}
+		seen[s.ID] = true
+		res := publishSession(r.Context(), t, s, now)
+		if res.Error != "" {
+			logger.Warn("publish failed", "session", s.ID, "target", t.Name, "err", res.Error)
+		} else {
+			logger.Info("published session", "session", s.ID, "target", t.Name, "remote", res.RemoteDir)
+			publishEvent("session.published", s.ID, map[string]any{"target": t.Name, "remoteDir": res.RemoteDir})
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, results)
+}
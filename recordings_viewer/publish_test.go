@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePublishTarget(t *testing.T) {
+	got, err := parsePublishTarget("home", "sftp://me@nas.local:2222/srv/recordings/?identity=/k/id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := publishTarget{Name: "home", Tool: "sftp", User: "me", Host: "nas.local", Port: 2222, Dir: "/srv/recordings", Identity: "/k/id"}
+	if got != want {
+		t.Fatalf("got %+v", got)
+	}
+	if got, _ := parsePublishTarget("box", "rsync+ssh://box/backup"); got.Tool != "rsync" || got.login() != "box" {
+		t.Fatalf("rsync target = %+v", got)
+	}
+	for _, bad := range []string{"s3://bucket/x", "sftp:///no-host", "sftp://h:port/x"} {
+		if _, err := parsePublishTarget("x", bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestPublishSessionsOverSFTP(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "2024/call.webm", "2024/call.txt", "2024/other.webm")
+	target, _ := parsePublishTarget("home", "sftp://me@nas:2222/srv/rec?identity=/k/id")
+	useConfig(t, func(c *config) {
+		c.SFTPPath = "sftp"
+		c.PublishTargets = map[string]publishTarget{"home": target}
+	})
+	var batch string
+	var gotArgs []string
+	var summary sessionSummary
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		gotArgs = append([]string{name}, args...)
+		data, err := os.ReadFile(args[1])
+		batch = string(data)
+		for _, line := range strings.Split(batch, "\n") {
+			if strings.HasPrefix(line, "put ") && strings.Contains(line, ".summary.json") {
+				local := strings.Trim(strings.Fields(line)[1], `"`)
+				raw, _ := os.ReadFile(local)
+				json.Unmarshal(raw, &summary)
+			}
+		}
+		return nil, err
+	})
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/publish", strings.NewReader(`{"target": "home", "sessions": ["2024/call"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var results []publishResult
+	json.NewDecoder(rec.Body).Decode(&results)
+	if len(results) != 1 || results[0].Error != "" || results[0].RemoteDir != "/srv/rec/2024" {
+		t.Fatalf("results = %+v", results)
+	}
+	if !reflect.DeepEqual(results[0].Files, []string{"call.txt", "call.webm", "call.summary.json"}) {
+		t.Fatalf("files = %v", results[0].Files)
+	}
+	wantArgs := []string{"sftp", "-b", gotArgs[2], "-o", "BatchMode=yes", "-P", "2222", "-i", "/k/id", "me@nas"}
+	if !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Fatalf("args = %v", gotArgs)
+	}
+	for _, want := range []string{`-mkdir "/srv"`, `-mkdir "/srv/rec/2024"`, `"/srv/rec/2024/call.webm"`} {
+		if !strings.Contains(batch, want) {
+			t.Errorf("batch lacks %s:\n%s", want, batch)
+		}
+	}
+	if summary.ID != "2024/call" || summary.Excerpt != "2024/call.txt" {
+		t.Fatalf("summary = %+v", summary)
+	}
+}
+
+func TestPublishRejectsUnknownTarget(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.PublishTargets = map[string]publishTarget{} })
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/publish", strings.NewReader(`{"target": "nope", "sessions": ["a"]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d", rec.Code)
+	}
+}
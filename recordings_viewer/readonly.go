@@ -0,0 +1,38 @@
+package main
+
+import "net/http"
+
+// readOnlySafePaths are POST endpoints that only read the library.
+var readOnlySafePaths = map[string]bool{
+	"/api/export":            true,
+	"/api/export/zip":        true,
+	"/api/export/vault":      true,
+	"/api/backup":            true,
+	"/api/publish":           true,
+	"/api/share":             true,
+	"/api/webhooks/test":     true,
+	"/api/validate/manifest": true,
+}
+
+// mutatingTasks are scheduled tasks that change the library and are
+// skipped in read-only mode.
+var mutatingTasks = map[string]bool{
+	"retention": true,
+	"cold":      true,
+	"backfill":  true,
+	"calendar":  true,
+	"sync":      true,
+}
+
+// withReadOnly refuses every request that could change the library when the
+// server runs with -readonly: writes, uploads, transcription requests and
+// open-folder. Reads and exports still work.
+func withReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg().ReadOnly && isWriteMethod(r.Method) && !readOnlySafePaths[unversionedPath(r.URL.Path)] {
+			http.Error(w, "server is read-only", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"recordings_viewer/testsupport"
+)
+
+func TestReadOnlyRefusesWrites(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.ReadOnly = true })
+	writeTestFiles(t, dir, "a.txt")
+	os.Mkdir(filepath.Join(dir, "s"), 0o755)
+	fake := &testsupport.FakeLauncher{}
+	h := withReadOnly(newMuxWithLauncher(fake))
+
+	for _, tc := range []struct{ method, url, body string }{
+		{http.MethodPut, "/api/transcripts/a.txt", "changed"},
+		{http.MethodPost, "/api/open-folder", `{"path":"s"}`},
+		{http.MethodPost, "/api/transcripts/a.txt/rename", `{"name":"b"}`},
+		{http.MethodDelete, "/api/export-profiles/x", ""},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body)))
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: status=%d want 403", tc.method, tc.url, rec.Code)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "a.txt" {
+		t.Fatalf("file changed to %q", data)
+	}
+	if len(fake.Opened()) != 0 {
+		t.Fatalf("folder opened in read-only mode")
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/a.txt", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("read status=%d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/verify", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("verify update status=%d want 403", rec.Code)
+	}
+}
+
+func TestReadOnlySkipsMutatingSchedules(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.ReadOnly = true; c.JanitorInterval = 0 })
+	ran := map[string]bool{}
+	orig := scheduledTasks
+	scheduledTasks = map[string]func(time.Time){}
+	for name := range orig {
+		scheduledTasks[name] = func(time.Time) { ran[name] = true }
+	}
+	t.Cleanup(func() { scheduledTasks = orig })
+	saveSchedules(map[string]schedule{
+		"retention": {Name: "retention", Expr: "@every 1h", Enabled: true},
+		"digest":    {Name: "digest", Expr: "@every 1h", Enabled: true},
+	})
+
+	runDueSchedules(time.Now())
+	if ran["retention"] || !ran["digest"] {
+		t.Fatalf("ran=%v; want only digest", ran)
+	}
+}
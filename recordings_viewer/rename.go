@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// recordingStem returns the name shared by a recording's paired files, e.g.
+// "foo" for "foo.webm", "foo.txt", "foo.meta.json", the auto-split segment
+// "foo.part001.webm", the track "foo.track-mic.webm" and artifacts such as
+// "foo.summary.md".
+func recordingStem(name string) string {
+	if isMetaFile(name) {
+		return name[:len(name)-len(metaSuffix)]
+	}
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	stem = partSuffix.ReplaceAllString(artifactInfix.ReplaceAllString(stem, ""), "")
+	return trackSuffix.ReplaceAllString(stem, "")
+}
+
+// pairedFiles lists the file names in fullPath's directory that share its
+// stem, including fullPath itself.
+func pairedFiles(fullPath string) ([]string, error) {
+	dir := filepath.Dir(fullPath)
+	stem := recordingStem(filepath.Base(fullPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		if recordingStem(e.Name()) == stem {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// renameHandler serves POST /api/transcripts/{path}/rename with a body of
+// {"name": "new-stem"}. Every file sharing the recording's stem is renamed.
+func renameHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if !decodeActionBody(w, r, &payload) {
+		return
+	}
+	name := strings.TrimSpace(payload.Name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		http.Error(w, "invalid name", http.StatusBadRequest)
+		return
+	}
+	// The name becomes the stem of every paired file, so it must be one:
+	// "notes.v2" or "call.part1" would be cut short by recordingStem.
+	if recordingStem(name) != name {
+		http.Error(w, fmt.Sprintf("invalid name: %q is not a recording name without an extension", name), http.StatusBadRequest)
+		return
+	}
+	fullPath := absPath(rel)
+	relocateRecording(w, r, rel, filepath.Dir(fullPath), name)
+}
+
+// moveHandler serves POST /api/transcripts/{path}/move with a body of
+// {"to": "folder"}, relocating the recording and its paired files into another
+// folder, possibly in another workspace ("@archive/2023"). An empty "to"
+// moves to the root of the recording's workspace.
+func moveHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	var payload struct {
+		To string `json:"to"`
+	}
+	if !decodeActionBody(w, r, &payload) {
+		return
+	}
+	ws, _, err := splitWorkspace(filepath.ToSlash(rel))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	destDir := ws.Dir
+	if to := strings.Trim(strings.TrimSpace(payload.To), `/\`); to != "" && to != "." {
+		_, full, err := resolveRecordingPath(to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		destDir = full
+	}
+	fullPath := absPath(rel)
+	relocateRecording(w, r, rel, destDir, recordingStem(filepath.Base(fullPath)))
+}
+
+func decodeActionBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// relocateRecording moves the recording rel and its paired files into
+// destDir under newStem, recording the move in the audit log. A move
+// leaves the files' contents, and so their SHA-256, as they were.
+func relocateRecording(w http.ResponseWriter, r *http.Request, rel, destDir, newStem string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	fullPath := absPath(rel)
+	if _, err := os.Stat(fullPath); err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	moved, err := renamePaired(fullPath, destDir, newStem)
+	switch {
+	case errors.Is(err, errDestinationExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, errAlreadyAtDestination):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	base := filepath.Base(fullPath)
+	newRel, _ := relPath(filepath.Join(destDir, newStem+strings.TrimPrefix(base, recordingStem(base))))
+	sum, _ := currentSHA256(absPath(newRel))
+	auditChange(r, "file.renamed", rel, map[string]any{"to": newRel, "files": moved, "before": sum, "after": sum})
+	slog.Info("relocated recording", "from", rel, "to", newRel, "files", len(moved))
+	publishEvent("recording.renamed", newRel, map[string]any{"from": filepath.ToSlash(rel), "files": moved})
+	writeJSON(w, map[string]any{"id": newRel, "files": moved})
+}
+
+var (
+	errDestinationExists    = errors.New("destination exists")
+	errAlreadyAtDestination = errors.New("recording already at destination")
+)
+
+// renamePaired moves every file paired with fullPath into destDir under
+// newStem. Destinations are checked up front and completed renames are rolled
+// back if a later one fails, so the pairing is never left half-moved.
+// Callers must hold mu.
+func renamePaired(fullPath, destDir, newStem string) ([]string, error) {
+	names, err := pairedFiles(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	srcDir := filepath.Dir(fullPath)
+	oldStem := recordingStem(filepath.Base(fullPath))
+	if srcDir == destDir && oldStem == newStem {
+		return nil, errAlreadyAtDestination
+	}
+
+	type pair struct{ from, to string }
+	plan := make([]pair, 0, len(names))
+	for _, name := range names {
+		to := filepath.Join(destDir, newStem+strings.TrimPrefix(name, oldStem))
+		if _, err := os.Stat(to); err == nil {
+			return nil, fmt.Errorf("%w: %s", errDestinationExists, filepath.Base(to))
+		}
+		plan = append(plan, pair{filepath.Join(srcDir, name), to})
+	}
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	moved := make([]string, 0, len(plan))
+	for i, p := range plan {
+		if err := moveFile(p.from, p.to); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if rerr := moveFile(plan[j].to, plan[j].from); rerr != nil {
+					slog.Error("rollback rename", "path", plan[j].to, "err", rerr)
+				}
+			}
+			return nil, err
+		}
+		rel, _ := relPath(p.to)
+		moved = append(moved, rel)
+	}
+	for _, p := range plan {
+		moveChecksum(p.from, p.to)
+	}
+	return moved, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRenameMovesPairedFiles(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "foo.webm", "foo.txt", "foo.meta.json", "foobar.txt")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/transcripts/foo.txt/rename", strings.NewReader(`{"name":"standup"}`))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d want %d body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var res struct {
+		ID    string   `json:"id"`
+		Files []string `json:"files"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if res.ID != "standup.txt" {
+		t.Fatalf("id=%q want standup.txt", res.ID)
+	}
+	sort.Strings(res.Files)
+	if got := strings.Join(res.Files, ","); got != "standup.meta.json,standup.txt,standup.webm" {
+		t.Fatalf("files=%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "foobar.txt")); err != nil {
+		t.Fatalf("unrelated file should stay: %v", err)
+	}
+}
+
+func TestMoveRejectsConflictWithoutPartialMove(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "foo.webm", "foo.txt", "archive/foo.txt")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/transcripts/foo.webm/move", strings.NewReader(`{"to":"recordings/archive"}`))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusConflict)
+	}
+	for _, name := range []string{"foo.webm", "foo.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s should not have moved: %v", name, err)
+		}
+	}
+}
+
+func TestMoveIntoFolder(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "foo.webm", "foo.txt")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/transcripts/foo.webm/move", strings.NewReader(`{"to":"2024/acme"}`))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d want %d body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	for _, name := range []string{"foo.webm", "foo.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, "2024", "acme", name)); err != nil {
+			t.Fatalf("%s not moved: %v", name, err)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/transcripts/2024/acme/foo.webm/move", strings.NewReader(`{"to":"../outside"}`))
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("traversal status=%d want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRenameRejectsNamesThatAreNotStems(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "foo.webm", "foo.txt", "taken.txt")
+
+	rename := func(name string) int {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/transcripts/foo.webm/rename", strings.NewReader(`{"name":"`+name+`"}`)))
+		return rec.Code
+	}
+	for _, name := range []string{"notes.v2", "call.part1", "standup.webm", "talk.track-mic"} {
+		if code := rename(name); code != http.StatusBadRequest {
+			t.Fatalf("rename to %q: status=%d want 400", name, code)
+		}
+	}
+	if code := rename("foo"); code != http.StatusBadRequest {
+		t.Fatalf("rename to itself: status=%d want 400", code)
+	}
+	if code := rename("taken"); code != http.StatusConflict {
+		t.Fatalf("rename onto existing: status=%d want 409", code)
+	}
+	for _, name := range []string{"foo.webm", "foo.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s should not have moved: %v", name, err)
+		}
+	}
+}
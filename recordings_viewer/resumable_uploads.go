@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// uploadResumeTTL is how long a resumable upload may sit idle before it
+// expires; every chunk that arrives extends it.
+const uploadResumeTTL = 24 * time.Hour
+
+// partPath is where a resumable upload collects its bytes: next to the
+// recording, so completing it is a rename, and ending in .tmp, so session
+// scans skip it.
+func (up stagedUpload) partPath() string {
+	return absPath(up.Path) + "." + up.ID + ".tmp"
+}
+
+// uploadOffset is how many bytes of a resumable upload have arrived.
+func (up stagedUpload) uploadOffset() (int64, error) {
+	info, err := os.Stat(up.partPath())
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// checkUploadSize refuses a declared upload size beyond the body limit or
+// the free disk space, as withWriteLimits does for a single request.
+func checkUploadSize(size int64) (int, error) {
+	switch {
+	case size < 0:
+		return http.StatusBadRequest, errors.New("size must not be negative")
+	case cfg().MaxBodyBytes > 0 && size > cfg().MaxBodyBytes:
+		return http.StatusRequestEntityTooLarge, errors.New("upload too large")
+	}
+	if free, _, err := diskSpace(baseDir); err == nil && size > 0 && uint64(size) > free {
+		return http.StatusInsufficientStorage, errors.New("not enough disk space")
+	}
+	return http.StatusOK, nil
+}
+
+// chunkWriters holds the resumable uploads a PATCH is writing to, so two
+// connections cannot append to the same upload at once.
+var chunkWriters = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: map[string]bool{}}
+
+func claimChunkWriter(id string) bool {
+	chunkWriters.Lock()
+	defer chunkWriters.Unlock()
+	if chunkWriters.ids[id] {
+		return false
+	}
+	chunkWriters.ids[id] = true
+	return true
+}
+
+func releaseChunkWriter(id string) {
+	chunkWriters.Lock()
+	delete(chunkWriters.ids, id)
+	chunkWriters.Unlock()
+}
+
+// resumableUploadHandler serves a resumable upload at /api/uploads/{id},
+// following the core of the tus protocol: HEAD answers how much has
+// arrived in Upload-Offset (GET the same as JSON), PATCH with
+// Upload-Offset appends the body at that offset, and DELETE abandons the
+// upload. POST /api/uploads/{id}/finalize completes it.
+func resumableUploadHandler(w http.ResponseWriter, r *http.Request, id string) {
+	mu.Lock()
+	items, err := loadStagedUploads()
+	mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	up, ok := items[id]
+	if !ok || !up.Resumable {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	offset, err := up.uploadOffset()
+	if err != nil {
+		http.Error(w, "upload data is gone; start a new upload", http.StatusGone)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if up.Size > 0 {
+		w.Header().Set("Upload-Length", strconv.FormatInt(up.Size, 10))
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		writeJSON(w, map[string]any{"id": up.ID, "path": up.Path, "offset": offset, "size": up.Size, "expiresAt": up.ExpiresAt})
+	case http.MethodPatch:
+		writeUploadChunk(w, r, up, offset)
+	case http.MethodDelete:
+		mu.Lock()
+		defer mu.Unlock()
+		items, err := loadStagedUploads()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		delete(items, id)
+		if err := saveStagedUploads(items); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		os.Remove(up.partPath())
+		requestLogger(r).Info("abandoned upload", "upload", id, "path", up.Path, "bytes", offset)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeUploadChunk appends the body of a PATCH to up. Whatever arrives is
+// kept even when the connection drops halfway, so the client resumes from
+// the offset HEAD reports rather than resending the whole chunk.
+func writeUploadChunk(w http.ResponseWriter, r *http.Request, up stagedUpload, offset int64) {
+	want, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Offset header is required", http.StatusBadRequest)
+		return
+	}
+	if !claimChunkWriter(up.ID) {
+		http.Error(w, "another chunk of this upload is being written", http.StatusConflict)
+		return
+	}
+	defer releaseChunkWriter(up.ID)
+	// Another chunk may have landed since the caller looked.
+	if offset, err = up.uploadOffset(); err != nil {
+		http.Error(w, "upload data is gone; start a new upload", http.StatusGone)
+		return
+	}
+	if want != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		http.Error(w, fmt.Sprintf("upload is at offset %d, not %d", offset, want), http.StatusConflict)
+		return
+	}
+
+	limit := int64(-1)
+	if up.Size > 0 {
+		limit = up.Size - offset
+	}
+	if cfg().MaxBodyBytes > 0 && (limit < 0 || cfg().MaxBodyBytes-offset < limit) {
+		limit = cfg().MaxBodyBytes - offset
+	}
+	f, err := os.OpenFile(up.partPath(), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var src io.Reader = r.Body
+	if limit >= 0 {
+		src = io.LimitReader(r.Body, limit+1)
+	}
+	n, copyErr := io.Copy(f, src)
+	if limit >= 0 && n > limit {
+		// Keep what fits; the rest was never part of the upload.
+		f.Truncate(offset + limit)
+		n = limit
+		copyErr = errUploadTooLong
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	offset += n
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	mu.Lock()
+	if items, err := loadStagedUploads(); err == nil {
+		if cur, ok := items[up.ID]; ok {
+			cur.ExpiresAt = time.Now().UTC().Add(uploadResumeTTL)
+			items[up.ID] = cur
+			if err := saveStagedUploads(items); err != nil {
+				slog.Error("extend upload", "upload", up.ID, "err", err)
+			}
+		}
+	}
+	mu.Unlock()
+
+	if errors.Is(copyErr, errUploadTooLong) {
+		http.Error(w, "chunk runs past the upload's size or the body limit", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if copyErr != nil {
+		requestLogger(r).Warn("upload chunk interrupted", "upload", up.ID, "offset", offset, "err", copyErr)
+		http.Error(w, copyErr.Error(), bodyErrorStatus(copyErr, http.StatusBadRequest))
+		return
+	}
+	requestLogger(r).Debug("upload chunk", "upload", up.ID, "bytes", n, "offset", offset)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errUploadTooLong = errors.New("upload too long")
+
+// completeResumableUpload moves the bytes of up into place once they have
+// all arrived. Callers hold mu.
+func completeResumableUpload(up stagedUpload) (int, error) {
+	if !claimChunkWriter(up.ID) {
+		return http.StatusConflict, errors.New("a chunk of this upload is still being written")
+	}
+	defer releaseChunkWriter(up.ID)
+	offset, err := up.uploadOffset()
+	if err != nil {
+		return http.StatusGone, errors.New("upload data is gone; start a new upload")
+	}
+	if up.Size > 0 && offset != up.Size {
+		return http.StatusConflict, fmt.Errorf("upload incomplete: %d of %d bytes received", offset, up.Size)
+	}
+	fullPath := absPath(up.Path)
+	if err := os.Rename(up.partPath(), fullPath); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	trackFiles(fullPath)
+	return http.StatusOK, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingReader yields data and then fails, like a dropped connection.
+type failingReader struct{ data io.Reader }
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func createResumableUpload(t *testing.T, body string, header http.Header) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	var res struct {
+		ID     string `json:"id"`
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if rec.Code != http.StatusOK || res.Method != http.MethodPatch || res.URL != "/api/uploads/"+res.ID {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	return res.ID
+}
+
+func patchChunk(id string, offset string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/api/uploads/"+id, body)
+	req.Header.Set("Upload-Offset", offset)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	return rec
+}
+
+func uploadOffsetOf(t *testing.T, id string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/uploads/"+id, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HEAD: %d", rec.Code)
+	}
+	return rec.Header().Get("Upload-Offset")
+}
+
+func TestResumableUploadSurvivesInterruptedChunk(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.S3 = s3Config{} })
+	id := createResumableUpload(t, `{"path": "uuid/clip/audio.webm", "resumable": true, "size": 10}`,
+		http.Header{"X-Recorded-At": {"2024-05-01T10:00:00+02:00"}, "X-Source-Title": {"Design%20review"}})
+	if got := uploadOffsetOf(t, id); got != "0" {
+		t.Fatalf("initial offset=%s", got)
+	}
+
+	if rec := patchChunk(id, "0", strings.NewReader("hello")); rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("first chunk: %d %v", rec.Code, rec.Header())
+	}
+	// The connection drops two bytes into the next chunk.
+	if rec := patchChunk(id, "5", failingReader{strings.NewReader("wo")}); rec.Code == http.StatusNoContent {
+		t.Fatalf("interrupted chunk reported success")
+	}
+	if got := uploadOffsetOf(t, id); got != "7" {
+		t.Fatalf("offset after interruption=%s", got)
+	}
+	if rec := patchChunk(id, "5", strings.NewReader("world")); rec.Code != http.StatusConflict || rec.Header().Get("Upload-Offset") != "7" {
+		t.Fatalf("stale offset: %d %v", rec.Code, rec.Header())
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/uploads/"+id+"/finalize", nil))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "7 of 10") {
+		t.Fatalf("early finalize: %d %s", rec.Code, rec.Body)
+	}
+
+	// Bytes past the declared size are dropped.
+	if rec := patchChunk(id, "7", strings.NewReader("rld!")); rec.Code != http.StatusRequestEntityTooLarge || rec.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("overlong chunk: %d %v", rec.Code, rec.Header())
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/uploads/"+id+"/finalize", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("finalize: %d %s", rec.Code, rec.Body)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "uuid/clip/audio.webm"))
+	if err != nil || string(data) != "helloworld" {
+		t.Fatalf("recording=%q err=%v", data, err)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "uuid/clip/audio.webm"))
+	if meta.Recorded == nil || meta.Recorded.Offset != "+02:00" {
+		t.Fatalf("recorded=%+v", meta.Recorded)
+	}
+	if meta.Source == nil || meta.Source.Title != "Design review" {
+		t.Fatalf("source=%+v", meta.Source)
+	}
+	mu.Lock()
+	items, _ := loadStagedUploads()
+	sums, _ := loadChecksums()
+	mu.Unlock()
+	if len(items) != 0 {
+		t.Fatalf("staged=%v", items)
+	}
+	if _, ok := sums["uuid/clip/audio.webm"]; !ok {
+		t.Fatalf("recording not in checksum index")
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/uploads/"+id, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("HEAD after finalize: %d", rec.Code)
+	}
+}
+
+func TestResumableUploadWithoutSizeAndAbandon(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.S3 = s3Config{} })
+	id := createResumableUpload(t, `{"path": "talk.webm", "resumable": true}`, nil)
+	patchChunk(id, "0", strings.NewReader("abc"))
+	if rec := patchChunk(id, "3", strings.NewReader("def")); rec.Code != http.StatusNoContent {
+		t.Fatalf("chunk: %d %s", rec.Code, rec.Body)
+	}
+
+	// The janitor leaves idle uploads alone until they expire.
+	part := filepath.Join(dir, "talk.webm."+id+".tmp")
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(part, old, old)
+	runJanitor(time.Now(), time.Hour)
+	if _, err := os.Stat(part); err != nil {
+		t.Fatalf("janitor removed a live upload: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/uploads/"+id, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d", rec.Code)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Fatalf("part file left behind: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "talk.webm")); !os.IsNotExist(err) {
+		t.Fatalf("abandoned upload was saved")
+	}
+}
+
+func TestResumableUploadRefusesOversizedDeclaration(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.MaxBodyBytes = 100 })
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(`{"path": "big.webm", "resumable": true, "size": 101}`)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status=%d %s", rec.Code, rec.Body)
+	}
+}
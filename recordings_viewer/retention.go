@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// retentionPolicy decides which sessions are removed or archived. A zero
+// MaxAge or MaxBytes disables that rule.
+type retentionPolicy struct {
+	MaxAge     time.Duration
+	MaxBytes   int64
+	Action     string // "delete" or "archive"
+	ArchiveDir string
+}
+
+func (p retentionPolicy) enabled() bool {
+	return p.MaxAge > 0 || p.MaxBytes > 0
+}
+
+// retentionCandidate is a session selected by the policy.
+type retentionCandidate struct {
+	ID        string    `json:"id"`
+	Files     []string  `json:"files"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `json:"createdAt"`
+	Reason    string    `json:"reason"`
+}
+
+type retentionPlan struct {
+	Action     string               `json:"action"`
+	Candidates []retentionCandidate `json:"candidates"`
+	FreedBytes int64                `json:"freedBytes"`
+	TotalBytes int64                `json:"totalBytes"`
+}
+
+func sessionBytes(s session) int64 {
+	var n int64
+	for _, f := range s.Files {
+		if info, err := os.Stat(absPath(f)); err == nil {
+			n += info.Size()
+		}
+	}
+	return n
+}
+
+// planRetention selects sessions older than MaxAge, then the oldest remaining
+// sessions until the library fits in MaxBytes.
+func planRetention(p retentionPolicy, now time.Time) (retentionPlan, error) {
+	plan := retentionPlan{Action: p.Action, Candidates: []retentionCandidate{}}
+	sessions, err := scanSessions()
+	if err != nil {
+		return plan, err
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+
+	sizes := make([]int64, len(sessions))
+	for i, s := range sessions {
+		sizes[i] = sessionBytes(s)
+		plan.TotalBytes += sizes[i]
+	}
+	remaining := plan.TotalBytes
+	for i, s := range sessions {
+		reason := ""
+		switch {
+		case p.MaxAge > 0 && now.Sub(s.CreatedAt) > p.MaxAge:
+			reason = fmt.Sprintf("older than %s", p.MaxAge)
+		case p.MaxBytes > 0 && remaining > p.MaxBytes:
+			reason = fmt.Sprintf("library exceeds %d bytes", p.MaxBytes)
+		default:
+			continue
+		}
+		plan.Candidates = append(plan.Candidates, retentionCandidate{
+			ID: s.ID, Files: s.Files, Bytes: sizes[i], CreatedAt: s.CreatedAt, Reason: reason,
+		})
+		plan.FreedBytes += sizes[i]
+		remaining -= sizes[i]
+	}
+	return plan, nil
+}
+
+// applyRetention deletes or archives the planned sessions. Archived files keep
+// their path relative to baseDir under ArchiveDir.
+func applyRetention(p retentionPolicy, plan retentionPlan) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	done := 0
+	for _, c := range plan.Candidates {
+		for _, f := range c.Files {
+			src := absPath(f)
+			var err error
+			if p.Action == "archive" {
+				dst := filepath.Join(p.ArchiveDir, filepath.FromSlash(f))
+				if err = os.MkdirAll(filepath.Dir(dst), 0o755); err == nil {
+					err = moveFile(src, dst)
+				}
+			} else {
+				err = os.Remove(src)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return done, fmt.Errorf("%s %s: %w", p.Action, f, err)
+			}
+			forgetFiles(src)
+		}
+		done++
+		publishEvent("retention."+p.Action, c.ID, map[string]any{"reason": c.Reason, "bytes": c.Bytes})
+	}
+	return done, nil
+}
+
+// moveFile renames src to dst, copying across filesystems when needed.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if _, err := writeFileAtomic(dst, in); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// currentRetentionPolicy returns the configured policy, archiving into the
+// hidden state dir when no archive dir is set.
+func currentRetentionPolicy() retentionPolicy {
+	p := cfg().Retention
+	if p.Action != "delete" {
+		p.Action = "archive"
+	}
+	if p.ArchiveDir == "" {
+		p.ArchiveDir = filepath.Join(stateDir(), "archive")
+	}
+	return p
+}
+
+// runRetention plans and applies the configured policy once.
+func runRetention(now time.Time) {
+	p := currentRetentionPolicy()
+	if !p.enabled() {
+		return
+	}
+	plan, err := planRetention(p, now)
+	if err != nil {
+		slog.Error("retention", "err", err)
+		return
+	}
+	if len(plan.Candidates) == 0 {
+		return
+	}
+	n, err := applyRetention(p, plan)
+	if err != nil {
+		slog.Error("retention", "err", err)
+	}
+	slog.Info("retention applied", "action", p.Action, "sessions", n, "bytes", plan.FreedBytes)
+}
+
+// retentionPreviewHandler serves GET /api/retention/preview, a dry run of the
+// configured policy listing what would be removed.
+func retentionPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := currentRetentionPolicy()
+	if !p.enabled() {
+		writeJSON(w, retentionPlan{Action: p.Action, Candidates: []retentionCandidate{}})
+		return
+	}
+	plan, err := planRetention(p, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, plan)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func ageFiles(t *testing.T, dir string, age time.Duration, names ...string) {
+	t.Helper()
+	when := time.Now().Add(-age)
+	for _, n := range names {
+		if err := os.Chtimes(filepath.Join(dir, n), when, when); err != nil {
+			t.Fatalf("chtimes %s: %v", n, err)
+		}
+	}
+}
+
+func TestRetentionPreviewListsOldSessions(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "old.webm", "old.txt", "new.webm")
+	ageFiles(t, dir, 40*24*time.Hour, "old.webm", "old.txt")
+	useConfig(t, func(c *config) { c.Retention = retentionPolicy{MaxAge: 30 * 24 * time.Hour} })
+
+	rec := httptest.NewRecorder()
+	retentionPreviewHandler(rec, httptest.NewRequest(http.MethodGet, "/api/retention/preview", nil))
+	var plan retentionPlan
+	if err := json.NewDecoder(rec.Body).Decode(&plan); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if plan.Action != "archive" || len(plan.Candidates) != 1 || plan.Candidates[0].ID != "old" || len(plan.Candidates[0].Files) != 2 {
+		t.Fatalf("plan=%+v", plan)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.webm")); err != nil {
+		t.Fatalf("preview must not remove files: %v", err)
+	}
+}
+
+func TestPlanRetentionTrimsOldestToSizeLimit(t *testing.T) {
+	dir := useTempBaseDir(t)
+	for _, n := range []string{"a.webm", "b.webm", "c.webm"} {
+		if err := os.WriteFile(filepath.Join(dir, n), make([]byte, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ageFiles(t, dir, 3*time.Hour, "a.webm")
+	ageFiles(t, dir, 2*time.Hour, "b.webm")
+	plan, err := planRetention(retentionPolicy{MaxBytes: 150}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Candidates) != 2 || plan.Candidates[0].ID != "a" || plan.Candidates[1].ID != "b" || plan.FreedBytes != 200 {
+		t.Fatalf("plan=%+v", plan)
+	}
+}
+
+func TestRunRetentionArchivesAndDeletes(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "talks/old.webm", "gone.webm")
+	ageFiles(t, dir, 48*time.Hour, "talks/old.webm", "gone.webm")
+	archive := t.TempDir()
+	useConfig(t, func(c *config) {
+		c.Retention = retentionPolicy{MaxAge: time.Hour, ArchiveDir: archive}
+	})
+	runRetention(time.Now())
+	if _, err := os.Stat(filepath.Join(archive, "talks/old.webm")); err != nil {
+		t.Fatalf("expected archived file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "talks/old.webm")); !os.IsNotExist(err) {
+		t.Fatalf("original should be gone: %v", err)
+	}
+
+	writeTestFiles(t, dir, "stale.webm")
+	ageFiles(t, dir, 48*time.Hour, "stale.webm")
+	useConfig(t, func(c *config) { c.Retention = retentionPolicy{MaxAge: time.Hour, Action: "delete"} })
+	runRetention(time.Now())
+	if _, err := os.Stat(filepath.Join(dir, "stale.webm")); !os.IsNotExist(err) {
+		t.Fatalf("stale file should be deleted: %v", err)
+	}
+}
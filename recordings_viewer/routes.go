@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// recordingHandler handles a request about one recording; rel is its
+// cleaned path relative to baseDir.
+type recordingHandler func(w http.ResponseWriter, r *http.Request, rel string)
+
+// ServeHTTP calls h with the "path" wildcard, which recordingRouter sets to
+// the cleaned recording path, so recording handlers can be wrapped in the
+// same middleware as any other handler.
+func (h recordingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h(w, r, r.PathValue("path"))
+}
+
+// segmentRoute is the action of /api/transcripts/{path}/segments/{n}.
+const segmentRoute = "segments/{n}"
+
+// recordingRouter serves the routes under a recording's path. ServeMux can
+// only match a path of any depth with a trailing {path...} wildcard, so the
+// action that may follow it, e.g. "tags" in /api/transcripts/{path}/tags, is
+// matched here: routes are registered as "METHOD action", or as "METHOD" for
+// the recording itself.
+type recordingRouter struct {
+	routes map[string]map[string]http.Handler // action, then method
+}
+
+func (rr *recordingRouter) handle(pattern string, h http.Handler) {
+	method, action, _ := strings.Cut(pattern, " ")
+	if rr.routes == nil {
+		rr.routes = map[string]map[string]http.Handler{}
+	}
+	if rr.routes[action] == nil {
+		rr.routes[action] = map[string]http.Handler{}
+	}
+	rr.routes[action][method] = h
+}
+
+// split separates the action from the recording path in rel.
+func (rr *recordingRouter) split(rel string) (recording, action, n string) {
+	if recording, i, ok := splitSegmentPath(rel); ok {
+		if _, ok := rr.routes[segmentRoute]; ok {
+			return recording, segmentRoute, strconv.Itoa(i)
+		}
+	}
+	if i := strings.LastIndex(rel, "/"); i > 0 {
+		if _, ok := rr.routes[rel[i+1:]]; ok {
+			return rel[:i], rel[i+1:], ""
+		}
+	}
+	return rel, "", ""
+}
+
+// ServeHTTP serves a request matched by a pattern ending in {path...}.
+func (rr *recordingRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rel := r.PathValue("path")
+	if rel == "" || strings.HasSuffix(rel, "/") {
+		http.Error(w, "missing transcript path", http.StatusBadRequest)
+		return
+	}
+	recording, action, n := rr.split(rel)
+	cleanRel, _, err := resolveRecordingPath(recording)
+	if errors.Is(err, errStatePath) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	methods := rr.routes[action]
+	h, ok := methods[r.Method]
+	if !ok {
+		allowed := make([]string, 0, len(methods))
+		for m := range methods {
+			allowed = append(allowed, m)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.SetPathValue("path", cleanRel)
+	if n != "" {
+		r.SetPathValue("n", n)
+	}
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecordingRouterDispatchesByActionAndMethod(t *testing.T) {
+	useTempBaseDir(t)
+	rr := &recordingRouter{}
+	route := func(name string) recordingHandler {
+		return func(w http.ResponseWriter, r *http.Request, rel string) {
+			fmt.Fprintf(w, "%s %s %s", name, rel, r.PathValue("n"))
+		}
+	}
+	rr.handle("GET", route("file"))
+	rr.handle("GET tags", route("get-tags"))
+	rr.handle("DELETE tags", route("delete-tags"))
+	rr.handle("PATCH "+segmentRoute, route("segment"))
+	mux := http.NewServeMux()
+	mux.Handle("/api/transcripts/{path...}", rr)
+
+	for _, tc := range []struct{ method, path, want string }{
+		{http.MethodGet, "/api/transcripts/a/b.txt", "file a/b.txt "},
+		{http.MethodGet, "/api/transcripts/a/b.txt/tags", "get-tags a/b.txt "},
+		{http.MethodDelete, "/api/transcripts/a/b.txt/tags", "delete-tags a/b.txt "},
+		{http.MethodPatch, "/api/transcripts/a/b.json/segments/3", "segment a/b.json 3"},
+		// Not a registered action, so part of the recording's path.
+		{http.MethodGet, "/api/transcripts/a/notes", "file a/notes "},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != tc.want {
+			t.Fatalf("%s %s: %d %q want %q", tc.method, tc.path, rec.Code, rec.Body, tc.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/transcripts/a/b.txt/tags", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "DELETE, GET" {
+		t.Fatalf("status=%d allow=%q", rec.Code, rec.Header().Get("Allow"))
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/a/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("directory: status=%d", rec.Code)
+	}
+}
+
+func TestTranscriptRoutesRejectUnsupportedMethods(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.txt")
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/transcripts/call.txt/export", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Fatalf("status=%d allow=%q", rec.Code, rec.Header().Get("Allow"))
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/transcripts/call.txt", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, PUT" {
+		t.Fatalf("v1: status=%d allow=%q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
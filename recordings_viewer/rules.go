@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Rule fields: what a rule's keyword is looked for in.
+const (
+	ruleTitle      = "title"
+	ruleURL        = "url"
+	ruleTranscript = "transcript"
+	ruleAny        = "any"
+)
+
+// assignRule tags recordings whose title, URL or transcript contain a
+// keyword, so they file themselves under a project. Keyword matches
+// ignoring case; "|" separates alternatives, as in VIEWER_TOPICS.
+type assignRule struct {
+	ID      string `json:"id"`
+	Field   string `json:"field"`
+	Keyword string `json:"keyword"`
+	Tag     string `json:"tag"`
+	Enabled bool   `json:"enabled"`
+}
+
+func (rule *assignRule) validate() error {
+	rule.Field = strings.ToLower(strings.TrimSpace(rule.Field))
+	if rule.Field == "" {
+		rule.Field = ruleAny
+	}
+	rule.Keyword = strings.TrimSpace(rule.Keyword)
+	rule.Tag = strings.TrimSpace(rule.Tag)
+	switch {
+	case !slices.Contains([]string{ruleTitle, ruleURL, ruleTranscript, ruleAny}, rule.Field):
+		return fmt.Errorf("unknown field %q (want title, url, transcript or any)", rule.Field)
+	case len(rule.alternatives()) == 0:
+		return errors.New("keyword is required")
+	case rule.Tag == "":
+		return errors.New("tag is required")
+	}
+	return nil
+}
+
+func (rule assignRule) alternatives() []string {
+	var out []string
+	for _, k := range strings.Split(rule.Keyword, "|") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// matches reports whether the rule's keyword appears in src.
+func (rule assignRule) matches(src ruleSource) bool {
+	var texts []string
+	switch rule.Field {
+	case ruleTitle:
+		texts = []string{src.Title}
+	case ruleURL:
+		texts = []string{src.URL}
+	case ruleTranscript:
+		texts = []string{src.Transcript}
+	default:
+		texts = []string{src.Title, src.URL, src.Transcript}
+	}
+	for _, text := range texts {
+		text = strings.ToLower(text)
+		for _, k := range rule.alternatives() {
+			if strings.Contains(text, k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ruleSource is what rules are matched against. Title and URL are those of
+// the tab the extension recorded, from the history.jsonl it keeps next to
+// each recording folder; without one the title is the session ID.
+type ruleSource struct {
+	Title, URL, Transcript string
+}
+
+func newRuleSource(s *session) ruleSource {
+	src := ruleSource{Title: s.ID, Transcript: sessionText(s)}
+	if title, url, ok := tabHistory(s); ok {
+		if title != "" {
+			src.Title = title
+		}
+		src.URL = url
+	}
+	return src
+}
+
+// tabHistory finds the extension's history entry for the folder of s and
+// returns the tab title and URL it recorded.
+func tabHistory(s *session) (title, url string, ok bool) {
+	if s.Folder == "" {
+		return "", "", false
+	}
+	f, err := os.Open(filepath.Join(absPath(path.Dir(s.Folder)), "history.jsonl"))
+	if err != nil {
+		return "", "", false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var entry struct {
+			Folder   string `json:"folder"`
+			TabTitle string `json:"tabTitle"`
+			TabURL   string `json:"tabURL"`
+		}
+		if json.Unmarshal(sc.Bytes(), &entry) != nil {
+			continue
+		}
+		// The host writes absolute paths of its own machine.
+		if base := entry.Folder[strings.LastIndexAny(entry.Folder, `/\`)+1:]; base == path.Base(s.Folder) {
+			title, url, ok = entry.TabTitle, entry.TabURL, true
+		}
+	}
+	return title, url, ok
+}
+
+func rulesPath() string {
+	return filepath.Join(stateDir(), "rules.json")
+}
+
+// loadRules reads the rules in the order they were added. Callers hold mu.
+func loadRules() ([]assignRule, error) {
+	items := []assignRule{}
+	data, err := os.ReadFile(rulesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func saveRules(items []assignRule) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(rulesPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// ruleAssignment is the tags the rules gave one session.
+type ruleAssignment struct {
+	Session string   `json:"session"`
+	Tags    []string `json:"tags"`
+	Rules   []string `json:"rules"`
+}
+
+// evaluateRules returns the tags the enabled rules give s that it does not
+// have yet, and the rules that matched.
+func evaluateRules(rules []assignRule, s *session) (tags, matched []string) {
+	var src *ruleSource
+	for _, rule := range rules {
+		if !rule.Enabled || slices.Contains(s.Tags, rule.Tag) {
+			continue
+		}
+		if src == nil {
+			v := newRuleSource(s)
+			src = &v
+		}
+		if rule.matches(*src) {
+			matched = append(matched, rule.ID)
+			if !slices.Contains(tags, rule.Tag) {
+				tags = append(tags, rule.Tag)
+			}
+		}
+	}
+	return tags, matched
+}
+
+// applyRules adds the tags the rules give s to its manifest and publishes
+// "tags.updated". Tags are only ever added, so removing one by hand
+// sticks until the rule matches a new recording.
+func applyRules(rules []assignRule, s *session) (*ruleAssignment, error) {
+	tags, matched := evaluateRules(rules, s)
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	meta, err := loadMeta(s.metaPath())
+	if err != nil {
+		return nil, err
+	}
+	meta.Tags = normalizeTags(append(meta.Tags, tags...))
+	if err := saveMeta(s.metaPath(), meta); err != nil {
+		return nil, err
+	}
+	publishEvent("tags.updated", s.ID, map[string]any{"tags": meta.Tags, "rules": matched})
+	return &ruleAssignment{Session: s.ID, Tags: tags, Rules: matched}, nil
+}
+
+// applyRulesAfterTranscription runs the rules on the session of the
+// recording at rel once its transcript is written.
+func applyRulesAfterTranscription(rel string) {
+	if cfg().ReadOnly {
+		return
+	}
+	mu.Lock()
+	rules, err := loadRules()
+	mu.Unlock()
+	if err != nil {
+		slog.Error("rules", "err", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	s, err := findSession(rel)
+	if err != nil {
+		return
+	}
+	a, err := applyRules(rules, s)
+	if err != nil {
+		slog.Error("rules", "path", rel, "err", err)
+		return
+	}
+	if a != nil {
+		slog.Info("rules tagged recording", "session", a.Session, "tags", a.Tags)
+	}
+}
+
+// rulesHandler serves /api/rules: GET lists the rules, POST adds one and
+// GET/PUT/DELETE /api/rules/{id} manage one. POST /api/rules/apply runs
+// the enabled rules over the whole library, or with ?dry=1 only reports
+// what they would tag.
+func rulesHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/rules"), "/")
+	if id == "apply" {
+		applyRulesHandler(w, r)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	rules, err := loadRules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, rules)
+		case http.MethodPost:
+			var rule assignRule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if err := rule.validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rule.ID = randomID()
+			if err := saveRules(append(rules, rule)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			requestLogger(r).Info("added rule", "id", rule.ID, "tag", rule.Tag)
+			writeJSONStatus(w, http.StatusCreated, rule)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	i := slices.IndexFunc(rules, func(rule assignRule) bool { return rule.ID == id })
+	if i < 0 {
+		http.Error(w, "rule not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, rules[i])
+	case http.MethodPut:
+		var rule assignRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := rule.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rule.ID = id
+		rules[i] = rule
+		if err := saveRules(rules); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, rule)
+	case http.MethodDelete:
+		if err := saveRules(slices.Delete(rules, i, i+1)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func applyRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dry, _ := strconv.ParseBool(r.URL.Query().Get("dry"))
+	mu.Lock()
+	rules, err := loadRules()
+	mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sessions, err := scanSessions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := []ruleAssignment{}
+	for i := range sessions {
+		s := &sessions[i]
+		if dry {
+			if tags, matched := evaluateRules(rules, s); len(tags) > 0 {
+				out = append(out, ruleAssignment{Session: s.ID, Tags: tags, Rules: matched})
+			}
+			continue
+		}
+		a, err := applyRules(rules, s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if a != nil {
+			out = append(out, *a)
+		}
+	}
+	if !dry {
+		requestLogger(r).Info("applied rules", "sessions", len(out))
+	}
+	writeJSON(w, out)
+}
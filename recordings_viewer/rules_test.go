@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func addRule(t *testing.T, body string) assignRule {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/rules %s: %d %s", body, rec.Code, rec.Body)
+	}
+	var rule assignRule
+	if err := json.Unmarshal(rec.Body.Bytes(), &rule); err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func TestRulesCRUD(t *testing.T) {
+	useTempBaseDir(t)
+	rule := addRule(t, `{"field": "URL", "keyword": " github.com/acme ", "tag": "project:acme", "enabled": true}`)
+	if rule.ID == "" || rule.Field != ruleURL || rule.Keyword != "github.com/acme" {
+		t.Fatalf("rule=%+v", rule)
+	}
+	addRule(t, `{"keyword": "budget", "tag": "finance"}`)
+
+	for _, bad := range []string{`{"field": "body", "keyword": "x", "tag": "y"}`, `{"keyword": " | ", "tag": "y"}`, `{"keyword": "x"}`, `{`} {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(bad)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("POST %s: %d", bad, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/rules/"+rule.ID, strings.NewReader(`{"field": "title", "keyword": "Acme", "tag": "project:acme"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"enabled":false`) {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/rules/"+rule.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rules/"+rule.ID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("GET deleted: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rules", nil))
+	var rules []assignRule
+	json.Unmarshal(rec.Body.Bytes(), &rules)
+	if len(rules) != 1 || rules[0].Tag != "finance" || rules[0].Field != ruleAny {
+		t.Fatalf("rules=%+v", rules)
+	}
+}
+
+func TestApplyRulesMatchesTitleURLAndTranscript(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "tab-1/standup-20240501-100000-abc123/audio.webm", "notes/call.webm")
+	os.WriteFile(filepath.Join(dir, "tab-1/standup-20240501-100000-abc123/transcript.txt"), []byte("we went over the Q3 budget"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes/call.txt"), []byte("nothing to see"), 0o644)
+	history := `{"folder": "C:\\Users\\me\\recordings\\tab-1\\standup-20240501-100000-abc123", "tabTitle": "Acme weekly standup", "tabURL": "https://meet.example.com/acme-standup"}` + "\n"
+	os.WriteFile(filepath.Join(dir, "tab-1/history.jsonl"), []byte(history), 0o644)
+
+	addRule(t, `{"field": "title", "keyword": "acme", "tag": "project:acme", "enabled": true}`)
+	addRule(t, `{"field": "url", "keyword": "zoom.us|meet.example.com", "tag": "meeting", "enabled": true}`)
+	addRule(t, `{"field": "transcript", "keyword": "budget", "tag": "finance", "enabled": true}`)
+	addRule(t, `{"keyword": "call", "tag": "disabled", "enabled": false}`)
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/rules/apply?dry=1", nil))
+	var planned []ruleAssignment
+	json.Unmarshal(rec.Body.Bytes(), &planned)
+	if rec.Code != http.StatusOK || len(planned) != 1 || !slices.Equal(planned[0].Tags, []string{"project:acme", "meeting", "finance"}) {
+		t.Fatalf("dry run: %d %s", rec.Code, rec.Body)
+	}
+	if s, _ := findSession("tab-1/standup-20240501-100000-abc123/audio"); len(s.Tags) != 0 {
+		t.Fatalf("dry run tagged %v", s.Tags)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/rules/apply", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply: %d %s", rec.Code, rec.Body)
+	}
+	s, _ := findSession("tab-1/standup-20240501-100000-abc123/audio")
+	if !slices.Equal(s.Tags, []string{"finance", "meeting", "project:acme"}) {
+		t.Fatalf("tags=%v", s.Tags)
+	}
+	if other, _ := findSession("notes/call"); len(other.Tags) != 0 {
+		t.Fatalf("unmatched session tagged %v", other.Tags)
+	}
+
+	// Tags already present are not reported again.
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/rules/apply", nil))
+	if strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Fatalf("second apply: %s", rec.Body)
+	}
+}
+
+func TestRulesRunAfterTranscription(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "interview.webm")
+	addRule(t, `{"field": "transcript", "keyword": "candidate", "tag": "hiring", "enabled": true}`)
+	fakeWhisper(t, "60", func(_ context.Context, args []string) ([]byte, error) {
+		out := argAfter(args, "--output_dir")
+		return nil, os.WriteFile(filepath.Join(out, "interview.json"), []byte(`{"text":"Tell me about the candidate","segments":[]}`), 0o644)
+	})
+
+	j := queueTranscription(t, "interview.webm")
+	runJob(j)
+
+	s, err := findSession("interview")
+	if err != nil || !slices.Equal(s.Tags, []string{"hiring"}) {
+		t.Fatalf("session=%+v err=%v", s, err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objectURL returns the path-style URL for key in the configured bucket.
+func (c s3Config) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + path.Join(c.Bucket, key)
+	return u, nil
+}
+
+// objectKey maps a recordings-relative path to its key in the bucket.
+func (c s3Config) objectKey(rel string) string {
+	return path.Join(c.Prefix, rel)
+}
+
+// presign returns a SigV4 query-signed URL for method on key.
+func (c s3Config) presign(method, key string, expires time.Duration) (string, error) {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return presignV4(method, u, c.Region, c.AccessKey, c.SecretKey, c.SessionToken, time.Now(), expires), nil
+}
+
+// s3Client makes the server's own requests to the bucket; an endpoint that
+// does not answer fails them instead of hanging the caller.
+var s3Client = &http.Client{Timeout: 30 * time.Second}
+
+// headObject checks that key exists and returns its size and ETag.
+func (c s3Config) headObject(ctx context.Context, key string) (int64, string, error) {
+	signed, err := c.presign(http.MethodHead, key, 5*time.Minute)
+	if err != nil {
+		return 0, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, signed, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	res, err := s3Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("object %s: %s", key, res.Status)
+	}
+	return res.ContentLength, strings.Trim(res.Header.Get("ETag"), `"`), nil
+}
+
+// presignV4 implements AWS Signature Version 4 query-string signing with an
+// unsigned payload, which is what S3-compatible stores expect for presigned
+// URLs. Only the host header is signed so browsers can PUT freely.
+func presignV4(method string, u *url.URL, region, accessKey, secretKey, sessionToken string, now time.Time, expires time.Duration) string {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	scope := day + "/" + region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", accessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprint(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if sessionToken != "" {
+		query.Set("X-Amz-Security-Token", sessionToken)
+	}
+	canonicalQuery := canonicalQueryString(query)
+	canonicalURI := awsURIEncode(u.Path, false)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	signed := *u
+	signed.RawPath = canonicalURI
+	signed.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return signed.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQueryString(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, val := range v[k] {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(val, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes s per the SigV4 rules: everything except
+// unreserved characters, and '/' too unless encodeSlash is false.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
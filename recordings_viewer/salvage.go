@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// chunkSuffix matches the ".chunk0000" marker of incremental capture
+// uploads: a client saves name.chunk0000.webm, name.chunk0001.webm, … while
+// recording and name.webm once it stops, which removes the chunks.
+var chunkSuffix = regexp.MustCompile(`\.chunk\d{4,}$`)
+
+// isChunkFile reports whether name is an incremental capture chunk.
+func isChunkFile(name string) bool {
+	return isAudioFile(name) && chunkSuffix.MatchString(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// partialInfo marks a recording rebuilt from the chunks of an interrupted
+// capture; the end of the recording is probably missing.
+type partialInfo struct {
+	SalvagedAt time.Time `json:"salvagedAt"`
+	Chunks     int       `json:"chunks"`
+	Bytes      int64     `json:"bytes"`
+}
+
+// chunkGroup is the chunks one capture left behind.
+type chunkGroup struct {
+	fullPath string // the recording the chunks would have become
+	chunks   []string
+	bytes    int64
+	first    time.Time
+	last     time.Time
+}
+
+// findChunkGroups collects capture chunks in every workspace by the
+// recording they belong to.
+func findChunkGroups() ([]*chunkGroup, error) {
+	groups := map[string]*chunkGroup{}
+	err := walkRecordings(func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isChunkFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		ext := filepath.Ext(p)
+		target := chunkSuffix.ReplaceAllString(strings.TrimSuffix(p, ext), "") + ext
+		g := groups[target]
+		if g == nil {
+			g = &chunkGroup{fullPath: target, first: info.ModTime()}
+			groups[target] = g
+		}
+		g.chunks = append(g.chunks, p)
+		g.bytes += info.Size()
+		if info.ModTime().Before(g.first) {
+			g.first = info.ModTime()
+		}
+		if info.ModTime().After(g.last) {
+			g.last = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*chunkGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.Slice(g.chunks, func(i, j int) bool { return naturalLess(g.chunks[i], g.chunks[j]) })
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool { return naturalLess(out[i].fullPath, out[j].fullPath) })
+	return out, nil
+}
+
+// dropChunks removes the capture chunks of the recording at fullPath once
+// the complete recording has been saved. Callers hold mu.
+func dropChunks(fullPath string) {
+	if !isAudioFile(fullPath) || isChunkFile(filepath.Base(fullPath)) {
+		return
+	}
+	ext := filepath.Ext(fullPath)
+	stem := strings.TrimSuffix(fullPath, ext)
+	matches, _ := filepath.Glob(globEscape(stem) + ".chunk[0-9][0-9][0-9][0-9]*" + globEscape(ext))
+	var removed []string
+	for _, m := range matches {
+		if isChunkFile(filepath.Base(m)) && os.Remove(m) == nil {
+			removed = append(removed, m)
+		}
+	}
+	if len(removed) > 0 {
+		forgetFiles(removed...)
+	}
+}
+
+// concatChunks writes the chunks back to back into out. MediaRecorder only
+// puts the container header in the first chunk, so the result is one
+// stream, missing the index a finished recording would have.
+func concatChunks(chunks []string, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		in, err := os.Open(c)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		_, err = io.Copy(f, in)
+		in.Close()
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// remuxSalvaged copies whatever ffmpeg can decode from in to out, rebuilding
+// timestamps and the index and dropping a truncated tail.
+func remuxSalvaged(ctx context.Context, in, out string) error {
+	output, err := runCommandFunc(ctx, cfg().FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-fflags", "+genpts+discardcorrupt", "-err_detect", "ignore_err",
+		"-i", in,
+		"-vn", "-c:a", "copy",
+		out,
+	)
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, outputTail(output))
+	}
+	if info, err := os.Stat(out); err != nil || info.Size() == 0 {
+		return errors.New("nothing playable in the chunks")
+	}
+	return nil
+}
+
+type salvagedRecording struct {
+	Session string `json:"session"`
+	Path    string `json:"path"`
+	Chunks  int    `json:"chunks"`
+	Bytes   int64  `json:"bytes"`
+	Job     string `json:"job,omitempty"`
+	// NotQueued says why no transcription was queued; see
+	// preflightTranscription.
+	NotQueued string `json:"notQueued,omitempty"`
+}
+
+type salvageSkip struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type salvageReport struct {
+	Salvaged []salvagedRecording `json:"salvaged"`
+	Skipped  []salvageSkip       `json:"skipped"`
+}
+
+// salvageGroup rebuilds one interrupted capture as a partial recording.
+// Callers hold mu.
+func salvageGroup(ctx context.Context, g *chunkGroup, now time.Time) error {
+	id := randomID()
+	if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+		return err
+	}
+	ext := filepath.Ext(g.fullPath)
+	joined := filepath.Join(tempDir(), "salvage-"+id+ext)
+	defer os.Remove(joined)
+	if err := concatChunks(g.chunks, joined); err != nil {
+		return err
+	}
+	remuxed := filepath.Join(tempDir(), "salvage-"+id+".out"+ext)
+	defer os.Remove(remuxed)
+	if err := remuxSalvaged(ctx, joined, remuxed); err != nil {
+		return err
+	}
+	if err := moveFile(remuxed, g.fullPath); err != nil {
+		return err
+	}
+	trackFiles(g.fullPath)
+	meta, err := loadMeta(g.fullPath)
+	if err != nil {
+		return err
+	}
+	meta.Partial = &partialInfo{SalvagedAt: now.UTC(), Chunks: len(g.chunks), Bytes: g.bytes}
+	if meta.Recorded == nil {
+		rt := newRecordingTime(g.first.In(time.Local))
+		meta.Recorded = &rt
+	}
+	if err := saveMeta(g.fullPath, meta); err != nil {
+		return err
+	}
+	dropChunks(g.fullPath)
+	return nil
+}
+
+// salvageHandler serves POST /api/salvage. Chunks of captures that stopped
+// uploading more than cfg.SalvageIdle ago, and never saved their complete
+// recording, are joined and remuxed into a recording marked partial, which
+// is queued for transcription unless the body says {"transcribe": false}.
+func salvageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req := struct {
+		Transcribe *bool  `json:"transcribe"`
+		Engine     string `json:"engine"`
+		Model      string `json:"model"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	transcribe := req.Transcribe == nil || *req.Transcribe
+	if req.Engine == "" {
+		req.Engine = cfg().DefaultEngine
+	}
+	if _, ok := cfg().Engines[req.Engine]; transcribe && !ok {
+		http.Error(w, "unknown engine", http.StatusBadRequest)
+		return
+	}
+
+	logger := requestLogger(r)
+	now := time.Now()
+	report := salvageReport{Salvaged: []salvagedRecording{}, Skipped: []salvageSkip{}}
+	mu.Lock()
+	groups, err := findChunkGroups()
+	if err != nil {
+		mu.Unlock()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, g := range groups {
+		rel, _ := relPath(g.fullPath)
+		switch _, statErr := os.Stat(g.fullPath); {
+		case now.Sub(g.last) < cfg().SalvageIdle:
+			report.Skipped = append(report.Skipped, salvageSkip{Path: rel, Reason: "capture still active"})
+			continue
+		case statErr == nil:
+			report.Skipped = append(report.Skipped, salvageSkip{Path: rel, Reason: "recording already exists"})
+			continue
+		}
+		if err := salvageGroup(r.Context(), g, now); err != nil {
+			logger.Warn("salvage failed", "path", rel, "chunks", len(g.chunks), "err", err)
+			report.Skipped = append(report.Skipped, salvageSkip{Path: rel, Reason: err.Error()})
+			continue
+		}
+		logger.Info("salvaged partial recording", "path", rel, "chunks", len(g.chunks), "bytes", g.bytes)
+		report.Salvaged = append(report.Salvaged, salvagedRecording{
+			Session: path.Join(path.Dir(rel), recordingStem(path.Base(rel))),
+			Path:    rel, Chunks: len(g.chunks), Bytes: g.bytes,
+		})
+	}
+	mu.Unlock()
+
+	for i, s := range report.Salvaged {
+		publishEvent("recording.salvaged", s.Path, map[string]any{"chunks": s.Chunks, "bytes": s.Bytes})
+		if transcribe {
+			j, err := queueTranscribeJob(s.Path, req.Engine, req.Model)
+			if err != nil {
+				report.Salvaged[i].NotQueued = err.Error()
+				continue
+			}
+			report.Salvaged[i].Job = j.ID
+		}
+	}
+	writeJSON(w, report)
+}
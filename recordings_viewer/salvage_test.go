@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRemux makes ffmpeg copy its input to its output, or fail for inputs
+// containing "garbage".
+func fakeRemux(t *testing.T) {
+	t.Helper()
+	useRunCommand(t, func(_ context.Context, name string, a ...string) ([]byte, error) {
+		data, err := os.ReadFile(argAfter(a, "-i"))
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(string(data), "garbage") {
+			return []byte("invalid data"), errors.New("exit status 1")
+		}
+		return nil, os.WriteFile(a[len(a)-1], data, 0o644)
+	})
+}
+
+func TestSalvageRebuildsInterruptedCapture(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{})
+	useConfig(t, func(c *config) { c.SalvageIdle = time.Minute })
+	fakeRemux(t)
+	chunks := []string{"tab/call.chunk0000.webm", "tab/call.chunk0001.webm", "tab/call.chunk0010.webm"}
+	for i, c := range chunks {
+		os.MkdirAll(filepath.Join(dir, "tab"), 0o755)
+		os.WriteFile(filepath.Join(dir, c), []byte{'a' + byte(i)}, 0o644)
+	}
+	ageFiles(t, dir, time.Hour, chunks...)
+	writeTestFiles(t, dir, "live.chunk0000.webm")
+
+	rec := httptest.NewRecorder()
+	salvageHandler(rec, httptest.NewRequest(http.MethodPost, "/api/salvage", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body)
+	}
+	var report salvageReport
+	json.NewDecoder(rec.Body).Decode(&report)
+	if len(report.Salvaged) != 1 || report.Salvaged[0].Session != "tab/call" || report.Salvaged[0].Chunks != 3 || report.Salvaged[0].Job == "" {
+		t.Fatalf("salvaged=%+v", report.Salvaged)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Path != "live.webm" {
+		t.Fatalf("skipped=%+v; the active capture should be left alone", report.Skipped)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "tab", "call.webm"))
+	if err != nil || string(data) != "abc" {
+		t.Fatalf("salvaged audio=%q err=%v; chunks must be joined in order", data, err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "tab", "*.chunk*")); len(matches) != 0 {
+		t.Fatalf("chunks left behind: %v", matches)
+	}
+	s, err := findSession("tab/call")
+	if err != nil || !s.Partial {
+		t.Fatalf("session=%+v err=%v; want partial", s, err)
+	}
+}
+
+func TestSalvageKeepsChunksWhenNothingIsPlayable(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{})
+	fakeRemux(t)
+	os.WriteFile(filepath.Join(dir, "x.chunk0000.webm"), []byte("garbage"), 0o644)
+	ageFiles(t, dir, time.Hour, "x.chunk0000.webm")
+
+	rec := httptest.NewRecorder()
+	salvageHandler(rec, httptest.NewRequest(http.MethodPost, "/api/salvage", strings.NewReader(`{"transcribe":false}`)))
+	var report salvageReport
+	json.NewDecoder(rec.Body).Decode(&report)
+	if len(report.Salvaged) != 0 || len(report.Skipped) != 1 || !strings.Contains(report.Skipped[0].Reason, "invalid data") {
+		t.Fatalf("report=%+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x.chunk0000.webm")); err != nil {
+		t.Fatalf("chunk removed after failed salvage: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x.webm")); !os.IsNotExist(err) {
+		t.Fatalf("recording created after failed salvage: %v", err)
+	}
+}
+
+func TestPutCompleteRecordingDropsChunks(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.chunk0000.webm", "a.chunk0001.webm", "ab.chunk0000.webm")
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/transcripts/a.webm", strings.NewReader(webmHeader+"full")))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status=%d", rec.Code)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.chunk*"))
+	if len(matches) != 1 || filepath.Base(matches[0]) != "ab.chunk0000.webm" {
+		t.Fatalf("remaining chunks=%v", matches)
+	}
+	sessions, _ := scanSessions()
+	if len(sessions) != 1 || sessions[0].ID != "a" {
+		t.Fatalf("sessions=%+v; chunks must not show up as sessions", sessions)
+	}
+}
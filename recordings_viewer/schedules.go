@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cronSpec is a parsed schedule expression: either five cron fields
+// (minute hour day-of-month month day-of-week) or "@every <duration>".
+type cronSpec struct {
+	every                         time.Duration
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronDescriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+}
+
+// parseCron parses expr. Fields accept *, numbers, ranges (a-b), lists
+// (a,b) and steps (*/n, a-b/n); day-of-week 7 is Sunday like 0.
+func parseCron(expr string) (cronSpec, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Minute {
+			return cronSpec{}, fmt.Errorf("invalid @every duration %q (minimum 1m)", rest)
+		}
+		return cronSpec{every: d}, nil
+	}
+	if full, ok := cronDescriptors[expr]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSpec{}, fmt.Errorf("expected 5 fields in %q", expr)
+	}
+	var spec cronSpec
+	var err error
+	bounds := []struct {
+		dst      *uint64
+		min, max int
+	}{{&spec.minute, 0, 59}, {&spec.hour, 0, 23}, {&spec.dom, 1, 31}, {&spec.month, 1, 12}, {&spec.dow, 0, 7}}
+	for i, b := range bounds {
+		if *b.dst, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return cronSpec{}, fmt.Errorf("field %d: %w", i+1, err)
+		}
+	}
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1
+	}
+	spec.domAny = fields[2] == "*"
+	spec.dowAny = fields[4] == "*"
+	return spec, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loText); err != nil {
+				return 0, fmt.Errorf("invalid value %q", loText)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiText); err != nil {
+					return 0, fmt.Errorf("invalid value %q", hiText)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first run time strictly after t.
+func (c cronSpec) next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron semantics: when both day fields are restricted a
+// day matching either one qualifies.
+func (c cronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// scheduledTasks are the background tasks that can be scheduled by name.
+var scheduledTasks = map[string]func(now time.Time){
+	"janitor":    runScheduledJanitor,
+	"retention":  runRetention,
+	"cold":       runColdStorage,
+	"backfill":   runBackfill,
+	"digest":     runDigest,
+	"verify":     runScheduledVerify,
+	"backup":     runScheduledBackup,
+	"duplicates": runScheduledDuplicates,
+	"calendar":   runScheduledCalendar,
+	"sync":       runScheduledSync,
+}
+
+// schedule is the persisted timing of one task.
+type schedule struct {
+	Name    string    `json:"name"`
+	Expr    string    `json:"expr"`
+	Enabled bool      `json:"enabled"`
+	LastRun time.Time `json:"lastRun,omitzero"`
+}
+
+type scheduleView struct {
+	schedule
+	NextRuns []time.Time `json:"nextRuns"`
+}
+
+var scheduler struct {
+	sync.Mutex
+	changed chan struct{}
+}
+
+func schedulesPath() string {
+	return filepath.Join(stateDir(), "schedules.json")
+}
+
+// defaultSchedules derives the initial timings from the environment so
+// existing VIEWER_*_INTERVAL settings keep working.
+func defaultSchedules() map[string]schedule {
+	every := func(d time.Duration) string {
+		if d <= 0 {
+			return "@every 1h"
+		}
+		return "@every " + d.String()
+	}
+	return map[string]schedule{
+		"janitor":    {Name: "janitor", Expr: every(cfg().JanitorInterval), Enabled: cfg().JanitorInterval > 0},
+		"retention":  {Name: "retention", Expr: every(cfg().RetentionInterval), Enabled: cfg().RetentionInterval > 0},
+		"cold":       {Name: "cold", Expr: "0 1 * * *", Enabled: cfg().Cold.After > 0},
+		"backfill":   {Name: "backfill", Expr: "0 3 * * *"},
+		"digest":     {Name: "digest", Expr: "0 8 * * *"},
+		"verify":     {Name: "verify", Expr: "0 4 * * 0"},
+		"backup":     {Name: "backup", Expr: "0 2 * * *"},
+		"duplicates": {Name: "duplicates", Expr: "0 5 * * 0"},
+		"calendar":   {Name: "calendar", Expr: "@every 15m", Enabled: len(cfg().CalendarFeeds) > 0},
+		"sync":       {Name: "sync", Expr: "@every 15m", Enabled: cfg().SyncPeer != ""},
+	}
+}
+
+// loadSchedules returns the defaults overlaid with saved schedules. Callers
+// hold scheduler.
+func loadSchedules() (map[string]schedule, error) {
+	items := defaultSchedules()
+	data, err := os.ReadFile(schedulesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string]schedule
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	for name, s := range saved {
+		if _, ok := scheduledTasks[name]; ok {
+			s.Name = name
+			items[name] = s
+		}
+	}
+	return items, nil
+}
+
+func saveSchedules(items map[string]schedule) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(schedulesPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// nextRun is when s should fire after now. A task that has never run on an
+// @every schedule runs immediately; a missed cron run fires once on start.
+func (s schedule) nextRun(spec cronSpec, now time.Time) time.Time {
+	if s.LastRun.IsZero() {
+		if spec.every > 0 {
+			return now
+		}
+		return spec.next(now)
+	}
+	return spec.next(s.LastRun)
+}
+
+// runDueSchedules runs every enabled task whose next run is not after now
+// and returns when the scheduler should wake again.
+func runDueSchedules(now time.Time) time.Time {
+	scheduler.Lock()
+	items, err := loadSchedules()
+	scheduler.Unlock()
+	if err != nil {
+		slog.Error("schedules", "err", err)
+		return now.Add(time.Minute)
+	}
+	wake := now.Add(time.Hour)
+	for name, s := range items {
+		spec, err := parseCron(s.Expr)
+		if !s.Enabled || err != nil {
+			continue
+		}
+		next := s.nextRun(spec, now)
+		if !next.After(now) && cfg().ReadOnly && mutatingTasks[name] {
+			next = spec.next(now)
+		} else if !next.After(now) {
+			scheduledTasks[name](now)
+			scheduler.Lock()
+			if current, err := loadSchedules(); err == nil {
+				s = current[name]
+				s.LastRun = now.UTC()
+				current[name] = s
+				if err := saveSchedules(current); err != nil {
+					slog.Error("schedules", "err", err)
+				}
+			}
+			scheduler.Unlock()
+			next = spec.next(now)
+		}
+		if !next.IsZero() && next.Before(wake) {
+			wake = next
+		}
+	}
+	return wake
+}
+
+// startScheduler runs scheduled tasks until ctx is cancelled, re-reading the
+// schedules whenever they are changed through the API.
+func startScheduler(ctx context.Context) {
+	scheduler.Lock()
+	if scheduler.changed == nil {
+		scheduler.changed = make(chan struct{}, 1)
+	}
+	changed := scheduler.changed
+	scheduler.Unlock()
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			wake := runDueSchedules(time.Now())
+			timer := time.NewTimer(time.Until(wake))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-changed:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+func notifyScheduler() {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	if scheduler.changed == nil {
+		return
+	}
+	select {
+	case scheduler.changed <- struct{}{}:
+	default:
+	}
+}
+
+func scheduleViews(items map[string]schedule, now time.Time) []scheduleView {
+	views := []scheduleView{}
+	for _, s := range items {
+		v := scheduleView{schedule: s, NextRuns: []time.Time{}}
+		if spec, err := parseCron(s.Expr); err == nil && s.Enabled {
+			t := s.nextRun(spec, now)
+			for len(v.NextRuns) < 5 && !t.IsZero() {
+				v.NextRuns = append(v.NextRuns, t.UTC())
+				t = spec.next(t)
+			}
+		}
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// schedulesHandler serves GET /api/schedules with the next five runs of each
+// task, and PUT /api/schedules to change expressions or enable tasks.
+func schedulesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		scheduler.Lock()
+		items, err := loadSchedules()
+		scheduler.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, scheduleViews(items, time.Now()))
+	case http.MethodPut:
+		var updates []struct {
+			Name    string  `json:"name"`
+			Expr    *string `json:"expr"`
+			Enabled *bool   `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		scheduler.Lock()
+		items, err := loadSchedules()
+		if err != nil {
+			scheduler.Unlock()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, u := range updates {
+			s, ok := items[u.Name]
+			if !ok {
+				scheduler.Unlock()
+				http.Error(w, "unknown schedule: "+u.Name, http.StatusBadRequest)
+				return
+			}
+			if u.Expr != nil {
+				if _, err := parseCron(*u.Expr); err != nil {
+					scheduler.Unlock()
+					http.Error(w, u.Name+": "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				s.Expr = strings.TrimSpace(*u.Expr)
+			}
+			if u.Enabled != nil {
+				s.Enabled = *u.Enabled
+			}
+			items[u.Name] = s
+		}
+		err = saveSchedules(items)
+		scheduler.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notifyScheduler()
+		publishEvent("schedules.updated", "", nil)
+		writeJSON(w, scheduleViews(items, time.Now()))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func runScheduledJanitor(now time.Time) {
+	report := runJanitor(now, cfg().JanitorTTL)
+	if n := report.ExpiredUploads + report.PartialFiles + report.TempOutputs; n > 0 {
+		slog.Info("janitor removed stale items", "items", n, "bytes", report.BytesFreed)
+	}
+}
+
+// runBackfill queues a transcription for every audio recording that has no
+// transcript and no pending job.
+func runBackfill(now time.Time) {
+	sessions, err := scanSessions()
+	if err != nil {
+		slog.Error("backfill", "err", err)
+		return
+	}
+	pending := map[string]bool{}
+	for _, j := range jobs.list() {
+		if j.Status == jobQueued || j.Status == jobRunning {
+			pending[j.Path] = true
+		}
+	}
+	queued := 0
+	for _, s := range sessions {
+		if s.Audio == "" || s.hasTranscript() || pending[s.Audio] {
+			continue
+		}
+		if _, err := queueTranscribeJob(s.Audio, cfg().DefaultEngine, ""); err != nil {
+			continue
+		}
+		queued++
+	}
+	if queued > 0 {
+		slog.Info("backfill queued transcriptions", "count", queued)
+	}
+}
+
+// runDigest publishes a "digest" event summarising activity in the previous
+// day: new sessions and finished jobs.
+func runDigest(now time.Time) {
+	since := now.Add(-24 * time.Hour)
+	sessions, err := scanSessions()
+	if err != nil {
+		slog.Error("digest", "err", err)
+		return
+	}
+	var created []string
+	for _, s := range sessions {
+		if s.CreatedAt.After(since) {
+			created = append(created, s.ID)
+		}
+	}
+	completed, failed := 0, 0
+	for _, j := range jobs.list() {
+		if j.FinishedAt == nil || j.FinishedAt.Before(since) {
+			continue
+		}
+		switch j.Status {
+		case jobCompleted:
+			completed++
+		case jobFailed:
+			failed++
+		}
+	}
+	publishEvent("digest", "", map[string]any{
+		"since":         since.UTC(),
+		"newSessions":   created,
+		"jobsCompleted": completed,
+		"jobsFailed":    failed,
+	})
+}
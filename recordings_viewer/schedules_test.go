@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	from := time.Date(2024, 3, 1, 10, 17, 30, 0, time.UTC) // a Friday
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 3, 2, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 7", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", from.Add(90 * time.Minute)},
+	}
+	for _, c := range cases {
+		spec, err := parseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", c.expr, err)
+		}
+		if got := spec.next(from); !got.Equal(c.want) {
+			t.Errorf("%q next=%s want %s", c.expr, got, c.want)
+		}
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every 10s"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("%q should not parse", bad)
+		}
+	}
+}
+
+func TestSchedulesAPIUpdatesAndPreviews(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.JanitorInterval = time.Hour })
+
+	rec := httptest.NewRecorder()
+	body := `[{"name":"backfill","expr":"0 2 * * *","enabled":true},{"name":"janitor","enabled":false}]`
+	schedulesHandler(rec, httptest.NewRequest(http.MethodPut, "/api/schedules", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	schedulesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/schedules", nil))
+	var views []scheduleView
+	if err := json.NewDecoder(rec.Body).Decode(&views); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	byName := map[string]scheduleView{}
+	for _, v := range views {
+		byName[v.Name] = v
+	}
+	backfill := byName["backfill"]
+	if backfill.Expr != "0 2 * * *" || len(backfill.NextRuns) != 5 || backfill.NextRuns[0].Hour() != 2 {
+		t.Fatalf("backfill=%+v", backfill)
+	}
+	if j := byName["janitor"]; j.Enabled || len(j.NextRuns) != 0 {
+		t.Fatalf("janitor=%+v", j)
+	}
+
+	for _, bad := range []string{`[{"name":"nope"}]`, `[{"name":"digest","expr":"bogus"}]`} {
+		rec = httptest.NewRecorder()
+		schedulesHandler(rec, httptest.NewRequest(http.MethodPut, "/api/schedules", strings.NewReader(bad)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d", bad, rec.Code)
+		}
+	}
+}
+
+func TestRunDueSchedulesRecordsLastRun(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	writeTestFiles(t, dir, "done.webm", "done.txt", "todo.webm")
+	useConfig(t, func(c *config) { c.JanitorInterval = 0 })
+	scheduler.Lock()
+	saveSchedules(map[string]schedule{"backfill": {Expr: "@every 1h", Enabled: true}})
+	scheduler.Unlock()
+
+	now := time.Now()
+	if wake := runDueSchedules(now); !wake.Equal(now.Add(time.Hour)) {
+		t.Fatalf("wake=%s want %s", wake, now.Add(time.Hour))
+	}
+	queued := jobs.list()
+	if len(queued) != 1 || queued[0].Path != "todo.webm" {
+		t.Fatalf("backfill jobs=%+v", queued)
+	}
+	runDueSchedules(now.Add(time.Minute))
+	if n := len(jobs.list()); n != 1 {
+		t.Fatalf("backfill ran again before its next run: %d jobs", n)
+	}
+	scheduler.Lock()
+	items, _ := loadSchedules()
+	scheduler.Unlock()
+	if !items["backfill"].LastRun.Equal(now.UTC()) {
+		t.Fatalf("lastRun=%s", items["backfill"].LastRun)
+	}
+}
+
+func TestStartSchedulerStopsOnCancel(t *testing.T) {
+	useTempBaseDir(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	startScheduler(ctx)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("scheduler did not stop after cancel")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchExportContext is how many segments around each match a search
+// report quotes when the request does not say.
+const searchExportContext = 1
+
+// searchReportHit is a segment a search export found, with the segments
+// around it and a link that plays the recording from its start.
+type searchReportHit struct {
+	Session string
+	Path    string
+	Link    string
+	Segment int
+	Start   float64
+	End     float64
+	Speaker string
+	Text    string
+	Spans   [][2]int
+	Before  []string
+	After   []string
+}
+
+// searchReport runs q over every finished transcript, quoting the around
+// segments on each side of a match. Transcripts that cannot be read are
+// skipped and logged.
+func searchReport(r *http.Request, q searchQuery, around int) ([]searchReportHit, error) {
+	sessions, err := scanSessions()
+	if err != nil {
+		return nil, err
+	}
+	var hits []searchReportHit
+	for i := range sessions {
+		s := &sessions[i]
+		src := s.TranscriptJSON
+		if src == "" {
+			src = s.Transcript
+		}
+		if src == "" || !q.matchesSession(s) {
+			continue
+		}
+		doc, err := loadTranscriptDoc(absPath(src))
+		if err != nil {
+			requestLogger(r).Warn("search export", "path", src, "err", err)
+			continue
+		}
+		link := sourceURL(r, s.ID)
+		for n, seg := range doc.Segments {
+			spans := q.matchSegment(seg)
+			if spans == nil {
+				continue
+			}
+			h := searchReportHit{Session: s.ID, Path: src, Link: link, Segment: n, Start: seg.Start, End: seg.End, Speaker: seg.Speaker, Text: seg.Text, Spans: spans}
+			if seg.End > 0 {
+				h.Link += "#t=" + strconv.FormatFloat(seg.Start, 'f', -1, 64)
+			}
+			for _, c := range doc.Segments[max(0, n-around):n] {
+				h.Before = append(h.Before, c.caption())
+			}
+			for _, c := range doc.Segments[n+1 : min(len(doc.Segments), n+1+around)] {
+				h.After = append(h.After, c.caption())
+			}
+			hits = append(hits, h)
+		}
+	}
+	return hits, nil
+}
+
+// markText wraps the spans of text, offsets and lengths in runes, in
+// before and after, joining spans that overlap.
+func markText(text string, spans [][2]int, before, after string) string {
+	rs := []rune(text)
+	var b strings.Builder
+	at := 0
+	for i := 0; i < len(spans); i++ {
+		start, end := spans[i][0], spans[i][0]+spans[i][1]
+		for i+1 < len(spans) && spans[i+1][0] <= end {
+			i++
+			end = max(end, spans[i][0]+spans[i][1])
+		}
+		if start < at || end > len(rs) || start == end {
+			continue
+		}
+		b.WriteString(string(rs[at:start]) + before + string(rs[start:end]) + after)
+		at = end
+	}
+	b.WriteString(string(rs[at:]))
+	return b.String()
+}
+
+// renderSearchMarkdown writes hits as a Markdown report: a section per
+// recording, and under it each match's time, linked to the recording,
+// quoted with its context and the matched text in bold.
+func renderSearchMarkdown(query string, hits []searchReportHit, exported time.Time) string {
+	var b strings.Builder
+	recordings := 0
+	for i, h := range hits {
+		if i == 0 || hits[i-1].Session != h.Session {
+			recordings++
+		}
+	}
+	fmt.Fprintf(&b, "# Search: %s\n\n", query)
+	fmt.Fprintf(&b, "%d matches in %d recordings, exported %s.\n", len(hits), recordings, exported.UTC().Format(time.RFC3339))
+	for i, h := range hits {
+		if i == 0 || hits[i-1].Session != h.Session {
+			fmt.Fprintf(&b, "\n## %s\n", h.Session)
+		}
+		fmt.Fprintf(&b, "\n### [%s](%s)\n\n", clockTime(h.Start), h.Link)
+		for _, c := range h.Before {
+			fmt.Fprintf(&b, "> %s\n", c)
+		}
+		text := markText(strings.TrimSpace(h.Text), trimmedSpans(h.Text, h.Spans), "**", "**")
+		if h.Speaker != "" {
+			text = h.Speaker + ": " + text
+		}
+		fmt.Fprintf(&b, "> %s\n", text)
+		for _, c := range h.After {
+			fmt.Fprintf(&b, "> %s\n", c)
+		}
+	}
+	return b.String()
+}
+
+// trimmedSpans shifts spans into text with its leading space trimmed, as
+// whisper starts each segment with one.
+func trimmedSpans(text string, spans [][2]int) [][2]int {
+	lead := len([]rune(text)) - len([]rune(strings.TrimLeft(text, " \t\n")))
+	out := make([][2]int, 0, len(spans))
+	for _, sp := range spans {
+		if start := sp[0] - lead; start >= 0 {
+			out = append(out, [2]int{start, sp[1]})
+		}
+	}
+	return out
+}
+
+// searchCSVColumns are the columns of a CSV search report.
+var searchCSVColumns = []string{"session", "transcript", "segment", "start", "end", "speaker", "text", "before", "after", "link"}
+
+// writeSearchCSV writes hits as CSV with a UTF-8 byte order mark, as
+// writeSessionsCSV does.
+func writeSearchCSV(w http.ResponseWriter, hits []searchReportHit) {
+	w.Write([]byte("\ufeff"))
+	cw := csv.NewWriter(w)
+	cw.Write(searchCSVColumns)
+	for _, h := range hits {
+		cw.Write([]string{
+			csvText(h.Session), csvText(h.Path), strconv.Itoa(h.Segment),
+			clockTime(h.Start), clockTime(h.End), csvText(h.Speaker),
+			csvText(strings.TrimSpace(h.Text)),
+			csvText(strings.Join(h.Before, " ")), csvText(strings.Join(h.After, " ")),
+			h.Link,
+		})
+	}
+	cw.Flush()
+}
+
+// searchExportHandler serves POST /api/search/export with a body of
+// {"query": "...", "regex": false, "format": "markdown"|"csv",
+// "context": 1}: a report of every segment of every finished transcript
+// the query matches (see searchQuery), with "context" segments on each side
+// and a link that plays the recording from the match.
+func searchExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		Query   string `json:"query"`
+		Regex   bool   `json:"regex"`
+		Format  string `json:"format"`
+		Context *int   `json:"context"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON body", bodyErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+	if strings.TrimSpace(payload.Query) == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+	if payload.Format == "" {
+		payload.Format = "markdown"
+	}
+	if !slices.Contains([]string{"markdown", "csv"}, payload.Format) {
+		http.Error(w, "format must be markdown or csv", http.StatusBadRequest)
+		return
+	}
+	around := searchExportContext
+	if payload.Context != nil {
+		if around = *payload.Context; around < 0 {
+			http.Error(w, "context must be a number of segments", http.StatusBadRequest)
+			return
+		}
+	}
+	q, err := parseSearchQuery(payload.Query, payload.Regex)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hits, err := searchReport(r, q, around)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(hits) == 0 {
+		http.Error(w, "no transcripts match the query", http.StatusNotFound)
+		return
+	}
+	now := time.Now()
+	name := "search-" + now.Format("20060102")
+	if payload.Format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+		writeSearchCSV(w, hits)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, name))
+	fmt.Fprint(w, renderSearchMarkdown(payload.Query, hits, now))
+}
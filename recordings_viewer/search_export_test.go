@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkText(t *testing.T) {
+	if got := markText("Ça va, ça va.", [][2]int{{0, 2}, {0, 5}, {7, 2}}, "**", "**"); got != "**Ça va**, **ça** va." {
+		t.Fatalf("marked = %q", got)
+	}
+}
+
+func TestSearchExportHandler(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.PublicURL = "https://viewer.example" })
+	writeTestFiles(t, dir, "2024/call.webm", "2024/standup.webm")
+	os.WriteFile(filepath.Join(dir, "2024", "call.json"), []byte(segmentsFixture), 0o644)
+	os.WriteFile(filepath.Join(dir, "2024", "standup.txt"), []byte("Kenobi was not at the standup.\n"), 0o644)
+	export := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/search/export", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := export(`{"query": "kenobi"}`)
+	md := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/markdown; charset=utf-8" {
+		t.Fatalf("markdown export = %d %s", rec.Code, md)
+	}
+	for _, want := range []string{
+		"# Search: kenobi\n\n2 matches in 2 recordings",
+		"## 2024/call\n\n### [00:00:01](https://viewer.example/recordings/2024/call.webm#t=1.5)\n\n> Hello there.\n> General **Kenobi**.\n",
+		"## 2024/standup\n\n### [00:00:00](https://viewer.example/recordings/2024/standup.webm)\n\n> **Kenobi** was not at the standup.\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+
+	rec = export(`{"query": "title:call", "format": "csv", "context": 0}`)
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(rec.Body.String(), "\ufeff"))).ReadAll()
+	if err != nil || rec.Code != http.StatusOK || len(rows) != 3 || rows[1][0] != "2024/call" || rows[2][6] != "General Kenobi." || rows[2][7] != "" {
+		t.Fatalf("csv export = %d %q", rec.Code, rows)
+	}
+
+	for body, want := range map[string]int{
+		`{"query": ""}`:                   http.StatusBadRequest,
+		`{"query": "x", "format": "pdf"}`: http.StatusBadRequest,
+		`{"query": "(", "regex": true}`:   http.StatusBadRequest,
+		`{"query": "obi-wan"}`:            http.StatusNotFound,
+	} {
+		if rec := export(body); rec.Code != want {
+			t.Errorf("%s = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// searchNearDefault is how many words apart the terms of a NEAR without a
+// distance may be.
+const searchNearDefault = 5
+
+// searchFilters are the filters a transcript search understands.
+var searchFilters = []string{"title", "tag", "speaker"}
+
+// searchSyntax describes the query language for GET
+// /api/system/capabilities, so clients know what to offer.
+var searchSyntax = map[string]any{
+	"phrases": true,
+	"near":    map[string]any{"operator": "NEAR/n", "defaultWords": searchNearDefault},
+	"filters": searchFilters,
+	"regex":   map[string]any{"param": "regex", "syntax": "re2"},
+}
+
+// searchTerm is text a segment must contain: a word or phrase, ignoring
+// case, or in regex mode a regular expression.
+type searchTerm struct {
+	lit []rune
+	re  *regexp.Regexp
+}
+
+// nearTerms requires two terms in the same segment, at most within words
+// apart.
+type nearTerms struct {
+	a, b   searchTerm
+	within int
+}
+
+// searchQuery is a transcript search such as
+// `speaker:Me "budget review" costs NEAR/3 march`. A segment matches when
+// it contains every term and every NEAR pair; speaker: keeps the segments
+// of any of the speakers named, and title: and tag: the recordings whose
+// title contains each title: given and that have each tag.
+type searchQuery struct {
+	Terms    []searchTerm
+	Near     []nearTerms
+	Titles   []string
+	Tags     []string
+	Speakers []string
+}
+
+// parseSearchQuery parses a search string. Words are split as in
+// parseSessionQuery, so "quoted phrases" are one term; "a NEAR b" or
+// "a NEAR/3 b" pairs the terms around it. With regex set every term is a
+// regular expression, matched ignoring case. Words with an unknown key,
+// such as "10:30", are terms.
+func parseSearchQuery(q string, regex bool) (searchQuery, error) {
+	var sq searchQuery
+	words, err := splitQuery(q)
+	if err != nil {
+		return sq, err
+	}
+	term := func(w string) (searchTerm, error) {
+		if !regex {
+			return searchTerm{lit: foldRunes(w)}, nil
+		}
+		re, err := regexp.Compile("(?i)" + w)
+		if err != nil {
+			return searchTerm{}, fmt.Errorf("invalid regular expression %q: %v", w, err)
+		}
+		return searchTerm{re: re}, nil
+	}
+	afterTerm := false
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if key, value, ok := strings.Cut(w, ":"); ok && slices.Contains(searchFilters, strings.ToLower(key)) {
+			if value == "" {
+				return sq, fmt.Errorf("%s: needs a value", key)
+			}
+			switch strings.ToLower(key) {
+			case "title":
+				sq.Titles = append(sq.Titles, strings.ToLower(value))
+			case "tag":
+				sq.Tags = append(sq.Tags, value)
+			default:
+				sq.Speakers = append(sq.Speakers, value)
+			}
+			afterTerm = false
+			continue
+		}
+		if w == "NEAR" || strings.HasPrefix(w, "NEAR/") {
+			within := searchNearDefault
+			if n, ok := strings.CutPrefix(w, "NEAR/"); ok {
+				if within, err = strconv.Atoi(n); err != nil || within < 1 {
+					return sq, fmt.Errorf("%s: want NEAR/n with n a number of words", w)
+				}
+			}
+			if !afterTerm || i+1 == len(words) {
+				return sq, fmt.Errorf("%s needs a term on each side", w)
+			}
+			b, err := term(words[i+1])
+			if err != nil {
+				return sq, err
+			}
+			last := len(sq.Terms) - 1
+			sq.Near = append(sq.Near, nearTerms{a: sq.Terms[last], b: b, within: within})
+			sq.Terms = sq.Terms[:last]
+			i++
+			afterTerm = false
+			continue
+		}
+		t, err := term(w)
+		if err != nil {
+			return sq, err
+		}
+		sq.Terms = append(sq.Terms, t)
+		afterTerm = true
+	}
+	return sq, nil
+}
+
+// find returns where t occurs in text, as offsets and lengths in runes.
+// Empty matches of a regular expression are left out.
+func (t searchTerm) find(text string) [][2]int {
+	var out [][2]int
+	if t.re != nil {
+		for _, loc := range t.re.FindAllStringIndex(text, -1) {
+			if loc[0] < loc[1] {
+				out = append(out, [2]int{utf8.RuneCountInString(text[:loc[0]]), utf8.RuneCountInString(text[loc[0]:loc[1]])})
+			}
+		}
+		return out
+	}
+	if len(t.lit) == 0 {
+		return nil
+	}
+	rs := foldRunes(text)
+	for i := 0; i+len(t.lit) <= len(rs); i++ {
+		if slices.Equal(rs[i:i+len(t.lit)], t.lit) {
+			out = append(out, [2]int{i, len(t.lit)})
+			i += len(t.lit) - 1
+		}
+	}
+	return out
+}
+
+// wordIndex numbers the words of text: the nth rune of text is in, or
+// follows, word wordIndex(text)[n].
+func wordIndex(text string) []int {
+	idx := make([]int, 0, len(text))
+	n, inWord := -1, false
+	for _, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && !inWord {
+			n++
+		}
+		inWord = isWord
+		idx = append(idx, n)
+	}
+	return idx
+}
+
+// matchSegment returns the spans of seg's text to highlight, as offsets
+// and lengths in runes, or nil when seg does not match. A query of
+// filters alone highlights the whole text.
+func (q searchQuery) matchSegment(seg segment) [][2]int {
+	if len(q.Speakers) > 0 && !slices.ContainsFunc(q.Speakers, func(s string) bool { return strings.EqualFold(s, seg.Speaker) }) {
+		return nil
+	}
+	var spans [][2]int
+	for _, t := range q.Terms {
+		found := t.find(seg.Text)
+		if len(found) == 0 {
+			return nil
+		}
+		spans = append(spans, found...)
+	}
+	var words []int
+	for _, n := range q.Near {
+		as, bs := n.a.find(seg.Text), n.b.find(seg.Text)
+		if words == nil {
+			words = wordIndex(seg.Text)
+		}
+		near := false
+		for _, a := range as {
+			for _, b := range bs {
+				if d := words[a[0]] - words[b[0]]; d <= n.within && d >= -n.within {
+					spans = append(spans, a, b)
+					near = true
+				}
+			}
+		}
+		if !near {
+			return nil
+		}
+	}
+	if len(q.Terms) == 0 && len(q.Near) == 0 {
+		return [][2]int{{0, utf8.RuneCountInString(seg.Text)}}
+	}
+	slices.SortFunc(spans, func(a, b [2]int) int {
+		if a[0] != b[0] {
+			return a[0] - b[0]
+		}
+		return a[1] - b[1]
+	})
+	return slices.Compact(spans)
+}
+
+// matchesSession reports whether s passes q's title: and tag: filters. A
+// recording's title is its name, and the title of the tab or calendar
+// event it was recorded in.
+func (q searchQuery) matchesSession(s *session) bool {
+	if !hasAllTags(s.Tags, q.Tags) {
+		return false
+	}
+	if len(q.Titles) == 0 {
+		return true
+	}
+	titles := strings.ToLower(recordingStem(filepath.Base(s.ID)))
+	if s.Source != nil {
+		titles += "\n" + strings.ToLower(s.Source.Title)
+	}
+	if s.Calendar != nil {
+		titles += "\n" + strings.ToLower(s.Calendar.Title)
+	}
+	for _, t := range q.Titles {
+		if !strings.Contains(titles, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// filtersSessions reports whether q has filters on the recording itself.
+func (q searchQuery) filtersSessions() bool {
+	return len(q.Titles) > 0 || len(q.Tags) > 0
+}
+
+// search returns a match for every span q highlights in segs, in
+// transcript order.
+func (q searchQuery) search(segs []segment) []transcriptMatch {
+	matches := []transcriptMatch{}
+	for n, seg := range segs {
+		for _, sp := range q.matchSegment(seg) {
+			matches = append(matches, transcriptMatch{Segment: n, Start: seg.Start, End: seg.End, Offset: sp[0], Length: sp[1], Text: seg.Text})
+		}
+	}
+	return matches
+}
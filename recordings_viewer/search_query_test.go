@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSearchQuerySegments(t *testing.T) {
+	segs := []segment{
+		{Start: 0, End: 2, Text: " Ça va? ÇA VA.", Speaker: "Me"},
+		{Start: 2, End: 4, Text: " The budget for March is tight.", Speaker: "Others"},
+		{Start: 4, End: 6, Text: " March on, the budget can wait a few more weeks.", Speaker: "Me"},
+	}
+	cases := []struct {
+		q     string
+		regex bool
+		want  string // segment:offset:length of each match
+	}{
+		{q: `"ça va"`, want: "0:1:5 0:8:5"},
+		{q: `ça va`, want: "0:1:2 0:4:2 0:8:2 0:11:2"},
+		{q: `aa`},
+		{q: `budget NEAR/2 march`, want: "1:5:6 1:16:5"},
+		{q: `budget NEAR march`, want: "1:5:6 1:16:5 2:1:5 2:15:6"},
+		{q: `budget speaker:me`, want: "2:15:6"},
+		{q: `speaker:Others`, want: "1:0:31"},
+		{q: `m(ar|ay)ch\b`, regex: true, want: "1:16:5 2:1:5"},
+		{q: `"budget (for|can)"`, regex: true, want: "1:5:10 2:15:10"},
+	}
+	for _, c := range cases {
+		q, err := parseSearchQuery(c.q, c.regex)
+		if err != nil {
+			t.Errorf("%s: %v", c.q, err)
+			continue
+		}
+		var got []string
+		for _, m := range q.search(segs) {
+			got = append(got, fmt.Sprintf("%d:%d:%d", m.Segment, m.Offset, m.Length))
+		}
+		if strings.Join(got, " ") != c.want {
+			t.Errorf("%s = %v, want %s", c.q, got, c.want)
+		}
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	for _, q := range []string{`NEAR march`, `budget NEAR`, `a NEAR/x b`, `tag:`, `"open`, `a(`} {
+		if _, err := parseSearchQuery(q, true); err == nil {
+			t.Errorf("%s parsed", q)
+		}
+	}
+	q, err := parseSearchQuery(`10:30 title:Standup tag:work`, false)
+	if err != nil || len(q.Terms) != 1 || q.Titles[0] != "standup" || q.Tags[0] != "work" {
+		t.Fatalf("query = %+v, %v", q, err)
+	}
+	s := &session{ID: "2024/standup-05.webm", Tags: []string{"work"}}
+	if !q.matchesSession(s) {
+		t.Error("recording does not match its title and tag")
+	}
+	s.Tags = nil
+	if q.matchesSession(s) {
+		t.Error("recording without the tag matches")
+	}
+}
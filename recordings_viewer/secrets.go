@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// secretSettings are the settings that may come from the secret store
+// instead of the environment or config file, which win when they set them.
+func secretSettings(c *config) map[string]*string {
+	return map[string]*string{
+		"VIEWER_AUTH_TOKEN":       &c.AuthToken,
+		"VIEWER_SHARE_SECRET":     &c.ShareSecret,
+		"VIEWER_BACKUP_PASSWORD":  &c.BackupPassword,
+		"VIEWER_WEBHOOK_SECRET":   &c.WebhookSecret,
+		"VIEWER_SYNC_TOKEN":       &c.SyncToken,
+		"VIEWER_S3_SECRET_KEY":    &c.S3.SecretKey,
+		"VIEWER_S3_SESSION_TOKEN": &c.S3.SessionToken,
+	}
+}
+
+var errSecretNotFound = errors.New("secret not found")
+
+// secretStore keeps secrets by setting name.
+type secretStore interface {
+	// kind names the store for logs and the CLI, e.g. "keychain".
+	kind() string
+	get(name string) (string, error)
+	set(name, value string) error
+	remove(name string) error
+}
+
+// openSecretStore returns the store c.SecretsBackend names. "auto" picks
+// the OS keychain when there is one: the macOS Keychain, libsecret on Linux
+// desktops and DPAPI on Windows. Otherwise it falls back to a file
+// encrypted with VIEWER_SECRETS_PASSPHRASE.
+func openSecretStore(c config) (secretStore, error) {
+	file := &secretsFile{path: c.SecretsFile, passphrase: os.Getenv("VIEWER_SECRETS_PASSPHRASE")}
+	if file.path == "" {
+		file.path = filepath.Join(secretsDir(), "secrets.enc")
+	}
+	switch c.SecretsBackend {
+	case "file":
+		return file, nil
+	case "keychain":
+		return osKeychain(), nil
+	case "", "auto":
+		if osKeychainAvailable() {
+			return osKeychain(), nil
+		}
+		return file, nil
+	}
+	return nil, fmt.Errorf("VIEWER_SECRETS_BACKEND: unknown backend %q (want auto, keychain or file)", c.SecretsBackend)
+}
+
+// secretsDir is the per-user folder for secrets kept in files, outside the
+// recordings so they are not backed up or shared with them.
+func secretsDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, serviceName)
+}
+
+func osKeychain() secretStore {
+	switch hostOS {
+	case "darwin":
+		return macKeychain{}
+	case "windows":
+		return &secretsFile{path: filepath.Join(secretsDir(), "secrets.dpapi"), dpapi: true}
+	}
+	return libsecret{}
+}
+
+func osKeychainAvailable() bool {
+	switch hostOS {
+	case "darwin":
+		_, err := exec.LookPath("security")
+		return err == nil
+	case "windows":
+		return true
+	}
+	// secret-tool needs a session bus to reach the keyring daemon, which
+	// headless machines lack.
+	_, err := exec.LookPath("secret-tool")
+	return err == nil && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != ""
+}
+
+// applyStoredSecrets fills the secret settings c leaves empty from the
+// secret store. Without a store, or when it fails, c is left as it is.
+func applyStoredSecrets(c *config) {
+	store, err := openSecretStore(*c)
+	if err != nil {
+		slog.Warn("secret store unavailable", "err", err)
+		return
+	}
+	fields := secretSettings(c)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if *fields[name] != "" {
+			continue
+		}
+		v, err := store.get(name)
+		if errors.Is(err, errSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			slog.Warn("secret store unavailable", "store", store.kind(), "err", err)
+			return
+		}
+		*fields[name] = v
+		slog.Debug("setting read from secret store", "name", name, "store", store.kind())
+	}
+}
+
+// runSecretCommand runs a keychain tool with stdin as its input and
+// returns its standard output. Tests replace it.
+var runSecretCommand = func(stdin, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// exitCode is the exit status of the command that returned err, or -1.
+func exitCode(err error) int {
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode()
+	}
+	return -1
+}
+
+// macKeychain keeps secrets as generic passwords in the login keychain.
+type macKeychain struct{}
+
+// errSecItemNotFound is the exit status of security(1) for a missing item.
+const errSecItemNotFound = 44
+
+func (macKeychain) kind() string { return "keychain" }
+
+func (macKeychain) get(name string) (string, error) {
+	out, err := runSecretCommand("", "security", "find-generic-password", "-s", serviceName, "-a", name, "-w")
+	if exitCode(err) == errSecItemNotFound {
+		return "", errSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// set passes the command on stdin, hex-encoding the value, so the secret
+// never appears in a process listing.
+func (macKeychain) set(name, value string) error {
+	cmd := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", serviceName, name, hex.EncodeToString([]byte(value)))
+	_, err := runSecretCommand(cmd, "security", "-i")
+	return err
+}
+
+func (macKeychain) remove(name string) error {
+	_, err := runSecretCommand("", "security", "delete-generic-password", "-s", serviceName, "-a", name)
+	if exitCode(err) == errSecItemNotFound {
+		return errSecretNotFound
+	}
+	return err
+}
+
+// libsecret keeps secrets in the desktop keyring (GNOME Keyring, KWallet)
+// through secret-tool.
+type libsecret struct{}
+
+func (libsecret) kind() string { return "libsecret" }
+
+func (libsecret) get(name string) (string, error) {
+	out, err := runSecretCommand("", "secret-tool", "lookup", "service", serviceName, "name", name)
+	// secret-tool exits 1 with no output when nothing matches.
+	if exitCode(err) == 1 && len(out) == 0 {
+		return "", errSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (libsecret) set(name, value string) error {
+	_, err := runSecretCommand(value, "secret-tool", "store", "--label="+serviceName+" "+name, "service", serviceName, "name", name)
+	return err
+}
+
+func (s libsecret) remove(name string) error {
+	if _, err := s.get(name); err != nil {
+		return err
+	}
+	_, err := runSecretCommand("", "secret-tool", "clear", "service", serviceName, "name", name)
+	return err
+}
+
+// secretsKDFIterations is the PBKDF2 work factor for new secrets files.
+var secretsKDFIterations = 600_000
+
+// secretsFile keeps secrets in one file, sealed with AES-256-GCM under a
+// key derived from passphrase, or with DPAPI, which ties it to the Windows
+// user account.
+type secretsFile struct {
+	path       string
+	passphrase string
+	dpapi      bool
+	// key caches the key derived for salt.
+	key, salt []byte
+}
+
+// secretsEnvelope is the JSON a passphrase-sealed secrets file holds.
+type secretsEnvelope struct {
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func (f *secretsFile) kind() string {
+	if f.dpapi {
+		return "dpapi"
+	}
+	return "file"
+}
+
+func (f *secretsFile) deriveKey(salt []byte, iterations int) ([]byte, error) {
+	if f.passphrase == "" {
+		return nil, errors.New("the secrets file needs VIEWER_SECRETS_PASSPHRASE")
+	}
+	if f.key == nil || !bytes.Equal(salt, f.salt) {
+		key, err := pbkdf2.Key(sha256.New, f.passphrase, salt, iterations, 32)
+		if err != nil {
+			return nil, err
+		}
+		f.key, f.salt = key, salt
+	}
+	return f.key, nil
+}
+
+// load returns the secrets in the file, and the envelope they came in.
+func (f *secretsFile) load() (map[string]string, *secretsEnvelope, error) {
+	secrets := map[string]string{}
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var plain []byte
+	var env *secretsEnvelope
+	if f.dpapi {
+		if plain, err = unprotectData(data); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		env = &secretsEnvelope{}
+		if err := json.Unmarshal(data, env); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.path, err)
+		}
+		key, err := f.deriveKey(env.Salt, env.Iterations)
+		if err != nil {
+			return nil, nil, err
+		}
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if plain, err = gcm.Open(nil, env.Nonce, env.Data, nil); err != nil {
+			return nil, nil, fmt.Errorf("%s: wrong passphrase or damaged file", f.path)
+		}
+	}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", f.path, err)
+	}
+	return secrets, env, nil
+}
+
+// save seals secrets into the file, keeping the salt of env if there is
+// one so the derived key stays cached.
+func (f *secretsFile) save(secrets map[string]string, env *secretsEnvelope) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if f.dpapi {
+		if data, err = protectData(plain); err != nil {
+			return err
+		}
+	} else {
+		if env == nil {
+			env = &secretsEnvelope{Iterations: secretsKDFIterations, Salt: make([]byte, 16)}
+			rand.Read(env.Salt)
+		}
+		key, err := f.deriveKey(env.Salt, env.Iterations)
+		if err != nil {
+			return err
+		}
+		gcm, err := newGCM(key)
+		if err != nil {
+			return err
+		}
+		env.Nonce = make([]byte, gcm.NonceSize())
+		rand.Read(env.Nonce)
+		env.Data = gcm.Seal(nil, env.Nonce, plain, nil)
+		if data, err = json.MarshalIndent(env, "", "  "); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	if _, err := writeFileAtomic(f.path, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	return os.Chmod(f.path, 0o600)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (f *secretsFile) get(name string) (string, error) {
+	secrets, _, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	v, ok := secrets[name]
+	if !ok {
+		return "", errSecretNotFound
+	}
+	return v, nil
+}
+
+func (f *secretsFile) set(name, value string) error {
+	secrets, env, err := f.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return f.save(secrets, env)
+}
+
+func (f *secretsFile) remove(name string) error {
+	secrets, env, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return errSecretNotFound
+	}
+	delete(secrets, name)
+	return f.save(secrets, env)
+}
+
+// cliSecrets manages the secret store: `secrets set NAME` stores the value
+// read from stdin, `secrets get NAME` prints it and `secrets rm NAME`
+// deletes it. NAME is one of the secretSettings.
+func cliSecrets(c *cli, args []string) int {
+	fs := c.flags("secrets", "set|get|rm NAME")
+	rest, err := c.parse(fs, args)
+	if err != nil {
+		return exitConfig
+	}
+	if len(rest) != 2 {
+		fs.Usage()
+		return exitConfig
+	}
+	action, name := rest[0], strings.ToUpper(rest[1])
+	if _, ok := secretSettings(cfg())[name]; !ok {
+		var names []string
+		for n := range secretSettings(cfg()) {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return c.fail(exitConfig, fmt.Errorf("%s is not a secret setting; secrets: %s", rest[1], strings.Join(names, ", ")))
+	}
+	store, err := openSecretStore(*cfg())
+	if err != nil {
+		return c.fail(exitConfig, err)
+	}
+	res := map[string]string{"name": name, "store": store.kind()}
+	switch action {
+	case "set":
+		value, err := readSecretValue(c.stdin)
+		if err != nil {
+			return c.fail(exitConfig, err)
+		}
+		if err := store.set(name, value); err != nil {
+			return c.fail(exitFailed, err)
+		}
+		c.print(res, func(w io.Writer) { fmt.Fprintf(w, "stored %s in %s\n", name, store.kind()) })
+	case "get":
+		value, err := store.get(name)
+		if err != nil {
+			return c.fail(exitFailed, fmt.Errorf("%s: %w", name, err))
+		}
+		res["value"] = value
+		c.print(res, func(w io.Writer) { fmt.Fprintln(w, value) })
+	case "rm":
+		if err := store.remove(name); err != nil {
+			return c.fail(exitFailed, fmt.Errorf("%s: %w", name, err))
+		}
+		c.print(res, func(w io.Writer) { fmt.Fprintf(w, "removed %s from %s\n", name, store.kind()) })
+	default:
+		fs.Usage()
+		return exitConfig
+	}
+	return exitOK
+}
+
+// readSecretValue reads the first line of r, so a value can be piped in or
+// typed without it showing up in the shell history.
+func readSecretValue(r io.Reader) (string, error) {
+	if r == nil {
+		r = os.Stdin
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("no value on stdin")
+	}
+	return line, nil
+}
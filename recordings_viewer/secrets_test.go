@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useSecretsFile points the secret store at an encrypted file in a temp
+// folder, sealed with passphrase.
+func useSecretsFile(t *testing.T, passphrase string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	t.Setenv("VIEWER_SECRETS_PASSPHRASE", passphrase)
+	useConfig(t, func(c *config) { c.SecretsBackend, c.SecretsFile = "file", path })
+	orig := secretsKDFIterations
+	secretsKDFIterations = 1000
+	t.Cleanup(func() { secretsKDFIterations = orig })
+	return path
+}
+
+func runSecretsCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := runCLI(&cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}, append([]string{"secrets"}, args...))
+	return code, stdout.String(), stderr.String()
+}
+
+func TestSecretsFileRoundTrip(t *testing.T) {
+	path := useSecretsFile(t, "correct horse")
+
+	if code, out, errOut := runSecretsCLI(t, "s3cr3t-key\n", "set", "viewer_s3_secret_key"); code != exitOK || out != "stored VIEWER_S3_SECRET_KEY in file\n" {
+		t.Fatalf("set: %d %q %q", code, out, errOut)
+	}
+	runSecretsCLI(t, "tok\n", "set", "VIEWER_AUTH_TOKEN")
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.Contains(data, []byte("s3cr3t")) {
+		t.Fatalf("file holds the secret in the clear: %s %v", data, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Fatalf("mode=%v", info.Mode())
+	}
+	if code, out, _ := runSecretsCLI(t, "", "get", "VIEWER_S3_SECRET_KEY"); code != exitOK || out != "s3cr3t-key\n" {
+		t.Fatalf("get: %d %q", code, out)
+	}
+
+	// Stored secrets fill in what the environment and config leave out.
+	c := *cfg()
+	c.AuthToken = "from-env"
+	applyStoredSecrets(&c)
+	if c.S3.SecretKey != "s3cr3t-key" || c.AuthToken != "from-env" || c.WebhookSecret != "" {
+		t.Fatalf("config=%+v", c)
+	}
+
+	if code, _, _ := runSecretsCLI(t, "", "rm", "VIEWER_S3_SECRET_KEY"); code != exitOK {
+		t.Fatalf("rm: %d", code)
+	}
+	if code, _, errOut := runSecretsCLI(t, "", "get", "VIEWER_S3_SECRET_KEY"); code != exitFailed || !strings.Contains(errOut, "not found") {
+		t.Fatalf("get after rm: %d %q", code, errOut)
+	}
+
+	t.Setenv("VIEWER_SECRETS_PASSPHRASE", "wrong")
+	if code, _, errOut := runSecretsCLI(t, "", "get", "VIEWER_AUTH_TOKEN"); code != exitFailed || !strings.Contains(errOut, "wrong passphrase") {
+		t.Fatalf("wrong passphrase: %d %q", code, errOut)
+	}
+}
+
+func TestSecretsCLIRejectsUsage(t *testing.T) {
+	useSecretsFile(t, "pw")
+	for _, args := range [][]string{{"set", "VIEWER_LISTEN"}, {"get"}, {"list", "VIEWER_AUTH_TOKEN"}} {
+		if code, _, _ := runSecretsCLI(t, "x\n", args...); code != exitConfig {
+			t.Errorf("%v: code=%d", args, code)
+		}
+	}
+	if code, _, errOut := runSecretsCLI(t, "\n", "set", "VIEWER_AUTH_TOKEN"); code != exitConfig || !strings.Contains(errOut, "no value") {
+		t.Fatalf("empty value: %d %q", code, errOut)
+	}
+}
+
+func TestSecretsUseMacKeychain(t *testing.T) {
+	origOS, origRun := hostOS, runSecretCommand
+	t.Cleanup(func() { hostOS, runSecretCommand = origOS, origRun })
+	hostOS = "darwin"
+	useConfig(t, func(c *config) { c.SecretsBackend = "keychain" })
+	notFound := exec.Command("sh", "-c", "exit 44").Run()
+	keychain := map[string]string{}
+	runSecretCommand = func(stdin, name string, args ...string) ([]byte, error) {
+		if name != "security" {
+			t.Fatalf("ran %s", name)
+		}
+		switch args[0] {
+		case "-i":
+			f := strings.Fields(stdin)
+			if len(f) != 8 || f[0] != "add-generic-password" || f[3] != serviceName {
+				t.Fatalf("stdin=%q", stdin)
+			}
+			v, _ := hex.DecodeString(f[7])
+			keychain[f[5]] = string(v)
+		case "find-generic-password":
+			if v, ok := keychain[argAfter(args, "-a")]; ok {
+				return []byte(v + "\n"), nil
+			}
+			return nil, notFound
+		case "delete-generic-password":
+			if _, ok := keychain[argAfter(args, "-a")]; !ok {
+				return nil, notFound
+			}
+			delete(keychain, argAfter(args, "-a"))
+		}
+		return nil, nil
+	}
+
+	if code, out, _ := runSecretsCLI(t, "hook secret\n", "set", "VIEWER_WEBHOOK_SECRET"); code != exitOK || out != "stored VIEWER_WEBHOOK_SECRET in keychain\n" {
+		t.Fatalf("set: %d %q", code, out)
+	}
+	c := *cfg()
+	applyStoredSecrets(&c)
+	if c.WebhookSecret != "hook secret" {
+		t.Fatalf("webhook secret=%q", c.WebhookSecret)
+	}
+	if code, _, _ := runSecretsCLI(t, "", "rm", "VIEWER_WEBHOOK_SECRET"); code != exitOK {
+		t.Fatalf("rm: %d", code)
+	}
+	if _, err := (macKeychain{}).get("VIEWER_WEBHOOK_SECRET"); !errors.Is(err, errSecretNotFound) {
+		t.Fatalf("get after rm: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+var errNoDPAPI = errors.New("DPAPI is only available on Windows")
+
+func protectData([]byte) ([]byte, error) { return nil, errNoDPAPI }
+
+func unprotectData([]byte) ([]byte, error) { return nil, errNoDPAPI }
@@ -0,0 +1,47 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// dataBlob is the DATA_BLOB the DPAPI functions take and return.
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+// cryptprotectUIForbidden fails rather than prompting the user.
+const cryptprotectUIForbidden = 0x1
+
+var crypt32 = syscall.NewLazyDLL("crypt32.dll")
+
+// protectData encrypts data for the current Windows user with DPAPI.
+func protectData(data []byte) ([]byte, error) {
+	return dpapi("CryptProtectData", data)
+}
+
+// unprotectData decrypts what protectData returned.
+func unprotectData(data []byte) ([]byte, error) {
+	return dpapi("CryptUnprotectData", data)
+}
+
+// dpapi calls CryptProtectData or CryptUnprotectData, which share their
+// parameter layout, on data.
+func dpapi(proc string, data []byte) ([]byte, error) {
+	in := dataBlob{size: uint32(len(data))}
+	if len(data) > 0 {
+		in.data = &data[0]
+	}
+	var out dataBlob
+	r, _, callErr := crypt32.NewProc(proc).Call(uintptr(unsafe.Pointer(&in)), 0, 0, 0, 0,
+		cryptprotectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("%s: %w", proc, callErr)
+	}
+	defer syscall.LocalFree(syscall.Handle(unsafe.Pointer(out.data)))
+	return append([]byte(nil), unsafe.Slice(out.data, out.size)...), nil
+}
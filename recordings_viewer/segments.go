@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// segmentPatch is the body of PATCH /api/transcripts/{path}/segments/{n}.
+// Omitted fields keep their value.
+type segmentPatch struct {
+	Text  *string  `json:"text"`
+	Start *float64 `json:"start"`
+	End   *float64 `json:"end"`
+}
+
+var (
+	errNoSegment     = errors.New("no such segment")
+	errInvalidTiming = errors.New("invalid timing")
+)
+
+// splitSegmentPath splits "{path}/segments/{n}" into the recording path and
+// the segment index.
+func splitSegmentPath(rel string) (string, int, bool) {
+	i := strings.LastIndex(rel, "/segments/")
+	if i <= 0 {
+		return "", 0, false
+	}
+	digits := rel[i+len("/segments/"):]
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return "", 0, false
+	}
+	return rel[:i], n, true
+}
+
+// patchSegment applies p to segment n (counted from 0) of the recording's
+// whisper JSON and rewrites the top-level text to match. Fields the server
+// does not know, such as whisper's tokens and probabilities, are kept.
+// Callers hold mu.
+func patchSegment(fullPath string, n int, p segmentPatch) (segment, error) {
+	jsonPath := transcriptJSONPath(fullPath)
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return segment{}, err
+	}
+	var doc map[string]json.RawMessage
+	var segs []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return segment{}, fmt.Errorf("%s: %w", jsonPath, err)
+	}
+	if err := json.Unmarshal(doc["segments"], &segs); err != nil || n >= len(segs) {
+		return segment{}, errNoSegment
+	}
+
+	var cur segment
+	raw, _ := json.Marshal(segs[n])
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return segment{}, err
+	}
+	if p.Text != nil {
+		cur.Text = *p.Text
+	}
+	if p.Start != nil {
+		cur.Start = *p.Start
+	}
+	if p.End != nil {
+		cur.End = *p.End
+	}
+	if cur.Start < 0 || cur.End < cur.Start {
+		return segment{}, fmt.Errorf("%w: start %g, end %g", errInvalidTiming, cur.Start, cur.End)
+	}
+	if p.Text != nil {
+		// Whisper's probabilities describe the text it heard, not the
+		// correction; see readConfidence.
+		segs[n]["edited"] = json.RawMessage("true")
+	}
+	segs[n]["text"], _ = json.Marshal(cur.Text)
+	segs[n]["start"], _ = json.Marshal(cur.Start)
+	segs[n]["end"], _ = json.Marshal(cur.End)
+
+	// Whisper's text is its segments' texts run together.
+	var text strings.Builder
+	for _, s := range segs {
+		var t string
+		json.Unmarshal(s["text"], &t)
+		text.WriteString(t)
+	}
+	doc["text"], _ = json.Marshal(text.String())
+	if doc["segments"], err = json.Marshal(segs); err != nil {
+		return segment{}, err
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return segment{}, err
+	}
+	if _, err := writeFileAtomic(jsonPath, strings.NewReader(string(out))); err != nil {
+		return segment{}, err
+	}
+	return cur, nil
+}
+
+// segmentHandler serves PATCH /api/transcripts/{path}/segments/{n} with
+// {"text": ..., "start": ..., "end": ...} to edit one segment of the JSON
+// transcript without uploading the whole file. It responds with the segment
+// as saved.
+func segmentHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		http.Error(w, "invalid segment number", http.StatusBadRequest)
+		return
+	}
+	var p segmentPatch
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "invalid JSON body", bodyErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+	if p.Text == nil && p.Start == nil && p.End == nil {
+		http.Error(w, "text, start or end required", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	jsonPath := transcriptJSONPath(absPath(rel))
+	before, _ := currentSHA256(jsonPath)
+	seg, err := patchSegment(absPath(rel), n, p)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "no JSON transcript", http.StatusNotFound)
+		return
+	case errors.Is(err, errNoSegment):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errInvalidTiming):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRel, _ := relPath(jsonPath)
+	after, _ := currentSHA256(jsonPath)
+	auditChange(r, "file.updated", jsonRel, map[string]any{"before": before, "after": after, "segment": n})
+	requestLogger(r).Info("updated segment", "path", jsonRel, "segment", n)
+	publishEvent("transcript.updated", jsonRel, map[string]any{"segment": n})
+	regenerateAfterChange(jsonRel)
+	queueKeywordsJob(jsonRel)
+	writeJSON(w, seg)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const segmentsFixture = `{"text":" Hello there. General Kenobi.","language":"en","segments":[` +
+	`{"id":0,"start":0,"end":1.5,"text":" Hello there.","avg_logprob":-0.2},` +
+	`{"id":1,"start":1.5,"end":3,"text":" General Kenobi.","avg_logprob":-0.4}]}`
+
+func patchSegmentRequest(t *testing.T, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestPatchSegment(t *testing.T) {
+	dir := useTempBaseDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "call.json"), []byte(segmentsFixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any file of the recording names it.
+	rec := patchSegmentRequest(t, "/api/transcripts/call.webm/segments/1", `{"text":" General Grievous.","end":3.25}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var seg segment
+	json.NewDecoder(rec.Body).Decode(&seg)
+	if seg != (segment{ID: 1, Start: 1.5, End: 3.25, Text: " General Grievous."}) {
+		t.Fatalf("segment = %+v", seg)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "call.json"))
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["text"] != " Hello there. General Grievous." || doc["language"] != "en" {
+		t.Fatalf("doc = %v", doc)
+	}
+	segs := doc["segments"].([]any)
+	second := segs[1].(map[string]any)
+	if second["avg_logprob"] != -0.4 || second["start"] != 1.5 {
+		t.Fatalf("unknown fields or untouched timing lost: %v", second)
+	}
+	if first := segs[0].(map[string]any); first["text"] != " Hello there." {
+		t.Fatalf("other segment changed: %v", first)
+	}
+}
+
+func TestPatchSegmentErrors(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "plain.txt")
+	if err := os.WriteFile(filepath.Join(dir, "call.json"), []byte(segmentsFixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		target, body string
+		want         int
+	}{
+		{"/api/transcripts/call.json/segments/2", `{"text":"x"}`, http.StatusNotFound},
+		{"/api/transcripts/plain.txt/segments/0", `{"text":"x"}`, http.StatusNotFound},
+		{"/api/transcripts/call.json/segments/0", `{"start":2}`, http.StatusBadRequest},
+		{"/api/transcripts/call.json/segments/0", `{}`, http.StatusBadRequest},
+		{"/api/transcripts/call.json/segments/0", `not json`, http.StatusBadRequest},
+	} {
+		if rec := patchSegmentRequest(t, tc.target, tc.body); rec.Code != tc.want {
+			t.Errorf("PATCH %s %s = %d, want %d", tc.target, tc.body, rec.Code, tc.want)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "call.json"))
+	if string(data) != segmentsFixture {
+		t.Fatalf("failed patches changed the transcript: %s", data)
+	}
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/transcripts/call.json/segments/0", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+const serviceName = "recordings-viewer"
+
+// serviceSpec describes how to register the server to start on login for one
+// platform: where the definition file goes, its contents, and the commands
+// that (de)activate it.
+type serviceSpec struct {
+	File      string
+	Contents  string
+	Install   [][]string
+	Uninstall [][]string
+}
+
+// serviceFuncs quote values for the definition files: systemd's own
+// quoting for unit settings, XML escaping for launchd's plist.
+var serviceFuncs = template.FuncMap{
+	"systemd": systemdQuote,
+	"xml": func(s string) (string, error) {
+		var b strings.Builder
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+}
+
+var systemdUnit = template.Must(template.New("systemd").Funcs(serviceFuncs).Parse(`[Unit]
+Description=Recordings viewer server
+After=network.target
+
+[Service]
+ExecStart={{range $i, $a := .Args}}{{if $i}} {{end}}{{systemd $a}}{{end}}
+WorkingDirectory={{systemd .Dir}}
+Restart=on-failure
+KillSignal=SIGTERM
+TimeoutStopSec=35
+
+[Install]
+WantedBy=default.target
+`))
+
+var launchdPlist = template.Must(template.New("launchd").Funcs(serviceFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{{xml .Label}}</string>
+  <key>ProgramArguments</key>
+  <array>
+{{- range .Args}}
+    <string>{{xml .}}</string>
+{{- end}}
+  </array>
+  <key>WorkingDirectory</key>
+  <string>{{xml .Dir}}</string>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <true/>
+</dict>
+</plist>
+`))
+
+// systemdQuote quotes s as one word of a unit setting, so paths with
+// spaces, quotes or specifiers survive.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
+
+// serviceArgs are the server's flags for a service: the config file and
+// recordings folder, as absolute paths, so it does not depend on the
+// directory or environment it is started in.
+func serviceArgs(configPath, dir string) []string {
+	var args []string
+	if configPath != "" {
+		args = append(args, "-config", configPath)
+	}
+	return append(args, "-dir", dir)
+}
+
+// buildServiceSpec returns the login service definition for goos that runs
+// exe with args. Windows has no user-level service manager in the standard
+// library, so a logon scheduled task is used instead.
+func buildServiceSpec(goos, exe, home string, args []string) (serviceSpec, error) {
+	data := struct {
+		Args       []string
+		Dir, Label string
+	}{append([]string{exe}, args...), filepath.Dir(exe), "com.example." + serviceName}
+	var buf bytes.Buffer
+	switch goos {
+	case "linux":
+		if err := systemdUnit.Execute(&buf, data); err != nil {
+			return serviceSpec{}, err
+		}
+		return serviceSpec{
+			File:      filepath.Join(home, ".config", "systemd", "user", serviceName+".service"),
+			Contents:  buf.String(),
+			Install:   [][]string{{"systemctl", "--user", "daemon-reload"}, {"systemctl", "--user", "enable", "--now", serviceName}},
+			Uninstall: [][]string{{"systemctl", "--user", "disable", "--now", serviceName}},
+		}, nil
+	case "darwin":
+		if err := launchdPlist.Execute(&buf, data); err != nil {
+			return serviceSpec{}, err
+		}
+		file := filepath.Join(home, "Library", "LaunchAgents", data.Label+".plist")
+		return serviceSpec{
+			File:      file,
+			Contents:  buf.String(),
+			Install:   [][]string{{"launchctl", "load", "-w", file}},
+			Uninstall: [][]string{{"launchctl", "unload", "-w", file}},
+		}, nil
+	case "windows":
+		quoted := make([]string, len(data.Args))
+		for i, a := range data.Args {
+			quoted[i] = `"` + a + `"`
+		}
+		return serviceSpec{
+			Install:   [][]string{{"schtasks", "/Create", "/F", "/SC", "ONLOGON", "/TN", serviceName, "/TR", strings.Join(quoted, " ")}},
+			Uninstall: [][]string{{"schtasks", "/Delete", "/F", "/TN", serviceName}},
+		}, nil
+	default:
+		return serviceSpec{}, fmt.Errorf("service install not supported on %s", goos)
+	}
+}
+
+// runServiceCommand implements `viewer_server service install|uninstall|print`
+// and returns the process exit code: exitConfig for bad usage or config,
+// exitFailed when a step fails. The service is given -config and -dir: the
+// flags' values, or VIEWER_CONFIG and the recordings folder the server
+// would use now.
+func runServiceCommand(args []string) int {
+	fs := flag.NewFlagSet("service", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("VIEWER_CONFIG"), "TOML config file for the service")
+	dir := fs.String("dir", "", "recordings folder for the service")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: viewer_server service [-config file] [-dir folder] install|uninstall|print")
+	}
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return exitConfig
+	}
+	if *configPath != "" {
+		abs, err := filepath.Abs(*configPath)
+		if err == nil {
+			err = loadConfigFile(abs)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitConfig
+		}
+		*configPath = abs
+	}
+	if *dir == "" {
+		*dir = recordingsDirSetting()
+	}
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	spec, err := buildServiceSpec(runtime.GOOS, exe, home, serviceArgs(*configPath, absDir))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	switch fs.Arg(0) {
+	case "print":
+		if spec.File != "" {
+			fmt.Printf("# %s\n%s", spec.File, spec.Contents)
+		}
+		for _, c := range spec.Install {
+			fmt.Println(c)
+		}
+		return exitOK
+	case "install":
+		if spec.File != "" {
+			if err := os.MkdirAll(filepath.Dir(spec.File), 0o755); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailed
+			}
+			if err := os.WriteFile(spec.File, []byte(spec.Contents), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailed
+			}
+			fmt.Printf("wrote %s\n", spec.File)
+		}
+		return runServiceSteps(spec.Install)
+	case "uninstall":
+		code := runServiceSteps(spec.Uninstall)
+		if spec.File != "" {
+			if err := os.Remove(spec.File); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailed
+			}
+		}
+		return code
+	default:
+		fs.Usage()
+		return exitConfig
+	}
+}
+
+func runServiceSteps(steps [][]string) int {
+	for _, step := range steps {
+		out, err := runCommandFunc(context.Background(), step[0], step[1:]...)
+		os.Stdout.Write(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", step, err)
+			return exitFailed
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBuildServiceSpecPerPlatform(t *testing.T) {
+	exe := "/opt/my viewer/viewer_server"
+	args := serviceArgs("/etc/viewer & co.toml", "/data/100% recordings")
+	linux, err := buildServiceSpec("linux", exe, "/home/me", args)
+	if err != nil {
+		t.Fatalf("linux: %v", err)
+	}
+	if linux.File != "/home/me/.config/systemd/user/recordings-viewer.service" ||
+		!strings.Contains(linux.Contents, `ExecStart="/opt/my viewer/viewer_server" "-config" "/etc/viewer & co.toml" "-dir" "/data/100%% recordings"`+"\n") {
+		t.Fatalf("linux spec=%+v", linux)
+	}
+
+	darwin, err := buildServiceSpec("darwin", exe, "/Users/me", args)
+	if err != nil {
+		t.Fatalf("darwin: %v", err)
+	}
+	if !strings.HasSuffix(darwin.File, "LaunchAgents/com.example.recordings-viewer.plist") ||
+		!strings.Contains(darwin.Contents, "<string>"+exe+"</string>\n    <string>-config</string>\n    <string>/etc/viewer &amp; co.toml</string>\n    <string>-dir</string>") {
+		t.Fatalf("darwin spec=%+v", darwin)
+	}
+
+	windows, err := buildServiceSpec("windows", exe, `C:\Users\me`, serviceArgs("", `D:\rec`))
+	if err != nil {
+		t.Fatalf("windows: %v", err)
+	}
+	if windows.File != "" || windows.Install[0][0] != "schtasks" || windows.Install[0][len(windows.Install[0])-1] != `"/opt/my viewer/viewer_server" "-dir" "D:\rec"` {
+		t.Fatalf("windows spec=%+v", windows)
+	}
+
+	if _, err := buildServiceSpec("plan9", exe, "/", args); err == nil {
+		t.Fatalf("expected unsupported platform error")
+	}
+}
+
+func TestRunServiceCommandInstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install writes a unit file only on linux/darwin")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	var ran [][]string
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		ran = append(ran, append([]string{name}, args...))
+		return nil, nil
+	})
+
+	dir := t.TempDir()
+	if code := runServiceCommand([]string{"-dir", dir, "install"}); code != 0 {
+		t.Fatalf("exit code=%d", code)
+	}
+	exe, _ := os.Executable()
+	spec, _ := buildServiceSpec(runtime.GOOS, exe, home, serviceArgs("", dir))
+	if data, err := os.ReadFile(spec.File); err != nil || string(data) != spec.Contents {
+		t.Fatalf("service file not written: %v", err)
+	}
+	if len(ran) != len(spec.Install) {
+		t.Fatalf("ran=%v want %v", ran, spec.Install)
+	}
+	if !strings.HasPrefix(spec.File, filepath.Clean(home)) {
+		t.Fatalf("service file %s outside HOME", spec.File)
+	}
+
+	for _, args := range [][]string{{"bogus"}, {"-bogus", "install"}, {}} {
+		if code := runServiceCommand(args); code != exitConfig {
+			t.Errorf("%q exit code=%d want %d", args, code, exitConfig)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// sessionQuery selects sessions with a search string such as
+// `tag:interview after:2024-01 field:client=Acme "budget review"`. Filters of the same kind
+// must all match, except lang:, where any one does.
+type sessionQuery struct {
+	Tags      []string
+	Topics    []string
+	Langs     []string
+	Workspace string
+	Fields    []fieldFilter
+	// After and Before are date prefixes (YYYY, YYYY-MM or YYYY-MM-DD)
+	// compared with the day the session was recorded: After matches that
+	// period and everything later, Before everything earlier, and Day only
+	// that period.
+	After, Before, Day string
+	// Text terms must each appear in the session ID or its transcript,
+	// ignoring case.
+	Text []string
+}
+
+// queryDateLayouts are the accepted forms of after:, before: and day:.
+var queryDateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+// parseSessionQuery parses a search string. Words of the form key:value
+// are filters; everything else, including "quoted phrases", is text.
+func parseSessionQuery(q string) (sessionQuery, error) {
+	var sq sessionQuery
+	words, err := splitQuery(q)
+	if err != nil {
+		return sq, err
+	}
+	for _, w := range words {
+		key, value, ok := strings.Cut(w, ":")
+		if !ok || !isQueryKey(key) {
+			sq.Text = append(sq.Text, strings.ToLower(w))
+			continue
+		}
+		key = strings.ToLower(key)
+		if value == "" {
+			return sq, fmt.Errorf("%s: needs a value", key)
+		}
+		switch key {
+		case "tag":
+			sq.Tags = append(sq.Tags, value)
+		case "topic":
+			sq.Topics = append(sq.Topics, value)
+		case "lang":
+			sq.Langs = append(sq.Langs, value)
+		case "field":
+			ff, err := parseFieldFilter(value)
+			if err != nil {
+				return sq, err
+			}
+			sq.Fields = append(sq.Fields, ff)
+		case "workspace":
+			ws, ok := findWorkspace(value)
+			if !ok {
+				return sq, fmt.Errorf("unknown workspace %q", value)
+			}
+			sq.Workspace = ws.Name
+		case "after", "before", "day":
+			if !validQueryDate(value) {
+				return sq, fmt.Errorf("%s:%s: want YYYY, YYYY-MM or YYYY-MM-DD", key, value)
+			}
+			switch key {
+			case "after":
+				sq.After = value
+			case "before":
+				sq.Before = value
+			default:
+				sq.Day = value
+			}
+		default:
+			return sq, fmt.Errorf("unknown filter %q (want tag, topic, lang, field, workspace, after, before or day)", key)
+		}
+	}
+	return sq, nil
+}
+
+// isQueryKey reports whether key looks like a filter name rather than part
+// of the text, so "10:30" stays a search term.
+func isQueryKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitQuery splits q at spaces outside double quotes and drops the
+// quotes, so both "two words" and tag:"two words" are one word.
+func splitQuery(q string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	quoted, inWord := false, false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord && cur.Len() > 0 {
+				words = append(words, cur.String())
+			}
+			cur.Reset()
+			inWord = false
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", q)
+	}
+	if cur.Len() > 0 {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+func validQueryDate(value string) bool {
+	for _, layout := range queryDateLayouts {
+		if _, err := time.Parse(layout, value); err == nil && len(value) == len(layout) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether s passes every filter. Transcripts are only read
+// when the query has text terms and the cheaper filters passed.
+func (q sessionQuery) matches(s *session) bool {
+	day := s.RecordedDay
+	switch {
+	case q.After != "" && day < q.After:
+		return false
+	case q.Before != "" && day >= q.Before:
+		return false
+	case q.Day != "" && !strings.HasPrefix(day, q.Day):
+		return false
+	case !inWorkspace(s.ID, q.Workspace):
+		return false
+	case !hasAllTags(s.Tags, q.Tags) || !hasAllTags(s.Topics, q.Topics):
+		return false
+	case !matchesLanguage(s.Language, q.Langs) || !matchesFields(s.Fields, q.Fields):
+		return false
+	}
+	if len(q.Text) == 0 {
+		return true
+	}
+	haystack := strings.ToLower(s.ID) + "\n" + strings.ToLower(sessionText(s))
+	if s.Source != nil {
+		haystack += "\n" + strings.ToLower(s.Source.Title+"\n"+s.Source.URL)
+	}
+	if c := s.Calendar; c != nil {
+		haystack += "\n" + strings.ToLower(c.Title)
+		for _, a := range c.Attendees {
+			haystack += "\n" + strings.ToLower(a.Name+" "+a.Email)
+		}
+	}
+	for _, t := range q.Text {
+		if !strings.Contains(haystack, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionText returns the session's transcript text, or "" when it has
+// none or it cannot be read.
+func sessionText(s *session) string {
+	src := s.TranscriptJSON
+	if src == "" {
+		src = s.Transcript
+	}
+	if src == "" {
+		return ""
+	}
+	doc, err := loadTranscriptDoc(absPath(src))
+	if err != nil {
+		return ""
+	}
+	if doc.Text != "" {
+		return doc.Text
+	}
+	texts := make([]string, len(doc.Segments))
+	for i, seg := range doc.Segments {
+		texts[i] = seg.Text
+	}
+	return strings.Join(texts, " ")
+}
+
+// selectSessions resolves the sessions an export request names by ID and
+// those matching query, in that order and each once. The status goes with
+// a non-nil error.
+func selectSessions(ids []string, query string) ([]*session, int, error) {
+	var sessions []*session
+	picked := map[string]bool{}
+	for _, id := range ids {
+		s, err := findSession(id)
+		if err != nil {
+			return nil, http.StatusNotFound, fmt.Errorf("session not found: %s", id)
+		}
+		if !picked[s.ID] {
+			picked[s.ID] = true
+			sessions = append(sessions, s)
+		}
+	}
+	if query == "" {
+		return sessions, http.StatusOK, nil
+	}
+	q, err := parseSessionQuery(query)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	all, err := scanSessions()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	for i := range all {
+		if s := &all[i]; !picked[s.ID] && q.matches(s) {
+			picked[s.ID] = true
+			sessions = append(sessions, s)
+		}
+	}
+	if len(sessions) == 0 {
+		return nil, http.StatusNotFound, fmt.Errorf("no sessions match the query")
+	}
+	return sessions, http.StatusOK, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSessionQuery(t *testing.T) {
+	q, err := parseSessionQuery(`tag:interview Tag:"acme corp" after:2024-01 before:2024-06-15 lang:en lang:ja "Budget review" 10:30`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sessionQuery{
+		Tags:   []string{"interview", "acme corp"},
+		Langs:  []string{"en", "ja"},
+		After:  "2024-01",
+		Before: "2024-06-15",
+		Text:   []string{"budget review", "10:30"},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Fatalf("query = %+v, want %+v", q, want)
+	}
+
+	for _, bad := range []string{"after:2024-1", "day:May", "tag:", "color:red", `"open`, "workspace:nowhere"} {
+		if _, err := parseSessionQuery(bad); err == nil {
+			t.Errorf("parseSessionQuery(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSessionQueryMatches(t *testing.T) {
+	s := &session{ID: "2024/standup", RecordedDay: "2024-03-04", Tags: []string{"interview", "acme"}, Language: "en"}
+	cases := map[string]bool{
+		"":                             true,
+		"tag:interview tag:acme":       true,
+		"tag:interview tag:other":      false,
+		"after:2024-03 before:2024-04": true,
+		"after:2024-03-05":             false,
+		"before:2024-03-04":            false,
+		"day:2024-03":                  true,
+		"day:2024-03-05":               false,
+		"lang:ja lang:en":              true,
+		"STANDUP":                      true,
+		"standup retro":                false,
+		"after:2024 tag:acme lang:fr":  false,
+	}
+	for raw, want := range cases {
+		q, err := parseSessionQuery(raw)
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		if got := q.matches(s); got != want {
+			t.Errorf("%q matches = %v, want %v", raw, got, want)
+		}
+	}
+}
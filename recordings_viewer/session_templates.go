@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// languageCodePattern matches the ISO 639-1 codes whisper's --language
+// takes.
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// sessionTemplate is how a kind of recurring recording, such as a weekly
+// standup, is processed: the tags and project it is filed under, the
+// model and language it is transcribed with, and the prompt its summary
+// is written with.
+type sessionTemplate struct {
+	Tags          []string `json:"tags,omitempty"`
+	Project       string   `json:"project,omitempty"`
+	Model         string   `json:"model,omitempty"`
+	Language      string   `json:"language,omitempty"`
+	SummaryPrompt string   `json:"summaryPrompt,omitempty"`
+}
+
+func (t *sessionTemplate) validate() error {
+	t.Tags = normalizeTags(t.Tags)
+	t.Project = strings.TrimSpace(t.Project)
+	t.Model = strings.TrimSpace(t.Model)
+	t.Language = strings.ToLower(strings.TrimSpace(t.Language))
+	t.SummaryPrompt = strings.TrimSpace(t.SummaryPrompt)
+	if _, ok := findWhisperModel(t.Model); t.Model != "" && !ok {
+		return fmt.Errorf("unknown model %q", t.Model)
+	}
+	if t.Language != "" && !languageCodePattern.MatchString(t.Language) {
+		return fmt.Errorf("language %q is not a language code such as \"en\"", t.Language)
+	}
+	return nil
+}
+
+// tags returns the tags the template gives a recording; the project is
+// the tag "project:{project}", as project rules give it.
+func (t sessionTemplate) tags() []string {
+	tags := slices.Clone(t.Tags)
+	if t.Project != "" {
+		tags = append(tags, "project:"+t.Project)
+	}
+	return tags
+}
+
+// templateInfo is the template a recording was made with, as it was
+// then: editing a template changes the recordings made after.
+type templateInfo struct {
+	Name          string    `json:"name"`
+	Model         string    `json:"model,omitempty"`
+	Language      string    `json:"language,omitempty"`
+	SummaryPrompt string    `json:"summaryPrompt,omitempty"`
+	AppliedAt     time.Time `json:"appliedAt"`
+}
+
+func sessionTemplatesPath() string {
+	return filepath.Join(stateDir(), "session-templates.json")
+}
+
+// loadSessionTemplates reads the templates by name. Callers hold mu.
+func loadSessionTemplates() (map[string]sessionTemplate, error) {
+	items := map[string]sessionTemplate{}
+	data, err := os.ReadFile(sessionTemplatesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func saveSessionTemplates(items map[string]sessionTemplate) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(sessionTemplatesPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// errUnknownTemplate is returned for a template name that is not saved.
+var errUnknownTemplate = errors.New("unknown session template")
+
+// findSessionTemplate returns the template called name. Callers hold mu.
+func findSessionTemplate(name string) (sessionTemplate, error) {
+	items, err := loadSessionTemplates()
+	if err != nil {
+		return sessionTemplate{}, err
+	}
+	t, ok := items[name]
+	if !ok {
+		return sessionTemplate{}, fmt.Errorf("%w %q", errUnknownTemplate, name)
+	}
+	return t, nil
+}
+
+// sessionTemplateHeader reads the optional X-Session-Template header the
+// extension sends with a recording, checking the template exists. Callers
+// hold mu.
+func sessionTemplateHeader(r *http.Request) (string, error) {
+	name := strings.TrimSpace(r.Header.Get("X-Session-Template"))
+	if name == "" {
+		return "", nil
+	}
+	if _, err := findSessionTemplate(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// templateStatus is the status of a failed template lookup: 400 for an
+// unknown template.
+func templateStatus(err error) int {
+	if errors.Is(err, errUnknownTemplate) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// apply files meta under t, called name: it adds the template's tags and
+// keeps the rest for when the recording is transcribed.
+func (t sessionTemplate) apply(meta *recordingMeta, name string) {
+	meta.Tags = normalizeTags(append(meta.Tags, t.tags()...))
+	meta.Template = &templateInfo{Name: name, Model: t.Model, Language: t.Language, SummaryPrompt: t.SummaryPrompt, AppliedAt: time.Now().UTC()}
+}
+
+// applySessionTemplate files the recording at fullPath under the template
+// called name. Callers hold mu.
+func applySessionTemplate(fullPath, name string) error {
+	t, err := findSessionTemplate(name)
+	if err != nil {
+		return err
+	}
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		return err
+	}
+	t.apply(&meta, name)
+	return saveMeta(fullPath, meta)
+}
+
+// recordingTemplate returns the template the recording at rel was made
+// with, if any.
+func recordingTemplate(rel string) *templateInfo {
+	meta, err := loadMeta(absPath(rel))
+	if err != nil {
+		return nil
+	}
+	return meta.Template
+}
+
+// summarizeAfterTranscription queues a summary of the session of the
+// recording at rel when its template has a summary prompt, so the
+// recording is summarized without VIEWER_REGENERATE_STALE.
+func summarizeAfterTranscription(rel string) {
+	t := recordingTemplate(rel)
+	if t == nil || t.SummaryPrompt == "" || len(cfg().SummaryCommand) == 0 || cfg().ReadOnly {
+		return
+	}
+	s, err := findSession(rel)
+	if err != nil {
+		return
+	}
+	target := s.ID + ".summary.md"
+	if a, ok := s.Artifacts[artifactSummary]; ok {
+		target = a.Path
+	}
+	if jobs.pending("regenerate", target) {
+		return
+	}
+	j := &job{ID: randomID(), Type: "regenerate", Path: target, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path, "template", t.Name)
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+}
+
+// summaryCommand returns cfg.SummaryCommand for the transcript at src with
+// {prompt} replaced by the summary prompt of its session template. An
+// argument that is only {prompt} is dropped when there is none.
+func summaryCommand(src string) []string {
+	prompt := ""
+	if t := recordingTemplate(src); t != nil {
+		prompt = t.SummaryPrompt
+	}
+	var out []string
+	for _, arg := range cfg().SummaryCommand {
+		if arg == "{prompt}" && prompt == "" {
+			continue
+		}
+		out = append(out, strings.ReplaceAll(arg, "{prompt}", prompt))
+	}
+	return out
+}
+
+type namedSessionTemplate struct {
+	Name string `json:"name"`
+	sessionTemplate
+}
+
+// sessionTemplatesHandler serves GET /api/session-templates and
+// GET/PUT/DELETE /api/session-templates/{name}.
+func sessionTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/session-templates"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		items, err := loadSessionTemplates()
+		mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list := []namedSessionTemplate{}
+		for n, t := range items {
+			list = append(list, namedSessionTemplate{Name: n, sessionTemplate: t})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		writeJSON(w, list)
+		return
+	}
+	if !profileNamePattern.MatchString(name) {
+		http.Error(w, "invalid template name", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	items, err := loadSessionTemplates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		t, ok := items[name]
+		if !ok {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, namedSessionTemplate{Name: name, sessionTemplate: t})
+	case http.MethodPut:
+		var t sessionTemplate
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := t.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items[name] = t
+		if err := saveSessionTemplates(items); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, namedSessionTemplate{Name: name, sessionTemplate: t})
+	case http.MethodDelete:
+		if _, ok := items[name]; !ok {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		delete(items, name)
+		if err := saveSessionTemplates(items); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func putSessionTemplate(t *testing.T, name, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/session-templates/"+name, strings.NewReader(body)))
+	return rec
+}
+
+func TestSessionTemplatesCRUD(t *testing.T) {
+	useTempBaseDir(t)
+	rec := putSessionTemplate(t, "standup", `{"tags": [" meeting", "meeting", ""], "project": " acme ", "model": "small", "language": "DE", "summaryPrompt": "List the action items."}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	putSessionTemplate(t, "1-on-1", `{"tags": ["private"]}`)
+
+	for name, body := range map[string]string{
+		"bad-model":    `{"model": "huge"}`,
+		"bad-language": `{"language": "German"}`,
+		"-dash":        `{}`,
+		"bad-json":     `{`,
+	} {
+		if rec := putSessionTemplate(t, name, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s %s: %d", name, body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/session-templates", nil))
+	var list []namedSessionTemplate
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list) != 2 || list[0].Name != "1-on-1" || list[1].Project != "acme" || list[1].Language != "de" || !reflect.DeepEqual(list[1].Tags, []string{"meeting"}) {
+		t.Fatalf("list = %+v", list)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/session-templates/1-on-1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/session-templates/1-on-1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("GET deleted: %d", rec.Code)
+	}
+}
+
+func TestSessionTemplateAppliesToRecording(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	useConfig(t, func(c *config) { c.SummaryCommand = []string{"summarize", "{src}", "{prompt}"} })
+	putSessionTemplate(t, "standup", `{"tags": ["meeting"], "project": "acme", "model": "small", "language": "de", "summaryPrompt": "List the action items."}`)
+	var summarized []string
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ffprobe":
+			return []byte("60"), nil
+		case "whisper":
+			if argAfter(args, "--language") != "de" || argAfter(args, "--model") != "small" {
+				return nil, fmt.Errorf("args = %v", args)
+			}
+			return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), "call.json"), []byte(segmentsFixture), 0o644)
+		case "summarize":
+			summarized = args
+			return []byte("- nothing\n"), nil
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	})
+
+	put := func(template string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/transcripts/call.webm", strings.NewReader(webmHeader+"audio"))
+		req.Header.Set("X-Session-Template", template)
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := put("weekly"); code != http.StatusBadRequest {
+		t.Fatalf("unknown template: %d", code)
+	}
+	if code := put("standup"); code != http.StatusNoContent {
+		t.Fatalf("PUT: %d", code)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "call.webm"))
+	if !reflect.DeepEqual(meta.Tags, []string{"meeting", "project:acme"}) || meta.Template == nil || meta.Template.Name != "standup" {
+		t.Fatalf("meta = %+v", meta)
+	}
+
+	// Transcribed with the template's model and language, then summarized
+	// with its prompt.
+	j := queueTranscription(t, "call.webm")
+	if j.Model != "small" || j.Language != "de" {
+		t.Fatalf("job = %+v", j)
+	}
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted {
+		t.Fatalf("job = %+v", got)
+	}
+	summary, ok := jobs.claim()
+	if !ok || summary.Type != "regenerate" || summary.Path != "call.summary.md" {
+		t.Fatalf("summary job = %+v", summary)
+	}
+	runJob(summary)
+	if !reflect.DeepEqual(summarized, []string{filepath.Join(dir, "call.txt"), "List the action items."}) {
+		t.Fatalf("summarize args = %q", summarized)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "call.summary.md")); err != nil || string(data) != "- nothing\n" {
+		t.Fatalf("summary = %q, %v", data, err)
+	}
+}
+
+func TestSummaryCommandWithoutTemplate(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.SummaryCommand = []string{"llm", "-f", "{src}", "{prompt}", "--note={prompt}"} })
+	if got := summaryCommand("call.txt"); !reflect.DeepEqual(got, []string{"llm", "-f", "{src}", "--note="}) {
+		t.Fatalf("command = %q", got)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sessionPairWindow bounds how far apart the modification times of an audio
+// file and a differently named transcript in the same folder may be for them
+// to be treated as one recording session.
+const sessionPairWindow = 10 * time.Minute
+
+var (
+	audioExts = map[string]bool{
+		".webm": true, ".ogg": true, ".opus": true, ".mp3": true,
+		".wav": true, ".m4a": true, ".flac": true, ".mp4": true,
+	}
+	// sessionIgnoredFiles are bookkeeping files written by the extension host
+	// that never belong to a single recording.
+	sessionIgnoredFiles = map[string]bool{"tab.json": true, "history.jsonl": true}
+)
+
+// session groups the files that make up one recording: audio, plain-text and
+// JSON transcripts, and sidecar metadata. ID is the slash-separated path of
+// the session's primary file without its extension.
+type session struct {
+	ID             string   `json:"id"`
+	Folder         string   `json:"folder"`
+	Audio          string   `json:"audio,omitempty"`
+	Parts          []string `json:"parts,omitempty"`
+	Transcript     string   `json:"transcript,omitempty"`
+	TranscriptJSON string   `json:"transcriptJson,omitempty"`
+	Meta           string   `json:"meta,omitempty"`
+	Files          []string `json:"files"`
+	Tags           []string `json:"tags,omitempty"`
+	Topics         []string `json:"topics,omitempty"`
+	Language       string   `json:"language,omitempty"`
+	// Duration is the length of the audio in seconds, of all its parts
+	// together; see durationLookup.
+	Duration float64 `json:"duration,omitempty"`
+	// Tracks are the synchronized tracks of a multi-track capture, such as
+	// the tab audio and the microphone.
+	Tracks []sessionTrack `json:"tracks,omitempty"`
+	// Fields are the session's custom fields; see customField.
+	Fields map[string]customField `json:"fields,omitempty"`
+	// Partial is set for recordings salvaged from an interrupted capture.
+	Partial bool `json:"partial,omitempty"`
+	// Published sessions are listed in the public gallery.
+	Published bool `json:"published,omitempty"`
+	// Source is the tab the recording was captured from, and Calendar
+	// the calendar event it was recorded in.
+	Source   *sourceInfo   `json:"source,omitempty"`
+	Calendar *calendarInfo `json:"calendar,omitempty"`
+	// Template is the session template it was recorded with.
+	Template string `json:"template,omitempty"`
+	// Cold lists the audio files moved to cold storage.
+	Cold []coldFile `json:"cold,omitempty"`
+	// Favorite sessions can be listed alone or first; see favoritesFilter.
+	Favorite  bool      `json:"favorite,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// RecordedAt is the start time in UTC and RecordedOffset the offset of
+	// the clock it was recorded on; RecordedDay is the date there.
+	// DisplayTime and DisplayDay show the start in the server's (or the
+	// request's ?tz=) display time zone.
+	RecordedAt     time.Time `json:"recordedAt"`
+	RecordedOffset string    `json:"recordedOffset"`
+	RecordedDay    string    `json:"recordedDay"`
+	DisplayTime    string    `json:"displayTime,omitempty"`
+	DisplayDay     string    `json:"displayDay,omitempty"`
+
+	// Artifacts maps each kind of file the session has (audio,
+	// transcript_json, srt, summary, ...) to its URL and freshness.
+	Artifacts map[string]artifact `json:"artifacts"`
+
+	modTimes map[string]time.Time
+}
+
+func (s *session) add(rel string, modTime time.Time) {
+	name := path.Base(rel)
+	switch ext := strings.ToLower(path.Ext(name)); {
+	case isMetaFile(name):
+		s.Meta = rel
+	case artifactInfix.MatchString(strings.TrimSuffix(name, path.Ext(name))):
+		// Summaries, waveforms, spectrograms, notes and enhanced audio
+		// only appear in Artifacts.
+	case audioExts[ext] && trackSuffix.MatchString(strings.TrimSuffix(name, path.Ext(name))):
+		track, _ := trackName(name)
+		s.addTrack(rel, track)
+	case audioExts[ext]:
+		if partSuffix.MatchString(strings.TrimSuffix(name, path.Ext(name))) {
+			s.Parts = append(s.Parts, rel)
+			sort.Strings(s.Parts)
+			s.Audio = s.Parts[0]
+		} else {
+			s.Audio = rel
+		}
+	case ext == ".txt":
+		s.Transcript = rel
+	case ext == ".json":
+		s.TranscriptJSON = rel
+	}
+	s.Files = append(s.Files, rel)
+	if s.modTimes == nil {
+		s.modTimes = map[string]time.Time{}
+	}
+	s.modTimes[rel] = modTime
+	if s.CreatedAt.IsZero() || modTime.Before(s.CreatedAt) {
+		s.CreatedAt = modTime
+	}
+	if modTime.After(s.UpdatedAt) {
+		s.UpdatedAt = modTime
+	}
+}
+
+func (s *session) merge(o *session) {
+	s.Files = append(s.Files, o.Files...)
+	for f, t := range o.modTimes {
+		s.modTimes[f] = t
+	}
+	s.Parts = append(s.Parts, o.Parts...)
+	for _, tr := range o.Tracks {
+		s.addTrack(tr.Path, tr.Name)
+	}
+	if s.Audio == "" {
+		s.Audio = o.Audio
+	}
+	if s.Transcript == "" {
+		s.Transcript = o.Transcript
+	}
+	if s.TranscriptJSON == "" {
+		s.TranscriptJSON = o.TranscriptJSON
+	}
+	if s.Meta == "" {
+		s.Meta = o.Meta
+	}
+	if o.CreatedAt.Before(s.CreatedAt) {
+		s.CreatedAt = o.CreatedAt
+	}
+	if o.UpdatedAt.After(s.UpdatedAt) {
+		s.UpdatedAt = o.UpdatedAt
+	}
+}
+
+func (s *session) hasTranscript() bool {
+	return s.Transcript != "" || s.TranscriptJSON != ""
+}
+
+// metaPath returns the absolute sidecar path that session-level metadata is
+// read from and written to.
+func (s *session) metaPath() string {
+	if s.Meta != "" {
+		return absPath(s.Meta)
+	}
+	return absPath(s.ID + metaSuffix)
+}
+
+// scanSessions walks every workspace and groups files into sessions. Files sharing a
+// folder and stem always belong together; afterwards, an audio-only group and
+// a transcript-only group in the same folder are paired when their
+// modification times fall within sessionPairWindow, which covers the
+// extension's audio.webm + transcript.txt layout.
+func scanSessions() ([]session, error) {
+	byFolder := map[string]map[string]*session{}
+	err := walkRecordings(func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if sessionIgnoredFiles[name] || strings.HasSuffix(name, ".tmp") || strings.HasPrefix(name, ".") || isChunkFile(name) {
+			return nil
+		}
+		if !isArtifactFile(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, ok := relPath(p)
+		if !ok {
+			return nil
+		}
+		folder := path.Dir(rel)
+		stem := recordingStem(name)
+		groups := byFolder[folder]
+		if groups == nil {
+			groups = map[string]*session{}
+			byFolder[folder] = groups
+		}
+		s := groups[stem]
+		if s == nil {
+			s = &session{ID: path.Join(folder, stem), Folder: folder}
+			groups[stem] = s
+		}
+		s.add(rel, info.ModTime())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []session
+	for _, groups := range byFolder {
+		out = append(out, pairByTimestamp(groups)...)
+	}
+	// Without the records, regenerated artifacts are judged by mtime.
+	derived, _ := loadDerived()
+	durations := newDurationLookup()
+	defer durations.save()
+	for i := range out {
+		sort.Slice(out[i].Files, func(a, b int) bool { return naturalLess(out[i].Files[a], out[i].Files[b]) })
+		upgradeManifests(&out[i])
+		out[i].Tags = sessionTags(&out[i])
+		meta, _ := loadMeta(out[i].metaPath())
+		out[i].setRecorded(sessionRecordingTime(&out[i], meta))
+		out[i].Partial = meta.Partial != nil
+		out[i].Published = meta.Gallery != nil
+		out[i].Favorite = meta.Favorite != nil
+		out[i].Fields = meta.Fields
+		out[i].Source = meta.Source
+		out[i].Calendar = meta.Calendar
+		out[i].Cold = meta.Cold
+		if meta.Template != nil {
+			out[i].Template = meta.Template.Name
+		}
+		if meta.Keywords != nil {
+			out[i].Topics = meta.Keywords.Topics
+		}
+		if meta.Language != nil {
+			out[i].Language = meta.Language.Code
+		}
+		out[i].setArtifacts(derived)
+		audio := out[i].Parts
+		if len(audio) == 0 && out[i].Audio != "" {
+			audio = []string{out[i].Audio}
+		}
+		out[i].Duration, _ = durations.total(audio)
+	}
+	sort.Slice(out, func(i, j int) bool { return naturalLess(out[i].ID, out[j].ID) })
+	return out, nil
+}
+
+// pairByTimestamp merges audio-only and transcript-only groups of one folder
+// whose timestamps are close enough, preferring the closest match.
+func pairByTimestamp(groups map[string]*session) []session {
+	var audioOnly, textOnly []*session
+	for _, s := range groups {
+		switch {
+		case s.Audio != "" && !s.hasTranscript():
+			audioOnly = append(audioOnly, s)
+		case s.Audio == "" && s.hasTranscript():
+			textOnly = append(textOnly, s)
+		}
+	}
+	merged := map[*session]bool{}
+	for _, a := range audioOnly {
+		var best *session
+		var bestGap time.Duration
+		for _, t := range textOnly {
+			if merged[t] {
+				continue
+			}
+			gap := a.UpdatedAt.Sub(t.UpdatedAt)
+			if gap < 0 {
+				gap = -gap
+			}
+			if gap <= sessionPairWindow && (best == nil || gap < bestGap) {
+				best, bestGap = t, gap
+			}
+		}
+		if best != nil {
+			a.merge(best)
+			merged[best] = true
+		}
+	}
+	out := make([]session, 0, len(groups))
+	for _, s := range groups {
+		if !merged[s] {
+			out = append(out, *s)
+		}
+	}
+	return out
+}
+
+// sessionTags collects tags from every sidecar in the session.
+func sessionTags(s *session) []string {
+	var tags []string
+	for _, f := range s.Files {
+		if !isMetaFile(f) {
+			continue
+		}
+		if meta, err := loadMeta(absPath(f)); err == nil {
+			tags = append(tags, meta.Tags...)
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return normalizeTags(tags)
+}
+
+// findSession returns the session with the given ID, or one containing the
+// given file path or sharing its stem, so callers may address a session by
+// any of them.
+func findSession(id string) (*session, error) {
+	clean, err := normalizeRecordingsRelative(id)
+	if err != nil {
+		return nil, err
+	}
+	clean = filepath.ToSlash(clean)
+	sessions, err := scanSessions()
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if sessions[i].ID == clean {
+			return &sessions[i], nil
+		}
+	}
+	for i := range sessions {
+		for _, f := range sessions[i].Files {
+			if f == clean {
+				return &sessions[i], nil
+			}
+		}
+	}
+	// Fall back to the stem so a not-yet-written sibling such as foo.txt
+	// still resolves to foo's session.
+	stemID := path.Join(path.Dir(clean), recordingStem(path.Base(clean)))
+	for i := range sessions {
+		if sessions[i].ID == stemID {
+			return &sessions[i], nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// sessionsHandler serves GET /api/sessions and GET /api/sessions/{id}, and
+// hands /api/sessions/{id}/notes, /chapters and /annotations to their
+// handlers.
+// ?day=YYYY-MM-DD lists the sessions recorded on that date on the
+// recorder's clock, ?workspace= those in one workspace, ?topic= those with
+// every given topic, ?lang= those in any given language, ?field= those
+// whose custom fields match every filter and ?favorites=true the
+// favorites; ?favorites=first lists favorites ahead of the rest, ?tz=
+// overrides the display time zone and ?format=csv returns the listing as a
+// spreadsheet.
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if id, action, arg, ok := splitSessionAction(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sessions"), "/")); ok {
+		// A session may also be named "notes", so fall through when the
+		// rest is not one.
+		if s, err := findSession(id); err == nil {
+			switch action {
+			case "notes":
+				sessionNotesHandler(w, r, s)
+			case "chapters":
+				chaptersHandler(w, r, s)
+			case "cold":
+				sessionColdHandler(w, r, s)
+			default:
+				annotationsHandler(w, r, s, arg)
+			}
+			return
+		}
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	loc, err := displayTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sessions"), "/")
+	if id == "" {
+		order, err := parseListingOrder(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		all, err := scanSessions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		scope, err := workspaceScope(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		day := r.URL.Query().Get("day")
+		topics := r.URL.Query()["topic"]
+		langs := r.URL.Query()["lang"]
+		fields, err := parseFieldFilters(r.URL.Query()["field"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		favorites, err := parseFavoritesFilter(r.URL.Query().Get("favorites"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sessions := make([]session, 0, len(all))
+		for _, s := range all {
+			s.setDisplayZone(loc)
+			if (day == "" || s.RecordedDay == day) && inWorkspace(s.ID, scope) && hasAllTags(s.Topics, topics) && matchesLanguage(s.Language, langs) && matchesFields(s.Fields, fields) && favorites.matches(&s) {
+				sessions = append(sessions, s)
+			}
+		}
+		order.sortSessions(sessions)
+		favorites.pin(sessions)
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			writeJSON(w, sessions)
+		case "csv":
+			writeSessionsCSV(w, sessions)
+		default:
+			http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		}
+		return
+	}
+	s, err := findSession(id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.setDisplayZone(loc)
+	writeJSON(w, s)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sessionsCSVColumns are the columns every CSV listing starts with; each
+// custom field in use follows as a column of its own.
+var sessionsCSVColumns = []string{"id", "recorded_at", "day", "language", "tags", "topics", "published", "partial", "audio", "transcript", "source_title", "source_url"}
+
+// writeSessionsCSV writes sessions as CSV with a UTF-8 byte order mark, so
+// spreadsheet apps read names in any script correctly.
+func writeSessionsCSV(w http.ResponseWriter, sessions []session) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="sessions-%s.csv"`, time.Now().Format("20060102")))
+	w.Write([]byte("\ufeff"))
+	cw := csv.NewWriter(w)
+	names := fieldNames(sessions)
+	header := append([]string{}, sessionsCSVColumns...)
+	for _, name := range names {
+		if slices.Contains(sessionsCSVColumns, name) {
+			name = "field:" + name
+		}
+		header = append(header, name)
+	}
+	cw.Write(header)
+	for _, s := range sessions {
+		when, day := s.DisplayTime, s.DisplayDay
+		if when == "" && !s.RecordedAt.IsZero() {
+			when, day = s.RecordedAt.Format(time.RFC3339), s.RecordedDay
+		}
+		var source sourceInfo
+		if s.Source != nil {
+			source = *s.Source
+		}
+		transcript := s.TranscriptJSON
+		if s.Transcript != "" {
+			transcript = s.Transcript
+		}
+		row := []string{
+			csvText(s.ID), when, day, s.Language,
+			csvText(strings.Join(s.Tags, "; ")), csvText(strings.Join(s.Topics, "; ")),
+			fmt.Sprint(s.Published), fmt.Sprint(s.Partial),
+			csvText(s.Audio), csvText(transcript),
+			csvText(source.Title), csvText(source.URL),
+		}
+		for _, name := range names {
+			f, ok := s.Fields[name]
+			switch {
+			case !ok:
+				row = append(row, "")
+			case f.Type == fieldText:
+				row = append(row, csvText(f.String()))
+			default:
+				row = append(row, f.String())
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+}
+
+// csvText keeps spreadsheet apps from running text that starts like a
+// formula, which a recording name or client field could carry.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
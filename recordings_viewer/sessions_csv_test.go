@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionsCSV(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "a.txt", "=b.webm")
+	putFields(t, "a.webm", `{"fields": {"client": "-Acme", "hours": 2.5, "id": "M-1"}}`)
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?format=csv&tz=UTC", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("status=%d headers=%v", rec.Code, rec.Header())
+	}
+	body, ok := strings.CutPrefix(rec.Body.String(), "\ufeff")
+	if !ok {
+		t.Fatal("missing byte order mark")
+	}
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id,recorded_at,day,language,tags,topics,published,partial,audio,transcript,source_title,source_url,client,hours,field:id"
+	if len(rows) != 3 || strings.Join(rows[0], ",") != want {
+		t.Fatalf("rows = %q", rows)
+	}
+	byID := map[string][]string{}
+	for _, row := range rows[1:] {
+		byID[row[0]] = row
+	}
+	a := byID["a"]
+	if a == nil || a[8] != "a.webm" || a[9] != "a.txt" || a[12] != "'-Acme" || a[13] != "2.5" || a[14] != "M-1" {
+		t.Fatalf("a = %q", a)
+	}
+	if byID["'=b"] == nil {
+		t.Fatalf("formula-like id not escaped: %q", rows)
+	}
+
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?format=xml", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("format=xml status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanSessionsGroupsByStemAndTimestamp(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir,
+		"foo.webm", "foo.txt", "foo.json", "foo.meta.json",
+		"uuid/clip-1/audio.webm", "uuid/clip-1/transcript.txt", "uuid/tab.json",
+		"lonely.txt",
+	)
+	if err := os.WriteFile(filepath.Join(dir, "foo.meta.json"), []byte(`{"tags":["acme"]}`), 0o644); err != nil {
+		t.Fatalf("write meta: %v", err)
+	}
+
+	sessions, err := scanSessions()
+	if err != nil {
+		t.Fatalf("scanSessions: %v", err)
+	}
+	byID := map[string]session{}
+	for _, s := range sessions {
+		byID[s.ID] = s
+	}
+	if len(byID) != 3 {
+		t.Fatalf("sessions=%+v want 3", sessions)
+	}
+	foo := byID["foo"]
+	if foo.Audio != "foo.webm" || foo.Transcript != "foo.txt" || foo.TranscriptJSON != "foo.json" || foo.Meta != "foo.meta.json" {
+		t.Fatalf("foo session=%+v", foo)
+	}
+	if len(foo.Tags) != 1 || foo.Tags[0] != "acme" {
+		t.Fatalf("foo tags=%v", foo.Tags)
+	}
+	clip, ok := byID["uuid/clip-1/audio"]
+	if !ok || clip.Transcript != "uuid/clip-1/transcript.txt" {
+		t.Fatalf("clip session=%+v", clip)
+	}
+	if byID["lonely"].Audio != "" {
+		t.Fatalf("lonely session should have no audio")
+	}
+}
+
+func TestScanSessionsDoesNotPairDistantFiles(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.webm", "b.txt")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "b.txt"), old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	sessions, err := scanSessions()
+	if err != nil {
+		t.Fatalf("scanSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("sessions=%+v want 2 unpaired", sessions)
+	}
+}
+
+func TestSessionsHandlerLookupByFile(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "foo.webm", "foo.txt")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions/foo.txt", nil)
+	rec := httptest.NewRecorder()
+	sessionsHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusOK)
+	}
+	var s session
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.ID != "foo" || s.Audio != "foo.webm" {
+		t.Fatalf("session=%+v", s)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/sessions/missing", nil)
+	rec = httptest.NewRecorder()
+	sessionsHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing status=%d want %d", rec.Code, http.StatusNotFound)
+	}
+}
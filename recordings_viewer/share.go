@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultShareTTL is how long a share link lasts when the request does not
+// say.
+const defaultShareTTL = 24 * time.Hour
+
+//go:embed share.html
+var sharePage []byte
+
+var (
+	errShareInvalid = errors.New("invalid share link")
+	errShareExpired = errors.New("share link expired")
+)
+
+// shareClaims is what a share token grants: read access to one session
+// until Expires (Unix seconds).
+type shareClaims struct {
+	Session string `json:"s"`
+	Expires int64  `json:"e"`
+}
+
+// shareKeyMu keeps two first requests from creating different keys.
+var shareKeyMu sync.Mutex
+
+// shareKey returns the key share tokens are signed with: cfg.ShareSecret,
+// or a random key created next to the secrets file on first use, outside
+// the recordings so it is never served or backed up with them. Removing
+// share.key revokes every link handed out with it.
+func shareKey() ([]byte, error) {
+	if cfg().ShareSecret != "" {
+		return []byte(cfg().ShareSecret), nil
+	}
+	shareKeyMu.Lock()
+	defer shareKeyMu.Unlock()
+	keyPath := filepath.Join(secretsDir(), "share.key")
+	key, err := os.ReadFile(keyPath)
+	if err == nil && len(key) >= 32 {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(secretsDir(), 0o700); err != nil {
+		return nil, err
+	}
+	return key, os.WriteFile(keyPath, key, 0o600)
+}
+
+// signShare returns a token for c: its claims and their HMAC-SHA256, both
+// base64url-encoded and joined by a dot, so it fits in a URL path.
+func signShare(c shareClaims) (string, error) {
+	key, err := shareKey()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyShare checks a token's signature and expiry and returns its claims.
+func verifyShare(token string, now time.Time) (shareClaims, error) {
+	var c shareClaims
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, errShareInvalid
+	}
+	key, err := shareKey()
+	if err != nil {
+		return c, err
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return c, errShareInvalid
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return c, errShareInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || json.Unmarshal(payload, &c) != nil || c.Session == "" {
+		return c, errShareInvalid
+	}
+	if now.Unix() >= c.Expires {
+		return c, errShareExpired
+	}
+	return c, nil
+}
+
+// sharedFiles maps the base names of the files a share link exposes (the
+// audio, its parts, the transcripts and subtitles) to recordings paths.
+// Metadata, summaries and notes stay private.
+func sharedFiles(s *session) map[string]string {
+	out := map[string]string{}
+	for _, f := range s.Files {
+		switch artifactKind(path.Base(f)) {
+		case artifactAudio, artifactTranscriptTxt, artifactTranscriptJSON, artifactSRT:
+			out[path.Base(f)] = f
+		}
+	}
+	return out
+}
+
+// publicBaseURL is the scheme and host links to this server start with:
+// cfg.PublicURL, or what the request was addressed to.
+func publicBaseURL(r *http.Request) string {
+	if cfg().PublicURL != "" {
+		return cfg().PublicURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p == "http" || p == "https" {
+		scheme = p
+	}
+	return scheme + "://" + r.Host
+}
+
+// shareHandler serves POST /api/share: {"session": "<id>", "ttl": "24h"}
+// returns a link that lets anyone holding it listen to the session and
+// read its transcript, without credentials, until it expires.
+func shareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Session string `json:"session"`
+		TTL     string `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultShareTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if cfg().ShareMaxTTL > 0 && ttl > cfg().ShareMaxTTL {
+		http.Error(w, fmt.Sprintf("ttl exceeds the maximum of %s", cfg().ShareMaxTTL), http.StatusBadRequest)
+		return
+	}
+	if req.Session == "" {
+		http.Error(w, "missing session", http.StatusBadRequest)
+		return
+	}
+	s, err := findSession(req.Session)
+	if err != nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	token, err := signShare(shareClaims{Session: s.ID, Expires: expires.Unix()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("shared session", "session", s.ID, "expires", expires)
+	publishEvent("share.created", s.ID, map[string]any{"expiresAt": expires.UTC()})
+	writeJSONStatus(w, http.StatusCreated, map[string]any{
+		"url":       publicBaseURL(r) + "/share/" + token,
+		"token":     token,
+		"session":   s.ID,
+		"expiresAt": expires.UTC(),
+	})
+}
+
+// sharedHandler serves what a share link opens: GET /share/{token} is a
+// player page, /share/{token}/info describes the session and
+// /share/{token}/files/{name} serves one of its shared files.
+func sharedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/share/"), "/")
+	claims, err := verifyShare(token, time.Now())
+	switch {
+	case errors.Is(err, errShareExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, errShareInvalid):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s, err := findSession(claims.Session)
+	if err != nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	// Keep the token out of Referer headers sent to other sites.
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "private")
+	files := sharedFiles(s)
+
+	switch name, isFile := strings.CutPrefix(rest, "files/"); {
+	case rest == "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(sharePage)
+	case rest == "info":
+		type sharedFile struct {
+			Name string `json:"name"`
+			Kind string `json:"kind"`
+			URL  string `json:"url"`
+		}
+		list := []sharedFile{}
+		for _, f := range s.Files {
+			if files[path.Base(f)] == f {
+				list = append(list, sharedFile{Name: path.Base(f), Kind: artifactKind(path.Base(f)), URL: "/share/" + token + "/files/" + path.Base(f)})
+			}
+		}
+		writeJSON(w, map[string]any{
+			"session":    s.ID,
+			"recordedAt": s.RecordedAt,
+			"expiresAt":  time.Unix(claims.Expires, 0).UTC(),
+			"files":      list,
+		})
+	case isFile:
+		rel, ok := files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		serveSessionFile(w, r, rel)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveSessionFile serves the recordings file rel, with audio remuxed so
+// browsers can seek in it.
+func serveSessionFile(w http.ResponseWriter, r *http.Request, rel string) {
+	out := absPath(rel)
+	if artifactKind(path.Base(rel)) == artifactAudio {
+		if seekable, err := seekableCopy(out); err == nil {
+			out = seekable
+		} else {
+			requestLogger(r).Warn("remux for seeking", "path", rel, "err", err)
+		}
+	}
+	setContentType(w, rel)
+	http.ServeFile(w, r, out)
+}
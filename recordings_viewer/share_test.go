@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createShare(t *testing.T, body string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/share", strings.NewReader(body))
+	req.Host = "viewer.local:8080"
+	newMux().ServeHTTP(rec, req)
+	var resp struct {
+		URL   string `json:"url"`
+		Token string `json:"token"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code == http.StatusCreated && resp.URL != "http://viewer.local:8080/share/"+resp.Token {
+		t.Fatalf("url = %q", resp.URL)
+	}
+	return rec, resp.Token
+}
+
+// useConfigHome points the per-user config folder, where the share key is
+// created, at a temporary directory.
+func useConfigHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("AppData", home)
+	return secretsDir()
+}
+
+func TestShareLink(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfigHome(t)
+	writeTestFiles(t, dir, "2024/call.webm", "2024/call.txt", "2024/call.summary.txt")
+	os.WriteFile(filepath.Join(dir, "2024", "call.json"), []byte(segmentsFixture), 0o644)
+	fakeStreamRemux(t, "12.5", nil)
+
+	rec, token := createShare(t, `{"session": "2024/call", "ttl": "1h"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d: %s", rec.Code, rec.Body)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	if rec := get("/share/" + token); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<audio") {
+		t.Fatalf("page = %d", rec.Code)
+	}
+	rec = get("/share/" + token + "/info")
+	var info struct {
+		Session string `json:"session"`
+		Files   []struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"files"`
+	}
+	json.NewDecoder(rec.Body).Decode(&info)
+	if info.Session != "2024/call" || len(info.Files) != 3 {
+		t.Fatalf("info = %+v", info)
+	}
+	for _, f := range info.Files {
+		if rec := get(f.URL); rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d", f.URL, rec.Code)
+		}
+	}
+	// Only the audio and transcripts are shared.
+	for _, name := range []string{"call.summary.txt", "call" + metaSuffix, "other.webm"} {
+		if rec := get("/share/" + token + "/files/" + name); rec.Code != http.StatusNotFound {
+			t.Fatalf("GET %s status = %d", name, rec.Code)
+		}
+	}
+	// A token for one session can't be bent into one for another.
+	if rec := get("/share/x" + token + "/info"); rec.Code != http.StatusNotFound {
+		t.Fatalf("tampered token status = %d", rec.Code)
+	}
+}
+
+func TestShareLinkExpires(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfigHome(t)
+	writeTestFiles(t, dir, "call.webm")
+
+	token, err := signShare(shareClaims{Session: "call", Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/share/"+token+"/info", nil))
+	if rec.Code != http.StatusGone {
+		t.Fatalf("expired link status = %d", rec.Code)
+	}
+
+	// A new secret revokes the links signed with the old key.
+	token, _ = signShare(shareClaims{Session: "call", Expires: time.Now().Add(time.Hour).Unix()})
+	useConfig(t, func(c *config) { c.ShareSecret = "rotated" })
+	if _, err := verifyShare(token, time.Now()); err != errShareInvalid {
+		t.Fatalf("verify after rotation = %v", err)
+	}
+}
+
+func TestShareRequestValidation(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfigHome(t)
+	writeTestFiles(t, dir, "call.webm")
+	useConfig(t, func(c *config) {
+		c.ShareMaxTTL = 48 * time.Hour
+		c.PublicURL = "https://recordings.example.com"
+	})
+
+	for body, want := range map[string]int{
+		`{"session": "call", "ttl": "72h"}`:     http.StatusBadRequest,
+		`{"session": "call", "ttl": "soon"}`:    http.StatusBadRequest,
+		`{"ttl": "1h"}`:                         http.StatusBadRequest,
+		`{"session": "missing"}`:                http.StatusNotFound,
+		`{"session": "call.webm", "ttl": "1h"}`: http.StatusCreated,
+	} {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/share", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("%s status = %d, want %d", body, rec.Code, want)
+		}
+		if rec.Code == http.StatusCreated && !strings.Contains(rec.Body.String(), `"url":"https://recordings.example.com/share/`) {
+			t.Errorf("%s = %s", body, rec.Body)
+		}
+	}
+}
+
+func TestShareKeyIsNotServed(t *testing.T) {
+	dir := useTempBaseDir(t)
+	keyDir := useConfigHome(t)
+	writeTestFiles(t, dir, "call.webm", ".viewer/jobs.json")
+
+	if _, err := signShare(shareClaims{Session: "call", Expires: time.Now().Add(time.Hour).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(keyDir, "share.key")); err != nil {
+		t.Fatalf("key not in the config folder: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".viewer", "share.key")); !os.IsNotExist(err) {
+		t.Fatalf("key in the recordings: %v", err)
+	}
+
+	// The state directory is not reachable through the transcripts API.
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		for _, p := range []string{".viewer/jobs.json", ".viewer/share.key", ".viewer"} {
+			rec := httptest.NewRecorder()
+			newMux().ServeHTTP(rec, httptest.NewRequest(method, "/api/transcripts/"+p, strings.NewReader("x")))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s %s = %d", method, p, rec.Code)
+			}
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ".viewer", "jobs.json")); string(data) != ".viewer/jobs.json" {
+		t.Fatalf("jobs.json = %q", data)
+	}
+}
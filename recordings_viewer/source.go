@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxSourceURL   = 2048
+	maxSourceTitle = 300
+)
+
+// sourceInfo is where a recording was captured: the URL and title of the
+// tab, e.g. a meeting or a video, and when the capture ended. Its start is
+// the manifest's recorded time.
+type sourceInfo struct {
+	URL     string    `json:"url,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	EndedAt time.Time `json:"endedAt,omitzero"`
+}
+
+// parseSource checks the source fields a client sent, any of which may be
+// empty, and returns nil when all are.
+func parseSource(rawURL, title, endedAt string) (*sourceInfo, error) {
+	src := &sourceInfo{Title: strings.TrimSpace(title)}
+	if rawURL = strings.TrimSpace(rawURL); rawURL != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil || !u.IsAbs() {
+			return nil, errors.New("source URL must be an absolute URL")
+		}
+		if len(rawURL) > maxSourceURL {
+			return nil, fmt.Errorf("source URL is longer than %d bytes", maxSourceURL)
+		}
+		src.URL = rawURL
+	}
+	if utf8.RuneCountInString(src.Title) > maxSourceTitle {
+		return nil, fmt.Errorf("source title is longer than %d characters", maxSourceTitle)
+	}
+	if endedAt != "" {
+		t, err := time.Parse(time.RFC3339, endedAt)
+		if err != nil {
+			return nil, errors.New("capture end must be an RFC 3339 time")
+		}
+		src.EndedAt = t.UTC()
+	}
+	if *src == (sourceInfo{}) {
+		return nil, nil
+	}
+	return src, nil
+}
+
+// sourceHeaders reads the optional X-Source-URL, X-Source-Title and
+// X-Capture-Ended-At headers the extension sends with a recording. The URL
+// and title are percent-encoded, as headers cannot carry every title.
+func sourceHeaders(r *http.Request) (*sourceInfo, error) {
+	rawURL, err := url.PathUnescape(r.Header.Get("X-Source-URL"))
+	if err != nil {
+		return nil, errors.New("X-Source-URL is not percent-encoded")
+	}
+	title, err := url.PathUnescape(r.Header.Get("X-Source-Title"))
+	if err != nil || !utf8.ValidString(title) {
+		return nil, errors.New("X-Source-Title is not percent-encoded UTF-8")
+	}
+	return parseSource(rawURL, title, r.Header.Get("X-Capture-Ended-At"))
+}
+
+// setSourceMeta stores src as the source in the sidecar of the recording
+// at fullPath. Callers hold mu.
+func setSourceMeta(fullPath string, src sourceInfo) error {
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		return err
+	}
+	meta.Source = &src
+	return saveMeta(fullPath, meta)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSource(t *testing.T) {
+	src, err := parseSource(" https://meet.google.com/abc-defg-hij ", " Weekly sync ", "2024-05-01T11:00:00+02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sourceInfo{URL: "https://meet.google.com/abc-defg-hij", Title: "Weekly sync", EndedAt: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}
+	if *src != want {
+		t.Fatalf("source = %+v", src)
+	}
+	if src, err := parseSource("", "", ""); src != nil || err != nil {
+		t.Fatalf("empty = %+v, %v", src, err)
+	}
+	for _, c := range [][3]string{
+		{"meet.google.com/abc", "", ""},
+		{"https://example.com/" + strings.Repeat("a", maxSourceURL), "", ""},
+		{"", strings.Repeat("é", maxSourceTitle+1), ""},
+		{"", "", "after lunch"},
+	} {
+		if _, err := parseSource(c[0], c[1], c[2]); err == nil {
+			t.Errorf("parseSource(%q, %q, %q) succeeded", c[0], c[1], c[2])
+		}
+	}
+}
+
+func TestTranscriptPutRecordsSource(t *testing.T) {
+	useTempBaseDir(t)
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/standup.webm", strings.NewReader(webmHeader+"audio"))
+	req.Header.Set("X-Recorded-At", "2024-05-01T10:00:00+02:00")
+	req.Header.Set("X-Source-URL", "https%3A%2F%2Fwww.youtube.com%2Fwatch%3Fv%3Dabc")
+	req.Header.Set("X-Source-Title", "Caf%C3%A9 talk %E2%80%94 YouTube")
+	req.Header.Set("X-Capture-Ended-At", "2024-05-01T10:45:00+02:00")
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	sessionsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/sessions", nil))
+	var got []session
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Source == nil {
+		t.Fatalf("sessions = %+v", got)
+	}
+	src := got[0].Source
+	if src.URL != "https://www.youtube.com/watch?v=abc" || src.Title != "Café talk — YouTube" || !src.EndedAt.Equal(time.Date(2024, 5, 1, 8, 45, 0, 0, time.UTC)) {
+		t.Fatalf("source = %+v", src)
+	}
+	if q, _ := parseSessionQuery("café youtube"); !q.matches(&got[0]) {
+		t.Fatal("query does not match the source title and URL")
+	}
+}
+
+func TestTranscriptPutRejectsInvalidSource(t *testing.T) {
+	dir := useTempBaseDir(t)
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/a.webm", strings.NewReader(webmHeader+"audio"))
+	req.Header.Set("X-Source-URL", "not a url")
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want 400", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.webm")); !os.IsNotExist(err) {
+		t.Fatalf("file written despite invalid header: %v", err)
+	}
+}
+
+func TestImportRecordsSource(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useRunCommand(t, func(_ context.Context, name string, a ...string) ([]byte, error) {
+		return nil, os.WriteFile(a[len(a)-1], []byte("webm"), 0o644)
+	})
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "call.m4a")
+	fw.Write([]byte("m4a data"))
+	mw.WriteField("sourceUrl", "https://zoom.us/j/123")
+	mw.WriteField("sourceTitle", "Zoom meeting")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	importHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body)
+	}
+	var res importResult
+	json.NewDecoder(rec.Body).Decode(&res)
+	meta, err := loadMeta(filepath.Join(dir, filepath.FromSlash(res.Files[0])))
+	if err != nil || meta.Source == nil || meta.Source.URL != "https://zoom.us/j/123" || meta.Source.Title != "Zoom meeting" {
+		t.Fatalf("meta = %+v, %v", meta.Source, err)
+	}
+}
+
+func TestManifestRejectsSourceEndingBeforeStart(t *testing.T) {
+	m := recordingMeta{
+		Schema:   manifestSchemaVersion,
+		Recorded: &recordingTime{At: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Offset: "+00:00"},
+		Source:   &sourceInfo{URL: "https://meet.google.com/x", EndedAt: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	problems := m.validate()
+	if len(problems) != 1 || problems[0].Field != "source.endedAt" {
+		t.Fatalf("problems = %+v", problems)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// extensionStats aggregates files sharing an extension.
+type extensionStats struct {
+	Ext   string `json:"ext"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// storageStats is the payload of GET /api/stats.
+type storageStats struct {
+	Recordings  int              `json:"recordings"`
+	Files       int              `json:"files"`
+	TotalBytes  int64            `json:"totalBytes"`
+	ByExtension []extensionStats `json:"byExtension"`
+	Oldest      *fileStamp       `json:"oldest,omitempty"`
+	Newest      *fileStamp       `json:"newest,omitempty"`
+	FreeBytes   *uint64          `json:"freeBytes,omitempty"`
+	TotalDisk   *uint64          `json:"diskBytes,omitempty"`
+}
+
+type fileStamp struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// collectStats walks every workspace (skipping state directories) and totals file
+// counts and sizes. Recordings are counted as audio files.
+func collectStats() (storageStats, error) {
+	var st storageStats
+	byExt := map[string]*extensionStats{}
+	err := walkRecordings(func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(d.Name()))
+		if isMetaFile(d.Name()) {
+			ext = metaSuffix
+		}
+		e := byExt[ext]
+		if e == nil {
+			e = &extensionStats{Ext: ext}
+			byExt[ext] = e
+		}
+		e.Files++
+		e.Bytes += info.Size()
+		st.Files++
+		st.TotalBytes += info.Size()
+
+		if !audioExts[ext] {
+			return nil
+		}
+		st.Recordings++
+		rel, _ := relPath(p)
+		stamp := &fileStamp{Path: rel, ModTime: info.ModTime().UTC()}
+		if st.Oldest == nil || stamp.ModTime.Before(st.Oldest.ModTime) {
+			st.Oldest = stamp
+		}
+		if st.Newest == nil || stamp.ModTime.After(st.Newest.ModTime) {
+			st.Newest = stamp
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	st.ByExtension = make([]extensionStats, 0, len(byExt))
+	for _, e := range byExt {
+		st.ByExtension = append(st.ByExtension, *e)
+	}
+	sort.Slice(st.ByExtension, func(i, j int) bool {
+		if st.ByExtension[i].Bytes != st.ByExtension[j].Bytes {
+			return st.ByExtension[i].Bytes > st.ByExtension[j].Bytes
+		}
+		return st.ByExtension[i].Ext < st.ByExtension[j].Ext
+	})
+	if free, total, err := diskSpace(baseDir); err == nil {
+		st.FreeBytes, st.TotalDisk = &free, &total
+	}
+	return st, nil
+}
+
+// statsHandler serves GET /api/stats.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := collectStats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, st)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatsHandlerTotals(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "old.webm", "uuid/clip/audio.webm", "uuid/clip/transcript.txt", "old.meta.json")
+	publishEvent("transcript.updated", "old.webm", nil) // state files must not count
+	past := time.Now().Add(-72 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "old.webm"), past, past)
+
+	rec := httptest.NewRecorder()
+	statsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d", rec.Code)
+	}
+	var st storageStats
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if st.Recordings != 2 || st.Files != 4 {
+		t.Fatalf("recordings=%d files=%d", st.Recordings, st.Files)
+	}
+	wantBytes := int64(len("old.webm") + len("uuid/clip/audio.webm") + len("uuid/clip/transcript.txt") + len("old.meta.json"))
+	if st.TotalBytes != wantBytes {
+		t.Fatalf("totalBytes=%d want %d", st.TotalBytes, wantBytes)
+	}
+	if st.Oldest == nil || st.Oldest.Path != "old.webm" || st.Newest.Path != "uuid/clip/audio.webm" {
+		t.Fatalf("oldest=%+v newest=%+v", st.Oldest, st.Newest)
+	}
+	if st.ByExtension[0].Ext != ".webm" || st.ByExtension[0].Files != 2 {
+		t.Fatalf("byExtension=%+v", st.ByExtension)
+	}
+	if st.FreeBytes == nil || *st.FreeBytes == 0 {
+		t.Fatalf("free disk space not reported")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamDrainTimeout bounds how long the relay waits for the backend to emit
+// its final transcript after the client stops sending audio.
+const streamDrainTimeout = 30 * time.Second
+
+// streamBackend is a running streaming transcription process: audio is
+// written to stdin and newline-delimited JSON events are read from stdout.
+type streamBackend struct {
+	stdin  io.WriteCloser
+	stdout io.Reader
+	wait   func() error
+}
+
+// startStreamBackend launches the configured streaming engine. Tests replace
+// it with an in-process fake.
+var startStreamBackend = func(ctx context.Context, name string, args ...string) (*streamBackend, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &streamBackend{stdin: stdin, stdout: stdout, wait: cmd.Wait}, nil
+}
+
+// wsTranscribeHandler serves GET /ws/transcribe. The client sends audio as
+// binary messages (format and sample rate given by ?format=webm|pcm_s16le and
+// ?rate=16000) and a {"type":"stop"} text message or a close frame when done.
+// Every line the backend prints is relayed as a text message, so clients
+// receive {"type":"partial"|"final","text":...} events while still recording.
+// The events also drive the captions overlay at /captions/live.
+func wsTranscribeHandler(w http.ResponseWriter, r *http.Request) {
+	command := cfg().StreamCommand
+	if len(command) == 0 {
+		http.Error(w, "streaming backend not configured", http.StatusServiceUnavailable)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "webm"
+	}
+	if format != "webm" && format != "pcm_s16le" {
+		http.Error(w, "unsupported format", http.StatusBadRequest)
+		return
+	}
+	rate := r.URL.Query().Get("rate")
+	if rate == "" {
+		rate = "16000"
+	}
+	if _, err := strconv.Atoi(rate); err != nil {
+		http.Error(w, "invalid rate", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	logger := requestLogger(r)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	args := append(append([]string(nil), command[1:]...), "--format", format, "--rate", rate)
+	backend, err := startStreamBackend(ctx, command[0], args...)
+	if err != nil {
+		logger.Error("start streaming backend", "err", err)
+		ws.close(1011, "streaming backend unavailable")
+		return
+	}
+	logger.Info("streaming transcription started", "format", format, "rate", rate)
+	liveCaptions.start()
+	defer liveCaptions.stop()
+
+	relayed := make(chan struct{})
+	go func() {
+		defer close(relayed)
+		scanner := bufio.NewScanner(backend.stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			event := normalizeStreamEvent(line)
+			liveCaptions.apply(event)
+			if err := ws.writeText(event); err != nil {
+				return
+			}
+		}
+	}()
+
+	var received int64
+	for {
+		op, msg, err := ws.readMessage()
+		if err != nil {
+			break
+		}
+		if op == wsOpText {
+			var ctl struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(msg, &ctl) == nil && ctl.Type == "stop" {
+				break
+			}
+			continue
+		}
+		received += int64(len(msg))
+		if _, err := backend.stdin.Write(msg); err != nil {
+			logger.Warn("streaming backend stdin", "err", err)
+			break
+		}
+	}
+	backend.stdin.Close()
+
+	select {
+	case <-relayed:
+	case <-time.After(streamDrainTimeout):
+		logger.Warn("streaming backend did not finish; killing it", "timeout", streamDrainTimeout)
+		cancel()
+		<-relayed
+	}
+	if err := backend.wait(); err != nil {
+		logger.Warn("streaming backend exited", "err", err)
+	}
+	logger.Info("streaming transcription finished", "bytes", received)
+	ws.writeText(`{"type":"done"}`)
+	ws.close(1000, "")
+}
+
+// normalizeStreamEvent passes JSON object lines through and wraps anything
+// else as a partial transcript so clients only ever see JSON events.
+func normalizeStreamEvent(line string) string {
+	if strings.HasPrefix(line, "{") && json.Valid([]byte(line)) {
+		return line
+	}
+	data, _ := json.Marshal(struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}{"partial", line})
+	return string(data)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useFakeStreamBackend replaces the streaming engine with one that reports
+// how many bytes it has received after every write and a final event at EOF.
+func useFakeStreamBackend(t *testing.T) *[]string {
+	t.Helper()
+	var gotArgs []string
+	orig := startStreamBackend
+	startStreamBackend = func(ctx context.Context, name string, args ...string) (*streamBackend, error) {
+		gotArgs = append([]string{name}, args...)
+		inR, inW := io.Pipe()
+		outR, outW := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer outW.Close()
+			total := 0
+			buf := make([]byte, 4096)
+			for {
+				n, err := inR.Read(buf)
+				total += n
+				if n > 0 {
+					fmt.Fprintf(outW, "heard %d bytes\n", total)
+				}
+				if err != nil {
+					fmt.Fprintf(outW, `{"type":"final","text":"done after %d"}`+"\n", total)
+					return
+				}
+			}
+		}()
+		return &streamBackend{stdin: inW, stdout: bufio.NewReader(outR), wait: func() error { <-done; return nil }}, nil
+	}
+	t.Cleanup(func() { startStreamBackend = orig })
+	return &gotArgs
+}
+
+func TestWSTranscribeRelaysPartialAndFinalEvents(t *testing.T) {
+	useConfig(t, func(c *config) { c.StreamCommand = []string{"python3", "whisper_stream.py"} })
+	args := useFakeStreamBackend(t)
+	srv := httptest.NewServer(http.HandlerFunc(wsTranscribeHandler))
+	defer srv.Close()
+
+	c := dialTestWebSocket(t, srv, "/ws/transcribe?format=pcm_s16le&rate=16000")
+	c.send(t, wsOpBinary, make([]byte, 320))
+	if _, msg := c.read(t); msg != `{"type":"partial","text":"heard 320 bytes"}` {
+		t.Fatalf("partial=%s", msg)
+	}
+	c.send(t, wsOpText, []byte(`{"type":"stop"}`))
+	if _, msg := c.read(t); msg != `{"type":"final","text":"done after 320"}` {
+		t.Fatalf("final=%s", msg)
+	}
+	if _, msg := c.read(t); msg != `{"type":"done"}` {
+		t.Fatalf("done=%s", msg)
+	}
+	if op, _ := c.read(t); op != wsOpClose {
+		t.Fatalf("expected close frame, got op %d", op)
+	}
+	if got := strings.Join(*args, " "); got != "python3 whisper_stream.py --format pcm_s16le --rate 16000" {
+		t.Fatalf("backend args=%s", got)
+	}
+}
+
+func TestWSTranscribeRequiresBackend(t *testing.T) {
+	useConfig(t, func(c *config) { c.StreamCommand = nil })
+	rec := httptest.NewRecorder()
+	wsTranscribeHandler(rec, httptest.NewRequest(http.MethodGet, "/ws/transcribe", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status=%d", rec.Code)
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sync keeps the recordings of two servers, say a desktop and a laptop,
+// the same. One side runs it against the other, its peer: it compares both
+// sides' files with the versions they had at their last sync, copies each
+// file changed on one side only to the other, and reports files changed on
+// both as conflicts. Files deleted on one side are reported and left alone
+// on the other. Only the primary workspace is synced.
+
+// syncFile is a file sync covers, as one side lists it.
+type syncFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// syncConflict is a file both sides changed since their last sync.
+type syncConflict struct {
+	Path  string   `json:"path"`
+	Local syncFile `json:"local"`
+	Peer  syncFile `json:"peer"`
+}
+
+// syncDeletion is a file deleted on one side (On is "local" or "peer")
+// since the last sync.
+type syncDeletion struct {
+	Path string `json:"path"`
+	On   string `json:"on"`
+}
+
+// syncReport is the outcome of one sync with a peer.
+type syncReport struct {
+	Peer       string          `json:"peer"`
+	DryRun     bool            `json:"dryRun,omitempty"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt"`
+	Unchanged  int             `json:"unchanged"`
+	Pulled     []string        `json:"pulled"`
+	Pushed     []string        `json:"pushed"`
+	Bytes      int64           `json:"bytes"`
+	Conflicts  []syncConflict  `json:"conflicts"`
+	Deleted    []syncDeletion  `json:"deleted"`
+	Failed     []backupFailure `json:"failed"`
+}
+
+// syncPeerState is what the last syncs with one peer left behind: the
+// SHA-256 both sides had of each file, and the last report.
+type syncPeerState struct {
+	Files      map[string]string `json:"files"`
+	LastSyncAt time.Time         `json:"lastSyncAt,omitzero"`
+	LastReport *syncReport       `json:"lastReport,omitempty"`
+}
+
+// Conflict resolutions: keep both versions and report the conflict, or
+// take the local, the peer's or the more recently modified version.
+const (
+	syncKeep  = "keep"
+	syncLocal = "local"
+	syncPeer  = "peer"
+	syncNewer = "newer"
+)
+
+var errSyncConflict = errors.New("changed on both sides")
+
+// syncRunning keeps a scheduled and a requested sync from overlapping.
+var syncRunning sync.Mutex
+
+func syncStatePath() string {
+	return filepath.Join(stateDir(), "sync.json")
+}
+
+// loadSyncState reads the state of every peer, keyed by the peer's URL.
+func loadSyncState() (map[string]*syncPeerState, error) {
+	state := map[string]*syncPeerState{}
+	data, err := os.ReadFile(syncStatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveSyncState(state map[string]*syncPeerState) error {
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	_, err = writeFileAtomic(syncStatePath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// syncable reports whether the recordings path rel is one sync covers: a
+// file of the primary workspace outside the server's own state.
+func syncable(rel string) bool {
+	return !strings.HasPrefix(rel, workspacePrefix) && checksumKey(absPath(rel)) != ""
+}
+
+// localSyncFiles lists the files this side syncs by recordings path.
+func localSyncFiles() (map[string]syncFile, error) {
+	candidates, err := collectBackupCandidates()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]syncFile{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c.rel, workspacePrefix) {
+			continue
+		}
+		files[c.rel] = syncFile{Path: c.rel, Size: c.sum.Size, ModTime: c.sum.ModTime, SHA256: c.sum.SHA256}
+	}
+	return files, nil
+}
+
+// currentSHA256 is the SHA-256 of the file at fullPath, or "" when there
+// is none. Callers hold mu.
+func currentSHA256(fullPath string) (string, error) {
+	info, err := os.Stat(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	index, err := loadChecksums()
+	if err != nil {
+		return "", err
+	}
+	if c, ok := index[checksumKey(fullPath)]; ok && c.Size == info.Size() && c.ModTime.Equal(info.ModTime().UTC()) {
+		return c.SHA256, nil
+	}
+	return hashFile(fullPath)
+}
+
+// stageSyncFile writes src to a scratch file and returns it with its
+// SHA-256. The caller removes it.
+func stageSyncFile(src io.Reader) (string, string, error) {
+	staged := filepath.Join(tempDir(), "sync-"+randomID())
+	h := sha256.New()
+	if _, err := writeFileAtomic(staged, io.TeeReader(src, h)); err != nil {
+		os.Remove(staged)
+		return "", "", err
+	}
+	return staged, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// installSyncFile moves the staged copy of rel, whose SHA-256 is sum, into
+// place with modification time modTime, unless the file there is no longer
+// the version expected ("" for none), in which case it returns
+// errSyncConflict.
+func installSyncFile(staged, rel, sum string, modTime time.Time, expected string) error {
+	full := absPath(rel)
+	mu.Lock()
+	defer mu.Unlock()
+	cur, err := currentSHA256(full)
+	if err != nil {
+		return err
+	}
+	if cur != expected {
+		return errSyncConflict
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	if err := os.Chtimes(staged, modTime, modTime); err != nil {
+		return err
+	}
+	if err := os.Rename(staged, full); err != nil {
+		return err
+	}
+	recordChecksum(full, sum)
+	return nil
+}
+
+// syncFilesHandler serves GET /api/sync/files, the files a peer compares
+// with its own when it syncs with this server.
+func syncFilesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	files, err := localSyncFiles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := make([]syncFile, 0, len(files))
+	for _, f := range files {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	writeJSON(w, map[string]any{"files": list})
+}
+
+func newSyncRoutes() *recordingRouter {
+	rr := &recordingRouter{}
+	rr.handle("GET", recordingHandler(getSyncFile))
+	rr.handle("PUT", recordingHandler(putSyncFile))
+	return rr
+}
+
+// getSyncFile serves GET /api/sync/files/{path} with the file.
+func getSyncFile(w http.ResponseWriter, r *http.Request, rel string) {
+	if !syncable(rel) {
+		http.Error(w, "not a synced file", http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, absPath(rel))
+}
+
+// putSyncFile serves PUT /api/sync/files/{path}: a peer's version of the
+// file. It replaces this side's only if that is still the version the peer
+// saw, whose SHA-256 is X-Sync-Base (empty when the file must not exist);
+// otherwise it answers 409. X-Content-SHA256 checks the copy, and
+// X-Modified-At (RFC 3339) becomes its modification time.
+func putSyncFile(w http.ResponseWriter, r *http.Request, rel string) {
+	if !syncable(rel) {
+		http.Error(w, "not a synced file", http.StatusBadRequest)
+		return
+	}
+	modTime, err := time.Parse(time.RFC3339Nano, r.Header.Get("X-Modified-At"))
+	if err != nil {
+		http.Error(w, "X-Modified-At must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	want := r.Header.Get("X-Content-SHA256")
+	if want == "" {
+		http.Error(w, "missing X-Content-SHA256", http.StatusBadRequest)
+		return
+	}
+	staged, sum, err := stageSyncFile(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(staged)
+	if sum != want {
+		http.Error(w, "content does not match X-Content-SHA256", http.StatusBadRequest)
+		return
+	}
+	err = installSyncFile(staged, rel, sum, modTime, r.Header.Get("X-Sync-Base"))
+	if errors.Is(err, errSyncConflict) {
+		http.Error(w, "the file changed since the peer last saw it", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	auditChange(r, "file.synced", rel, map[string]any{"before": r.Header.Get("X-Sync-Base"), "after": sum})
+	requestLogger(r).Info("received synced file", "path", rel)
+	publishEvent("sync.received", rel, map[string]any{"sha256": sum})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// syncClient talks to peers. Copies of long recordings may take a while,
+// so only connecting is bounded.
+var syncClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ResponseHeaderTimeout: 5 * time.Minute,
+	TLSHandshakeTimeout:   10 * time.Second,
+}}
+
+// remotePeer is the server sync exchanges files with, reached at base and
+// sending token, the peer's VIEWER_AUTH_TOKEN, with its writes.
+type remotePeer struct {
+	base  *url.URL
+	token string
+}
+
+// parsePeer parses the peer's http or https URL, e.g.
+// "https://laptop.local:8080".
+func parsePeer(raw, token string) (*remotePeer, error) {
+	u, err := url.Parse(strings.TrimRight(raw, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("peer %q must be an http or https URL", raw)
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return &remotePeer{base: u, token: token}, nil
+}
+
+// String names the peer without credentials; its state is kept under it.
+func (p *remotePeer) String() string {
+	u := *p.base
+	u.User = nil
+	return u.String()
+}
+
+func (p *remotePeer) url(elem ...string) string {
+	return p.base.JoinPath(append([]string{"api", "sync", "files"}, elem...)...).String()
+}
+
+func (p *remotePeer) fileURL(rel string) string {
+	return p.url(strings.Split(rel, "/")...)
+}
+
+func (p *remotePeer) do(req *http.Request) (*http.Response, error) {
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return syncClient.Do(req)
+}
+
+// peerError describes an unexpected answer, with the start of its body.
+func peerError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("%s %s: %s: %s", res.Request.Method, res.Request.URL.Path, res.Status, strings.TrimSpace(string(body)))
+}
+
+// list fetches the files the peer syncs.
+func (p *remotePeer) list(ctx context.Context) (map[string]syncFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, peerError(res)
+	}
+	var payload struct {
+		Files []syncFile `json:"files"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("peer file list: %w", err)
+	}
+	files := map[string]syncFile{}
+	for _, f := range payload.Files {
+		// A peer may only name files this side would sync too.
+		if clean, _, err := resolveRecordingPath(f.Path); err == nil && filepath.ToSlash(clean) == f.Path && syncable(f.Path) {
+			files[f.Path] = f
+		}
+	}
+	return files, nil
+}
+
+// pull copies the peer's version f over the local one, whose SHA-256 was
+// local ("" for none).
+func (p *remotePeer) pull(ctx context.Context, f syncFile, local string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.fileURL(f.Path), nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return peerError(res)
+	}
+	staged, sum, err := stageSyncFile(res.Body)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(staged)
+	if sum != f.SHA256 {
+		return errors.New("the peer's file changed while it was copied")
+	}
+	return installSyncFile(staged, f.Path, sum, f.ModTime, local)
+}
+
+// push copies the local version f over the peer's, whose SHA-256 was peer
+// ("" for none).
+func (p *remotePeer) push(ctx context.Context, f syncFile, peer string) error {
+	file, err := os.Open(absPath(f.Path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.fileURL(f.Path), file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = f.Size
+	req.Header.Set("X-Sync-Base", peer)
+	req.Header.Set("X-Content-SHA256", f.SHA256)
+	req.Header.Set("X-Modified-At", f.ModTime.UTC().Format(time.RFC3339Nano))
+	res, err := p.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusNoContent, http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return errSyncConflict
+	}
+	return peerError(res)
+}
+
+// syncAction decides what to do with one file given its local and peer
+// versions and the SHA-256 both had at the last sync (zero values for
+// none): "pull", "push", "conflict", "deleted-local", "deleted-peer" or "".
+func syncAction(local, peer syncFile, base, prefer string) string {
+	switch {
+	case local.SHA256 == peer.SHA256:
+		return ""
+	case peer.SHA256 == "":
+		if base == local.SHA256 {
+			return "deleted-peer"
+		}
+		return "push"
+	case local.SHA256 == "":
+		if base == peer.SHA256 {
+			return "deleted-local"
+		}
+		return "pull"
+	case local.SHA256 == base:
+		return "pull"
+	case peer.SHA256 == base:
+		return "push"
+	}
+	switch prefer {
+	case syncLocal:
+		return "push"
+	case syncPeer:
+		return "pull"
+	case syncNewer:
+		if local.ModTime.After(peer.ModTime) {
+			return "push"
+		}
+		if peer.ModTime.After(local.ModTime) {
+			return "pull"
+		}
+	}
+	return "conflict"
+}
+
+// syncWithPeer syncs the recordings with peer, settling conflicts as
+// prefer says. A dry run only reports what it would do.
+func syncWithPeer(ctx context.Context, peer *remotePeer, prefer string, dryRun bool) (syncReport, error) {
+	report := syncReport{
+		Peer: peer.String(), DryRun: dryRun, StartedAt: time.Now().UTC(),
+		Pulled: []string{}, Pushed: []string{}, Conflicts: []syncConflict{}, Deleted: []syncDeletion{}, Failed: []backupFailure{},
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		return report, err
+	}
+	ps := state[peer.String()]
+	if ps == nil {
+		ps = &syncPeerState{}
+	}
+	if ps.Files == nil {
+		ps.Files = map[string]string{}
+	}
+	remote, err := peer.list(ctx)
+	if err != nil {
+		return report, fmt.Errorf("peer %s: %w", peer, err)
+	}
+	local, err := localSyncFiles()
+	if err != nil {
+		return report, err
+	}
+	paths := map[string]bool{}
+	for _, files := range []map[string]syncFile{local, remote} {
+		for p := range files {
+			paths[p] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return naturalLess(sorted[i], sorted[j]) })
+
+	for _, p := range sorted {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		l, r := local[p], remote[p]
+		action := syncAction(l, r, ps.Files[p], prefer)
+		switch action {
+		case "":
+			report.Unchanged++
+			ps.Files[p] = l.SHA256
+			continue
+		case "conflict":
+			report.Conflicts = append(report.Conflicts, syncConflict{Path: p, Local: l, Peer: r})
+			continue
+		case "deleted-local", "deleted-peer":
+			report.Deleted = append(report.Deleted, syncDeletion{Path: p, On: strings.TrimPrefix(action, "deleted-")})
+			continue
+		}
+		if dryRun {
+			if action == "pull" {
+				report.Pulled = append(report.Pulled, p)
+				report.Bytes += r.Size
+			} else {
+				report.Pushed = append(report.Pushed, p)
+				report.Bytes += l.Size
+			}
+			continue
+		}
+		if action == "pull" {
+			err = peer.pull(ctx, r, l.SHA256)
+		} else {
+			err = peer.push(ctx, l, r.SHA256)
+		}
+		switch {
+		case errors.Is(err, errSyncConflict):
+			report.Conflicts = append(report.Conflicts, syncConflict{Path: p, Local: l, Peer: r})
+		case err != nil:
+			report.Failed = append(report.Failed, backupFailure{Path: p, Reason: err.Error()})
+		case action == "pull":
+			report.Pulled = append(report.Pulled, p)
+			report.Bytes += r.Size
+			ps.Files[p] = r.SHA256
+		default:
+			report.Pushed = append(report.Pushed, p)
+			report.Bytes += l.Size
+			ps.Files[p] = l.SHA256
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+	if dryRun {
+		return report, nil
+	}
+	// Files gone from both sides need no base any more.
+	for p := range ps.Files {
+		if !paths[p] {
+			delete(ps.Files, p)
+		}
+	}
+	ps.LastSyncAt = report.FinishedAt
+	ps.LastReport = &report
+	state[peer.String()] = ps
+	return report, saveSyncState(state)
+}
+
+// configuredPeer returns the peer of cfg.SyncPeer, or nil when none is set.
+func configuredPeer() (*remotePeer, error) {
+	if cfg().SyncPeer == "" {
+		return nil, nil
+	}
+	return parsePeer(cfg().SyncPeer, cfg().SyncToken)
+}
+
+// runScheduledSync runs the "sync" schedule with cfg.SyncPeer and
+// publishes the outcome.
+func runScheduledSync(now time.Time) {
+	peer, err := configuredPeer()
+	if err != nil || peer == nil {
+		if err != nil {
+			slog.Error("sync", "err", err)
+		}
+		return
+	}
+	if !syncRunning.TryLock() {
+		slog.Warn("sync still running, skipping scheduled run")
+		return
+	}
+	defer syncRunning.Unlock()
+	report, err := syncWithPeer(context.Background(), peer, cfg().SyncPrefer, false)
+	if err != nil {
+		slog.Error("sync", "peer", peer, "err", err)
+		publishEvent("sync.failed", "", map[string]any{"peer": peer.String(), "error": err.Error()})
+		return
+	}
+	slog.Info("sync finished", "peer", peer, "pulled", len(report.Pulled), "pushed", len(report.Pushed), "conflicts", len(report.Conflicts), "failed", len(report.Failed))
+	publishEvent("sync.completed", "", map[string]any{
+		"peer": peer.String(), "pulled": len(report.Pulled), "pushed": len(report.Pushed), "conflicts": report.Conflicts, "failed": report.Failed,
+	})
+}
+
+// cliSync syncs the recordings with the peer given, or cfg.SyncPeer, and
+// exits non-zero when files conflict or fail to copy.
+func cliSync(c *cli, args []string) int {
+	fs := c.flags("sync", "[-token token] [-prefer keep|local|peer|newer] [-dry-run] [peer-url]")
+	token := fs.String("token", "", "the peer's VIEWER_AUTH_TOKEN (default VIEWER_SYNC_TOKEN)")
+	prefer := fs.String("prefer", cfg().SyncPrefer, "how to settle files changed on both sides")
+	dryRun := fs.Bool("dry-run", false, "report what would be copied without copying")
+	rest, err := c.parse(fs, args)
+	if err != nil {
+		return exitConfig
+	}
+	raw := cfg().SyncPeer
+	switch len(rest) {
+	case 0:
+	case 1:
+		raw = rest[0]
+	default:
+		fs.Usage()
+		return exitConfig
+	}
+	if raw == "" {
+		return c.fail(exitConfig, errors.New("no peer: give its URL or set VIEWER_SYNC_PEER"))
+	}
+	switch *prefer {
+	case syncKeep, syncLocal, syncPeer, syncNewer:
+	default:
+		return c.fail(exitConfig, fmt.Errorf("-prefer must be keep, local, peer or newer"))
+	}
+	if cfg().ReadOnly && !*dryRun {
+		return c.fail(exitConfig, errors.New("recordings are read-only"))
+	}
+	if *token == "" {
+		*token = cfg().SyncToken
+	}
+	peer, err := parsePeer(raw, *token)
+	if err != nil {
+		return c.fail(exitConfig, err)
+	}
+	syncRunning.Lock()
+	report, err := syncWithPeer(context.Background(), peer, *prefer, *dryRun)
+	syncRunning.Unlock()
+	if err != nil {
+		return c.fail(exitFailed, err)
+	}
+	c.print(report, func(w io.Writer) {
+		verb := "copied"
+		if report.DryRun {
+			verb = "would copy"
+		}
+		fmt.Fprintf(w, "%s: %d unchanged, %s %d from the peer and %d to it (%s), %d conflicts, %d failed\n",
+			report.Peer, report.Unchanged, verb, len(report.Pulled), len(report.Pushed), formatBytes(report.Bytes), len(report.Conflicts), len(report.Failed))
+		if c.verbose {
+			for _, p := range report.Pulled {
+				fmt.Fprintf(w, "pulled    %s\n", p)
+			}
+			for _, p := range report.Pushed {
+				fmt.Fprintf(w, "pushed    %s\n", p)
+			}
+		}
+		for _, d := range report.Deleted {
+			fmt.Fprintf(w, "deleted   %s (on %s, kept on the other side)\n", d.Path, d.On)
+		}
+		for _, cf := range report.Conflicts {
+			c.problem(w, "conflict  %s (local %s, peer %s)", cf.Path, cf.Local.ModTime.Format(time.RFC3339), cf.Peer.ModTime.Format(time.RFC3339))
+		}
+		for _, f := range report.Failed {
+			c.problem(w, "failed    %s: %s", f.Path, f.Reason)
+		}
+	})
+	if len(report.Conflicts) > 0 || len(report.Failed) > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
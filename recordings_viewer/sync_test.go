@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// usePeer serves recordings of their own as a sync peer. Each request is
+// handled with baseDir pointing at the peer's directory and answered once
+// it is done, so the test's side never sees the swap.
+func usePeer(t *testing.T) (string, *remotePeer) {
+	t.Helper()
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		local := baseDir
+		baseDir = dir
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, r)
+		baseDir = local
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		io.Copy(w, rec.Body)
+	}))
+	t.Cleanup(srv.Close)
+	peer, err := parsePeer(srv.URL+"/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, peer
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func writeTestFile(t *testing.T, path, contents string, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncWithPeer(t *testing.T) {
+	dir := useTempBaseDir(t)
+	peerDir, peer := usePeer(t)
+	day := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(dir, "desk.webm"), "desk audio", day)
+	writeTestFile(t, filepath.Join(dir, "notes.json"), "v1", day)
+	writeTestFile(t, filepath.Join(peerDir, "2024/laptop.webm"), "laptop audio", day)
+	writeTestFile(t, filepath.Join(peerDir, "notes.json"), "v1", day)
+	writeTestFile(t, filepath.Join(peerDir, ".viewer/jobs.json"), "[]", day)
+	sync := func(prefer string) syncReport {
+		t.Helper()
+		report, err := syncWithPeer(context.Background(), peer, prefer, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	report := sync(syncKeep)
+	if strings.Join(report.Pulled, ",") != "2024/laptop.webm" || strings.Join(report.Pushed, ",") != "desk.webm" || report.Unchanged != 1 {
+		t.Fatalf("first sync = %+v", report)
+	}
+	if readTestFile(t, filepath.Join(peerDir, "desk.webm")) != "desk audio" || readTestFile(t, filepath.Join(dir, "2024/laptop.webm")) != "laptop audio" {
+		t.Fatal("files not copied")
+	}
+	if info, _ := os.Stat(filepath.Join(dir, "2024/laptop.webm")); !info.ModTime().Equal(day) {
+		t.Fatalf("pulled file modified at %v", info.ModTime())
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".viewer/jobs.json")); err == nil {
+		t.Fatal("state of the peer was synced")
+	}
+
+	// An edit on either side goes to the other.
+	writeTestFile(t, filepath.Join(dir, "notes.json"), "v2 desk", day.Add(time.Hour))
+	writeTestFile(t, filepath.Join(peerDir, "desk.webm"), "desk audio, trimmed", day.Add(time.Hour))
+	report = sync(syncKeep)
+	if strings.Join(report.Pushed, ",") != "notes.json" || strings.Join(report.Pulled, ",") != "desk.webm" {
+		t.Fatalf("second sync = %+v", report)
+	}
+
+	// Both sides edit the same file: kept apart until told which wins.
+	writeTestFile(t, filepath.Join(dir, "notes.json"), "v3 desk", day.Add(3*time.Hour))
+	writeTestFile(t, filepath.Join(peerDir, "notes.json"), "v3 laptop", day.Add(2*time.Hour))
+	report = sync(syncKeep)
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Path != "notes.json" || len(report.Pushed)+len(report.Pulled) != 0 {
+		t.Fatalf("conflict = %+v", report)
+	}
+	if readTestFile(t, filepath.Join(peerDir, "notes.json")) != "v3 laptop" {
+		t.Fatal("conflicting file overwritten")
+	}
+	report = sync(syncNewer)
+	if strings.Join(report.Pushed, ",") != "notes.json" || readTestFile(t, filepath.Join(peerDir, "notes.json")) != "v3 desk" {
+		t.Fatalf("newer = %+v", report)
+	}
+
+	// A deletion is reported, not copied back.
+	os.Remove(filepath.Join(dir, "2024/laptop.webm"))
+	report = sync(syncKeep)
+	if len(report.Deleted) != 1 || report.Deleted[0] != (syncDeletion{Path: "2024/laptop.webm", On: "local"}) || len(report.Pulled) != 0 {
+		t.Fatalf("deletion = %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(peerDir, "2024/laptop.webm")); err != nil {
+		t.Fatal("deleted on the peer too")
+	}
+}
+
+func TestPutSyncFileDetectsConflicts(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFile(t, filepath.Join(dir, "call.json"), "theirs", time.Now())
+	put := func(base, sum string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/sync/files/call.json", strings.NewReader("mine"))
+		req.Header.Set("X-Sync-Base", base)
+		req.Header.Set("X-Content-SHA256", sum)
+		req.Header.Set("X-Modified-At", "2024-05-01T09:00:00Z")
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if sum, _ := hashFile(filepath.Join(dir, "call.json")); put("", sum) != http.StatusBadRequest {
+		t.Fatal("accepted content that does not match its checksum")
+	}
+	staged, sum, _ := stageSyncFile(strings.NewReader("mine"))
+	os.Remove(staged)
+	if code := put("", sum); code != http.StatusConflict {
+		t.Fatalf("stale base: %d", code)
+	}
+	theirs, _ := hashFile(filepath.Join(dir, "call.json"))
+	if code := put(theirs, sum); code != http.StatusNoContent || readTestFile(t, filepath.Join(dir, "call.json")) != "mine" {
+		t.Fatalf("put: %d", code)
+	}
+	req := httptest.NewRequest(http.MethodPut, "/api/sync/files/.viewer/jobs.json", strings.NewReader("[]"))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("state file: %d", rec.Code)
+	}
+}
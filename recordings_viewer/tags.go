@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// transcriptTagsHandler serves GET/PUT /api/transcripts/{path}/tags. PUT
+// replaces the full tag set with the body's {"tags": [...]}. A recording
+// that does not exist is 404, so no sidecar is left without one.
+func transcriptTagsHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	fullPath := absPath(rel)
+	if _, err := os.Stat(fullPath); err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		meta, err := loadMeta(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string][]string{"tags": normalizeTags(meta.Tags)})
+	case http.MethodPut:
+		var payload struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		tags := normalizeTags(payload.Tags)
+
+		mu.Lock()
+		defer mu.Unlock()
+		meta, err := loadMeta(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		meta.Tags = tags
+		if err := saveMeta(fullPath, meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestLogger(r).Info("updated tags", "path", rel, "tags", tags)
+		publishEvent("tags.updated", rel, map[string]any{"tags": tags})
+		writeJSON(w, map[string][]string{"tags": tags})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listTagsHandler serves GET /api/tags with every tag in use and how many
+// recordings carry it, optionally within one ?workspace=.
+func listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	scope, err := workspaceScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	counts := map[string]int{}
+	err = walkRecordings(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isMetaFile(d.Name()) {
+			return nil
+		}
+		if rel, _ := relPath(path); !inWorkspace(rel, scope) {
+			return nil
+		}
+		meta, err := loadMeta(path)
+		if err != nil {
+			requestLogger(r).Warn("skipping unreadable metadata", "path", path, "err", err)
+			return nil
+		}
+		for _, tag := range normalizeTags(meta.Tags) {
+			counts[tag]++
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]tagCount, 0, len(counts))
+	for tag, n := range counts {
+		items = append(items, tagCount{Tag: tag, Count: n})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Tag < items[j].Tag })
+	writeJSON(w, items)
+}
+
+// normalizeTags trims, de-duplicates and sorts tags, dropping empty entries.
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// hasAllTags reports whether have contains every tag in want.
+func hasAllTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscriptTagsPutAndList(t *testing.T) {
+	dir := useTempBaseDir(t)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("ok"), 0o644); err != nil {
+			t.Fatalf("write file %s: %v", name, err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/a.txt/tags", strings.NewReader(`{"tags":[" acme ","interview","acme",""]}`))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d want %d body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "a.meta.json")); err != nil {
+		t.Fatalf("expected sidecar metadata: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/transcripts?tag=acme", nil)
+	rec = httptest.NewRecorder()
+	listTranscripts(rec, req)
+	var items []transcript
+	if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "a.txt" {
+		t.Fatalf("filtered items=%+v want only a.txt", items)
+	}
+	if got := strings.Join(items[0].Tags, ","); got != "acme,interview" {
+		t.Fatalf("tags=%q want %q", got, "acme,interview")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tags", nil)
+	rec = httptest.NewRecorder()
+	listTagsHandler(rec, req)
+	var counts []tagCount
+	if err := json.NewDecoder(rec.Body).Decode(&counts); err != nil {
+		t.Fatalf("decode tags: %v", err)
+	}
+	if len(counts) != 2 || counts[0] != (tagCount{Tag: "acme", Count: 1}) {
+		t.Fatalf("tag counts=%+v", counts)
+	}
+}
+
+func TestTranscriptTagsRejectsInvalidJSON(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a.txt")
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/a.txt/tags", strings.NewReader(`{`))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTranscriptTagsMissingRecording(t *testing.T) {
+	dir := useTempBaseDir(t)
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(method, "/api/transcripts/missing.txt/tags", strings.NewReader(`{"tags":["a"]}`)))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s status=%d want %d", method, rec.Code, http.StatusNotFound)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.meta.json")); !os.IsNotExist(err) {
+		t.Fatalf("orphan sidecar: %v", err)
+	}
+}
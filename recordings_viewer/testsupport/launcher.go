@@ -0,0 +1,68 @@
+// Package testsupport provides test doubles for the recordings viewer's
+// seams, for its own tests and for forks that build on them.
+package testsupport
+
+import "sync"
+
+// Launch is one process a FakeLauncher was asked to start.
+type Launch struct {
+	Name string
+	Args []string
+}
+
+// FakeLauncher satisfies the viewer's ProcessLauncher without starting
+// anything. It records every call; Err, when set, is returned from each.
+// It is safe for concurrent use.
+type FakeLauncher struct {
+	Err error
+
+	mu       sync.Mutex
+	started  []Launch
+	opened   []string
+	revealed []string
+}
+
+// Start records name and args.
+func (f *FakeLauncher) Start(name string, args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.started = append(f.started, Launch{Name: name, Args: append([]string(nil), args...)})
+	return f.Err
+}
+
+// Open records path.
+func (f *FakeLauncher) Open(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opened = append(f.opened, path)
+	return f.Err
+}
+
+// Reveal records path.
+func (f *FakeLauncher) Reveal(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revealed = append(f.revealed, path)
+	return f.Err
+}
+
+// Started returns the processes started so far.
+func (f *FakeLauncher) Started() []Launch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Launch(nil), f.started...)
+}
+
+// Opened returns the paths opened so far.
+func (f *FakeLauncher) Opened() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.opened...)
+}
+
+// Revealed returns the paths revealed so far.
+func (f *FakeLauncher) Revealed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.revealed...)
+}
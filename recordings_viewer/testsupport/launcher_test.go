@@ -0,0 +1,42 @@
+package testsupport
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFakeLauncherRecordsCalls(t *testing.T) {
+	f := &FakeLauncher{}
+	args := []string{"-R", "a.webm"}
+	if err := f.Start("open", args...); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	args[1] = "changed"
+	if err := f.Open("/tmp/x"); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got := f.Started()
+	if len(got) != 1 || got[0].Name != "open" || got[0].Args[1] != "a.webm" {
+		t.Fatalf("started=%+v", got)
+	}
+	if opened := f.Opened(); len(opened) != 1 || opened[0] != "/tmp/x" {
+		t.Fatalf("opened=%v", opened)
+	}
+	if err := f.Reveal("/tmp/x/a.webm"); err != nil {
+		t.Fatalf("Reveal: %v", err)
+	}
+	if revealed := f.Revealed(); len(revealed) != 1 || revealed[0] != "/tmp/x/a.webm" {
+		t.Fatalf("revealed=%v", revealed)
+	}
+}
+
+func TestFakeLauncherReturnsErr(t *testing.T) {
+	boom := errors.New("boom")
+	f := &FakeLauncher{Err: boom}
+	if err := f.Open("x"); !errors.Is(err, boom) {
+		t.Fatalf("Open err=%v", err)
+	}
+	if err := f.Start("x"); !errors.Is(err, boom) {
+		t.Fatalf("Start err=%v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// recordingTime is when a recording started: the instant in UTC plus the
+// UTC offset of the clock it was made on, e.g. "+09:00". Keeping the offset
+// lets a recording made abroad be grouped under the day it was made there
+// rather than the day it was on the server.
+type recordingTime struct {
+	At     time.Time `json:"at"`
+	Offset string    `json:"offset"`
+}
+
+// newRecordingTime captures t's instant and offset.
+func newRecordingTime(t time.Time) recordingTime {
+	return recordingTime{At: t.UTC(), Offset: t.Format("-07:00")}
+}
+
+// parseRecordingTime parses an RFC 3339 timestamp carrying the recorder's
+// offset, e.g. "2024-05-01T21:30:00+02:00".
+func parseRecordingTime(raw string) (recordingTime, error) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(raw))
+	if err != nil {
+		return recordingTime{}, fmt.Errorf("invalid recording time %q: want RFC 3339 with offset", raw)
+	}
+	return newRecordingTime(t), nil
+}
+
+// original returns the start time on the recorder's own clock.
+func (rt recordingTime) original() time.Time {
+	t, err := time.Parse("-07:00", rt.Offset)
+	if err != nil {
+		return rt.At
+	}
+	_, secs := t.Zone()
+	return rt.At.In(time.FixedZone(rt.Offset, secs))
+}
+
+// folderTimestamp matches the YYYYmmdd-HHMMSS stamp the extension host puts
+// in recording folder names.
+var folderTimestamp = regexp.MustCompile(`(?:^|[^0-9])([0-9]{8}-[0-9]{6})(?:[^0-9]|$)`)
+
+// sessionRecordingTime returns when s was recorded: the time stored in its
+// sidecar, else the host's folder stamp (written in the host's local time),
+// else the oldest file's modification time.
+func sessionRecordingTime(s *session, meta recordingMeta) recordingTime {
+	if meta.Recorded != nil && !meta.Recorded.At.IsZero() {
+		return *meta.Recorded
+	}
+	if m := folderTimestamp.FindStringSubmatch(s.ID); m != nil {
+		if t, err := time.ParseInLocation("20060102-150405", m[1], time.Local); err == nil {
+			return newRecordingTime(t)
+		}
+	}
+	return newRecordingTime(s.CreatedAt.In(time.Local))
+}
+
+// loadDisplayTimezone resolves a VIEWER_DISPLAY_TIMEZONE or ?tz= value: an
+// IANA name such as "Europe/Berlin", "UTC", "Local", or a fixed offset such
+// as "+05:30".
+func loadDisplayTimezone(name string) (*time.Location, error) {
+	switch name {
+	case "", "Local", "local":
+		return time.Local, nil
+	}
+	if name[0] == '+' || name[0] == '-' {
+		t, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %q", name)
+		}
+		_, secs := t.Zone()
+		return time.FixedZone(name, secs), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// displayTimezone returns the zone a listing request asked for with ?tz=,
+// defaulting to the server's display setting.
+func displayTimezone(r *http.Request) (*time.Location, error) {
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		return loadDisplayTimezone(tz)
+	}
+	if cfg().DisplayTimezone != nil {
+		return cfg().DisplayTimezone, nil
+	}
+	return time.Local, nil
+}
+
+// setRecorded fills s's recording time fields. RecordedDay is the date on
+// the recorder's clock.
+func (s *session) setRecorded(rt recordingTime) {
+	s.RecordedAt = rt.At
+	s.RecordedOffset = rt.Offset
+	s.RecordedDay = rt.original().Format(time.DateOnly)
+}
+
+// setDisplayZone renders s's start time and day in the display zone loc.
+func (s *session) setDisplayZone(loc *time.Location) {
+	if s.RecordedAt.IsZero() {
+		return
+	}
+	local := s.RecordedAt.In(loc)
+	s.DisplayTime = local.Format(time.RFC3339)
+	s.DisplayDay = local.Format(time.DateOnly)
+}
+
+// recordedAtHeader reads the optional X-Recorded-At header a client sends
+// with a recording upload.
+func recordedAtHeader(r *http.Request) (*recordingTime, error) {
+	raw := r.Header.Get("X-Recorded-At")
+	if raw == "" {
+		return nil, nil
+	}
+	rt, err := parseRecordingTime(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// setRecordedMeta stores rt as the start time in the sidecar of the
+// recording at fullPath. Callers hold mu.
+func setRecordedMeta(fullPath string, rt recordingTime) error {
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		return err
+	}
+	meta.Recorded = &rt
+	return saveMeta(fullPath, meta)
+}
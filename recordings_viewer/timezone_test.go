@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecordingTimeKeepsOffset(t *testing.T) {
+	rt, err := parseRecordingTime("2024-05-01T23:30:00+09:00")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !rt.At.Equal(time.Date(2024, 5, 1, 14, 30, 0, 0, time.UTC)) || rt.At.Location() != time.UTC {
+		t.Fatalf("at=%v", rt.At)
+	}
+	if rt.Offset != "+09:00" {
+		t.Fatalf("offset=%q", rt.Offset)
+	}
+	if got := rt.original().Format(time.RFC3339); got != "2024-05-01T23:30:00+09:00" {
+		t.Fatalf("original=%s", got)
+	}
+	if _, err := parseRecordingTime("2024-05-01 23:30"); err == nil {
+		t.Fatalf("expected error for timestamp without offset")
+	}
+}
+
+func TestLoadDisplayTimezone(t *testing.T) {
+	loc, err := loadDisplayTimezone("+05:30")
+	if err != nil {
+		t.Fatalf("offset: %v", err)
+	}
+	if _, off := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone(); off != 5*3600+30*60 {
+		t.Fatalf("offset=%d", off)
+	}
+	if loc, err := loadDisplayTimezone("UTC"); err != nil || loc != time.UTC {
+		t.Fatalf("UTC: %v %v", loc, err)
+	}
+	if _, err := loadDisplayTimezone("Mars/Olympus"); err == nil {
+		t.Fatalf("expected error for unknown zone")
+	}
+}
+
+func TestSessionsGroupByRecordedDay(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.DisplayTimezone = time.UTC })
+
+	// Recorded in Tokyo on the evening of May 1st, which is still the
+	// morning of May 1st in UTC; and on the morning of May 2nd in Tokyo,
+	// which is May 1st in UTC.
+	for name, stamp := range map[string]string{
+		"evening.webm": "2024-05-01T20:00:00+09:00",
+		"morning.webm": "2024-05-02T07:00:00+09:00",
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/api/transcripts/"+name, strings.NewReader(webmHeader+"audio"))
+		req.Header.Set("X-Recorded-At", stamp)
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("put %s: status=%d body=%s", name, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	sessionsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?day=2024-05-02", nil))
+	var got []session
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "morning" {
+		t.Fatalf("sessions=%+v want only morning", got)
+	}
+	s := got[0]
+	if s.RecordedOffset != "+09:00" || s.RecordedDay != "2024-05-02" {
+		t.Fatalf("recorded offset=%q day=%q", s.RecordedOffset, s.RecordedDay)
+	}
+	if s.DisplayDay != "2024-05-01" || s.DisplayTime != "2024-05-01T22:00:00Z" {
+		t.Fatalf("display day=%q time=%q", s.DisplayDay, s.DisplayTime)
+	}
+
+	rec = httptest.NewRecorder()
+	sessionsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/sessions/morning?tz=-04:00", nil))
+	var one session
+	json.NewDecoder(rec.Body).Decode(&one)
+	if one.DisplayTime != "2024-05-01T18:00:00-04:00" {
+		t.Fatalf("display time with tz=%q", one.DisplayTime)
+	}
+}
+
+func TestTranscriptPutRejectsInvalidRecordedAt(t *testing.T) {
+	dir := useTempBaseDir(t)
+	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/a.webm", strings.NewReader(webmHeader+"audio"))
+	req.Header.Set("X-Recorded-At", "yesterday")
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d want 400", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.webm")); !os.IsNotExist(err) {
+		t.Fatalf("file written despite invalid header: %v", err)
+	}
+}
+
+func TestSessionRecordingTimeFromFolderStamp(t *testing.T) {
+	s := &session{ID: "uuid/Meeting-20240501-213000-abc123/audio", CreatedAt: time.Now()}
+	rt := sessionRecordingTime(s, recordingMeta{})
+	want := time.Date(2024, 5, 1, 21, 30, 0, 0, time.Local)
+	if !rt.At.Equal(want) {
+		t.Fatalf("at=%v want %v", rt.At, want)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// trackSuffix matches the ".track-mic" marker that each synchronized track
+// of a multi-track capture carries between the stem and the extension, as
+// in "audio.track-tab.webm" and "audio.track-mic.webm".
+var trackSuffix = regexp.MustCompile(`\.track-([a-z0-9][a-z0-9_-]*)$`)
+
+// sessionTrack is one audio track of a multi-track session.
+type sessionTrack struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Speaker string `json:"speaker"`
+}
+
+// trackSpeakers names who is heard on the tracks the extension records: the
+// microphone is the user, the tab everyone else in the call.
+var trackSpeakers = map[string]string{"mic": "Me", "microphone": "Me", "tab": "Others"}
+
+func trackSpeaker(name string) string {
+	if s, ok := trackSpeakers[name]; ok {
+		return s
+	}
+	return name
+}
+
+// trackName returns the track a recording file is, if any.
+func trackName(name string) (string, bool) {
+	m := trackSuffix.FindStringSubmatch(strings.TrimSuffix(name, path.Ext(name)))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// trackPath returns the path of track name of the recording at rel, e.g.
+// "uuid/clip/audio.track-mic.webm" for "uuid/clip/audio.webm" and "mic".
+func trackPath(rel, name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !trackSuffix.MatchString(".track-" + name) {
+		return "", fmt.Errorf("invalid track name %q", name)
+	}
+	ext := path.Ext(rel)
+	stem := recordingStem(path.Base(rel))
+	return path.Join(path.Dir(rel), stem+".track-"+name+ext), nil
+}
+
+// addTrack records the track file rel in s. Without an audio file of its
+// own, the first track stands in for the session's audio.
+func (s *session) addTrack(rel, name string) {
+	s.Tracks = append(s.Tracks, sessionTrack{Name: name, Path: rel, Speaker: trackSpeaker(name)})
+	sort.Slice(s.Tracks, func(i, j int) bool { return s.Tracks[i].Name < s.Tracks[j].Name })
+	if _, isTrack := trackName(path.Base(s.Audio)); s.Audio == "" || isTrack {
+		s.Audio = s.Tracks[0].Path
+	}
+}
+
+// trackTranscript is the whisper JSON an engine produced for one track.
+type trackTranscript struct {
+	Track sessionTrack
+	Raw   []byte
+}
+
+// mergeTrackTranscripts interleaves the segments of each track's transcript
+// by start time into one whisper-style document, marking each segment with
+// its track and speaker, and renders the plain text with a speaker label
+// wherever the speaker changes.
+func mergeTrackTranscripts(parts []trackTranscript) ([]byte, string, error) {
+	type tagged struct {
+		start float64
+		seg   map[string]json.RawMessage
+	}
+	var all []tagged
+	doc := map[string]json.RawMessage{}
+	for _, p := range parts {
+		var src map[string]json.RawMessage
+		if err := json.Unmarshal(p.Raw, &src); err != nil {
+			return nil, "", fmt.Errorf("track %s: %w", p.Track.Name, err)
+		}
+		if _, ok := doc["language"]; !ok && len(src["language"]) > 0 {
+			doc["language"] = src["language"]
+		}
+		var segs []map[string]json.RawMessage
+		if len(src["segments"]) > 0 {
+			if err := json.Unmarshal(src["segments"], &segs); err != nil {
+				return nil, "", fmt.Errorf("track %s: %w", p.Track.Name, err)
+			}
+		}
+		for _, seg := range segs {
+			var start float64
+			json.Unmarshal(seg["start"], &start)
+			seg["track"], _ = json.Marshal(p.Track.Name)
+			seg["speaker"], _ = json.Marshal(p.Track.Speaker)
+			all = append(all, tagged{start, seg})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].start < all[j].start })
+
+	segs := make([]map[string]json.RawMessage, len(all))
+	var text, plain strings.Builder
+	speaker := ""
+	for i, t := range all {
+		t.seg["id"], _ = json.Marshal(i)
+		segs[i] = t.seg
+		var s segment
+		raw, _ := json.Marshal(t.seg)
+		json.Unmarshal(raw, &s)
+		text.WriteString(s.Text)
+		line := strings.TrimSpace(s.Text)
+		if line == "" {
+			continue
+		}
+		switch {
+		case s.Speaker != speaker:
+			if plain.Len() > 0 {
+				plain.WriteString("\n")
+			}
+			fmt.Fprintf(&plain, "%s: %s", s.Speaker, line)
+			speaker = s.Speaker
+		default:
+			plain.WriteString(" " + line)
+		}
+	}
+	doc["text"], _ = json.Marshal(text.String())
+	doc["segments"], _ = json.Marshal(segs)
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, plain.String(), nil
+}
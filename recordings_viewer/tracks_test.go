@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracksGroupIntoOneSession(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "uuid/clip/audio.track-tab.webm", "uuid/clip/audio.track-mic.webm")
+	sessions, err := scanSessions()
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("sessions=%+v err=%v", sessions, err)
+	}
+	s := sessions[0]
+	if s.ID != "uuid/clip/audio" || len(s.Tracks) != 2 || s.Audio != "uuid/clip/audio.track-mic.webm" {
+		t.Fatalf("session=%+v", s)
+	}
+	if s.Tracks[0].Speaker != "Me" || s.Tracks[1] != (sessionTrack{Name: "tab", Path: "uuid/clip/audio.track-tab.webm", Speaker: "Others"}) {
+		t.Fatalf("tracks=%+v", s.Tracks)
+	}
+}
+
+func TestUploadTrackPath(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.S3 = s3Config{} })
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(`{"path": "uuid/clip/audio.webm", "track": "Mic"}`)))
+	var res struct{ Path, URL string }
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if rec.Code != http.StatusOK || res.Path != "uuid/clip/audio.track-mic.webm" || res.URL != "/api/transcripts/uuid/clip/audio.track-mic.webm" {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(`{"path": "audio.webm", "track": "../mic"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad track: %d", rec.Code)
+	}
+}
+
+func TestTranscribeTracksMergesBySpeaker(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "call.track-tab.webm", "call.track-mic.webm")
+	transcripts := map[string]string{
+		"call.track-tab": `{"text":" Hi there. How was the trip?","language":"en","segments":[{"id":0,"start":0,"end":2,"text":" Hi there."},{"id":1,"start":5,"end":7,"text":" How was the trip?"}]}`,
+		"call.track-mic": `{"text":" Hello! Long.","language":"en","segments":[{"id":0,"start":2.5,"end":4,"text":" Hello!"},{"id":1,"start":8,"end":9,"text":" Long."}]}`,
+	}
+	fakeWhisper(t, "60", func(_ context.Context, args []string) ([]byte, error) {
+		stem := strings.TrimSuffix(filepath.Base(args[0]), ".webm")
+		doc, ok := transcripts[stem]
+		if !ok {
+			return nil, fmt.Errorf("unexpected input %s", args[0])
+		}
+		return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), stem+".json"), []byte(doc), 0o644)
+	})
+
+	j := queueTranscription(t, "call.track-tab.webm")
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted || strings.Join(got.Output, ",") != "call.json,call.txt" {
+		t.Fatalf("job=%+v", got)
+	}
+
+	text, _ := os.ReadFile(filepath.Join(dir, "call.txt"))
+	if want := "Others: Hi there.\nMe: Hello!\nOthers: How was the trip?\nMe: Long.\n"; string(text) != want {
+		t.Fatalf("txt=%q want %q", text, want)
+	}
+	doc, err := loadTranscriptDoc(filepath.Join(dir, "call.track-mic.webm"))
+	if err != nil || len(doc.Segments) != 4 || doc.Language != "en" {
+		t.Fatalf("doc=%+v err=%v", doc, err)
+	}
+	if s := doc.Segments[1]; s.ID != 1 || s.Speaker != "Me" || s.Start != 2.5 {
+		t.Fatalf("segment=%+v", s)
+	}
+	if srt := renderSRT(doc, provenance{}); !strings.Contains(srt, "Me: Hello!") {
+		t.Fatalf("srt=%s", srt)
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "call.json"))
+	if meta.Transcription == nil || strings.Join(meta.Transcription.Tracks, ",") != "mic,tab" {
+		t.Fatalf("transcription=%+v", meta.Transcription)
+	}
+	s, _ := findSession("call")
+	if !s.hasTranscript() || len(s.Tracks) != 2 {
+		t.Fatalf("session=%+v", s)
+	}
+}
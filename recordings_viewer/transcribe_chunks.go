@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// audioChunk is one piece of a long recording transcribed on its own.
+// Core is the part whose segments it contributes to the transcript; Range,
+// what the engine hears, reaches into its neighbours by the overlap so no
+// word is cut at the boundary.
+type audioChunk struct {
+	Core  timeRange
+	Range timeRange
+}
+
+// planChunks splits [start, end) seconds into pieces of about length that
+// overlap by overlap, all of the same size so the last is not a sliver.
+func planChunks(start, end float64, length, overlap time.Duration) []audioChunk {
+	n := int(math.Ceil((end - start) / length.Seconds()))
+	if n < 1 {
+		n = 1
+	}
+	size := (end - start) / float64(n)
+	chunks := make([]audioChunk, n)
+	for i := range chunks {
+		core := timeRange{Start: start + float64(i)*size, End: start + float64(i+1)*size}
+		if i == n-1 {
+			core.End = end
+		}
+		chunks[i] = audioChunk{
+			Core:  core,
+			Range: timeRange{Start: max(core.Start-overlap.Seconds(), start), End: min(core.End+overlap.Seconds(), end)},
+		}
+	}
+	return chunks
+}
+
+// runEngineChunked is runEngine for audio longer than cfg.ChunkOver: the
+// job's range of it, or all of it, is split by planChunks and the pieces
+// are transcribed cfg.ChunkWorkers at a time, then merged by
+// mergeChunkTranscripts. Shorter audio, or with chunking off, goes to
+// runEngine as it is.
+func runEngineChunked(ctx context.Context, j job, engine engineConfig, audio, outDir string) ([]byte, time.Duration, error) {
+	if cfg().ChunkOver <= 0 || cfg().ChunkLength <= 0 {
+		return runEngine(ctx, j, engine, audio, outDir)
+	}
+	duration, err := probeDuration(audio)
+	if err != nil {
+		return runEngine(ctx, j, engine, audio, outDir)
+	}
+	tr := timeRange{End: duration.Seconds()}
+	if j.Range != nil {
+		tr.Start = j.Range.Start
+		if j.Range.End != 0 {
+			tr.End = min(j.Range.End, tr.End)
+		}
+	}
+	if time.Duration((tr.End-tr.Start)*float64(time.Second)) <= cfg().ChunkOver {
+		return runEngine(ctx, j, engine, audio, outDir)
+	}
+	chunks := planChunks(tr.Start, tr.End, cfg().ChunkLength, cfg().ChunkOverlap)
+	workers := max(cfg().ChunkWorkers, 1)
+	slog.Info("transcribing in chunks", "job", j.ID, "chunks", len(chunks), "workers", workers)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	raws := make([][]byte, len(chunks))
+	var (
+		chunkMu sync.Mutex
+		timeout time.Duration
+		failed  error
+		wg      sync.WaitGroup
+	)
+	sem := make(chan struct{}, workers)
+	for i, c := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return
+			}
+			dir := filepath.Join(outDir, fmt.Sprintf("chunk-%03d", i))
+			part := j
+			part.Range = &c.Range
+			var t time.Duration
+			err := os.MkdirAll(dir, 0o755)
+			if err == nil {
+				raws[i], t, err = runEngine(ctx, part, engine, audio, dir)
+			}
+			chunkMu.Lock()
+			defer chunkMu.Unlock()
+			timeout = max(timeout, t)
+			// The chunk that failed first is the one to report, not
+			// those stopped after it.
+			if err != nil && failed == nil {
+				failed = fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	if failed != nil {
+		return nil, timeout, failed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, timeout, err
+	}
+	raw, err := mergeChunkTranscripts(chunks, raws)
+	if err != nil {
+		return nil, timeout, fmt.Errorf("merge chunks: %w", err)
+	}
+	return raw, timeout, nil
+}
+
+// chunkTimingSlack is how much earlier than the covered audio a chunk may
+// start a segment and still have it kept: chunks time the same speech a
+// little differently, but not by more.
+const chunkTimingSlack = 1.0
+
+// chunkTranscript is the part of a chunk's whisper JSON the merge reads;
+// segments are kept raw so fields it does not know survive.
+type chunkTranscript struct {
+	Language json.RawMessage   `json:"language"`
+	Segments []json.RawMessage `json:"segments"`
+}
+
+// mergeChunkTranscripts joins the whisper JSON of each chunk, whose
+// timestamps are already those of the whole recording, into one. Each
+// chunk contributes the segments that start before the end of its core,
+// less those the chunks before it already cover: a segment starting more
+// than chunkTimingSlack before the end of the last one kept was heard in
+// the overlap and is dropped, even when the two chunks time it
+// differently.
+func mergeChunkTranscripts(chunks []audioChunk, raws [][]byte) ([]byte, error) {
+	var language json.RawMessage
+	segs := []map[string]json.RawMessage{}
+	var text string
+	covered := math.Inf(-1)
+	for i, raw := range raws {
+		var src chunkTranscript
+		if err := json.Unmarshal(raw, &src); err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i+1, err)
+		}
+		if language == nil && len(src.Language) > 0 {
+			language = src.Language
+		}
+		core := chunks[i].Core
+		last := i == len(chunks)-1
+		for _, rawSeg := range src.Segments {
+			var s segment
+			if err := json.Unmarshal(rawSeg, &s); err != nil {
+				return nil, fmt.Errorf("chunk %d: segment: %w", i+1, err)
+			}
+			if (s.Start >= core.End && !last) || s.Start < covered-chunkTimingSlack {
+				continue
+			}
+			var seg map[string]json.RawMessage
+			if err := json.Unmarshal(rawSeg, &seg); err != nil {
+				return nil, fmt.Errorf("chunk %d: segment: %w", i+1, err)
+			}
+			seg["id"] = json.RawMessage(strconv.Itoa(len(segs)))
+			segs = append(segs, seg)
+			text += s.Text
+			covered = max(covered, s.End)
+		}
+	}
+	doc := map[string]any{"text": text, "segments": segs}
+	if language != nil {
+		doc["language"] = language
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlanChunks(t *testing.T) {
+	chunks := planChunks(0, 1500, 10*time.Minute, 5*time.Second)
+	want := []audioChunk{
+		{Core: timeRange{0, 500}, Range: timeRange{0, 505}},
+		{Core: timeRange{500, 1000}, Range: timeRange{495, 1005}},
+		{Core: timeRange{1000, 1500}, Range: timeRange{995, 1500}},
+	}
+	if fmt.Sprint(chunks) != fmt.Sprint(want) {
+		t.Fatalf("chunks = %v", chunks)
+	}
+	if chunks := planChunks(100, 400, 10*time.Minute, 5*time.Second); len(chunks) != 1 || chunks[0].Range != (timeRange{100, 400}) {
+		t.Fatalf("short = %v", chunks)
+	}
+}
+
+func TestMergeChunkTranscripts(t *testing.T) {
+	chunks := planChunks(0, 200, 100*time.Second, 5*time.Second)
+	raws := [][]byte{
+		[]byte(`{"language": "en", "segments": [{"id": 0, "start": 0, "end": 50, "text": " one"}, {"id": 1, "start": 97, "end": 103, "text": " two"}]}`),
+		[]byte(`{"language": "en", "segments": [{"id": 0, "start": 96, "end": 103, "text": " two"}, {"id": 1, "start": 103, "end": 180, "text": " three"}]}`),
+	}
+	raw, err := mergeChunkTranscripts(chunks, raws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Language string    `json:"language"`
+		Text     string    `json:"text"`
+		Segments []segment `json:"segments"`
+	}
+	json.Unmarshal(raw, &doc)
+	// " two" is heard by both chunks, timed a little differently, and kept
+	// once.
+	if doc.Language != "en" || doc.Text != " one two three" || len(doc.Segments) != 3 || doc.Segments[1].End != 103 || doc.Segments[2].ID != 2 {
+		t.Fatalf("merged = %+v", doc)
+	}
+}
+
+func TestMergeChunkTranscriptsDropsPhraseTimedEarlier(t *testing.T) {
+	chunks := planChunks(0, 200, 100*time.Second, 5*time.Second)
+	// The second chunk runs " two" together with the silence before it, so
+	// it starts well before the first chunk's copy ends but its middle
+	// falls after it.
+	raws := [][]byte{
+		[]byte(`{"segments": [{"id": 0, "start": 0, "end": 50, "text": " one"}, {"id": 1, "start": 97, "end": 103, "text": " two", "avg_logprob": -0.2}]}`),
+		[]byte(`{"segments": [{"id": 0, "start": 90, "end": 118, "text": " two"}, {"id": 1, "start": 118, "end": 180, "text": " three"}]}`),
+	}
+	raw, err := mergeChunkTranscripts(chunks, raws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Text     string           `json:"text"`
+		Segments []map[string]any `json:"segments"`
+	}
+	json.Unmarshal(raw, &doc)
+	if doc.Text != " one two three" || len(doc.Segments) != 3 || doc.Segments[1]["avg_logprob"] != -0.2 {
+		t.Fatalf("merged = %s", raw)
+	}
+
+	if _, err := mergeChunkTranscripts(chunks, [][]byte{raws[0], []byte(`{"segments": [{"start": "soon"}]}`)}); err == nil {
+		t.Fatal("malformed segment merged")
+	}
+}
+
+func TestRunJobTranscribesLongAudioInChunks(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	useConfig(t, func(c *config) {
+		c.ChunkOver, c.ChunkLength, c.ChunkOverlap, c.ChunkWorkers = 20*time.Minute, 10*time.Minute, 5*time.Second, 2
+	})
+	writeTestFiles(t, dir, "long.webm")
+
+	// The recording has a four-second segment every 100 seconds. ffmpeg
+	// writes the range it cut into the prepared file, and whisper answers
+	// with the segments in it, timed from the start of the range.
+	var running, peak atomic.Int32
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ffprobe":
+			return []byte("1500"), nil
+		case "ffmpeg":
+			return nil, os.WriteFile(args[len(args)-1], []byte(argAfter(args, "-ss")+" "+argAfter(args, "-to")), 0o644)
+		case "whisper":
+			n := running.Add(1)
+			defer running.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(50 * time.Millisecond)
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return nil, err
+			}
+			bounds := strings.Fields(string(data))
+			from, _ := strconv.ParseFloat(bounds[0], 64)
+			to, _ := strconv.ParseFloat(bounds[1], 64)
+			segs := []map[string]any{}
+			for k := 0; k < 15; k++ {
+				if start := float64(k * 100); start >= from && start+4 <= to {
+					segs = append(segs, map[string]any{"start": start - from, "end": start - from + 4, "text": fmt.Sprintf(" s%d", k)})
+				}
+			}
+			out, _ := json.Marshal(map[string]any{"language": "en", "segments": segs})
+			return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), "long.json"), out, 0o644)
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	})
+
+	j := queueTranscription(t, "long.webm")
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted {
+		t.Fatalf("job = %+v", got)
+	}
+	if p := peak.Load(); p != 2 {
+		t.Errorf("ran %d chunks at once, want 2", p)
+	}
+	var doc struct {
+		Segments []segment `json:"segments"`
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "long.json"))
+	json.Unmarshal(data, &doc)
+	if len(doc.Segments) != 15 || doc.Segments[5].Start != 500 || doc.Segments[5].Text != " s5" || doc.Segments[14].ID != 14 {
+		t.Fatalf("segments = %+v", doc.Segments)
+	}
+	text, _ := os.ReadFile(filepath.Join(dir, "long.txt"))
+	if !strings.HasPrefix(string(text), "s0 s1 s2") || !strings.HasSuffix(string(text), "s13 s14\n") {
+		t.Fatalf("text = %q", text)
+	}
+}
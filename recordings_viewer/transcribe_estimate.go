@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxThroughputSamples is how many of the last transcriptions by each
+// engine and model the estimates are based on, so they follow the machine
+// as it changes.
+const maxThroughputSamples = 20
+
+// throughputSample is one finished transcription: how much audio it had
+// and how long it ran.
+type throughputSample struct {
+	AudioSeconds float64   `json:"audioSeconds"`
+	WallSeconds  float64   `json:"wallSeconds"`
+	FinishedAt   time.Time `json:"finishedAt"`
+}
+
+// throughputStats is persisted in .viewer/throughput.json: the last
+// samples by "{engine}/{model}".
+type throughputStats struct {
+	Models map[string][]throughputSample `json:"models"`
+}
+
+// throughputMu serialises updates of the stats.
+var throughputMu sync.Mutex
+
+func throughputPath() string {
+	return filepath.Join(stateDir(), "throughput.json")
+}
+
+func loadThroughput() (throughputStats, error) {
+	stats := throughputStats{Models: map[string][]throughputSample{}}
+	data, err := os.ReadFile(throughputPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return stats, err
+	}
+	if stats.Models == nil {
+		stats.Models = map[string][]throughputSample{}
+	}
+	return stats, nil
+}
+
+// recordThroughput adds a transcription of audio that took wall by j's
+// engine and model to the stats.
+func recordThroughput(j job, audio, wall time.Duration) error {
+	if audio <= 0 || wall <= 0 {
+		return nil
+	}
+	throughputMu.Lock()
+	defer throughputMu.Unlock()
+	stats, err := loadThroughput()
+	if err != nil {
+		return err
+	}
+	key := j.Engine + "/" + j.Model
+	samples := append(stats.Models[key], throughputSample{AudioSeconds: audio.Seconds(), WallSeconds: wall.Seconds(), FinishedAt: time.Now().UTC()})
+	if len(samples) > maxThroughputSamples {
+		samples = samples[len(samples)-maxThroughputSamples:]
+	}
+	stats.Models[key] = samples
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(throughputPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// transcribedAudio is how much audio a finished transcription job went
+// through: each track of a multi-track session and each channel it split
+// counts.
+func transcribedAudio(j job) (time.Duration, error) {
+	d, err := recordingDuration(j.Path)
+	if err != nil {
+		return 0, err
+	}
+	if j.Range != nil {
+		d = j.Range.length(d)
+	}
+	if s, err := findSession(j.Path); err == nil && len(s.Tracks) > 1 {
+		d *= time.Duration(len(s.Tracks))
+	} else if j.SplitChannels {
+		d *= 2
+	}
+	return d, nil
+}
+
+// transcribeEstimate is how long a transcription by Model is expected to
+// run. Basis is "history" when the server has timed Samples transcriptions
+// by the engine and model, and "engine" when it has not and the engine's
+// configured real-time factor, the one its watchdog uses, stands in.
+type transcribeEstimate struct {
+	Model          string  `json:"model"`
+	Seconds        float64 `json:"seconds"`
+	RealtimeFactor float64 `json:"realtimeFactor"`
+	Basis          string  `json:"basis"`
+	Samples        int     `json:"samples,omitempty"`
+	Cost           float64 `json:"cost,omitempty"`
+}
+
+// estimateTranscription estimates a transcription of audio seconds by
+// engine and model from the stats.
+func estimateTranscription(stats throughputStats, engine, model string, audio float64) transcribeEstimate {
+	e := transcribeEstimate{Model: model, RealtimeFactor: cfg().Engines[engine].RTF, Basis: "engine"}
+	var audioSum, wallSum float64
+	samples := stats.Models[engine+"/"+model]
+	for _, s := range samples {
+		audioSum += s.AudioSeconds
+		wallSum += s.WallSeconds
+	}
+	if audioSum > 0 {
+		e.RealtimeFactor, e.Basis, e.Samples = wallSum/audioSum, "history", len(samples)
+	}
+	e.Seconds = audio * e.RealtimeFactor
+	if c := cfg().Engines[engine].CostPerMinute; c > 0 {
+		e.Cost = audio / 60 * c
+	}
+	return e
+}
+
+// transcribeEstimateHandler serves GET /api/recordings/{id}/estimate: how
+// long transcribing the session's audio would take with ?model= (which may
+// be repeated; the default model otherwise) and ?engine=, from the speed
+// of the server's recent transcriptions. A session of several tracks is
+// transcribed one track at a time, so each track counts.
+func transcribeEstimateHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, err := findSession(id)
+	if err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	if s.Audio == "" {
+		http.Error(w, "recording has no audio", http.StatusNotFound)
+		return
+	}
+	engine := r.URL.Query().Get("engine")
+	if engine == "" {
+		engine = cfg().DefaultEngine
+	}
+	if _, ok := cfg().Engines[engine]; !ok {
+		http.Error(w, "unknown engine", http.StatusBadRequest)
+		return
+	}
+	models := r.URL.Query()["model"]
+	if len(models) == 0 {
+		model := defaultModel()
+		if t := recordingTemplate(s.Audio); t != nil && t.Model != "" {
+			model = t.Model
+		}
+		models = []string{model}
+	}
+	parts := s.Parts
+	if len(parts) == 0 {
+		parts = []string{s.Audio}
+	}
+	var duration time.Duration
+	for _, rel := range parts {
+		d, err := recordingDuration(rel)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("the duration of %s could not be read", rel), http.StatusUnprocessableEntity)
+			return
+		}
+		duration += d
+	}
+	audio := duration.Seconds() * float64(max(len(s.Tracks), 1))
+
+	throughputMu.Lock()
+	stats, err := loadThroughput()
+	throughputMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	estimates := make([]transcribeEstimate, 0, len(models))
+	for _, model := range models {
+		estimates = append(estimates, estimateTranscription(stats, engine, model, audio))
+	}
+	writeJSON(w, map[string]any{"session": s.ID, "duration": duration.Seconds(), "audioSeconds": audio, "engine": engine, "estimates": estimates})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type estimateResponse struct {
+	Duration  float64              `json:"duration"`
+	Engine    string               `json:"engine"`
+	Estimates []transcribeEstimate `json:"estimates"`
+}
+
+func getEstimate(t *testing.T, url string) (int, estimateResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	var res estimateResponse
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	return rec.Code, res
+}
+
+func TestTranscribeEstimate(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 0.5, TimeoutMultiple: 3, MinTimeout: time.Minute})
+	writeTestFiles(t, dir, "call.webm")
+	fakeWhisper(t, "600", func(_ context.Context, args []string) ([]byte, error) {
+		return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), "call.json"), []byte(`{"text":"hi","segments":[]}`), 0o644)
+	})
+
+	// Without history the engine's real-time factor stands in.
+	code, res := getEstimate(t, "/api/recordings/call/estimate?model=small")
+	if code != http.StatusOK || res.Duration != 600 || res.Engine != "whisper" || len(res.Estimates) != 1 {
+		t.Fatalf("estimate = %d %+v", code, res)
+	}
+	if e := res.Estimates[0]; e.Model != "small" || e.Basis != "engine" || e.Seconds != 300 {
+		t.Fatalf("small = %+v", e)
+	}
+
+	runJob(queueTranscription(t, "call.webm"))
+	stats, _ := loadThroughput()
+	if samples := stats.Models["whisper/base"]; len(samples) != 1 || samples[0].AudioSeconds != 600 || samples[0].WallSeconds <= 0 {
+		t.Fatalf("samples = %+v", stats.Models)
+	}
+
+	// Estimates follow the recent transcriptions by the model.
+	stats.Models["whisper/base"] = []throughputSample{{AudioSeconds: 100, WallSeconds: 10}, {AudioSeconds: 300, WallSeconds: 110}}
+	data, _ := json.Marshal(stats)
+	os.WriteFile(throughputPath(), data, 0o644)
+	code, res = getEstimate(t, "/api/recordings/call/estimate?model=base&model=small")
+	if code != http.StatusOK || len(res.Estimates) != 2 {
+		t.Fatalf("estimates = %d %+v", code, res)
+	}
+	if e := res.Estimates[0]; e.Basis != "history" || e.Samples != 2 || e.RealtimeFactor != 0.3 || e.Seconds != 180 {
+		t.Fatalf("base = %+v", e)
+	}
+	if e := res.Estimates[1]; e.Basis != "engine" {
+		t.Fatalf("small = %+v", e)
+	}
+	// The default model is estimated when none is asked for.
+	if _, res = getEstimate(t, "/api/recordings/call/estimate"); len(res.Estimates) != 1 || res.Estimates[0].Model != "base" {
+		t.Fatalf("default = %+v", res)
+	}
+
+	if code, _ := getEstimate(t, "/api/recordings/call/estimate?engine=nope"); code != http.StatusBadRequest {
+		t.Errorf("unknown engine = %d", code)
+	}
+	if code, _ := getEstimate(t, "/api/recordings/missing/estimate"); code != http.StatusNotFound {
+		t.Errorf("unknown recording = %d", code)
+	}
+}
+
+func TestRecordThroughputKeepsRecentSamples(t *testing.T) {
+	useTempBaseDir(t)
+	j := job{Engine: "whisper", Model: "tiny"}
+	for i := 1; i <= maxThroughputSamples+3; i++ {
+		recordThroughput(j, time.Duration(i)*time.Minute, time.Second)
+	}
+	stats, _ := loadThroughput()
+	samples := stats.Models["whisper/tiny"]
+	if len(samples) != maxThroughputSamples || samples[0].AudioSeconds != 4*60 {
+		t.Fatalf("samples = %d, first %+v", len(samples), samples[0])
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeRange is the part of a recording a transcription covers, in seconds
+// from its start. A zero End runs to the end of the recording.
+type timeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end,omitempty"`
+}
+
+func (tr timeRange) check() error {
+	switch {
+	case math.IsNaN(tr.Start) || math.IsNaN(tr.End) || tr.Start < 0 || tr.End < 0:
+		return errors.New("range start and end must be seconds, at least 0")
+	case tr.End != 0 && tr.End <= tr.Start:
+		return errors.New("range end must be after its start")
+	}
+	return nil
+}
+
+// within fits tr to a recording of duration d, which is unknown when zero.
+func (tr timeRange) within(d time.Duration) (timeRange, error) {
+	total := d.Seconds()
+	if total <= 0 {
+		return tr, nil
+	}
+	if tr.Start >= total {
+		return tr, fmt.Errorf("range starts at %gs but the recording is %.1fs long", tr.Start, total)
+	}
+	if tr.End > total {
+		tr.End = 0
+	}
+	return tr, nil
+}
+
+// length is how much audio tr covers of a recording of duration d.
+func (tr timeRange) length(d time.Duration) time.Duration {
+	end := d.Seconds()
+	if tr.End != 0 {
+		end = tr.End
+	}
+	if end <= tr.Start {
+		return 0
+	}
+	return time.Duration((end - tr.Start) * float64(time.Second))
+}
+
+// prepareForTranscription cuts tr, when given, out of audio into outDir as
+// <stem>.wav, cleaning it up with enhanceFilters if enhance is set. It is
+// written in the 16 kHz mono whisper resamples to anyway, so the engine's
+// transcript still lands as <stem>.json.
+func prepareForTranscription(ctx context.Context, audio, outDir string, tr *timeRange, enhance bool) (string, error) {
+	stem := strings.TrimSuffix(filepath.Base(audio), filepath.Ext(audio))
+	out := filepath.Join(outDir, stem+".wav")
+	args := []string{"-hide_banner", "-loglevel", "error", "-y"}
+	if tr != nil {
+		args = append(args, "-ss", formatSeconds(tr.Start))
+		if tr.End != 0 {
+			args = append(args, "-to", formatSeconds(tr.End))
+		}
+	}
+	args = append(args, "-i", audio, "-vn")
+	if enhance {
+		args = append(args, "-af", enhanceFilters())
+	}
+	args = append(args, "-ac", "1", "-ar", "16000", out)
+	if output, err := runCommandFunc(ctx, cfg().FFmpegPath, args...); err != nil {
+		return "", &jobDiagnostics{msg: fmt.Sprintf("prepare audio: %v", err), detail: outputTail(output)}
+	}
+	return out, nil
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
+
+// offsetTranscript shifts the segment and word timestamps of a whisper
+// JSON transcript by offset seconds, so a transcript of a trimmed range
+// lines up with the whole recording. Other fields are kept as they are.
+func offsetTranscript(raw []byte, offset float64) ([]byte, error) {
+	if offset == 0 {
+		return raw, nil
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	var segs []map[string]json.RawMessage
+	if len(doc["segments"]) == 0 || json.Unmarshal(doc["segments"], &segs) != nil {
+		return raw, nil
+	}
+	for _, seg := range segs {
+		shiftTimes(seg, offset)
+		var words []map[string]json.RawMessage
+		if json.Unmarshal(seg["words"], &words) != nil || len(words) == 0 {
+			continue
+		}
+		for _, w := range words {
+			shiftTimes(w, offset)
+		}
+		seg["words"], _ = json.Marshal(words)
+	}
+	var err error
+	if doc["segments"], err = json.Marshal(segs); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+func shiftTimes(obj map[string]json.RawMessage, offset float64) {
+	for _, k := range []string{"start", "end"} {
+		var v float64
+		if json.Unmarshal(obj[k], &v) == nil {
+			// Round away float noise such as 600.1200000000001.
+			obj[k], _ = json.Marshal(math.Round((v+offset)*1000) / 1000)
+		}
+	}
+}
+
+// mergeRangeTranscript puts the whisper JSON of a transcription of tr, raw,
+// into the existing transcript of the whole recording: its segments replace
+// those of existing that overlap tr, and the rest of existing is kept, so
+// transcribing a range never loses the transcript around it. It returns the
+// merged JSON and its text.
+func mergeRangeTranscript(existing, raw []byte, tr timeRange) ([]byte, string, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(existing, &doc); err != nil {
+		return nil, "", fmt.Errorf("existing transcript: %w", err)
+	}
+	var old, fresh chunkTranscript
+	if err := json.Unmarshal(existing, &old); err != nil {
+		return nil, "", fmt.Errorf("existing transcript: %w", err)
+	}
+	if err := json.Unmarshal(raw, &fresh); err != nil {
+		return nil, "", err
+	}
+	end := tr.End
+	if end == 0 {
+		end = math.Inf(1)
+	}
+	type keptSegment struct {
+		segment
+		raw map[string]json.RawMessage
+	}
+	var kept []keptSegment
+	add := func(rawSeg json.RawMessage, outside bool) error {
+		var s segment
+		var seg map[string]json.RawMessage
+		if err := json.Unmarshal(rawSeg, &s); err != nil {
+			return fmt.Errorf("segment: %w", err)
+		}
+		if err := json.Unmarshal(rawSeg, &seg); err != nil {
+			return fmt.Errorf("segment: %w", err)
+		}
+		if !outside || s.End <= tr.Start || s.Start >= end {
+			kept = append(kept, keptSegment{s, seg})
+		}
+		return nil
+	}
+	for _, rawSeg := range old.Segments {
+		if err := add(rawSeg, true); err != nil {
+			return nil, "", fmt.Errorf("existing transcript: %w", err)
+		}
+	}
+	for _, rawSeg := range fresh.Segments {
+		if err := add(rawSeg, false); err != nil {
+			return nil, "", err
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Start < kept[j].Start })
+
+	segs := make([]map[string]json.RawMessage, 0, len(kept))
+	var text string
+	for i, s := range kept {
+		s.raw["id"] = json.RawMessage(strconv.Itoa(i))
+		segs = append(segs, s.raw)
+		text += s.Text
+	}
+	var err error
+	if doc["segments"], err = json.Marshal(segs); err != nil {
+		return nil, "", err
+	}
+	if doc["text"], err = json.Marshal(text); err != nil {
+		return nil, "", err
+	}
+	if len(doc["language"]) == 0 && len(fresh.Language) > 0 {
+		doc["language"] = fresh.Language
+	}
+	merged, err := json.Marshal(doc)
+	return merged, text, err
+}
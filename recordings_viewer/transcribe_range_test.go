@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscribeRangeTrimsAndOffsetsTimestamps(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 2, MinTimeout: time.Second})
+	writeTestFiles(t, dir, "long.webm")
+	var trimArgs, engineInput []string
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ffprobe":
+			return []byte("3600"), nil
+		case "ffmpeg":
+			trimArgs = args
+			return nil, os.WriteFile(args[len(args)-1], []byte("pcm"), 0o644)
+		case "whisper":
+			engineInput = args
+			doc := `{"text":" wrap up","segments":[{"id":0,"start":1.5,"end":4,"text":" wrap up","words":[{"word":"wrap","start":1.5,"end":2.25}]}],"language":"en"}`
+			return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), "long.json"), []byte(doc), 0o644)
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	})
+
+	rec := httptest.NewRecorder()
+	transcribeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path": "long.webm", "range": {"start": 3000, "end": 4000}}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("queue: %d %s", rec.Code, rec.Body)
+	}
+	j, _ := jobs.claim()
+	// An end past the recording runs to its end.
+	if j.Range == nil || j.Range.Start != 3000 || j.Range.End != 0 {
+		t.Fatalf("range=%+v", j.Range)
+	}
+	runJob(j)
+
+	got, _ := jobs.get(j.ID)
+	if got.Status != jobCompleted || got.Timeout != 1200 {
+		t.Fatalf("job=%+v", got)
+	}
+	if argAfter(trimArgs, "-ss") != "3000" || argAfter(trimArgs, "-to") != "" || argAfter(trimArgs, "-i") != filepath.Join(dir, "long.webm") {
+		t.Fatalf("ffmpeg args=%v", trimArgs)
+	}
+	if filepath.Ext(engineInput[0]) != ".wav" {
+		t.Fatalf("engine transcribed %s, not the trimmed audio", engineInput[0])
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "long.json"))
+	for _, want := range []string{`"start":3001.5`, `"end":3004`, `"end":3002.25`, `"language":"en"`} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("transcript missing %s: %s", want, data)
+		}
+	}
+	meta, _ := loadMeta(filepath.Join(dir, "long.webm"))
+	if meta.Transcription == nil || meta.Transcription.Range == nil || meta.Transcription.Range.Start != 3000 {
+		t.Fatalf("transcription=%+v", meta.Transcription)
+	}
+	if problems := meta.validate(); len(problems) != 0 {
+		t.Fatalf("manifest invalid: %v", problems)
+	}
+}
+
+func TestTranscribeRangeMergesIntoExistingTranscript(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 2, MinTimeout: time.Second})
+	writeTestFiles(t, dir, "long.webm")
+	full := `{"text":" hello there general","segments":[{"id":0,"start":0,"end":50,"text":" hello"},{"id":1,"start":60,"end":70,"text":" there"},{"id":2,"start":130,"end":140,"text":" general"}],"language":"en"}`
+	os.WriteFile(filepath.Join(dir, "long.json"), []byte(full), 0o644)
+	os.WriteFile(filepath.Join(dir, "long.txt"), []byte("hello there general\n"), 0o644)
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ffprobe":
+			return []byte("3600"), nil
+		case "ffmpeg":
+			return nil, os.WriteFile(args[len(args)-1], []byte("pcm"), 0o644)
+		case "whisper":
+			doc := `{"text":" over here","segments":[{"id":0,"start":5,"end":9,"text":" over here"}],"language":"en"}`
+			return nil, os.WriteFile(filepath.Join(argAfter(args, "--output_dir"), "long.json"), []byte(doc), 0o644)
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	})
+
+	rec := httptest.NewRecorder()
+	transcribeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path": "long.webm", "range": {"start": 55, "end": 120}}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("queue: %d %s", rec.Code, rec.Body)
+	}
+	j, _ := jobs.claim()
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted {
+		t.Fatalf("job=%+v", got)
+	}
+
+	doc, err := loadTranscriptDoc(filepath.Join(dir, "long.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for i, seg := range doc.Segments {
+		if seg.ID != i {
+			t.Fatalf("segment ids=%+v", doc.Segments)
+		}
+		texts = append(texts, seg.Text)
+	}
+	if strings.Join(texts, "|") != " hello| over here| general" {
+		t.Fatalf("segments=%q", texts)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "long.txt")); string(data) != "hello over here general\n" {
+		t.Fatalf("txt=%q", data)
+	}
+	for _, name := range []string{"long.json", "long.txt"} {
+		if versions, _ := listUndoVersions(name); len(versions) != 1 {
+			t.Fatalf("%s undo versions=%+v", name, versions)
+		}
+	}
+}
+
+func TestTranscribeRangeRejectsBadRanges(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	useTestEngine(t, engineConfig{RTF: 1, TimeoutMultiple: 2, MinTimeout: time.Second})
+	writeTestFiles(t, dir, "short.webm")
+	fakeWhisper(t, "60", nil)
+	for _, rng := range []string{`{"start": -5}`, `{"start": 30, "end": 10}`, `{"start": 60}`} {
+		rec := httptest.NewRecorder()
+		transcribeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcribe", strings.NewReader(`{"path": "short.webm", "range": `+rng+`}`)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("range %s: %d", rng, rec.Code)
+		}
+	}
+}
+
+func TestOffsetTranscriptKeepsUnknownFields(t *testing.T) {
+	out, err := offsetTranscript([]byte(`{"text":"hi","segments":[{"start":0.1,"end":0.2,"tokens":[1,2]}]}`), 600.02)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); got != `{"segments":[{"end":600.22,"start":600.12,"tokens":[1,2]}],"text":"hi"}` {
+		t.Fatalf("got %s", got)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// segment is one timed piece of a whisper transcript.
+type segment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+	// Speaker is set on the segments of a transcript merged from the
+	// tracks of a multi-track capture.
+	Speaker string `json:"speaker,omitempty"`
+}
+
+// caption is the segment's text, led by its speaker when known.
+func (s segment) caption() string {
+	text := strings.TrimSpace(s.Text)
+	if s.Speaker == "" || text == "" {
+		return text
+	}
+	return s.Speaker + ": " + text
+}
+
+// transcriptDoc is the subset of whisper's JSON output the server works with.
+type transcriptDoc struct {
+	Text     string    `json:"text"`
+	Language string    `json:"language,omitempty"`
+	Segments []segment `json:"segments"`
+}
+
+// transcriptJSONPath returns the whisper JSON transcript paired with any
+// file of a recording (audio, .txt or the .json itself).
+func transcriptJSONPath(fullPath string) string {
+	return filepath.Join(filepath.Dir(fullPath), recordingStem(filepath.Base(fullPath))+".json")
+}
+
+// loadTranscriptDoc reads the recording's whisper JSON. When only a plain
+// text transcript exists it is returned as a single untimed segment.
+func loadTranscriptDoc(fullPath string) (transcriptDoc, error) {
+	var doc transcriptDoc
+	data, err := os.ReadFile(transcriptJSONPath(fullPath))
+	if err == nil {
+		err = json.Unmarshal(data, &doc)
+		return doc, err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return doc, err
+	}
+	txt := filepath.Join(filepath.Dir(fullPath), recordingStem(filepath.Base(fullPath))+".txt")
+	data, err = os.ReadFile(txt)
+	if err != nil {
+		return doc, err
+	}
+	doc.Text = strings.TrimSpace(string(data))
+	doc.Segments = []segment{{Text: doc.Text}}
+	return doc, nil
+}
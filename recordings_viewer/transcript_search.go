@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// transcriptMatch is one place a search found in a transcript: segment n,
+// with its times, and the match at Offset characters into the segment's
+// text, Length characters long.
+type transcriptMatch struct {
+	Segment int     `json:"segment"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Offset  int     `json:"offset"`
+	Length  int     `json:"length"`
+	Text    string  `json:"text"`
+}
+
+// foldRunes lowercases s rune by rune, so offsets into the result are
+// offsets into s.
+func foldRunes(s string) []rune {
+	rs := []rune(s)
+	for i, r := range rs {
+		rs[i] = unicode.ToLower(r)
+	}
+	return rs
+}
+
+// transcriptSearchHandler serves GET /api/transcripts/{path}/search?q= with
+// where the recording's transcript matches q (see searchQuery), ignoring
+// case: the segment index and times of each match, to jump to, and where
+// in the segment's text it is, in characters, to highlight. ?regex=true
+// makes q's terms regular expressions. ?limit= returns only the first
+// matches; total counts them all. A recording with only a plain text
+// transcript has one untimed segment.
+func transcriptSearchHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	regex := false
+	if v := r.URL.Query().Get("regex"); v != "" {
+		var err error
+		if regex, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "regex must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	query, err := parseSearchQuery(q, regex)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "limit must be a number of matches, 0 for all", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	fullPath := absPath(rel)
+	doc, err := loadTranscriptDoc(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "no transcript", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	src := transcriptJSONPath(fullPath)
+	if _, err := os.Stat(src); err != nil {
+		src = filepath.Join(filepath.Dir(fullPath), recordingStem(filepath.Base(fullPath))+".txt")
+	}
+	matches := query.search(doc.Segments)
+	if query.filtersSessions() {
+		if s, err := findSession(rel); err != nil || !query.matchesSession(s) {
+			matches = []transcriptMatch{}
+		}
+	}
+	total := len(matches)
+	if limit > 0 && total > limit {
+		matches = matches[:limit]
+	}
+	srcRel, _ := relPath(src)
+	writeJSON(w, map[string]any{"path": srcRel, "query": q, "total": total, "matches": matches})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscriptSearchHandler(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "call.webm")
+	os.WriteFile(filepath.Join(dir, "call.json"), []byte(segmentsFixture), 0o644)
+	os.WriteFile(filepath.Join(dir, "memo.txt"), []byte("Nothing to see, nothing."), 0o644)
+	search := func(target string) (int, map[string]json.RawMessage) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var body map[string]json.RawMessage
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	code, body := search("/api/transcripts/call.webm/search?q=KENOBI")
+	var matches []transcriptMatch
+	json.Unmarshal(body["matches"], &matches)
+	if code != http.StatusOK || string(body["path"]) != `"call.json"` || len(matches) != 1 || matches[0].Segment != 1 || matches[0].Start != 1.5 || matches[0].Offset != 9 {
+		t.Fatalf("search = %d %v", code, body)
+	}
+	code, body = search("/api/transcripts/memo.txt/search?q=nothing&limit=1")
+	matches = nil
+	json.Unmarshal(body["matches"], &matches)
+	if code != http.StatusOK || string(body["total"]) != "2" || len(matches) != 1 || string(body["path"]) != `"memo.txt"` {
+		t.Fatalf("plain text search = %d %v", code, body)
+	}
+	code, body = search("/api/transcripts/call.webm/search?q=kenobi%7Chello&regex=true")
+	if code != http.StatusOK || string(body["total"]) != "2" {
+		t.Fatalf("regex search = %d %v", code, body)
+	}
+	if _, body := search("/api/transcripts/call.webm/search?q=kenobi+title:standup"); string(body["total"]) != "0" {
+		t.Fatalf("search of another title = %v", body)
+	}
+	if code, _ := search("/api/transcripts/call.webm/search?q=(&regex=true"); code != http.StatusBadRequest {
+		t.Fatalf("bad regex: %d", code)
+	}
+	if code, _ := search("/api/transcripts/call.webm/search"); code != http.StatusBadRequest {
+		t.Fatalf("without q: %d", code)
+	}
+	if code, _ := search("/api/transcripts/other.webm/search?q=x"); code != http.StatusNotFound {
+		t.Fatalf("no transcript: %d", code)
+	}
+}
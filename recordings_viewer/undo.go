@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// undoVersionFormat names the copies in a transcript's undo buffer by when
+// they were taken, so they sort oldest first.
+const undoVersionFormat = "20060102T150405.000000000Z"
+
+// undoVersion is a copy of a transcript taken before a PUT replaced it.
+type undoVersion struct {
+	Version string    `json:"version"`
+	SavedAt time.Time `json:"savedAt"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// undoDir is where the undo buffer of the transcript at rel is kept:
+// .viewer/undo/<rel>/, one file per version.
+func undoDir(rel string) string {
+	return filepath.Join(stateDir(), "undo", filepath.FromSlash(rel))
+}
+
+// saveUndoVersion copies the transcript at rel into its undo buffer before
+// it is overwritten, keeping the newest cfg.UndoVersions. Nothing is kept
+// for files that do not exist yet or are not transcripts. Callers hold mu.
+func saveUndoVersion(rel string) error {
+	if cfg().UndoVersions <= 0 || !isTranscriptFile(rel) {
+		return nil
+	}
+	src, err := os.Open(absPath(rel))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dir := undoDir(rel)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// Coarse clocks can give two quick PUTs the same time.
+	at := time.Now().UTC()
+	for {
+		if _, err := os.Stat(filepath.Join(dir, at.Format(undoVersionFormat))); err != nil {
+			break
+		}
+		at = at.Add(time.Nanosecond)
+	}
+	if _, err := writeFileAtomic(filepath.Join(dir, at.Format(undoVersionFormat)), src); err != nil {
+		return err
+	}
+	versions, err := listUndoVersions(rel)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions[min(cfg().UndoVersions, len(versions)):] {
+		os.Remove(filepath.Join(dir, v.Version))
+	}
+	return nil
+}
+
+// listUndoVersions returns the undo buffer of the transcript at rel,
+// newest first.
+func listUndoVersions(rel string) ([]undoVersion, error) {
+	entries, err := os.ReadDir(undoDir(rel))
+	if errors.Is(err, os.ErrNotExist) {
+		return []undoVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []undoVersion{}
+	for _, e := range entries {
+		at, err := time.Parse(undoVersionFormat, e.Name())
+		if err != nil || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, undoVersion{Version: e.Name(), SavedAt: at, Bytes: info.Size()})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+// undoHandler serves GET /api/transcripts/{path}/undo with the transcript's
+// undo buffer, newest first, and POST to restore the newest version, or
+// the one {"version": "..."} names. The restored version and any newer ones
+// leave the buffer, so restoring again steps further back; the content it
+// replaces is not kept.
+func undoHandler(w http.ResponseWriter, r *http.Request, rel string) {
+	switch r.Method {
+	case http.MethodGet:
+		versions, err := listUndoVersions(rel)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, versions)
+	case http.MethodPost:
+		var payload struct {
+			Version string `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, `body must be {"version": "..."} or empty`, http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		versions, err := listUndoVersions(rel)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i := 0
+		if payload.Version != "" {
+			i = sort.Search(len(versions), func(i int) bool { return versions[i].Version <= payload.Version })
+			if i == len(versions) || versions[i].Version != payload.Version {
+				http.Error(w, "no such version", http.StatusNotFound)
+				return
+			}
+		} else if len(versions) == 0 {
+			http.Error(w, "nothing to undo", http.StatusNotFound)
+			return
+		}
+		restored := versions[i]
+		dir := undoDir(rel)
+		src, err := os.Open(filepath.Join(dir, restored.Version))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fullPath := absPath(rel)
+		before, _ := currentSHA256(fullPath)
+		_, err = writeFileAtomic(fullPath, src)
+		src.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, v := range versions[:i+1] {
+			os.Remove(filepath.Join(dir, v.Version))
+		}
+		after, _ := currentSHA256(fullPath)
+		auditChange(r, "file.restored", rel, map[string]any{"before": before, "after": after, "version": restored.Version})
+		logger := requestLogger(r)
+		logger.Info("restored transcript", "path", rel, "version", restored.Version)
+		publishEvent("transcript.restored", rel, map[string]any{"version": restored.Version})
+		afterRecordingSaved(rel, fullPath)
+		writeJSON(w, map[string]any{"restored": restored, "remaining": len(versions) - i - 1})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUndoTranscriptOverwrites(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.UndoVersions = 2 })
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+	for _, text := range []string{"v1", "v2", "v3", "v4"} {
+		if rec := serve(http.MethodPut, "/api/transcripts/call.txt", text); rec.Code != http.StatusNoContent {
+			t.Fatalf("put %s: %d %s", text, rec.Code, rec.Body)
+		}
+	}
+
+	var versions []undoVersion
+	rec := serve(http.MethodGet, "/api/transcripts/call.txt/undo", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &versions); err != nil || len(versions) != 2 || versions[0].Bytes != 2 {
+		t.Fatalf("versions = %s", rec.Body)
+	}
+	if rec := serve(http.MethodPost, "/api/transcripts/call.txt/undo", ""); rec.Code != http.StatusOK || readTestFile(t, filepath.Join(dir, "call.txt")) != "v3" {
+		t.Fatalf("undo: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodPost, "/api/transcripts/call.txt/undo", `{"version": "20000101T000000.000000000Z"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown version: %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/api/transcripts/call.txt/undo", `{"version": "`+versions[1].Version+`"}`); rec.Code != http.StatusOK || readTestFile(t, filepath.Join(dir, "call.txt")) != "v2" {
+		t.Fatalf("undo to version: %d %s", rec.Code, rec.Body)
+	}
+	// v1 was dropped when the buffer was full.
+	if rec := serve(http.MethodPost, "/api/transcripts/call.txt/undo", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("empty buffer: %d", rec.Code)
+	}
+
+	// Audio is not copied.
+	writeTestFiles(t, dir, "call.webm")
+	serve(http.MethodPut, "/api/transcripts/call.webm", webmHeader+"audio")
+	if versions, _ := listUndoVersions("call.webm"); len(versions) != 0 {
+		t.Fatalf("audio versions = %v", versions)
+	}
+}
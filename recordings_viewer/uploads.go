@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// uploadURLTTL is how long a presigned upload URL stays valid.
+const uploadURLTTL = time.Hour
+
+// stagedUpload tracks an upload that has been handed out but not finalized.
+type stagedUpload struct {
+	ID          string    `json:"id"`
+	Path        string    `json:"path"`
+	Backend     string    `json:"backend"`
+	Key         string    `json:"key,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// Resumable uploads arrive in chunks at /api/uploads/{id}; Size is
+	// the declared total, if known.
+	Resumable bool  `json:"resumable,omitempty"`
+	Size      int64 `json:"size,omitempty"`
+	// Recorded is the X-Recorded-At the upload was created with, stored
+	// in the sidecar when it is finalized.
+	Recorded *recordingTime `json:"recorded,omitempty"`
+	// Source is the tab the recording came from, sent as X-Source-URL
+	// and X-Source-Title when the upload was created; see sourceHeaders.
+	Source *sourceInfo `json:"source,omitempty"`
+	// Template is the session template sent as X-Session-Template.
+	Template string `json:"template,omitempty"`
+}
+
+// remoteObject records where a recording's bytes live when they were
+// uploaded straight to object storage instead of the recordings folder.
+type remoteObject struct {
+	Backend string `json:"backend"`
+	Bucket  string `json:"bucket"`
+	Key     string `json:"key"`
+	Size    int64  `json:"size"`
+	ETag    string `json:"etag,omitempty"`
+}
+
+func stagedUploadsPath() string {
+	return filepath.Join(stateDir(), "uploads.json")
+}
+
+// loadStagedUploads reads the staged upload registry. Callers must hold mu.
+func loadStagedUploads() (map[string]stagedUpload, error) {
+	items := map[string]stagedUpload{}
+	data, err := os.ReadFile(stagedUploadsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// saveStagedUploads persists the registry. Callers must hold mu.
+func saveStagedUploads(items map[string]stagedUpload) error {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(stagedUploadsPath(), strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// uploadsHandler serves POST /api/uploads and POST /api/uploads/{id}/finalize,
+// and the chunks of resumable uploads at /api/uploads/{id}.
+//
+// Creating an upload with {"path": "...", "contentType": "audio/webm"} returns
+// where the client should PUT the bytes: a presigned object storage URL when an
+// S3 backend is configured, otherwise the local transcript endpoint. With
+// "resumable": true the bytes are PATCHed to the server in chunks instead.
+func uploadsHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/uploads"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+	if rest != "" && action == "" {
+		resumableUploadHandler(w, r, id)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rest == "" {
+		createUpload(w, r)
+		return
+	}
+	if action != "finalize" {
+		http.NotFound(w, r)
+		return
+	}
+	finalizeUpload(w, r, id)
+}
+
+func createUpload(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Path        string `json:"path"`
+		ContentType string `json:"contentType"`
+		Resumable   bool   `json:"resumable"`
+		Size        int64  `json:"size"`
+		Track       string `json:"track"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	cleanRel, _, err := resolveRecordingPath(payload.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rel := filepath.ToSlash(cleanRel)
+	if payload.Track != "" {
+		// One upload per track, each to the path of its own track file.
+		if rel, err = trackPath(rel, payload.Track); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now().UTC()
+	up := stagedUpload{
+		ID:          randomID(),
+		Backend:     "local",
+		ContentType: payload.ContentType,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(uploadURLTTL),
+	}
+	if up.Source, err = sourceHeaders(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recorded, err := recordedAtHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if up.Template, err = sessionTemplateHeader(r); err != nil {
+		http.Error(w, err.Error(), templateStatus(err))
+		return
+	}
+	items, err := loadStagedUploads()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if payload.Track == "" {
+		// Tracks keep the path they were sent with, so they stay together.
+		rel = namedRecordingPath(rel, uploadName(rel, recorded, up.Source), func(p string) bool {
+			for _, other := range items {
+				if recordingStem(other.Path) == recordingStem(p) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	up.Path, up.Recorded = rel, recorded
+	res := map[string]any{"id": up.ID, "path": rel, "method": http.MethodPut, "expiresAt": up.ExpiresAt}
+
+	s3 := cfg().S3
+	if payload.Resumable {
+		if status, err := checkUploadSize(payload.Size); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		up.Resumable, up.Size = true, payload.Size
+		up.ExpiresAt = now.Add(uploadResumeTTL)
+		res = map[string]any{"id": up.ID, "path": rel, "method": http.MethodPatch, "url": "/api/uploads/" + up.ID, "offset": 0, "expiresAt": up.ExpiresAt}
+		res["finalizeUrl"] = "/api/uploads/" + up.ID + "/finalize"
+	} else if s3.enabled() {
+		up.Backend = "s3"
+		up.Key = s3.objectKey(rel)
+		signed, err := s3.presign(http.MethodPut, up.Key, uploadURLTTL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res["url"] = signed
+		res["finalizeUrl"] = "/api/uploads/" + up.ID + "/finalize"
+	} else {
+		res["url"] = "/api/transcripts/" + rel
+	}
+
+	if up.Resumable {
+		if err := os.MkdirAll(filepath.Dir(up.partPath()), 0o755); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := os.WriteFile(up.partPath(), nil, 0o644); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	items[up.ID] = up
+	if err := saveStagedUploads(items); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("staged upload", "backend", up.Backend, "upload", up.ID, "path", rel)
+	writeJSON(w, res)
+}
+
+// uploadName is what the naming template knows of an upload to rel.
+func uploadName(rel string, recorded *recordingTime, source *sourceInfo) recordingName {
+	n := recordingName{Name: path.Base(rel)}
+	if recorded != nil {
+		n.Recorded = recorded.original()
+	}
+	if source != nil {
+		n.Title, n.URL = source.Title, source.URL
+	}
+	return n
+}
+
+// finalizeUpload confirms an object storage upload landed and records it in
+// the recording's sidecar so the library knows where the audio lives. A
+// resumable upload is moved into place once all of it has arrived. An
+// upload past its ExpiresAt is refused with 410.
+func finalizeUpload(w http.ResponseWriter, r *http.Request, id string) {
+	mu.Lock()
+	items, err := loadStagedUploads()
+	mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	up, ok := items[id]
+	if !ok {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	if time.Now().After(up.ExpiresAt) {
+		http.Error(w, "upload expired", http.StatusGone)
+		return
+	}
+	// The bucket is asked before taking mu so a slow endpoint holds up
+	// only this request.
+	var remote *remoteObject
+	if up.Backend == "s3" {
+		s3 := cfg().S3
+		size, etag, err := s3.headObject(r.Context(), up.Key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		remote = &remoteObject{Backend: "s3", Bucket: s3.Bucket, Key: up.Key, Size: size, ETag: etag}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if items, err = loadStagedUploads(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if up, ok = items[id]; !ok {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	fullPath := absPath(up.Path)
+	if up.Resumable {
+		if status, err := completeResumableUpload(up); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	meta, err := loadMeta(fullPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if remote != nil {
+		meta.Remote = remote
+		if err := saveMeta(fullPath, meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if _, err := os.Stat(fullPath); err != nil {
+		http.Error(w, "upload not received", http.StatusConflict)
+		return
+	}
+	if up.Recorded != nil {
+		if err := setRecordedMeta(fullPath, *up.Recorded); err != nil {
+			requestLogger(r).Error("record start time", "path", up.Path, "err", err)
+		}
+	}
+	if up.Source != nil {
+		if err := setSourceMeta(fullPath, *up.Source); err != nil {
+			requestLogger(r).Error("record source", "path", up.Path, "err", err)
+		}
+	}
+	if up.Template != "" {
+		if err := applySessionTemplate(fullPath, up.Template); err != nil {
+			requestLogger(r).Error("apply session template", "path", up.Path, "template", up.Template, "err", err)
+		}
+	}
+
+	delete(items, id)
+	if err := saveStagedUploads(items); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("finalized upload", "backend", up.Backend, "upload", id, "path", up.Path)
+	publishEvent("upload.finalized", up.Path, map[string]any{"backend": up.Backend})
+	if up.Resumable {
+		afterRecordingSaved(up.Path, fullPath)
+	}
+	writeJSON(w, map[string]any{"id": up.ID, "path": up.Path, "remote": meta.Remote})
+}
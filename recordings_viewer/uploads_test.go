@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateUploadLocalBackend(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.S3 = s3Config{} })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(`{"path":"recordings/uuid/clip/audio.webm"}`))
+	rec := httptest.NewRecorder()
+	uploadsHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var res map[string]any
+	json.NewDecoder(rec.Body).Decode(&res)
+	if res["url"] != "/api/transcripts/uuid/clip/audio.webm" {
+		t.Fatalf("url=%v", res["url"])
+	}
+}
+
+func TestS3UploadPresignAndFinalize(t *testing.T) {
+	dir := useTempBaseDir(t)
+	var headPath string
+	var headLocked bool
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Query().Get("X-Amz-Signature") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		headPath = r.URL.Path
+		if mu.TryLock() {
+			mu.Unlock()
+		} else {
+			headLocked = true
+		}
+		w.Header().Set("Content-Length", "1234")
+		w.Header().Set("ETag", `"abc"`)
+	}))
+	defer store.Close()
+	useConfig(t, func(c *config) {
+		c.S3 = s3Config{Endpoint: store.URL, Bucket: "rec", Region: "us-east-1", AccessKey: "AK", SecretKey: "SK"}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(`{"path":"clip.webm","contentType":"audio/webm"}`))
+	req.Header.Set("X-Recorded-At", "2024-05-01T10:00:00+02:00")
+	rec := httptest.NewRecorder()
+	uploadsHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID          string `json:"id"`
+		URL         string `json:"url"`
+		FinalizeURL string `json:"finalizeUrl"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if !strings.HasPrefix(created.URL, store.URL+"/rec/clip.webm?") || !strings.Contains(created.URL, "X-Amz-Signature=") {
+		t.Fatalf("presigned url=%s", created.URL)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, created.FinalizeURL, nil)
+	rec = httptest.NewRecorder()
+	uploadsHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("finalize status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if headPath != "/rec/clip.webm" || headLocked {
+		t.Fatalf("HEAD path=%q, under mu=%v", headPath, headLocked)
+	}
+	meta, err := loadMeta(filepath.Join(dir, "clip.webm"))
+	if err != nil {
+		t.Fatalf("loadMeta: %v", err)
+	}
+	if meta.Remote == nil || meta.Remote.Size != 1234 || meta.Remote.ETag != "abc" {
+		t.Fatalf("remote=%+v", meta.Remote)
+	}
+	if meta.Recorded == nil || !meta.Recorded.At.Equal(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("recorded=%+v", meta.Recorded)
+	}
+
+	rec = httptest.NewRecorder()
+	uploadsHandler(rec, httptest.NewRequest(http.MethodPost, created.FinalizeURL, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("second finalize status=%d want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestFinalizeExpiredUpload(t *testing.T) {
+	useTempBaseDir(t)
+	useConfig(t, func(c *config) { c.S3 = s3Config{} })
+
+	rec := httptest.NewRecorder()
+	uploadsHandler(rec, httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(`{"path":"clip.webm","resumable":true,"size":4}`)))
+	var created struct {
+		ID          string `json:"id"`
+		FinalizeURL string `json:"finalizeUrl"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	items, _ := loadStagedUploads()
+	up := items[created.ID]
+	up.ExpiresAt = time.Now().Add(-time.Minute)
+	items[created.ID] = up
+	saveStagedUploads(items)
+
+	rec = httptest.NewRecorder()
+	uploadsHandler(rec, httptest.NewRequest(http.MethodPost, created.FinalizeURL, nil))
+	if rec.Code != http.StatusGone {
+		t.Fatalf("finalize status=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
@@ -1,176 +1,682 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 type transcript struct {
-	ID      string `json:"id"`
-	Content string `json:"content"`
+	ID       string                 `json:"id"`
+	Content  string                 `json:"content"`
+	Tags     []string               `json:"tags,omitempty"`
+	Topics   []string               `json:"topics,omitempty"`
+	Language string                 `json:"language,omitempty"`
+	Fields   map[string]customField `json:"fields,omitempty"`
+	// Duration is set for audio files, in seconds.
+	Duration float64 `json:"duration,omitempty"`
 }
 
+const (
+	appName    = "recordings-viewer"
+	appVersion = "0.2.0"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take to drain after
+// SIGINT/SIGTERM.
+const shutdownTimeout = 30 * time.Second
+
 var (
-	baseDir           string
-	mu                sync.Mutex
-	commandFactory    = func(name string, args ...string) command { return exec.Command(name, args...) }
-	openerCommandFunc = openerCommand
+	baseDir    string
+	mu         sync.Mutex
+	background sync.WaitGroup // long-running workers drained on shutdown
+	// runCommandFunc runs a helper binary to completion and returns its
+	// combined output. Cancelling ctx kills the process. Tests replace it to
+	// avoid spawning processes.
+	runCommandFunc = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, name, args...).CombinedOutput()
+	}
 )
 
-type command interface {
-	Start() error
+func init() {
+	baseDir = recordingsDirSetting()
+	slog.Info("recordings directory", "path", baseDir)
 }
 
-func init() {
-	// Resolve recordings directory relative to the viewer_server source file.
+// recordingsDirSetting returns VIEWER_RECORDINGS_DIR, or the recordings
+// folder next to the viewer_server source directory.
+func recordingsDirSetting() string {
+	if dir := getenv("VIEWER_RECORDINGS_DIR"); dir != "" {
+		return filepath.Clean(dir)
+	}
 	_, srcFile, _, ok := runtime.Caller(0)
 	if !ok {
-		log.Fatal("could not resolve viewer_server.go path")
+		fatal("could not resolve viewer_server.go path")
 	}
 	viewerDir := filepath.Dir(srcFile)
-	baseDir = filepath.Clean(filepath.Join(viewerDir, "..", "recordings"))
-	log.Printf("recordings directory: %s", baseDir)
+	return filepath.Clean(filepath.Join(viewerDir, "..", "recordings"))
+}
+
+// stateDir is where the server keeps its own bookkeeping files. It lives
+// inside baseDir as a hidden folder so it travels with the recordings.
+func stateDir() string {
+	return filepath.Join(baseDir, ".viewer")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		os.Exit(runServiceCommand(os.Args[2:]))
+	}
+	m, code := parseMainFlags(os.Args[1:], os.Stderr)
+	if code != exitOK {
+		os.Exit(code)
+	}
+	if err := loadConfigFile(m.configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfig)
+	}
+	logLevelSet := m.logLevel != ""
+	if m.logLevel == "" {
+		// Subcommands keep their output to the results unless asked.
+		defaultLevel := "info"
+		if m.fs.NArg() > 0 {
+			defaultLevel = "warn"
+		}
+		m.logLevel = envString("VIEWER_LOG_LEVEL", defaultLevel)
+	}
+	if m.logFormat == "" {
+		m.logFormat = envString("VIEWER_LOG_FORMAT", "text")
+	}
+	if err := setupLogging(os.Stderr, m.logLevel, m.logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfig)
+	}
+	// Flags given on the command line win over the environment and file.
+	flagOverrides := func(c *config) {
+		m.fs.Visit(func(f *flag.Flag) {
+			if f.Name == "readonly" {
+				c.ReadOnly = m.readOnly
+			}
+		})
+	}
+	next := loadConfig()
+	flagOverrides(&next)
+	applyStoredSecrets(&next)
+	if err := validateConfig(next); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfig)
+	}
+	setConfig(next)
+	baseDir = recordingsDirSetting()
+	if m.dir != "" {
+		baseDir = filepath.Clean(m.dir)
+	}
+	if m.configPath != "" {
+		slog.Info("config file", "path", m.configPath, "recordings", baseDir)
+	}
+	if m.fs.NArg() > 0 {
+		c := &cli{json: m.json, quiet: m.quiet, verbose: m.verbose, logLevelSet: logLevelSet, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+		os.Exit(runCLI(c, m.fs.Args()))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if m.configPath == "" {
+				slog.Warn("SIGHUP ignored: no config file")
+				continue
+			}
+			if err := reloadConfig(m.configPath, flagOverrides); err != nil {
+				slog.Error("config reload failed, keeping current config", "err", err)
+				continue
+			}
+			slog.Info("config reloaded", "path", m.configPath)
+		}
+	}()
+
+	srv := &http.Server{Addr: cfg().Listen, Handler: withRequestLog(withIPAllowlist(withCORS(withReadOnly(withAuth(withAuditTrail(withWriteLimits(newMux())))))))}
+	startScheduler(ctx)
+	if err := jobs.restore(jobQueuePath()); err != nil {
+		slog.Error("restore job queue", "err", err)
+	}
+	clearPartialTranscripts()
+	startJobWorkers(ctx, poolGeneral, cfg().JobWorkers)
+	startJobWorkers(ctx, poolPreview, cfg().PreviewWorkers)
+	startWarmPool(ctx)
+	startDurationIndexer(ctx)
+	startWebhooks(ctx)
+	startHooks(ctx)
+
+	// ListenAndServe returns as soon as Shutdown starts; shutdownDone tells
+	// when the in-flight requests have finished.
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		slog.Info("shutting down: waiting for in-flight requests")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutdown", "err", err)
+		}
+	}()
+
+	if cfg().GalleryListen != "" {
+		gallery := &http.Server{Addr: cfg().GalleryListen, Handler: withRequestLog(galleryMux())}
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			gallery.Shutdown(shutdownCtx)
+		}()
+		go func() {
+			slog.Info("gallery listening", "addr", gallery.Addr)
+			if err := gallery.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("gallery server failed", "err", err)
+			}
+		}()
+	}
+
+	slog.Info("server listening", "addr", srv.Addr, "readonly", cfg().ReadOnly)
+	warnOpenListen()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("server failed", "err", err)
+	}
+	<-shutdownDone
+
+	// Interrupt running jobs, which restore queues again on the next start,
+	// and give the other background work shutdownTimeout to finish its
+	// current pass. Then take the write lock so no PUT is left half-renamed
+	// when the process exits.
+	jobs.interrupt()
+	if !waitBackground(shutdownTimeout) {
+		slog.Warn("shutting down with background work still running", "waited", shutdownTimeout)
+	}
+	mu.Lock()
+	slog.Info("server stopped")
+}
+
+// waitBackground waits up to d for the background workers to return and
+// reports whether they did.
+func waitBackground(d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// mainFlags are the flags given before the subcommand, or to the server.
+type mainFlags struct {
+	fs                                   *flag.FlagSet
+	configPath, dir, logLevel, logFormat string
+	readOnly, json, quiet, verbose       bool
+}
+
+// parseMainFlags parses the command line up to the subcommand. A flag it
+// does not know is bad usage, so it returns exitConfig rather than the
+// flag package's 2, which the subcommands use for partial failure.
+func parseMainFlags(args []string, stderr io.Writer) (*mainFlags, int) {
+	m := &mainFlags{fs: flag.NewFlagSet("viewer_server", flag.ContinueOnError)}
+	fs := m.fs
+	fs.SetOutput(stderr)
+	fs.StringVar(&m.configPath, "config", os.Getenv("VIEWER_CONFIG"), "TOML config file; reloaded on SIGHUP")
+	fs.StringVar(&m.dir, "dir", "", "recordings folder; overrides VIEWER_RECORDINGS_DIR")
+	fs.StringVar(&m.logLevel, "log-level", "", "minimum log level: debug, info, warn or error")
+	fs.StringVar(&m.logFormat, "log-format", "", "log output format: text or json")
+	fs.BoolVar(&m.readOnly, "readonly", false, "refuse edits, uploads and open-folder")
+	fs.BoolVar(&m.json, "json", false, "print machine-readable JSON from subcommands")
+	fs.BoolVar(&m.quiet, "quiet", false, "print only errors from subcommands")
+	fs.BoolVar(&m.verbose, "verbose", false, "report subcommand progress and debug logs")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitConfig
+	}
+	return m, exitOK
+}
+
+func newMux() *http.ServeMux {
+	return newMuxWithLauncher(execLauncher{})
+}
+
+// newMuxWithLauncher is newMux with the desktop endpoints starting
+// processes through l.
+func newMuxWithLauncher(l ProcessLauncher) *http.ServeMux {
 	mux := http.NewServeMux()
+	launch := launchHandlers{launcher: l}
 
 	// Serve viewer static assets
-	mux.Handle("/", http.FileServer(http.Dir(".")))
+	mux.Handle("/", assetsHandler())
 
 	// Expose recordings directory so the UI can read audio/transcripts
-	mux.Handle("/recordings/", http.StripPrefix(
-		"/recordings/",
-		http.FileServer(http.Dir(baseDir)),
-	))
+	mux.Handle("/recordings/", recordingsHandler())
 
 	mux.HandleFunc("/api/transcripts", listTranscripts)
-	mux.HandleFunc("/api/transcripts/", transcriptHandler)
-	mux.HandleFunc("/api/open-folder", openFolderHandler)
-
-	log.Println("server listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	mux.Handle("/api/transcripts/{path...}", newTranscriptRoutes())
+	mux.HandleFunc("/api/sessions", sessionsHandler)
+	mux.HandleFunc("/api/sessions/", sessionsHandler)
+	mux.HandleFunc("/api/recordings/", recordingsAPIHandler)
+	mux.HandleFunc("/api/tags", listTagsHandler)
+	mux.HandleFunc("/api/uploads", uploadsHandler)
+	mux.HandleFunc("/api/uploads/", uploadsHandler)
+	mux.HandleFunc("/api/events", eventsHandler)
+	mux.HandleFunc("/api/transcribe", transcribeHandler)
+	mux.HandleFunc("/api/jobs", jobsHandler)
+	mux.HandleFunc("/api/jobs/", jobsHandler)
+	mux.HandleFunc("/api/models", modelsHandler)
+	mux.HandleFunc("/ws/transcribe", wsTranscribeHandler)
+	mux.HandleFunc("/captions/live", captionsPageHandler)
+	mux.HandleFunc("/captions/live/ws", captionsFeedHandler)
+	mux.HandleFunc("/captions/live.vtt", captionsVTTHandler)
+	mux.HandleFunc("/api/open-folder", launch.openFolder)
+	mux.HandleFunc("/api/reveal", launch.reveal)
+	mux.HandleFunc("/api/health", healthHandler)
+	mux.HandleFunc("/api/system/capabilities", capabilitiesHandler)
+	mux.HandleFunc("/api/environment", environmentHandler)
+	mux.HandleFunc("/api/docs", docsHandler)
+	mux.HandleFunc("/api/openapi.json", openAPIHandler)
+	mux.HandleFunc("/api/stats", statsHandler)
+	mux.HandleFunc("/api/audit", auditHandler)
+	mux.HandleFunc("/api/retention/preview", retentionPreviewHandler)
+	mux.HandleFunc("/api/cold/preview", coldPreviewHandler)
+	mux.HandleFunc("/api/schedules", schedulesHandler)
+	mux.HandleFunc("/api/rules", rulesHandler)
+	mux.HandleFunc("/api/rules/", rulesHandler)
+	mux.HandleFunc("/api/metadata/bulk", bulkMetadataHandler)
+	mux.HandleFunc("/api/alerts", alertsHandler)
+	mux.HandleFunc("/api/alerts/", alertsHandler)
+	mux.HandleFunc("/api/export", zipExportHandler)
+	mux.HandleFunc("/api/export/zip", zipExportHandler)
+	mux.HandleFunc("/api/export/vault", vaultExportHandler)
+	mux.HandleFunc("/api/search/export", searchExportHandler)
+	mux.HandleFunc("/api/import", importHandler)
+	mux.HandleFunc("/api/verify", verifyHandler)
+	mux.HandleFunc("/api/manifest", offlineManifestHandler)
+	mux.HandleFunc("/api/duplicates", duplicatesHandler)
+	mux.HandleFunc("/api/calendar", calendarHandler)
+	mux.HandleFunc("/api/calendar/sync", calendarSyncHandler)
+	mux.HandleFunc("/api/backup", backupHandler)
+	mux.HandleFunc("/api/backup/status", backupStatusHandler)
+	mux.HandleFunc("/api/sync/files", syncFilesHandler)
+	mux.Handle("/api/sync/files/{path...}", newSyncRoutes())
+	mux.HandleFunc("/api/publish", publishHandler)
+	mux.HandleFunc("/api/share", shareHandler)
+	mux.HandleFunc("/share/", sharedHandler)
+	mux.HandleFunc("/gallery/", galleryHandler)
+	mux.HandleFunc("/api/webhooks/test", webhooksTestHandler)
+	mux.HandleFunc("/api/hooks", hooksHandler)
+	mux.HandleFunc("/api/salvage", salvageHandler)
+	mux.HandleFunc("/api/stale", staleHandler)
+	mux.HandleFunc("/api/validate/manifest", validateManifestHandler)
+	mux.HandleFunc("/api/workspaces", workspacesHandler(mux))
+	mux.HandleFunc("/api/workspaces/", workspacesHandler(mux))
+	mux.HandleFunc("/api/export-profiles", exportProfilesHandler)
+	mux.HandleFunc("/api/export-profiles/", exportProfilesHandler)
+	mux.HandleFunc("/api/session-templates", sessionTemplatesHandler)
+	mux.HandleFunc("/api/session-templates/", sessionTemplatesHandler)
+	mux.HandleFunc(apiV1Prefix+"/", apiV1Handler(mux))
+	return mux
 }
 
 func listTranscripts(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	files, err := os.ReadDir(baseDir)
+	order, err := parseListingOrder(r.URL.Query())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	items := make([]transcript, 0, len(files))
-	for _, f := range files {
-		if f.IsDir() {
+	scope, err := workspaceScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wantTags := r.URL.Query()["tag"]
+	wantTopics := r.URL.Query()["topic"]
+	wantLangs := r.URL.Query()["lang"]
+	wantFields, err := parseFieldFilters(r.URL.Query()["field"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := []transcript{}
+	modTimes := map[string]time.Time{}
+	durations := newDurationLookup()
+	defer durations.save()
+	for _, ws := range workspaces() {
+		if scope != "" && ws.Name != scope {
+			continue
+		}
+		files, err := os.ReadDir(ws.Dir)
+		if err != nil {
+			if ws.Primary {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 			continue
 		}
-		items = append(items, transcript{ID: f.Name()})
+		for _, f := range files {
+			if f.IsDir() || isMetaFile(f.Name()) {
+				continue
+			}
+			item := transcript{ID: ws.prefix() + f.Name()}
+			if meta, err := loadMeta(filepath.Join(ws.Dir, f.Name())); err == nil {
+				item.Tags = meta.Tags
+				if meta.Keywords != nil {
+					item.Topics = meta.Keywords.Topics
+				}
+				if meta.Language != nil {
+					item.Language = meta.Language.Code
+				}
+				item.Fields = meta.Fields
+			}
+			if !hasAllTags(item.Tags, wantTags) || !hasAllTags(item.Topics, wantTopics) ||
+				!matchesLanguage(item.Language, wantLangs) || !matchesFields(item.Fields, wantFields) {
+				continue
+			}
+			if info, err := f.Info(); err == nil {
+				modTimes[item.ID] = info.ModTime()
+			}
+			if isAudioFile(f.Name()) {
+				item.Duration, _ = durations.seconds(item.ID)
+			}
+			items = append(items, item)
+		}
 	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].ID, items[j].ID
+		if order.desc {
+			a, b = b, a
+		}
+		if order.by != "name" && !modTimes[a].Equal(modTimes[b]) {
+			return modTimes[a].Before(modTimes[b])
+		}
+		return order.coll.less(a, b)
+	})
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(items)
 }
 
-func transcriptHandler(w http.ResponseWriter, r *http.Request) {
-	rel := strings.TrimPrefix(r.URL.Path, "/api/transcripts/")
-	if rel == "" || strings.HasSuffix(rel, "/") {
-		http.Error(w, "missing transcript path", http.StatusBadRequest)
+// randomID returns a random 16-character hex identifier.
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newTranscriptRoutes returns the routes of /api/transcripts/{path...}: the
+// recording file itself and the actions on it.
+func newTranscriptRoutes() *recordingRouter {
+	rr := &recordingRouter{}
+	rr.handle("GET", recordingHandler(getTranscriptFile))
+	rr.handle("PUT", recordingHandler(putTranscriptFile))
+	rr.handle("GET tags", recordingHandler(transcriptTagsHandler))
+	rr.handle("PUT tags", recordingHandler(transcriptTagsHandler))
+	rr.handle("POST rename", recordingHandler(renameHandler))
+	rr.handle("POST move", recordingHandler(moveHandler))
+	rr.handle("GET export", recordingHandler(exportHandler))
+	rr.handle("POST tag-audio", recordingHandler(tagAudioHandler))
+	rr.handle("GET keywords", recordingHandler(keywordsHandler))
+	rr.handle("GET confidence", recordingHandler(confidenceHandler))
+	rr.handle("GET search", recordingHandler(transcriptSearchHandler))
+	rr.handle("POST keywords", recordingHandler(keywordsHandler))
+	rr.handle("GET language", recordingHandler(languageHandler))
+	rr.handle("PUT language", recordingHandler(languageHandler))
+	rr.handle("POST language", recordingHandler(languageHandler))
+	rr.handle("GET published", recordingHandler(publishedHandler))
+	rr.handle("PUT published", recordingHandler(publishedHandler))
+	rr.handle("GET favorite", recordingHandler(favoriteHandler))
+	rr.handle("PUT favorite", recordingHandler(favoriteHandler))
+	rr.handle("GET fields", recordingHandler(transcriptFieldsHandler))
+	rr.handle("PUT fields", recordingHandler(transcriptFieldsHandler))
+	rr.handle("GET undo", recordingHandler(undoHandler))
+	rr.handle("POST undo", recordingHandler(undoHandler))
+	rr.handle("PATCH "+segmentRoute, recordingHandler(segmentHandler))
+	return rr
+}
+
+// getTranscriptFile serves GET /api/transcripts/{path} with the file.
+func getTranscriptFile(w http.ResponseWriter, r *http.Request, rel string) {
+	setContentType(w, rel)
+	http.ServeFile(w, r, absPath(rel))
+}
+
+// putTranscriptFile serves PUT /api/transcripts/{path}, storing the body as
+// the file; a manifest is validated first, a body that is not the kind of
+// file its extension says is refused (see checkedContent), and a transcript
+// it replaces is kept in its undo buffer. A recording sent with
+// X-Session-Template is filed under that template.
+func putTranscriptFile(w http.ResponseWriter, r *http.Request, cleanRel string) {
+	fullPath := absPath(cleanRel)
+	recorded, err := recordedAtHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	cleanRel, err := normalizeRecordingsRelative(rel)
+	source, err := sourceHeaders(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	baseClean := filepath.Clean(baseDir)
-	fullPath := filepath.Clean(filepath.Join(baseClean, cleanRel))
-	if !isInsideBase(fullPath, baseClean) {
-		http.Error(w, "invalid path", http.StatusBadRequest)
+	body, err := checkedContent(cleanRel, r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	logger := requestLogger(r)
+	template, err := sessionTemplateHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), templateStatus(err))
 		return
 	}
-	switch r.Method {
-	case http.MethodGet:
-		http.ServeFile(w, r, fullPath)
-	case http.MethodPut:
-		mu.Lock()
-		defer mu.Unlock()
-		log.Printf("PUT %s", rel)
 
-		// Ensure parent directory exists for nested paths
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	if err := saveUndoVersion(cleanRel); err != nil {
+		logger.Error("save undo version", "path", cleanRel, "err", err)
+	}
+	before, _ := currentSHA256(fullPath)
+	var n int64
+	if isMetaFile(fullPath) {
+		n, err = putManifest(fullPath, body)
+	} else {
+		n, err = writeFileAtomic(fullPath, body)
+	}
+	var invalid manifestErrors
+	if errors.As(err, &invalid) {
+		writeJSONStatus(w, http.StatusUnprocessableEntity, map[string]any{"errors": invalid})
+		return
+	}
+	var mismatch *contentMismatchError
+	if errors.As(err, &mismatch) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	if recorded != nil {
+		if err := setRecordedMeta(fullPath, *recorded); err != nil {
+			logger.Error("record start time", "path", cleanRel, "err", err)
 		}
-
-		tmp := fullPath + ".tmp"
-		file, err := os.Create(tmp)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	}
+	if source != nil {
+		if err := setSourceMeta(fullPath, *source); err != nil {
+			logger.Error("record source", "path", cleanRel, "err", err)
 		}
-		defer os.Remove(tmp)
-		if n, err := io.Copy(file, r.Body); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		} else {
-			log.Printf("wrote %d bytes to %s", n, fullPath)
+	}
+	if template != "" && !isMetaFile(fullPath) {
+		if err := applySessionTemplate(fullPath, template); err != nil {
+			logger.Error("apply session template", "path", cleanRel, "template", template, "err", err)
 		}
+	}
+	after, _ := currentSHA256(fullPath)
+	auditChange(r, "file.updated", cleanRel, map[string]any{"before": before, "after": after, "bytes": n})
+	logger.Info("updated transcript", "path", cleanRel, "bytes", n)
+	publishEvent("transcript.updated", cleanRel, map[string]any{"bytes": n})
+	afterRecordingSaved(cleanRel, fullPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// afterRecordingSaved does the follow-up work for a file uploaded to
+// cleanRel: it drops the capture chunks it replaces, regenerates stale
+// artifacts, and queues jobs detecting the language and extracting keywords
+// of transcripts and splitting audio longer than cfg.MaxRecordingDuration.
+// Callers hold mu.
+func afterRecordingSaved(cleanRel, fullPath string) {
+	dropChunks(fullPath)
+	regenerateAfterChange(cleanRel)
+	if isTranscriptFile(cleanRel) {
+		queueLanguageJob(cleanRel)
+		queueKeywordsJob(cleanRel)
+	}
+	queueSplitJob(cleanRel)
+}
+
+// errStatePath is returned by resolveRecordingPath for a path into the
+// server's state directory, which is not a recording.
+var errStatePath = errors.New("not found")
+
+// resolveRecordingPath normalizes p with normalizeRecordingsRelative and returns
+// both the cleaned relative path and the absolute path inside its workspace.
+// Paths into .viewer are refused with errStatePath.
+func resolveRecordingPath(p string) (string, string, error) {
+	cleanRel, err := normalizeRecordingsRelative(p)
+	if err != nil {
+		return "", "", err
+	}
+	ws, inner, err := splitWorkspace(filepath.ToSlash(cleanRel))
+	if err != nil {
+		return "", "", err
+	}
+	if first, _, _ := strings.Cut(inner, "/"); first == ".viewer" {
+		return "", "", errStatePath
+	}
+	root := filepath.Clean(ws.Dir)
+	fullPath := filepath.Clean(filepath.Join(root, filepath.FromSlash(inner)))
+	if !isInsideBase(fullPath, root) {
+		return "", "", fmt.Errorf("invalid path")
+	}
+	return cleanRel, fullPath, nil
+}
+
+// writeFileAtomic streams src into fullPath via a temp file and rename so
+// readers never observe a partial write. Parent directories are created as
+// needed. Callers are expected to hold mu.
+func writeFileAtomic(fullPath string, src io.Reader) (int64, error) {
+	// Ensure parent directory exists for nested paths
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return 0, err
+	}
+
+	tmp := fullPath + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, h), src)
+	if err != nil {
 		file.Close()
-		if err := os.Rename(tmp, fullPath); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		log.Printf("updated transcript %s", rel)
-		w.WriteHeader(http.StatusNoContent)
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return n, err
+	}
+	if err := file.Close(); err != nil {
+		return n, err
 	}
+	if err := os.Rename(tmp, fullPath); err != nil {
+		return n, err
+	}
+	recordChecksum(fullPath, hex.EncodeToString(h.Sum(nil)))
+	return n, nil
+}
+
+// launchRequest is the body of POST /api/open-folder and /api/reveal.
+type launchRequest struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
 }
 
-func openFolderHandler(w http.ResponseWriter, r *http.Request) {
+// readLaunchRequest decodes a launch request and resolves its path inside
+// the workspaces. On failure it writes the response and returns ok false.
+func readLaunchRequest(w http.ResponseWriter, r *http.Request) (req launchRequest, target string, info os.FileInfo, ok bool) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	var payload struct {
-		Path string `json:"path"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid JSON body", http.StatusBadRequest)
 		return
 	}
-	path := strings.TrimSpace(payload.Path)
-	if path == "" {
+	req.Path = strings.TrimSpace(req.Path)
+	if req.Path == "" {
 		http.Error(w, "path is required", http.StatusBadRequest)
 		return
 	}
-	log.Printf("open-folder request path: %s", path)
+	requestLogger(r).Debug("launch request", "endpoint", r.URL.Path, "path", req.Path, "action", req.Action)
 
-	cleanRel, err := normalizeRecordingsRelative(path)
+	_, target, err := resolveRecordingPath(req.Path)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	info, err = os.Stat(target)
+	if err != nil {
+		http.Error(w, "path not found", http.StatusNotFound)
+		return
+	}
+	return req, target, info, true
+}
 
-	baseClean := filepath.Clean(baseDir)
-	target := filepath.Clean(filepath.Join(baseClean, cleanRel))
-	if !isInsideBase(target, baseClean) {
-		http.Error(w, "invalid path", http.StatusBadRequest)
+// writeLaunchError reports a ProcessLauncher failure for feature.
+func writeLaunchError(w http.ResponseWriter, feature string, err error) {
+	if errors.Is(err, ErrOpenUnsupported) {
+		http.Error(w, feature+" not supported on this platform", http.StatusNotImplemented)
 		return
 	}
-	info, err := os.Stat(target)
-	if err != nil {
-		http.Error(w, "folder not found", http.StatusNotFound)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// openFolder serves POST /api/open-folder with {"path": ...}, showing the
+// folder in the file manager.
+func (h launchHandlers) openFolder(w http.ResponseWriter, r *http.Request) {
+	_, target, info, ok := readLaunchRequest(w, r)
+	if !ok {
 		return
 	}
 	if !info.IsDir() {
@@ -178,32 +684,46 @@ func openFolderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("open-folder resolved target: %s", target)
-	cmdName, args := openerCommandFunc(target)
-	if cmdName == "" {
-		http.Error(w, "open-folder not supported on this platform", http.StatusNotImplemented)
-		return
-	}
-
-	cmd := commandFactory(cmdName, args...)
-	if err := cmd.Start(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	requestLogger(r).Info("open folder", "target", target)
+	if err := h.launcher.Open(target); err != nil {
+		writeLaunchError(w, "open-folder", err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func openerCommand(path string) (string, []string) {
-	switch runtime.GOOS {
-	case "darwin":
-		return "open", []string{path}
-	case "windows":
-		return "explorer", []string{path}
-	case "linux":
-		return "xdg-open", []string{path}
+// reveal serves POST /api/reveal with {"path": ..., "action": ...}.
+// The default action "reveal" shows the file or folder selected in the
+// file manager; "play" opens an audio file in the default player.
+func (h launchHandlers) reveal(w http.ResponseWriter, r *http.Request) {
+	req, target, info, ok := readLaunchRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Action == "" {
+		req.Action = "reveal"
+	}
+	var err error
+	switch req.Action {
+	case "reveal":
+		requestLogger(r).Info("reveal", "target", target)
+		err = h.launcher.Reveal(target)
+	case "play":
+		if info.IsDir() || !isAudioFile(target) {
+			http.Error(w, "path is not an audio file", http.StatusBadRequest)
+			return
+		}
+		requestLogger(r).Info("play", "target", target)
+		err = h.launcher.Open(target)
 	default:
-		return "", nil
+		http.Error(w, "unknown action: "+req.Action, http.StatusBadRequest)
+		return
 	}
+	if err != nil {
+		writeLaunchError(w, req.Action, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // normalizeRecordingsRelative converts a possibly absolute or mixed-slash path into a
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -9,17 +10,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
-)
-
-type fakeCommand struct {
-	startErr error
-	started  bool
-}
 
-func (f *fakeCommand) Start() error {
-	f.started = true
-	return f.startErr
-}
+	"recordings_viewer/testsupport"
+)
 
 func useTempBaseDir(t *testing.T) string {
 	t.Helper()
@@ -32,6 +25,50 @@ func useTempBaseDir(t *testing.T) string {
 	return dir
 }
 
+// useConfig applies edit to a copy of the current config for the duration of
+// the test.
+func useConfig(t *testing.T, edit func(*config)) {
+	t.Helper()
+	orig := *cfg()
+	next := orig
+	edit(&next)
+	setConfig(next)
+	t.Cleanup(func() {
+		setConfig(orig)
+	})
+}
+
+// useRunCommand routes runCommandFunc to fn for the duration of the test,
+// and runCommandLinesFunc too, passing it fn's output once fn returns.
+func useRunCommand(t *testing.T, fn func(ctx context.Context, name string, args ...string) ([]byte, error)) {
+	t.Helper()
+	orig, origLines := runCommandFunc, runCommandLinesFunc
+	runCommandFunc = fn
+	runCommandLinesFunc = func(ctx context.Context, onLine func(string), name string, args ...string) ([]byte, error) {
+		out, err := fn(ctx, name, args...)
+		for _, line := range strings.Split(string(out), "\n") {
+			onLine(line)
+		}
+		return out, err
+	}
+	t.Cleanup(func() {
+		runCommandFunc, runCommandLinesFunc = orig, origLines
+	})
+}
+
+func writeTestFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("mkdir for %s: %v", name, err)
+		}
+		if err := os.WriteFile(full, []byte(name), 0o644); err != nil {
+			t.Fatalf("write file %s: %v", name, err)
+		}
+	}
+}
+
 func TestListTranscripts(t *testing.T) {
 	dir := useTempBaseDir(t)
 	wantFiles := []string{"a.txt", "b.json"}
@@ -85,7 +122,7 @@ func TestTranscriptHandlerGet(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/api/transcripts/"+file, nil)
 	rec := httptest.NewRecorder()
 
-	transcriptHandler(rec, req)
+	newMux().ServeHTTP(rec, req)
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -110,7 +147,7 @@ func TestTranscriptHandlerPut(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPut, "/api/transcripts/"+file, strings.NewReader(content))
 	rec := httptest.NewRecorder()
 
-	transcriptHandler(rec, req)
+	newMux().ServeHTTP(rec, req)
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -131,9 +168,12 @@ func TestTranscriptHandlerPut(t *testing.T) {
 func TestTranscriptHandlerRejectsInvalidPath(t *testing.T) {
 	useTempBaseDir(t)
 	req := httptest.NewRequest(http.MethodGet, "/api/transcripts/../secret.txt", nil)
+	// ServeMux would redirect to the cleaned path; make sure the routes
+	// reject it when handed one anyway.
+	req.SetPathValue("path", "../secret.txt")
 	rec := httptest.NewRecorder()
 
-	transcriptHandler(rec, req)
+	newTranscriptRoutes().ServeHTTP(rec, req)
 
 	if rec.Result().StatusCode != http.StatusBadRequest {
 		t.Fatalf("status=%d want %d", rec.Result().StatusCode, http.StatusBadRequest)
@@ -148,7 +188,7 @@ func TestTranscriptHandlerPutWithRecordingsPrefix(t *testing.T) {
     req := httptest.NewRequest(http.MethodPut, "/api/transcripts/recordings/"+file, strings.NewReader(content))
     rec := httptest.NewRecorder()
 
-    transcriptHandler(rec, req)
+    newMux().ServeHTTP(rec, req)
 
     res := rec.Result()
     defer res.Body.Close()
@@ -174,7 +214,7 @@ func TestTranscriptHandlerPutWithDoubleRecordingsPrefix(t *testing.T) {
     req := httptest.NewRequest(http.MethodPut, "/api/transcripts/recordings/recordings/"+file, strings.NewReader(content))
     rec := httptest.NewRecorder()
 
-    transcriptHandler(rec, req)
+    newMux().ServeHTTP(rec, req)
 
     res := rec.Result()
     defer res.Body.Close()
@@ -200,33 +240,12 @@ func TestOpenFolderHandlerSuccess(t *testing.T) {
 		t.Fatalf("mkdir target: %v", err)
 	}
 
-	origOpener := openerCommandFunc
-	var gotOpenerPath string
-	openerCommandFunc = func(path string) (string, []string) {
-		gotOpenerPath = path
-		return "open", []string{path}
-	}
-	t.Cleanup(func() {
-		openerCommandFunc = origOpener
-	})
-
-	origFactory := commandFactory
-	var gotName string
-	var gotArgs []string
-	cmd := &fakeCommand{}
-	commandFactory = func(name string, args ...string) command {
-		gotName = name
-		gotArgs = append([]string(nil), args...)
-		return cmd
-	}
-	t.Cleanup(func() {
-		commandFactory = origFactory
-	})
+	fake := &testsupport.FakeLauncher{}
 
 	req := httptest.NewRequest(http.MethodPost, "/api/open-folder", strings.NewReader(`{"path":"`+target+`"}`))
 	rec := httptest.NewRecorder()
 
-	openFolderHandler(rec, req)
+	launchHandlers{launcher: fake}.openFolder(rec, req)
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -234,16 +253,7 @@ func TestOpenFolderHandlerSuccess(t *testing.T) {
 	if res.StatusCode != http.StatusNoContent {
 		t.Fatalf("status=%d want %d", res.StatusCode, http.StatusNoContent)
 	}
-	if gotOpenerPath != absTarget {
-		t.Fatalf("opener path=%q want %q", gotOpenerPath, absTarget)
-	}
-	if gotName != "open" {
-		t.Fatalf("command name=%q want %q", gotName, "open")
-	}
-	if len(gotArgs) != 1 || gotArgs[0] != absTarget {
-		t.Fatalf("command args=%v want [%q]", gotArgs, absTarget)
-	}
-	if !cmd.started {
-		t.Fatalf("expected command Start to be called")
+	if opened := fake.Opened(); len(opened) != 1 || opened[0] != absTarget {
+		t.Fatalf("opened=%v want [%q]", opened, absTarget)
 	}
 }
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// engineWhisperCpp is the engine that transcribes with whisper.cpp's
+// server, whisper-server, which loads its model once and then answers one
+// transcription at a time over HTTP. A pool of them is kept running, so a
+// short interactive transcription does not wait seconds for the model to
+// load.
+const engineWhisperCpp = "whisper.cpp"
+
+// whisperCppConfig configures the whisper.cpp engine. Models are ggml
+// files, ggml-<model>.bin in ModelDir. Pool servers are kept running with
+// their model loaded; one unused for Idle is stopped, and zero keeps them.
+type whisperCppConfig struct {
+	ModelDir string
+	Pool     int
+	Idle     time.Duration
+}
+
+// warmServer is a running whisper-server with model loaded.
+type warmServer struct {
+	model   string
+	url     string
+	started time.Time
+	// lastUsed is when it last finished a transcription, and served how
+	// many it has.
+	lastUsed time.Time
+	served   int
+	busy     bool
+	// output keeps the end of what the process printed, for diagnostics.
+	output *tailBuffer
+	stop   func()
+	exited <-chan struct{}
+}
+
+func (s *warmServer) alive() bool {
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// readinessClient polls a starting whisper-server. A server that accepts
+// the connection but does not answer yet is asked again on the next tick.
+var readinessClient = &http.Client{Timeout: time.Second}
+
+// startWarmServer starts a whisper-server for model and waits until it has
+// loaded it. Tests replace it to avoid spawning processes.
+var startWarmServer = func(ctx context.Context, binary, model string) (*warmServer, error) {
+	modelFile := whisperCppModelFile(model)
+	if _, err := os.Stat(modelFile); err != nil {
+		return nil, fmt.Errorf("model %s: %w", model, err)
+	}
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	// The server outlives the job that started it, so it is not tied to
+	// the job's context.
+	cmd := exec.Command(binary, "-m", modelFile, "-l", "auto", "--host", "127.0.0.1", "--port", strconv.Itoa(port))
+	out := &tailBuffer{}
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	s := &warmServer{
+		model: model, url: "http://127.0.0.1:" + strconv.Itoa(port), started: time.Now(), output: out, exited: exited,
+		stop: func() {
+			cmd.Process.Kill()
+			<-exited
+		},
+	}
+	// whisper-server only listens once the model is loaded.
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.stop()
+			return nil, ctx.Err()
+		case <-exited:
+			return nil, &jobDiagnostics{msg: "whisper-server exited while loading " + model, detail: out.String()}
+		case <-tick.C:
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/", nil)
+		if err != nil {
+			s.stop()
+			return nil, err
+		}
+		if res, err := readinessClient.Do(req); err == nil {
+			res.Body.Close()
+			return s, nil
+		}
+	}
+}
+
+// freePort returns a TCP port on the loopback interface nothing listens on.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// whisperCppModelFile is the ggml file of model: model itself when it
+// names a file, else ggml-<model>.bin in the model directory.
+func whisperCppModelFile(model string) string {
+	if strings.HasSuffix(model, ".bin") || strings.ContainsAny(model, `/\`) {
+		return model
+	}
+	return filepath.Join(cfg().WhisperCpp.ModelDir, "ggml-"+model+".bin")
+}
+
+// tailBuffer keeps the last 64 KiB written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - 64<<10; over > 0 {
+		b.buf = b.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return outputTail(b.buf)
+}
+
+// warmPool holds the whisper-servers kept running between jobs.
+type warmPool struct {
+	mu      sync.Mutex
+	servers []*warmServer
+}
+
+var warmServers = &warmPool{}
+
+// acquire returns an idle server with model loaded, or starts one. When
+// the pool is full an idle server of another model makes room; if every
+// server is busy, the one started is stopped again after the job.
+func (p *warmPool) acquire(ctx context.Context, binary, model string) (*warmServer, error) {
+	p.mu.Lock()
+	var evict *warmServer
+	for _, s := range p.servers {
+		if !s.busy && s.model == model && s.alive() {
+			s.busy = true
+			p.mu.Unlock()
+			return s, nil
+		}
+	}
+	p.prune()
+	if len(p.servers) >= cfg().WhisperCpp.Pool {
+		for _, s := range p.servers {
+			if !s.busy && (evict == nil || s.lastUsed.Before(evict.lastUsed)) {
+				evict = s
+			}
+		}
+		if evict != nil {
+			p.remove(evict)
+		}
+	}
+	p.mu.Unlock()
+	if evict != nil {
+		slog.Info("stopping whisper-server to make room", "model", evict.model)
+		evict.stop()
+	}
+
+	slog.Info("starting whisper-server", "model", model)
+	s, err := startWarmServer(ctx, binary, model)
+	if err != nil {
+		return nil, err
+	}
+	s.busy = true
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.servers) < cfg().WhisperCpp.Pool {
+		p.servers = append(p.servers, s)
+	}
+	return s, nil
+}
+
+// release returns s to the pool after a job, or stops it when it failed
+// mid-transcription or is not part of the pool.
+func (p *warmPool) release(s *warmServer, ok bool) {
+	p.mu.Lock()
+	s.busy = false
+	s.lastUsed = time.Now()
+	s.served++
+	pooled := p.remove(s)
+	if ok && pooled && s.alive() {
+		p.servers = append(p.servers, s)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	s.stop()
+}
+
+// remove drops s from the pool and reports whether it was there. Callers
+// hold p.mu.
+func (p *warmPool) remove(s *warmServer) bool {
+	for i, cur := range p.servers {
+		if cur == s {
+			p.servers = append(p.servers[:i], p.servers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// prune drops servers that exited. Callers hold p.mu.
+func (p *warmPool) prune() {
+	kept := p.servers[:0]
+	for _, s := range p.servers {
+		if s.alive() {
+			kept = append(kept, s)
+		} else {
+			slog.Warn("whisper-server exited", "model", s.model, "output", s.output.String())
+		}
+	}
+	p.servers = kept
+}
+
+// stopIdle stops the servers unused since before cutoff.
+func (p *warmPool) stopIdle(cutoff time.Time) {
+	p.mu.Lock()
+	var stale []*warmServer
+	for _, s := range p.servers {
+		if !s.busy && s.lastUsed.Before(cutoff) {
+			stale = append(stale, s)
+		}
+	}
+	for _, s := range stale {
+		p.remove(s)
+	}
+	p.mu.Unlock()
+	for _, s := range stale {
+		slog.Info("stopping idle whisper-server", "model", s.model)
+		s.stop()
+	}
+}
+
+// stopAll stops every server, at shutdown. Busy ones are dropped from the
+// pool, so release stops them once their job is done.
+func (p *warmPool) stopAll() {
+	p.mu.Lock()
+	var idle []*warmServer
+	for _, s := range p.servers {
+		if !s.busy {
+			idle = append(idle, s)
+		}
+	}
+	p.servers = nil
+	p.mu.Unlock()
+	for _, s := range idle {
+		s.stop()
+	}
+}
+
+// warmServerStatus describes one pooled server for the capabilities
+// endpoint.
+type warmServerStatus struct {
+	Model     string    `json:"model"`
+	Busy      bool      `json:"busy"`
+	StartedAt time.Time `json:"startedAt"`
+	Served    int       `json:"served"`
+}
+
+func (p *warmPool) status() []warmServerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := []warmServerStatus{}
+	for _, s := range p.servers {
+		out = append(out, warmServerStatus{Model: s.model, Busy: s.busy, StartedAt: s.started.UTC(), Served: s.served})
+	}
+	return out
+}
+
+// startWarmPool fills the pool with servers of the default model, when
+// whisper.cpp is the default engine, stops idle ones after
+// cfg.WhisperCpp.Idle and stops them all when ctx ends.
+func startWarmPool(ctx context.Context) {
+	engine, ok := cfg().Engines[engineWhisperCpp]
+	if !ok {
+		return
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		if cfg().DefaultEngine == engineWhisperCpp {
+			model := defaultModel()
+			var started []*warmServer
+			for range cfg().WhisperCpp.Pool {
+				s, err := warmServers.acquire(ctx, engine.Binary, model)
+				if err != nil {
+					slog.Error("warm whisper-server", "model", model, "err", err)
+					break
+				}
+				started = append(started, s)
+			}
+			for _, s := range started {
+				warmServers.release(s, true)
+			}
+		}
+		tick := time.NewTicker(time.Minute)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				warmServers.stopAll()
+				return
+			case now := <-tick.C:
+				if cfg().WhisperCpp.Idle > 0 {
+					warmServers.stopIdle(now.Add(-cfg().WhisperCpp.Idle))
+				}
+			}
+		}
+	}()
+}
+
+// transcribeWarm transcribes the 16 kHz WAV file at audio with a pooled
+// whisper-server for model and returns its JSON, which has the text and
+// segments of whisper's.
+func transcribeWarm(ctx context.Context, engine engineConfig, audio, model, language string) ([]byte, error) {
+	s, err := warmServers.acquire(ctx, engine.Binary, model)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := s.inference(ctx, audio, language)
+	// A server cut off mid-transcription is still busy with it.
+	warmServers.release(s, err == nil || ctx.Err() == nil && s.alive())
+	return raw, err
+}
+
+// inference posts audio to the server's /inference endpoint, with the
+// language it is in unless that is left for the server to detect.
+func (s *warmServer) inference(ctx context.Context, audio, language string) ([]byte, error) {
+	f, err := os.Open(audio)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", filepath.Base(audio))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = mw.WriteField("response_format", "verbose_json")
+		}
+		if err == nil && language != "" {
+			err = mw.WriteField("language", language)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/inference", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, &jobDiagnostics{msg: fmt.Sprintf("whisper-server: %v", err), detail: s.output.String()}
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &jobDiagnostics{msg: "whisper-server: " + res.Status, detail: outputTail(raw)}
+	}
+	var parsed struct {
+		Error    string            `json:"error"`
+		Segments []json.RawMessage `json:"segments"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, &jobDiagnostics{msg: "whisper-server answered without JSON", detail: outputTail(raw)}
+	}
+	if parsed.Error != "" {
+		return nil, errors.New("whisper-server: " + parsed.Error)
+	}
+	return bytes.TrimSpace(raw), nil
+}
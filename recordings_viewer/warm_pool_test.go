@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// useWarmServers replaces whisper-server with HTTP servers answering
+// /inference, and returns the models they were started for.
+func useWarmServers(t *testing.T, pool int) func() []string {
+	t.Helper()
+	useConfig(t, func(c *config) {
+		c.FFmpegPath = "ffmpeg"
+		c.FFprobePath = "ffprobe"
+		c.Engines = map[string]engineConfig{engineWhisperCpp: {Binary: "whisper-server", RTF: 0.5, TimeoutMultiple: 3}}
+		c.WhisperCpp = whisperCppConfig{Pool: pool}
+	})
+	var mu sync.Mutex
+	var started []string
+	orig := startWarmServer
+	startWarmServer = func(_ context.Context, _, model string) (*warmServer, error) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/inference" || r.FormValue("response_format") != "verbose_json" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if _, _, err := r.FormFile("file"); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"language": "en", "text": " hello", "segments": [{"start": 1.5, "end": 2, "text": " hello ` + model + `"}]}`))
+		}))
+		mu.Lock()
+		started = append(started, model)
+		mu.Unlock()
+		exited := make(chan struct{})
+		return &warmServer{model: model, url: srv.URL, output: &tailBuffer{}, exited: exited, stop: func() {
+			srv.Close()
+			close(exited)
+		}}, nil
+	}
+	t.Cleanup(func() {
+		warmServers.stopAll()
+		startWarmServer = orig
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), started...)
+	}
+}
+
+func TestWarmPoolReusesServers(t *testing.T) {
+	dir := useTempBaseDir(t)
+	started := useWarmServers(t, 1)
+	useRunCommand(t, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if name == "ffprobe" {
+			return []byte("60\n"), nil
+		}
+		return nil, os.WriteFile(args[len(args)-1], []byte("RIFF"), 0o644)
+	})
+	writeTestFiles(t, dir, "call.webm")
+	engine := cfg().Engines[engineWhisperCpp]
+	run := func(model string, tr *timeRange) []byte {
+		t.Helper()
+		raw, _, err := runEngine(context.Background(), job{Engine: engineWhisperCpp, Model: model, Range: tr}, engine, filepath.Join(dir, "call.webm"), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	run("base", nil)
+	raw := run("base", &timeRange{Start: 30})
+	var doc struct {
+		Segments []struct{ Start float64 } `json:"segments"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil || len(doc.Segments) != 1 || doc.Segments[0].Start != 31.5 {
+		t.Fatalf("range transcript = %s", raw)
+	}
+	if got := started(); len(got) != 1 {
+		t.Fatalf("servers started for %v", got)
+	}
+	status := warmServers.status()
+	if len(status) != 1 || status[0].Served != 2 || status[0].Busy {
+		t.Fatalf("status = %+v", status)
+	}
+
+	// Another model takes the only place in the pool.
+	run("small", nil)
+	run("small", nil)
+	if got := started(); len(got) != 2 || got[1] != "small" {
+		t.Fatalf("servers started for %v", got)
+	}
+	if status := warmServers.status(); len(status) != 1 || status[0].Model != "small" {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestWarmPoolFullOfBusyServers(t *testing.T) {
+	started := useWarmServers(t, 1)
+	busy, err := warmServers.acquire(context.Background(), "whisper-server", "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pool is full, so this one is stopped after its job.
+	extra, err := warmServers.acquire(context.Background(), "whisper-server", "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	warmServers.release(extra, true)
+	if extra.alive() {
+		t.Fatal("server outside the pool kept running")
+	}
+	warmServers.release(busy, true)
+	if !busy.alive() || len(started()) != 2 || len(warmServers.status()) != 1 {
+		t.Fatalf("pool = %+v", warmServers.status())
+	}
+}
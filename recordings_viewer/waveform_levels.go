@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxWaveformWidth caps the peaks one range request returns.
+	maxWaveformWidth = 10000
+	// waveformCacheSize is how many waveforms' zoom levels are kept in
+	// memory, enough for the few recordings open in editors.
+	waveformCacheSize = 8
+)
+
+// waveformLevels are a waveform's zoom levels: level 0 is its detail, each
+// level above halves the one below it by keeping the louder of each pair of
+// peaks, up to a single peak.
+type waveformLevels struct {
+	waveform
+	base   int
+	levels [][]byte
+}
+
+// newWaveformLevels builds the zoom levels of w. A waveform drawn before
+// it had detail starts from its overview.
+func newWaveformLevels(w waveform) *waveformLevels {
+	l := &waveformLevels{waveform: w, base: w.DetailSamplesPerPeak}
+	level := w.Detail
+	if len(level) == 0 {
+		l.base = w.SamplesPerPeak
+		level = make([]byte, len(w.Peaks))
+		for i, p := range w.Peaks {
+			level[i] = byte(math.Round(min(max(p, 0), 1) * 255))
+		}
+	}
+	l.Detail = nil
+	l.levels = [][]byte{level}
+	for len(level) > 1 {
+		next := make([]byte, (len(level)+1)/2)
+		for i := range next {
+			next[i] = level[2*i]
+			if 2*i+1 < len(level) {
+				next[i] = max(next[i], level[2*i+1])
+			}
+		}
+		l.levels = append(l.levels, next)
+		level = next
+	}
+	return l
+}
+
+// waveformRange is the part of a waveform a range request returns. Start
+// and End are those of its first and last peaks, which are aligned to the
+// level's peaks so the same range always gets the same answer.
+type waveformRange struct {
+	Start          float64   `json:"start"`
+	End            float64   `json:"end"`
+	Duration       float64   `json:"duration"`
+	SampleRate     int       `json:"sampleRate"`
+	Level          int       `json:"level"`
+	Levels         int       `json:"levels"`
+	SamplesPerPeak int       `json:"samplesPerPeak"`
+	Peaks          []float64 `json:"peaks"`
+}
+
+// rangePeaks returns the peaks from start to end seconds at the finest
+// level that fits them in width peaks.
+func (l *waveformLevels) rangePeaks(start, end float64, width int) waveformRange {
+	end = min(end, l.Duration)
+	start = min(start, end)
+	rate := float64(l.SampleRate)
+	k := 0
+	for ; k < len(l.levels)-1; k++ {
+		spp := float64(l.base << k)
+		if math.Ceil(end*rate/spp)-math.Floor(start*rate/spp) <= float64(width) {
+			break
+		}
+	}
+	spp := l.base << k
+	level := l.levels[k]
+	from := min(int(start*rate)/spp, len(level))
+	to := min(int(math.Ceil(end*rate/float64(spp))), len(level))
+	out := waveformRange{
+		Start: roundOffset(float64(from*spp) / rate), End: roundOffset(min(float64(to*spp)/rate, l.Duration)),
+		Duration: l.Duration, SampleRate: l.SampleRate, Level: k, Levels: len(l.levels), SamplesPerPeak: spp,
+		Peaks: make([]float64, 0, to-from),
+	}
+	for _, b := range level[from:to] {
+		out.Peaks = append(out.Peaks, math.Round(float64(b)/255*1000)/1000)
+	}
+	return out
+}
+
+// waveformCache keeps the zoom levels of recently requested waveforms by
+// recordings path, until their file changes.
+var waveformCache = struct {
+	sync.Mutex
+	entries map[string]cachedWaveform
+}{entries: map[string]cachedWaveform{}}
+
+type cachedWaveform struct {
+	modTime time.Time
+	size    int64
+	levels  *waveformLevels
+}
+
+// loadWaveformLevels reads the waveform at rel and builds its zoom levels,
+// or returns those cached.
+func loadWaveformLevels(rel string) (*waveformLevels, error) {
+	info, err := os.Stat(absPath(rel))
+	if err != nil {
+		return nil, err
+	}
+	waveformCache.Lock()
+	c, ok := waveformCache.entries[rel]
+	waveformCache.Unlock()
+	if ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.levels, nil
+	}
+	data, err := os.ReadFile(absPath(rel))
+	if err != nil {
+		return nil, err
+	}
+	var w waveform
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, err
+	}
+	if w.SampleRate <= 0 || w.SamplesPerPeak <= 0 || (len(w.Detail) > 0 && w.DetailSamplesPerPeak <= 0) {
+		return nil, errors.New("waveform has no sample rate")
+	}
+	levels := newWaveformLevels(w)
+	waveformCache.Lock()
+	if len(waveformCache.entries) >= waveformCacheSize {
+		clear(waveformCache.entries)
+	}
+	waveformCache.entries[rel] = cachedWaveform{modTime: info.ModTime(), size: info.Size(), levels: levels}
+	waveformCache.Unlock()
+	return levels, nil
+}
+
+// serveWaveform writes the waveform at rel. Without a query it is the
+// overview; with ?start= and ?end= (seconds) and ?width= (peaks, default
+// waveformPeaks) it is that range at the finest zoom level that fits, so
+// an editor can zoom into hours of audio a screenful at a time.
+func serveWaveform(w http.ResponseWriter, r *http.Request, rel string) {
+	levels, err := loadWaveformLevels(rel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	if !q.Has("start") && !q.Has("end") && !q.Has("width") {
+		writeJSON(w, levels.waveform)
+		return
+	}
+	start, end, width := 0.0, levels.Duration, waveformPeaks
+	if v := q.Get("start"); v != "" {
+		if start, err = strconv.ParseFloat(v, 64); err != nil || !(start >= 0) || math.IsInf(start, 0) {
+			http.Error(w, "start must be a number of seconds", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("end"); v != "" {
+		if end, err = strconv.ParseFloat(v, 64); err != nil || !(end > start) || math.IsInf(end, 0) {
+			http.Error(w, "end must be a number of seconds after start", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("width"); v != "" {
+		if width, err = strconv.Atoi(v); err != nil || width < 1 || width > maxWaveformWidth {
+			http.Error(w, "width must be from 1 to "+strconv.Itoa(maxWaveformWidth), http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, levels.rangePeaks(start, end, width))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWaveformLevelsPickTheFinestThatFits(t *testing.T) {
+	// An hour at 100 peaks a second, silent but for a loud second at 30:00.
+	detail := make([]byte, 3600*waveformDetailRate)
+	for i := 1800 * waveformDetailRate; i < 1801*waveformDetailRate; i++ {
+		detail[i] = 255
+	}
+	l := newWaveformLevels(waveform{Duration: 3600, SampleRate: 8000, SamplesPerPeak: 14400, DetailSamplesPerPeak: 80, Detail: detail})
+	if l.Detail != nil || len(l.levels[len(l.levels)-1]) != 1 || l.levels[len(l.levels)-1][0] != 255 {
+		t.Fatalf("levels: %d, top %v", len(l.levels), l.levels[len(l.levels)-1])
+	}
+
+	whole := l.rangePeaks(0, 3600, 1000)
+	if whole.Level != 9 || whole.SamplesPerPeak != 80<<9 || len(whole.Peaks) > 1000 || whole.Start != 0 || whole.End != 3600 {
+		t.Fatalf("whole: level %d, %d samples per peak, %d peaks, %v-%v", whole.Level, whole.SamplesPerPeak, len(whole.Peaks), whole.Start, whole.End)
+	}
+	loud := 0
+	for _, p := range whole.Peaks {
+		if p == 1 {
+			loud++
+		}
+	}
+	if loud == 0 || loud > 2 {
+		t.Fatalf("the loud second spans %d peaks of the whole", loud)
+	}
+
+	near := l.rangePeaks(1799.5, 1801.5, 1000)
+	if near.Level != 0 || len(near.Peaks) != 200 || near.Peaks[49] != 0 || near.Peaks[50] != 1 || near.Peaks[150] != 0 {
+		t.Fatalf("near: level %d, %d peaks", near.Level, len(near.Peaks))
+	}
+	// Ranges are aligned to the level's peaks and clamped to the audio.
+	if r := l.rangePeaks(3599.995, 4000, 10); r.Start != 3599.99 || r.End != 3600 || len(r.Peaks) != 1 {
+		t.Fatalf("end: %+v", r)
+	}
+}
+
+func TestWaveformLevelsFromOverviewOnly(t *testing.T) {
+	l := newWaveformLevels(waveform{Duration: 4, SampleRate: 8000, SamplesPerPeak: 8000, Peaks: []float64{0, 1, 0.5, 0}})
+	r := l.rangePeaks(0, 4, 2)
+	if r.Level != 1 || r.SamplesPerPeak != 16000 || len(r.Peaks) != 2 || r.Peaks[0] != 1 || r.Peaks[1] != 0.502 {
+		t.Fatalf("range: %+v", r)
+	}
+}
+
+func TestServeWaveformRanges(t *testing.T) {
+	dir := useTempBaseDir(t)
+	data, _ := json.Marshal(waveform{Duration: 2, SampleRate: 8000, SamplesPerPeak: 8, Peaks: []float64{0.5}, DetailSamplesPerPeak: 80, Detail: make([]byte, 200)})
+	if err := os.WriteFile(filepath.Join(dir, "call.waveform.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		serveWaveform(rec, httptest.NewRequest(http.MethodGet, "/api/recordings/call/waveform"+query, nil), "call.waveform.json")
+		return rec
+	}
+	rec := serve("")
+	var w map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &w); err != nil || w["detail"] != nil || w["peaks"] == nil {
+		t.Fatalf("overview: %d %s", rec.Code, rec.Body)
+	}
+	rec = serve("?width=50")
+	var r waveformRange
+	if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil || r.Level != 2 || len(r.Peaks) != 50 {
+		t.Fatalf("width only: %d %s", rec.Code, rec.Body)
+	}
+	for _, q := range []string{"?start=-1", "?start=NaN", "?start=1&end=1", "?width=0", "?width=10001", "?end=soon"} {
+		if rec := serve(q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d", q, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// waveformRate is the sample rate audio is decoded at to draw its
+	// waveform; peaks need no more.
+	waveformRate = 8000
+	// waveformPeaks is how many peaks a waveform's overview has, whatever
+	// the length of the recording.
+	waveformPeaks = 2000
+	// waveformDetailRate is how many peaks a second the finest zoom level
+	// has.
+	waveformDetailRate = 100
+	// spectrogramSize is the width and height of a spectrogram image.
+	spectrogramSize = "1200x256"
+)
+
+// pipeCommandFunc starts a command and returns its standard output as it
+// is written, and a func that waits for it to exit. Tests replace it.
+var pipeCommandFunc = func(ctx context.Context, name string, args ...string) (io.Reader, func() error, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	wait := func() error {
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("%v: %s", err, outputTail(stderr.Bytes()))
+		}
+		return nil
+	}
+	return stdout, wait, nil
+}
+
+// waveform is the content of a foo.waveform.json the server draws: the
+// loudest sample of each stretch of SamplesPerPeak samples, from 0 to 1.
+// Detail has the same at DetailSamplesPerPeak, waveformDetailRate peaks a
+// second, as one byte from 0 to 255 each; clients get it a range at a
+// time, see waveformLevels.
+type waveform struct {
+	Duration             float64   `json:"duration"`
+	SampleRate           int       `json:"sampleRate"`
+	SamplesPerPeak       int       `json:"samplesPerPeak"`
+	Peaks                []float64 `json:"peaks"`
+	DetailSamplesPerPeak int       `json:"detailSamplesPerPeak,omitempty"`
+	Detail               []byte    `json:"detail,omitempty"`
+}
+
+// drawWaveform decodes the audio at the recordings path src to mono PCM
+// with ffmpeg and returns its waveform as JSON, reporting the share of the
+// audio decoded so far to progress.
+func drawWaveform(ctx context.Context, src string, progress func(float64)) ([]byte, error) {
+	d, err := probeDuration(absPath(src))
+	if err != nil {
+		return nil, err
+	}
+	total := max(int(d.Seconds()*waveformRate), 1)
+	w := waveform{Duration: math.Round(d.Seconds()*1000) / 1000, SampleRate: waveformRate, SamplesPerPeak: max((total+waveformPeaks-1)/waveformPeaks, 1), Peaks: []float64{},
+		DetailSamplesPerPeak: waveformRate / waveformDetailRate, Detail: make([]byte, 0, total/(waveformRate/waveformDetailRate)+1)}
+	out, wait, err := pipeCommandFunc(ctx, cfg().FFmpegPath, "-hide_banner", "-loglevel", "error",
+		"-i", absPath(src), "-vn", "-ac", "1", "-ar", fmt.Sprint(waveformRate), "-f", "s16le", "-")
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 64<<10)
+	var carry []byte
+	peak, n, decoded := 0, 0, 0
+	detailPeak, detailN := 0, 0
+	for {
+		k, readErr := out.Read(buf)
+		data := append(carry, buf[:k]...)
+		even := len(data) &^ 1
+		for i := 0; i < even; i += 2 {
+			v := int(int16(binary.LittleEndian.Uint16(data[i:])))
+			peak = max(peak, v, -v)
+			detailPeak = max(detailPeak, v, -v)
+			if n++; n == w.SamplesPerPeak {
+				w.Peaks = append(w.Peaks, roundPeak(peak))
+				peak, n = 0, 0
+			}
+			if detailN++; detailN == w.DetailSamplesPerPeak {
+				w.Detail = append(w.Detail, detailByte(detailPeak))
+				detailPeak, detailN = 0, 0
+			}
+		}
+		carry = append(carry[:0], data[even:]...)
+		decoded += even / 2
+		progress(float64(decoded) / float64(total))
+		if readErr != nil {
+			break
+		}
+	}
+	if err := wait(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	if n > 0 {
+		w.Peaks = append(w.Peaks, roundPeak(peak))
+	}
+	if detailN > 0 {
+		w.Detail = append(w.Detail, detailByte(detailPeak))
+	}
+	return json.Marshal(w)
+}
+
+func roundPeak(peak int) float64 {
+	return math.Round(float64(peak)/32768*1000) / 1000
+}
+
+func detailByte(peak int) byte {
+	return byte(min(peak*255/32767, 255))
+}
+
+// drawSpectrogram returns a PNG spectrogram of the audio at the recordings
+// path src, drawn by ffmpeg's showspectrumpic.
+func drawSpectrogram(ctx context.Context, src string) ([]byte, error) {
+	if err := os.MkdirAll(tempDir(), 0o755); err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(tempDir(), "spectrogram-"+randomID()+".png")
+	defer os.Remove(tmp)
+	if out, err := runCommandFunc(ctx, cfg().FFmpegPath, "-hide_banner", "-loglevel", "error", "-y",
+		"-i", absPath(src), "-lavfi", "showspectrumpic=s="+spectrogramSize+":legend=0", tmp); err != nil {
+		return nil, &jobDiagnostics{msg: fmt.Sprintf("draw spectrogram: %v", err), detail: outputTail(out)}
+	}
+	return os.ReadFile(tmp)
+}
+
+// regenerateJobType is the type of the job that rebuilds an artifact of
+// kind: waveforms and spectrograms have their own, which jobPool gives
+// their own workers.
+func regenerateJobType(kind string) string {
+	if kind == artifactWaveform || kind == artifactSpectrogram {
+		return kind
+	}
+	return "regenerate"
+}
+
+// previewPath is where the artifact of kind for the audio at rel is kept.
+func previewPath(rel, kind string) string {
+	ext := ".json"
+	if kind == artifactSpectrogram {
+		ext = ".png"
+	}
+	return pathJoinRel(path.Dir(rel), recordingStem(path.Base(rel))+"."+kind+ext)
+}
+
+// queuePreviewJob queues the job drawing the artifact of kind at rel, or
+// returns the one already queued or running.
+func queuePreviewJob(kind, rel string) job {
+	if j, ok := jobs.findPending(kind, rel); ok {
+		return j
+	}
+	j := &job{ID: randomID(), Type: kind, Path: rel, Priority: priorityInteractive, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	jobs.enqueue(j)
+	slog.Info("queued job", "job", j.ID, "type", j.Type, "path", j.Path)
+	publishEvent("job.queued", j.Path, map[string]any{"id": j.ID})
+	return *j
+}
+
+// previewHandler serves GET /api/recordings/{id}/waveform and
+// /api/recordings/{id}/spectrogram. A fresh one is returned, the waveform
+// as its overview or the range asked for (see serveWaveform); otherwise a job drawing it is queued, or the pending one found, and
+// returned with 202. Clients then follow the job's job.progress and
+// job.completed events.
+func previewHandler(w http.ResponseWriter, r *http.Request, id, kind string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, err := findSession(id)
+	if err != nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	if s.Audio == "" {
+		http.Error(w, "recording has no audio", http.StatusNotFound)
+		return
+	}
+	a, ok := s.Artifacts[kind]
+	if ok && a.Fresh && kind == artifactWaveform {
+		serveWaveform(w, r, a.Path)
+		return
+	}
+	if ok && a.Fresh {
+		http.ServeFile(w, r, absPath(a.Path))
+		return
+	}
+	if cfg().ReadOnly {
+		http.Error(w, "server is read-only", http.StatusForbidden)
+		return
+	}
+	rel := a.Path
+	if rel == "" {
+		rel = previewPath(s.Audio, kind)
+	}
+	writeJSONStatus(w, http.StatusAccepted, queuePreviewJob(kind, rel))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// usePipeCommand replaces the streamed ffmpeg decode with fn.
+func usePipeCommand(t *testing.T, fn func(name string, args ...string) []byte) {
+	t.Helper()
+	orig := pipeCommandFunc
+	pipeCommandFunc = func(ctx context.Context, name string, args ...string) (io.Reader, func() error, error) {
+		return bytes.NewReader(fn(name, args...)), func() error { return nil }, nil
+	}
+	t.Cleanup(func() { pipeCommandFunc = orig })
+}
+
+func getPreview(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestWaveformIsDrawnOnceByPreviewWorkers(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	writeTestFiles(t, dir, "call.webm")
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != cfg().FFprobePath {
+			t.Fatalf("unexpected command %s", name)
+		}
+		return []byte("2\n"), nil
+	})
+	// A second at half volume, then one at full.
+	pcm := make([]byte, 0, 4*waveformRate*2)
+	for i := range 2 * waveformRate {
+		v := int16(16384)
+		if i >= waveformRate {
+			v = -32768
+		}
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(v))
+	}
+	usePipeCommand(t, func(name string, args ...string) []byte {
+		if name != cfg().FFmpegPath || argAfter(args, "-ar") != "8000" {
+			t.Fatalf("args=%v", args)
+		}
+		return pcm
+	})
+
+	var queued []job
+	for range 3 {
+		rec := getPreview(t, "/api/recordings/call/waveform")
+		var j job
+		if err := json.Unmarshal(rec.Body.Bytes(), &j); err != nil || rec.Code != http.StatusAccepted {
+			t.Fatalf("queue: %d %s", rec.Code, rec.Body)
+		}
+		queued = append(queued, j)
+	}
+	if queued[0].ID != queued[2].ID || queued[0].Type != "waveform" || queued[0].Path != "call.waveform.json" || len(jobs.list()) != 1 {
+		t.Fatalf("jobs=%+v", jobs.list())
+	}
+	if _, ok := jobs.claimFrom(poolGeneral); ok {
+		t.Fatal("a general worker took a waveform job")
+	}
+	j, ok := jobs.claimFrom(poolPreview)
+	if !ok {
+		t.Fatal("no waveform job for the preview workers")
+	}
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted {
+		t.Fatalf("job=%+v", got)
+	}
+	evs, _ := readEventsSince(eventLogPath(), 0)
+	progressed := false
+	for _, ev := range evs {
+		progressed = progressed || (ev.Type == "job.progress" && ev.Data["id"] == j.ID && ev.Data["progress"] == 1.0)
+	}
+	if !progressed {
+		t.Fatalf("no job.progress event in %+v", evs)
+	}
+
+	rec := getPreview(t, "/api/recordings/call/waveform")
+	var w waveform
+	if err := json.Unmarshal(rec.Body.Bytes(), &w); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("get: %d %s", rec.Code, rec.Body)
+	}
+	if len(w.Peaks) != waveformPeaks || w.SamplesPerPeak != 8 || w.Peaks[0] != 0.5 || w.Peaks[waveformPeaks-1] != 1 || w.Duration != 2 {
+		t.Fatalf("waveform: %d peaks of %d, first %v last %v", len(w.Peaks), w.SamplesPerPeak, w.Peaks[0], w.Peaks[len(w.Peaks)-1])
+	}
+	if w.DetailSamplesPerPeak != 80 || w.Detail != nil {
+		t.Fatalf("overview detail: %d samples per peak, %d bytes", w.DetailSamplesPerPeak, len(w.Detail))
+	}
+
+	rec = getPreview(t, "/api/recordings/call/waveform?start=0.5&end=1.5&width=100")
+	var zoomed waveformRange
+	if err := json.Unmarshal(rec.Body.Bytes(), &zoomed); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("get range: %d %s", rec.Code, rec.Body)
+	}
+	if zoomed.Level != 0 || len(zoomed.Peaks) != 100 || zoomed.Start != 0.5 || zoomed.End != 1.5 || zoomed.Peaks[0] != 0.498 || zoomed.Peaks[99] != 1 {
+		t.Fatalf("range: %+v", zoomed)
+	}
+}
+
+func TestSpectrogramIsDrawnAsPNG(t *testing.T) {
+	dir := useTempBaseDir(t)
+	useJobQueue(t)
+	writeTestFiles(t, dir, "2024/talk.webm")
+	useRunCommand(t, func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != cfg().FFmpegPath || argAfter(args, "-lavfi") != "showspectrumpic=s=1200x256:legend=0" {
+			t.Fatalf("args=%v", args)
+		}
+		return nil, os.WriteFile(args[len(args)-1], []byte("\x89PNG\r\n\x1a\n"), 0o644)
+	})
+
+	if rec := getPreview(t, "/api/recordings/2024/talk/spectrogram"); rec.Code != http.StatusAccepted {
+		t.Fatalf("queue: %d %s", rec.Code, rec.Body)
+	}
+	j, _ := jobs.claim()
+	runJob(j)
+	if got, _ := jobs.get(j.ID); got.Status != jobCompleted || got.Output[0] != "2024/talk.spectrogram.png" {
+		t.Fatalf("job=%+v", got)
+	}
+	rec := getPreview(t, "/api/recordings/2024/talk/spectrogram")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("get: %d %s", rec.Code, rec.Header())
+	}
+	if rec := getPreview(t, "/api/recordings/nope/spectrogram"); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing recording: %d", rec.Code)
+	}
+}
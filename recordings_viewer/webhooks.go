@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	// webhookAttempts is how many times a delivery is tried before it is
+	// given up on.
+	webhookAttempts = 3
+	// webhookExcerptLen bounds the transcript excerpt in a payload.
+	webhookExcerptLen = 280
+)
+
+var (
+	// webhookRetryDelay is the wait before the first retry; it doubles
+	// after each failed attempt.
+	webhookRetryDelay = 5 * time.Second
+	webhookClient     = &http.Client{Timeout: 10 * time.Second}
+)
+
+// webhookPayload is the JSON body POSTed to each webhook. Text is a
+// one-line message, so Slack and Mattermost incoming webhooks can show the
+// payload as it is.
+type webhookPayload struct {
+	Event   string       `json:"event"`
+	Time    time.Time    `json:"time"`
+	Path    string       `json:"path,omitempty"`
+	Session *session     `json:"session,omitempty"`
+	Excerpt string       `json:"excerpt,omitempty"`
+	Alert   string       `json:"alert,omitempty"`
+	Matches []alertMatch `json:"matches,omitempty"`
+	Text    string       `json:"text"`
+}
+
+// webhookEvent maps a server event to the webhook event it triggers, if
+// any: a new recording by upload, import or salvage is
+// "recording.uploaded", a finished transcription job
+// "transcript.completed", and a content alert "alert.matched".
+func webhookEvent(ev serverEvent) (string, bool) {
+	switch ev.Type {
+	case "upload.finalized", "recording.imported", "recording.salvaged":
+		return "recording.uploaded", true
+	case "transcript.updated":
+		// PUTs of audio files are uploads from the extension.
+		return "recording.uploaded", isAudioFile(ev.Path)
+	case "job.completed":
+		id, _ := ev.Data["id"].(string)
+		j, ok := jobs.get(id)
+		return "transcript.completed", ok && j.Type == "transcribe"
+	case "alert.matched":
+		return "alert.matched", true
+	}
+	return "", false
+}
+
+// newWebhookPayload describes the session ev is about for event. An
+// alert's payload names the alert and quotes the segments it matched.
+func newWebhookPayload(event string, ev serverEvent) webhookPayload {
+	rel := ev.Path
+	p := webhookPayload{Event: event, Time: ev.Time.UTC(), Path: rel}
+	name := rel
+	if s, err := findSession(rel); err == nil {
+		p.Session = s
+		p.Excerpt = transcriptExcerpt(*s, webhookExcerptLen)
+		name = s.ID
+	}
+	switch event {
+	case "recording.uploaded":
+		p.Text = fmt.Sprintf("New recording: %s", name)
+	case "transcript.completed":
+		p.Text = fmt.Sprintf("Transcript ready: %s", name)
+	case "alert.matched":
+		p.Alert, _ = ev.Data["name"].(string)
+		p.Matches, _ = ev.Data["matches"].([]alertMatch)
+		p.Text = fmt.Sprintf("Alert %q: %s", p.Alert, name)
+		if len(p.Matches) > 0 {
+			p.Excerpt = p.Matches[0].Text
+		}
+	default:
+		p.Text = fmt.Sprintf("%s: %s", event, name)
+	}
+	if p.Excerpt != "" {
+		p.Text += "\n> " + p.Excerpt
+	}
+	return p
+}
+
+// sendWebhook POSTs body to target once. With cfg.WebhookSecret set, the
+// X-Viewer-Signature header carries the body's HMAC-SHA256 so receivers
+// can check where it came from.
+func sendWebhook(ctx context.Context, target, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "recordings-viewer/"+appVersion)
+	req.Header.Set("X-Viewer-Event", event)
+	if secret := cfg().WebhookSecret; secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Viewer-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s", res.Status)
+	}
+	return nil
+}
+
+// deliverWebhook sends body to target, retrying with backoff.
+func deliverWebhook(ctx context.Context, target, event string, body []byte) {
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := sendWebhook(ctx, target, event, body)
+		if err == nil {
+			slog.Debug("webhook delivered", "url", redactURL(target), "event", event)
+			return
+		}
+		if attempt == webhookAttempts || ctx.Err() != nil {
+			slog.Error("webhook failed", "url", redactURL(target), "event", event, "attempts", attempt, "err", err)
+			return
+		}
+		slog.Warn("webhook attempt failed, retrying", "url", redactURL(target), "event", event, "attempt", attempt, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		delay *= 2
+	}
+}
+
+// redactURL keeps a webhook URL's scheme and host for logs and responses;
+// the path of a Slack or Discord webhook is its secret.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "(invalid URL)"
+	}
+	if u.Path == "" || u.Path == "/" {
+		return u.Scheme + "://" + u.Host
+	}
+	return u.Scheme + "://" + u.Host + "/…"
+}
+
+// startWebhooks delivers webhooks for server events until ctx is done.
+func startWebhooks(ctx context.Context) {
+	follower := events.follow()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		follower.run(ctx, func(ev serverEvent) {
+			event, ok := webhookEvent(ev)
+			c := cfg()
+			if !ok || len(c.Webhooks) == 0 || !slices.Contains(c.WebhookEvents, event) {
+				return
+			}
+			body, err := json.Marshal(newWebhookPayload(event, ev))
+			if err != nil {
+				slog.Error("webhook payload", "event", event, "err", err)
+				return
+			}
+			for _, target := range c.Webhooks {
+				background.Add(1)
+				go func() {
+					defer background.Done()
+					deliverWebhook(ctx, target, event, body)
+				}()
+			}
+		})
+	}()
+}
+
+// webhooksTestHandler serves POST /api/webhooks/test: it sends a "test"
+// payload to every webhook once and reports each one's outcome.
+func webhooksTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	type result struct {
+		URL   string `json:"url"`
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+	}
+	body, err := json.Marshal(webhookPayload{Event: "test", Time: time.Now().UTC(), Text: "Test notification from recordings-viewer"})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results := []result{}
+	for _, target := range cfg().Webhooks {
+		res := result{URL: redactURL(target), OK: true}
+		if err := sendWebhook(r.Context(), target, "test", body); err != nil {
+			res.OK, res.Error = false, err.Error()
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, results)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookReceiver starts a server that answers with the given statuses in
+// turn (200 once they run out) and passes each request body to got.
+func webhookReceiver(t *testing.T, got chan<- *http.Request, statuses ...int) *httptest.Server {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		if n := int(calls.Add(1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+		got <- r
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func receive(t *testing.T, got <-chan *http.Request) (*http.Request, webhookPayload) {
+	t.Helper()
+	select {
+	case r := <-got:
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		return r, p
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+	}
+	return nil, webhookPayload{}
+}
+
+func TestWebhookOnUpload(t *testing.T) {
+	useTempBaseDir(t)
+	got := make(chan *http.Request, 4)
+	srv := webhookReceiver(t, got)
+	useConfig(t, func(c *config) {
+		c.Webhooks = []string{srv.URL + "/hook"}
+		c.WebhookEvents = []string{"recording.uploaded", "transcript.completed"}
+		c.WebhookSecret = "s3cret"
+		c.ExtractKeywords = false
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() { cancel(); background.Wait() })
+	startWebhooks(ctx)
+
+	// A transcript edit is not an upload; the audio that follows is.
+	for _, p := range []string{"/api/transcripts/call.txt", "/api/transcripts/call.webm"} {
+		body := "Hello from the call."
+		if strings.HasSuffix(p, ".webm") {
+			body = webmHeader + body
+		}
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, p, strings.NewReader(body)))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s status = %d", p, rec.Code)
+		}
+	}
+	r, p := receive(t, got)
+	if p.Event != "recording.uploaded" || p.Path != "call.webm" || p.Session == nil || p.Session.ID != "call" {
+		t.Fatalf("payload = %+v", p)
+	}
+	if p.Excerpt != "Hello from the call." || !strings.HasPrefix(p.Text, "New recording: call\n") {
+		t.Fatalf("payload = %+v", p)
+	}
+	if r.Header.Get("X-Viewer-Event") != "recording.uploaded" || !strings.HasPrefix(r.Header.Get("X-Viewer-Signature"), "sha256=") {
+		t.Fatalf("headers = %v", r.Header)
+	}
+	select {
+	case r := <-got:
+		t.Fatalf("unexpected second webhook %s", r.URL)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	useConfig(t, func(c *config) { c.WebhookSecret = "s3cret" })
+	var sig string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig = r.Header.Get("X-Viewer-Signature")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	if err := sendWebhook(context.Background(), srv.URL, "test", []byte(`{"event":"test"}`)); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("signature = %q", sig)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	orig := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = orig })
+	got := make(chan *http.Request, 4)
+	srv := webhookReceiver(t, got, http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	deliverWebhook(context.Background(), srv.URL, "test", []byte(`{}`))
+	if len(got) != 3 {
+		t.Fatalf("attempts = %d, want 3", len(got))
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	useJobQueue(t)
+	jobs.enqueue(&job{ID: "t1", Type: "transcribe", Status: jobCompleted})
+	jobs.enqueue(&job{ID: "k1", Type: "keywords", Status: jobCompleted})
+
+	cases := []struct {
+		ev   serverEvent
+		want string
+	}{
+		{serverEvent{Type: "upload.finalized", Path: "a.webm"}, "recording.uploaded"},
+		{serverEvent{Type: "transcript.updated", Path: "a.m4a"}, "recording.uploaded"},
+		{serverEvent{Type: "transcript.updated", Path: "a.txt"}, ""},
+		{serverEvent{Type: "job.completed", Path: "a.webm", Data: map[string]any{"id": "t1"}}, "transcript.completed"},
+		{serverEvent{Type: "job.completed", Path: "a.webm", Data: map[string]any{"id": "k1"}}, ""},
+		{serverEvent{Type: "alert.matched", Path: "a.webm", Data: map[string]any{"alert": "x1"}}, "alert.matched"},
+		{serverEvent{Type: "tags.updated", Path: "a.webm"}, ""},
+	}
+	for _, c := range cases {
+		got, ok := webhookEvent(c.ev)
+		if !ok {
+			got = ""
+		}
+		if got != c.want {
+			t.Errorf("webhookEvent(%s %s) = %q, want %q", c.ev.Type, c.ev.Path, got, c.want)
+		}
+	}
+}
+
+func TestWebhooksTestHandler(t *testing.T) {
+	got := make(chan *http.Request, 2)
+	ok := webhookReceiver(t, got)
+	failing := webhookReceiver(t, got, http.StatusNotFound)
+	useConfig(t, func(c *config) { c.Webhooks = []string{ok.URL + "/services/T0/B0/secret", failing.URL} })
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/test", nil))
+	var results []struct {
+		URL   string `json:"url"`
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&results)
+	if len(results) != 2 || !results[0].OK || results[1].OK || results[1].Error != "404 Not Found" {
+		t.Fatalf("results = %+v", results)
+	}
+	if strings.Contains(results[0].URL, "secret") || !strings.HasSuffix(results[0].URL, "/…") {
+		t.Fatalf("URL not redacted: %s", results[0].URL)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWSClient is a bare-bones WebSocket client for exercising handlers.
+type testWSClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialTestWebSocket(t *testing.T, srv *httptest.Server, path string) *testWSClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: "+key+"\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status=%d", res.StatusCode)
+	}
+	if got := res.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("accept=%q", got)
+	}
+	return &testWSClient{conn: conn, r: r}
+}
+
+func (c *testWSClient) send(t *testing.T, op int, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	head := []byte{0x80 | byte(op)}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, 0x80|byte(n))
+	case n <= 0xFFFF:
+		head = append(head, 0x80|126, byte(n>>8), byte(n))
+	default:
+		head = append(head, 0x80|127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	head = append(head, mask[:]...)
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+	if _, err := c.conn.Write(append(head, masked...)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+func (c *testWSClient) read(t *testing.T) (int, string) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	n := int(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.r, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.r, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	return int(head[0] & 0x0F), string(payload)
+}
+
+// newEchoWebSocketServer starts a server that sends every message back.
+func newEchoWebSocketServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		for {
+			op, msg, err := ws.readMessage()
+			if err != nil {
+				ws.conn.Close()
+				return
+			}
+			ws.writeFrame(op, msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketEchoWithFragmentsAndPing(t *testing.T) {
+	c := dialTestWebSocket(t, newEchoWebSocketServer(t), "/")
+
+	c.send(t, wsOpPing, []byte("hi"))
+	if op, msg := c.read(t); op != wsOpPong || msg != "hi" {
+		t.Fatalf("pong op=%d msg=%q", op, msg)
+	}
+
+	// A fragmented text message: "hel" + "lo".
+	c.conn.Write([]byte{0x01, 0x83, 0, 0, 0, 0, 'h', 'e', 'l'})
+	c.conn.Write([]byte{0x80, 0x82, 0, 0, 0, 0, 'l', 'o'})
+	if op, msg := c.read(t); op != wsOpText || msg != "hello" {
+		t.Fatalf("echo op=%d msg=%q", op, msg)
+	}
+
+	big := strings.Repeat("x", 70000)
+	c.send(t, wsOpBinary, []byte(big))
+	if op, msg := c.read(t); op != wsOpBinary || len(msg) != len(big) {
+		t.Fatalf("big echo op=%d len=%d", op, len(msg))
+	}
+}
+
+func TestUpgradeWebSocketRejectsPlainRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if _, err := upgradeWebSocket(rec, httptest.NewRequest(http.MethodGet, "/ws/transcribe", nil)); err == nil {
+		t.Fatalf("expected error")
+	}
+	if rec.Code != http.StatusUpgradeRequired {
+		t.Fatalf("status=%d", rec.Code)
+	}
+}
+
+func TestWebSocketClosesOnProtocolErrors(t *testing.T) {
+	srv := newEchoWebSocketServer(t)
+	for name, frames := range map[string][]byte{
+		"unmasked":      {0x81, 0x02, 'h', 'i'},
+		"reserved bits": {0xC1, 0x82, 0, 0, 0, 0, 'h', 'i'},
+		"interleaved":   {0x01, 0x81, 0, 0, 0, 0, 'a', 0x81, 0x81, 0, 0, 0, 0, 'b'},
+	} {
+		c := dialTestWebSocket(t, srv, "/")
+		c.conn.Write(frames)
+		op, payload := c.read(t)
+		if op != wsOpClose || len(payload) < 2 || binary.BigEndian.Uint16([]byte(payload)) != 1002 {
+			t.Errorf("%s: op=%d payload=%q", name, op, payload)
+		}
+	}
+}
+
+func TestUpgradeWebSocketChecksOrigin(t *testing.T) {
+	useConfig(t, func(c *config) { c.AllowedOrigins = []string{"chrome-extension://abc"} })
+	for origin, want := range map[string]bool{
+		"":                                 true,
+		"http://viewer.local":              true,
+		"chrome-extension://abc":           true,
+		"https://evil.example":             false,
+		"http://viewer.local.evil.example": false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/ws/transcribe", nil)
+		r.Host = "viewer.local"
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		upgradeWebSocket(rec, r)
+		// The recorder cannot be hijacked, so an allowed handshake gets as
+		// far as a 500.
+		if got := rec.Code != http.StatusForbidden; got != want {
+			t.Errorf("origin %q: status %d", origin, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// workspacePrefix starts the paths of recordings in workspaces other than
+// the primary one: "@nas/2024/call.webm" is 2024/call.webm under the "nas"
+// root. Paths in the primary workspace (baseDir) carry no prefix, so
+// existing links and IDs keep working.
+const workspacePrefix = "@"
+
+// workspace is one recordings root the server browses.
+type workspace struct {
+	Name    string `json:"name"`
+	Dir     string `json:"dir"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// prefix is what paths in ws start with.
+func (ws workspace) prefix() string {
+	if ws.Primary {
+		return ""
+	}
+	return workspacePrefix + ws.Name + "/"
+}
+
+// validWorkspaceName reports whether name can be used in paths and URLs.
+func validWorkspaceName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// workspaces returns the primary recordings root followed by the extra
+// roots from VIEWER_WORKSPACES in name order.
+func workspaces() []workspace {
+	out := []workspace{{Name: cfg().PrimaryWorkspace, Dir: baseDir, Primary: true}}
+	for name, dir := range cfg().Workspaces {
+		out = append(out, workspace{Name: name, Dir: dir})
+	}
+	sort.Slice(out[1:], func(i, j int) bool { return out[i+1].Name < out[j+1].Name })
+	return out
+}
+
+// findWorkspace returns the workspace called name; "" is the primary one.
+func findWorkspace(name string) (workspace, bool) {
+	if name == "" || name == cfg().PrimaryWorkspace {
+		return workspaces()[0], true
+	}
+	if dir, ok := cfg().Workspaces[name]; ok {
+		return workspace{Name: name, Dir: dir}, true
+	}
+	return workspace{}, false
+}
+
+// splitWorkspace splits a slash-separated recordings path into its
+// workspace and the path inside it.
+func splitWorkspace(rel string) (workspace, string, error) {
+	if !strings.HasPrefix(rel, workspacePrefix) {
+		ws, _ := findWorkspace("")
+		return ws, rel, nil
+	}
+	name, rest, _ := strings.Cut(strings.TrimPrefix(rel, workspacePrefix), "/")
+	ws, ok := findWorkspace(name)
+	if !ok || ws.Primary {
+		return workspace{}, "", fmt.Errorf("unknown workspace %q", name)
+	}
+	return ws, rest, nil
+}
+
+// absPath returns the file a validated recordings path refers to.
+func absPath(rel string) string {
+	rel = filepath.ToSlash(rel)
+	ws, inner, err := splitWorkspace(rel)
+	if err != nil {
+		return filepath.Join(baseDir, filepath.FromSlash(rel))
+	}
+	return filepath.Join(ws.Dir, filepath.FromSlash(inner))
+}
+
+// relPath is the inverse of absPath: the slash-separated recordings path of
+// a file inside one of the workspaces.
+func relPath(full string) (string, bool) {
+	all := workspaces()
+	// Extra roots first, in case one is mounted inside the primary root.
+	for _, ws := range append(all[1:], all[0]) {
+		rel, err := filepath.Rel(ws.Dir, full)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+			continue
+		}
+		if rel == "." {
+			return strings.TrimSuffix(ws.prefix(), "/"), true
+		}
+		return ws.prefix() + filepath.ToSlash(rel), true
+	}
+	return "", false
+}
+
+// inWorkspace reports whether the recordings path rel lies in the workspace
+// called name; an empty name matches everything.
+func inWorkspace(rel, name string) bool {
+	if name == "" {
+		return true
+	}
+	ws, _, err := splitWorkspace(rel)
+	return err == nil && ws.Name == name
+}
+
+// workspaceScope reads a listing request's ?workspace= filter.
+func workspaceScope(r *http.Request) (string, error) {
+	name := r.URL.Query().Get("workspace")
+	if name == "" {
+		return "", nil
+	}
+	ws, ok := findWorkspace(name)
+	if !ok {
+		return "", fmt.Errorf("unknown workspace %q", name)
+	}
+	return ws.Name, nil
+}
+
+// walkRecordings walks every workspace root like filepath.WalkDir, without
+// visiting the roots themselves, the primary state directory, or a
+// workspace's own .viewer folder. A root that cannot be read, such as an
+// unmounted drive, is logged and skipped.
+func walkRecordings(fn fs.WalkDirFunc) error {
+	for _, ws := range workspaces() {
+		if _, err := os.Stat(ws.Dir); err != nil {
+			if !ws.Primary {
+				slog.Warn("workspace unavailable", "workspace", ws.Name, "dir", ws.Dir, "err", err)
+				continue
+			}
+		}
+		root := ws.Dir
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if p == root {
+				if err != nil {
+					return err
+				}
+				return nil
+			}
+			if d != nil && d.IsDir() && filepath.Dir(p) == root {
+				if d.Name() == ".viewer" || ws.Primary && strings.HasPrefix(d.Name(), workspacePrefix) {
+					return filepath.SkipDir
+				}
+			}
+			return fn(p, d, err)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordingsFS serves /recordings/ from every workspace.
+type recordingsFS struct{}
+
+func (recordingsFS) Open(name string) (http.File, error) {
+	rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+	ws, inner, err := splitWorkspace(rel)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	if ws.Primary && strings.HasPrefix(rel, ".viewer") {
+		return nil, os.ErrNotExist
+	}
+	return http.Dir(ws.Dir).Open("/" + inner)
+}
+
+type workspaceInfo struct {
+	workspace
+	Available bool    `json:"available"`
+	FreeBytes *uint64 `json:"freeBytes,omitempty"`
+	TotalDisk *uint64 `json:"totalDisk,omitempty"`
+}
+
+// workspacesHandler serves GET /api/workspaces, and /api/workspaces/{name}/...
+// as the API scoped to one workspace: /api/workspaces/nas/sessions lists
+// that workspace's sessions, /api/workspaces/nas/transcripts/a.txt is
+// /api/transcripts/@nas/a.txt.
+func workspacesHandler(api http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/workspaces"), "/")
+		if rest == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			var out []workspaceInfo
+			for _, ws := range workspaces() {
+				info := workspaceInfo{workspace: ws}
+				if st, err := os.Stat(ws.Dir); err == nil && st.IsDir() {
+					info.Available = true
+					if free, total, err := diskSpace(ws.Dir); err == nil {
+						info.FreeBytes, info.TotalDisk = &free, &total
+					}
+				}
+				out = append(out, info)
+			}
+			writeJSON(w, out)
+			return
+		}
+		name, sub, _ := strings.Cut(rest, "/")
+		ws, ok := findWorkspace(name)
+		if !ok {
+			http.Error(w, "workspace not found", http.StatusNotFound)
+			return
+		}
+		endpoint, inner, _ := strings.Cut(sub, "/")
+		switch endpoint {
+		case "transcripts", "sessions", "tags":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		target := "/api/" + endpoint
+		if inner != "" {
+			target += "/" + ws.prefix() + inner
+		}
+		scoped := r.Clone(r.Context())
+		scoped.URL = &url.URL{Path: target, RawQuery: r.URL.RawQuery}
+		q := scoped.URL.Query()
+		q.Set("workspace", ws.Name)
+		scoped.URL.RawQuery = q.Encode()
+		scoped.RequestURI = scoped.URL.RequestURI()
+		api.ServeHTTP(w, scoped)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useWorkspace registers an extra workspace backed by a temp dir.
+func useWorkspace(t *testing.T, name string) string {
+	t.Helper()
+	dir := t.TempDir()
+	useConfig(t, func(c *config) {
+		c.PrimaryWorkspace = "default"
+		c.Workspaces = map[string]string{name: dir}
+	})
+	return dir
+}
+
+func TestWorkspacePathsRoundTrip(t *testing.T) {
+	base := useTempBaseDir(t)
+	nas := useWorkspace(t, "nas")
+	for rel, full := range map[string]string{
+		"a/b.webm":      filepath.Join(base, "a", "b.webm"),
+		"@nas/a/b.webm": filepath.Join(nas, "a", "b.webm"),
+	} {
+		if got := absPath(rel); got != full {
+			t.Fatalf("absPath(%q)=%q want %q", rel, got, full)
+		}
+		if got, ok := relPath(full); !ok || got != rel {
+			t.Fatalf("relPath(%q)=%q,%v want %q", full, got, ok, rel)
+		}
+	}
+	if _, _, err := resolveRecordingPath("@nope/a.txt"); err == nil {
+		t.Fatalf("expected error for unknown workspace")
+	}
+	if _, _, err := resolveRecordingPath("@nas/../../etc/passwd"); err == nil {
+		t.Fatalf("expected error for traversal out of a workspace")
+	}
+}
+
+func TestWorkspacesScopeListings(t *testing.T) {
+	base := useTempBaseDir(t)
+	nas := useWorkspace(t, "nas")
+	writeTestFiles(t, base, "local.webm", "local.txt")
+	writeTestFiles(t, nas, "2024/remote.webm", "top.txt")
+	mux := newMux()
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+	ids := func(rec *httptest.ResponseRecorder) []string {
+		var items []struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var out []string
+		for _, it := range items {
+			out = append(out, it.ID)
+		}
+		return out
+	}
+
+	if got := strings.Join(ids(get("/api/sessions")), ","); got != "@nas/2024/remote,@nas/top,local" {
+		t.Fatalf("all sessions=%s", got)
+	}
+	if got := strings.Join(ids(get("/api/sessions?workspace=default")), ","); got != "local" {
+		t.Fatalf("default sessions=%s", got)
+	}
+	if got := strings.Join(ids(get("/api/workspaces/nas/sessions")), ","); got != "@nas/2024/remote,@nas/top" {
+		t.Fatalf("scoped sessions=%s", got)
+	}
+	if got := strings.Join(ids(get("/api/workspaces/nas/transcripts")), ","); got != "@nas/top.txt" {
+		t.Fatalf("scoped transcripts=%s", got)
+	}
+	if rec := get("/api/sessions?workspace=nope"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown workspace status=%d", rec.Code)
+	}
+
+	rec := get("/api/workspaces/nas/transcripts/top.txt")
+	if body, _ := io.ReadAll(rec.Body); rec.Code != http.StatusOK || string(body) != "top.txt" {
+		t.Fatalf("scoped get status=%d body=%q", rec.Code, body)
+	}
+	rec = get("/recordings/@nas/2024/remote.webm")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("static file status=%d", rec.Code)
+	}
+
+	rec = get("/api/workspaces")
+	var list []workspaceInfo
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 2 || !list[0].Primary || list[1].Name != "nas" || !list[1].Available {
+		t.Fatalf("workspaces=%+v", list)
+	}
+}
+
+func TestMoveRecordingBetweenWorkspaces(t *testing.T) {
+	base := useTempBaseDir(t)
+	archive := useWorkspace(t, "archive")
+	writeTestFiles(t, base, "call.webm", "call.txt")
+
+	rec := httptest.NewRecorder()
+	moveHandler(rec, httptest.NewRequest(http.MethodPost, "/api/transcripts/call.webm/move", strings.NewReader(`{"to":"@archive/2023"}`)), "call.webm")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body)
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&res)
+	if res.ID != "@archive/2023/call.webm" {
+		t.Fatalf("id=%q", res.ID)
+	}
+	if _, err := os.Stat(filepath.Join(archive, "2023", "call.txt")); err != nil {
+		t.Fatalf("transcript not moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "call.webm")); !os.IsNotExist(err) {
+		t.Fatalf("source left behind: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// zipExportHandler serves POST /api/export and /api/export/zip: given
+// {"ids": [...]}, {"query": "..."} (see parseSessionQuery) or both, it
+// streams a ZIP archive with every file of each selected session (audio,
+// parts, transcripts and sidecar metadata) at its path relative to the
+// recordings directory. With "profile" set, each session's export in that
+// profile is added under exports/. Progress is published as
+// export.progress events carrying the X-Export-ID response header's value.
+func zipExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		IDs     []string `json:"ids"`
+		Query   string   `json:"query"`
+		Profile string   `json:"profile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	payload.Query = strings.TrimSpace(payload.Query)
+	if len(payload.IDs) == 0 && payload.Query == "" {
+		http.Error(w, "no sessions selected", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve everything before the first byte is written so a bad ID or
+	// query is still reported with a proper status.
+	var opts *exportOptions
+	if payload.Profile != "" {
+		o, err := exportOptionsFromQuery(url.Values{"profile": {payload.Profile}})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts = &o
+	}
+	sessions, status, err := selectSessions(payload.IDs, payload.Query)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	exportID := randomID()
+	name := fmt.Sprintf("recordings-%s.zip", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Header().Set("X-Export-ID", exportID)
+	log := requestLogger(r).With("export", exportID)
+	// Headers are already sent once writing starts; a truncated archive
+	// and an export.failed event are the only signals left to the client.
+	fail := func(err error, args ...any) {
+		log.Error("zip export", append(args, "err", err)...)
+		publishEvent("export.failed", "", map[string]any{"id": exportID, "error": err.Error()})
+	}
+	zw := zip.NewWriter(w)
+	seen := map[string]bool{}
+	for n, s := range sessions {
+		for _, f := range s.Files {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+			if err := addZipFile(zw, f); err != nil {
+				fail(err, "path", f)
+				return
+			}
+		}
+		if opts != nil {
+			if err := addZipProfileExport(zw, s, *opts); err != nil {
+				fail(err, "session", s.ID, "profile", payload.Profile)
+				return
+			}
+		}
+		publishEvent("export.progress", s.ID, map[string]any{"id": exportID, "done": n + 1, "total": len(sessions)})
+	}
+	if err := zw.Close(); err != nil {
+		fail(err)
+		return
+	}
+	publishEvent("export.completed", "", map[string]any{"id": exportID, "sessions": len(sessions), "files": len(seen)})
+}
+
+func addZipFile(zw *zip.Writer, rel string) error {
+	f, err := os.Open(absPath(rel))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = rel
+	// Audio is already compressed; deflating it only costs CPU.
+	if isAudioFile(rel) {
+		hdr.Method = zip.Store
+	} else {
+		hdr.Method = zip.Deflate
+	}
+	dst, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// addZipProfileExport adds the session's transcript or audio rendered with
+// opts as exports/{id}.{format}. Sessions without a transcript or audio for
+// the profile's format are skipped.
+func addZipProfileExport(zw *zip.Writer, s *session, opts exportOptions) error {
+	name := "exports/" + s.ID + "." + exportExtension(opts.Format)
+	if audioExportFormats[opts.Format] {
+		if s.Audio == "" {
+			return nil
+		}
+		out, err := transcodeAudio(s, s.Audio, opts.Format, recordingProvenance(s.Audio))
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, f)
+		return err
+	}
+	if !s.hasTranscript() {
+		return nil
+	}
+	rel := s.TranscriptJSON
+	if rel == "" {
+		rel = s.Transcript
+	}
+	body, err := renderTranscriptExport(rel, opts, recordingProvenance(rel))
+	if err != nil {
+		return err
+	}
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(dst, body)
+	return err
+}
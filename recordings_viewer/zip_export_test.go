@@ -0,0 +1,116 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestZipExportStreamsSelectedSessions(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a/talk.webm", "a/talk.txt", "a/talk.meta.json", "b/other.webm", "skip.webm")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"ids":["a/talk","b/other.webm"]}`))
+	zipExportHandler(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("status=%d headers=%v body=%s", rec.Code, rec.Header(), rec.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name == "a/talk.webm" && f.Method != zip.Store {
+			t.Fatalf("audio should be stored, method=%d", f.Method)
+		}
+		if f.Name == "a/talk.txt" {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != "a/talk.txt" {
+				t.Fatalf("talk.txt=%q", data)
+			}
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a/talk.meta.json,a/talk.txt,a/talk.webm,b/other.webm" {
+		t.Fatalf("names=%v", names)
+	}
+}
+
+func TestZipExportRejectsUnknownSession(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "talk.webm")
+	rec := httptest.NewRecorder()
+	zipExportHandler(rec, httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"ids":["talk","missing"]}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status=%d", rec.Code)
+	}
+}
+
+func TestZipExportByQuery(t *testing.T) {
+	dir := useTempBaseDir(t)
+	writeTestFiles(t, dir, "a/talk.webm", "b/other.webm", "b/other.txt", "c/third.webm")
+	if err := os.WriteFile(filepath.Join(dir, "a", "talk.txt"), []byte("Notes from the budget review."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"a/talk.webm", "b/other.webm"} {
+		if err := saveMeta(absPath(f), recordingMeta{Tags: []string{"interview"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/export/zip", strings.NewReader(`{"query":"tag:interview budget"}`)))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Export-ID") == "" {
+		t.Fatalf("status=%d headers=%v body=%s", rec.Code, rec.Header(), rec.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a/talk.meta.json,a/talk.txt,a/talk.webm" {
+		t.Fatalf("names=%v", names)
+	}
+
+	var types []string
+	for len(ch) > 0 {
+		ev := <-ch
+		if ev.Data["id"] != rec.Header().Get("X-Export-ID") {
+			t.Fatalf("event %s has id %v", ev.Type, ev.Data["id"])
+		}
+		types = append(types, ev.Type)
+	}
+	if strings.Join(types, ",") != "export.progress,export.completed" {
+		t.Fatalf("events=%v", types)
+	}
+
+	for body, want := range map[string]int{
+		`{"query":"tag:nothing"}`: http.StatusNotFound,
+		`{"query":"after:soon"}`:  http.StatusBadRequest,
+		`{"query":"  "}`:          http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		zipExportHandler(rec, httptest.NewRequest(http.MethodPost, "/api/export/zip", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("%s: status=%d want %d", body, rec.Code, want)
+		}
+	}
+}
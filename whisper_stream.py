@@ -0,0 +1,88 @@
+"""
+Streaming transcription backend for the recordings viewer's /ws/transcribe relay.
+
+Audio arrives on stdin (either a continuous WebM stream as produced by
+MediaRecorder, or raw 16-bit little-endian mono PCM). Whenever enough new audio
+has accumulated the buffer is re-transcribed and a JSON line is printed:
+
+    {"type": "partial", "text": "..."}
+
+At end of input a final {"type": "final", "text": "..."} line is emitted.
+"""
+
+import argparse
+import json
+import logging
+import sys
+
+import numpy as np
+import whisper
+
+from whisper_host_utils import convert_webm_to_wav_array
+
+logger = logging.getLogger("whisper_stream")
+
+
+def emit(event_type, text):
+    sys.stdout.write(json.dumps({"type": event_type, "text": text}, ensure_ascii=False) + "\n")
+    sys.stdout.flush()
+
+
+def decode(buffer, fmt, rate):
+    if fmt == "pcm_s16le":
+        samples = np.frombuffer(bytes(buffer[: len(buffer) // 2 * 2]), dtype="<i2")
+        audio = samples.astype(np.float32) / 32768.0
+        if rate != 16000 and len(audio):
+            positions = np.linspace(0, len(audio) - 1, int(len(audio) * 16000 / rate))
+            audio = np.interp(positions, np.arange(len(audio)), audio).astype(np.float32)
+        return audio
+    return convert_webm_to_wav_array(bytes(buffer))
+
+
+def main():
+    parser = argparse.ArgumentParser(description=__doc__)
+    parser.add_argument("--format", choices=["webm", "pcm_s16le"], default="webm")
+    parser.add_argument("--rate", type=int, default=16000)
+    parser.add_argument("--model", default="base")
+    parser.add_argument("--interval", type=float, default=3.0, help="seconds of new audio between partials")
+    args = parser.parse_args()
+
+    logging.basicConfig(stream=sys.stderr, level=logging.INFO)
+    model = whisper.load_model(args.model)
+    logger.info("streaming backend ready (format=%s rate=%s)", args.format, args.rate)
+
+    # Bytes per second only applies to PCM; for WebM use a rough Opus bitrate.
+    bytes_per_second = args.rate * 2 if args.format == "pcm_s16le" else 4000
+    threshold = int(bytes_per_second * args.interval)
+
+    buffer = bytearray()
+    pending = 0
+    last_text = ""
+    while True:
+        chunk = sys.stdin.buffer.read1(65536)
+        if not chunk:
+            break
+        buffer.extend(chunk)
+        pending += len(chunk)
+        if pending < threshold:
+            continue
+        pending = 0
+        try:
+            text = model.transcribe(decode(buffer, args.format, args.rate)).get("text", "").strip()
+        except Exception:
+            logger.exception("partial transcription failed")
+            continue
+        if text and text != last_text:
+            last_text = text
+            emit("partial", text)
+
+    if buffer:
+        try:
+            last_text = model.transcribe(decode(buffer, args.format, args.rate)).get("text", "").strip()
+        except Exception:
+            logger.exception("final transcription failed")
+    emit("final", last_text)
+
+
+if __name__ == "__main__":
+    main()